@@ -0,0 +1,372 @@
+package api
+
+import (
+	"api-server/db"
+	"api-server/models"
+	"api-server/utils"
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"go.uber.org/zap"
+)
+
+// UserInvitationNewReq is the request body to invite a user. The role is user if not passed.
+type UserInvitationNewReq struct {
+	Email string `json:"email" validate:"required,email,max=254"`
+	Role  string `json:"role" validate:"omitempty,oneof=admin user"`
+}
+
+// AdminUserRes is a user as listed to admins
+type AdminUserRes struct {
+	ID          bson.ObjectID `json:"id"`
+	Login       string        `json:"login"`
+	Name        string        `json:"name"`
+	Email       string        `json:"email"`
+	AvatarURL   string        `json:"avatarURL"`
+	Providers   []string      `json:"providers"`
+	Role        string        `json:"role"`
+	SuspendedAt *time.Time    `json:"suspendedAt,omitempty"`
+	CreatedAt   time.Time     `json:"createdAt"`
+}
+
+// AdminUsers handles the users of the server and their invitations, for admins only.
+type AdminUsers struct {
+	client              *mongo.Client
+	collProfiles        *mongo.Collection
+	collUserInvitations *mongo.Collection
+	collRefreshTokens   *mongo.Collection
+	deletion            *profileDeletion
+	logger              *zap.SugaredLogger
+	validate            *validator.Validate
+}
+
+// NewAdminUsers constructs an AdminUsers handler with the given dependencies.
+func NewAdminUsers(logger *zap.SugaredLogger, client *mongo.Client, validate *validator.Validate) *AdminUsers {
+	colls := db.GetCollections(client)
+	return &AdminUsers{
+		client:              client,
+		collProfiles:        colls.Profiles,
+		collUserInvitations: colls.UserInvitations,
+		collRefreshTokens:   colls.RefreshTokens,
+		deletion:            newProfileDeletion(logger, client),
+		logger:              logger,
+		validate:            validate,
+	}
+}
+
+// GetInvitations returns the invitations, i.e. the emails allowed to sign up, oldest first.
+func (au *AdminUsers) GetInvitations(c *gin.Context) {
+	au.logger.Info("REST - GET - GetInvitations called")
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	cur, err := au.collUserInvitations.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}}))
+	if err != nil {
+		au.logger.Errorf("REST - GET - GetInvitations - cannot find invitations, err = %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot get invitations"})
+		return
+	}
+	invitations := make([]models.UserInvitation, 0)
+	if err = cur.All(ctx, &invitations); err != nil {
+		au.logger.Errorf("REST - GET - GetInvitations - cannot read invitations, err = %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot get invitations"})
+		return
+	}
+	c.JSON(http.StatusOK, invitations)
+}
+
+// PostInvitation invites an email, so its user can sign up with any login having that verified email.
+func (au *AdminUsers) PostInvitation(c *gin.Context) {
+	au.logger.Info("REST - POST - PostInvitation called")
+
+	var invitationBody UserInvitationNewReq
+	if err := c.ShouldBindJSON(&invitationBody); err != nil {
+		au.logger.Errorf("REST - POST - PostInvitation - Cannot bind request body. Err = %v\n", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request payload"})
+		return
+	}
+	if err := au.validate.Struct(invitationBody); err != nil {
+		au.logger.Errorf("REST - POST - PostInvitation - request body is not valid, err %#v", err)
+		var errFields = utils.GetErrorMessage(err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body, these fields are not valid:" + errFields})
+		return
+	}
+
+	admin, err := utils.GetProfileFromContext(c)
+	if err != nil {
+		au.logger.Error("REST - POST - PostInvitation - cannot find profile")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "cannot find profile"})
+		return
+	}
+
+	role := invitationBody.Role
+	if role == "" {
+		role = models.ProfileRoleUser
+	}
+	invitation := models.UserInvitation{
+		ID:        bson.NewObjectID(),
+		Email:     utils.NormalizeEmail(invitationBody.Email),
+		Role:      role,
+		InvitedBy: &admin.ID,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	if _, err = au.collUserInvitations.InsertOne(ctx, invitation); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			au.logger.Errorf("REST - POST - PostInvitation - email already invited")
+			c.JSON(http.StatusConflict, gin.H{"error": "email already invited"})
+			return
+		}
+		au.logger.Errorf("REST - POST - PostInvitation - cannot save invitation, err = %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot create invitation"})
+		return
+	}
+
+	au.logger.Infow("AUDIT - user invited",
+		"profileID", admin.ID.Hex(),
+		"invitationID", invitation.ID.Hex(),
+		"role", invitation.Role,
+	)
+	c.JSON(http.StatusOK, invitation)
+}
+
+// DeleteInvitation removes an email from the allowed ones. A profile already created with it is not changed,
+// suspend or delete it to remove the access.
+func (au *AdminUsers) DeleteInvitation(c *gin.Context) {
+	au.logger.Info("REST - DELETE - DeleteInvitation called")
+
+	invitationID, err := bson.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		au.logger.Error("REST - DELETE - DeleteInvitation - wrong format of the path param 'id'")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "wrong format of the path param 'id'"})
+		return
+	}
+
+	admin, err := utils.GetProfileFromContext(c)
+	if err != nil {
+		au.logger.Error("REST - DELETE - DeleteInvitation - cannot find profile")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "cannot find profile"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	res, err := au.collUserInvitations.DeleteOne(ctx, bson.M{"_id": invitationID})
+	if err != nil {
+		au.logger.Errorf("REST - DELETE - DeleteInvitation - cannot delete invitation, err = %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot delete invitation"})
+		return
+	}
+	if res.DeletedCount == 0 {
+		au.logger.Errorf("REST - DELETE - DeleteInvitation - cannot find invitation with id: %v", invitationID)
+		c.JSON(http.StatusNotFound, gin.H{"error": "invitation not found"})
+		return
+	}
+
+	au.logger.Infow("AUDIT - user invitation deleted",
+		"profileID", admin.ID.Hex(),
+		"invitationID", invitationID.Hex(),
+	)
+	c.JSON(http.StatusOK, gin.H{"message": "invitation has been deleted"})
+}
+
+// GetUsers returns the profiles of the server, oldest first.
+func (au *AdminUsers) GetUsers(c *gin.Context) {
+	au.logger.Info("REST - GET - GetUsers called")
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	cur, err := au.collProfiles.Find(ctx, bson.M{}, options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: 1}}).
+		SetProjection(bson.M{"github": 1, "identities": 1, "role": 1, "suspendedAt": 1, "createdAt": 1}))
+	if err != nil {
+		au.logger.Errorf("REST - GET - GetUsers - cannot find profiles, err = %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot get users"})
+		return
+	}
+	var profiles []models.Profile
+	if err = cur.All(ctx, &profiles); err != nil {
+		au.logger.Errorf("REST - GET - GetUsers - cannot read profiles, err = %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot get users"})
+		return
+	}
+
+	users := utils.MapSlice(profiles, func(profile models.Profile) AdminUserRes {
+		identity := profile.MainIdentity()
+		role := profile.Role
+		if role == "" {
+			role = models.ProfileRoleUser
+		}
+		providers := utils.MapSlice(profile.Identities, func(identity models.Identity) string {
+			return identity.Provider
+		})
+		if len(profile.Identities) == 0 {
+			providers = []string{models.IdentityProviderGitHub}
+		}
+		return AdminUserRes{
+			ID:          profile.ID,
+			Login:       identity.Login,
+			Name:        identity.Name,
+			Email:       identity.Email,
+			AvatarURL:   identity.AvatarURL,
+			Providers:   providers,
+			Role:        role,
+			SuspendedAt: profile.SuspendedAt,
+			CreatedAt:   profile.CreatedAt,
+		}
+	})
+	c.JSON(http.StatusOK, users)
+}
+
+// PostSuspendUser suspends a profile: its tokens are rejected and its sessions are revoked, until it is reactivated.
+func (au *AdminUsers) PostSuspendUser(c *gin.Context) {
+	au.logger.Info("REST - POST - PostSuspendUser called")
+
+	admin, profileID, ok := au.getTargetProfile(c, "PostSuspendUser")
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+	now := time.Now().UTC()
+
+	res, err := au.collProfiles.UpdateOne(ctx, bson.M{
+		"_id": profileID,
+	}, bson.M{
+		"$set": bson.M{"suspendedAt": now, "modifiedAt": now},
+	})
+	if err != nil {
+		au.logger.Errorf("REST - POST - PostSuspendUser - cannot suspend profile, err = %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot suspend user"})
+		return
+	}
+	if res.MatchedCount == 0 {
+		au.logger.Errorf("REST - POST - PostSuspendUser - cannot find profile with id: %v", profileID)
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+	// access tokens are rejected by the middleware, refresh tokens are revoked to log out everywhere
+	_, err = au.collRefreshTokens.UpdateMany(ctx,
+		bson.M{"profileId": profileID, "revokedAt": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revokedAt": now}},
+	)
+	if err != nil {
+		au.logger.Errorf("REST - POST - PostSuspendUser - cannot revoke refresh tokens, err = %v", err)
+	}
+
+	au.logger.Infow("AUDIT - user suspended",
+		"profileID", admin.ID.Hex(),
+		"suspendedProfileID", profileID.Hex(),
+	)
+	c.JSON(http.StatusOK, gin.H{"message": "user has been suspended"})
+}
+
+// PostReactivateUser removes the suspension of a profile, that must log in again.
+func (au *AdminUsers) PostReactivateUser(c *gin.Context) {
+	au.logger.Info("REST - POST - PostReactivateUser called")
+
+	admin, profileID, ok := au.getTargetProfile(c, "PostReactivateUser")
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	res, err := au.collProfiles.UpdateOne(ctx, bson.M{
+		"_id": profileID,
+	}, bson.M{
+		"$unset": bson.M{"suspendedAt": ""},
+		"$set":   bson.M{"modifiedAt": time.Now().UTC()},
+	})
+	if err != nil {
+		au.logger.Errorf("REST - POST - PostReactivateUser - cannot reactivate profile, err = %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot reactivate user"})
+		return
+	}
+	if res.MatchedCount == 0 {
+		au.logger.Errorf("REST - POST - PostReactivateUser - cannot find profile with id: %v", profileID)
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+
+	au.logger.Infow("AUDIT - user reactivated",
+		"profileID", admin.ID.Hex(),
+		"reactivatedProfileID", profileID.Hex(),
+	)
+	c.JSON(http.StatusOK, gin.H{"message": "user has been reactivated"})
+}
+
+// DeleteUser deletes a profile with everything it owns, like users deleting their account.
+// Its invitation is deleted too, so the user cannot sign up again unless invited.
+func (au *AdminUsers) DeleteUser(c *gin.Context) {
+	au.logger.Info("REST - DELETE - DeleteUser called")
+
+	admin, profileID, ok := au.getTargetProfile(c, "DeleteUser")
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+	defer cancel()
+
+	result, err := au.deletion.deleteProfile(ctx, bson.M{"_id": profileID})
+	if errors.Is(err, errProfileDeletionNotFound) {
+		au.logger.Errorf("REST - DELETE - DeleteUser - cannot find profile with id: %v", profileID)
+		c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+		return
+	}
+	if err != nil {
+		au.logger.Errorf("REST - DELETE - DeleteUser - cannot delete profile in transaction, err = %#v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot delete user"})
+		return
+	}
+
+	// only the admin is recorded, the deleted profile must not be traceable
+	au.logger.Infow("AUDIT - user deleted",
+		"profileID", admin.ID.Hex(),
+		"homesDeleted", result.HomesDeleted,
+		"homesLeft", result.HomesLeft,
+		"devicesDeleted", result.DevicesDeleted,
+	)
+	c.JSON(http.StatusOK, gin.H{"message": "user has been deleted"})
+}
+
+// ------------------------------ Private methods ------------------------------
+
+// getTargetProfile returns the admin and the profile of the path param 'id', that must not be the admin.
+// Admins cannot suspend or delete themselves, so there is always an admin.
+func (au *AdminUsers) getTargetProfile(c *gin.Context, handlerName string) (utils.SessionProfile, bson.ObjectID, bool) {
+	profileID, err := bson.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		au.logger.Errorf("REST - %s - wrong format of the path param 'id'", handlerName)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "wrong format of the path param 'id'"})
+		return utils.SessionProfile{}, bson.ObjectID{}, false
+	}
+	admin, err := utils.GetProfileFromContext(c)
+	if err != nil {
+		au.logger.Errorf("REST - %s - cannot find profile", handlerName)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "cannot find profile"})
+		return utils.SessionProfile{}, bson.ObjectID{}, false
+	}
+	if admin.ID == profileID {
+		au.logger.Errorf("REST - %s - admins cannot change themselves", handlerName)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "you cannot suspend or delete yourself"})
+		return utils.SessionProfile{}, bson.ObjectID{}, false
+	}
+	return admin, profileID, true
+}
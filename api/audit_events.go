@@ -0,0 +1,131 @@
+package api
+
+import (
+	"api-server/db"
+	"api-server/models"
+	"api-server/utils"
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"go.uber.org/zap"
+)
+
+const defaultAuditEventsLimit = 50
+const maxAuditEventsLimit = 200
+
+// AuditEventsRes is a page of audit events, from the most recent one
+type AuditEventsRes struct {
+	Events []models.AuditEvent `json:"events"`
+	// NextBefore is the value of the query param 'before' to get the next page, empty on the last page
+	NextBefore string `json:"nextBefore,omitempty"`
+}
+
+// AuditEvents handles the audit log of profiles, written by AuditLog.
+type AuditEvents struct {
+	collProfiles    *mongo.Collection
+	collAuditEvents *mongo.Collection
+	logger          *zap.SugaredLogger
+}
+
+// NewAuditEvents constructs an AuditEvents handler with the given dependencies.
+func NewAuditEvents(logger *zap.SugaredLogger, client *mongo.Client) *AuditEvents {
+	return &AuditEvents{
+		collProfiles:    db.GetCollections(client).Profiles,
+		collAuditEvents: db.GetCollections(client).AuditEvents,
+		logger:          logger,
+	}
+}
+
+// GetAuditEvents returns a page of audit events of the logged profile, from the most recent one.
+// Query params: `limit`, `before` (the `nextBefore` of the previous page), `action`, `outcome`,
+// and `from`, `to` as RFC3339 dates.
+func (ae *AuditEvents) GetAuditEvents(c *gin.Context) {
+	ae.logger.Info("REST - GET - GetAuditEvents called")
+
+	limit := defaultAuditEventsLimit
+	if rawLimit := c.Query("limit"); rawLimit != "" {
+		parsed, err := strconv.Atoi(rawLimit)
+		if err != nil || parsed <= 0 || parsed > maxAuditEventsLimit {
+			ae.logger.Errorf("REST - GET - GetAuditEvents - wrong format of query param 'limit': %s", rawLimit)
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("the query param 'limit' must be a number between 1 and %d", maxAuditEventsLimit)})
+			return
+		}
+		limit = parsed
+	}
+
+	profile, err := utils.GetLoggedProfileFromContext(c, ae.collProfiles)
+	if err != nil {
+		ae.logger.Error("REST - GET - GetAuditEvents - cannot find profile")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "cannot find profile"})
+		return
+	}
+
+	filter := bson.M{"actorId": profile.ID}
+	if rawBefore := c.Query("before"); rawBefore != "" {
+		before, errBefore := bson.ObjectIDFromHex(rawBefore)
+		if errBefore != nil {
+			ae.logger.Error("REST - GET - GetAuditEvents - wrong format of query param 'before'")
+			c.JSON(http.StatusBadRequest, gin.H{"error": "wrong format of the query param 'before'"})
+			return
+		}
+		filter["_id"] = bson.M{"$lt": before}
+	}
+	if action := c.Query("action"); action != "" {
+		filter["action"] = action
+	}
+	if outcome := c.Query("outcome"); outcome != "" {
+		if outcome != string(models.AuditOutcomeSuccess) && outcome != string(models.AuditOutcomeFailure) {
+			ae.logger.Errorf("REST - GET - GetAuditEvents - outcome '%s' is not valid", outcome)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "the query param 'outcome' must be success or failure"})
+			return
+		}
+		filter["outcome"] = outcome
+	}
+	createdAt := bson.M{}
+	for param, operator := range map[string]string{"from": "$gte", "to": "$lt"} {
+		raw := c.Query(param)
+		if raw == "" {
+			continue
+		}
+		parsed, errTime := time.Parse(time.RFC3339, raw)
+		if errTime != nil {
+			ae.logger.Errorf("REST - GET - GetAuditEvents - wrong format of query param '%s', err = %v", param, errTime)
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("wrong format of the query param '%s', it must be a RFC3339 date", param)})
+			return
+		}
+		createdAt[operator] = parsed.UTC()
+	}
+	if len(createdAt) > 0 {
+		filter["createdAt"] = createdAt
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	cur, err := ae.collAuditEvents.Find(ctx, filter,
+		options.Find().SetSort(bson.D{{Key: "_id", Value: -1}}).SetLimit(int64(limit)))
+	if err != nil {
+		ae.logger.Errorf("REST - GET - GetAuditEvents - cannot find audit events, err = %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot get audit events"})
+		return
+	}
+	defer cur.Close(ctx)
+
+	res := AuditEventsRes{Events: make([]models.AuditEvent, 0)}
+	if err = cur.All(ctx, &res.Events); err != nil {
+		ae.logger.Errorf("REST - GET - GetAuditEvents - cannot decode audit events, err = %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot get audit events"})
+		return
+	}
+	if len(res.Events) == limit {
+		res.NextBefore = res.Events[len(res.Events)-1].ID.Hex()
+	}
+	c.JSON(http.StatusOK, res)
+}
@@ -0,0 +1,205 @@
+package api
+
+import (
+	authpkg "api-server/auth"
+	"api-server/db"
+	"api-server/models"
+	"api-server/utils"
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"go.uber.org/zap"
+)
+
+const (
+	// auditQueueSize is the number of events waiting to be written, before callers are slowed down
+	auditQueueSize = 1024
+	// auditEnqueueTimeout is how long a caller waits while the queue is full, then its event is dropped
+	auditEnqueueTimeout = 100 * time.Millisecond
+	// auditBatchSize is the max number of events written at once
+	auditBatchSize = 100
+	// auditFlushInterval is how often queued events are written, when they are less than auditBatchSize
+	auditFlushInterval = time.Second
+	auditWriteTimeout  = 5 * time.Second
+	// maxAuditUserAgentLength truncates user agents, they are chosen by clients
+	maxAuditUserAgentLength = 256
+)
+
+// AuditLog writes audit events to the audit_events collection in background, in batches.
+// Handlers record events without waiting for the database, but when the queue is full they are slowed down
+// for a while, then events are dropped. The "AUDIT - ..." log lines remain the complete record.
+// A nil AuditLog ignores everything.
+type AuditLog struct {
+	collAuditEvents *mongo.Collection
+	logger          *zap.SugaredLogger
+
+	queue     chan models.AuditEvent
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewAuditLog constructs an AuditLog and starts its writer, that runs until Close.
+// It must be shared by all handlers recording events.
+func NewAuditLog(logger *zap.SugaredLogger, client *mongo.Client) *AuditLog {
+	a := &AuditLog{
+		collAuditEvents: db.GetCollections(client).AuditEvents,
+		logger:          logger,
+		queue:           make(chan models.AuditEvent, auditQueueSize),
+		stop:            make(chan struct{}),
+		done:            make(chan struct{}),
+	}
+	go a.run()
+	return a
+}
+
+// Close writes the queued events and stops the writer, waiting until ctx is done.
+// Events recorded after Close are dropped.
+func (a *AuditLog) Close(ctx context.Context) error {
+	if a == nil {
+		return nil
+	}
+	a.closeOnce.Do(func() {
+		close(a.stop)
+	})
+	select {
+	case <-a.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// ------------------------------ Private methods ------------------------------
+
+// record queues event of the request c, filling its id, time, IP, user agent and, if not set, client type.
+func (a *AuditLog) record(c *gin.Context, event models.AuditEvent) {
+	if a == nil {
+		return
+	}
+	request := newRequestAuditEvent(c)
+	event.IP = request.IP
+	event.UserAgent = request.UserAgent
+	if event.ClientType == "" {
+		event.ClientType = request.ClientType
+	}
+	a.recordEvent(event)
+}
+
+// recordEvent queues event as it is, filling only its id and time.
+// It's used without a request, e.g. by schedules and rules, or with the request fields of newRequestAuditEvent.
+func (a *AuditLog) recordEvent(event models.AuditEvent) {
+	if a == nil {
+		return
+	}
+	event.ID = bson.NewObjectID()
+	event.CreatedAt = time.Now().UTC()
+
+	select {
+	case a.queue <- event:
+		return
+	default:
+	}
+	timer := time.NewTimer(auditEnqueueTimeout)
+	defer timer.Stop()
+	select {
+	case a.queue <- event:
+	case <-timer.C:
+		a.logger.Errorw("AuditLog - queue is full, audit event dropped",
+			"action", event.Action,
+			"actorID", event.ActorID.Hex(),
+		)
+	}
+}
+
+// recordLogin records a login of profileID with a client of clientType, failed if err is not nil.
+// profileID is empty when the user is not known, e.g. without an invitation.
+func (a *AuditLog) recordLogin(c *gin.Context, profileID bson.ObjectID, clientType string, err error) {
+	event := models.AuditEvent{
+		ActorID:    profileID,
+		Action:     models.AuditActionLogin,
+		TargetType: models.AuditTargetProfile,
+		ClientType: clientType,
+		Outcome:    models.AuditOutcomeSuccess,
+	}
+	if !profileID.IsZero() {
+		event.TargetID = profileID.Hex()
+	}
+	if err != nil {
+		event.Outcome = models.AuditOutcomeFailure
+		switch {
+		case errors.Is(err, authpkg.ErrProfileSuspended):
+			event.Reason = "profile is suspended"
+		case errors.Is(err, authpkg.ErrLoginNotPermitted):
+			event.Reason = "login not permitted"
+		default:
+			event.Reason = "login failed"
+		}
+	}
+	a.record(c, event)
+}
+
+// newRequestAuditEvent returns an event with IP, user agent and client type of the request c,
+// to record actions done later on its behalf with recordEvent.
+func newRequestAuditEvent(c *gin.Context) models.AuditEvent {
+	event := models.AuditEvent{
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	}
+	if len(event.UserAgent) > maxAuditUserAgentLength {
+		event.UserAgent = strings.ToValidUTF8(event.UserAgent[:maxAuditUserAgentLength], "")
+	}
+	// without claims, e.g. on public routes, the client type stays empty
+	event.ClientType, _ = utils.GetClientTypeFromContext(c)
+	return event
+}
+
+// run writes queued events every auditFlushInterval, or as soon as there are auditBatchSize of them.
+func (a *AuditLog) run() {
+	defer close(a.done)
+	ticker := time.NewTicker(auditFlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]any, 0, auditBatchSize)
+	for {
+		select {
+		case event := <-a.queue:
+			batch = append(batch, event)
+			if len(batch) >= auditBatchSize {
+				a.write(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			a.write(batch)
+			batch = batch[:0]
+		case <-a.stop:
+			for {
+				select {
+				case event := <-a.queue:
+					batch = append(batch, event)
+				default:
+					a.write(batch)
+					return
+				}
+			}
+		}
+	}
+}
+
+func (a *AuditLog) write(batch []any) {
+	if len(batch) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), auditWriteTimeout)
+	defer cancel()
+	if _, err := a.collAuditEvents.InsertMany(ctx, batch, options.InsertMany().SetOrdered(false)); err != nil {
+		a.logger.Errorw("AuditLog - cannot write audit events", "events", len(batch), "error", err)
+	}
+}
@@ -0,0 +1,313 @@
+package api
+
+import (
+	"api-server/db"
+	"api-server/models"
+	"api-server/utils"
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.uber.org/zap"
+)
+
+const (
+	// dashboardDeadline bounds the whole dashboard, devices not read in time are marked with an error
+	dashboardDeadline = 3 * time.Second
+	// maxParallelDashboardDevices limits devices read at the same time,
+	// every device reads its sensors with maxParallelSensorReads
+	maxParallelDashboardDevices = 8
+)
+
+// DashboardDevice is a device with its current values and online status.
+// Values of features that cannot be read have an error, while Error is set if the device cannot be read at all.
+type DashboardDevice struct {
+	Device      models.Device               `json:"device"`
+	Values      []models.DeviceFeatureState `json:"values"`
+	Online      *models.Online              `json:"online,omitempty"`
+	OnlineError string                      `json:"onlineError,omitempty"`
+	Error       string                      `json:"error,omitempty"`
+}
+
+// DashboardRoom is a room with its devices.
+type DashboardRoom struct {
+	ID      bson.ObjectID     `json:"id"`
+	Name    string            `json:"name"`
+	Floor   int               `json:"floor"`
+	Devices []DashboardDevice `json:"devices"`
+}
+
+// DashboardResp is everything required to render a home, or a single room of it.
+type DashboardResp struct {
+	HomeID   bson.ObjectID   `json:"homeId"`
+	Name     string          `json:"name"`
+	Location string          `json:"location"`
+	Rooms    []DashboardRoom `json:"rooms"`
+	// Partial is true if at least a device, value or online status has an error
+	Partial bool `json:"partial"`
+}
+
+// Dashboard aggregates rooms, devices, values and online statuses of a home in a single response.
+type Dashboard struct {
+	client        *mongo.Client
+	collProfiles  *mongo.Collection
+	collHomes     *mongo.Collection
+	collDevices   *mongo.Collection
+	devicesValues *DevicesValues
+	online        *Online
+	logger        *zap.SugaredLogger
+}
+
+// NewDashboard constructs a Dashboard handler with the given dependencies.
+// Values are read through devicesValues, shared by all handlers, so they are recorded and evaluated by rules.
+func NewDashboard(logger *zap.SugaredLogger, client *mongo.Client, devicesValues *DevicesValues) *Dashboard {
+	return &Dashboard{
+		client:        client,
+		collProfiles:  db.GetCollections(client).Profiles,
+		collHomes:     db.GetCollections(client).Homes,
+		collDevices:   db.GetCollections(client).Devices,
+		devicesValues: devicesValues,
+		online:        NewOnline(logger, client),
+		logger:        logger,
+	}
+}
+
+// GetHomeDashboard returns all rooms of a home with their devices. Every member can read it.
+func (d *Dashboard) GetHomeDashboard(c *gin.Context) {
+	d.logger.Info("REST - GET - GetHomeDashboard called")
+	d.getDashboard(c, "GetHomeDashboard", false)
+}
+
+// GetRoomDashboard returns a single room of a home with its devices. Every member can read it.
+func (d *Dashboard) GetRoomDashboard(c *gin.Context) {
+	d.logger.Info("REST - GET - GetRoomDashboard called")
+	d.getDashboard(c, "GetRoomDashboard", true)
+}
+
+// ------------------------------ Private methods ------------------------------
+
+func (d *Dashboard) getDashboard(c *gin.Context, handlerName string, singleRoom bool) {
+	homeID, errID := bson.ObjectIDFromHex(c.Param("id"))
+	var roomID bson.ObjectID
+	var errRid error
+	if singleRoom {
+		roomID, errRid = bson.ObjectIDFromHex(c.Param("rid"))
+	}
+	if errID != nil || errRid != nil {
+		d.logger.Errorf("REST - GET - %s - wrong format of one of the path params", handlerName)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "wrong format of one of the path params"})
+		return
+	}
+
+	profile, err := utils.GetLoggedProfileFromContext(c, d.collProfiles)
+	if err != nil {
+		d.logger.Errorf("REST - GET - %s - cannot find profile", handlerName)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "cannot find profile"})
+		return
+	}
+	home, _, err := getHomeWithRole(c.Request.Context(), d.collHomes, &profile, homeID)
+	if err != nil {
+		d.logger.Errorf("REST - GET - %s - cannot access home, err = %v", handlerName, err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cannot get dashboard of an home that is not in your profile"})
+		return
+	}
+
+	rooms := home.Rooms
+	if singleRoom {
+		rooms = utils.FilterSlice(home.Rooms, func(room models.Room) bool {
+			return room.ID == roomID
+		})
+		if len(rooms) == 0 {
+			d.logger.Errorf("REST - GET - %s - cannot find room with id: %v", handlerName, roomID)
+			c.JSON(http.StatusNotFound, gin.H{"error": "room not found"})
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), dashboardDeadline)
+	defer cancel()
+	deviceIDs := make([]bson.ObjectID, 0)
+	for _, room := range rooms {
+		deviceIDs = append(deviceIDs, room.Devices...)
+	}
+	dashboardDevices, err := d.readDevices(ctx, deviceIDs)
+	if err != nil {
+		d.logger.Errorf("REST - GET - %s - cannot read devices, err = %v", handlerName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot get dashboard"})
+		return
+	}
+
+	resp := DashboardResp{
+		HomeID:   home.ID,
+		Name:     home.Name,
+		Location: home.Location,
+		Rooms:    make([]DashboardRoom, 0, len(rooms)),
+	}
+	for _, room := range rooms {
+		dashboardRoom := DashboardRoom{
+			ID:      room.ID,
+			Name:    room.Name,
+			Floor:   room.Floor,
+			Devices: make([]DashboardDevice, 0, len(room.Devices)),
+		}
+		for _, deviceID := range room.Devices {
+			dashboardDevice := dashboardDevices[deviceID]
+			if dashboardDevice.Error != "" || dashboardDevice.OnlineError != "" {
+				resp.Partial = true
+			}
+			for _, value := range dashboardDevice.Values {
+				if value.Error != "" {
+					resp.Partial = true
+				}
+			}
+			dashboardRoom.Devices = append(dashboardRoom.Devices, dashboardDevice)
+		}
+		resp.Rooms = append(resp.Rooms, dashboardRoom)
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// readDevices reads values and online statuses of devices concurrently, until ctx is done.
+// Devices that are not read in time have an error.
+func (d *Dashboard) readDevices(ctx context.Context, deviceIDs []bson.ObjectID) (map[bson.ObjectID]DashboardDevice, error) {
+	devices, owners, err := d.findDevicesWithOwners(ctx, deviceIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	type readResult struct {
+		deviceID        bson.ObjectID
+		dashboardDevice DashboardDevice
+	}
+	results := make(chan readResult, len(deviceIDs))
+	devicesLimit := make(chan struct{}, maxParallelDashboardDevices)
+	dashboardDevices := make(map[bson.ObjectID]DashboardDevice, len(deviceIDs))
+	pending := 0
+	for _, deviceID := range deviceIDs {
+		device, found := devices[deviceID]
+		if !found {
+			dashboardDevices[deviceID] = DashboardDevice{
+				Device: models.Device{ID: deviceID},
+				Values: []models.DeviceFeatureState{},
+				Error:  "device not found",
+			}
+			continue
+		}
+		if _, alreadyRead := dashboardDevices[deviceID]; alreadyRead {
+			continue
+		}
+		// placeholder replaced by the result, if it arrives before the deadline
+		dashboardDevices[deviceID] = DashboardDevice{
+			Device: device,
+			Values: []models.DeviceFeatureState{},
+			Error:  "cannot read device in time",
+		}
+		pending++
+		owner, hasOwner := owners[deviceID]
+		go func() {
+			select {
+			case devicesLimit <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			defer func() { <-devicesLimit }()
+			results <- readResult{deviceID: deviceID, dashboardDevice: d.readDevice(ctx, &device, owner, hasOwner)}
+		}()
+	}
+
+	for ; pending > 0; pending-- {
+		select {
+		case result := <-results:
+			dashboardDevices[result.deviceID] = result.dashboardDevice
+		case <-ctx.Done():
+			d.logger.Errorf("readDevices - deadline exceeded with %d devices to read", pending)
+			return dashboardDevices, nil
+		}
+	}
+	return dashboardDevices, nil
+}
+
+// readDevice reads values and online status of a single device. The online status is read while reading values.
+func (d *Dashboard) readDevice(ctx context.Context, device *models.Device, owner models.Profile, hasOwner bool) DashboardDevice {
+	dashboardDevice := DashboardDevice{Device: *device, Values: []models.DeviceFeatureState{}}
+
+	onlineFeature := utils.GetOnlineFeature(device.Features)
+	onlineDone := make(chan struct{})
+	if onlineFeature != nil {
+		go func() {
+			defer close(onlineDone)
+			online, err := d.online.readOnline(ctx, device, onlineFeature)
+			if err != nil {
+				d.logger.Errorf("readDevice - cannot get online of device %s, err = %v", device.ID.Hex(), err)
+				dashboardDevice.OnlineError = "cannot get online"
+				return
+			}
+			dashboardDevice.Online = &online
+		}()
+	} else {
+		close(onlineDone)
+	}
+
+	// the online status is returned on its own
+	valuesDevice := *device
+	valuesDevice.Features = utils.FilterSlice(device.Features, func(feature models.Feature) bool {
+		return onlineFeature == nil || feature.UUID != onlineFeature.UUID
+	})
+	apiToken := ""
+	var errToken error
+	if hasControllerFeatures(&valuesDevice) {
+		if !hasOwner {
+			errToken = errDeviceOwnerNotFound
+		} else {
+			apiToken, errToken = decryptProfileAPIToken(&owner)
+		}
+	}
+	if errToken != nil {
+		d.logger.Errorf("readDevice - cannot load api token of device %s, err = %v", device.ID.Hex(), errToken)
+		dashboardDevice.Error = "cannot get device values"
+	} else {
+		dashboardDevice.Values = d.devicesValues.readDeviceValues(ctx, &valuesDevice, apiToken)
+	}
+
+	<-onlineDone
+	return dashboardDevice
+}
+
+// findDevicesWithOwners loads devices with deviceIDs and the profiles owning them, by device id.
+func (d *Dashboard) findDevicesWithOwners(ctx context.Context, deviceIDs []bson.ObjectID) (map[bson.ObjectID]models.Device, map[bson.ObjectID]models.Profile, error) {
+	devices := make(map[bson.ObjectID]models.Device, len(deviceIDs))
+	owners := make(map[bson.ObjectID]models.Profile, len(deviceIDs))
+	if len(deviceIDs) == 0 {
+		return devices, owners, nil
+	}
+
+	cur, err := d.collDevices.Find(ctx, bson.M{"_id": bson.M{"$in": deviceIDs}})
+	if err != nil {
+		return nil, nil, err
+	}
+	var deviceList []models.Device
+	if err = cur.All(ctx, &deviceList); err != nil {
+		return nil, nil, err
+	}
+	for _, device := range deviceList {
+		devices[device.ID] = device
+	}
+
+	cur, err = d.collProfiles.Find(ctx, bson.M{"devices": bson.M{"$in": deviceIDs}})
+	if err != nil {
+		return nil, nil, err
+	}
+	var profiles []models.Profile
+	if err = cur.All(ctx, &profiles); err != nil {
+		return nil, nil, err
+	}
+	for _, profile := range profiles {
+		for _, deviceID := range profile.Devices {
+			owners[deviceID] = profile
+		}
+	}
+	return devices, owners, nil
+}
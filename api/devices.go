@@ -6,9 +6,11 @@ import (
 	"api-server/models"
 	"api-server/utils"
 	"context"
+	"errors"
 	"net/http"
 	"net/url"
 	"os"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -20,6 +22,9 @@ import (
 	"go.uber.org/zap"
 )
 
+// maxPatchDeviceAttempts is how many times PatchDevice reads and updates a device changed at the same time
+const maxPatchDeviceAttempts = 3
+
 // AssignDeviceReq is the request body for assigning a device to a home room.
 type AssignDeviceReq struct {
 	HomeID string `json:"homeId" validate:"required"`
@@ -27,12 +32,30 @@ type AssignDeviceReq struct {
 	Name   string `json:"name" validate:"omitempty,max=32"`
 }
 
+// DeviceLocation is the home room of a device, among the homes of the logged profile.
+type DeviceLocation struct {
+	HomeID   bson.ObjectID `json:"homeId"`
+	HomeName string        `json:"homeName"`
+	RoomID   bson.ObjectID `json:"roomId"`
+	RoomName string        `json:"roomName"`
+}
+
+// DeviceRes is a device returned by GetDevices, with its location or null if it isn't assigned to a room.
+type DeviceRes struct {
+	models.Device
+	Location *DeviceLocation `json:"location"`
+}
+
 // Devices handles device registration, lookup, and deletion.
 type Devices struct {
 	client          *mongo.Client
 	collDevices     *mongo.Collection
 	collProfiles    *mongo.Collection
 	collHomes       *mongo.Collection
+	collScenes      *mongo.Collection
+	collSchedules   *mongo.Collection
+	collRules       *mongo.Collection
+	events          *EventsHub
 	logger          *zap.SugaredLogger
 	validate        *validator.Validate
 	grpcTarget      string
@@ -40,7 +63,7 @@ type Devices struct {
 }
 
 // NewDevices constructs a Devices handler with the given dependencies.
-func NewDevices(logger *zap.SugaredLogger, client *mongo.Client, validate *validator.Validate) *Devices {
+func NewDevices(logger *zap.SugaredLogger, client *mongo.Client, validate *validator.Validate, events *EventsHub) *Devices {
 	grpcURL := os.Getenv("GRPC_URL")
 	onlineServerURL := os.Getenv("HTTP_ONLINE_SERVER") + ":" + os.Getenv("HTTP_ONLINE_PORT")
 	onlineByUUIDURL := onlineServerURL + os.Getenv("HTTP_ONLINE_API")
@@ -50,6 +73,10 @@ func NewDevices(logger *zap.SugaredLogger, client *mongo.Client, validate *valid
 		collDevices:     db.GetCollections(client).Devices,
 		collProfiles:    db.GetCollections(client).Profiles,
 		collHomes:       db.GetCollections(client).Homes,
+		collScenes:      db.GetCollections(client).Scenes,
+		collSchedules:   db.GetCollections(client).Schedules,
+		collRules:       db.GetCollections(client).Rules,
+		events:          events,
 		logger:          logger,
 		validate:        validate,
 		grpcTarget:      grpcURL,
@@ -57,10 +84,22 @@ func NewDevices(logger *zap.SugaredLogger, client *mongo.Client, validate *valid
 	}
 }
 
-// GetDevices function
+// GetDevices returns the devices of the logged profile with their locations.
+// The optional query param `assigned` keeps only devices assigned, or not assigned, to a room.
 func (d *Devices) GetDevices(c *gin.Context) {
 	d.logger.Info("REST - GET - GetDevices called")
 
+	var assignedFilter *bool
+	if rawAssigned := c.Query("assigned"); rawAssigned != "" {
+		assigned, errAssigned := strconv.ParseBool(rawAssigned)
+		if errAssigned != nil {
+			d.logger.Errorf("REST - GET - GetDevices - wrong format of query param 'assigned': %s", rawAssigned)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "wrong format of the query param 'assigned'"})
+			return
+		}
+		assignedFilter = &assigned
+	}
+
 	// retrieve current profile identity from the authenticated context
 	profileSession, err := utils.GetProfileFromContext(c)
 	if err != nil {
@@ -80,9 +119,23 @@ func (d *Devices) GetDevices(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "cannot find profile"})
 		return
 	}
+	// collect devices owned by the profile and devices assigned to rooms of homes shared with it
+	deviceIDs, locations, err := d.getAccessibleDevices(c.Request.Context(), &profile)
+	if err != nil {
+		d.logger.Errorf("REST - GET - GetDevices - cannot get homes of profile, err = %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot find device in profile"})
+		return
+	}
+	if assignedFilter != nil {
+		deviceIDs = utils.FilterSlice(deviceIDs, func(deviceID bson.ObjectID) bool {
+			_, found := locations[deviceID]
+			return found == *assignedFilter
+		})
+	}
+
 	// extract Devices from db
 	cur, errDevices := d.collDevices.Find(c.Request.Context(), bson.M{
-		"_id": bson.M{"$in": profile.Devices},
+		"_id": bson.M{"$in": deviceIDs},
 	})
 	if errDevices != nil {
 		d.logger.Error("REST - GET - GetDevices - cannot find device in profile")
@@ -91,14 +144,14 @@ func (d *Devices) GetDevices(c *gin.Context) {
 	}
 	defer cur.Close(c.Request.Context())
 
-	devices := make([]models.Device, 0)
+	devices := make([]DeviceRes, 0)
 	for cur.Next(c.Request.Context()) {
 		var device models.Device
 		if err := cur.Decode(&device); err != nil {
 			d.logger.Errorf("REST - GET - GetDevices - cannot decode device, err = %v", err)
 			continue
 		}
-		devices = append(devices, device)
+		devices = append(devices, DeviceRes{Device: device, Location: locations[device.ID]})
 	}
 	c.JSON(http.StatusOK, devices)
 }
@@ -152,6 +205,9 @@ func (d *Devices) DeleteDevice(c *gin.Context) {
 		return
 	}
 
+	// profiles lose access to the device with the transaction
+	audience := d.events.deviceAudience(c.Request.Context(), objectID)
+
 	// start-session
 	dbSession, err := d.client.StartSession()
 	if err != nil {
@@ -166,10 +222,9 @@ func (d *Devices) DeleteDevice(c *gin.Context) {
 		// Official `mongo-driver` documentation state: "callback may be run
 		// multiple times during WithTransaction due to retry attempts, so it must be idempotent."
 
-		// update all rooms of homes owned by the profile removing the deviceId
+		// update all rooms of every home containing the deviceId, including homes shared with other profiles
 		filter := bson.M{
-			// filter homes owned by the profile
-			"_id": bson.M{"$in": profile.Homes},
+			"rooms.devices": objectID,
 		}
 		update := bson.M{
 			"$pull": bson.M{
@@ -192,6 +247,37 @@ func (d *Devices) DeleteDevice(c *gin.Context) {
 			return nil, err
 		}
 
+		// remove the device from all scenes using it
+		if _, err := d.collScenes.UpdateMany(
+			sessionCtx,
+			bson.M{"steps.deviceId": objectID},
+			bson.M{"$pull": bson.M{"steps": bson.M{"deviceId": objectID}}},
+		); err != nil {
+			d.logger.Errorf("REST - DELETE - DeleteDevices - cannot remove device from scenes, err = %#v", err)
+			return nil, err
+		}
+
+		// schedules target a single device, so they are useless without it
+		if _, err := d.collSchedules.DeleteMany(sessionCtx, bson.M{"deviceId": objectID}); err != nil {
+			d.logger.Errorf("REST - DELETE - DeleteDevices - cannot remove schedules of device, err = %#v", err)
+			return nil, err
+		}
+
+		// rules cannot be evaluated without the device of their condition,
+		// the other ones only lose the actions on this device
+		if _, err := d.collRules.DeleteMany(sessionCtx, bson.M{"condition.deviceId": objectID}); err != nil {
+			d.logger.Errorf("REST - DELETE - DeleteDevices - cannot remove rules of device, err = %#v", err)
+			return nil, err
+		}
+		if _, err := d.collRules.UpdateMany(
+			sessionCtx,
+			bson.M{"actions.deviceId": objectID},
+			bson.M{"$pull": bson.M{"actions": bson.M{"deviceId": objectID}}},
+		); err != nil {
+			d.logger.Errorf("REST - DELETE - DeleteDevices - cannot remove device from rules, err = %#v", err)
+			return nil, err
+		}
+
 		// remove device
 		if _, err := d.collDevices.DeleteOne(sessionCtx, bson.M{
 			"_id": objectID,
@@ -233,10 +319,12 @@ func (d *Devices) DeleteDevice(c *gin.Context) {
 		"deviceID", objectID.Hex(),
 		"deviceUUID", device.UUID,
 	)
+	d.events.publish(models.Event{Type: models.EventDeviceDeleted, DeviceID: &objectID}, audience)
 	c.JSON(http.StatusOK, gin.H{"message": "device has been deleted"})
 }
 
-// PutAssignDeviceToHomeRoom assigns a device to a room within a home and optionally sets the device name.
+// PutAssignDeviceToHomeRoom assigns a device to a room within a home and optionally renames the device,
+// overriding its name like PATCH /api/devices/:id.
 func (d *Devices) PutAssignDeviceToHomeRoom(c *gin.Context) {
 	d.logger.Info("REST - PUT - PutAssignDeviceToHomeRoom called")
 
@@ -292,23 +380,25 @@ func (d *Devices) PutAssignDeviceToHomeRoom(c *gin.Context) {
 		return
 	}
 
-	// 2. profile must be the owner of home with id = `assignDeviceReq.HomeID`
-	if _, found := utils.Find(profile.Homes, homeObjID); !found {
-		d.logger.Errorf("REST - GET - PutAssignDeviceToHomeRoom - profile must be the owner of home with id = '%s'", assignDeviceReq.HomeID)
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "you are not the owner of home id = " + assignDeviceReq.HomeID})
-		return
-	}
-
-	// 3. `assignDeviceReq.RoomID` must be a room of home with id = `assignDeviceReq.HomeID`
-	var home models.Home
-	err = d.collHomes.FindOne(c.Request.Context(), bson.M{
-		"_id": homeObjID,
-	}).Decode(&home)
+	// 2. profile must be at least an admin of home with id = `assignDeviceReq.HomeID`
+	home, role, err := getHomeWithRole(c.Request.Context(), d.collHomes, &profile, homeObjID)
 	if err != nil {
+		if errors.Is(err, errHomeNotMember) {
+			d.logger.Errorf("REST - GET - PutAssignDeviceToHomeRoom - profile must be the owner of home with id = '%s'", assignDeviceReq.HomeID)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "you are not the owner of home id = " + assignDeviceReq.HomeID})
+			return
+		}
 		d.logger.Errorf("REST - PUT - PutAssignDeviceToHomeRoom - cannot find home with id = '%s'", assignDeviceReq.HomeID)
 		c.JSON(http.StatusNotFound, gin.H{"error": "Cannot find home id = " + assignDeviceReq.HomeID})
 		return
 	}
+	if !utils.HasHomeRole(role, models.HomeRoleAdmin) {
+		d.logger.Errorf("REST - PUT - PutAssignDeviceToHomeRoom - role '%s' cannot assign devices to home with id = '%s'", role, assignDeviceReq.HomeID)
+		c.JSON(http.StatusForbidden, gin.H{"error": "you don't have permission to assign devices to home id = " + assignDeviceReq.HomeID})
+		return
+	}
+
+	// 3. `assignDeviceReq.RoomID` must be a room of home with id = `assignDeviceReq.HomeID`
 	// `roomID` must be a room of `home`
 	var roomFound bool
 	for _, val := range home.Rooms {
@@ -331,12 +421,18 @@ func (d *Devices) PutAssignDeviceToHomeRoom(c *gin.Context) {
 		return
 	}
 
-	// use MAC address as default name if none provided
+	// keep the current name if none provided, or use MAC address as default name
 	deviceName := assignDeviceReq.Name
+	if deviceName == "" {
+		deviceName = deviceDoc.DisplayName()
+	}
 	if deviceName == "" {
 		deviceName = deviceDoc.Mac
 	}
 
+	// profiles of the previous home lose access to the device with the transaction
+	previousAudience := d.events.deviceAudience(c.Request.Context(), deviceID)
+
 	// start-session
 	dbSession, err := d.client.StartSession()
 	if err != nil {
@@ -351,8 +447,8 @@ func (d *Devices) PutAssignDeviceToHomeRoom(c *gin.Context) {
 		// Official `mongo-driver` documentation state: "callback may be run
 		// multiple times during WithTransaction due to retry attempts, so it must be idempotent."
 
-		// 4. remove device with id = `deviceID` from all rooms of profile's homes
-		filterProfileHomes := bson.M{"_id": bson.M{"$in": profile.Homes}} // filter homes owned by the profile
+		// 4. remove device with id = `deviceID` from all rooms of every home containing it
+		filterProfileHomes := bson.M{"rooms.devices": deviceID}
 		updateClean := bson.M{
 			"$pull": bson.M{
 				// using the `all positional operator` https://www.mongodb.com/docs/manual/reference/operator/update/positional-all/
@@ -386,10 +482,13 @@ func (d *Devices) PutAssignDeviceToHomeRoom(c *gin.Context) {
 			return nil, errUpdate
 		}
 
-		// 6. update the device name
+		// 6. override the device name, the one reported by the device is never changed
+		if deviceName == deviceDoc.DisplayName() {
+			return nil, nil
+		}
 		_, errName := d.collDevices.UpdateOne(sessionCtx,
 			bson.M{"_id": deviceID},
-			bson.M{"$set": bson.M{"name": deviceName}},
+			bson.M{"$set": bson.M{"overrides.name": deviceName}},
 		)
 		if errName != nil {
 			d.logger.Errorf("REST - PUT - PutAssignDeviceToHomeRoom - cannot update device name, errName = %#v", errName)
@@ -409,9 +508,287 @@ func (d *Devices) PutAssignDeviceToHomeRoom(c *gin.Context) {
 		"roomID", roomObjID.Hex(),
 		"deviceName", deviceName,
 	)
+	d.events.publish(models.Event{
+		Type:     models.EventDeviceAssigned,
+		HomeID:   &homeObjID,
+		RoomID:   &roomObjID,
+		DeviceID: &deviceID,
+		Data:     gin.H{"name": deviceName},
+	}, previousAudience, d.events.homeAudience(c.Request.Context(), homeObjID))
 	c.JSON(http.StatusOK, gin.H{"message": "device has been assigned to room"})
 }
 
+// DeleteDeviceAssignment removes a device from every room of the homes of the logged profile, without deleting it.
+// Device owners can unassign it from all their homes, otherwise you must be at least an admin of the home, like for assignments.
+func (d *Devices) DeleteDeviceAssignment(c *gin.Context) {
+	d.logger.Info("REST - DELETE - DeleteDeviceAssignment called")
+
+	deviceID, err := bson.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		d.logger.Error("REST - DELETE - DeleteDeviceAssignment - wrong format of device 'id' path param")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "wrong format of device 'id' path param"})
+		return
+	}
+
+	profile, err := utils.GetLoggedProfileFromContext(c, d.collProfiles)
+	if err != nil {
+		d.logger.Error("REST - DELETE - DeleteDeviceAssignment - cannot find profile")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "cannot find profile"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	homes, err := findProfileHomes(ctx, d.collHomes, &profile)
+	if err != nil {
+		d.logger.Errorf("REST - DELETE - DeleteDeviceAssignment - cannot get homes of profile, err = %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot unassign device"})
+		return
+	}
+	_, isOwner := utils.Find(profile.Devices, deviceID)
+	var assignedHomes int
+	allowedHomeIDs := make([]bson.ObjectID, 0)
+	for _, home := range homes {
+		if !homeHasDevice(&home, deviceID) {
+			continue
+		}
+		assignedHomes++
+		role, _ := utils.GetHomeRole(&home, profile.ID, profile.Homes)
+		if isOwner || utils.HasHomeRole(role, models.HomeRoleAdmin) {
+			allowedHomeIDs = append(allowedHomeIDs, home.ID)
+		}
+	}
+	if assignedHomes == 0 {
+		d.logger.Errorf("REST - DELETE - DeleteDeviceAssignment - device with id = '%s' is not assigned to your homes", deviceID.Hex())
+		c.JSON(http.StatusNotFound, gin.H{"error": "device is not assigned to a room of your homes"})
+		return
+	}
+	if len(allowedHomeIDs) == 0 {
+		d.logger.Errorf("REST - DELETE - DeleteDeviceAssignment - your home role cannot unassign device with id = '%s'", deviceID.Hex())
+		c.JSON(http.StatusForbidden, gin.H{"error": "you don't have permission to unassign this device"})
+		return
+	}
+
+	// profiles of these homes lose access to the device with the transaction
+	previousAudience := d.events.deviceAudience(ctx, deviceID)
+
+	// start-session
+	dbSession, err := d.client.StartSession()
+	if err != nil {
+		d.logger.Errorf("REST - DELETE - DeleteDeviceAssignment - cannot start a db session %#v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "unknown error while trying to unassign a device"})
+		return
+	}
+	// Defers ending the session after the transaction is committed or ended
+	defer dbSession.EndSession(ctx)
+
+	_, errTrans := dbSession.WithTransaction(ctx, func(sessionCtx context.Context) (interface{}, error) {
+		// Official `mongo-driver` documentation state: "callback may be run
+		// multiple times during WithTransaction due to retry attempts, so it must be idempotent."
+		filter := bson.M{
+			"_id":           bson.M{"$in": allowedHomeIDs},
+			"rooms.devices": deviceID,
+		}
+		update := bson.M{
+			"$pull": bson.M{
+				// using the `all positional operator` https://www.mongodb.com/docs/manual/reference/operator/update/positional-all/
+				"rooms.$[].devices": deviceID,
+			},
+			"$set": bson.M{
+				"modifiedAt": time.Now(),
+			},
+		}
+		if _, err := d.collHomes.UpdateMany(sessionCtx, filter, update); err != nil {
+			d.logger.Errorf("REST - DELETE - DeleteDeviceAssignment - cannot remove device from rooms, err = %#v", err)
+			return nil, err
+		}
+		return nil, nil
+	}, options.Transaction().SetWriteConcern(writeconcern.Majority()))
+	if errTrans != nil {
+		d.logger.Errorf("REST - DELETE - DeleteDeviceAssignment - cannot unassign device in transaction, errTrans = %#v", errTrans)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot unassign device in DB"})
+		return
+	}
+
+	for _, homeID := range allowedHomeIDs {
+		d.logger.Infow("AUDIT - device unassigned from rooms",
+			"profileID", profile.ID.Hex(),
+			"deviceID", deviceID.Hex(),
+			"homeID", homeID.Hex(),
+		)
+		d.events.publish(models.Event{
+			Type:     models.EventDeviceUnassigned,
+			HomeID:   &homeID,
+			DeviceID: &deviceID,
+		}, previousAudience)
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "device has been unassigned"})
+}
+
+// PatchDevice changes the metadata of a device edited by users, see models.DeviceOverridesPatch.
+// Fields reported by the device are never changed. Device owners and admins of homes with the device can edit it.
+func (d *Devices) PatchDevice(c *gin.Context) {
+	d.logger.Info("REST - PATCH - PatchDevice called")
+
+	deviceID, err := bson.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		d.logger.Error("REST - PATCH - PatchDevice - wrong format of device 'id' path param")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "wrong format of device 'id' path param"})
+		return
+	}
+
+	var patch models.DeviceOverridesPatch
+	if err = c.ShouldBindJSON(&patch); err != nil {
+		d.logger.Errorf("REST - PATCH - PatchDevice - Cannot bind request body, err = %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request payload"})
+		return
+	}
+	if err = d.validate.Struct(patch); err != nil {
+		d.logger.Errorf("REST - PATCH - PatchDevice - request body is not valid, err %#v", err)
+		var errFields = utils.GetErrorMessage(err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body, these fields are not valid:" + errFields})
+		return
+	}
+
+	profile, err := utils.GetLoggedProfileFromContext(c, d.collProfiles)
+	if err != nil {
+		d.logger.Error("REST - PATCH - PatchDevice - cannot find profile")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "cannot find profile"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	// you can edit a device if you own it or if you are at least an admin of a home with it, like for assignments
+	if _, err = resolveDeviceAccess(ctx, d.collProfiles, d.collHomes, &profile, deviceID, models.HomeRoleAdmin); err != nil {
+		if errors.Is(err, errInsufficientHomeRole) {
+			d.logger.Error("REST - PATCH - PatchDevice - your home role cannot edit this device")
+			c.JSON(http.StatusForbidden, gin.H{"error": "you don't have permission to edit this device"})
+			return
+		}
+		d.logger.Errorf("REST - PATCH - PatchDevice - this is not your device, err = %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "this device is not in your profile"})
+		return
+	}
+	// overrides are changed only if nobody else changed them since they have been read, otherwise they are read again
+	var device models.Device
+	updated := false
+	for attempt := 0; attempt < maxPatchDeviceAttempts && !updated; attempt++ {
+		if err = d.collDevices.FindOne(ctx, bson.M{"_id": deviceID}).Decode(&device); err != nil {
+			d.logger.Errorf("REST - PATCH - PatchDevice - cannot find device, err = %v", err)
+			c.JSON(http.StatusNotFound, gin.H{"error": "cannot find device"})
+			return
+		}
+
+		overrides, err := utils.PatchDeviceOverrides(&device, &patch)
+		if err != nil {
+			d.logger.Errorf("REST - PATCH - PatchDevice - cannot apply overrides, err = %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		// only overrides are written, so fields reported by the device at the same time are not lost
+		update := bson.M{"$unset": bson.M{"overrides": ""}}
+		filter := overridesFilter(deviceID, device.Overrides)
+		device.Overrides = nil
+		if !overrides.IsEmpty() {
+			update = bson.M{"$set": bson.M{"overrides": overrides}}
+			device.Overrides = &overrides
+		}
+		result, err := d.collDevices.UpdateOne(ctx, filter, update)
+		if err != nil {
+			d.logger.Errorf("REST - PATCH - PatchDevice - cannot update device, err = %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot update device"})
+			return
+		}
+		updated = result.MatchedCount == 1
+	}
+	if !updated {
+		d.logger.Errorf("REST - PATCH - PatchDevice - overrides of device %s changed concurrently", deviceID.Hex())
+		c.JSON(http.StatusConflict, gin.H{"error": "device has been changed at the same time, retry"})
+		return
+	}
+
+	d.logger.Infow("AUDIT - device metadata updated",
+		"profileID", profile.ID.Hex(),
+		"deviceID", deviceID.Hex(),
+	)
+	d.events.publish(models.Event{
+		Type:     models.EventDeviceUpdated,
+		DeviceID: &deviceID,
+		Data:     device.Overrides,
+	}, d.events.deviceAudience(c.Request.Context(), deviceID))
+	c.JSON(http.StatusOK, device)
+}
+
+// overridesFilter matches the device with deviceID only if it still has overrides.
+// Fields are compared one by one, because they can be set on their own, e.g. the name by PutAssignDeviceToHomeRoom.
+func overridesFilter(deviceID bson.ObjectID, overrides *models.DeviceOverrides) bson.M {
+	if overrides == nil {
+		overrides = &models.DeviceOverrides{}
+	}
+	filter := bson.M{"_id": deviceID}
+	fields := map[string]string{
+		"overrides.name":     overrides.Name,
+		"overrides.icon":     overrides.Icon,
+		"overrides.category": string(overrides.Category),
+	}
+	for field, value := range fields {
+		if value == "" {
+			filter[field] = bson.M{"$exists": false}
+		} else {
+			filter[field] = value
+		}
+	}
+	if len(overrides.Features) == 0 {
+		filter["overrides.features"] = bson.M{"$exists": false}
+	} else {
+		filter["overrides.features"] = overrides.Features
+	}
+	return filter
+}
+
+// getAccessibleDevices returns the ids of devices owned by profile
+// together with devices assigned to rooms of homes shared with it,
+// and the locations of devices assigned to rooms of all its homes.
+func (d *Devices) getAccessibleDevices(ctx context.Context, profile *models.Profile) ([]bson.ObjectID, map[bson.ObjectID]*DeviceLocation, error) {
+	deviceIDs := make([]bson.ObjectID, 0, len(profile.Devices))
+	deviceIDs = append(deviceIDs, profile.Devices...)
+	locations := make(map[bson.ObjectID]*DeviceLocation)
+
+	homes, err := findProfileHomes(ctx, d.collHomes, profile)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, home := range homes {
+		for _, room := range home.Rooms {
+			for _, deviceID := range room.Devices {
+				// a device is assigned to a single room, see PutAssignDeviceToHomeRoom
+				locations[deviceID] = &DeviceLocation{
+					HomeID:   home.ID,
+					HomeName: home.Name,
+					RoomID:   room.ID,
+					RoomName: room.Name,
+				}
+				if !utils.Contains(deviceIDs, deviceID) {
+					deviceIDs = append(deviceIDs, deviceID)
+				}
+			}
+		}
+	}
+	return deviceIDs, locations, nil
+}
+
+func homeHasDevice(home *models.Home, deviceID bson.ObjectID) bool {
+	for _, room := range home.Rooms {
+		if utils.Contains(room.Devices, deviceID) {
+			return true
+		}
+	}
+	return false
+}
+
 func (d *Devices) deleteOnlineByUUIDService(urlOnline string) (int, string, error) {
 	return utils.Delete(urlOnline)
 }
@@ -0,0 +1,256 @@
+package api
+
+import (
+	"api-server/models"
+	"api-server/utils"
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+const defaultHistoryRange = 24 * time.Hour
+const defaultHistoryBucket = "1h"
+const maxHistoryBuckets = 1000
+
+// maxFeatureValueClockSkew is the max distance from the server time of timestamps read from devices
+const maxFeatureValueClockSkew = 5 * time.Minute
+
+// featureValueKey identifies a feature of a device
+type featureValueKey struct {
+	deviceID    bson.ObjectID
+	featureUUID string
+}
+
+// FeatureHistoryResp is the response body with aggregated values of a feature in a time range.
+type FeatureHistoryResp struct {
+	DeviceID    bson.ObjectID               `json:"deviceId"`
+	FeatureUUID string                      `json:"featureUuid"`
+	From        time.Time                   `json:"from"`
+	To          time.Time                   `json:"to"`
+	Bucket      string                      `json:"bucket"`
+	Values      []models.FeatureValueBucket `json:"values"`
+}
+
+// GetFeatureHistory returns min, max and avg values of a device feature for each time bucket in [from, to).
+// Query params `from` and `to` are RFC3339 dates, `bucket` is a size like "5m", "1h" or "1d".
+func (dv *DevicesValues) GetFeatureHistory(c *gin.Context) {
+	dv.logger.Info("REST - GET - GetFeatureHistory called")
+
+	objectID, errID := bson.ObjectIDFromHex(c.Param("id"))
+	if errID != nil {
+		dv.logger.Error("REST - GET - GetFeatureHistory - wrong format of the path param 'id'")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "wrong format of the path param 'id'"})
+		return
+	}
+	featureUUID := c.Param("fid")
+	if !utils.IsValidUUID(featureUUID) {
+		dv.logger.Error("REST - GET - GetFeatureHistory - wrong format of the path param 'fid'")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "wrong format of the path param 'fid'"})
+		return
+	}
+
+	to := time.Now().UTC()
+	if rawTo := c.Query("to"); rawTo != "" {
+		parsed, err := time.Parse(time.RFC3339, rawTo)
+		if err != nil {
+			dv.logger.Errorf("REST - GET - GetFeatureHistory - wrong format of query param 'to', err = %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "wrong format of the query param 'to', it must be a RFC3339 date"})
+			return
+		}
+		to = parsed.UTC()
+	}
+	from := to.Add(-defaultHistoryRange)
+	if rawFrom := c.Query("from"); rawFrom != "" {
+		parsed, err := time.Parse(time.RFC3339, rawFrom)
+		if err != nil {
+			dv.logger.Errorf("REST - GET - GetFeatureHistory - wrong format of query param 'from', err = %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "wrong format of the query param 'from', it must be a RFC3339 date"})
+			return
+		}
+		from = parsed.UTC()
+	}
+	if !from.Before(to) {
+		dv.logger.Error("REST - GET - GetFeatureHistory - 'from' must be before 'to'")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "the query param 'from' must be before 'to'"})
+		return
+	}
+	bucketParam := c.DefaultQuery("bucket", defaultHistoryBucket)
+	bucket, err := utils.ParseTimeBucket(bucketParam)
+	if err != nil {
+		dv.logger.Errorf("REST - GET - GetFeatureHistory - wrong format of query param 'bucket', err = %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "wrong format of the query param 'bucket', use a size like 5m, 1h or 1d"})
+		return
+	}
+	if to.Sub(from)/bucket.Duration > maxHistoryBuckets {
+		dv.logger.Error("REST - GET - GetFeatureHistory - too many buckets in the requested range")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "too many buckets, use a shorter range or a bigger bucket"})
+		return
+	}
+
+	// retrieve current profile object from database using the authenticated context
+	profile, err := utils.GetLoggedProfileFromContext(c, dv.collProfiles)
+	if err != nil {
+		dv.logger.Error("REST - GET - GetFeatureHistory - cannot find profile")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "cannot find profile"})
+		return
+	}
+
+	// check if device is owned by profile or placed in a home shared with it
+	if _, err = resolveDeviceAccess(c.Request.Context(), dv.collProfiles, dv.collHomes, &profile, objectID, models.HomeRoleGuest); err != nil {
+		dv.logger.Errorf("REST - GET - GetFeatureHistory - this device is not in your profile, err = %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "this device is not in your profile"})
+		return
+	}
+	device, err := dv.getDevice(c.Request.Context(), objectID)
+	if err != nil {
+		dv.logger.Error("REST - GET - GetFeatureHistory - cannot find device")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cannot find device"})
+		return
+	}
+	var featureFound bool
+	for _, feature := range device.Features {
+		if feature.UUID == featureUUID {
+			featureFound = true
+			break
+		}
+	}
+	if !featureFound {
+		dv.logger.Errorf("REST - GET - GetFeatureHistory - cannot find feature %s in device", featureUUID)
+		c.JSON(http.StatusNotFound, gin.H{"error": "feature not found"})
+		return
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"meta.deviceId":    objectID,
+			"meta.featureUuid": featureUUID,
+			"timestamp":        bson.M{"$gte": from, "$lt": to},
+		}}},
+		{{Key: "$group", Value: bson.M{
+			"_id": bson.M{"$dateTrunc": bson.M{
+				"date":    "$timestamp",
+				"unit":    bucket.Unit,
+				"binSize": bucket.BinSize,
+			}},
+			"min":   bson.M{"$min": "$value"},
+			"max":   bson.M{"$max": "$value"},
+			"avg":   bson.M{"$avg": "$value"},
+			"count": bson.M{"$sum": 1},
+		}}},
+		{{Key: "$sort", Value: bson.M{"_id": 1}}},
+	}
+	cur, err := dv.collFeatureValues.Aggregate(c.Request.Context(), pipeline)
+	if err != nil {
+		dv.logger.Errorf("REST - GET - GetFeatureHistory - cannot aggregate feature values, err = %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot get feature history"})
+		return
+	}
+	defer cur.Close(c.Request.Context())
+
+	values := make([]models.FeatureValueBucket, 0)
+	if err = cur.All(c.Request.Context(), &values); err != nil {
+		dv.logger.Errorf("REST - GET - GetFeatureHistory - cannot decode feature values, err = %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot get feature history"})
+		return
+	}
+
+	c.JSON(http.StatusOK, FeatureHistoryResp{
+		DeviceID:    objectID,
+		FeatureUUID: featureUUID,
+		From:        from,
+		To:          to,
+		Bucket:      bucketParam,
+		Values:      values,
+	})
+}
+
+// recordReadFeatureValues stores feature states read from devices in the feature_values time-series collection.
+// States are polled many times with the same device timestamp, so a state is skipped if its timestamp
+// is the last one recorded for that feature, without reading the collection.
+// It returns the recorded states, i.e. the new ones.
+func (dv *DevicesValues) recordReadFeatureValues(ctx context.Context, deviceID bson.ObjectID, states []models.DeviceFeatureState) ([]models.DeviceFeatureState, error) {
+	now := time.Now().UTC()
+	recorded := make([]models.DeviceFeatureState, 0, len(states))
+	dv.lastReadValuesMu.Lock()
+	for _, state := range states {
+		key := featureValueKey{deviceID: deviceID, featureUUID: state.FeatureUUID}
+		if state.ModifiedAt > 0 && dv.lastReadValues[key] == state.ModifiedAt {
+			continue
+		}
+		// marked before inserting, so concurrent reads of the same state don't record it twice
+		dv.lastReadValues[key] = state.ModifiedAt
+		recorded = append(recorded, state)
+	}
+	dv.lastReadValuesMu.Unlock()
+
+	docs := utils.MapSlice(recorded, func(state models.DeviceFeatureState) interface{} {
+		return newFeatureValue(deviceID, &state, readFeatureValueTimestamp(state.ModifiedAt, now))
+	})
+	if err := dv.insertFeatureValues(ctx, docs); err != nil {
+		// let the next read record them again
+		dv.lastReadValuesMu.Lock()
+		for _, state := range recorded {
+			key := featureValueKey{deviceID: deviceID, featureUUID: state.FeatureUUID}
+			if dv.lastReadValues[key] == state.ModifiedAt {
+				delete(dv.lastReadValues, key)
+			}
+		}
+		dv.lastReadValuesMu.Unlock()
+		return nil, err
+	}
+	return recorded, nil
+}
+
+// recordSetFeatureValues stores feature states set on devices in the feature_values time-series collection.
+// Their timestamps come from clients, so values are recorded at the server time.
+func (dv *DevicesValues) recordSetFeatureValues(ctx context.Context, deviceID bson.ObjectID, states []models.DeviceFeatureState) error {
+	now := time.Now().UTC()
+	docs := utils.MapSlice(states, func(state models.DeviceFeatureState) interface{} {
+		return newFeatureValue(deviceID, &state, now)
+	})
+	return dv.insertFeatureValues(ctx, docs)
+}
+
+func (dv *DevicesValues) insertFeatureValues(ctx context.Context, docs []interface{}) error {
+	if len(docs) == 0 {
+		return nil
+	}
+	_, err := dv.collFeatureValues.InsertMany(ctx, docs)
+	return err
+}
+
+// readFeatureValueTimestamp returns the time of a value read from a device, modified at modifiedAt.
+// Device clocks can be wrong, so the server time now is used when modifiedAt is missing
+// or farther than maxFeatureValueClockSkew from it.
+func readFeatureValueTimestamp(modifiedAt int64, now time.Time) time.Time {
+	if modifiedAt <= 0 {
+		return now
+	}
+	timestamp := time.UnixMilli(modifiedAt).UTC()
+	if timestamp.Before(now.Add(-maxFeatureValueClockSkew)) || timestamp.After(now.Add(maxFeatureValueClockSkew)) {
+		return now
+	}
+	return timestamp
+}
+
+func newFeatureValue(deviceID bson.ObjectID, state *models.DeviceFeatureState, timestamp time.Time) models.FeatureValue {
+	return models.FeatureValue{
+		Meta: models.FeatureValueMeta{
+			DeviceID:    deviceID,
+			FeatureUUID: state.FeatureUUID,
+		},
+		Timestamp: timestamp,
+		// format as float32 to store 22.1 instead of 22.100000381469727
+		Value: float32ToFloat64(state.Value),
+	}
+}
+
+func float32ToFloat64(value float32) float64 {
+	parsed, _ := strconv.ParseFloat(strconv.FormatFloat(float64(value), 'f', -1, 32), 64)
+	return parsed
+}
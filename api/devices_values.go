@@ -2,17 +2,18 @@ package api
 
 import (
 	pb "api-server/api/grpc/device"
-	"api-server/customerrors"
 	"api-server/db"
 	"api-server/models"
 	"api-server/utils"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -20,12 +21,50 @@ import (
 	"go.mongodb.org/mongo-driver/v2/bson"
 	"go.mongodb.org/mongo-driver/v2/mongo"
 	"go.uber.org/zap"
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
 
 const setValuesGRPCTimeout = time.Second
+const getValuesGRPCTimeout = time.Second
+
+// maxParallelSensorReads limits concurrent requests to the sensors service for a single device
+const maxParallelSensorReads = 4
+
+// FeatureValueError describes why the value of a single feature has been rejected.
+type FeatureValueError struct {
+	FeatureUUID string `json:"featureUuid"`
+	Name        string `json:"name"`
+	Error       string `json:"error"`
+}
+
+// featureValuesError collects every feature state whose value doesn't satisfy the feature Spec.
+type featureValuesError struct {
+	features []FeatureValueError
+}
+
+func (e *featureValuesError) Error() string {
+	return fmt.Sprintf("%d feature values are not valid", len(e.features))
+}
+
+// deviceValuesError explains why values could not be set to a device by setHomeDeviceValues.
+type deviceValuesError struct {
+	// message can be returned to clients, while err is the cause to log
+	message  string
+	features []FeatureValueError
+	err      error
+}
+
+func (e *deviceValuesError) Error() string {
+	if e.err != nil {
+		return e.message + ": " + e.err.Error()
+	}
+	return e.message
+}
+
+func (e *deviceValuesError) Unwrap() error {
+	return e.err
+}
 
 // DevicesValues handles reading and writing feature values for devices.
 type DevicesValues struct {
@@ -33,8 +72,15 @@ type DevicesValues struct {
 	collDevices       *mongo.Collection
 	collProfiles      *mongo.Collection
 	collHomes         *mongo.Collection
+	collFeatureValues *mongo.Collection
+	// lastReadValues has the device timestamp of the last value read and recorded for each feature
+	lastReadValues    map[featureValueKey]int64
+	lastReadValuesMu  sync.Mutex
+	ruleEngine        *ruleEngine
+	events            *EventsHub
+	audit             *AuditLog
 	logger            *zap.SugaredLogger
-	grpcTarget        string
+	deviceClient      pb.DeviceClient
 	sensorGetValueURL string
 	validate          *validator.Validate
 }
@@ -47,21 +93,30 @@ func decryptProfileAPIToken(profile *models.Profile) (string, error) {
 }
 
 // NewDevicesValues constructs a DevicesValues handler with the given dependencies.
-func NewDevicesValues(logger *zap.SugaredLogger, client *mongo.Client, validate *validator.Validate) *DevicesValues {
-	grpcURL := os.Getenv("GRPC_URL")
+// deviceClient is shared with other handlers, because its connection to api-devices is long-lived.
+// Values read or set are published to events, values set by clients are recorded in audit.
+// A single DevicesValues must be shared by all handlers reading or setting values, because it owns the rule engine.
+func NewDevicesValues(logger *zap.SugaredLogger, client *mongo.Client, validate *validator.Validate, deviceClient pb.DeviceClient, events *EventsHub, audit *AuditLog) *DevicesValues {
 	sensorServerURL := os.Getenv("HTTP_SENSOR_SERVER") + ":" + os.Getenv("HTTP_SENSOR_PORT")
 	sensorGetValueURL := sensorServerURL + os.Getenv("HTTP_SENSOR_GETVALUE_API")
 
-	return &DevicesValues{
+	dv := &DevicesValues{
 		client:            client,
 		collDevices:       db.GetCollections(client).Devices,
 		collProfiles:      db.GetCollections(client).Profiles,
 		collHomes:         db.GetCollections(client).Homes,
+		collFeatureValues: db.GetCollections(client).FeatureValues,
+		lastReadValues:    make(map[featureValueKey]int64),
 		logger:            logger,
-		grpcTarget:        grpcURL,
+		deviceClient:      deviceClient,
+		events:            events,
+		audit:             audit,
 		sensorGetValueURL: sensorGetValueURL,
 		validate:          validate,
 	}
+	// rule actions set values through dv
+	dv.ruleEngine = newRuleEngine(logger, client, dv)
+	return dv
 }
 
 // ------------------------------ Public methods ------------------------------
@@ -85,10 +140,10 @@ func (dv *DevicesValues) GetValuesDevice(c *gin.Context) {
 		return
 	}
 
-	// check if device is in profile (device owned by profile)
-
-	if !utils.Contains(profile.Devices, objectID) {
-		dv.logger.Error("REST - GET - GetValuesDevice - this device is not in your profile")
+	// check if device is owned by profile or placed in a home shared with it
+	owner, err := resolveDeviceAccess(c.Request.Context(), dv.collProfiles, dv.collHomes, &profile, objectID, models.HomeRoleGuest)
+	if err != nil {
+		dv.logger.Errorf("REST - GET - GetValuesDevice - this device is not in your profile, err = %v", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": "this device is not in your profile"})
 		return
 	}
@@ -100,55 +155,17 @@ func (dv *DevicesValues) GetValuesDevice(c *gin.Context) {
 		return
 	}
 
-	var deviceFeatureStates []models.DeviceFeatureState
-	for _, feature := range device.Features {
-		dv.logger.Debugf("REST - GET - GetValuesDevice - feature = %v", feature)
-		if feature.Type == models.Controller {
-			apiToken, err := decryptProfileAPIToken(&profile)
-			if err != nil {
-				dv.logger.Error("REST - GET - GetValuesDevice - cannot load profile api token")
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot get device values"})
-				return
-			}
-			state, err := dv.getControllerValue(&device, &feature, apiToken)
-			if err != nil {
-				dv.logger.Errorf("REST - GET - GetValuesDevice - cannot get values via gRPC, err = %v", err)
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot get values"})
-				return
-			}
-			deviceFeatureStates = append(deviceFeatureStates, *state)
-		} else {
-			if !utils.IsValidUUID(device.UUID) || !utils.IsValidUUID(feature.UUID) {
-				dv.logger.Errorf("REST - GetValuesDevice - invalid UUID format: device=%s feature=%s", device.UUID, feature.UUID)
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot get sensor value"})
-				return
-			}
-			path := dv.sensorGetValueURL + url.PathEscape(device.UUID) + "/features/" + url.PathEscape(feature.UUID) + "/" + url.PathEscape(feature.Name)
-			dv.logger.Debugf("REST - GetValuesDevice - path = %s\n", path)
-			_, result, err := utils.Get(path)
-			if err != nil {
-				dv.logger.Errorf("REST - GetValuesDevice - cannot get sensor value from remote service = %#v", err)
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot get sensor value"})
-				return
-			}
-
-			sensorFeatureValue := models.DeviceFeatureState{}
-			err = json.Unmarshal([]byte(result), &sensorFeatureValue)
-			if err != nil {
-				dv.logger.Errorf("REST - GetValuesDevice - cannot unmarshal JSON response from sensor value remote service = %#v", err)
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot get sensor value"})
-				return
-			}
-			// add to the object with the value also other information
-			// to associate the value to the specific feature
-			sensorFeatureValue.FeatureUUID = feature.UUID
-			sensorFeatureValue.Type = feature.Type
-			sensorFeatureValue.Name = feature.Name
-
-			dv.logger.Debugf("REST - GetValuesDevice - sensor value for feature = %s is = %#v\n", feature.Name, sensorFeatureValue)
-			deviceFeatureStates = append(deviceFeatureStates, sensorFeatureValue)
+	apiToken := ""
+	if hasControllerFeatures(&device) {
+		apiToken, err = decryptProfileAPIToken(&owner)
+		if err != nil {
+			dv.logger.Error("REST - GET - GetValuesDevice - cannot load profile api token")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot get device values"})
+			return
 		}
 	}
+	// features that cannot be read have an error, the others are returned anyway
+	deviceFeatureStates := dv.readDeviceValues(c.Request.Context(), &device, apiToken)
 	c.JSON(http.StatusOK, deviceFeatureStates)
 }
 
@@ -188,9 +205,23 @@ func (dv *DevicesValues) PostValuesDevice(c *gin.Context) {
 		return
 	}
 
-	// check if device is in profile (device owned by profile)
-	if !utils.Contains(profile.Devices, objectID) {
-		dv.logger.Error("REST - POST - PostValuesDevice - this is not your device")
+	// check if device is owned by profile or placed in a home where profile can control devices
+	owner, err := resolveDeviceAccess(c.Request.Context(), dv.collProfiles, dv.collHomes, &profile, objectID, models.HomeRoleMember)
+	if err != nil {
+		if errors.Is(err, errInsufficientHomeRole) {
+			dv.logger.Error("REST - POST - PostValuesDevice - your home role cannot control this device")
+			dv.audit.record(c, models.AuditEvent{
+				ActorID:    profile.ID,
+				Action:     models.AuditActionDeviceValuesSet,
+				TargetType: models.AuditTargetDevice,
+				TargetID:   objectID.Hex(),
+				Outcome:    models.AuditOutcomeFailure,
+				Reason:     "home role cannot control the device",
+			})
+			c.JSON(http.StatusForbidden, gin.H{"error": "you don't have permission to control this device"})
+			return
+		}
+		dv.logger.Errorf("REST - POST - PostValuesDevice - this is not your device, err = %v", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": "this device is not in your profile"})
 		return
 	}
@@ -202,22 +233,35 @@ func (dv *DevicesValues) PostValuesDevice(c *gin.Context) {
 		return
 	}
 	if err = dv.validateFeatureStatesForDevice(&device, featureStates); err != nil {
+		var valuesErr *featureValuesError
+		if errors.As(err, &valuesErr) {
+			dv.logger.Errorf("REST - POST - PostValuesDevice - feature values out of spec, err %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid device feature values", "features": valuesErr.features})
+			return
+		}
 		dv.logger.Errorf("REST - POST - PostValuesDevice - unauthorized feature state, err %#v", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid device feature"})
 		return
 	}
 
-	apiToken, err := decryptProfileAPIToken(&profile)
+	apiToken, err := decryptProfileAPIToken(&owner)
 	if err != nil {
 		dv.logger.Error("REST - POST - SetValuesDevice - cannot load profile api token")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot set device values"})
 		return
 	}
 
-	// send via gRPC
-	err = dv.sendViaGrpc(&device, featureStates, apiToken)
+	err = dv.setDeviceValues(c.Request.Context(), &device, featureStates, apiToken)
 	if err != nil {
 		dv.logger.Errorf("REST - POST - PostValuesDevice - cannot set values via gRPC, err %v", err)
+		dv.audit.record(c, models.AuditEvent{
+			ActorID:    profile.ID,
+			Action:     models.AuditActionDeviceValuesSet,
+			TargetType: models.AuditTargetDevice,
+			TargetID:   objectID.Hex(),
+			Outcome:    models.AuditOutcomeFailure,
+			Reason:     "cannot send values to the device",
+		})
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot set value"})
 		return
 	}
@@ -226,26 +270,150 @@ func (dv *DevicesValues) PostValuesDevice(c *gin.Context) {
 		"profileID", profile.ID.Hex(),
 		"deviceID", objectID.Hex(),
 	)
+	dv.audit.record(c, models.AuditEvent{
+		ActorID:    profile.ID,
+		Action:     models.AuditActionDeviceValuesSet,
+		TargetType: models.AuditTargetDevice,
+		TargetID:   objectID.Hex(),
+		Outcome:    models.AuditOutcomeSuccess,
+	})
 	c.JSON(http.StatusOK, gin.H{"message": "set values success"})
 }
 
 // ------------------------------ Private methods ------------------------------
 
-// getControllerValue calls gRPC to get a single controller feature value.
-// Having this as a separate function ensures that defer runs at the end of
-// each call, avoiding the resource leak that occurs with defer inside a for-loop.
-func (dv *DevicesValues) getControllerValue(device *models.Device, feature *models.Feature, apiToken string) (*models.DeviceFeatureState, error) {
-	conn, err := grpc.NewClient(dv.grpcTarget, grpc.WithTransportCredentials(insecure.NewCredentials()))
+// readDeviceValues reads current values of all features of device, like getFeatureValues.
+// New values are recorded in the history and published, then rules are evaluated with all read values.
+func (dv *DevicesValues) readDeviceValues(ctx context.Context, device *models.Device, apiToken string) []models.DeviceFeatureState {
+	states := dv.getFeatureValues(ctx, device, apiToken)
+	readStates := utils.FilterSlice(states, func(state models.DeviceFeatureState) bool {
+		return state.Error == ""
+	})
+
+	// history is best-effort, a failure must not prevent reading current values
+	changedStates, err := dv.recordReadFeatureValues(ctx, device.ID, readStates)
+	if err != nil {
+		dv.logger.Errorf("readDeviceValues - cannot record feature values history, err = %v", err)
+	}
+	// only values not read before are pushed to streams
+	dv.events.publishDeviceValues(ctx, device.ID, changedStates)
+	dv.ruleEngine.evaluateAsync(device.ID, readStates)
+	return states
+}
+
+// setDeviceValues sends featureStates to device via gRPC.
+// Then values are recorded in the history and published, and rules are evaluated with them.
+func (dv *DevicesValues) setDeviceValues(ctx context.Context, device *models.Device, featureStates []models.DeviceFeatureState, apiToken string) error {
+	if err := dv.sendViaGrpc(device, featureStates, apiToken); err != nil {
+		return err
+	}
+	// history is best-effort, values have been already applied to the device
+	if err := dv.recordSetFeatureValues(ctx, device.ID, featureStates); err != nil {
+		dv.logger.Errorf("setDeviceValues - cannot record feature values history, err = %v", err)
+	}
+	dv.events.publishDeviceValues(ctx, device.ID, featureStates)
+	dv.ruleEngine.evaluateAsync(device.ID, featureStates)
+	return nil
+}
+
+// getFeatureValues reads current values of all features of device, in the same order.
+// Controller values are read with a single gRPC call, while sensor values are read concurrently,
+// at most maxParallelSensorReads at a time. A feature that cannot be read has an error instead of the value.
+func (dv *DevicesValues) getFeatureValues(ctx context.Context, device *models.Device, apiToken string) []models.DeviceFeatureState {
+	states := make([]models.DeviceFeatureState, len(device.Features))
+	controllerIndexes := make([]int, 0)
+	sensorsLimit := make(chan struct{}, maxParallelSensorReads)
+	var wg sync.WaitGroup
+	for i, feature := range device.Features {
+		if feature.Type == models.Controller {
+			controllerIndexes = append(controllerIndexes, i)
+			continue
+		}
+		wg.Go(func() {
+			sensorsLimit <- struct{}{}
+			defer func() { <-sensorsLimit }()
+			states[i] = dv.getSensorValue(ctx, device, &feature)
+		})
+	}
+	if len(controllerIndexes) > 0 {
+		controllers := utils.MapSlice(controllerIndexes, func(i int) models.Feature {
+			return device.Features[i]
+		})
+		for j, state := range dv.getControllerValues(ctx, device, controllers, apiToken) {
+			states[controllerIndexes[j]] = state
+		}
+	}
+	wg.Wait()
+	return states
+}
+
+// getControllerValues reads values of controllers via the GetValues gRPC call, in the same order.
+// If api-devices doesn't support GetValues yet, values are read one by one.
+func (dv *DevicesValues) getControllerValues(ctx context.Context, device *models.Device, controllers []models.Feature, apiToken string) []models.DeviceFeatureState {
+	states := utils.MapSlice(controllers, func(feature models.Feature) models.DeviceFeatureState {
+		return models.DeviceFeatureState{
+			FeatureUUID: feature.UUID,
+			Name:        feature.Name,
+			Type:        feature.Type,
+		}
+	})
+
+	grpcCtx, cancel := context.WithTimeout(ctx, getValuesGRPCTimeout)
+	defer cancel()
+	response, err := dv.deviceClient.GetValues(grpcCtx, &pb.GetValuesRequest{
+		Id:         device.ID.Hex(),
+		DeviceUuid: device.UUID,
+		Mac:        device.Mac,
+		ApiToken:   apiToken,
+		Features: utils.MapSlice(controllers, func(feature models.Feature) *pb.GetValuesFeature {
+			return &pb.GetValuesFeature{
+				FeatureUuid: feature.UUID,
+				FeatureName: feature.Name,
+			}
+		}),
+	})
+	if status.Code(err) == codes.Unimplemented {
+		dv.logger.Debug("gRPC - getControllerValues - GetValues is not implemented, reading values one by one")
+		for i := range controllers {
+			dv.getControllerValue(ctx, device, &controllers[i], apiToken, &states[i])
+		}
+		return states
+	}
 	if err != nil {
-		return nil, err
+		dv.logger.Errorf("gRPC - getControllerValues - cannot get values via gRPC, err = %v", err)
+		for i := range states {
+			states[i].Error = "cannot get controller value"
+		}
+		return states
 	}
-	defer conn.Close()
 
-	client := pb.NewDeviceClient(conn)
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	featureValues := make(map[string]*pb.FeatureValueResponse, len(response.GetFeatureValues()))
+	for _, featureValue := range response.GetFeatureValues() {
+		featureValues[featureValue.GetFeatureUuid()] = featureValue
+	}
+	for i := range states {
+		featureValue, found := featureValues[states[i].FeatureUUID]
+		switch {
+		case !found:
+			states[i].Error = "cannot get controller value"
+		case featureValue.GetError() != "":
+			dv.logger.Errorf("gRPC - getControllerValues - cannot get value of feature %s, err = %s", states[i].FeatureUUID, featureValue.GetError())
+			states[i].Error = "cannot get controller value"
+		default:
+			states[i].Value = featureValue.GetValue()
+			states[i].CreatedAt = featureValue.GetCreatedAt()
+			states[i].ModifiedAt = featureValue.GetModifiedAt()
+		}
+	}
+	return states
+}
+
+// getControllerValue calls gRPC to get a single controller feature value into state.
+func (dv *DevicesValues) getControllerValue(ctx context.Context, device *models.Device, feature *models.Feature, apiToken string, state *models.DeviceFeatureState) {
+	grpcCtx, cancel := context.WithTimeout(ctx, getValuesGRPCTimeout)
 	defer cancel()
 
-	response, err := client.GetValue(ctx, &pb.GetValueRequest{
+	response, err := dv.deviceClient.GetValue(grpcCtx, &pb.GetValueRequest{
 		Id:          device.ID.Hex(),
 		DeviceUuid:  device.UUID,
 		FeatureUuid: feature.UUID,
@@ -254,49 +422,62 @@ func (dv *DevicesValues) getControllerValue(device *models.Device, feature *mode
 		ApiToken:    apiToken,
 	})
 	if err != nil {
-		return nil, err
+		dv.logger.Errorf("gRPC - getControllerValue - cannot get value of feature %s via gRPC, err = %v", feature.UUID, err)
+		state.Error = "cannot get controller value"
+		return
 	}
+	state.Value = response.Value
+	state.CreatedAt = response.CreatedAt
+	state.ModifiedAt = response.ModifiedAt
+}
 
-	return &models.DeviceFeatureState{
+// getSensorValue reads the value of a sensor feature from the sensors service, until ctx is done.
+func (dv *DevicesValues) getSensorValue(ctx context.Context, device *models.Device, feature *models.Feature) models.DeviceFeatureState {
+	// add to the object with the value also other information
+	// to associate the value to the specific feature
+	state := models.DeviceFeatureState{
 		FeatureUUID: feature.UUID,
-		Name:        feature.Name,
 		Type:        feature.Type,
-		Value:       response.Value,
-		CreatedAt:   response.CreatedAt,
-		ModifiedAt:  response.ModifiedAt,
-	}, nil
-}
-
-func (dv *DevicesValues) sendViaGrpc(device *models.Device, featureStates []models.DeviceFeatureState, apiToken string) error {
-	dv.logger.Infof("gRPC - sendViaGrpc - Called with featureStates = %#v", featureStates)
-
-	// Set up a connection to the gRPC server.
-	securityDialOption, isSecure, err := utils.BuildSecurityDialOption()
+		Name:        feature.Name,
+	}
+	if !utils.IsValidUUID(device.UUID) || !utils.IsValidUUID(feature.UUID) {
+		dv.logger.Errorf("REST - getSensorValue - invalid UUID format: device=%s feature=%s", device.UUID, feature.UUID)
+		state.Error = "cannot get sensor value"
+		return state
+	}
+	path := dv.sensorGetValueURL + url.PathEscape(device.UUID) + "/features/" + url.PathEscape(feature.UUID) + "/" + url.PathEscape(feature.Name)
+	dv.logger.Debugf("REST - getSensorValue - path = %s\n", path)
+	_, result, err := utils.GetWithContext(ctx, path)
 	if err != nil {
-		dv.logger.Errorf("gRPC - sendViaGrpc - Cannot build security dial option object!, err %#v", err)
-		return customerrors.Wrap(http.StatusInternalServerError, err, "Cannot create securityDialOption to prepare the gRPC connection")
+		dv.logger.Errorf("REST - getSensorValue - cannot get sensor value from remote service = %#v", err)
+		state.Error = "cannot get sensor value"
+		return state
 	}
-	if isSecure {
-		dv.logger.Info("gRPC - sendViaGrpc - GRPC secure enabled!")
-	} else {
-		dv.logger.Info("gRPC - sendViaGrpc - GRPC secure NOT enabled!")
+
+	sensorFeatureValue := models.DeviceFeatureState{}
+	if err = json.Unmarshal([]byte(result), &sensorFeatureValue); err != nil {
+		dv.logger.Errorf("REST - getSensorValue - cannot unmarshal JSON response from sensor value remote service = %#v", err)
+		state.Error = "cannot get sensor value"
+		return state
 	}
+	state.Value = sensorFeatureValue.Value
+	state.CreatedAt = sensorFeatureValue.CreatedAt
+	state.ModifiedAt = sensorFeatureValue.ModifiedAt
+	dv.logger.Debugf("REST - getSensorValue - sensor value for feature = %s is = %#v\n", feature.Name, state)
+	return state
+}
 
-	conn, err := grpc.NewClient(dv.grpcTarget, securityDialOption)
-	if err != nil {
-		dv.logger.Errorf("gRPC - sendViaGrpc - cannot connect via gRPC, err %#v", err)
-		return customerrors.GrpcSendError{
-			Status:  customerrors.ConnectionError,
-			Message: "Cannot connect to api-devices",
+func hasControllerFeatures(device *models.Device) bool {
+	for _, feature := range device.Features {
+		if feature.Type == models.Controller {
+			return true
 		}
 	}
-	defer conn.Close()
-	client := pb.NewDeviceClient(conn)
+	return false
+}
 
-	// -------------------------------------------------------
-	// I reach this point only if I can connect to gRPC SERVER
-	// -------------------------------------------------------
-	dv.logger.Info("gRPC - sendViaGrpc - gRPC server connected")
+func (dv *DevicesValues) sendViaGrpc(device *models.Device, featureStates []models.DeviceFeatureState, apiToken string) error {
+	dv.logger.Infof("gRPC - sendViaGrpc - Called with featureStates = %#v", featureStates)
 
 	ctx, cancel := context.WithTimeout(context.Background(), setValuesGRPCTimeout)
 	defer cancel()
@@ -310,7 +491,7 @@ func (dv *DevicesValues) sendViaGrpc(device *models.Device, featureStates []mode
 	})
 	dv.logger.Debugf("gRPC - sendViaGrpc - requests request = %#v", requests)
 
-	response, errSend := client.SetValues(ctx, &pb.SetValuesRequest{
+	response, errSend := dv.deviceClient.SetValues(ctx, &pb.SetValuesRequest{
 		Id:            device.ID.Hex(),
 		DeviceUuid:    device.UUID,
 		Mac:           device.Mac,
@@ -322,7 +503,6 @@ func (dv *DevicesValues) sendViaGrpc(device *models.Device, featureStates []mode
 			dv.logger.Errorw("gRPC - sendViaGrpc - SetValues failed",
 				"code", grpcStatus.Code().String(),
 				"message", grpcStatus.Message(),
-				"target", dv.grpcTarget,
 				"timeout", setValuesGRPCTimeout.String(),
 			)
 		} else {
@@ -360,6 +540,7 @@ func (dv *DevicesValues) validateFeatureStatesForDevice(device *models.Device, f
 		controllerFeatures[feature.UUID] = feature
 	}
 
+	var valuesErr featureValuesError
 	for _, featureState := range featureStates {
 		feature, found := controllerFeatures[featureState.FeatureUUID]
 		if !found {
@@ -371,6 +552,17 @@ func (dv *DevicesValues) validateFeatureStatesForDevice(device *models.Device, f
 		if featureState.Type != models.Controller || featureState.Name != feature.Name {
 			return fmt.Errorf("feature %s does not match device feature metadata", featureState.FeatureUUID)
 		}
+		// collect all out of spec values, so clients can report them at once
+		if err := utils.ValidateSpecValue(feature.Spec, featureState.Value); err != nil {
+			valuesErr.features = append(valuesErr.features, FeatureValueError{
+				FeatureUUID: feature.UUID,
+				Name:        feature.Name,
+				Error:       err.Error(),
+			})
+		}
+	}
+	if len(valuesErr.features) > 0 {
+		return &valuesErr
 	}
 	return nil
 }
@@ -384,3 +576,59 @@ func (dv *DevicesValues) getDevice(ctx context.Context, deviceID bson.ObjectID)
 	dv.logger.Debug("Device found: ", device)
 	return device, err
 }
+
+// setHomeDeviceValues sends featureStates to a device of home on behalf of profile, like PostValuesDevice.
+// Scenes and schedules store values in advance, so the device is checked again to be in the home,
+// to be controllable by profile and to accept those values.
+// The outcome is recorded in the audit log with the request fields or client type of source.
+func (dv *DevicesValues) setHomeDeviceValues(ctx context.Context, source models.AuditEvent, profile *models.Profile, home *models.Home, deviceID bson.ObjectID, featureStates []models.DeviceFeatureState) *deviceValuesError {
+	valuesErr := dv.sendHomeDeviceValues(ctx, profile, home, deviceID, featureStates)
+
+	event := source
+	event.ActorID = profile.ID
+	event.Action = models.AuditActionDeviceValuesSet
+	event.TargetType = models.AuditTargetDevice
+	event.TargetID = deviceID.Hex()
+	event.Outcome = models.AuditOutcomeSuccess
+	if valuesErr != nil {
+		event.Outcome = models.AuditOutcomeFailure
+		event.Reason = valuesErr.message
+	} else {
+		dv.logger.Infow("AUDIT - device values set",
+			"profileID", profile.ID.Hex(),
+			"deviceID", deviceID.Hex(),
+			"clientType", source.ClientType,
+		)
+	}
+	dv.audit.recordEvent(event)
+	return valuesErr
+}
+
+func (dv *DevicesValues) sendHomeDeviceValues(ctx context.Context, profile *models.Profile, home *models.Home, deviceID bson.ObjectID, featureStates []models.DeviceFeatureState) *deviceValuesError {
+	if !isDeviceInHome(home, deviceID) {
+		return &deviceValuesError{message: "device is not in a room of this home"}
+	}
+	owner, err := resolveDeviceAccess(ctx, dv.collProfiles, dv.collHomes, profile, deviceID, models.HomeRoleMember)
+	if err != nil {
+		return &deviceValuesError{message: "you don't have permission to control this device", err: err}
+	}
+	device, err := dv.getDevice(ctx, deviceID)
+	if err != nil {
+		return &deviceValuesError{message: "device not found", err: err}
+	}
+	if err = dv.validateFeatureStatesForDevice(&device, featureStates); err != nil {
+		var valuesErr *featureValuesError
+		if errors.As(err, &valuesErr) {
+			return &deviceValuesError{message: "invalid device feature values", features: valuesErr.features, err: err}
+		}
+		return &deviceValuesError{message: "invalid device feature", err: err}
+	}
+	apiToken, err := decryptProfileAPIToken(&owner)
+	if err != nil {
+		return &deviceValuesError{message: "cannot set device values", err: err}
+	}
+	if err = dv.setDeviceValues(ctx, &device, featureStates, apiToken); err != nil {
+		return &deviceValuesError{message: "cannot set value", err: err}
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package api
+
+import (
+	"api-server/utils"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// eventsHeartbeatInterval keeps streams open through proxies closing idle connections
+const eventsHeartbeatInterval = 25 * time.Second
+
+// Events streams changes of homes and devices to clients with Server-Sent Events.
+type Events struct {
+	hub    *EventsHub
+	logger *zap.SugaredLogger
+}
+
+// NewEvents constructs an Events handler streaming events published to hub.
+func NewEvents(logger *zap.SugaredLogger, hub *EventsHub) *Events {
+	return &Events{
+		hub:    hub,
+		logger: logger,
+	}
+}
+
+// GetEvents streams events of homes and devices accessible by the logged profile,
+// until the client disconnects or the access token expires.
+// Every event has its type as SSE event name and a models.Event as JSON data.
+// Events published while disconnected are lost, so clients must reload their state after reconnecting.
+func (ev *Events) GetEvents(c *gin.Context) {
+	ev.logger.Info("REST - GET - GetEvents called")
+
+	profile, err := utils.GetProfileFromContext(c)
+	if err != nil {
+		ev.logger.Error("REST - GET - GetEvents - cannot find profile")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "cannot find profile"})
+		return
+	}
+	expiresAt, err := utils.GetTokenExpirationFromContext(c)
+	if err != nil {
+		ev.logger.Errorf("REST - GET - GetEvents - cannot read token expiration, err = %v", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "cannot read token expiration"})
+		return
+	}
+
+	sub := ev.hub.subscribe(profile.ID)
+	defer ev.hub.unsubscribe(sub)
+	expiration := time.NewTimer(time.Until(expiresAt))
+	defer expiration.Stop()
+	heartbeat := time.NewTicker(eventsHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	// otherwise nginx buffers events
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	// clients can rely on events published after this one
+	c.SSEvent("ready", gin.H{"profileId": profile.ID})
+	c.Writer.Flush()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			ev.logger.Debugf("REST - GET - GetEvents - stream of profile %s closed by the client", profile.ID.Hex())
+			return
+		case <-expiration.C:
+			ev.logger.Debugf("REST - GET - GetEvents - access token of profile %s expired", profile.ID.Hex())
+			c.SSEvent("expired", gin.H{"message": "token is expired"})
+			c.Writer.Flush()
+			return
+		case <-heartbeat.C:
+			// comments are ignored by clients
+			if _, err = io.WriteString(c.Writer, ": heartbeat\n\n"); err != nil {
+				return
+			}
+			c.Writer.Flush()
+		case event, open := <-sub.events:
+			if !open {
+				ev.logger.Warnf("REST - GET - GetEvents - stream of profile %s closed, because too slow", profile.ID.Hex())
+				return
+			}
+			c.SSEvent(string(event.Type), event)
+			c.Writer.Flush()
+		}
+	}
+}
@@ -0,0 +1,394 @@
+package api
+
+import (
+	"api-server/db"
+	"api-server/models"
+	"api-server/utils"
+	"context"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"go.uber.org/zap"
+)
+
+const (
+	// eventsBufferSize is the number of events queued for every stream, streams that don't keep up are closed
+	eventsBufferSize = 64
+	// onlineWatchInterval is how often online statuses are read, while at least a stream is open
+	onlineWatchInterval = 15 * time.Second
+	// onlineTimeout is the time without updates from a device, after which it is offline
+	onlineTimeout = time.Minute
+	// maxParallelOnlineReads limits online statuses read at the same time by the watcher
+	maxParallelOnlineReads = 8
+)
+
+// eventSubscriber is an open stream of a profile.
+type eventSubscriber struct {
+	profileID bson.ObjectID
+	events    chan models.Event
+}
+
+// EventsHub delivers events to the streams opened on this instance.
+// Handlers publish events after their changes, to the profiles that can access the changed home or device.
+// Those profiles are searched only if at least a stream is open, so publishing is cheap without streams.
+// While streams are open, online statuses of their devices are read periodically to publish transitions.
+// A nil EventsHub ignores everything.
+type EventsHub struct {
+	collProfiles *mongo.Collection
+	collHomes    *mongo.Collection
+	collDevices  *mongo.Collection
+	online       *Online
+	logger       *zap.SugaredLogger
+
+	mu          sync.Mutex
+	subscribers map[bson.ObjectID]map[*eventSubscriber]struct{}
+	stopWatcher context.CancelFunc
+}
+
+// NewEventsHub constructs an EventsHub with the given dependencies.
+// It must be shared by all handlers and background jobs publishing events.
+func NewEventsHub(logger *zap.SugaredLogger, client *mongo.Client) *EventsHub {
+	return &EventsHub{
+		collProfiles: db.GetCollections(client).Profiles,
+		collHomes:    db.GetCollections(client).Homes,
+		collDevices:  db.GetCollections(client).Devices,
+		online:       NewOnline(logger, client),
+		logger:       logger,
+		subscribers:  make(map[bson.ObjectID]map[*eventSubscriber]struct{}),
+	}
+}
+
+// ------------------------------ Private methods ------------------------------
+
+// subscribe opens a stream of profileID. Its channel is closed by unsubscribe,
+// or as soon as it doesn't keep up with events.
+func (e *EventsHub) subscribe(profileID bson.ObjectID) *eventSubscriber {
+	sub := &eventSubscriber{
+		profileID: profileID,
+		events:    make(chan models.Event, eventsBufferSize),
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.subscribers[profileID] == nil {
+		e.subscribers[profileID] = make(map[*eventSubscriber]struct{})
+	}
+	e.subscribers[profileID][sub] = struct{}{}
+	if e.stopWatcher == nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		e.stopWatcher = cancel
+		go e.watchOnline(ctx)
+	}
+	return sub
+}
+
+// unsubscribe closes the stream sub, if not already closed.
+func (e *EventsHub) unsubscribe(sub *eventSubscriber) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.removeLocked(sub)
+}
+
+// removeLocked closes sub and stops the online watcher with the last stream. e.mu must be held.
+func (e *EventsHub) removeLocked(sub *eventSubscriber) {
+	subs := e.subscribers[sub.profileID]
+	if _, found := subs[sub]; !found {
+		return
+	}
+	delete(subs, sub)
+	close(sub.events)
+	if len(subs) == 0 {
+		delete(e.subscribers, sub.profileID)
+	}
+	if len(e.subscribers) == 0 && e.stopWatcher != nil {
+		e.stopWatcher()
+		e.stopWatcher = nil
+	}
+}
+
+func (e *EventsHub) hasSubscribers() bool {
+	if e == nil {
+		return false
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return len(e.subscribers) > 0
+}
+
+// publish sends event to the streams of all profiles in audiences, once per profile.
+// It never blocks, streams with a full buffer are closed, so their clients reconnect and reload their state.
+func (e *EventsHub) publish(event models.Event, audiences ...[]bson.ObjectID) {
+	if e == nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	sent := make(map[bson.ObjectID]bool)
+	for _, audience := range audiences {
+		for _, profileID := range audience {
+			if sent[profileID] {
+				continue
+			}
+			sent[profileID] = true
+			for sub := range e.subscribers[profileID] {
+				select {
+				case sub.events <- event:
+				default:
+					e.logger.Warnf("publish - stream of profile %s doesn't keep up with events, closing it", profileID.Hex())
+					e.removeLocked(sub)
+				}
+			}
+		}
+	}
+}
+
+// publishDeviceValues publishes states of deviceID to the profiles that can access it.
+func (e *EventsHub) publishDeviceValues(ctx context.Context, deviceID bson.ObjectID, states []models.DeviceFeatureState) {
+	if len(states) == 0 || !e.hasSubscribers() {
+		return
+	}
+	e.publish(models.Event{
+		Type:     models.EventDeviceValues,
+		DeviceID: &deviceID,
+		Data:     states,
+	}, e.deviceAudience(ctx, deviceID))
+}
+
+// homeAudience returns the profiles that can access homeID, or nil without streams.
+// Search it before removing profiles from the home, to notify them too.
+func (e *EventsHub) homeAudience(ctx context.Context, homeID bson.ObjectID) []bson.ObjectID {
+	if !e.hasSubscribers() {
+		return nil
+	}
+	audience, err := e.findHomesAudience(ctx, []bson.ObjectID{homeID})
+	if err != nil {
+		e.logger.Errorf("homeAudience - cannot find profiles of home %s, err = %v", homeID.Hex(), err)
+		return nil
+	}
+	return audience
+}
+
+// deviceAudience returns the owner of deviceID and the profiles of homes containing it, or nil without streams.
+// Search it before moving or removing the device, to notify profiles that are losing it too.
+func (e *EventsHub) deviceAudience(ctx context.Context, deviceID bson.ObjectID) []bson.ObjectID {
+	if !e.hasSubscribers() {
+		return nil
+	}
+	audience, err := e.findDeviceAudience(ctx, deviceID)
+	if err != nil {
+		e.logger.Errorf("deviceAudience - cannot find profiles of device %s, err = %v", deviceID.Hex(), err)
+		return nil
+	}
+	return audience
+}
+
+func (e *EventsHub) findDeviceAudience(ctx context.Context, deviceID bson.ObjectID) ([]bson.ObjectID, error) {
+	owners, err := e.findProfileIDs(ctx, bson.M{"devices": deviceID})
+	if err != nil {
+		return nil, err
+	}
+	cur, err := e.collHomes.Find(ctx, bson.M{"rooms.devices": deviceID}, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var homes []models.Home
+	if err = cur.All(ctx, &homes); err != nil {
+		return nil, err
+	}
+	homeIDs := utils.MapSlice(homes, func(home models.Home) bson.ObjectID {
+		return home.ID
+	})
+	homesAudience, err := e.findHomesAudience(ctx, homeIDs)
+	if err != nil {
+		return nil, err
+	}
+	return append(owners, homesAudience...), nil
+}
+
+// findHomesAudience returns members of homeIDs and profiles with them in their homes.
+func (e *EventsHub) findHomesAudience(ctx context.Context, homeIDs []bson.ObjectID) ([]bson.ObjectID, error) {
+	if len(homeIDs) == 0 {
+		return []bson.ObjectID{}, nil
+	}
+	audience, err := e.findProfileIDs(ctx, bson.M{"homes": bson.M{"$in": homeIDs}})
+	if err != nil {
+		return nil, err
+	}
+	cur, err := e.collHomes.Find(ctx, bson.M{"_id": bson.M{"$in": homeIDs}}, options.Find().SetProjection(bson.M{"members": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var homes []models.Home
+	if err = cur.All(ctx, &homes); err != nil {
+		return nil, err
+	}
+	for _, home := range homes {
+		for _, member := range home.Members {
+			audience = append(audience, member.ProfileID)
+		}
+	}
+	return audience, nil
+}
+
+func (e *EventsHub) findProfileIDs(ctx context.Context, filter bson.M) ([]bson.ObjectID, error) {
+	cur, err := e.collProfiles.Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var profiles []models.Profile
+	if err = cur.All(ctx, &profiles); err != nil {
+		return nil, err
+	}
+	return utils.MapSlice(profiles, func(profile models.Profile) bson.ObjectID {
+		return profile.ID
+	}), nil
+}
+
+// watchOnline publishes online transitions of devices accessible by profiles with open streams, until ctx is done.
+func (e *EventsHub) watchOnline(ctx context.Context) {
+	e.logger.Info("watchOnline - started")
+	ticker := time.NewTicker(onlineWatchInterval)
+	defer ticker.Stop()
+	// last online status of every watched device
+	statuses := make(map[bson.ObjectID]bool)
+	for {
+		select {
+		case <-ctx.Done():
+			e.logger.Info("watchOnline - stopped")
+			return
+		case <-ticker.C:
+			if err := e.checkOnline(ctx, statuses); err != nil {
+				e.logger.Errorf("watchOnline - cannot check online statuses, err = %v", err)
+			}
+		}
+	}
+}
+
+// checkOnline reads online statuses of watched devices and publishes the changed ones.
+// The first status of a device is only stored, because clients read it when they open the stream.
+func (e *EventsHub) checkOnline(ctx context.Context, statuses map[bson.ObjectID]bool) error {
+	audiences, err := e.findWatchedDevices(ctx)
+	if err != nil {
+		return err
+	}
+	for deviceID := range statuses {
+		if _, watched := audiences[deviceID]; !watched {
+			delete(statuses, deviceID)
+		}
+	}
+	if len(audiences) == 0 {
+		return nil
+	}
+
+	deviceIDs := make([]bson.ObjectID, 0, len(audiences))
+	for deviceID := range audiences {
+		deviceIDs = append(deviceIDs, deviceID)
+	}
+	cur, err := e.collDevices.Find(ctx, bson.M{"_id": bson.M{"$in": deviceIDs}})
+	if err != nil {
+		return err
+	}
+	var devices []models.Device
+	if err = cur.All(ctx, &devices); err != nil {
+		return err
+	}
+
+	type onlineResult struct {
+		deviceID bson.ObjectID
+		online   models.Online
+	}
+	var results []onlineResult
+	var resultsMu sync.Mutex
+	var wg sync.WaitGroup
+	readsLimit := make(chan struct{}, maxParallelOnlineReads)
+	for _, device := range devices {
+		onlineFeature := utils.GetOnlineFeature(device.Features)
+		if onlineFeature == nil {
+			continue
+		}
+		wg.Go(func() {
+			select {
+			case readsLimit <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			defer func() { <-readsLimit }()
+			online, errOnline := e.online.readOnline(ctx, &device, onlineFeature)
+			if errOnline != nil {
+				e.logger.Debugf("checkOnline - cannot get online of device %s, err = %v", device.ID.Hex(), errOnline)
+				return
+			}
+			resultsMu.Lock()
+			defer resultsMu.Unlock()
+			results = append(results, onlineResult{deviceID: device.ID, online: online})
+		})
+	}
+	wg.Wait()
+
+	for _, result := range results {
+		isOnline := result.online.CurrentTime.Sub(result.online.ModifiedAt) <= onlineTimeout
+		wasOnline, known := statuses[result.deviceID]
+		statuses[result.deviceID] = isOnline
+		if !known || wasOnline == isOnline {
+			continue
+		}
+		e.publish(models.Event{
+			Type:     models.EventDeviceOnline,
+			DeviceID: &result.deviceID,
+			Data: models.DeviceOnlineEvent{
+				Online:     isOnline,
+				ModifiedAt: result.online.ModifiedAt,
+			},
+		}, audiences[result.deviceID])
+	}
+	return nil
+}
+
+// findWatchedDevices returns devices accessible by profiles with open streams, with those profiles.
+func (e *EventsHub) findWatchedDevices(ctx context.Context) (map[bson.ObjectID][]bson.ObjectID, error) {
+	e.mu.Lock()
+	profileIDs := make([]bson.ObjectID, 0, len(e.subscribers))
+	for profileID := range e.subscribers {
+		profileIDs = append(profileIDs, profileID)
+	}
+	e.mu.Unlock()
+
+	audiences := make(map[bson.ObjectID][]bson.ObjectID)
+	if len(profileIDs) == 0 {
+		return audiences, nil
+	}
+	cur, err := e.collProfiles.Find(ctx, bson.M{"_id": bson.M{"$in": profileIDs}})
+	if err != nil {
+		return nil, err
+	}
+	var profiles []models.Profile
+	if err = cur.All(ctx, &profiles); err != nil {
+		return nil, err
+	}
+	for _, profile := range profiles {
+		deviceIDs := make(map[bson.ObjectID]bool)
+		for _, deviceID := range profile.Devices {
+			deviceIDs[deviceID] = true
+		}
+		homes, err := findProfileHomes(ctx, e.collHomes, &profile)
+		if err != nil {
+			return nil, err
+		}
+		for _, home := range homes {
+			for _, room := range home.Rooms {
+				for _, deviceID := range room.Devices {
+					deviceIDs[deviceID] = true
+				}
+			}
+		}
+		for deviceID := range deviceIDs {
+			audiences[deviceID] = append(audiences[deviceID], profile.ID)
+		}
+	}
+	return audiences, nil
+}
@@ -3,10 +3,13 @@ package api
 import (
 	"api-server/customerrors"
 	"api-server/db"
+	"api-server/models"
 	"api-server/utils"
+	"context"
 	"encoding/json"
 	"net/http"
 	"os"
+	"sort"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -16,15 +19,28 @@ import (
 	"go.uber.org/zap"
 )
 
+const (
+	// fcmTokenStaleAfter is the time after which a token not registered again is stale and removed.
+	// Apps register their token at every start, so only uninstalled or unused ones become stale.
+	fcmTokenStaleAfter = 30 * 24 * time.Hour
+	// maxFCMTokensPerProfile limits tokens of a profile, the least recently seen ones are removed
+	maxFCMTokensPerProfile = 10
+)
+
 // InitFCMTokenReq is the request body for registering a Firebase Cloud Messaging token.
+// Registering an existing token refreshes it, keeping its label and platform if not passed.
 type InitFCMTokenReq struct {
-	FCMToken string `json:"fcmToken" validate:"required,max=512"`
+	FCMToken    string             `json:"fcmToken" validate:"required,max=512"`
+	DeviceLabel string             `json:"deviceLabel" validate:"omitempty,max=50"`
+	Platform    models.FCMPlatform `json:"platform" validate:"omitempty,oneof=android ios web"`
 }
 
-// OnlineFCMReq is the payload forwarded to the online service to associate an FCM token with an API token.
+// OnlineFCMReq is the payload forwarded to the online service to associate all FCM tokens of a profile with its API token.
 type OnlineFCMReq struct {
 	APIToken string `json:"apiToken" validate:"required"`
-	FCMToken string `json:"fcmToken" validate:"required,max=512"`
+	// FCMToken is the token just registered, for online services supporting a single token
+	FCMToken  string   `json:"fcmToken,omitempty"`
+	FCMTokens []string `json:"fcmTokens"`
 }
 
 // FCMToken handles Firebase Cloud Messaging token registration for push notifications.
@@ -34,11 +50,12 @@ type FCMToken struct {
 	logger             *zap.SugaredLogger
 	keepAliveOnlineURL string
 	fcmTokenOnlineURL  string
+	audit              *AuditLog
 	validate           *validator.Validate
 }
 
 // NewFCMToken constructs an FCMToken handler with the given dependencies.
-func NewFCMToken(logger *zap.SugaredLogger, client *mongo.Client, validate *validator.Validate) *FCMToken {
+func NewFCMToken(logger *zap.SugaredLogger, client *mongo.Client, validate *validator.Validate, audit *AuditLog) *FCMToken {
 	onlineServerURL := os.Getenv("HTTP_ONLINE_SERVER") + ":" + os.Getenv("HTTP_ONLINE_PORT")
 	keepAliveOnlineURL := onlineServerURL + os.Getenv("HTTP_ONLINE_KEEPALIVE_API")
 	fcmTokenOnlineURL := onlineServerURL + os.Getenv("HTTP_ONLINE_FCMTOKEN_API")
@@ -49,6 +66,7 @@ func NewFCMToken(logger *zap.SugaredLogger, client *mongo.Client, validate *vali
 		logger:             logger,
 		keepAliveOnlineURL: keepAliveOnlineURL,
 		fcmTokenOnlineURL:  fcmTokenOnlineURL,
+		audit:              audit,
 		validate:           validate,
 	}
 }
@@ -81,21 +99,6 @@ func (ft *FCMToken) PostFCMToken(c *gin.Context) {
 		return
 	}
 
-	// store FCM Token also on profile
-	_, err = ft.collProfiles.UpdateOne(c.Request.Context(), bson.M{
-		"_id": profile.ID,
-	}, bson.M{
-		"$set": bson.M{
-			"fcmToken":          initFCMTokenBody.FCMToken,
-			"fcmTokenTimestamp": time.Now(),
-		},
-	})
-	if err != nil {
-		ft.logger.Error("REST - POST - PostFCMToken - Cannot update profile with fcmToken")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot update profile with fcmToken"})
-		return
-	}
-
 	apiToken, err := decryptProfileAPIToken(&profile)
 	if err != nil {
 		ft.logger.Error("REST - POST - PostFCMToken - cannot load profile api token")
@@ -103,9 +106,14 @@ func (ft *FCMToken) PostFCMToken(c *gin.Context) {
 		return
 	}
 
+	// the online service is updated first, so the token is stored only if it receives notifications
+	now := time.Now()
+	fcmToken := newFCMToken(&profile, initFCMTokenBody, now)
+	fcmTokens := nextFCMTokens(profile.FCMTokens, fcmToken, now)
 	var onlineFCMReq = OnlineFCMReq{
-		APIToken: apiToken,
-		FCMToken: initFCMTokenBody.FCMToken,
+		APIToken:  apiToken,
+		FCMToken:  initFCMTokenBody.FCMToken,
+		FCMTokens: fcmTokenValues(fcmTokens),
 	}
 	err = ft.initFCMTokenViaHTTP(&onlineFCMReq)
 	if err != nil {
@@ -116,12 +124,154 @@ func (ft *FCMToken) PostFCMToken(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cannot initialize FCM Token"})
 		return
 	}
+
+	// an app installation receives notifications of a single profile, the last one logged in
+	ft.releaseFCMToken(c.Request.Context(), profile.ID, initFCMTokenBody.FCMToken)
+
+	// store FCM Token also on profile
+	if err = upsertFCMToken(c.Request.Context(), ft.collProfiles, profile.ID, fcmToken, now); err != nil {
+		ft.logger.Errorf("REST - POST - PostFCMToken - Cannot update profile with fcmToken, err = %v", err)
+		// restores the tokens of the profile in the online service, to match the ones in db
+		if errSync := ft.syncFCMTokens(&profile, freshFCMTokens(profile.FCMTokens, now)); errSync != nil {
+			ft.logger.Errorf("REST - POST - PostFCMToken - cannot restore FCM Tokens via HTTP, err = %v", errSync)
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot update profile with fcmToken"})
+		return
+	}
+
 	ft.logger.Infow("AUDIT - FCM token registered",
 		"profileID", profile.ID.Hex(),
+		"fcmTokens", len(fcmTokens),
 	)
+	ft.audit.record(c, models.AuditEvent{
+		ActorID:    profile.ID,
+		Action:     models.AuditActionFCMTokenRegistered,
+		TargetType: models.AuditTargetProfile,
+		TargetID:   profile.ID.Hex(),
+		Outcome:    models.AuditOutcomeSuccess,
+	})
 	c.JSON(http.StatusOK, gin.H{"message": "FCMToken assigned to APIToken"})
 }
 
+// GetFCMTokens returns FCM tokens of the logged profile, from the most recently seen. Stale tokens are not returned.
+func (ft *FCMToken) GetFCMTokens(c *gin.Context) {
+	ft.logger.Info("REST - GET - GetFCMTokens called")
+
+	profile, err := utils.GetLoggedProfileFromContext(c, ft.collProfiles)
+	if err != nil {
+		ft.logger.Error("REST - GET - GetFCMTokens - cannot find profile")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "cannot find profile"})
+		return
+	}
+
+	fcmTokens := freshFCMTokens(profile.FCMTokens, time.Now())
+	sort.Slice(fcmTokens, func(i, j int) bool {
+		return fcmTokens[i].LastSeenAt.After(fcmTokens[j].LastSeenAt)
+	})
+	c.JSON(http.StatusOK, fcmTokens)
+}
+
+// DeleteFCMToken removes an FCM token of the logged profile, e.g. to stop notifications on a lost smartphone.
+// The online service is updated first, so the token is not removed if it would still receive notifications.
+func (ft *FCMToken) DeleteFCMToken(c *gin.Context) {
+	ft.logger.Info("REST - DELETE - DeleteFCMToken called")
+
+	tokenID, err := bson.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		ft.logger.Error("REST - DELETE - DeleteFCMToken - wrong format of the path param 'id'")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "wrong format of the path param 'id'"})
+		return
+	}
+
+	profile, err := utils.GetLoggedProfileFromContext(c, ft.collProfiles)
+	if err != nil {
+		ft.logger.Error("REST - DELETE - DeleteFCMToken - cannot find profile")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "cannot find profile"})
+		return
+	}
+	fcmTokens := freshFCMTokens(profile.FCMTokens, time.Now())
+	remainingTokens := utils.FilterSlice(fcmTokens, func(fcmToken models.FCMToken) bool {
+		return fcmToken.ID != tokenID
+	})
+	if len(remainingTokens) == len(fcmTokens) {
+		ft.logger.Errorf("REST - DELETE - DeleteFCMToken - cannot find fcm token with id: %v", tokenID)
+		c.JSON(http.StatusNotFound, gin.H{"error": "fcm token not found"})
+		return
+	}
+
+	if err = ft.syncFCMTokens(&profile, remainingTokens); err != nil {
+		ft.logger.Errorf("REST - DELETE - DeleteFCMToken - cannot update FCM Tokens via HTTP. Err %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot delete fcm token"})
+		return
+	}
+	_, err = ft.collProfiles.UpdateOne(c.Request.Context(), bson.M{
+		"_id": profile.ID,
+	}, bson.M{
+		"$pull": bson.M{"fcmTokens": bson.M{"_id": tokenID}},
+		"$set":  bson.M{"modifiedAt": time.Now()},
+	})
+	if err != nil {
+		ft.logger.Errorf("REST - DELETE - DeleteFCMToken - cannot remove fcm token from profile, err = %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot delete fcm token"})
+		return
+	}
+
+	ft.logger.Infow("AUDIT - FCM token deleted",
+		"profileID", profile.ID.Hex(),
+		"fcmTokenID", tokenID.Hex(),
+	)
+	c.JSON(http.StatusOK, gin.H{"message": "fcm token has been deleted"})
+}
+
+// ------------------------------ Private methods ------------------------------
+
+// releaseFCMToken removes token from profiles other than profileID, updating the online service for them.
+// It is best-effort, because a failure must not prevent the registration for profileID.
+func (ft *FCMToken) releaseFCMToken(ctx context.Context, profileID bson.ObjectID, token string) {
+	cur, err := ft.collProfiles.Find(ctx, bson.M{
+		"_id":             bson.M{"$ne": profileID},
+		"fcmTokens.token": token,
+	})
+	if err != nil {
+		ft.logger.Errorf("releaseFCMToken - cannot find other profiles with the fcm token, err = %v", err)
+		return
+	}
+	var profiles []models.Profile
+	if err = cur.All(ctx, &profiles); err != nil {
+		ft.logger.Errorf("releaseFCMToken - cannot find other profiles with the fcm token, err = %v", err)
+		return
+	}
+	for _, profile := range profiles {
+		_, err = ft.collProfiles.UpdateOne(ctx, bson.M{
+			"_id": profile.ID,
+		}, bson.M{
+			"$pull": bson.M{"fcmTokens": bson.M{"token": token}},
+		})
+		if err != nil {
+			ft.logger.Errorf("releaseFCMToken - cannot remove fcm token from profile %s, err = %v", profile.ID.Hex(), err)
+			continue
+		}
+		remainingTokens := utils.FilterSlice(freshFCMTokens(profile.FCMTokens, time.Now()), func(fcmToken models.FCMToken) bool {
+			return fcmToken.Token != token
+		})
+		if err = ft.syncFCMTokens(&profile, remainingTokens); err != nil {
+			ft.logger.Errorf("releaseFCMToken - cannot update FCM Tokens of profile %s via HTTP, err = %v", profile.ID.Hex(), err)
+		}
+	}
+}
+
+// syncFCMTokens replaces FCM tokens of profile in the online service with fcmTokens.
+func (ft *FCMToken) syncFCMTokens(profile *models.Profile, fcmTokens []models.FCMToken) error {
+	apiToken, err := decryptProfileAPIToken(profile)
+	if err != nil {
+		return err
+	}
+	return ft.initFCMTokenViaHTTP(&OnlineFCMReq{
+		APIToken:  apiToken,
+		FCMTokens: fcmTokenValues(fcmTokens),
+	})
+}
+
 func (ft *FCMToken) initFCMTokenViaHTTP(obj *OnlineFCMReq) error {
 	// check if service is available calling keep-alive
 	_, _, keepAliveErr := utils.Get(ft.keepAliveOnlineURL)
@@ -141,3 +291,87 @@ func (ft *FCMToken) initFCMTokenViaHTTP(obj *OnlineFCMReq) error {
 	}
 	return nil
 }
+
+// newFCMToken returns the token of req to store in profile, keeping id, creation time, label and platform
+// of the same token if it is already there.
+func newFCMToken(profile *models.Profile, req InitFCMTokenReq, now time.Time) models.FCMToken {
+	fcmToken := models.FCMToken{
+		ID:          bson.NewObjectID(),
+		Token:       req.FCMToken,
+		DeviceLabel: req.DeviceLabel,
+		Platform:    req.Platform,
+		CreatedAt:   now,
+		LastSeenAt:  now,
+	}
+	for _, existing := range profile.FCMTokens {
+		if existing.Token != req.FCMToken {
+			continue
+		}
+		fcmToken.ID = existing.ID
+		fcmToken.CreatedAt = existing.CreatedAt
+		if fcmToken.DeviceLabel == "" {
+			fcmToken.DeviceLabel = existing.DeviceLabel
+		}
+		if fcmToken.Platform == "" {
+			fcmToken.Platform = existing.Platform
+		}
+	}
+	return fcmToken
+}
+
+// nextFCMTokens returns the tokens stored by upsertFCMToken adding fcmToken to fcmTokens,
+// to send them to the online service before updating the profile.
+func nextFCMTokens(fcmTokens []models.FCMToken, fcmToken models.FCMToken, now time.Time) []models.FCMToken {
+	next := utils.FilterSlice(freshFCMTokens(fcmTokens, now), func(existing models.FCMToken) bool {
+		return existing.Token != fcmToken.Token
+	})
+	next = append(next, fcmToken)
+	sort.SliceStable(next, func(i, j int) bool {
+		return next[i].LastSeenAt.After(next[j].LastSeenAt)
+	})
+	if len(next) > maxFCMTokensPerProfile {
+		next = next[:maxFCMTokensPerProfile]
+	}
+	return next
+}
+
+// upsertFCMToken adds fcmToken to the profile with profileID, replacing the same token if already there
+// and removing stale tokens. Only the maxFCMTokensPerProfile most recently seen tokens are kept.
+func upsertFCMToken(ctx context.Context, collProfiles *mongo.Collection, profileID bson.ObjectID, fcmToken models.FCMToken, now time.Time) error {
+	// the same array cannot be pulled and pushed by a single update
+	_, err := collProfiles.UpdateOne(ctx, bson.M{
+		"_id": profileID,
+	}, bson.M{
+		"$pull": bson.M{"fcmTokens": bson.M{"$or": bson.A{
+			bson.M{"token": fcmToken.Token},
+			bson.M{"lastSeenAt": bson.M{"$lt": now.Add(-fcmTokenStaleAfter)}},
+		}}},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = collProfiles.UpdateOne(ctx, bson.M{
+		"_id": profileID,
+	}, bson.M{
+		"$push": bson.M{"fcmTokens": bson.M{
+			"$each":  bson.A{fcmToken},
+			"$sort":  bson.M{"lastSeenAt": -1},
+			"$slice": maxFCMTokensPerProfile,
+		}},
+		"$set": bson.M{"modifiedAt": now},
+	})
+	return err
+}
+
+// freshFCMTokens returns fcmTokens seen within fcmTokenStaleAfter from now
+func freshFCMTokens(fcmTokens []models.FCMToken, now time.Time) []models.FCMToken {
+	return utils.FilterSlice(fcmTokens, func(fcmToken models.FCMToken) bool {
+		return now.Sub(fcmToken.LastSeenAt) <= fcmTokenStaleAfter
+	})
+}
+
+func fcmTokenValues(fcmTokens []models.FCMToken) []string {
+	return utils.MapSlice(fcmTokens, func(fcmToken models.FCMToken) string {
+		return fcmToken.Token
+	})
+}
@@ -369,6 +369,264 @@ func (x *SetValueResponse) GetMessage() string {
 	return ""
 }
 
+type GetValuesRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"` // device id
+	DeviceUuid    string                 `protobuf:"bytes,2,opt,name=deviceUuid,proto3" json:"deviceUuid,omitempty"`
+	Mac           string                 `protobuf:"bytes,3,opt,name=mac,proto3" json:"mac,omitempty"`
+	ApiToken      string                 `protobuf:"bytes,4,opt,name=api_token,json=apiToken,proto3" json:"api_token,omitempty"`
+	Features      []*GetValuesFeature    `protobuf:"bytes,5,rep,name=features,proto3" json:"features,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetValuesRequest) Reset() {
+	*x = GetValuesRequest{}
+	mi := &file_api_grpc_device_device_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetValuesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetValuesRequest) ProtoMessage() {}
+
+func (x *GetValuesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_api_grpc_device_device_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetValuesRequest.ProtoReflect.Descriptor instead.
+func (*GetValuesRequest) Descriptor() ([]byte, []int) {
+	return file_api_grpc_device_device_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *GetValuesRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *GetValuesRequest) GetDeviceUuid() string {
+	if x != nil {
+		return x.DeviceUuid
+	}
+	return ""
+}
+
+func (x *GetValuesRequest) GetMac() string {
+	if x != nil {
+		return x.Mac
+	}
+	return ""
+}
+
+func (x *GetValuesRequest) GetApiToken() string {
+	if x != nil {
+		return x.ApiToken
+	}
+	return ""
+}
+
+func (x *GetValuesRequest) GetFeatures() []*GetValuesFeature {
+	if x != nil {
+		return x.Features
+	}
+	return nil
+}
+
+type GetValuesFeature struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	FeatureUuid   string                 `protobuf:"bytes,1,opt,name=featureUuid,proto3" json:"featureUuid,omitempty"`
+	FeatureName   string                 `protobuf:"bytes,2,opt,name=featureName,proto3" json:"featureName,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetValuesFeature) Reset() {
+	*x = GetValuesFeature{}
+	mi := &file_api_grpc_device_device_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetValuesFeature) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetValuesFeature) ProtoMessage() {}
+
+func (x *GetValuesFeature) ProtoReflect() protoreflect.Message {
+	mi := &file_api_grpc_device_device_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetValuesFeature.ProtoReflect.Descriptor instead.
+func (*GetValuesFeature) Descriptor() ([]byte, []int) {
+	return file_api_grpc_device_device_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *GetValuesFeature) GetFeatureUuid() string {
+	if x != nil {
+		return x.FeatureUuid
+	}
+	return ""
+}
+
+func (x *GetValuesFeature) GetFeatureName() string {
+	if x != nil {
+		return x.FeatureName
+	}
+	return ""
+}
+
+type GetValuesResponse struct {
+	state         protoimpl.MessageState  `protogen:"open.v1"`
+	FeatureValues []*FeatureValueResponse `protobuf:"bytes,1,rep,name=featureValues,proto3" json:"featureValues,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetValuesResponse) Reset() {
+	*x = GetValuesResponse{}
+	mi := &file_api_grpc_device_device_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetValuesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetValuesResponse) ProtoMessage() {}
+
+func (x *GetValuesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_api_grpc_device_device_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetValuesResponse.ProtoReflect.Descriptor instead.
+func (*GetValuesResponse) Descriptor() ([]byte, []int) {
+	return file_api_grpc_device_device_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *GetValuesResponse) GetFeatureValues() []*FeatureValueResponse {
+	if x != nil {
+		return x.FeatureValues
+	}
+	return nil
+}
+
+// FeatureValueResponse is the value of a single feature.
+// If error is not empty, the value cannot be read and the other values are still valid.
+type FeatureValueResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	FeatureUuid   string                 `protobuf:"bytes,1,opt,name=featureUuid,proto3" json:"featureUuid,omitempty"`
+	FeatureName   string                 `protobuf:"bytes,2,opt,name=featureName,proto3" json:"featureName,omitempty"`
+	Value         float32                `protobuf:"fixed32,3,opt,name=value,proto3" json:"value,omitempty"`
+	CreatedAt     int64                  `protobuf:"varint,4,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	ModifiedAt    int64                  `protobuf:"varint,5,opt,name=modified_at,json=modifiedAt,proto3" json:"modified_at,omitempty"`
+	Error         string                 `protobuf:"bytes,6,opt,name=error,proto3" json:"error,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FeatureValueResponse) Reset() {
+	*x = FeatureValueResponse{}
+	mi := &file_api_grpc_device_device_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FeatureValueResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FeatureValueResponse) ProtoMessage() {}
+
+func (x *FeatureValueResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_api_grpc_device_device_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FeatureValueResponse.ProtoReflect.Descriptor instead.
+func (*FeatureValueResponse) Descriptor() ([]byte, []int) {
+	return file_api_grpc_device_device_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *FeatureValueResponse) GetFeatureUuid() string {
+	if x != nil {
+		return x.FeatureUuid
+	}
+	return ""
+}
+
+func (x *FeatureValueResponse) GetFeatureName() string {
+	if x != nil {
+		return x.FeatureName
+	}
+	return ""
+}
+
+func (x *FeatureValueResponse) GetValue() float32 {
+	if x != nil {
+		return x.Value
+	}
+	return 0
+}
+
+func (x *FeatureValueResponse) GetCreatedAt() int64 {
+	if x != nil {
+		return x.CreatedAt
+	}
+	return 0
+}
+
+func (x *FeatureValueResponse) GetModifiedAt() int64 {
+	if x != nil {
+		return x.ModifiedAt
+	}
+	return 0
+}
+
+func (x *FeatureValueResponse) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
 var File_api_grpc_device_device_proto protoreflect.FileDescriptor
 
 const file_api_grpc_device_device_proto_rawDesc = "" +
@@ -405,9 +663,32 @@ const file_api_grpc_device_device_proto_rawDesc = "" +
 	"\x05value\x18\x03 \x01(\x02R\x05value\"D\n" +
 	"\x10SetValueResponse\x12\x16\n" +
 	"\x06status\x18\x01 \x01(\tR\x06status\x12\x18\n" +
-	"\amessage\x18\x02 \x01(\tR\amessage2\x8c\x01\n" +
+	"\amessage\x18\x02 \x01(\tR\amessage\"\xa7\x01\n" +
+	"\x10GetValuesRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x1e\n" +
+	"\n" +
+	"deviceUuid\x18\x02 \x01(\tR\n" +
+	"deviceUuid\x12\x10\n" +
+	"\x03mac\x18\x03 \x01(\tR\x03mac\x12\x1b\n" +
+	"\tapi_token\x18\x04 \x01(\tR\bapiToken\x124\n" +
+	"\bfeatures\x18\x05 \x03(\v2\x18.device.GetValuesFeatureR\bfeatures\"V\n" +
+	"\x10GetValuesFeature\x12 \n" +
+	"\vfeatureUuid\x18\x01 \x01(\tR\vfeatureUuid\x12 \n" +
+	"\vfeatureName\x18\x02 \x01(\tR\vfeatureName\"W\n" +
+	"\x11GetValuesResponse\x12B\n" +
+	"\rfeatureValues\x18\x01 \x03(\v2\x1c.device.FeatureValueResponseR\rfeatureValues\"\xc6\x01\n" +
+	"\x14FeatureValueResponse\x12 \n" +
+	"\vfeatureUuid\x18\x01 \x01(\tR\vfeatureUuid\x12 \n" +
+	"\vfeatureName\x18\x02 \x01(\tR\vfeatureName\x12\x14\n" +
+	"\x05value\x18\x03 \x01(\x02R\x05value\x12\x1d\n" +
+	"\n" +
+	"created_at\x18\x04 \x01(\x03R\tcreatedAt\x12\x1f\n" +
+	"\vmodified_at\x18\x05 \x01(\x03R\n" +
+	"modifiedAt\x12\x14\n" +
+	"\x05error\x18\x06 \x01(\tR\x05error2\xd0\x01\n" +
 	"\x06Device\x12?\n" +
-	"\bGetValue\x12\x17.device.GetValueRequest\x1a\x18.device.GetValueResponse\"\x00\x12A\n" +
+	"\bGetValue\x12\x17.device.GetValueRequest\x1a\x18.device.GetValueResponse\"\x00\x12B\n" +
+	"\tGetValues\x12\x18.device.GetValuesRequest\x1a\x19.device.GetValuesResponse\"\x00\x12A\n" +
 	"\tSetValues\x12\x18.device.SetValuesRequest\x1a\x18.device.SetValueResponse\"\x00B0Z.github.com/Ks89/home-anthill/api-server/deviceb\x06proto3"
 
 var (
@@ -422,25 +703,33 @@ func file_api_grpc_device_device_proto_rawDescGZIP() []byte {
 	return file_api_grpc_device_device_proto_rawDescData
 }
 
-var file_api_grpc_device_device_proto_msgTypes = make([]protoimpl.MessageInfo, 5)
+var file_api_grpc_device_device_proto_msgTypes = make([]protoimpl.MessageInfo, 9)
 var file_api_grpc_device_device_proto_goTypes = []any{
-	(*GetValueRequest)(nil),  // 0: device.GetValueRequest
-	(*GetValueResponse)(nil), // 1: device.GetValueResponse
-	(*SetValuesRequest)(nil), // 2: device.SetValuesRequest
-	(*SetValueRequest)(nil),  // 3: device.SetValueRequest
-	(*SetValueResponse)(nil), // 4: device.SetValueResponse
+	(*GetValueRequest)(nil),      // 0: device.GetValueRequest
+	(*GetValueResponse)(nil),     // 1: device.GetValueResponse
+	(*SetValuesRequest)(nil),     // 2: device.SetValuesRequest
+	(*SetValueRequest)(nil),      // 3: device.SetValueRequest
+	(*SetValueResponse)(nil),     // 4: device.SetValueResponse
+	(*GetValuesRequest)(nil),     // 5: device.GetValuesRequest
+	(*GetValuesFeature)(nil),     // 6: device.GetValuesFeature
+	(*GetValuesResponse)(nil),    // 7: device.GetValuesResponse
+	(*FeatureValueResponse)(nil), // 8: device.FeatureValueResponse
 }
 var file_api_grpc_device_device_proto_depIdxs = []int32{
 	3, // 0: device.SetValuesRequest.featureValues:type_name -> device.SetValueRequest
-	0, // 1: device.Device.GetValue:input_type -> device.GetValueRequest
-	2, // 2: device.Device.SetValues:input_type -> device.SetValuesRequest
-	1, // 3: device.Device.GetValue:output_type -> device.GetValueResponse
-	4, // 4: device.Device.SetValues:output_type -> device.SetValueResponse
-	3, // [3:5] is the sub-list for method output_type
-	1, // [1:3] is the sub-list for method input_type
-	1, // [1:1] is the sub-list for extension type_name
-	1, // [1:1] is the sub-list for extension extendee
-	0, // [0:1] is the sub-list for field type_name
+	6, // 1: device.GetValuesRequest.features:type_name -> device.GetValuesFeature
+	8, // 2: device.GetValuesResponse.featureValues:type_name -> device.FeatureValueResponse
+	0, // 3: device.Device.GetValue:input_type -> device.GetValueRequest
+	5, // 4: device.Device.GetValues:input_type -> device.GetValuesRequest
+	2, // 5: device.Device.SetValues:input_type -> device.SetValuesRequest
+	1, // 6: device.Device.GetValue:output_type -> device.GetValueResponse
+	7, // 7: device.Device.GetValues:output_type -> device.GetValuesResponse
+	4, // 8: device.Device.SetValues:output_type -> device.SetValueResponse
+	6, // [6:9] is the sub-list for method output_type
+	3, // [3:6] is the sub-list for method input_type
+	3, // [3:3] is the sub-list for extension type_name
+	3, // [3:3] is the sub-list for extension extendee
+	0, // [0:3] is the sub-list for field type_name
 }
 
 func init() { file_api_grpc_device_device_proto_init() }
@@ -454,7 +743,7 @@ func file_api_grpc_device_device_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_api_grpc_device_device_proto_rawDesc), len(file_api_grpc_device_device_proto_rawDesc)),
 			NumEnums:      0,
-			NumMessages:   5,
+			NumMessages:   9,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
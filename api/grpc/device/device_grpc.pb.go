@@ -20,6 +20,7 @@ const _ = grpc.SupportPackageIsVersion9
 
 const (
 	Device_GetValue_FullMethodName  = "/device.Device/GetValue"
+	Device_GetValues_FullMethodName = "/device.Device/GetValues"
 	Device_SetValues_FullMethodName = "/device.Device/SetValues"
 )
 
@@ -28,6 +29,8 @@ const (
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type DeviceClient interface {
 	GetValue(ctx context.Context, in *GetValueRequest, opts ...grpc.CallOption) (*GetValueResponse, error)
+	// GetValues returns values of multiple controller features of a device in a single call
+	GetValues(ctx context.Context, in *GetValuesRequest, opts ...grpc.CallOption) (*GetValuesResponse, error)
 	SetValues(ctx context.Context, in *SetValuesRequest, opts ...grpc.CallOption) (*SetValueResponse, error)
 }
 
@@ -49,6 +52,16 @@ func (c *deviceClient) GetValue(ctx context.Context, in *GetValueRequest, opts .
 	return out, nil
 }
 
+func (c *deviceClient) GetValues(ctx context.Context, in *GetValuesRequest, opts ...grpc.CallOption) (*GetValuesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetValuesResponse)
+	err := c.cc.Invoke(ctx, Device_GetValues_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *deviceClient) SetValues(ctx context.Context, in *SetValuesRequest, opts ...grpc.CallOption) (*SetValueResponse, error) {
 	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
 	out := new(SetValueResponse)
@@ -64,6 +77,8 @@ func (c *deviceClient) SetValues(ctx context.Context, in *SetValuesRequest, opts
 // for forward compatibility.
 type DeviceServer interface {
 	GetValue(context.Context, *GetValueRequest) (*GetValueResponse, error)
+	// GetValues returns values of multiple controller features of a device in a single call
+	GetValues(context.Context, *GetValuesRequest) (*GetValuesResponse, error)
 	SetValues(context.Context, *SetValuesRequest) (*SetValueResponse, error)
 	mustEmbedUnimplementedDeviceServer()
 }
@@ -78,6 +93,9 @@ type UnimplementedDeviceServer struct{}
 func (UnimplementedDeviceServer) GetValue(context.Context, *GetValueRequest) (*GetValueResponse, error) {
 	return nil, status.Error(codes.Unimplemented, "method GetValue not implemented")
 }
+func (UnimplementedDeviceServer) GetValues(context.Context, *GetValuesRequest) (*GetValuesResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method GetValues not implemented")
+}
 func (UnimplementedDeviceServer) SetValues(context.Context, *SetValuesRequest) (*SetValueResponse, error) {
 	return nil, status.Error(codes.Unimplemented, "method SetValues not implemented")
 }
@@ -120,6 +138,24 @@ func _Device_GetValue_Handler(srv interface{}, ctx context.Context, dec func(int
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Device_GetValues_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetValuesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DeviceServer).GetValues(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Device_GetValues_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DeviceServer).GetValues(ctx, req.(*GetValuesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _Device_SetValues_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(SetValuesRequest)
 	if err := dec(in); err != nil {
@@ -149,6 +185,10 @@ var Device_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "GetValue",
 			Handler:    _Device_GetValue_Handler,
 		},
+		{
+			MethodName: "GetValues",
+			Handler:    _Device_GetValues_Handler,
+		},
 		{
 			MethodName: "SetValues",
 			Handler:    _Device_SetValues_Handler,
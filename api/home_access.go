@@ -0,0 +1,127 @@
+package api
+
+import (
+	"api-server/models"
+	"api-server/utils"
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+var (
+	errHomeNotMember        = errors.New("profile is not a member of this home")
+	errHomeNotFound         = errors.New("home listed in profile not found")
+	errDeviceNotAccessible  = errors.New("device is not accessible by this profile")
+	errDeviceOwnerNotFound  = errors.New("device owner not found")
+	errInsufficientHomeRole = errors.New("insufficient home role")
+)
+
+// getHomeWithRole loads the home with homeID and the role that profile has on it.
+// It returns errHomeNotMember when the profile cannot access that home at all
+// and errHomeNotFound when the home is listed in the profile, but it doesn't exist anymore.
+func getHomeWithRole(ctx context.Context, collHomes *mongo.Collection, profile *models.Profile, homeID bson.ObjectID) (models.Home, models.HomeRole, error) {
+	var home models.Home
+	err := collHomes.FindOne(ctx, bson.M{"_id": homeID}).Decode(&home)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			if utils.Contains(profile.Homes, homeID) {
+				return models.Home{}, "", errHomeNotFound
+			}
+			return models.Home{}, "", errHomeNotMember
+		}
+		return models.Home{}, "", err
+	}
+	role, found := utils.GetHomeRole(&home, profile.ID, profile.Homes)
+	if !found {
+		return models.Home{}, "", errHomeNotMember
+	}
+	return home, role, nil
+}
+
+// findProfileHomes returns all homes that profile can access, either because
+// they are listed in its profile or because it is one of their members.
+func findProfileHomes(ctx context.Context, collHomes *mongo.Collection, profile *models.Profile) ([]models.Home, error) {
+	homeIDs := profile.Homes
+	if homeIDs == nil {
+		homeIDs = []bson.ObjectID{}
+	}
+	cur, err := collHomes.Find(ctx, bson.M{
+		"$or": bson.A{
+			bson.M{"_id": bson.M{"$in": homeIDs}},
+			bson.M{"members.profileId": profile.ID},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	homes := make([]models.Home, 0)
+	if err = cur.All(ctx, &homes); err != nil {
+		return nil, err
+	}
+	return homes, nil
+}
+
+// resolveDeviceAccess checks that profile can use deviceID with at least the required home role
+// and returns the profile that owns the device. Device owners can always use their devices,
+// other profiles only through a shared home where that device is assigned to a room.
+// The owner is required because device services authenticate with the owner's apiToken.
+func resolveDeviceAccess(ctx context.Context, collProfiles, collHomes *mongo.Collection, profile *models.Profile, deviceID bson.ObjectID, required models.HomeRole) (models.Profile, error) {
+	if utils.Contains(profile.Devices, deviceID) {
+		return *profile, nil
+	}
+
+	cur, err := collHomes.Find(ctx, bson.M{"rooms.devices": deviceID})
+	if err != nil {
+		return models.Profile{}, err
+	}
+	defer cur.Close(ctx)
+
+	var homes []models.Home
+	if err = cur.All(ctx, &homes); err != nil {
+		return models.Profile{}, err
+	}
+
+	var isMember bool
+	var hasRole bool
+	for i := range homes {
+		role, found := utils.GetHomeRole(&homes[i], profile.ID, profile.Homes)
+		if !found {
+			continue
+		}
+		isMember = true
+		if utils.HasHomeRole(role, required) {
+			hasRole = true
+			break
+		}
+	}
+	if !isMember {
+		return models.Profile{}, errDeviceNotAccessible
+	}
+	if !hasRole {
+		return models.Profile{}, errInsufficientHomeRole
+	}
+
+	var owner models.Profile
+	err = collProfiles.FindOne(ctx, bson.M{"devices": deviceID}).Decode(&owner)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return models.Profile{}, errDeviceOwnerNotFound
+		}
+		return models.Profile{}, err
+	}
+	return owner, nil
+}
+
+// isDeviceInHome returns true if deviceID is assigned to a room of home.
+func isDeviceInHome(home *models.Home, deviceID bson.ObjectID) bool {
+	for _, room := range home.Rooms {
+		if utils.Contains(room.Devices, deviceID) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,574 @@
+package api
+
+import (
+	"api-server/db"
+	"api-server/models"
+	"api-server/utils"
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"go.mongodb.org/mongo-driver/v2/mongo/writeconcern"
+	"go.uber.org/zap"
+)
+
+const homeInvitationTTL = 7 * 24 * time.Hour
+
+var errInvitationNotValid = errors.New("invitation is invalid, expired or already used")
+
+// HomeInvitationNewReq is the request body for inviting someone to a home.
+type HomeInvitationNewReq struct {
+	Role models.HomeRole `json:"role" validate:"required,oneof=admin member guest"`
+	// optional, when set only a profile with this email can accept the invitation
+	Email string `json:"email" validate:"omitempty,email,max=254"`
+}
+
+// HomeInvitationAcceptReq is the request body for accepting a home invitation.
+type HomeInvitationAcceptReq struct {
+	Code string `json:"code" validate:"required,max=128"`
+}
+
+// HomeInvitationResp is returned once, when an invitation is created, because it contains the raw code.
+type HomeInvitationResp struct {
+	ID        bson.ObjectID   `json:"id"`
+	Code      string          `json:"code"`
+	Role      models.HomeRole `json:"role"`
+	Email     string          `json:"email,omitempty"`
+	ExpiresAt time.Time       `json:"expiresAt"`
+}
+
+// HomeMemberResp is a member of a home with its public GitHub data.
+type HomeMemberResp struct {
+	ProfileID bson.ObjectID   `json:"profileId"`
+	Role      models.HomeRole `json:"role"`
+	Login     string          `json:"login"`
+	Name      string          `json:"name"`
+	AvatarURL string          `json:"avatarURL"`
+	AddedAt   time.Time       `json:"addedAt"`
+}
+
+// HomeMembersResp is the response body listing members and pending invitations of a home.
+type HomeMembersResp struct {
+	Members     []HomeMemberResp        `json:"members"`
+	Invitations []models.HomeInvitation `json:"invitations"`
+}
+
+// HomeMembers handles members, roles and invitations of shared homes.
+type HomeMembers struct {
+	client          *mongo.Client
+	collProfiles    *mongo.Collection
+	collHomes       *mongo.Collection
+	collInvitations *mongo.Collection
+	events          *EventsHub
+	logger          *zap.SugaredLogger
+	validate        *validator.Validate
+}
+
+// NewHomeMembers constructs a HomeMembers handler with the given dependencies.
+func NewHomeMembers(logger *zap.SugaredLogger, client *mongo.Client, validate *validator.Validate, events *EventsHub) *HomeMembers {
+	return &HomeMembers{
+		client:          client,
+		collProfiles:    db.GetCollections(client).Profiles,
+		collHomes:       db.GetCollections(client).Homes,
+		collInvitations: db.GetCollections(client).HomeInvitations,
+		events:          events,
+		logger:          logger,
+		validate:        validate,
+	}
+}
+
+// GetMembers returns members and pending invitations of a home. Every member can read them.
+func (hm *HomeMembers) GetMembers(c *gin.Context) {
+	hm.logger.Info("REST - GET - GetMembers called")
+
+	homeID, errID := bson.ObjectIDFromHex(c.Param("id"))
+	if errID != nil {
+		hm.logger.Error("REST - GET - GetMembers - wrong format of the path param 'id'")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "wrong format of the path param 'id'"})
+		return
+	}
+
+	profile, err := utils.GetLoggedProfileFromContext(c, hm.collProfiles)
+	if err != nil {
+		hm.logger.Error("REST - GET - GetMembers - cannot find profile")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "cannot find profile"})
+		return
+	}
+
+	home, role, err := getHomeWithRole(c.Request.Context(), hm.collHomes, &profile, homeID)
+	if err != nil {
+		hm.logger.Errorf("REST - GET - GetMembers - cannot access home, err = %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cannot get members of an home that is not in your profile"})
+		return
+	}
+
+	members := home.Members
+	if len(members) == 0 {
+		// legacy home never shared: its only member is the owner
+		members = []models.HomeMember{{ProfileID: profile.ID, Role: role, AddedAt: home.CreatedAt}}
+	}
+	membersResp, err := hm.buildMembersResp(c.Request.Context(), members)
+	if err != nil {
+		hm.logger.Errorf("REST - GET - GetMembers - cannot load member profiles, err = %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot get members"})
+		return
+	}
+
+	invitations := make([]models.HomeInvitation, 0)
+	if utils.HasHomeRole(role, models.HomeRoleAdmin) {
+		cur, errFind := hm.collInvitations.Find(c.Request.Context(), bson.M{
+			"homeId":     homeID,
+			"acceptedAt": bson.M{"$exists": false},
+			"revokedAt":  bson.M{"$exists": false},
+			"expiresAt":  bson.M{"$gt": time.Now().UTC()},
+		})
+		if errFind != nil {
+			hm.logger.Errorf("REST - GET - GetMembers - cannot find invitations, err = %v", errFind)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot get members"})
+			return
+		}
+		defer cur.Close(c.Request.Context())
+		if errFind = cur.All(c.Request.Context(), &invitations); errFind != nil {
+			hm.logger.Errorf("REST - GET - GetMembers - cannot decode invitations, err = %v", errFind)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot get members"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, HomeMembersResp{
+		Members:     membersResp,
+		Invitations: invitations,
+	})
+}
+
+// PostInvitation creates a single-use invitation code to join a home with a role.
+func (hm *HomeMembers) PostInvitation(c *gin.Context) {
+	hm.logger.Info("REST - POST - PostInvitation called")
+
+	homeID, errID := bson.ObjectIDFromHex(c.Param("id"))
+	if errID != nil {
+		hm.logger.Error("REST - POST - PostInvitation - wrong format of the path param 'id'")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "wrong format of the path param 'id'"})
+		return
+	}
+
+	var invitationReq HomeInvitationNewReq
+	if err := c.ShouldBindJSON(&invitationReq); err != nil {
+		hm.logger.Error("REST - POST - PostInvitation - Cannot bind request body", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request payload"})
+		return
+	}
+	if err := hm.validate.Struct(invitationReq); err != nil {
+		hm.logger.Errorf("REST - POST - PostInvitation - request body is not valid, err %#v", err)
+		var errFields = utils.GetErrorMessage(err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body, these fields are not valid:" + errFields})
+		return
+	}
+
+	profile, err := utils.GetLoggedProfileFromContext(c, hm.collProfiles)
+	if err != nil {
+		hm.logger.Error("REST - POST - PostInvitation - cannot find profile")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "cannot find profile"})
+		return
+	}
+
+	home, role, err := getHomeWithRole(c.Request.Context(), hm.collHomes, &profile, homeID)
+	if err != nil {
+		hm.logger.Errorf("REST - POST - PostInvitation - cannot access home, err = %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cannot invite to an home that is not in your profile"})
+		return
+	}
+	if !utils.CanGrantHomeRole(role, invitationReq.Role) {
+		hm.logger.Errorf("REST - POST - PostInvitation - role '%s' cannot invite with role '%s'", role, invitationReq.Role)
+		c.JSON(http.StatusForbidden, gin.H{"error": "you don't have permission to invite with this role"})
+		return
+	}
+
+	code, err := utils.RandomString(32)
+	if err != nil {
+		hm.logger.Errorf("REST - POST - PostInvitation - cannot create invitation code, err = %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot create invitation"})
+		return
+	}
+
+	now := time.Now().UTC()
+	invitation := models.HomeInvitation{
+		ID:        bson.NewObjectID(),
+		HomeID:    homeID,
+		CodeHash:  utils.HashToken(code),
+		Role:      invitationReq.Role,
+		Email:     strings.ToLower(strings.TrimSpace(invitationReq.Email)),
+		InvitedBy: profile.ID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(homeInvitationTTL),
+	}
+
+	// homes created before members were introduced get their owner materialized
+	// the first time they are shared, so that every member is listed in the home document.
+	if len(home.Members) == 0 {
+		_, err = hm.collHomes.UpdateOne(c.Request.Context(), bson.M{
+			"_id":     homeID,
+			"members": bson.M{"$exists": false},
+		}, bson.M{
+			"$set": bson.M{
+				"members": []models.HomeMember{{
+					ProfileID: profile.ID,
+					Role:      models.HomeRoleOwner,
+					AddedAt:   home.CreatedAt,
+				}},
+			},
+		})
+		if err != nil {
+			hm.logger.Errorf("REST - POST - PostInvitation - cannot initialize home members, err = %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot create invitation"})
+			return
+		}
+	}
+
+	if _, err = hm.collInvitations.InsertOne(c.Request.Context(), invitation); err != nil {
+		hm.logger.Errorf("REST - POST - PostInvitation - cannot insert invitation, err = %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot create invitation"})
+		return
+	}
+
+	hm.logger.Infow("AUDIT - home invitation created",
+		"profileID", profile.ID.Hex(),
+		"homeID", homeID.Hex(),
+		"invitationID", invitation.ID.Hex(),
+		"role", invitation.Role,
+	)
+	c.JSON(http.StatusOK, HomeInvitationResp{
+		ID:        invitation.ID,
+		Code:      code,
+		Role:      invitation.Role,
+		Email:     invitation.Email,
+		ExpiresAt: invitation.ExpiresAt,
+	})
+}
+
+// DeleteInvitation revokes a pending invitation.
+func (hm *HomeMembers) DeleteInvitation(c *gin.Context) {
+	hm.logger.Info("REST - DELETE - DeleteInvitation called")
+
+	homeID, errID := bson.ObjectIDFromHex(c.Param("id"))
+	invitationID, errIid := bson.ObjectIDFromHex(c.Param("iid"))
+	if errID != nil || errIid != nil {
+		hm.logger.Error("REST - DELETE - DeleteInvitation - wrong format of one of the path params")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "wrong format of one of the path params"})
+		return
+	}
+
+	profile, err := utils.GetLoggedProfileFromContext(c, hm.collProfiles)
+	if err != nil {
+		hm.logger.Error("REST - DELETE - DeleteInvitation - cannot find profile")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "cannot find profile"})
+		return
+	}
+
+	_, role, err := getHomeWithRole(c.Request.Context(), hm.collHomes, &profile, homeID)
+	if err != nil {
+		hm.logger.Errorf("REST - DELETE - DeleteInvitation - cannot access home, err = %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cannot revoke invitations of an home that is not in your profile"})
+		return
+	}
+	if !utils.HasHomeRole(role, models.HomeRoleAdmin) {
+		hm.logger.Errorf("REST - DELETE - DeleteInvitation - role '%s' cannot revoke invitations", role)
+		c.JSON(http.StatusForbidden, gin.H{"error": "you don't have permission to revoke invitations of this home"})
+		return
+	}
+
+	result, err := hm.collInvitations.UpdateOne(c.Request.Context(), bson.M{
+		"_id":        invitationID,
+		"homeId":     homeID,
+		"acceptedAt": bson.M{"$exists": false},
+		"revokedAt":  bson.M{"$exists": false},
+	}, bson.M{
+		"$set": bson.M{"revokedAt": time.Now().UTC()},
+	})
+	if err != nil {
+		hm.logger.Errorf("REST - DELETE - DeleteInvitation - cannot revoke invitation, err = %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot revoke invitation"})
+		return
+	}
+	if result.MatchedCount == 0 {
+		hm.logger.Errorf("REST - DELETE - DeleteInvitation - cannot find pending invitation with id: %v", invitationID)
+		c.JSON(http.StatusNotFound, gin.H{"error": "invitation not found"})
+		return
+	}
+
+	hm.logger.Infow("AUDIT - home invitation revoked",
+		"profileID", profile.ID.Hex(),
+		"homeID", homeID.Hex(),
+		"invitationID", invitationID.Hex(),
+	)
+	c.JSON(http.StatusOK, gin.H{"message": "invitation has been revoked"})
+}
+
+// PostAcceptInvitation adds the logged profile to a home redeeming an invitation code.
+func (hm *HomeMembers) PostAcceptInvitation(c *gin.Context) {
+	hm.logger.Info("REST - POST - PostAcceptInvitation called")
+
+	homeID, errID := bson.ObjectIDFromHex(c.Param("id"))
+	if errID != nil {
+		hm.logger.Error("REST - POST - PostAcceptInvitation - wrong format of the path param 'id'")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "wrong format of the path param 'id'"})
+		return
+	}
+
+	var acceptReq HomeInvitationAcceptReq
+	if err := c.ShouldBindJSON(&acceptReq); err != nil {
+		hm.logger.Error("REST - POST - PostAcceptInvitation - Cannot bind request body", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request payload"})
+		return
+	}
+	if err := hm.validate.Struct(acceptReq); err != nil {
+		hm.logger.Errorf("REST - POST - PostAcceptInvitation - request body is not valid, err %#v", err)
+		var errFields = utils.GetErrorMessage(err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body, these fields are not valid:" + errFields})
+		return
+	}
+
+	profile, err := utils.GetLoggedProfileFromContext(c, hm.collProfiles)
+	if err != nil {
+		hm.logger.Error("REST - POST - PostAcceptInvitation - cannot find profile")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "cannot find profile"})
+		return
+	}
+
+	if _, _, err = getHomeWithRole(c.Request.Context(), hm.collHomes, &profile, homeID); err == nil {
+		hm.logger.Error("REST - POST - PostAcceptInvitation - profile is already a member of this home")
+		c.JSON(http.StatusConflict, gin.H{"error": "you are already a member of this home"})
+		return
+	} else if !errors.Is(err, errHomeNotMember) {
+		hm.logger.Errorf("REST - POST - PostAcceptInvitation - cannot read home, err = %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot accept invitation"})
+		return
+	}
+
+	dbSession, err := hm.client.StartSession()
+	if err != nil {
+		hm.logger.Errorf("REST - POST - PostAcceptInvitation - cannot start a db session, err = %#v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot accept invitation"})
+		return
+	}
+	// Defers ending the session after the transaction is committed or ended
+	defer dbSession.EndSession(context.Background())
+
+	codeHash := utils.HashToken(strings.TrimSpace(acceptReq.Code))
+	var invitation models.HomeInvitation
+	_, errTrans := dbSession.WithTransaction(c.Request.Context(), func(sessionCtx context.Context) (interface{}, error) {
+		// Official `mongo-driver` documentation state: "callback may be run
+		// multiple times during WithTransaction due to retry attempts, so it must be idempotent."
+		now := time.Now().UTC()
+		errFind := hm.collInvitations.FindOneAndUpdate(sessionCtx, bson.M{
+			"homeId":     homeID,
+			"codeHash":   codeHash,
+			"acceptedAt": bson.M{"$exists": false},
+			"revokedAt":  bson.M{"$exists": false},
+			"expiresAt":  bson.M{"$gt": now},
+		}, bson.M{
+			"$set": bson.M{
+				"acceptedAt": now,
+				"acceptedBy": profile.ID,
+			},
+		}).Decode(&invitation)
+		if errFind != nil {
+			if errors.Is(errFind, mongo.ErrNoDocuments) {
+				return nil, errInvitationNotValid
+			}
+			return nil, errFind
+		}
+		if invitation.Email != "" && !profile.HasVerifiedEmail(invitation.Email) {
+			return nil, errInvitationNotValid
+		}
+
+		if _, errUpd := hm.collHomes.UpdateOne(sessionCtx, bson.M{
+			"_id":               homeID,
+			"members.profileId": bson.M{"$ne": profile.ID},
+		}, bson.M{
+			"$push": bson.M{
+				"members": models.HomeMember{
+					ProfileID: profile.ID,
+					Role:      invitation.Role,
+					AddedAt:   now,
+				},
+			},
+			"$set": bson.M{"modifiedAt": now},
+		}); errUpd != nil {
+			return nil, errUpd
+		}
+		_, errUpd := hm.collProfiles.UpdateOne(sessionCtx,
+			bson.M{"_id": profile.ID},
+			bson.M{"$addToSet": bson.M{"homes": homeID}},
+		)
+		return nil, errUpd
+	}, options.Transaction().SetWriteConcern(writeconcern.Majority()))
+	if errTrans != nil {
+		if errors.Is(errTrans, errInvitationNotValid) {
+			hm.logger.Error("REST - POST - PostAcceptInvitation - invitation is not valid")
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid or expired invitation"})
+			return
+		}
+		hm.logger.Errorf("REST - POST - PostAcceptInvitation - cannot accept invitation in transaction, errTrans = %#v", errTrans)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot accept invitation"})
+		return
+	}
+
+	hm.logger.Infow("AUDIT - home invitation accepted",
+		"profileID", profile.ID.Hex(),
+		"homeID", homeID.Hex(),
+		"invitationID", invitation.ID.Hex(),
+		"role", invitation.Role,
+	)
+	hm.events.publish(models.Event{Type: models.EventHomeMembersUpdated, HomeID: &homeID}, hm.events.homeAudience(c.Request.Context(), homeID))
+	c.JSON(http.StatusOK, gin.H{"message": "invitation has been accepted"})
+}
+
+// DeleteMember removes a member from a home. Members can always leave a home,
+// except the owner. Admins can remove members with a lower role.
+func (hm *HomeMembers) DeleteMember(c *gin.Context) {
+	hm.logger.Info("REST - DELETE - DeleteMember called")
+
+	homeID, errID := bson.ObjectIDFromHex(c.Param("id"))
+	memberID, errPid := bson.ObjectIDFromHex(c.Param("pid"))
+	if errID != nil || errPid != nil {
+		hm.logger.Error("REST - DELETE - DeleteMember - wrong format of one of the path params")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "wrong format of one of the path params"})
+		return
+	}
+
+	profile, err := utils.GetLoggedProfileFromContext(c, hm.collProfiles)
+	if err != nil {
+		hm.logger.Error("REST - DELETE - DeleteMember - cannot find profile")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "cannot find profile"})
+		return
+	}
+
+	home, role, err := getHomeWithRole(c.Request.Context(), hm.collHomes, &profile, homeID)
+	if err != nil {
+		hm.logger.Errorf("REST - DELETE - DeleteMember - cannot access home, err = %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cannot remove members of an home that is not in your profile"})
+		return
+	}
+
+	var memberRole models.HomeRole
+	for _, member := range home.Members {
+		if member.ProfileID == memberID {
+			memberRole = member.Role
+		}
+	}
+	if memberRole == "" {
+		hm.logger.Errorf("REST - DELETE - DeleteMember - cannot find member with id: %v", memberID)
+		c.JSON(http.StatusNotFound, gin.H{"error": "member not found"})
+		return
+	}
+	if memberRole == models.HomeRoleOwner {
+		hm.logger.Error("REST - DELETE - DeleteMember - the owner cannot be removed from a home")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "the owner cannot be removed from a home"})
+		return
+	}
+	if memberID != profile.ID && !utils.CanGrantHomeRole(role, memberRole) {
+		hm.logger.Errorf("REST - DELETE - DeleteMember - role '%s' cannot remove a member with role '%s'", role, memberRole)
+		c.JSON(http.StatusForbidden, gin.H{"error": "you don't have permission to remove this member"})
+		return
+	}
+
+	var member models.Profile
+	err = hm.collProfiles.FindOne(c.Request.Context(), bson.M{"_id": memberID}).Decode(&member)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		hm.logger.Errorf("REST - DELETE - DeleteMember - cannot find member profile, err = %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot remove member"})
+		return
+	}
+	memberDevices := member.Devices
+	if memberDevices == nil {
+		memberDevices = []bson.ObjectID{}
+	}
+
+	dbSession, err := hm.client.StartSession()
+	if err != nil {
+		hm.logger.Errorf("REST - DELETE - DeleteMember - cannot start a db session, err = %#v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot remove member"})
+		return
+	}
+	// Defers ending the session after the transaction is committed or ended
+	defer dbSession.EndSession(context.Background())
+
+	_, errTrans := dbSession.WithTransaction(c.Request.Context(), func(sessionCtx context.Context) (interface{}, error) {
+		// Official `mongo-driver` documentation state: "callback may be run
+		// multiple times during WithTransaction due to retry attempts, so it must be idempotent."
+
+		// remove the member and take its devices out of the rooms of this home
+		if _, errUpd := hm.collHomes.UpdateOne(sessionCtx, bson.M{
+			"_id": homeID,
+		}, bson.M{
+			"$pull": bson.M{
+				"members":           bson.M{"profileId": memberID},
+				"rooms.$[].devices": bson.M{"$in": memberDevices},
+			},
+			"$set": bson.M{"modifiedAt": time.Now()},
+		}); errUpd != nil {
+			return nil, errUpd
+		}
+		_, errUpd := hm.collProfiles.UpdateOne(sessionCtx,
+			bson.M{"_id": memberID},
+			bson.M{"$pull": bson.M{"homes": homeID}},
+		)
+		return nil, errUpd
+	}, options.Transaction().SetWriteConcern(writeconcern.Majority()))
+	if errTrans != nil {
+		hm.logger.Errorf("REST - DELETE - DeleteMember - cannot remove member in transaction, errTrans = %#v", errTrans)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot remove member"})
+		return
+	}
+
+	hm.logger.Infow("AUDIT - home member removed",
+		"profileID", profile.ID.Hex(),
+		"homeID", homeID.Hex(),
+		"memberID", memberID.Hex(),
+	)
+	// the removed member is not in the audience anymore
+	hm.events.publish(models.Event{Type: models.EventHomeMembersUpdated, HomeID: &homeID}, hm.events.homeAudience(c.Request.Context(), homeID), []bson.ObjectID{memberID})
+	c.JSON(http.StatusOK, gin.H{"message": "member has been removed"})
+}
+
+func (hm *HomeMembers) buildMembersResp(ctx context.Context, members []models.HomeMember) ([]HomeMemberResp, error) {
+	profileIDs := utils.MapSlice(members, func(member models.HomeMember) bson.ObjectID {
+		return member.ProfileID
+	})
+	cur, err := hm.collProfiles.Find(ctx, bson.M{"_id": bson.M{"$in": profileIDs}})
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var profiles []models.Profile
+	if err = cur.All(ctx, &profiles); err != nil {
+		return nil, err
+	}
+	profilesByID := make(map[bson.ObjectID]models.Profile, len(profiles))
+	for _, p := range profiles {
+		profilesByID[p.ID] = p
+	}
+
+	membersResp := make([]HomeMemberResp, 0, len(members))
+	for _, member := range members {
+		identity := profilesByID[member.ProfileID].MainIdentity()
+		membersResp = append(membersResp, HomeMemberResp{
+			ProfileID: member.ProfileID,
+			Role:      member.Role,
+			Login:     identity.Login,
+			Name:      identity.Name,
+			AvatarURL: identity.AvatarURL,
+			AddedAt:   member.AddedAt,
+		})
+	}
+	return membersResp, nil
+}
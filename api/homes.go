@@ -5,6 +5,7 @@ import (
 	"api-server/models"
 	"api-server/utils"
 	"context"
+	"errors"
 	"net/http"
 	"time"
 
@@ -21,6 +22,7 @@ import (
 type HomeNewReq struct {
 	Name     string       `json:"name" validate:"required,min=1,max=50"`
 	Location string       `json:"location" validate:"required,min=1,max=50"`
+	Timezone string       `json:"timezone" validate:"omitempty,timezone"`
 	Rooms    []RoomNewReq `json:"rooms" validate:"required,dive"`
 }
 
@@ -28,6 +30,8 @@ type HomeNewReq struct {
 type HomeUpdateReq struct {
 	Name     string `json:"name" validate:"required,min=1,max=50"`
 	Location string `json:"location" validate:"required,min=1,max=50"`
+	// IANA timezone, like "Europe/Rome". When empty, the current one is kept
+	Timezone string `json:"timezone" validate:"omitempty,timezone"`
 }
 
 // RoomNewReq is the request body for creating a new room.
@@ -46,21 +50,33 @@ type RoomUpdateReq struct {
 
 // Homes handles CRUD operations for homes and rooms.
 type Homes struct {
-	client       *mongo.Client
-	collProfiles *mongo.Collection
-	collHomes    *mongo.Collection
-	logger       *zap.SugaredLogger
-	validate     *validator.Validate
+	client          *mongo.Client
+	collProfiles    *mongo.Collection
+	collHomes       *mongo.Collection
+	collDevices     *mongo.Collection
+	collInvitations *mongo.Collection
+	collScenes      *mongo.Collection
+	collSchedules   *mongo.Collection
+	collRules       *mongo.Collection
+	events          *EventsHub
+	logger          *zap.SugaredLogger
+	validate        *validator.Validate
 }
 
 // NewHomes constructs a Homes handler with the given dependencies.
-func NewHomes(logger *zap.SugaredLogger, client *mongo.Client, validate *validator.Validate) *Homes {
+func NewHomes(logger *zap.SugaredLogger, client *mongo.Client, validate *validator.Validate, events *EventsHub) *Homes {
 	return &Homes{
-		client:       client,
-		collProfiles: db.GetCollections(client).Profiles,
-		collHomes:    db.GetCollections(client).Homes,
-		logger:       logger,
-		validate:     validate,
+		client:          client,
+		collProfiles:    db.GetCollections(client).Profiles,
+		collHomes:       db.GetCollections(client).Homes,
+		collDevices:     db.GetCollections(client).Devices,
+		collInvitations: db.GetCollections(client).HomeInvitations,
+		collScenes:      db.GetCollections(client).Scenes,
+		collSchedules:   db.GetCollections(client).Schedules,
+		collRules:       db.GetCollections(client).Rules,
+		events:          events,
+		logger:          logger,
+		validate:        validate,
 	}
 }
 
@@ -87,26 +103,13 @@ func (h *Homes) GetHomes(c *gin.Context) {
 		return
 	}
 
-	// extract Homes of that profile from db
-	cur, err := h.collHomes.Find(c.Request.Context(), bson.M{
-		"_id": bson.M{"$in": profile.Homes},
-	})
+	// extract Homes of that profile from db, both owned and shared with it
+	homes, err := findProfileHomes(c.Request.Context(), h.collHomes, &profile)
 	if err != nil {
 		h.logger.Error("REST - GET - GetHomes - Cannot get homes of profile in session", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot get your homes"})
 		return
 	}
-	defer cur.Close(c.Request.Context())
-
-	homes := make([]models.Home, 0)
-	for cur.Next(c.Request.Context()) {
-		var home models.Home
-		if err := cur.Decode(&home); err != nil {
-			h.logger.Errorf("REST - GET - GetHomes - cannot decode home, err = %v", err)
-			continue
-		}
-		homes = append(homes, home)
-	}
 
 	c.JSON(http.StatusOK, homes)
 }
@@ -145,8 +148,14 @@ func (h *Homes) PostHome(c *gin.Context) {
 	home.ID = bson.NewObjectID()
 	home.Name = newHome.Name
 	home.Location = newHome.Location
+	home.Timezone = newHome.Timezone
 	home.CreatedAt = newDate
 	home.ModifiedAt = newDate
+	home.Members = []models.HomeMember{{
+		ProfileID: profileSession.ID,
+		Role:      models.HomeRoleOwner,
+		AddedAt:   newDate,
+	}}
 	home.Rooms = []models.Room{}
 	for _, r := range newHome.Rooms {
 		home.Rooms = append(home.Rooms, models.Room{
@@ -196,6 +205,7 @@ func (h *Homes) PostHome(c *gin.Context) {
 		"profileID", profileSession.ID.Hex(),
 		"homeID", home.ID.Hex(),
 	)
+	h.events.publish(models.Event{Type: models.EventHomeCreated, HomeID: &home.ID}, []bson.ObjectID{profileSession.ID})
 	c.JSON(http.StatusOK, home)
 }
 
@@ -225,29 +235,75 @@ func (h *Homes) PutHome(c *gin.Context) {
 		return
 	}
 
-	// you can update a home only if you are the owner of that home
-	isOwned := h.isHomeOwnedBy(c, objectID)
-	if !isOwned {
-		h.logger.Error("REST - PUT - PutHome - Request payload cannot contain Rooms. This API is made to change only the home object.")
+	// you can update a home only if you are at least an admin of that home
+	role, errRole := h.getHomeRole(c, objectID)
+	if errors.Is(errRole, errHomeNotFound) {
+		h.logger.Error("REST - PUT - PutHome - Cannot find home")
+		c.JSON(http.StatusNotFound, gin.H{"error": "cannot find home"})
+		return
+	}
+	if errRole != nil {
+		h.logger.Error("REST - PUT - PutHome - Cannot update a home that is not in your profile")
 		c.JSON(http.StatusBadRequest, gin.H{"error": "cannot update a home that is not in your profile"})
 		return
 	}
+	if !utils.HasHomeRole(role, models.HomeRoleAdmin) {
+		h.logger.Errorf("REST - PUT - PutHome - role '%s' cannot update this home", role)
+		c.JSON(http.StatusForbidden, gin.H{"error": "you don't have permission to update this home"})
+		return
+	}
 
-	_, errUpd := h.collHomes.UpdateOne(c.Request.Context(), bson.M{
-		"_id": objectID,
-	}, bson.M{
-		"$set": bson.M{
-			"name":       home.Name,
-			"location":   home.Location,
-			"modifiedAt": time.Now(),
-		},
-	})
-	if errUpd != nil {
-		h.logger.Error("REST - PUT - PutHome - Cannot update home in DB.")
+	set := bson.M{
+		"name":       home.Name,
+		"location":   home.Location,
+		"modifiedAt": time.Now(),
+	}
+	if home.Timezone != "" {
+		set["timezone"] = home.Timezone
+	}
+	// start-session
+	dbSession, err := h.client.StartSession()
+	if err != nil {
+		h.logger.Errorf("REST - PUT - PutHome - cannot start a db session, err = %#v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "unknown error while trying to update an home"})
+		return
+	}
+	// Defers ending the session after the transaction is committed or ended
+	defer dbSession.EndSession(context.Background())
+
+	_, errTrans := dbSession.WithTransaction(c.Request.Context(), func(sessionCtx context.Context) (interface{}, error) {
+		// Official `mongo-driver` documentation state: "callback may be run
+		// multiple times during WithTransaction due to retry attempts, so it must be idempotent."
+		var previousHome models.Home
+		errUpd := h.collHomes.FindOneAndUpdate(sessionCtx, bson.M{
+			"_id": objectID,
+		}, bson.M{
+			"$set": set,
+		}).Decode(&previousHome)
+		if errors.Is(errUpd, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+		if errUpd != nil {
+			h.logger.Errorf("REST - PUT - PutHome - Cannot update home in DB, errUpd = %#v", errUpd)
+			return nil, errUpd
+		}
+		// schedules run in the timezone of the home, so their next run must be moved with it
+		if home.Timezone != "" && home.Timezone != previousHome.Timezone {
+			previousHome.Timezone = home.Timezone
+			if errSchedules := rescheduleHome(sessionCtx, h.collSchedules, &previousHome); errSchedules != nil {
+				h.logger.Errorf("REST - PUT - PutHome - Cannot update schedules to the new timezone, errSchedules = %v", errSchedules)
+				return nil, errSchedules
+			}
+		}
+		return nil, nil
+	}, options.Transaction().SetWriteConcern(writeconcern.Majority()))
+	if errTrans != nil {
+		h.logger.Errorf("REST - PUT - PutHome - Cannot update home and its schedules in transaction, errTrans = %#v", errTrans)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot update home in Db"})
 		return
 	}
 
+	h.events.publish(models.Event{Type: models.EventHomeUpdated, HomeID: &objectID}, h.events.homeAudience(c.Request.Context(), objectID))
 	c.JSON(http.StatusOK, gin.H{"message": "home has been updated"})
 }
 
@@ -262,28 +318,34 @@ func (h *Homes) DeleteHome(c *gin.Context) {
 		return
 	}
 
-	// you can update a home only if you are the owner of that home
-	isOwned := h.isHomeOwnedBy(c, objectID)
-
-	if !isOwned {
+	// you can delete a home only if you are the owner of that home
+	role, errRole := h.getHomeRole(c, objectID)
+	if errors.Is(errRole, errHomeNotFound) {
+		h.logger.Error("REST - DELETE - DeleteHome - Cannot find home")
+		c.JSON(http.StatusNotFound, gin.H{"error": "cannot find home"})
+		return
+	}
+	if errRole != nil {
 		h.logger.Error("REST - DELETE - DeleteHome - Cannot delete a home that is not in your profile")
 		c.JSON(http.StatusBadRequest, gin.H{"error": "cannot delete a home that is not in your profile"})
 		return
 	}
+	if role != models.HomeRoleOwner {
+		h.logger.Errorf("REST - DELETE - DeleteHome - role '%s' cannot delete this home", role)
+		c.JSON(http.StatusForbidden, gin.H{"error": "only the owner can delete this home"})
+		return
+	}
 
-	// retrieve current profile object from session
-	profile, err := utils.GetLoggedProfileFromContext(c, h.collProfiles)
+	// retrieve current profile identity from the authenticated context
+	profile, err := utils.GetProfileFromContext(c)
 	if err != nil {
 		h.logger.Error("REST - DELETE - DeleteHome - cannot find profile")
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "cannot find profile"})
 		return
 	}
-	var newHomes []bson.ObjectID
-	for _, homeID := range profile.Homes {
-		if homeID != objectID {
-			newHomes = append(newHomes, homeID)
-		}
-	}
+
+	// profiles lose access to the home with the transaction
+	audience := h.events.homeAudience(c.Request.Context(), objectID)
 
 	// start-session
 	dbSession, err := h.client.StartSession()
@@ -298,18 +360,51 @@ func (h *Homes) DeleteHome(c *gin.Context) {
 	_, errTrans := dbSession.WithTransaction(c.Request.Context(), func(sessionCtx context.Context) (interface{}, error) {
 		// Official `mongo-driver` documentation state: "callback may be run
 		// multiple times during WithTransaction due to retry attempts, so it must be idempotent."
-		_, errUpd := h.collProfiles.UpdateOne(sessionCtx, bson.M{
-			"_id": profile.ID,
+		// remove the home from the owner and from all profiles it was shared with
+		_, errUpd := h.collProfiles.UpdateMany(sessionCtx, bson.M{
+			"homes": objectID,
 		}, bson.M{
-			"$set": bson.M{
-				"homes": newHomes,
+			"$pull": bson.M{
+				"homes": objectID,
 			},
 		})
 		if errUpd != nil {
-			h.logger.Errorf("REST - DELETE - DeleteHome - Cannot remove home from profile in DB, errUpd = %#v", errUpd)
+			h.logger.Errorf("REST - DELETE - DeleteHome - Cannot remove home from profiles in DB, errUpd = %#v", errUpd)
 			return nil, errUpd
 		}
 
+		_, errInv := h.collInvitations.DeleteMany(sessionCtx, bson.M{
+			"homeId": objectID,
+		})
+		if errInv != nil {
+			h.logger.Errorf("REST - DELETE - DeleteHome - Cannot remove home invitations from DB, errInv = %#v", errInv)
+			return nil, errInv
+		}
+
+		_, errScenes := h.collScenes.DeleteMany(sessionCtx, bson.M{
+			"homeId": objectID,
+		})
+		if errScenes != nil {
+			h.logger.Errorf("REST - DELETE - DeleteHome - Cannot remove home scenes from DB, errScenes = %#v", errScenes)
+			return nil, errScenes
+		}
+
+		_, errSchedules := h.collSchedules.DeleteMany(sessionCtx, bson.M{
+			"homeId": objectID,
+		})
+		if errSchedules != nil {
+			h.logger.Errorf("REST - DELETE - DeleteHome - Cannot remove home schedules from DB, errSchedules = %#v", errSchedules)
+			return nil, errSchedules
+		}
+
+		_, errRules := h.collRules.DeleteMany(sessionCtx, bson.M{
+			"homeId": objectID,
+		})
+		if errRules != nil {
+			h.logger.Errorf("REST - DELETE - DeleteHome - Cannot remove home rules from DB, errRules = %#v", errRules)
+			return nil, errRules
+		}
+
 		_, errDel := h.collHomes.DeleteOne(sessionCtx, bson.M{
 			"_id": objectID,
 		})
@@ -327,6 +422,7 @@ func (h *Homes) DeleteHome(c *gin.Context) {
 		"profileID", profile.ID.Hex(),
 		"homeID", objectID.Hex(),
 	)
+	h.events.publish(models.Event{Type: models.EventHomeDeleted, HomeID: &objectID}, audience)
 	c.JSON(http.StatusOK, gin.H{"message": "home has been deleted"})
 }
 
@@ -341,11 +437,15 @@ func (h *Homes) GetRooms(c *gin.Context) {
 		return
 	}
 
-	// you can update a home only if you are the owner of that home
-	isOwned := h.isHomeOwnedBy(c, objectID)
-
-	if !isOwned {
-		h.logger.Error("REST - GET - GetRooms - Cannot get rooms, because you aren't the owner of that house")
+	// every member of a home, guests included, can read its rooms
+	_, errRole := h.getHomeRole(c, objectID)
+	if errors.Is(errRole, errHomeNotFound) {
+		h.logger.Error("REST - GET - GetRooms - Cannot find home")
+		c.JSON(http.StatusNotFound, gin.H{"error": "cannot find rooms for that home"})
+		return
+	}
+	if errRole != nil {
+		h.logger.Error("REST - GET - GetRooms - Cannot get rooms, because you aren't a member of that house")
 		c.JSON(http.StatusBadRequest, gin.H{"error": "cannot get rooms of an home that is not in your profile"})
 		return
 	}
@@ -388,14 +488,23 @@ func (h *Homes) PostRoom(c *gin.Context) {
 		return
 	}
 
-	// you can update a home only if you are the owner of that home
-	isOwned := h.isHomeOwnedBy(c, objectID)
-
-	if !isOwned {
+	// you can add rooms to a home only if you are at least an admin of that home
+	role, errRole := h.getHomeRole(c, objectID)
+	if errors.Is(errRole, errHomeNotFound) {
+		h.logger.Error("REST - POST - PostRoom - Cannot find home")
+		c.JSON(http.StatusNotFound, gin.H{"error": "cannot find home"})
+		return
+	}
+	if errRole != nil {
 		h.logger.Error("REST - POST - PostRoom - Cannot create a room in an home that is not in session profile")
 		c.JSON(http.StatusBadRequest, gin.H{"error": "cannot create a room in an home that is not in your profile"})
 		return
 	}
+	if !utils.HasHomeRole(role, models.HomeRoleAdmin) {
+		h.logger.Errorf("REST - POST - PostRoom - role '%s' cannot create rooms in this home", role)
+		c.JSON(http.StatusForbidden, gin.H{"error": "you don't have permission to create rooms in this home"})
+		return
+	}
 
 	var home models.Home
 	err = h.collHomes.FindOne(c.Request.Context(), bson.M{
@@ -434,6 +543,7 @@ func (h *Homes) PostRoom(c *gin.Context) {
 		return
 	}
 
+	h.events.publish(models.Event{Type: models.EventRoomCreated, HomeID: &objectID, RoomID: &room.ID, Data: room}, h.events.homeAudience(c.Request.Context(), objectID))
 	c.JSON(http.StatusOK, gin.H{"message": "room added to the home"})
 }
 
@@ -462,14 +572,23 @@ func (h *Homes) PutRoom(c *gin.Context) {
 		return
 	}
 
-	// you can update a home only if you are the owner of that home
-	isOwned := h.isHomeOwnedBy(c, homeID)
-
-	if !isOwned {
+	// you can update rooms of a home only if you are at least an admin of that home
+	role, errRole := h.getHomeRole(c, homeID)
+	if errors.Is(errRole, errHomeNotFound) {
+		h.logger.Error("REST - PUT - PutRoom - Cannot find home")
+		c.JSON(http.StatusNotFound, gin.H{"error": "cannot find rooms for that home"})
+		return
+	}
+	if errRole != nil {
 		h.logger.Error("REST - PUT - PutRoom - Cannot update a room in an home that is not in session profile")
 		c.JSON(http.StatusBadRequest, gin.H{"error": "cannot update a room in an home that is not in your profile"})
 		return
 	}
+	if !utils.HasHomeRole(role, models.HomeRoleAdmin) {
+		h.logger.Errorf("REST - PUT - PutRoom - role '%s' cannot update rooms in this home", role)
+		c.JSON(http.StatusForbidden, gin.H{"error": "you don't have permission to update rooms in this home"})
+		return
+	}
 
 	// get Home
 	var home models.Home
@@ -515,6 +634,7 @@ func (h *Homes) PutRoom(c *gin.Context) {
 		return
 	}
 
+	h.events.publish(models.Event{Type: models.EventRoomUpdated, HomeID: &homeID, RoomID: &roomID}, h.events.homeAudience(c.Request.Context(), homeID))
 	c.JSON(http.StatusOK, gin.H{"message": "room has been updated"})
 }
 
@@ -530,14 +650,23 @@ func (h *Homes) DeleteRoom(c *gin.Context) {
 		return
 	}
 
-	// you can update a home only if you are the owner of that home
-	isOwned := h.isHomeOwnedBy(c, objectID)
-
-	if !isOwned {
+	// you can delete rooms of a home only if you are at least an admin of that home
+	role, errRole := h.getHomeRole(c, objectID)
+	if errors.Is(errRole, errHomeNotFound) {
+		h.logger.Error("REST - DELETE - DeleteRoom - Cannot find home")
+		c.JSON(http.StatusNotFound, gin.H{"error": "home not found"})
+		return
+	}
+	if errRole != nil {
 		h.logger.Error("REST - DELETE - DeleteRoom - Cannot delete a room in an home that is not in session profile")
 		c.JSON(http.StatusBadRequest, gin.H{"error": "cannot delete a room in an home that is not in your profile"})
 		return
 	}
+	if !utils.HasHomeRole(role, models.HomeRoleAdmin) {
+		h.logger.Errorf("REST - DELETE - DeleteRoom - role '%s' cannot delete rooms in this home", role)
+		c.JSON(http.StatusForbidden, gin.H{"error": "you don't have permission to delete rooms in this home"})
+		return
+	}
 
 	var home models.Home
 	err := h.collHomes.FindOne(c.Request.Context(), bson.M{
@@ -576,23 +705,25 @@ func (h *Homes) DeleteRoom(c *gin.Context) {
 		return
 	}
 
+	h.events.publish(models.Event{Type: models.EventRoomDeleted, HomeID: &objectID, RoomID: &objectRid}, h.events.homeAudience(c.Request.Context(), objectID))
 	c.JSON(http.StatusOK, gin.H{"message": "room has been deleted"})
 }
 
-func (h *Homes) isHomeOwnedBy(c *gin.Context, objectID bson.ObjectID) bool {
-	// you can update a home only if you are the owner of that home
+// getHomeRole returns the role of the logged profile on the home with objectID.
+// It returns errHomeNotFound when the home is listed in the profile, but it doesn't exist anymore,
+// so handlers can answer 404 without granting any role.
+func (h *Homes) getHomeRole(c *gin.Context, objectID bson.ObjectID) (models.HomeRole, error) {
 	// read profile from db. This is required to get fresh data from db.
-
 	profile, err := utils.GetLoggedProfileFromContext(c, h.collProfiles)
 	if err != nil {
-		h.logger.Error("isHomeOwnedBy - cannot find profile")
-		return false
+		h.logger.Error("getHomeRole - cannot find profile")
+		return "", err
 	}
 
-	found := utils.Contains(profile.Homes, objectID)
-	if !found {
-		h.logger.Error("isHomeOwnedBy - cannot update a home that is not in your profile")
-		return false
+	_, role, err := getHomeWithRole(c.Request.Context(), h.collHomes, &profile, objectID)
+	if err != nil {
+		h.logger.Errorf("getHomeRole - profile cannot access home, err = %v", err)
+		return "", err
 	}
-	return true
+	return role, nil
 }
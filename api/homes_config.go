@@ -0,0 +1,302 @@
+package api
+
+import (
+	"api-server/models"
+	"api-server/utils"
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"go.mongodb.org/mongo-driver/v2/mongo/writeconcern"
+)
+
+// HomeConfigApplyRes is the result of applying a configuration to a home
+type HomeConfigApplyRes struct {
+	DryRun bool                  `json:"dryRun"`
+	Diff   models.HomeConfigDiff `json:"diff"`
+}
+
+// GetHomeConfig returns the configuration of rooms and device assignments of a home,
+// as JSON or as YAML with ?format=yaml, see models.HomeConfig.
+func (h *Homes) GetHomeConfig(c *gin.Context) {
+	h.logger.Info("REST - GET - GetHomeConfig called")
+
+	homeID, errID := bson.ObjectIDFromHex(c.Param("id"))
+	if errID != nil {
+		h.logger.Error("REST - GET - GetHomeConfig - wrong format of the path param 'id'")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "wrong format of the path param 'id'"})
+		return
+	}
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "yaml" {
+		h.logger.Errorf("REST - GET - GetHomeConfig - format '%s' is not supported", format)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be json or yaml"})
+		return
+	}
+
+	_, errRole := h.getHomeRole(c, homeID)
+	if errors.Is(errRole, errHomeNotFound) {
+		h.logger.Error("REST - GET - GetHomeConfig - Cannot find home")
+		c.JSON(http.StatusNotFound, gin.H{"error": "cannot find home"})
+		return
+	}
+	if errRole != nil {
+		h.logger.Error("REST - GET - GetHomeConfig - Cannot get the configuration of a home that is not in your profile")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cannot get the configuration of a home that is not in your profile"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	var home models.Home
+	if err := h.collHomes.FindOne(ctx, bson.M{"_id": homeID}).Decode(&home); err != nil {
+		h.logger.Errorf("REST - GET - GetHomeConfig - cannot find home, err = %v", err)
+		c.JSON(http.StatusNotFound, gin.H{"error": "cannot find home"})
+		return
+	}
+	devices, err := h.findDevices(ctx, homeDeviceIDs(&home))
+	if err != nil {
+		h.logger.Errorf("REST - GET - GetHomeConfig - cannot find devices of home, err = %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot get home configuration"})
+		return
+	}
+
+	config := utils.ExportHomeConfig(&home, devices)
+	if format == "yaml" {
+		c.YAML(http.StatusOK, config)
+		return
+	}
+	c.JSON(http.StatusOK, config)
+}
+
+// PutHomeConfig applies a configuration, as JSON or YAML according to Content-Type, to a home in a transaction.
+// Rooms not in the configuration are deleted and devices not in it are removed from the rooms of the home.
+// Devices can be the ones of the caller or already in the home. With ?dryRun=true it only returns the changes.
+func (h *Homes) PutHomeConfig(c *gin.Context) {
+	h.logger.Info("REST - PUT - PutHomeConfig called")
+
+	homeID, errID := bson.ObjectIDFromHex(c.Param("id"))
+	if errID != nil {
+		h.logger.Error("REST - PUT - PutHomeConfig - wrong format of the path param 'id'")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "wrong format of the path param 'id'"})
+		return
+	}
+	dryRun, err := strconv.ParseBool(c.DefaultQuery("dryRun", "false"))
+	if err != nil {
+		h.logger.Error("REST - PUT - PutHomeConfig - wrong format of the query param 'dryRun'")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "wrong format of the query param 'dryRun'"})
+		return
+	}
+
+	// binds JSON or YAML, according to Content-Type
+	var config models.HomeConfig
+	if err = c.ShouldBind(&config); err != nil {
+		h.logger.Errorf("REST - PUT - PutHomeConfig - Cannot bind request body. Err = %v\n", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request payload"})
+		return
+	}
+	if err = h.validate.Struct(config); err != nil {
+		h.logger.Errorf("REST - PUT - PutHomeConfig - request body is not valid, err %#v", err)
+		var errFields = utils.GetErrorMessage(err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body, these fields are not valid:" + errFields})
+		return
+	}
+
+	// you can configure a home only if you are at least an admin of that home, like for rooms
+	role, errRole := h.getHomeRole(c, homeID)
+	if errors.Is(errRole, errHomeNotFound) {
+		h.logger.Error("REST - PUT - PutHomeConfig - Cannot find home")
+		c.JSON(http.StatusNotFound, gin.H{"error": "cannot find home"})
+		return
+	}
+	if errRole != nil {
+		h.logger.Error("REST - PUT - PutHomeConfig - Cannot configure a home that is not in your profile")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cannot configure a home that is not in your profile"})
+		return
+	}
+	if !utils.HasHomeRole(role, models.HomeRoleAdmin) {
+		h.logger.Errorf("REST - PUT - PutHomeConfig - role '%s' cannot configure this home", role)
+		c.JSON(http.StatusForbidden, gin.H{"error": "you don't have permission to configure this home"})
+		return
+	}
+	profile, err := utils.GetLoggedProfileFromContext(c, h.collProfiles)
+	if err != nil {
+		h.logger.Error("REST - PUT - PutHomeConfig - cannot find profile")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "cannot find profile"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	if dryRun {
+		plan, err := h.planHomeConfig(ctx, homeID, profile.ID, &config, now)
+		if err != nil {
+			h.respondHomeConfigError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, HomeConfigApplyRes{DryRun: true, Diff: plan.Diff})
+		return
+	}
+
+	// start-session
+	dbSession, err := h.client.StartSession()
+	if err != nil {
+		h.logger.Errorf("REST - PUT - PutHomeConfig - cannot start a db session, err = %#v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot apply home configuration"})
+		return
+	}
+	// Defers ending the session after the transaction is committed or ended
+	defer dbSession.EndSession(context.Background())
+
+	var plan utils.HomeConfigPlan
+	var previousAudiences [][]bson.ObjectID
+	_, errTrans := dbSession.WithTransaction(ctx, func(sessionCtx context.Context) (interface{}, error) {
+		// Official `mongo-driver` documentation state: "callback may be run
+		// multiple times during WithTransaction due to retry attempts, so it must be idempotent."
+
+		// the plan is built on the home read in the transaction, so concurrent changes are not overwritten
+		var err error
+		plan, err = h.planHomeConfig(sessionCtx, homeID, profile.ID, &config, now)
+		if err != nil {
+			return nil, err
+		}
+		if plan.Diff.IsEmpty() {
+			return nil, nil
+		}
+
+		// profiles of the previous homes lose access to the devices with the transaction
+		previousAudiences = make([][]bson.ObjectID, 0, len(plan.DeviceIDs))
+		for _, deviceID := range plan.DeviceIDs {
+			previousAudiences = append(previousAudiences, h.events.deviceAudience(sessionCtx, deviceID))
+		}
+
+		// a device can be in a single room, so it's removed from rooms of other homes
+		if len(plan.DeviceIDs) > 0 {
+			if _, err := h.collHomes.UpdateMany(sessionCtx, bson.M{
+				"_id":           bson.M{"$ne": homeID},
+				"rooms.devices": bson.M{"$in": plan.DeviceIDs},
+			}, bson.M{
+				"$pull": bson.M{"rooms.$[].devices": bson.M{"$in": plan.DeviceIDs}},
+			}); err != nil {
+				h.logger.Errorf("REST - PUT - PutHomeConfig - cannot remove devices from other homes, err = %#v", err)
+				return nil, err
+			}
+		}
+
+		if _, err := h.collHomes.UpdateOne(sessionCtx, bson.M{
+			"_id": homeID,
+		}, bson.M{
+			"$set": bson.M{
+				"rooms":      plan.Rooms,
+				"modifiedAt": now,
+			},
+		}); err != nil {
+			h.logger.Errorf("REST - PUT - PutHomeConfig - cannot update rooms of home, err = %#v", err)
+			return nil, err
+		}
+
+		for deviceID, name := range plan.DeviceNames {
+			if _, err := h.collDevices.UpdateOne(sessionCtx,
+				bson.M{"_id": deviceID},
+				bson.M{"$set": bson.M{"overrides.name": name, "modifiedAt": now}},
+			); err != nil {
+				h.logger.Errorf("REST - PUT - PutHomeConfig - cannot rename device, err = %#v", err)
+				return nil, err
+			}
+		}
+		return nil, nil
+	}, options.Transaction().SetWriteConcern(writeconcern.Majority()))
+	if errTrans != nil {
+		h.respondHomeConfigError(c, errTrans)
+		return
+	}
+	if plan.Diff.IsEmpty() {
+		c.JSON(http.StatusOK, HomeConfigApplyRes{DryRun: false, Diff: plan.Diff})
+		return
+	}
+
+	h.logger.Infow("AUDIT - home configuration applied",
+		"profileID", profile.ID.Hex(),
+		"homeID", homeID.Hex(),
+		"roomsCreated", len(plan.Diff.RoomsCreated),
+		"roomsDeleted", len(plan.Diff.RoomsDeleted),
+		"devicesAssigned", len(plan.Diff.DevicesAssigned),
+		"devicesUnassigned", len(plan.Diff.DevicesUnassigned),
+	)
+	h.events.publish(models.Event{Type: models.EventHomeUpdated, HomeID: &homeID},
+		append(previousAudiences, h.events.homeAudience(c.Request.Context(), homeID))...)
+	c.JSON(http.StatusOK, HomeConfigApplyRes{DryRun: false, Diff: plan.Diff})
+}
+
+// ------------------------------ Private methods ------------------------------
+
+// planHomeConfig reads the home with homeID and the devices it can contain with ctx, then plans config on them.
+// Devices of the profile with profileID can be assigned, like with PutAssignDeviceToHomeRoom,
+// and the ones in the home can be moved.
+func (h *Homes) planHomeConfig(ctx context.Context, homeID, profileID bson.ObjectID, config *models.HomeConfig, now time.Time) (utils.HomeConfigPlan, error) {
+	var home models.Home
+	if err := h.collHomes.FindOne(ctx, bson.M{"_id": homeID}).Decode(&home); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return utils.HomeConfigPlan{}, errHomeNotFound
+		}
+		return utils.HomeConfigPlan{}, err
+	}
+	var profile models.Profile
+	if err := h.collProfiles.FindOne(ctx, bson.M{"_id": profileID}).Decode(&profile); err != nil {
+		return utils.HomeConfigPlan{}, err
+	}
+	devices, err := h.findDevices(ctx, append(homeDeviceIDs(&home), profile.Devices...))
+	if err != nil {
+		return utils.HomeConfigPlan{}, err
+	}
+	return utils.PlanHomeConfig(&home, devices, config, now)
+}
+
+// respondHomeConfigError answers PutHomeConfig with the status of err, returned while applying a configuration
+func (h *Homes) respondHomeConfigError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errHomeNotFound):
+		h.logger.Errorf("REST - PUT - PutHomeConfig - cannot find home, err = %v", err)
+		c.JSON(http.StatusNotFound, gin.H{"error": "cannot find home"})
+	case errors.Is(err, utils.ErrHomeConfigNotValid):
+		h.logger.Errorf("REST - PUT - PutHomeConfig - cannot plan home configuration, err = %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		h.logger.Errorf("REST - PUT - PutHomeConfig - cannot apply home configuration, err = %#v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot apply home configuration"})
+	}
+}
+
+// findDevices returns the devices with deviceIDs
+func (h *Homes) findDevices(ctx context.Context, deviceIDs []bson.ObjectID) ([]models.Device, error) {
+	devices := make([]models.Device, 0)
+	if len(deviceIDs) == 0 {
+		return devices, nil
+	}
+	cur, err := h.collDevices.Find(ctx, bson.M{"_id": bson.M{"$in": deviceIDs}})
+	if err != nil {
+		return nil, err
+	}
+	if err = cur.All(ctx, &devices); err != nil {
+		return nil, err
+	}
+	return devices, nil
+}
+
+// homeDeviceIDs returns the devices assigned to rooms of home
+func homeDeviceIDs(home *models.Home) []bson.ObjectID {
+	deviceIDs := make([]bson.ObjectID, 0)
+	for _, room := range home.Rooms {
+		deviceIDs = append(deviceIDs, room.Devices...)
+	}
+	return deviceIDs
+}
@@ -0,0 +1,131 @@
+package api
+
+import (
+	authpkg "api-server/auth"
+	"api-server/models"
+	"api-server/utils"
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// GetIdentities returns the logins linked to the logged profile, the first one is the main identity.
+func (gh *GitHubWebHandler) GetIdentities(c *gin.Context) {
+	gh.logger.Info("REST - GET - GetIdentities called")
+
+	sessionProfile, err := utils.GetProfileFromContext(c)
+	if err != nil {
+		gh.logger.Error("REST - GET - GetIdentities - cannot find profile")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "cannot find profile"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	var profile models.Profile
+	err = gh.collProfiles.FindOne(ctx, bson.M{"_id": sessionProfile.ID},
+		options.FindOne().SetProjection(bson.M{"identities": 1, "github": 1}),
+	).Decode(&profile)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			gh.logger.Errorf("REST - GET - GetIdentities - cannot find profile %s", sessionProfile.ID.Hex())
+			c.JSON(http.StatusNotFound, gin.H{"error": "cannot find profile"})
+			return
+		}
+		gh.logger.Errorf("REST - GET - GetIdentities - cannot find profile, err = %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot get identities"})
+		return
+	}
+	identities := profile.Identities
+	if len(identities) == 0 {
+		identities = []models.Identity{profile.MainIdentity()}
+	}
+	c.JSON(http.StatusOK, identities)
+}
+
+// LinkIdentity starts the login with the provider in path params, to link its identity to the logged profile.
+// It returns the authorization URL, because browsers cannot follow redirects of authenticated API calls.
+// The provider redirects to the usual callback, which links the identity instead of logging in
+// and redirects to /postlink.
+func (gh *GitHubWebHandler) LinkIdentity(c *gin.Context) {
+	gh.logger.Info("REST - POST - LinkIdentity called")
+
+	profile, err := utils.GetProfileFromContext(c)
+	if err != nil {
+		gh.logger.Error("REST - POST - LinkIdentity - cannot find profile")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "cannot find profile"})
+		return
+	}
+
+	authURL, ok := gh.startAuthorization(c, c.Param("provider"), profile.ID.Hex())
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"url": authURL})
+}
+
+// DeleteIdentity unlinks the identity of the provider in path params from the logged profile.
+// The last identity cannot be unlinked, otherwise nobody could log in with the profile anymore.
+func (gh *GitHubWebHandler) DeleteIdentity(c *gin.Context) {
+	gh.logger.Info("REST - DELETE - DeleteIdentity called")
+
+	providerName := c.Param("provider")
+	profile, err := utils.GetProfileFromContext(c)
+	if err != nil {
+		gh.logger.Error("REST - DELETE - DeleteIdentity - cannot find profile")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "cannot find profile"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	err = authpkg.UnlinkIdentity(ctx, gh.logger, gh.collProfiles, profile.ID, providerName)
+	switch {
+	case errors.Is(err, authpkg.ErrIdentityNotFound):
+		gh.logger.Errorf("REST - DELETE - DeleteIdentity - cannot find identity of provider %s", providerName)
+		c.JSON(http.StatusNotFound, gin.H{"error": "identity not found"})
+	case errors.Is(err, authpkg.ErrLastIdentity):
+		gh.logger.Errorf("REST - DELETE - DeleteIdentity - cannot unlink the last identity of profile %s", profile.ID.Hex())
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cannot unlink the last login"})
+	case err != nil:
+		gh.logger.Errorf("REST - DELETE - DeleteIdentity - cannot unlink identity, err = %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot unlink identity"})
+	default:
+		c.JSON(http.StatusOK, gin.H{"message": "identity has been unlinked"})
+	}
+}
+
+// ------------------------------ Private methods ------------------------------
+
+// linkIdentity completes LinkIdentity in the callback, linking identity to the profile that started it
+func (gh *GitHubWebHandler) linkIdentity(ctx context.Context, c *gin.Context, linkProfileID string, identity models.Identity) {
+	profileID, err := bson.ObjectIDFromHex(linkProfileID)
+	if err != nil {
+		gh.logger.Errorf("REST - GET - Callback - invalid profile to link %s", linkProfileID)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid oauth callback"})
+		return
+	}
+
+	err = authpkg.LinkIdentity(ctx, gh.logger, gh.collProfiles, profileID, identity)
+	switch {
+	case errors.Is(err, authpkg.ErrIdentityLinkedToOtherProfile):
+		gh.logger.Errorf("REST - GET - Callback - identity %s is linked to another profile", identity.ID)
+		c.JSON(http.StatusConflict, gin.H{"error": "this login is already linked to another profile"})
+	case errors.Is(err, authpkg.ErrProviderAlreadyLinked):
+		gh.logger.Errorf("REST - GET - Callback - profile %s has already an identity of provider %s", linkProfileID, identity.Provider)
+		c.JSON(http.StatusConflict, gin.H{"error": "a login with this provider is already linked, unlink it first"})
+	case err != nil:
+		gh.logger.Errorw("REST - GET - Callback - could not link identity", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not link identity"})
+	default:
+		c.Redirect(http.StatusFound, "/postlink#provider="+identity.Provider)
+	}
+}
@@ -0,0 +1,32 @@
+package api
+
+import (
+	"api-server/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// JWKS publishes the public keys verifying access tokens, so other services can verify them without secrets.
+type JWKS struct {
+	jwtKeys *utils.JWTKeySet
+	logger  *zap.SugaredLogger
+}
+
+// NewJWKS constructs a JWKS handler publishing the keys of jwtKeys.
+func NewJWKS(logger *zap.SugaredLogger, jwtKeys *utils.JWTKeySet) *JWKS {
+	return &JWKS{
+		jwtKeys: jwtKeys,
+		logger:  logger,
+	}
+}
+
+// GetJWKS returns the public keys as JSON Web Key Set (RFC 7517).
+// It includes keys of tokens that are still valid after a rotation, and new keys before they sign tokens,
+// so verifiers can cache it for a few minutes.
+func (j *JWKS) GetJWKS(c *gin.Context) {
+	j.logger.Info("REST - GET - GetJWKS called")
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, gin.H{"keys": j.jwtKeys.JWKS()})
+}
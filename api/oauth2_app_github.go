@@ -23,6 +23,7 @@ import (
 	"go.uber.org/zap"
 )
 
+// GitHubAppHandler logs in the mobile app with GitHub or any other configured identity provider.
 type GitHubAppHandler struct {
 	collProfiles                *mongo.Collection
 	auth                        *authpkg.Auth
@@ -31,7 +32,9 @@ type GitHubAppHandler struct {
 	sessionAppCodeChallengeName string
 	sessionAppStateName         string
 	sessionGitHubVerifierName   string
-	httpClient                  *http.Client
+	sessionProviderName         string
+	sessionNonceName            string
+	audit                       *AuditLog
 }
 
 type AppExchangeCodeReq struct {
@@ -44,7 +47,7 @@ type AppExchangeCodeResp struct {
 	RefreshToken string `json:"refreshToken"`
 }
 
-func NewGitHubAppHandler(auth *authpkg.Auth, logger *zap.SugaredLogger, client *mongo.Client, sessionStateName, sessionAppCodeChallengeName string) *GitHubAppHandler {
+func NewGitHubAppHandler(auth *authpkg.Auth, logger *zap.SugaredLogger, client *mongo.Client, audit *AuditLog, sessionStateName, sessionAppCodeChallengeName string) *GitHubAppHandler {
 	return &GitHubAppHandler{
 		collProfiles:                db.GetCollections(client).Profiles,
 		auth:                        auth,
@@ -53,31 +56,60 @@ func NewGitHubAppHandler(auth *authpkg.Auth, logger *zap.SugaredLogger, client *
 		sessionAppCodeChallengeName: sessionAppCodeChallengeName,
 		sessionAppStateName:         sessionAppCodeChallengeName + "_app_state",
 		sessionGitHubVerifierName:   sessionAppCodeChallengeName + "_github_verifier",
-		httpClient: &http.Client{
-			Timeout: 10 * time.Second,
-		},
+		sessionProviderName:         sessionStateName + "_provider",
+		sessionNonceName:            sessionStateName + "_nonce",
+		audit:                       audit,
 	}
 }
 
+// GitHubAppLogin starts the login of the mobile app with GitHub
 func (gh *GitHubAppHandler) GitHubAppLogin(c *gin.Context) {
 	gh.logger.Info("REST - GET - GitHubAppLogin called")
+	gh.appLogin(c, models.IdentityProviderGitHub)
+}
+
+// ProviderAppLogin starts the login of the mobile app with the provider in path params
+func (gh *GitHubAppHandler) ProviderAppLogin(c *gin.Context) {
+	gh.logger.Info("REST - GET - ProviderAppLogin called")
+	gh.appLogin(c, c.Param("provider"))
+}
+
+// GitHubAppCallback completes the login of the mobile app with GitHub
+func (gh *GitHubAppHandler) GitHubAppCallback(c *gin.Context) {
+	gh.logger.Info("REST - GET - GitHubAppCallback called")
+	gh.appCallback(c, models.IdentityProviderGitHub)
+}
+
+// ProviderAppCallback completes the login of the mobile app with the provider in path params
+func (gh *GitHubAppHandler) ProviderAppCallback(c *gin.Context) {
+	gh.logger.Info("REST - GET - ProviderAppCallback called")
+	gh.appCallback(c, c.Param("provider"))
+}
+
+func (gh *GitHubAppHandler) appLogin(c *gin.Context, providerName string) {
+	provider, ok := gh.auth.Providers.Get(providerName)
+	if !ok {
+		gh.logger.Errorf("REST - GET - AppLogin - unknown identity provider %s", providerName)
+		c.JSON(http.StatusNotFound, gin.H{"error": "unknown identity provider"})
+		return
+	}
 
 	// ---------------------- MOBILE APP SPECIFIC ----------------------
-	// This PKCE challenge is generated by the mobile app, not by GitHub.
+	// This PKCE challenge is generated by the mobile app, not by the provider.
 	// It protects the later /app/exchange-code step: if the app_code leaks
 	// through the OS/browser redirect boundary, it cannot be redeemed without
 	// the app-held verifier.
 	appCodeChallenge := strings.TrimSpace(c.Query("code_challenge"))
 	appCodeChallengeMethod := strings.TrimSpace(c.Query("code_challenge_method"))
 	if !utils.IsValidPKCECodeChallenge(appCodeChallenge) || appCodeChallengeMethod != utils.PKCEChallengeMethodS256 {
-		gh.logger.Error("REST - GET - GitHubAppLogin - invalid app-code PKCE challenge")
+		gh.logger.Error("REST - GET - AppLogin - invalid app-code PKCE challenge")
 		c.JSON(http.StatusBadRequest, gin.H{"error": "missing or invalid PKCE parameters"})
 		return
 	}
 	// -----------------------------------------------------------------
 	appState := strings.TrimSpace(c.Query("app_state"))
 	if !utils.IsValidPKCEVerifier(appState) {
-		gh.logger.Error("REST - GET - GitHubAppLogin - invalid app state")
+		gh.logger.Error("REST - GET - AppLogin - invalid app state")
 		c.JSON(http.StatusBadRequest, gin.H{"error": "missing or invalid app state"})
 		return
 	}
@@ -86,36 +118,53 @@ func (gh *GitHubAppHandler) GitHubAppLogin(c *gin.Context) {
 
 	// build state for CSRF protection. Use the RFC 7636 PKCE verifier
 	// maximum length because the value has the same unguessable bearer-secret
-	// property and GitHub echoes it through the OAuth redirect.
+	// property and the provider echoes it through the OAuth redirect.
 	state, err := utils.NewPKCEVerifier()
 	if err != nil {
-		gh.logger.Error("REST - GET - GitHubAppLogin - cannot create random state token")
+		gh.logger.Error("REST - GET - AppLogin - cannot create random state token")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not initialize oauth flow"})
+		return
+	}
+	// build nonce, OpenID Connect providers put it in the ID token to bind it to this login
+	nonce, err := utils.NewPKCEVerifier()
+	if err != nil {
+		gh.logger.Error("REST - GET - AppLogin - cannot create random nonce")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not initialize oauth flow"})
 		return
 	}
 
 	// This second PKCE verifier is server-generated and protects only the
-	// server <-> GitHub authorization-code exchange, exactly like the web flow.
+	// server <-> provider authorization-code exchange, exactly like the web flow.
 	// build PKCE plain secret verifier
 	// (it will be used only on our server-side as a verification step)
 	githubVerifier, err := utils.NewPKCEVerifier()
 	if err != nil {
-		gh.logger.Errorw("REST - GET - GitHubAppLogin - cannot create GitHub PKCE verifier", "error", err)
+		gh.logger.Errorw("REST - GET - AppLogin - cannot create PKCE verifier", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not initialize oauth flow"})
 		return
 	}
 	// build PKCE codeChallenge from verifier with sha256 and base64 function
-	// This will be used later to send it to GitHub (so we send the hashed version and not the plain verifier code)
+	// This will be used later to send it to the provider (so we send the hashed version and not the plain verifier code)
 	githubCodeChallenge, err := utils.BuildPKCECodeChallenge(githubVerifier)
 	if err != nil {
-		gh.logger.Errorw("REST - GET - GitHubAppLogin - cannot create GitHub PKCE challenge", "error", err)
+		gh.logger.Errorw("REST - GET - AppLogin - cannot create PKCE challenge", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not initialize oauth flow"})
 		return
 	}
 
-	// store both state and GitHub PKCE verifier in session
+	// authURL must expose only the S256 challenge. Keep the raw verifier server-side.
+	authURL, err := provider.AuthorizationURL(c.Request.Context(), authpkg.OAuthClientApp, state, nonce, githubCodeChallenge)
+	if err != nil {
+		gh.logger.Errorw("REST - GET - AppLogin - cannot build authorization URL", "provider", providerName, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not build authURL during oauth flow initialization"})
+		return
+	}
+
+	// store state, nonce, provider and PKCE verifier in session
 	session.Set(gh.sessionStateName, state)
 	session.Set(gh.sessionGitHubVerifierName, githubVerifier)
+	session.Set(gh.sessionProviderName, providerName)
+	session.Set(gh.sessionNonceName, nonce)
 
 	// ---------------------- MOBILE APP SPECIFIC ----------------------
 	// save also PKCE challenge and state in session, we will need these later
@@ -124,99 +173,89 @@ func (gh *GitHubAppHandler) GitHubAppLogin(c *gin.Context) {
 	// -----------------------------------------------------------------
 
 	if err = session.Save(); err != nil {
-		gh.logger.Error("REST - GET - GitHubAppLogin - cannot save session")
+		gh.logger.Error("REST - GET - AppLogin - cannot save session")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not initialize oauth flow"})
 		return
 	}
 
-	// authURL must expose only the S256 challenge. Keep the raw verifier server-side.
-	authURL, err := authpkg.BuildGitHubAuthorizationURL(authpkg.GitHubOAuthClientApp, state, githubCodeChallenge)
-	if err != nil {
-		gh.logger.Errorw("REST - GET - GitHubAppLogin - cannot build authorization URL", "error", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not build authURL during oauth flow initialization"})
-		return
-	}
-
-	gh.logger.Debug("REST - GET - GitHubAppLogin - authURL: ", authURL)
+	gh.logger.Debug("REST - GET - AppLogin - authURL: ", authURL)
 	c.Redirect(http.StatusTemporaryRedirect, authURL)
 }
 
-func (gh *GitHubAppHandler) GitHubAppCallback(c *gin.Context) {
-	gh.auth.Logger.Info("REST - GET - GitHubAppCallback called")
-
+func (gh *GitHubAppHandler) appCallback(c *gin.Context, providerName string) {
 	session := sessions.Default(c)
 	defer func() {
 		session.Delete(gh.sessionStateName)
 		session.Delete(gh.sessionGitHubVerifierName)
 		session.Delete(gh.sessionAppCodeChallengeName)
 		session.Delete(gh.sessionAppStateName)
+		session.Delete(gh.sessionProviderName)
+		session.Delete(gh.sessionNonceName)
 		if err := session.Save(); err != nil {
-			gh.logger.Warnw("GitHubAppCallback - cannot clear oauth session", "error", err)
+			gh.logger.Warnw("AppCallback - cannot clear oauth session", "error", err)
 		}
 	}()
 
 	// extract state (for CSRF protection)
 	queryState := strings.TrimSpace(c.Query("state"))
-	// extract code: a one-time authorization code from GitHub, used to get a GitHub access token.
+	// extract code: a one-time authorization code from the provider, used to get its tokens.
 	queryCode := strings.TrimSpace(c.Query("code"))
 	if queryState == "" || queryCode == "" {
-		gh.logger.Error("REST - GET - GitHubAppCallback - missing either state or code callback parameters")
+		gh.logger.Error("REST - GET - AppCallback - missing either state or code callback parameters")
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid oauth callback"})
 		return
 	}
 
-	// check if state, GitHub PKCE verifier, and app-code PKCE challenge are in session.
+	// check if state, provider PKCE verifier, provider, nonce and app-code PKCE challenge are in session.
 	sessionState, _ := session.Get(gh.sessionStateName).(string)
 	githubVerifier, _ := session.Get(gh.sessionGitHubVerifierName).(string)
+	sessionProvider, _ := session.Get(gh.sessionProviderName).(string)
+	nonce, _ := session.Get(gh.sessionNonceName).(string)
 	appCodeChallenge, _ := session.Get(gh.sessionAppCodeChallengeName).(string)
 	appState, _ := session.Get(gh.sessionAppStateName).(string)
-	if sessionState == "" || !utils.IsValidPKCEVerifier(githubVerifier) ||
+	if sessionState == "" || !utils.IsValidPKCEVerifier(githubVerifier) || sessionProvider == "" || nonce == "" ||
 		!utils.IsValidPKCECodeChallenge(appCodeChallenge) || !utils.IsValidPKCEVerifier(appState) {
-		gh.logger.Error("REST - GET - GitHubAppCallback - oauth session is missing or expired")
+		gh.logger.Error("REST - GET - AppCallback - oauth session is missing or expired")
 		c.JSON(http.StatusBadRequest, gin.H{"error": "oauth session is missing or expired"})
 		return
 	}
 
 	// state must be = to the one in session
 	if subtle.ConstantTimeCompare([]byte(queryState), []byte(sessionState)) != 1 {
-		gh.logger.Error("REST - GET - GitHubAppCallback - oauth state verification failed")
+		gh.logger.Error("REST - GET - AppCallback - oauth state verification failed")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid oauth callback"})
+		return
+	}
+
+	// the code must come from the provider the login started with
+	provider, ok := gh.auth.Providers.Get(providerName)
+	if !ok || sessionProvider != providerName {
+		gh.logger.Errorf("REST - GET - AppCallback - callback of provider %s, but login started with %s", providerName, sessionProvider)
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid oauth callback"})
 		return
 	}
 
-	// 10s timeout, so the GitHub token exchange and profile request cannot pin the request indefinitely.
+	// 10s timeout, so the token exchange and profile request cannot pin the request indefinitely.
 	// This is not really required because the timeout is already 10s, but in this way it's more explicit.
 	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
 	defer cancel()
 
-	// get GitHub access token passing both:
+	// get the identity of the user passing:
 	// - one-time code
-	// - PKCE plain verifier (the plain string, because GitHub will hash and compare it)
-	githubAccessToken, err := authpkg.ExchangeGitHubCodeForAccessToken(
-		ctx,
-		gh.httpClient,
-		authpkg.GitHubOAuthClientApp,
-		queryCode,
-		githubVerifier,
-	)
-	if err != nil {
-		gh.logger.Errorw("REST - GET - GitHubAppCallback - github token exchange failed", "error", err)
-		c.JSON(http.StatusBadGateway, gin.H{"error": "github token exchange failed"})
-		return
-	}
-
-	// get GitHub profile using the githubAccessToken
-	githubProfile, err := authpkg.FetchGitHubUser(ctx, gh.httpClient, githubAccessToken)
+	// - PKCE plain verifier (the plain string, because the provider will hash and compare it)
+	// - nonce, that must be in the ID token of OpenID Connect providers
+	identity, err := provider.Identity(ctx, authpkg.OAuthClientApp, queryCode, githubVerifier, nonce)
 	if err != nil {
-		gh.logger.Errorw("REST - GET - GitHubAppCallback - could not load github profile", "error", err)
-		c.JSON(http.StatusBadGateway, gin.H{"error": "could not load github profile"})
+		gh.logger.Errorw("REST - GET - AppCallback - login with identity provider failed", "provider", providerName, "error", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "login with identity provider failed"})
 		return
 	}
 
 	// find existing local profile or create a new one
-	profile, err := authpkg.FindOrCreateGitHubProfile(ctx, gh.logger, gh.collProfiles, githubProfile)
+	profile, err := authpkg.FindOrCreateProfile(ctx, gh.logger, gh.collProfiles, gh.auth.CollUserInvitations, identity)
 	if err != nil {
-		gh.logger.Errorw("REST - GET - GitHubAppCallback - could not persist user", "error", err)
+		gh.logger.Errorw("REST - GET - AppCallback - could not persist user", "error", err)
+		gh.audit.recordLogin(c, profile.ID, authpkg.RefreshTokenClientMobile, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not persist user"})
 		return
 	}
@@ -227,22 +266,24 @@ func (gh *GitHubAppHandler) GitHubAppCallback(c *gin.Context) {
 	// must redeem it later with the original verifier before JWTs are issued.
 	appLoginCode, expiry, err := gh.issueAppLoginResult(ctx, profile, appCodeChallenge)
 	if err != nil {
-		gh.auth.Logger.Errorw("REST - GET - GitHubAppCallback - could not issue app login result", "error", err)
+		gh.auth.Logger.Errorw("REST - GET - AppCallback - could not issue app login result", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not complete login"})
 		return
 	}
 
 	gh.auth.Logger.Infow("AUDIT - app login code issued",
 		"profileID", profile.ID.Hex(),
+		"provider", providerName,
 		"expiry", expiry,
 	)
+	gh.audit.recordLogin(c, profile.ID, authpkg.RefreshTokenClientMobile, nil)
 
 	queryParams := url.Values{}
 	queryParams.Set("code", appLoginCode)
 	queryParams.Set("state", appState)
 	location, err := gh.buildMobileAppRedirectURL(queryParams)
 	if err != nil {
-		gh.auth.Logger.Errorw("REST - GET - GitHubAppCallback - invalid app callback URL configuration", "error", err)
+		gh.auth.Logger.Errorw("REST - GET - AppCallback - invalid app callback URL configuration", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot build app redirect"})
 		return
 	}
@@ -308,13 +349,18 @@ func (gh *GitHubAppHandler) ExchangeAppCode(c *gin.Context) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "profile not found"})
 		return
 	}
+	if profile.IsSuspended() {
+		gh.auth.Logger.Errorw("REST - POST - ExchangeAppCode - profile is suspended", "profileID", profile.ID.Hex())
+		c.JSON(http.StatusForbidden, gin.H{"error": "profile is suspended"})
+		return
+	}
 
 	// issue the local access JWT and store a hashed refresh token server-side.
 	accessToken, refreshToken, expirationTime, err := authpkg.IssueGitHubLoginResult(
 		c.Request.Context(),
 		gh.auth.CollRefreshTokens,
 		profile,
-		gh.auth.JwtKey,
+		gh.auth.JWTKeys,
 		authpkg.MobileTokenTTL,
 		authpkg.MobileRefreshTokenTTL,
 		authpkg.RefreshTokenClientMobile,
@@ -23,9 +23,13 @@ import (
 type OAuthHandler struct {
 	logger            *zap.SugaredLogger
 	client            *mongo.Client
-	jwtKey            []byte
+	jwtKeys           *utils.JWTKeySet
 	collProfiles      *mongo.Collection
 	collRefreshTokens *mongo.Collection
+	// device authorization grant
+	collDeviceAuthorizations *mongo.Collection
+	deviceVerificationURI    string
+	audit                    *AuditLog
 }
 
 type appRefreshTokenReq struct {
@@ -38,20 +42,24 @@ type appRefreshTokenResp struct {
 }
 
 var (
-	errRefreshTokenNotFound        = errors.New("refresh token not found")
-	errRefreshTokenReuse           = errors.New("refresh token reuse detected")
-	errRefreshTokenExpired         = errors.New("refresh token expired")
-	errRefreshTokenProfileNotFound = errors.New("refresh token profile not found")
+	errRefreshTokenNotFound         = errors.New("refresh token not found")
+	errRefreshTokenReuse            = errors.New("refresh token reuse detected")
+	errRefreshTokenExpired          = errors.New("refresh token expired")
+	errRefreshTokenProfileNotFound  = errors.New("refresh token profile not found")
+	errRefreshTokenProfileSuspended = errors.New("refresh token profile suspended")
 )
 
-func NewOAuthHandler(logger *zap.SugaredLogger, client *mongo.Client) *OAuthHandler {
+func NewOAuthHandler(logger *zap.SugaredLogger, client *mongo.Client, jwtKeys *utils.JWTKeySet, audit *AuditLog) *OAuthHandler {
 	colls := db.GetCollections(client)
 	return &OAuthHandler{
-		logger:            logger,
-		client:            client,
-		jwtKey:            []byte(os.Getenv("JWT_PASSWORD")),
-		collProfiles:      colls.Profiles,
-		collRefreshTokens: colls.RefreshTokens,
+		logger:                   logger,
+		client:                   client,
+		jwtKeys:                  jwtKeys,
+		collProfiles:             colls.Profiles,
+		collRefreshTokens:        colls.RefreshTokens,
+		collDeviceAuthorizations: colls.DeviceAuthorizations,
+		deviceVerificationURI:    buildDeviceVerificationURI(os.Getenv("OAUTH2_CALLBACK")),
+		audit:                    audit,
 	}
 }
 
@@ -93,6 +101,10 @@ func (oc *OAuthHandler) RefreshToken(c *gin.Context) {
 			oc.logger.Errorw("REST - POST - RefreshToken - profile not found", "profileID", tokenRecord.ProfileID.Hex(), "error", err)
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "profile not found"})
 			return
+		case errors.Is(err, errRefreshTokenProfileSuspended):
+			oc.logger.Errorw("REST - POST - RefreshToken - profile is suspended", "profileID", tokenRecord.ProfileID.Hex())
+			c.JSON(http.StatusForbidden, gin.H{"error": "profile is suspended"})
+			return
 		default:
 			oc.logger.Errorw("REST - POST - RefreshToken - cannot validate refresh token", "error", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot validate refresh token"})
@@ -110,7 +122,7 @@ func (oc *OAuthHandler) RefreshToken(c *gin.Context) {
 
 	now := time.Now().UTC()
 	expirationTime := now.Add(authpkg.WebTokenTTL)
-	accessTokenString, err := utils.CreateJWT(profile, expirationTime, utils.AccessToken, authpkg.RefreshTokenClientWeb, oc.jwtKey)
+	accessTokenString, err := utils.CreateJWT(profile, expirationTime, utils.AccessToken, authpkg.RefreshTokenClientWeb, tokenRecord.FamilyID, oc.jwtKeys)
 	if err != nil {
 		oc.logger.Error("REST - POST - RefreshToken - cannot generate access JWT")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot generate access token"})
@@ -181,6 +193,10 @@ func (oc *OAuthHandler) RefreshMobileToken(c *gin.Context) {
 			oc.logger.Errorw("REST - POST - RefreshMobileToken - profile not found", "profileID", tokenRecord.ProfileID.Hex(), "error", err)
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "profile not found"})
 			return
+		case errors.Is(err, errRefreshTokenProfileSuspended):
+			oc.logger.Errorw("REST - POST - RefreshMobileToken - profile is suspended", "profileID", tokenRecord.ProfileID.Hex())
+			c.JSON(http.StatusForbidden, gin.H{"error": "profile is suspended"})
+			return
 		default:
 			oc.logger.Errorw("REST - POST - RefreshMobileToken - cannot validate refresh token", "error", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot validate refresh token"})
@@ -190,7 +206,7 @@ func (oc *OAuthHandler) RefreshMobileToken(c *gin.Context) {
 
 	now := time.Now().UTC()
 	expirationTime := now.Add(authpkg.MobileTokenTTL)
-	accessTokenString, err := utils.CreateJWT(profile, expirationTime, utils.AccessToken, authpkg.RefreshTokenClientMobile, oc.jwtKey)
+	accessTokenString, err := utils.CreateJWT(profile, expirationTime, utils.AccessToken, authpkg.RefreshTokenClientMobile, tokenRecord.FamilyID, oc.jwtKeys)
 	if err != nil {
 		oc.logger.Error("REST - POST - RefreshMobileToken - cannot generate access JWT")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot generate access token"})
@@ -230,6 +246,16 @@ func (oc *OAuthHandler) Logout(c *gin.Context) {
 		}
 	}
 
+	if err := clearWebSession(c); err != nil {
+		oc.logger.Errorw("REST - POST - Logout - cannot clear session", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot logout"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// clearWebSession removes the session and the refresh token cookies of the web app
+func clearWebSession(c *gin.Context) error {
 	session := sessions.Default(c)
 	session.Clear()
 	session.Options(sessions.Options{
@@ -240,13 +266,10 @@ func (oc *OAuthHandler) Logout(c *gin.Context) {
 		SameSite: http.SameSiteLaxMode,
 	})
 	if err := session.Save(); err != nil {
-		oc.logger.Errorw("REST - POST - Logout - cannot clear session", "error", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot logout"})
-		return
+		return err
 	}
-
 	utils.ClearRefreshTokenCookie(c, os.Getenv("ENV") == "prod")
-	c.Status(http.StatusNoContent)
+	return nil
 }
 
 func (oc *OAuthHandler) LogoutApp(c *gin.Context) {
@@ -305,6 +328,10 @@ func (oc *OAuthHandler) validateRefreshToken(ctx context.Context, rawRefreshToke
 	if err != nil {
 		return tokenRecord, models.Profile{}, errRefreshTokenProfileNotFound
 	}
+	// suspended profiles keep their tokens, but cannot use them
+	if profile.IsSuspended() {
+		return tokenRecord, models.Profile{}, errRefreshTokenProfileSuspended
+	}
 
 	return tokenRecord, profile, nil
 }
@@ -324,14 +351,20 @@ func (oc *OAuthHandler) rotateStoredRefreshToken(ctx context.Context, tokenRecor
 	}
 	defer dbSession.EndSession(context.Background())
 
+	familyCreatedAt := tokenRecord.FamilyCreatedAt
+	if familyCreatedAt.IsZero() {
+		// tokens stored before families tracked their creation time
+		familyCreatedAt = tokenRecord.CreatedAt
+	}
 	newTokenRecord := models.RefreshToken{
-		ID:         bson.NewObjectID(),
-		ProfileID:  tokenRecord.ProfileID,
-		TokenHash:  newHash,
-		FamilyID:   tokenRecord.FamilyID,
-		ClientType: tokenRecord.ClientType,
-		CreatedAt:  now,
-		ExpiresAt:  now.Add(ttl),
+		ID:              bson.NewObjectID(),
+		ProfileID:       tokenRecord.ProfileID,
+		TokenHash:       newHash,
+		FamilyID:        tokenRecord.FamilyID,
+		ClientType:      tokenRecord.ClientType,
+		CreatedAt:       now,
+		ExpiresAt:       now.Add(ttl),
+		FamilyCreatedAt: familyCreatedAt,
 	}
 
 	_, err = dbSession.WithTransaction(ctx, func(sessionCtx context.Context) (interface{}, error) {
@@ -385,6 +418,19 @@ func (oc *OAuthHandler) revokeRefreshTokenFamily(ctx context.Context, familyID s
 	return err
 }
 
+// revokeOtherRefreshTokenFamilies revokes refresh tokens of a profile, except the ones of keepFamilyID.
+// It returns the number of revoked tokens.
+func (oc *OAuthHandler) revokeOtherRefreshTokenFamilies(ctx context.Context, profileID bson.ObjectID, keepFamilyID string, revokedAt time.Time) (int64, error) {
+	result, err := oc.collRefreshTokens.UpdateMany(ctx,
+		bson.M{"profileId": profileID, "familyId": bson.M{"$ne": keepFamilyID}, "revokedAt": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revokedAt": revokedAt}},
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
+
 func (oc *OAuthHandler) revokeRefreshTokenByHash(ctx context.Context, tokenHash string, revokedAt time.Time) error {
 	_, err := oc.collRefreshTokens.UpdateOne(ctx,
 		bson.M{"tokenHash": tokenHash, "revokedAt": bson.M{"$exists": false}},
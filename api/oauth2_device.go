@@ -0,0 +1,400 @@
+package api
+
+import (
+	authpkg "api-server/auth"
+	"api-server/models"
+	"api-server/utils"
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// grant types of the token endpoint of headless clients
+const (
+	grantTypeDeviceCode   = "urn:ietf:params:oauth:grant-type:device_code"
+	grantTypeRefreshToken = "refresh_token"
+)
+
+// deviceCodeSlowDown is added to the poll interval of a client polling too often (RFC 8628, section 3.5)
+const deviceCodeSlowDown = 5 * time.Second
+
+// deviceVerificationPath is the page of the web app where logged users approve user codes
+const deviceVerificationPath = "/device"
+
+// DeviceCodeResp is the device authorization response (RFC 8628, section 3.2)
+type DeviceCodeResp struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval"`
+}
+
+// DeviceTokenResp is the access token response of headless clients (RFC 6749, section 5.1)
+type DeviceTokenResp struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// PostDeviceCode starts a login of a headless client with the device authorization grant.
+// The client shows the user code and the verification URI, then polls PostDeviceToken with the device code.
+func (oc *OAuthHandler) PostDeviceCode(c *gin.Context) {
+	oc.logger.Info("REST - POST - PostDeviceCode called")
+
+	deviceCode, err := utils.RandomString(32)
+	if err != nil {
+		oc.logger.Errorw("REST - POST - PostDeviceCode - cannot create device code", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+	now := time.Now().UTC()
+
+	authorization := models.DeviceAuthorization{
+		ID:             bson.NewObjectID(),
+		DeviceCodeHash: utils.HashToken(deviceCode),
+		Status:         models.DeviceAuthorizationPending,
+		Interval:       int(authpkg.DeviceCodePollInterval.Seconds()),
+		CreatedAt:      now,
+		ExpiresAt:      now.Add(authpkg.DeviceCodeTTL),
+	}
+	// user codes are short, so they can collide with the ones of other pending authorizations
+	for attempt := 0; attempt < 3; attempt++ {
+		if authorization.UserCode, err = utils.NewUserCode(); err != nil {
+			break
+		}
+		if _, err = oc.collDeviceAuthorizations.InsertOne(ctx, authorization); !mongo.IsDuplicateKeyError(err) {
+			break
+		}
+	}
+	if err != nil {
+		oc.logger.Errorw("REST - POST - PostDeviceCode - cannot save device authorization", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+		return
+	}
+
+	userCode := utils.FormatUserCode(authorization.UserCode)
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, DeviceCodeResp{
+		DeviceCode:              deviceCode,
+		UserCode:                userCode,
+		VerificationURI:         oc.deviceVerificationURI,
+		VerificationURIComplete: oc.deviceVerificationURI + "?user_code=" + url.QueryEscape(userCode),
+		ExpiresIn:               int(authpkg.DeviceCodeTTL.Seconds()),
+		Interval:                authorization.Interval,
+	})
+}
+
+// PostDeviceToken is the token endpoint of headless clients, with form parameters as defined by RFC 6749.
+// With the device_code grant it answers authorization_pending until the user code is approved,
+// then it issues access and refresh tokens once. With the refresh_token grant it rotates the refresh token.
+func (oc *OAuthHandler) PostDeviceToken(c *gin.Context) {
+	oc.logger.Info("REST - POST - PostDeviceToken called")
+
+	// token responses must not be cached (RFC 6749, section 5.1)
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+
+	switch c.PostForm("grant_type") {
+	case grantTypeDeviceCode:
+		oc.exchangeDeviceCode(c, c.PostForm("device_code"))
+	case grantTypeRefreshToken:
+		oc.refreshDeviceToken(c, c.PostForm("refresh_token"))
+	default:
+		oc.logger.Errorw("REST - POST - PostDeviceToken - unsupported grant type", "grantType", c.PostForm("grant_type"))
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unsupported_grant_type"})
+	}
+}
+
+// GetDeviceAuthorization returns the pending device authorization of a user code,
+// so the web app can ask the logged user to confirm it is the code shown by the client.
+func (oc *OAuthHandler) GetDeviceAuthorization(c *gin.Context) {
+	oc.logger.Info("REST - GET - GetDeviceAuthorization called")
+
+	userCode, ok := utils.NormalizeUserCode(c.Param("userCode"))
+	if !ok {
+		oc.logger.Error("REST - GET - GetDeviceAuthorization - wrong format of the path param 'userCode'")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "wrong format of the path param 'userCode'"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	var authorization models.DeviceAuthorization
+	err := oc.collDeviceAuthorizations.FindOne(ctx, bson.M{
+		"userCode":  userCode,
+		"status":    models.DeviceAuthorizationPending,
+		"expiresAt": bson.M{"$gt": time.Now().UTC()},
+	}).Decode(&authorization)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			oc.logger.Error("REST - GET - GetDeviceAuthorization - cannot find pending device authorization")
+			c.JSON(http.StatusNotFound, gin.H{"error": "user code not found or expired"})
+			return
+		}
+		oc.logger.Errorw("REST - GET - GetDeviceAuthorization - cannot find device authorization", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot get device authorization"})
+		return
+	}
+	authorization.UserCode = utils.FormatUserCode(authorization.UserCode)
+	c.JSON(http.StatusOK, authorization)
+}
+
+// PostApproveDeviceAuthorization approves a user code, so its client logs in as the logged profile.
+func (oc *OAuthHandler) PostApproveDeviceAuthorization(c *gin.Context) {
+	oc.logger.Info("REST - POST - PostApproveDeviceAuthorization called")
+	oc.decideDeviceAuthorization(c, models.DeviceAuthorizationApproved)
+}
+
+// PostDenyDeviceAuthorization denies a user code, so its client stops polling with access_denied.
+func (oc *OAuthHandler) PostDenyDeviceAuthorization(c *gin.Context) {
+	oc.logger.Info("REST - POST - PostDenyDeviceAuthorization called")
+	oc.decideDeviceAuthorization(c, models.DeviceAuthorizationDenied)
+}
+
+// ------------------------------ Private methods ------------------------------
+
+func (oc *OAuthHandler) decideDeviceAuthorization(c *gin.Context, status models.DeviceAuthorizationStatus) {
+	userCode, ok := utils.NormalizeUserCode(c.Param("userCode"))
+	if !ok {
+		oc.logger.Error("REST - POST - DeviceAuthorization - wrong format of the path param 'userCode'")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "wrong format of the path param 'userCode'"})
+		return
+	}
+
+	profile, err := utils.GetProfileFromContext(c)
+	if err != nil {
+		oc.logger.Error("REST - POST - DeviceAuthorization - cannot find profile")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "cannot find profile"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+	now := time.Now().UTC()
+
+	// a user code is decided once, by the first user
+	var authorization models.DeviceAuthorization
+	err = oc.collDeviceAuthorizations.FindOneAndUpdate(ctx, bson.M{
+		"userCode":  userCode,
+		"status":    models.DeviceAuthorizationPending,
+		"expiresAt": bson.M{"$gt": now},
+	}, bson.M{
+		"$set": bson.M{"status": status, "profileId": profile.ID, "decidedAt": now},
+	}, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&authorization)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			oc.logger.Error("REST - POST - DeviceAuthorization - cannot find pending device authorization")
+			c.JSON(http.StatusNotFound, gin.H{"error": "user code not found or expired"})
+			return
+		}
+		oc.logger.Errorw("REST - POST - DeviceAuthorization - cannot update device authorization", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot update device authorization"})
+		return
+	}
+
+	oc.logger.Infow("AUDIT - device authorization "+string(status),
+		"profileID", profile.ID.Hex(),
+		"deviceAuthorizationID", authorization.ID.Hex(),
+	)
+	c.JSON(http.StatusOK, gin.H{"message": "device authorization has been " + string(status)})
+}
+
+// exchangeDeviceCode answers a poll of a client with the device code, issuing tokens once approved.
+// Errors are the ones of RFC 8628, section 3.5.
+func (oc *OAuthHandler) exchangeDeviceCode(c *gin.Context, deviceCode string) {
+	if deviceCode == "" {
+		oc.logger.Error("REST - POST - PostDeviceToken - device code not found")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+	now := time.Now().UTC()
+
+	// the previous poll time is returned, to detect clients polling too often
+	var authorization models.DeviceAuthorization
+	err := oc.collDeviceAuthorizations.FindOneAndUpdate(ctx, bson.M{
+		"deviceCodeHash": utils.HashToken(deviceCode),
+	}, bson.M{
+		"$set": bson.M{"lastPolledAt": now},
+	}).Decode(&authorization)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			oc.logger.Error("REST - POST - PostDeviceToken - invalid device code")
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_grant"})
+			return
+		}
+		oc.logger.Errorw("REST - POST - PostDeviceToken - cannot find device authorization", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+		return
+	}
+
+	switch {
+	case now.After(authorization.ExpiresAt):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expired_token"})
+		return
+	case authorization.UsedAt != nil:
+		oc.logger.Errorw("REST - POST - PostDeviceToken - device code already used", "deviceAuthorizationID", authorization.ID.Hex())
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_grant"})
+		return
+	case authorization.Status == models.DeviceAuthorizationDenied:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "access_denied"})
+		return
+	case authorization.Status == models.DeviceAuthorizationPending:
+		interval := time.Duration(authorization.Interval) * time.Second
+		if authorization.LastPolledAt != nil && now.Sub(*authorization.LastPolledAt) < interval {
+			_, err = oc.collDeviceAuthorizations.UpdateOne(ctx, bson.M{"_id": authorization.ID}, bson.M{
+				"$inc": bson.M{"interval": int(deviceCodeSlowDown.Seconds())},
+			})
+			if err != nil {
+				oc.logger.Errorw("REST - POST - PostDeviceToken - cannot increase poll interval", "error", err)
+			}
+			c.JSON(http.StatusBadRequest, gin.H{"error": "slow_down"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "authorization_pending"})
+		return
+	}
+
+	// approved, tokens are issued to the first poll only
+	res, err := oc.collDeviceAuthorizations.UpdateOne(ctx, bson.M{
+		"_id":    authorization.ID,
+		"usedAt": bson.M{"$exists": false},
+	}, bson.M{
+		"$set": bson.M{"usedAt": now},
+	})
+	if err != nil {
+		oc.logger.Errorw("REST - POST - PostDeviceToken - cannot consume device authorization", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+		return
+	}
+	if res.ModifiedCount == 0 || authorization.ProfileID == nil {
+		oc.logger.Errorw("REST - POST - PostDeviceToken - device code already used", "deviceAuthorizationID", authorization.ID.Hex())
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_grant"})
+		return
+	}
+
+	var profile models.Profile
+	err = oc.collProfiles.FindOne(ctx, bson.M{"_id": *authorization.ProfileID}).Decode(&profile)
+	if err == nil && profile.IsSuspended() {
+		err = authpkg.ErrProfileSuspended
+	}
+	if err != nil {
+		oc.logger.Errorw("REST - POST - PostDeviceToken - profile not found", "profileID", authorization.ProfileID.Hex(), "error", err)
+		if errors.Is(err, authpkg.ErrProfileSuspended) {
+			oc.audit.recordLogin(c, *authorization.ProfileID, authpkg.RefreshTokenClientDevice, err)
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_grant"})
+		return
+	}
+
+	accessToken, refreshToken, expirationTime, err := authpkg.IssueGitHubLoginResult(
+		ctx,
+		oc.collRefreshTokens,
+		profile,
+		oc.jwtKeys,
+		authpkg.DeviceTokenTTL,
+		authpkg.DeviceRefreshTokenTTL,
+		authpkg.RefreshTokenClientDevice,
+	)
+	if err != nil {
+		oc.logger.Errorw("REST - POST - PostDeviceToken - cannot create tokens", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+		return
+	}
+
+	oc.logger.Infow("AUDIT - device tokens issued via device code",
+		"profileID", profile.ID.Hex(),
+		"deviceAuthorizationID", authorization.ID.Hex(),
+		"expiry", expirationTime,
+	)
+	oc.audit.recordLogin(c, profile.ID, authpkg.RefreshTokenClientDevice, nil)
+	c.JSON(http.StatusOK, DeviceTokenResp{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(authpkg.DeviceTokenTTL.Seconds()),
+		RefreshToken: refreshToken,
+	})
+}
+
+// refreshDeviceToken issues a new access token to a headless client, rotating its refresh token.
+func (oc *OAuthHandler) refreshDeviceToken(c *gin.Context, rawRefreshToken string) {
+	if rawRefreshToken == "" {
+		oc.logger.Error("REST - POST - PostDeviceToken - refresh token not found")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	defer cancel()
+
+	tokenRecord, profile, err := oc.validateRefreshToken(ctx, rawRefreshToken, authpkg.RefreshTokenClientDevice)
+	if err != nil {
+		if errors.Is(err, errRefreshTokenNotFound) || errors.Is(err, errRefreshTokenReuse) || errors.Is(err, errRefreshTokenExpired) ||
+			errors.Is(err, errRefreshTokenProfileNotFound) || errors.Is(err, errRefreshTokenProfileSuspended) {
+			oc.logger.Errorw("REST - POST - PostDeviceToken - invalid refresh token", "error", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_grant"})
+			return
+		}
+		oc.logger.Errorw("REST - POST - PostDeviceToken - cannot validate refresh token", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+		return
+	}
+
+	expirationTime := time.Now().UTC().Add(authpkg.DeviceTokenTTL)
+	accessToken, err := utils.CreateJWT(profile, expirationTime, utils.AccessToken, authpkg.RefreshTokenClientDevice, tokenRecord.FamilyID, oc.jwtKeys)
+	if err != nil {
+		oc.logger.Error("REST - POST - PostDeviceToken - cannot generate access JWT")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+		return
+	}
+
+	newRefreshToken, err := oc.rotateStoredRefreshToken(ctx, tokenRecord, authpkg.DeviceRefreshTokenTTL)
+	if err != nil {
+		if errors.Is(err, errRefreshTokenReuse) {
+			oc.logger.Error("REST - POST - PostDeviceToken - refresh token reuse detected during rotation")
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_grant"})
+			return
+		}
+		oc.logger.Errorw("REST - POST - PostDeviceToken - cannot rotate refresh token", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+		return
+	}
+
+	oc.logger.Infow("AUDIT - device access token refreshed",
+		"profileID", profile.ID.Hex(),
+		"expiry", expirationTime,
+	)
+	c.JSON(http.StatusOK, DeviceTokenResp{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(authpkg.DeviceTokenTTL.Seconds()),
+		RefreshToken: newRefreshToken,
+	})
+}
+
+// buildDeviceVerificationURI returns the page of the web app to approve user codes.
+// The web app is served at the origin of the web OAuth callback, like /postlogin.
+func buildDeviceVerificationURI(webCallbackURL string) string {
+	callbackURL, err := url.Parse(webCallbackURL)
+	if err != nil || callbackURL.Host == "" {
+		return deviceVerificationPath
+	}
+	verificationURL := url.URL{Scheme: callbackURL.Scheme, Host: callbackURL.Host, Path: deviceVerificationPath}
+	return verificationURL.String()
+}
@@ -3,6 +3,7 @@ package api
 import (
 	authpkg "api-server/auth"
 	"api-server/db"
+	"api-server/models"
 	"api-server/utils"
 	"context"
 	"crypto/subtle"
@@ -18,153 +19,222 @@ import (
 	"go.uber.org/zap"
 )
 
+// GitHubWebHandler logs in the web app with GitHub or any other configured identity provider.
 type GitHubWebHandler struct {
 	collProfiles              *mongo.Collection
 	auth                      *authpkg.Auth
 	logger                    *zap.SugaredLogger
 	sessionStateName          string
 	sessionGitHubVerifierName string
-	httpClient                *http.Client
+	sessionProviderName       string
+	sessionNonceName          string
+	sessionLinkName           string
+	audit                     *AuditLog
 }
 
-func NewGitHubWebHandler(auth *authpkg.Auth, logger *zap.SugaredLogger, client *mongo.Client, sessionStateName, sessionPKCEName string) *GitHubWebHandler {
+func NewGitHubWebHandler(auth *authpkg.Auth, logger *zap.SugaredLogger, client *mongo.Client, audit *AuditLog, sessionStateName, sessionPKCEName string) *GitHubWebHandler {
 	return &GitHubWebHandler{
 		collProfiles:              db.GetCollections(client).Profiles,
 		auth:                      auth,
 		logger:                    logger,
 		sessionStateName:          sessionStateName,
 		sessionGitHubVerifierName: sessionPKCEName,
-		httpClient: &http.Client{
-			Timeout: 10 * time.Second,
-		},
+		sessionProviderName:       sessionStateName + "_provider",
+		sessionNonceName:          sessionStateName + "_nonce",
+		sessionLinkName:           sessionStateName + "_link",
+		audit:                     audit,
 	}
 }
 
+// GitHubLogin starts the login with GitHub
 func (gh *GitHubWebHandler) GitHubLogin(c *gin.Context) {
 	gh.logger.Info("REST - GET - GitHubLogin called")
+	gh.login(c, models.IdentityProviderGitHub)
+}
+
+// ProviderLogin starts the login with the provider in path params
+func (gh *GitHubWebHandler) ProviderLogin(c *gin.Context) {
+	gh.logger.Info("REST - GET - ProviderLogin called")
+	gh.login(c, c.Param("provider"))
+}
+
+// GitHubCallback completes the login with GitHub
+func (gh *GitHubWebHandler) GitHubCallback(c *gin.Context) {
+	gh.logger.Info("REST - GET - GitHubCallback called")
+	gh.callback(c, models.IdentityProviderGitHub)
+}
+
+// ProviderCallback completes the login with the provider in path params
+func (gh *GitHubWebHandler) ProviderCallback(c *gin.Context) {
+	gh.logger.Info("REST - GET - ProviderCallback called")
+	gh.callback(c, c.Param("provider"))
+}
+
+// GetProviders returns the names of the identity providers users can log in with,
+// to build login buttons pointing to /api/oauth/providers/:provider/login.
+func (gh *GitHubWebHandler) GetProviders(c *gin.Context) {
+	gh.logger.Info("REST - GET - GetProviders called")
+	c.JSON(http.StatusOK, gin.H{"providers": gh.auth.Providers.Names()})
+}
+
+// ------------------------------ Private methods ------------------------------
+
+func (gh *GitHubWebHandler) login(c *gin.Context, providerName string) {
+	authURL, ok := gh.startAuthorization(c, providerName, "")
+	if !ok {
+		return
+	}
+	gh.logger.Debug("REST - GET - Login - authURL: ", authURL)
+	c.Redirect(http.StatusTemporaryRedirect, authURL)
+}
+
+// startAuthorization saves a new OAuth flow in session and returns the authorization URL of the provider.
+// The callback links the identity to linkProfileID when not empty, otherwise it logs in.
+// On errors, it writes the response and returns false.
+func (gh *GitHubWebHandler) startAuthorization(c *gin.Context, providerName, linkProfileID string) (string, bool) {
+	provider, ok := gh.auth.Providers.Get(providerName)
+	if !ok {
+		gh.logger.Errorf("REST - Login - unknown identity provider %s", providerName)
+		c.JSON(http.StatusNotFound, gin.H{"error": "unknown identity provider"})
+		return "", false
+	}
 
 	session := sessions.Default(c)
 
 	// build state for CSRF protection. Use the RFC 7636 PKCE verifier
 	// maximum length because the value has the same unguessable bearer-secret
-	// property and GitHub echoes it through the OAuth redirect.
+	// property and the provider echoes it through the OAuth redirect.
 	state, err := utils.NewPKCEVerifier()
 	if err != nil {
-		gh.logger.Error("REST - GET - GitHubLogin - cannot create random state token")
+		gh.logger.Error("REST - Login - cannot create random state token")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not initialize oauth flow"})
-		return
+		return "", false
+	}
+	// build nonce, OpenID Connect providers put it in the ID token to bind it to this login
+	nonce, err := utils.NewPKCEVerifier()
+	if err != nil {
+		gh.logger.Error("REST - Login - cannot create random nonce")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not initialize oauth flow"})
+		return "", false
 	}
 
 	// build PKCE plain secret verifier
 	// (it will be used only on our server-side as a verification step)
 	githubVerifier, err := utils.NewPKCEVerifier()
 	if err != nil {
-		gh.logger.Errorw("REST - GET - GitHubLogin - cannot create GitHub PKCE verifier", "error", err)
+		gh.logger.Errorw("REST - Login - cannot create PKCE verifier", "error", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": "could not initialize oauth flow"})
-		return
+		return "", false
 	}
 	// build PKCE codeChallenge from verifier with sha256 and base64 function
-	// This will be used later to send it to GitHub (so we send the hashed version and not the plain verifier code)
+	// This will be used later to send it to the provider (so we send the hashed version and not the plain verifier code)
 	githubCodeChallenge, err := utils.BuildPKCECodeChallenge(githubVerifier)
 	if err != nil {
-		gh.logger.Errorw("REST - GET - GitHubLogin - cannot create GitHub PKCE challenge", "error", err)
+		gh.logger.Errorw("REST - Login - cannot create PKCE challenge", "error", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": "could not initialize oauth flow"})
-		return
+		return "", false
+	}
+
+	// authURL must expose only the S256 challenge. Keep the raw verifier server-side.
+	authURL, err := provider.AuthorizationURL(c.Request.Context(), authpkg.OAuthClientWeb, state, nonce, githubCodeChallenge)
+	if err != nil {
+		gh.logger.Errorw("REST - Login - cannot build authorization URL", "provider", providerName, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not build authURL during oauth flow initialization"})
+		return "", false
 	}
 
-	// store both state and GitHub PKCE verifier in session
+	// store state, nonce, provider and PKCE verifier in session
 	session.Set(gh.sessionStateName, state)
 	session.Set(gh.sessionGitHubVerifierName, githubVerifier)
+	session.Set(gh.sessionProviderName, providerName)
+	session.Set(gh.sessionNonceName, nonce)
+	// always overwrite it, so an abandoned link flow cannot turn a later login into a link
+	session.Set(gh.sessionLinkName, linkProfileID)
 
 	if err = session.Save(); err != nil {
-		gh.logger.Error("REST - GET - GitHubLogin - cannot save session")
+		gh.logger.Error("REST - Login - cannot save session")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not initialize oauth flow"})
-		return
+		return "", false
 	}
-
-	// authURL must expose only the S256 challenge. Keep the raw verifier server-side.
-	authURL, err := authpkg.BuildGitHubAuthorizationURL(authpkg.GitHubOAuthClientWeb, state, githubCodeChallenge)
-	if err != nil {
-		gh.logger.Errorw("REST - GET - GitHubLogin - cannot build authorization URL", "error", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not build authURL during oauth flow initialization"})
-		return
-	}
-
-	gh.logger.Debug("REST - GET - GitHubLogin - authURL: ", authURL)
-	c.Redirect(http.StatusTemporaryRedirect, authURL)
+	return authURL, true
 }
 
-func (gh *GitHubWebHandler) GitHubCallback(c *gin.Context) {
-	gh.auth.Logger.Info("REST - GET - GitHubCallback called")
-
+func (gh *GitHubWebHandler) callback(c *gin.Context, providerName string) {
 	session := sessions.Default(c)
 	defer func() {
 		session.Delete(gh.sessionStateName)
 		session.Delete(gh.sessionGitHubVerifierName)
+		session.Delete(gh.sessionProviderName)
+		session.Delete(gh.sessionNonceName)
+		session.Delete(gh.sessionLinkName)
 		if err := session.Save(); err != nil {
-			gh.logger.Warnw("GitHubCallback - cannot clear oauth session", "error", err)
+			gh.logger.Warnw("Callback - cannot clear oauth session", "error", err)
 		}
 	}()
 
 	// extract state (for CSRF protection)
 	queryState := strings.TrimSpace(c.Query("state"))
-	// extract code: a one-time authorization code from GitHub, used to get a GitHub access token.
+	// extract code: a one-time authorization code from the provider, used to get its tokens.
 	queryCode := strings.TrimSpace(c.Query("code"))
 	if queryState == "" || queryCode == "" {
-		gh.logger.Error("REST - GET - GitHubCallback - missing either state or code callback parameters")
+		gh.logger.Error("REST - GET - Callback - missing either state or code callback parameters")
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid oauth callback"})
 		return
 	}
 
-	// check if state and PKCE verifier are in session
+	// check if state, PKCE verifier, provider and nonce are in session
 	sessionState, _ := session.Get(gh.sessionStateName).(string)
 	githubVerifier, _ := session.Get(gh.sessionGitHubVerifierName).(string)
-	if sessionState == "" || !utils.IsValidPKCEVerifier(githubVerifier) {
-		gh.logger.Error("REST - GET - GitHubCallback - oauth session is missing or expired")
+	sessionProvider, _ := session.Get(gh.sessionProviderName).(string)
+	nonce, _ := session.Get(gh.sessionNonceName).(string)
+	linkProfileID, _ := session.Get(gh.sessionLinkName).(string)
+	if sessionState == "" || !utils.IsValidPKCEVerifier(githubVerifier) || sessionProvider == "" || nonce == "" {
+		gh.logger.Error("REST - GET - Callback - oauth session is missing or expired")
 		c.JSON(http.StatusBadRequest, gin.H{"error": "oauth session is missing or expired"})
 		return
 	}
 
 	// state must be = to the one in session
 	if subtle.ConstantTimeCompare([]byte(queryState), []byte(sessionState)) != 1 {
-		gh.logger.Error("REST - GET - GitHubCallback - oauth state verification failed")
+		gh.logger.Error("REST - GET - Callback - oauth state verification failed")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid oauth callback"})
+		return
+	}
+	// the code must come from the provider the login started with
+	provider, ok := gh.auth.Providers.Get(providerName)
+	if !ok || sessionProvider != providerName {
+		gh.logger.Errorf("REST - GET - Callback - callback of provider %s, but login started with %s", providerName, sessionProvider)
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid oauth callback"})
 		return
 	}
 
-	// 10s timeout, so the GitHub token exchange and profile request cannot pin the request indefinitely.
+	// 10s timeout, so the token exchange and profile request cannot pin the request indefinitely.
 	// This is not really required because the timeout is already 10s, but in this way it's more explicit.
 	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
 	defer cancel()
 
-	// get GitHub access token passing both:
+	// get the identity of the user passing:
 	// - one-time code
-	// - PKCE plain verifier (the plain string, because GitHub will do the sha256 and base64 to compare it)
-	githubAccessToken, err := authpkg.ExchangeGitHubCodeForAccessToken(
-		ctx,
-		gh.httpClient,
-		authpkg.GitHubOAuthClientWeb,
-		queryCode,
-		githubVerifier,
-	)
+	// - PKCE plain verifier (the plain string, because the provider will do the sha256 and base64 to compare it)
+	// - nonce, that must be in the ID token of OpenID Connect providers
+	identity, err := provider.Identity(ctx, authpkg.OAuthClientWeb, queryCode, githubVerifier, nonce)
 	if err != nil {
-		gh.logger.Errorw("REST - GET - GitHubCallback - github token exchange failed", "error", err)
-		c.JSON(http.StatusBadGateway, gin.H{"error": "github token exchange failed"})
+		gh.logger.Errorw("REST - GET - Callback - login with identity provider failed", "provider", providerName, "error", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "login with identity provider failed"})
 		return
 	}
 
-	// get GitHub profile using the githubAccessToken
-	githubProfile, err := authpkg.FetchGitHubUser(ctx, gh.httpClient, githubAccessToken)
-	if err != nil {
-		gh.logger.Errorw("REST - GET - GitHubCallback - could not load github profile", "error", err)
-		c.JSON(http.StatusBadGateway, gin.H{"error": "could not load github profile"})
+	// the flow started by LinkIdentity links the identity to the logged profile, instead of logging in
+	if linkProfileID != "" {
+		gh.linkIdentity(ctx, c, linkProfileID, identity)
 		return
 	}
 
 	// find existing local profile or create a new one
-	profile, err := authpkg.FindOrCreateGitHubProfile(ctx, gh.logger, gh.collProfiles, githubProfile)
+	profile, err := authpkg.FindOrCreateProfile(ctx, gh.logger, gh.collProfiles, gh.auth.CollUserInvitations, identity)
 	if err != nil {
-		gh.logger.Errorw("REST - GET - GitHubCallback - could not persist user", "error", err)
+		gh.logger.Errorw("REST - GET - Callback - could not persist user", "error", err)
+		gh.audit.recordLogin(c, profile.ID, authpkg.RefreshTokenClientWeb, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not persist user"})
 		return
 	}
@@ -172,7 +242,7 @@ func (gh *GitHubWebHandler) GitHubCallback(c *gin.Context) {
 	session.Set("profileID", profile.ID.Hex())
 	session.Set("githubID", profile.Github.ID)
 	if err = session.Save(); err != nil {
-		gh.auth.Logger.Errorw("REST - GET - GitHubCallback - failed to save profile in session", "error", err)
+		gh.auth.Logger.Errorw("REST - GET - Callback - failed to save profile in session", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not persist user"})
 		return
 	}
@@ -182,13 +252,13 @@ func (gh *GitHubWebHandler) GitHubCallback(c *gin.Context) {
 		ctx,
 		gh.auth.CollRefreshTokens,
 		profile,
-		gh.auth.JwtKey,
+		gh.auth.JWTKeys,
 		authpkg.WebTokenTTL,
 		authpkg.WebRefreshTokenTTL,
 		authpkg.RefreshTokenClientWeb,
 	)
 	if err != nil {
-		gh.auth.Logger.Errorw("REST - GET - GitHubCallback - could not issue web login result", "error", err)
+		gh.auth.Logger.Errorw("REST - GET - Callback - could not issue web login result", "error", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "could not complete login"})
 		return
 	}
@@ -198,8 +268,10 @@ func (gh *GitHubWebHandler) GitHubCallback(c *gin.Context) {
 
 	gh.auth.Logger.Infow("AUDIT - JWT issued (web)",
 		"profileID", profile.ID.Hex(),
+		"provider", providerName,
 		"expiry", expirationTime,
 	)
+	gh.audit.recordLogin(c, profile.ID, authpkg.RefreshTokenClientWeb, nil)
 
 	// The access token is returned in the fragment because the SPA consumes it after /postlogin.
 	location := url.URL{Path: "/postlogin", Fragment: "token=" + accessToken}
@@ -7,6 +7,8 @@ import (
 	"api-server/utils"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/url"
 	"os"
@@ -18,6 +20,8 @@ import (
 	"go.uber.org/zap"
 )
 
+var errOnlineResponse = errors.New("cannot unmarshal JSON response from online remote service")
+
 type onlineResponse struct {
 	UUID        string `json:"uuid"`
 	APIToken    string `json:"apiToken"`
@@ -31,6 +35,7 @@ type Online struct {
 	client          *mongo.Client
 	collDevices     *mongo.Collection
 	collProfiles    *mongo.Collection
+	collHomes       *mongo.Collection
 	logger          *zap.SugaredLogger
 	onlineByUUIDURL string
 }
@@ -44,6 +49,7 @@ func NewOnline(logger *zap.SugaredLogger, client *mongo.Client) *Online {
 		client:          client,
 		collDevices:     db.GetCollections(client).Devices,
 		collProfiles:    db.GetCollections(client).Profiles,
+		collHomes:       db.GetCollections(client).Homes,
 		logger:          logger,
 		onlineByUUIDURL: onlineByUUIDURL,
 	}
@@ -68,9 +74,9 @@ func (o *Online) GetOnline(c *gin.Context) {
 		return
 	}
 
-	// check if device is in profile (device owned by profile)
-	if !utils.Contains(profile.Devices, objectID) {
-		o.logger.Error("REST - GET - GetOnline - this device is not in your profile")
+	// check if device is owned by profile or placed in a home shared with it
+	if _, err = resolveDeviceAccess(c.Request.Context(), o.collProfiles, o.collHomes, &profile, objectID, models.HomeRoleGuest); err != nil {
+		o.logger.Errorf("REST - GET - GetOnline - this device is not in your profile, err = %v", err)
 		c.JSON(http.StatusBadRequest, gin.H{"error": "this device is not in your profile"})
 		return
 	}
@@ -89,38 +95,46 @@ func (o *Online) GetOnline(c *gin.Context) {
 		return
 	}
 
-	if !utils.IsValidUUID(device.UUID) || !utils.IsValidUUID(onlineFeature.UUID) {
-		o.logger.Error("REST - GET - GetOnline - invalid UUID format in device or feature")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cannot get online"})
-		return
-	}
-	path := o.onlineByUUIDURL + url.PathEscape(device.UUID) + "/features/" + url.PathEscape(onlineFeature.UUID)
-	o.logger.Debugf("REST - GET - GetOnline - calling external 'online' service = %s", path)
-	_, result, err := o.onlineByUUIDService(path)
+	response, err := o.readOnline(c.Request.Context(), &device, onlineFeature)
 	if err != nil {
 		o.logger.Errorf("REST - GetOnline - cannot get online from remote service = %#v", err)
 		if re, ok := err.(*customerrors.ErrorWrapper); ok {
 			o.logger.Errorf("REST - GetOnline - cannot get online with status = %d, message = %s\n", re.Code, re.Message)
 		}
+		if errors.Is(err, errOnlineResponse) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Cannot get online response"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cannot get online"})
 		return
 	}
-	o.logger.Debugf("REST - GetOnline - result = %#v", result)
+	c.JSON(http.StatusOK, &response)
+}
+
+// readOnline gets the online status of device from the external 'online' service, until ctx is done.
+func (o *Online) readOnline(ctx context.Context, device *models.Device, onlineFeature *models.Feature) (models.Online, error) {
+	if !utils.IsValidUUID(device.UUID) || !utils.IsValidUUID(onlineFeature.UUID) {
+		return models.Online{}, errors.New("invalid UUID format in device or feature")
+	}
+	path := o.onlineByUUIDURL + url.PathEscape(device.UUID) + "/features/" + url.PathEscape(onlineFeature.UUID)
+	o.logger.Debugf("readOnline - calling external 'online' service = %s", path)
+	_, result, err := o.onlineByUUIDService(ctx, path)
+	if err != nil {
+		return models.Online{}, err
+	}
+	o.logger.Debugf("readOnline - result = %#v", result)
 
 	onlineResp := onlineResponse{}
-	err = json.Unmarshal([]byte(result), &onlineResp)
-	if err != nil {
-		o.logger.Errorf("REST - GetOnline - cannot unmarshal JSON response from online remote service = %#v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Cannot get online response"})
-		return
+	if err = json.Unmarshal([]byte(result), &onlineResp); err != nil {
+		return models.Online{}, fmt.Errorf("%w: %v", errOnlineResponse, err)
 	}
-	o.logger.Debugf("REST - GetOnline - external 'online' service response = %#v", onlineResp)
+	o.logger.Debugf("readOnline - external 'online' service response = %#v", onlineResp)
 
-	response := models.Online{}
-	response.CreatedAt = time.UnixMilli(onlineResp.CreatedAt)
-	response.ModifiedAt = time.UnixMilli(onlineResp.ModifiedAt)
-	response.CurrentTime = time.UnixMilli(onlineResp.CurrentTime)
-	c.JSON(http.StatusOK, &response)
+	return models.Online{
+		CreatedAt:   time.UnixMilli(onlineResp.CreatedAt),
+		ModifiedAt:  time.UnixMilli(onlineResp.ModifiedAt),
+		CurrentTime: time.UnixMilli(onlineResp.CurrentTime),
+	}, nil
 }
 
 func (o *Online) getDevice(ctx context.Context, deviceID bson.ObjectID) (models.Device, error) {
@@ -133,6 +147,6 @@ func (o *Online) getDevice(ctx context.Context, deviceID bson.ObjectID) (models.
 	return device, err
 }
 
-func (o *Online) onlineByUUIDService(urlOnline string) (int, string, error) {
-	return utils.Get(urlOnline)
+func (o *Online) onlineByUUIDService(ctx context.Context, urlOnline string) (int, string, error) {
+	return utils.GetWithContext(ctx, urlOnline)
 }
@@ -0,0 +1,217 @@
+package api
+
+import (
+	"api-server/db"
+	"api-server/models"
+	"api-server/utils"
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"go.uber.org/zap"
+)
+
+// maxPersonalAccessTokensPerProfile limits the unexpired tokens of a profile
+const maxPersonalAccessTokensPerProfile = 20
+
+// PersonalAccessTokenNewReq is the request body to create a personal access token
+type PersonalAccessTokenNewReq struct {
+	Name          string   `json:"name" validate:"required,min=1,max=50"`
+	Scopes        []string `json:"scopes" validate:"required,min=1,unique,dive,oneof=homes:read homes:write devices:read devices:write values:read values:write"`
+	ExpiresInDays int      `json:"expiresInDays" validate:"required,min=1,max=365"`
+}
+
+// PersonalAccessTokenNewRes is a created personal access token, the only response with the token itself
+type PersonalAccessTokenNewRes struct {
+	models.PersonalAccessToken
+	Token string `json:"token"`
+}
+
+// PersonalAccessTokens handles the personal access tokens of the logged profile.
+type PersonalAccessTokens struct {
+	client                   *mongo.Client
+	collPersonalAccessTokens *mongo.Collection
+	logger                   *zap.SugaredLogger
+	validate                 *validator.Validate
+}
+
+// NewPersonalAccessTokens constructs a PersonalAccessTokens handler with the given dependencies.
+func NewPersonalAccessTokens(logger *zap.SugaredLogger, client *mongo.Client, validate *validator.Validate) *PersonalAccessTokens {
+	return &PersonalAccessTokens{
+		client:                   client,
+		collPersonalAccessTokens: db.GetCollections(client).PersonalAccessTokens,
+		logger:                   logger,
+		validate:                 validate,
+	}
+}
+
+// GetPersonalAccessTokens returns the unexpired personal access tokens of the logged profile, newest first.
+func (pt *PersonalAccessTokens) GetPersonalAccessTokens(c *gin.Context) {
+	pt.logger.Info("REST - GET - GetPersonalAccessTokens called")
+
+	profile, err := utils.GetProfileFromContext(c)
+	if err != nil {
+		pt.logger.Error("REST - GET - GetPersonalAccessTokens - cannot find profile")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "cannot find profile"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	cur, err := pt.collPersonalAccessTokens.Find(ctx, bson.M{
+		"profileId": profile.ID,
+		"expiresAt": bson.M{"$gt": time.Now().UTC()},
+	}, options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}}))
+	if err != nil {
+		pt.logger.Errorf("REST - GET - GetPersonalAccessTokens - cannot find personal access tokens, err = %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot get personal access tokens"})
+		return
+	}
+	pats := make([]models.PersonalAccessToken, 0)
+	if err = cur.All(ctx, &pats); err != nil {
+		pt.logger.Errorf("REST - GET - GetPersonalAccessTokens - cannot read personal access tokens, err = %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot get personal access tokens"})
+		return
+	}
+	c.JSON(http.StatusOK, pats)
+}
+
+// PostPersonalAccessToken creates a personal access token for the logged profile.
+// The token is in the response only, because just its hash is stored.
+func (pt *PersonalAccessTokens) PostPersonalAccessToken(c *gin.Context) {
+	pt.logger.Info("REST - POST - PostPersonalAccessToken called")
+
+	var newPATBody PersonalAccessTokenNewReq
+	if err := c.ShouldBindJSON(&newPATBody); err != nil {
+		pt.logger.Errorf("REST - POST - PostPersonalAccessToken - Cannot bind request body. Err = %v\n", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request payload"})
+		return
+	}
+	if err := pt.validate.Struct(newPATBody); err != nil {
+		pt.logger.Errorf("REST - POST - PostPersonalAccessToken - request body is not valid, err %#v", err)
+		var errFields = utils.GetErrorMessage(err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body, these fields are not valid:" + errFields})
+		return
+	}
+
+	profile, err := utils.GetProfileFromContext(c)
+	if err != nil {
+		pt.logger.Error("REST - POST - PostPersonalAccessToken - cannot find profile")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "cannot find profile"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+	now := time.Now().UTC()
+
+	count, err := pt.collPersonalAccessTokens.CountDocuments(ctx, bson.M{
+		"profileId": profile.ID,
+		"expiresAt": bson.M{"$gt": now},
+	})
+	if err != nil {
+		pt.logger.Errorf("REST - POST - PostPersonalAccessToken - cannot count personal access tokens, err = %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot create personal access token"})
+		return
+	}
+	if count >= maxPersonalAccessTokensPerProfile {
+		pt.logger.Errorf("REST - POST - PostPersonalAccessToken - profile %s has too many personal access tokens", profile.ID.Hex())
+		c.JSON(http.StatusConflict, gin.H{"error": "too many personal access tokens, delete one first"})
+		return
+	}
+
+	token, tokenHash, err := newPersonalAccessToken()
+	if err != nil {
+		pt.logger.Errorf("REST - POST - PostPersonalAccessToken - cannot generate personal access token, err = %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot create personal access token"})
+		return
+	}
+	pat := models.PersonalAccessToken{
+		ID:        bson.NewObjectID(),
+		ProfileID: profile.ID,
+		Name:      newPATBody.Name,
+		Scopes:    newPATBody.Scopes,
+		TokenHash: tokenHash,
+		CreatedAt: now,
+		ExpiresAt: now.Add(time.Duration(newPATBody.ExpiresInDays) * 24 * time.Hour),
+	}
+	if _, err = pt.collPersonalAccessTokens.InsertOne(ctx, pat); err != nil {
+		pt.logger.Errorf("REST - POST - PostPersonalAccessToken - cannot save personal access token, err = %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot create personal access token"})
+		return
+	}
+
+	pt.logger.Infow("AUDIT - personal access token created",
+		"profileID", profile.ID.Hex(),
+		"tokenID", pat.ID.Hex(),
+		"scopes", pat.Scopes,
+		"expiresAt", pat.ExpiresAt,
+	)
+	c.JSON(http.StatusOK, PersonalAccessTokenNewRes{PersonalAccessToken: pat, Token: token})
+}
+
+// DeletePersonalAccessToken revokes a personal access token of the logged profile.
+func (pt *PersonalAccessTokens) DeletePersonalAccessToken(c *gin.Context) {
+	pt.logger.Info("REST - DELETE - DeletePersonalAccessToken called")
+
+	tokenID, err := bson.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		pt.logger.Error("REST - DELETE - DeletePersonalAccessToken - wrong format of the path param 'id'")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "wrong format of the path param 'id'"})
+		return
+	}
+
+	profile, err := utils.GetProfileFromContext(c)
+	if err != nil {
+		pt.logger.Error("REST - DELETE - DeletePersonalAccessToken - cannot find profile")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "cannot find profile"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	// tokens of other profiles are reported as missing, to avoid disclosing them
+	res, err := pt.collPersonalAccessTokens.DeleteOne(ctx, bson.M{
+		"_id":       tokenID,
+		"profileId": profile.ID,
+	})
+	if err != nil {
+		pt.logger.Errorf("REST - DELETE - DeletePersonalAccessToken - cannot delete personal access token, err = %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot delete personal access token"})
+		return
+	}
+	if res.DeletedCount == 0 {
+		pt.logger.Errorf("REST - DELETE - DeletePersonalAccessToken - cannot find personal access token with id: %v", tokenID)
+		c.JSON(http.StatusNotFound, gin.H{"error": "personal access token not found"})
+		return
+	}
+
+	pt.logger.Infow("AUDIT - personal access token deleted",
+		"profileID", profile.ID.Hex(),
+		"tokenID", tokenID.Hex(),
+	)
+	c.JSON(http.StatusOK, gin.H{"message": "personal access token has been deleted"})
+}
+
+// ------------------------------ Private methods ------------------------------
+
+// newPersonalAccessToken returns a new token with its hash
+func newPersonalAccessToken() (string, string, error) {
+	secret, err := utils.RandomString(32)
+	if err != nil {
+		return "", "", err
+	}
+	token := models.PersonalAccessTokenPrefix + secret
+	tokenHash, err := utils.HashAPIToken(token)
+	if err != nil {
+		return "", "", err
+	}
+	return token, tokenHash, nil
+}
@@ -0,0 +1,307 @@
+package api
+
+import (
+	"api-server/customerrors"
+	"api-server/db"
+	"api-server/models"
+	"api-server/utils"
+	"context"
+	"errors"
+	"net/url"
+	"os"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"go.mongodb.org/mongo-driver/v2/mongo/writeconcern"
+	"go.uber.org/zap"
+)
+
+// errProfileDeletionNotFound is returned when no profile matches the deletion filter
+var errProfileDeletionNotFound = errors.New("profile to delete not found")
+
+// profileDeletionResult counts what has been removed with a profile.
+// It doesn't contain ids or names, so it can be audited after the profile is gone.
+type profileDeletionResult struct {
+	HomesDeleted   int
+	HomesLeft      int
+	DevicesDeleted int
+}
+
+// profileDeletion deletes profiles with everything they own, both for users deleting their account
+// and for admins deleting users.
+type profileDeletion struct {
+	client          *mongo.Client
+	colls           *db.Collections
+	collSensors     *mongo.Collection
+	collControls    *mongo.Collection
+	logger          *zap.SugaredLogger
+	onlineByUUIDURL string
+}
+
+func newProfileDeletion(logger *zap.SugaredLogger, client *mongo.Client) *profileDeletion {
+	onlineServerURL := os.Getenv("HTTP_ONLINE_SERVER") + ":" + os.Getenv("HTTP_ONLINE_PORT")
+	return &profileDeletion{
+		client:          client,
+		colls:           db.GetCollections(client),
+		collSensors:     client.Database(sensorDbName()).Collection("sensors"),
+		collControls:    client.Database(controllerDbName()).Collection("controllers"),
+		logger:          logger,
+		onlineByUUIDURL: onlineServerURL + os.Getenv("HTTP_ONLINE_API"),
+	}
+}
+
+// deleteProfile deletes the profile matching profileFilter in a transaction, together with:
+// homes it owns, with their invitations, scenes, schedules and rules; its membership of homes shared with it;
+// devices it owns, removed from rooms, scenes, schedules and rules like DeleteDevice does;
+// their documents in the sensors and controllers databases; its tokens, login codes, user invitation and audit events.
+// Feature values and online sensors of the devices are removed after the transaction, logging failures only.
+func (pd *profileDeletion) deleteProfile(ctx context.Context, profileFilter bson.M) (profileDeletionResult, error) {
+	dbSession, err := pd.client.StartSession()
+	if err != nil {
+		return profileDeletionResult{}, err
+	}
+	// Defers ending the session after the transaction is committed or ended
+	defer dbSession.EndSession(context.Background())
+
+	var result profileDeletionResult
+	var devices []models.Device
+	_, err = dbSession.WithTransaction(ctx, func(sessionCtx context.Context) (interface{}, error) {
+		// Official `mongo-driver` documentation state: "callback may be run
+		// multiple times during WithTransaction due to retry attempts, so it must be idempotent."
+		result = profileDeletionResult{}
+		devices = nil
+
+		var profile models.Profile
+		err := pd.colls.Profiles.FindOne(sessionCtx, profileFilter).Decode(&profile)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, errProfileDeletionNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if err = pd.deleteHomes(sessionCtx, &profile, &result); err != nil {
+			return nil, err
+		}
+
+		devices, err = pd.deleteDevices(sessionCtx, &profile)
+		if err != nil {
+			return nil, err
+		}
+		result.DevicesDeleted = len(devices)
+
+		if err = pd.deleteCredentials(sessionCtx, profile.ID); err != nil {
+			return nil, err
+		}
+
+		res, err := pd.colls.Profiles.DeleteOne(sessionCtx, profileFilter)
+		if err != nil {
+			pd.logger.Errorf("deleteProfile - cannot remove profile, err = %#v", err)
+			return nil, err
+		}
+		if res.DeletedCount == 0 {
+			return nil, errProfileDeletionNotFound
+		}
+		return nil, nil
+	}, options.Transaction().SetWriteConcern(writeconcern.Majority()))
+	if err != nil {
+		return profileDeletionResult{}, err
+	}
+
+	// We do this OUTSIDE the transaction because time-series collections cannot be written in transactions
+	// and HTTP requests are side effects that break idempotency if the transaction needs to retry.
+	pd.deleteDeviceSideEffects(ctx, devices)
+	return result, nil
+}
+
+// deleteHomes deletes the homes owned by profile and removes it from the members of the other ones
+func (pd *profileDeletion) deleteHomes(sessionCtx context.Context, profile *models.Profile, result *profileDeletionResult) error {
+	homes, err := findProfileHomes(sessionCtx, pd.colls.Homes, profile)
+	if err != nil {
+		pd.logger.Errorf("deleteProfile - cannot find homes of profile, err = %#v", err)
+		return err
+	}
+	ownedHomeIDs := make([]bson.ObjectID, 0)
+	sharedHomeIDs := make([]bson.ObjectID, 0)
+	for _, home := range homes {
+		role, found := utils.GetHomeRole(&home, profile.ID, profile.Homes)
+		if !found {
+			continue
+		}
+		if role == models.HomeRoleOwner {
+			ownedHomeIDs = append(ownedHomeIDs, home.ID)
+		} else {
+			sharedHomeIDs = append(sharedHomeIDs, home.ID)
+		}
+	}
+
+	if len(ownedHomeIDs) > 0 {
+		ownedFilter := bson.M{"homeId": bson.M{"$in": ownedHomeIDs}}
+		// remove the homes from all profiles they were shared with
+		if _, err = pd.colls.Profiles.UpdateMany(sessionCtx,
+			bson.M{"homes": bson.M{"$in": ownedHomeIDs}},
+			bson.M{"$pull": bson.M{"homes": bson.M{"$in": ownedHomeIDs}}},
+		); err != nil {
+			pd.logger.Errorf("deleteProfile - cannot remove homes from profiles, err = %#v", err)
+			return err
+		}
+		for _, coll := range []*mongo.Collection{
+			pd.colls.HomeInvitations,
+			pd.colls.Scenes,
+			pd.colls.Schedules,
+			pd.colls.ScheduleRuns,
+			pd.colls.Rules,
+			pd.colls.RuleExecutions,
+		} {
+			if _, err = coll.DeleteMany(sessionCtx, ownedFilter); err != nil {
+				pd.logger.Errorf("deleteProfile - cannot remove documents of homes from %s, err = %#v", coll.Name(), err)
+				return err
+			}
+		}
+		if _, err = pd.colls.Homes.DeleteMany(sessionCtx, bson.M{"_id": bson.M{"$in": ownedHomeIDs}}); err != nil {
+			pd.logger.Errorf("deleteProfile - cannot remove homes, err = %#v", err)
+			return err
+		}
+	}
+
+	if len(sharedHomeIDs) > 0 {
+		if _, err = pd.colls.Homes.UpdateMany(sessionCtx,
+			bson.M{"_id": bson.M{"$in": sharedHomeIDs}},
+			bson.M{"$pull": bson.M{"members": bson.M{"profileId": profile.ID}}},
+		); err != nil {
+			pd.logger.Errorf("deleteProfile - cannot remove profile from members of homes, err = %#v", err)
+			return err
+		}
+	}
+
+	// pending invitations sent by the profile to homes of other owners
+	if _, err = pd.colls.HomeInvitations.DeleteMany(sessionCtx, bson.M{"invitedBy": profile.ID}); err != nil {
+		pd.logger.Errorf("deleteProfile - cannot remove invitations sent by profile, err = %#v", err)
+		return err
+	}
+
+	result.HomesDeleted = len(ownedHomeIDs)
+	result.HomesLeft = len(sharedHomeIDs)
+	return nil
+}
+
+// deleteDevices deletes the devices owned by profile, returning them
+func (pd *profileDeletion) deleteDevices(sessionCtx context.Context, profile *models.Profile) ([]models.Device, error) {
+	devices := make([]models.Device, 0)
+	if len(profile.Devices) > 0 {
+		cur, err := pd.colls.Devices.Find(sessionCtx, bson.M{"_id": bson.M{"$in": profile.Devices}})
+		if err != nil {
+			pd.logger.Errorf("deleteProfile - cannot find devices of profile, err = %#v", err)
+			return nil, err
+		}
+		if err = cur.All(sessionCtx, &devices); err != nil {
+			pd.logger.Errorf("deleteProfile - cannot read devices of profile, err = %#v", err)
+			return nil, err
+		}
+	}
+
+	if len(devices) > 0 {
+		deviceIDs := utils.MapSlice(devices, func(device models.Device) bson.ObjectID {
+			return device.ID
+		})
+		inDevices := bson.M{"$in": deviceIDs}
+
+		// remove devices from rooms of every home, including homes of other profiles
+		if _, err := pd.colls.Homes.UpdateMany(sessionCtx,
+			bson.M{"rooms.devices": inDevices},
+			bson.M{"$pull": bson.M{"rooms.$[].devices": inDevices}},
+		); err != nil {
+			pd.logger.Errorf("deleteProfile - cannot remove devices from rooms, err = %#v", err)
+			return nil, err
+		}
+		if _, err := pd.colls.Scenes.UpdateMany(sessionCtx,
+			bson.M{"steps.deviceId": inDevices},
+			bson.M{"$pull": bson.M{"steps": bson.M{"deviceId": inDevices}}},
+		); err != nil {
+			pd.logger.Errorf("deleteProfile - cannot remove devices from scenes, err = %#v", err)
+			return nil, err
+		}
+		if _, err := pd.colls.Schedules.DeleteMany(sessionCtx, bson.M{"deviceId": inDevices}); err != nil {
+			pd.logger.Errorf("deleteProfile - cannot remove schedules of devices, err = %#v", err)
+			return nil, err
+		}
+		if _, err := pd.colls.Rules.DeleteMany(sessionCtx, bson.M{"condition.deviceId": inDevices}); err != nil {
+			pd.logger.Errorf("deleteProfile - cannot remove rules of devices, err = %#v", err)
+			return nil, err
+		}
+		if _, err := pd.colls.Rules.UpdateMany(sessionCtx,
+			bson.M{"actions.deviceId": inDevices},
+			bson.M{"$pull": bson.M{"actions": bson.M{"deviceId": inDevices}}},
+		); err != nil {
+			pd.logger.Errorf("deleteProfile - cannot remove devices from rules, err = %#v", err)
+			return nil, err
+		}
+		if _, err := pd.colls.Devices.DeleteMany(sessionCtx, bson.M{"_id": inDevices}); err != nil {
+			pd.logger.Errorf("deleteProfile - cannot remove devices, err = %#v", err)
+			return nil, err
+		}
+	}
+
+	// devices registered with the apiToken of the profile, the same ones updated by rotateProfileAndDeviceTokens
+	if _, err := pd.collSensors.DeleteMany(sessionCtx, bson.M{"profileOwnerId": profile.ID}); err != nil {
+		pd.logger.Errorf("deleteProfile - cannot remove sensors of profile, err = %#v", err)
+		return nil, err
+	}
+	if _, err := pd.collControls.DeleteMany(sessionCtx, bson.M{"profileOwnerId": profile.ID}); err != nil {
+		pd.logger.Errorf("deleteProfile - cannot remove controllers of profile, err = %#v", err)
+		return nil, err
+	}
+	return devices, nil
+}
+
+// deleteCredentials deletes what allows to act as the profile
+func (pd *profileDeletion) deleteCredentials(sessionCtx context.Context, profileID bson.ObjectID) error {
+	for _, coll := range []*mongo.Collection{
+		pd.colls.RefreshTokens,
+		pd.colls.PersonalAccessTokens,
+		pd.colls.DeviceAuthorizations,
+		pd.colls.AppLoginCodes,
+		pd.colls.UserInvitations,
+	} {
+		if _, err := coll.DeleteMany(sessionCtx, bson.M{"profileId": profileID}); err != nil {
+			pd.logger.Errorf("deleteProfile - cannot remove documents of profile from %s, err = %#v", coll.Name(), err)
+			return err
+		}
+	}
+	// audit events have IPs and user agents of the profile
+	if _, err := pd.colls.AuditEvents.DeleteMany(sessionCtx, bson.M{"actorId": profileID}); err != nil {
+		pd.logger.Errorf("deleteProfile - cannot remove audit events of profile, err = %#v", err)
+		return err
+	}
+	return nil
+}
+
+// deleteDeviceSideEffects removes feature values and online sensors of deleted devices
+func (pd *profileDeletion) deleteDeviceSideEffects(ctx context.Context, devices []models.Device) {
+	if len(devices) == 0 {
+		return
+	}
+	deviceIDs := utils.MapSlice(devices, func(device models.Device) bson.ObjectID {
+		return device.ID
+	})
+	if _, err := pd.colls.FeatureValues.DeleteMany(ctx, bson.M{"meta.deviceId": bson.M{"$in": deviceIDs}}); err != nil {
+		pd.logger.Errorf("deleteProfile - cannot remove feature values of devices, err = %#v", err)
+	}
+
+	for _, device := range devices {
+		if !utils.HasOnlineFeature(device.Features) {
+			continue
+		}
+		if !utils.IsValidUUID(device.UUID) {
+			pd.logger.Errorf("deleteProfile - invalid UUID format: device=%s", device.ID.Hex())
+			continue
+		}
+		if _, _, err := utils.Delete(pd.onlineByUUIDURL + url.PathEscape(device.UUID)); err != nil {
+			pd.logger.Errorf("deleteProfile - cannot delete online from remote service = %#v", err)
+			if re, ok := err.(*customerrors.ErrorWrapper); ok {
+				pd.logger.Errorf("deleteProfile - cannot delete online with status = %d, message = %s\n", re.Code, re.Message)
+			}
+		}
+	}
+}
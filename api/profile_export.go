@@ -0,0 +1,200 @@
+package api
+
+import (
+	"api-server/models"
+	"api-server/utils"
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// profileExportTimeout bounds the generation of an export, value history can be long
+const profileExportTimeout = 5 * time.Minute
+
+// profileExport is the profile in an export, without credentials
+type profileExport struct {
+	ID          bson.ObjectID     `json:"id"`
+	Github      models.GitHub     `json:"github"`
+	Identities  []models.Identity `json:"identities"`
+	Role        string            `json:"role,omitempty"`
+	SuspendedAt *time.Time        `json:"suspendedAt,omitempty"`
+	Homes       []bson.ObjectID   `json:"homes"`
+	Devices     []bson.ObjectID   `json:"devices"`
+	CreatedAt   time.Time         `json:"createdAt"`
+	ModifiedAt  time.Time         `json:"modifiedAt"`
+}
+
+// refreshTokenExport is the metadata of a refresh token in an export, without its hash
+type refreshTokenExport struct {
+	FamilyID   string     `json:"familyId"`
+	ClientType string     `json:"clientType"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	ExpiresAt  time.Time  `json:"expiresAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+	RevokedAt  *time.Time `json:"revokedAt,omitempty"`
+}
+
+// GetProfileExport returns a ZIP archive with a JSON file for every kind of personal data of the logged profile:
+// profile, homes with rooms, devices with features, FCM tokens, sessions (refresh tokens),
+// personal access tokens, audit events and the value history of its devices.
+// Files are streamed from db cursors, so an error after the first byte truncates the archive.
+func (p *Profiles) GetProfileExport(c *gin.Context) {
+	p.logger.Info("REST - GET - GetProfileExport called")
+
+	profile, err := utils.GetLoggedProfileFromContext(c, p.collProfiles)
+	if err != nil {
+		p.logger.Error("REST - GET - GetProfileExport - cannot find profile")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "cannot find profile"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), profileExportTimeout)
+	defer cancel()
+
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", `attachment; filename="home-anthill-export-`+time.Now().UTC().Format("20060102")+`.zip"`)
+	c.Status(http.StatusOK)
+
+	archive := zip.NewWriter(c.Writer)
+	if err = p.writeProfileExport(ctx, archive, &profile); err != nil {
+		p.logger.Errorf("REST - GET - GetProfileExport - cannot write export, err = %v", err)
+		c.Abort()
+		return
+	}
+	if err = archive.Close(); err != nil {
+		p.logger.Errorf("REST - GET - GetProfileExport - cannot close export, err = %v", err)
+		c.Abort()
+		return
+	}
+	p.logger.Infow("AUDIT - profile exported",
+		"profileID", profile.ID.Hex(),
+	)
+}
+
+// ------------------------------ Private methods ------------------------------
+
+func (p *Profiles) writeProfileExport(ctx context.Context, archive *zip.Writer, profile *models.Profile) error {
+	err := writeExportFile(archive, "profile.json", profileExport{
+		ID:          profile.ID,
+		Github:      profile.Github,
+		Identities:  profile.Identities,
+		Role:        profile.Role,
+		SuspendedAt: profile.SuspendedAt,
+		Homes:       profile.Homes,
+		Devices:     profile.Devices,
+		CreatedAt:   profile.CreatedAt,
+		ModifiedAt:  profile.ModifiedAt,
+	})
+	if err != nil {
+		return err
+	}
+	fcmTokens := profile.FCMTokens
+	if fcmTokens == nil {
+		fcmTokens = []models.FCMToken{}
+	}
+	if err = writeExportFile(archive, "fcm_tokens.json", fcmTokens); err != nil {
+		return err
+	}
+
+	homeIDs := profile.Homes
+	if homeIDs == nil {
+		homeIDs = []bson.ObjectID{}
+	}
+	deviceIDs := profile.Devices
+	if deviceIDs == nil {
+		deviceIDs = []bson.ObjectID{}
+	}
+
+	cur, err := p.collHomes.Find(ctx, bson.M{
+		"$or": bson.A{
+			bson.M{"_id": bson.M{"$in": homeIDs}},
+			bson.M{"members.profileId": profile.ID},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if err = writeExportCursor(ctx, archive, "homes.json", cur, func(home models.Home) any { return home }); err != nil {
+		return err
+	}
+
+	cur, err = p.collDevices.Find(ctx, bson.M{"_id": bson.M{"$in": deviceIDs}})
+	if err != nil {
+		return err
+	}
+	if err = writeExportCursor(ctx, archive, "devices.json", cur, func(device models.Device) any { return device }); err != nil {
+		return err
+	}
+
+	cur, err = p.collRefreshTokens.Find(ctx, bson.M{"profileId": profile.ID},
+		options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}}))
+	if err != nil {
+		return err
+	}
+	err = writeExportCursor(ctx, archive, "sessions.json", cur, func(token models.RefreshToken) any {
+		return refreshTokenExport{
+			FamilyID:   token.FamilyID,
+			ClientType: token.ClientType,
+			CreatedAt:  token.CreatedAt,
+			ExpiresAt:  token.ExpiresAt,
+			LastUsedAt: token.LastUsedAt,
+			RevokedAt:  token.RevokedAt,
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	cur, err = p.collPATs.Find(ctx, bson.M{"profileId": profile.ID},
+		options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}}))
+	if err != nil {
+		return err
+	}
+	err = writeExportCursor(ctx, archive, "personal_access_tokens.json", cur, func(pat models.PersonalAccessToken) any { return pat })
+	if err != nil {
+		return err
+	}
+
+	cur, err = p.collAuditEvents.Find(ctx, bson.M{"actorId": profile.ID},
+		options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return err
+	}
+	err = writeExportCursor(ctx, archive, "audit_events.json", cur, func(event models.AuditEvent) any { return event })
+	if err != nil {
+		return err
+	}
+
+	cur, err = p.collFeatureValues.Find(ctx, bson.M{"meta.deviceId": bson.M{"$in": deviceIDs}},
+		options.Find().SetSort(bson.D{{Key: "timestamp", Value: 1}}))
+	if err != nil {
+		return err
+	}
+	return writeExportCursor(ctx, archive, "feature_values.json", cur, func(value models.FeatureValue) any { return value })
+}
+
+// writeExportFile adds a JSON file with data to archive
+func writeExportFile(archive *zip.Writer, name string, data any) error {
+	w, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	return json.NewEncoder(w).Encode(data)
+}
+
+// writeExportCursor adds a JSON file to archive with the documents of cur, streaming them
+func writeExportCursor[T any](ctx context.Context, archive *zip.Writer, name string, cur *mongo.Cursor, convert func(T) any) error {
+	w, err := archive.Create(name)
+	if err != nil {
+		cur.Close(ctx)
+		return err
+	}
+	return utils.WriteCursorJSON(ctx, w, cur, convert)
+}
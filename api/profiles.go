@@ -7,6 +7,7 @@ import (
 	"api-server/utils"
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"os"
 	"time"
@@ -19,6 +20,20 @@ import (
 	"go.uber.org/zap"
 )
 
+// profileDeletionTokenTTL is how long a deletion token can confirm the deletion of a profile
+const profileDeletionTokenTTL = 5 * time.Minute
+
+// ProfileDeletionTokenRes is a token to confirm the deletion of the logged profile
+type ProfileDeletionTokenRes struct {
+	DeletionToken string    `json:"deletionToken"`
+	ExpiresAt     time.Time `json:"expiresAt"`
+}
+
+// ProfileDeleteReq is the request body to delete the logged profile
+type ProfileDeleteReq struct {
+	DeletionToken string `json:"deletionToken" validate:"required,max=128"`
+}
+
 // ProfileUpdateFCMTokenReq is the request body for updating a profile's FCM token.
 type ProfileUpdateFCMTokenReq struct {
 	FCMToken string `json:"fcmToken" validate:"required,max=512"`
@@ -48,25 +63,39 @@ type Profiles struct {
 	client                  *mongo.Client
 	collProfiles            *mongo.Collection
 	collDevices             *mongo.Collection
+	collHomes               *mongo.Collection
+	collRefreshTokens       *mongo.Collection
+	collPATs                *mongo.Collection
+	collFeatureValues       *mongo.Collection
+	collAuditEvents         *mongo.Collection
 	collSensors             *mongo.Collection
 	collControls            *mongo.Collection
 	onlineKeepAliveURL      string
 	onlineRotateAPITokenURL string
+	deletion                *profileDeletion
+	audit                   *AuditLog
 	logger                  *zap.SugaredLogger
 	validate                *validator.Validate
 }
 
 // NewProfiles constructs a Profiles handler with the given dependencies.
-func NewProfiles(logger *zap.SugaredLogger, client *mongo.Client, validate *validator.Validate) *Profiles {
+func NewProfiles(logger *zap.SugaredLogger, client *mongo.Client, validate *validator.Validate, audit *AuditLog) *Profiles {
 	onlineServerURL := os.Getenv("HTTP_ONLINE_SERVER") + ":" + os.Getenv("HTTP_ONLINE_PORT")
 	return &Profiles{
 		client:                  client,
 		collProfiles:            db.GetCollections(client).Profiles,
 		collDevices:             db.GetCollections(client).Devices,
+		collHomes:               db.GetCollections(client).Homes,
+		collRefreshTokens:       db.GetCollections(client).RefreshTokens,
+		collPATs:                db.GetCollections(client).PersonalAccessTokens,
+		collFeatureValues:       db.GetCollections(client).FeatureValues,
+		collAuditEvents:         db.GetCollections(client).AuditEvents,
 		collSensors:             client.Database(sensorDbName()).Collection("sensors"),
 		collControls:            client.Database(controllerDbName()).Collection("controllers"),
 		onlineKeepAliveURL:      onlineServerURL + os.Getenv("HTTP_ONLINE_KEEPALIVE_API"),
 		onlineRotateAPITokenURL: onlineServerURL + os.Getenv("HTTP_ONLINE_ROTATE_APITOKEN_API"),
+		deletion:                newProfileDeletion(logger, client),
+		audit:                   audit,
 		logger:                  logger,
 		validate:                validate,
 	}
@@ -89,9 +118,114 @@ func (p *Profiles) GetProfile(c *gin.Context) {
 	profileRes.CreatedAt = profile.CreatedAt
 	profileRes.ModifiedAt = profile.ModifiedAt
 	profileRes.Github = profile.Github
+	profileRes.Identities = profile.Identities
+	// legacy fields of apps supporting a single token, until they are removed
+	for _, fcmToken := range profile.FCMTokens {
+		if fcmToken.LastSeenAt.After(profileRes.FCMTokenTimestamp) {
+			profileRes.FCMToken = fcmToken.Token
+			profileRes.FCMTokenTimestamp = fcmToken.LastSeenAt
+		}
+	}
 	c.JSON(http.StatusOK, &profileRes)
 }
 
+// PostProfileDeletionToken returns a short-lived token, required by DeleteProfile to confirm the deletion.
+// A new token replaces the previous one.
+func (p *Profiles) PostProfileDeletionToken(c *gin.Context) {
+	p.logger.Info("REST - POST - PostProfileDeletionToken called")
+
+	profile, err := utils.GetProfileFromContext(c)
+	if err != nil {
+		p.logger.Error("REST - POST - PostProfileDeletionToken - cannot find profile")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "cannot find profile"})
+		return
+	}
+
+	deletionToken, err := utils.RandomString(32)
+	if err != nil {
+		p.logger.Errorf("REST - POST - PostProfileDeletionToken - cannot generate deletion token, err = %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot create deletion token"})
+		return
+	}
+	expiresAt := time.Now().UTC().Add(profileDeletionTokenTTL)
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	_, err = p.collProfiles.UpdateOne(ctx, bson.M{
+		"_id": profile.ID,
+	}, bson.M{
+		"$set": bson.M{
+			"deletionTokenHash":      utils.HashToken(deletionToken),
+			"deletionTokenExpiresAt": expiresAt,
+		},
+	})
+	if err != nil {
+		p.logger.Errorf("REST - POST - PostProfileDeletionToken - cannot save deletion token, err = %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot create deletion token"})
+		return
+	}
+	c.JSON(http.StatusOK, ProfileDeletionTokenRes{DeletionToken: deletionToken, ExpiresAt: expiresAt})
+}
+
+// DeleteProfile deletes the logged profile with its homes, devices and tokens, see profileDeletion.
+// It must be confirmed with a token of PostProfileDeletionToken, then the session is cleared.
+func (p *Profiles) DeleteProfile(c *gin.Context) {
+	p.logger.Info("REST - DELETE - DeleteProfile called")
+
+	var deleteBody ProfileDeleteReq
+	if err := c.ShouldBindJSON(&deleteBody); err != nil {
+		p.logger.Errorf("REST - DELETE - DeleteProfile - Cannot bind request body. Err = %v\n", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request payload"})
+		return
+	}
+	if err := p.validate.Struct(deleteBody); err != nil {
+		p.logger.Errorf("REST - DELETE - DeleteProfile - request body is not valid, err %#v", err)
+		var errFields = utils.GetErrorMessage(err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body, these fields are not valid:" + errFields})
+		return
+	}
+
+	profile, err := utils.GetProfileFromContext(c)
+	if err != nil {
+		p.logger.Error("REST - DELETE - DeleteProfile - cannot find profile")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "cannot find profile"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+	defer cancel()
+
+	// the token is checked with the deletion itself, so it can be used only once
+	result, err := p.deletion.deleteProfile(ctx, bson.M{
+		"_id":                    profile.ID,
+		"deletionTokenHash":      utils.HashToken(deleteBody.DeletionToken),
+		"deletionTokenExpiresAt": bson.M{"$gt": time.Now().UTC()},
+	})
+	if errors.Is(err, errProfileDeletionNotFound) {
+		p.logger.Error("REST - DELETE - DeleteProfile - deletion token is not valid or expired")
+		c.JSON(http.StatusForbidden, gin.H{"error": "deletion token is not valid or expired"})
+		return
+	}
+	if err != nil {
+		p.logger.Errorf("REST - DELETE - DeleteProfile - cannot delete profile in transaction, err = %#v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot delete profile"})
+		return
+	}
+
+	if err = clearWebSession(c); err != nil {
+		p.logger.Errorw("REST - DELETE - DeleteProfile - cannot clear session", "error", err)
+	}
+
+	// the profile doesn't exist anymore, so the record has no ids or names to keep personal data
+	p.logger.Infow("AUDIT - profile deleted",
+		"homesDeleted", result.HomesDeleted,
+		"homesLeft", result.HomesLeft,
+		"devicesDeleted", result.DevicesDeleted,
+	)
+	c.JSON(http.StatusOK, gin.H{"message": "profile has been deleted"})
+}
+
 // PostRotateAPIToken regenerates the API token for the logged-in profile.
 func (p *Profiles) PostRotateAPIToken(c *gin.Context) {
 	p.logger.Info("REST - POST - PostRotateAPIToken called")
@@ -164,6 +298,13 @@ func (p *Profiles) PostRotateAPIToken(c *gin.Context) {
 	p.logger.Infow("AUDIT - API token regenerated",
 		"profileID", profileSession.ID.Hex(),
 	)
+	p.audit.record(c, models.AuditEvent{
+		ActorID:    profileSession.ID,
+		Action:     models.AuditActionAPITokenRotated,
+		TargetType: models.AuditTargetProfile,
+		TargetID:   profileSession.ID.Hex(),
+		Outcome:    models.AuditOutcomeSuccess,
+	})
 	c.JSON(http.StatusOK, gin.H{"apiToken": newAPIToken})
 }
 
@@ -272,7 +413,8 @@ func controllerDbName() string {
 }
 
 // PostProfilesFCMToken function to store the Firebase Cloud Messaging Token
-// this api is unused, because I set FCM Token on profile while calling fcm_token POST API
+// this api is unused, because I set FCM Token on profile while calling fcm_token POST API.
+// Unlike that API, the token is not sent to the online service.
 func (p *Profiles) PostProfilesFCMToken(c *gin.Context) {
 	p.logger.Info("REST - POST - PostProfilesFCMToken called")
 
@@ -314,14 +456,15 @@ func (p *Profiles) PostProfilesFCMToken(c *gin.Context) {
 		return
 	}
 
-	_, err = p.collProfiles.UpdateOne(c.Request.Context(), bson.M{
-		"_id": profileSession.ID,
-	}, bson.M{
-		"$set": bson.M{
-			"fcmToken":   profileUpdateFCMTokenReq.FCMToken,
-			"modifiedAt": time.Now(),
-		},
-	})
+	profile, err := utils.GetLoggedProfileFromContext(c, p.collProfiles)
+	if err != nil {
+		p.logger.Error("REST - POST - PostProfilesFCMToken - cannot find profile in db")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "cannot find profile"})
+		return
+	}
+	now := time.Now()
+	fcmToken := newFCMToken(&profile, InitFCMTokenReq{FCMToken: profileUpdateFCMTokenReq.FCMToken}, now)
+	err = upsertFCMToken(c.Request.Context(), p.collProfiles, profile.ID, fcmToken, now)
 	if err != nil {
 		p.logger.Error("REST - POST - PostProfilesFCMToken - Cannot update profile with fcmToken")
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot set fcmToken"})
@@ -330,5 +473,12 @@ func (p *Profiles) PostProfilesFCMToken(c *gin.Context) {
 	p.logger.Infow("AUDIT - FCM token updated on profile",
 		"profileID", profileSession.ID.Hex(),
 	)
+	p.audit.record(c, models.AuditEvent{
+		ActorID:    profileSession.ID,
+		Action:     models.AuditActionFCMTokenRegistered,
+		TargetType: models.AuditTargetProfile,
+		TargetID:   profileSession.ID.Hex(),
+		Outcome:    models.AuditOutcomeSuccess,
+	})
 	c.JSON(http.StatusOK, gin.H{"message": "Profile update with FCM Token"})
 }
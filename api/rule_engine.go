@@ -0,0 +1,208 @@
+package api
+
+import (
+	"api-server/db"
+	"api-server/models"
+	"api-server/utils"
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.uber.org/zap"
+)
+
+// ruleEvaluationTimeout bounds the evaluation of rules, that runs in background after values are read or set
+const ruleEvaluationTimeout = 10 * time.Second
+
+// ruleDecision is the result of the evaluation of a rule with a value.
+type ruleDecision struct {
+	matched    bool
+	nextActive bool
+	trigger    bool
+	// why the rule is not triggered
+	reason string
+}
+
+// ruleEngine evaluates rules of homes when new values of their condition features are available.
+type ruleEngine struct {
+	collProfiles       *mongo.Collection
+	collHomes          *mongo.Collection
+	collRules          *mongo.Collection
+	collRuleExecutions *mongo.Collection
+	devicesValues      *DevicesValues
+	logger             *zap.SugaredLogger
+}
+
+func newRuleEngine(logger *zap.SugaredLogger, client *mongo.Client, devicesValues *DevicesValues) *ruleEngine {
+	return &ruleEngine{
+		collProfiles:       db.GetCollections(client).Profiles,
+		collHomes:          db.GetCollections(client).Homes,
+		collRules:          db.GetCollections(client).Rules,
+		collRuleExecutions: db.GetCollections(client).RuleExecutions,
+		devicesValues:      devicesValues,
+		logger:             logger,
+	}
+}
+
+// evaluateAsync evaluates rules in background, so clients don't wait for rule actions.
+func (re *ruleEngine) evaluateAsync(deviceID bson.ObjectID, featureStates []models.DeviceFeatureState) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), ruleEvaluationTimeout)
+		defer cancel()
+		if err := re.evaluate(ctx, deviceID, featureStates); err != nil {
+			re.logger.Errorf("RuleEngine - cannot evaluate rules of device %s, err = %v", deviceID.Hex(), err)
+		}
+	}()
+}
+
+// evaluate updates the state of all enabled rules with a condition on featureStates of deviceID,
+// executing the actions of the triggered ones.
+func (re *ruleEngine) evaluate(ctx context.Context, deviceID bson.ObjectID, featureStates []models.DeviceFeatureState) error {
+	values := make(map[string]float64, len(featureStates))
+	for _, featureState := range featureStates {
+		values[featureState.FeatureUUID] = float32ToFloat64(featureState.Value)
+	}
+	featureUUIDs := utils.MapSlice(featureStates, func(featureState models.DeviceFeatureState) string {
+		return featureState.FeatureUUID
+	})
+
+	cur, err := re.collRules.Find(ctx, bson.M{
+		"enabled":               true,
+		"condition.deviceId":    deviceID,
+		"condition.featureUuid": bson.M{"$in": featureUUIDs},
+	})
+	if err != nil {
+		return err
+	}
+	var rules []models.Rule
+	if err = cur.All(ctx, &rules); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, rule := range rules {
+		value := values[rule.Condition.FeatureUUID]
+		decision := decideRule(&rule, value, now)
+		if !decision.trigger {
+			if decision.nextActive != rule.Active {
+				// re-arm the rule, the update is skipped if another replica changed its state in the meantime
+				_, err = re.collRules.UpdateOne(ctx, bson.M{"_id": rule.ID, "active": rule.Active},
+					bson.M{"$set": bson.M{"active": decision.nextActive}})
+				if err != nil {
+					re.logger.Errorf("RuleEngine - cannot update state of rule %s, err = %v", rule.ID.Hex(), err)
+				}
+			}
+			continue
+		}
+		claimed, errClaim := re.claimRule(ctx, &rule, now)
+		if errClaim != nil {
+			re.logger.Errorf("RuleEngine - cannot claim rule %s, err = %v", rule.ID.Hex(), errClaim)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+		execution := re.executeRule(ctx, &rule, value, now)
+		if _, err = re.collRuleExecutions.InsertOne(ctx, execution); err != nil {
+			re.logger.Errorf("RuleEngine - cannot record execution of rule %s, err = %v", rule.ID.Hex(), err)
+		}
+		re.logger.Infow("AUDIT - rule executed",
+			"profileID", rule.CreatedBy.Hex(),
+			"homeID", rule.HomeID.Hex(),
+			"ruleID", rule.ID.Hex(),
+			"success", execution.Success,
+		)
+	}
+	return nil
+}
+
+// claimRule marks rule as triggered, only if its state hasn't been changed by someone else
+// since it was read, so concurrent evaluations execute its actions only once.
+func (re *ruleEngine) claimRule(ctx context.Context, rule *models.Rule, now time.Time) (bool, error) {
+	filter := bson.M{"_id": rule.ID, "enabled": true, "active": false}
+	if rule.LastTriggeredAt != nil {
+		filter["lastTriggeredAt"] = *rule.LastTriggeredAt
+	} else {
+		filter["lastTriggeredAt"] = bson.M{"$exists": false}
+	}
+	result, err := re.collRules.UpdateOne(ctx, filter, bson.M{
+		"$set": bson.M{"active": true, "lastTriggeredAt": now},
+	})
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount > 0, nil
+}
+
+// executeRule sends values of every action on behalf of the profile that created the rule.
+// A failing action doesn't stop the others.
+func (re *ruleEngine) executeRule(ctx context.Context, rule *models.Rule, value float64, now time.Time) models.RuleExecution {
+	execution := models.RuleExecution{
+		ID:           bson.NewObjectID(),
+		RuleID:       rule.ID,
+		HomeID:       rule.HomeID,
+		TriggerValue: value,
+		Results:      make([]models.RuleActionResult, 0, len(rule.Actions)),
+		ExecutedAt:   now,
+	}
+	failAll := func(message string) models.RuleExecution {
+		for _, action := range rule.Actions {
+			execution.Results = append(execution.Results, models.RuleActionResult{DeviceID: action.DeviceID, Error: message})
+		}
+		return execution
+	}
+
+	var creator models.Profile
+	if err := re.collProfiles.FindOne(ctx, bson.M{"_id": rule.CreatedBy}).Decode(&creator); err != nil {
+		re.logger.Errorf("RuleEngine - cannot find creator of rule %s, err = %v", rule.ID.Hex(), err)
+		return failAll("the profile that created the rule doesn't exist anymore")
+	}
+	home, _, err := getHomeWithRole(ctx, re.collHomes, &creator, rule.HomeID)
+	if err != nil {
+		re.logger.Errorf("RuleEngine - creator of rule %s cannot access home, err = %v", rule.ID.Hex(), err)
+		return failAll("the profile that created the rule is not a member of this home anymore")
+	}
+
+	execution.Success = true
+	for _, action := range rule.Actions {
+		result := models.RuleActionResult{DeviceID: action.DeviceID, Success: true}
+		featureStates := make([]models.DeviceFeatureState, 0, len(action.Values))
+		for _, value := range action.Values {
+			value.CreatedAt = now.UnixMilli()
+			value.ModifiedAt = now.UnixMilli()
+			featureStates = append(featureStates, value)
+		}
+		if valuesErr := re.devicesValues.setHomeDeviceValues(ctx, models.AuditEvent{ClientType: models.AuditClientRule}, &creator, &home, action.DeviceID, featureStates); valuesErr != nil {
+			re.logger.Errorf("RuleEngine - cannot execute action of rule %s on device %s, err = %v", rule.ID.Hex(), action.DeviceID.Hex(), valuesErr)
+			result.Success = false
+			result.Error = valuesErr.message
+			execution.Success = false
+		}
+		execution.Results = append(execution.Results, result)
+	}
+	return execution
+}
+
+// decideRule evaluates rule with value at time now, without changing anything.
+func decideRule(rule *models.Rule, value float64, now time.Time) ruleDecision {
+	matched, nextActive := utils.EvaluateRuleCondition(rule.Condition, rule.Active, value)
+	decision := ruleDecision{matched: matched, nextActive: nextActive}
+	switch {
+	case !rule.Enabled:
+		decision.reason = "rule is disabled"
+	case !matched:
+		decision.reason = "condition is not met"
+	case rule.Active:
+		decision.reason = "rule has been already triggered, the value must go back beyond the hysteresis first"
+	case rule.LastTriggeredAt != nil && now.Sub(*rule.LastTriggeredAt) < time.Duration(rule.CooldownSeconds)*time.Second:
+		decision.reason = fmt.Sprintf("rule is in cooldown until %s",
+			rule.LastTriggeredAt.Add(time.Duration(rule.CooldownSeconds)*time.Second).UTC().Format(time.RFC3339))
+		// keep it inactive, so it's triggered after the cooldown if the condition is still met
+		decision.nextActive = false
+	default:
+		decision.trigger = true
+	}
+	return decision
+}
@@ -0,0 +1,570 @@
+package api
+
+import (
+	"api-server/db"
+	"api-server/models"
+	"api-server/utils"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"go.uber.org/zap"
+)
+
+const defaultRuleExecutionsLimit = 20
+const maxRuleExecutionsLimit = 100
+
+// RuleConditionReq is the request body of the condition of a rule.
+type RuleConditionReq struct {
+	DeviceID    string              `json:"deviceId" validate:"required"`
+	FeatureUUID string              `json:"featureUuid" validate:"required"`
+	Operator    models.RuleOperator `json:"operator" validate:"required,oneof=gt gte lt lte eq neq"`
+	Value       float64             `json:"value"`
+	Hysteresis  float64             `json:"hysteresis" validate:"min=0"`
+}
+
+// RuleActionReq is the request body of an action of a rule.
+type RuleActionReq struct {
+	DeviceID string                      `json:"deviceId" validate:"required"`
+	Values   []models.DeviceFeatureState `json:"values" validate:"required,min=1,max=50,dive"`
+}
+
+// RuleReq is the request body for creating or updating a rule.
+type RuleReq struct {
+	Name            string           `json:"name" validate:"required,min=1,max=50"`
+	Enabled         bool             `json:"enabled"`
+	Condition       RuleConditionReq `json:"condition" validate:"required"`
+	Actions         []RuleActionReq  `json:"actions" validate:"required,min=1,max=20,dive"`
+	CooldownSeconds int              `json:"cooldownSeconds" validate:"min=0,max=86400"`
+}
+
+// RuleActionError describes why an action of a rule is not valid.
+type RuleActionError struct {
+	DeviceID string              `json:"deviceId"`
+	Error    string              `json:"error"`
+	Features []FeatureValueError `json:"features,omitempty"`
+}
+
+// RuleDryRunReq is the optional request body of a dry-run. Without a value,
+// the last recorded value of the condition feature is used.
+type RuleDryRunReq struct {
+	Value *float64 `json:"value"`
+}
+
+// RuleDryRunResp reports what would happen evaluating a rule, without executing its actions.
+type RuleDryRunResp struct {
+	RuleID bson.ObjectID `json:"ruleId"`
+	Value  float64       `json:"value"`
+	// "request" or "history"
+	ValueSource  string              `json:"valueSource"`
+	Matched      bool                `json:"matched"`
+	WouldTrigger bool                `json:"wouldTrigger"`
+	Reason       string              `json:"reason,omitempty"`
+	Actions      []models.RuleAction `json:"actions"`
+}
+
+// Rules handles automations of homes, that set values to devices when a feature value meets a condition.
+type Rules struct {
+	client             *mongo.Client
+	collProfiles       *mongo.Collection
+	collHomes          *mongo.Collection
+	collRules          *mongo.Collection
+	collRuleExecutions *mongo.Collection
+	collFeatureValues  *mongo.Collection
+	devicesValues      *DevicesValues
+	logger             *zap.SugaredLogger
+	validate           *validator.Validate
+}
+
+// NewRules constructs a Rules handler with the given dependencies.
+func NewRules(logger *zap.SugaredLogger, client *mongo.Client, validate *validator.Validate, devicesValues *DevicesValues) *Rules {
+	return &Rules{
+		client:             client,
+		collProfiles:       db.GetCollections(client).Profiles,
+		collHomes:          db.GetCollections(client).Homes,
+		collRules:          db.GetCollections(client).Rules,
+		collRuleExecutions: db.GetCollections(client).RuleExecutions,
+		collFeatureValues:  db.GetCollections(client).FeatureValues,
+		devicesValues:      devicesValues,
+		logger:             logger,
+		validate:           validate,
+	}
+}
+
+// GetRules returns all rules of a home. Every member can read them.
+func (r *Rules) GetRules(c *gin.Context) {
+	r.logger.Info("REST - GET - GetRules called")
+
+	homeID, errID := bson.ObjectIDFromHex(c.Param("id"))
+	if errID != nil {
+		r.logger.Error("REST - GET - GetRules - wrong format of the path param 'id'")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "wrong format of the path param 'id'"})
+		return
+	}
+
+	profile, err := utils.GetLoggedProfileFromContext(c, r.collProfiles)
+	if err != nil {
+		r.logger.Error("REST - GET - GetRules - cannot find profile")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "cannot find profile"})
+		return
+	}
+	if _, _, err = getHomeWithRole(c.Request.Context(), r.collHomes, &profile, homeID); err != nil {
+		r.logger.Errorf("REST - GET - GetRules - cannot access home, err = %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cannot get rules of an home that is not in your profile"})
+		return
+	}
+
+	cur, err := r.collRules.Find(c.Request.Context(), bson.M{"homeId": homeID})
+	if err != nil {
+		r.logger.Errorf("REST - GET - GetRules - cannot find rules, err = %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot get rules"})
+		return
+	}
+	defer cur.Close(c.Request.Context())
+
+	rules := make([]models.Rule, 0)
+	if err = cur.All(c.Request.Context(), &rules); err != nil {
+		r.logger.Errorf("REST - GET - GetRules - cannot decode rules, err = %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot get rules"})
+		return
+	}
+	c.JSON(http.StatusOK, rules)
+}
+
+// PostRule creates a rule in a home. Condition and actions are validated against features of their devices.
+func (r *Rules) PostRule(c *gin.Context) {
+	r.logger.Info("REST - POST - PostRule called")
+
+	homeID, errID := bson.ObjectIDFromHex(c.Param("id"))
+	if errID != nil {
+		r.logger.Error("REST - POST - PostRule - wrong format of the path param 'id'")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "wrong format of the path param 'id'"})
+		return
+	}
+
+	input, ok := r.bindRuleReq(c, homeID, "PostRule")
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	rule := input.rule
+	rule.ID = bson.NewObjectID()
+	rule.CreatedBy = input.profile.ID
+	rule.CreatedAt = now
+	rule.ModifiedAt = now
+	if _, err := r.collRules.InsertOne(c.Request.Context(), rule); err != nil {
+		r.logger.Errorf("REST - POST - PostRule - cannot insert rule, err = %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot create rule"})
+		return
+	}
+
+	r.logger.Infow("AUDIT - rule created",
+		"profileID", input.profile.ID.Hex(),
+		"homeID", homeID.Hex(),
+		"ruleID", rule.ID.Hex(),
+	)
+	c.JSON(http.StatusOK, rule)
+}
+
+// PutRule replaces a rule. Its state is reset, so it can be triggered again by the next value.
+func (r *Rules) PutRule(c *gin.Context) {
+	r.logger.Info("REST - PUT - PutRule called")
+
+	homeID, errID := bson.ObjectIDFromHex(c.Param("id"))
+	ruleID, errRid := bson.ObjectIDFromHex(c.Param("rid"))
+	if errID != nil || errRid != nil {
+		r.logger.Error("REST - PUT - PutRule - wrong format of one of the path params")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "wrong format of one of the path params"})
+		return
+	}
+
+	input, ok := r.bindRuleReq(c, homeID, "PutRule")
+	if !ok {
+		return
+	}
+
+	var rule models.Rule
+	err := r.collRules.FindOneAndUpdate(c.Request.Context(), bson.M{
+		"_id":    ruleID,
+		"homeId": homeID,
+	}, bson.M{
+		"$set": bson.M{
+			"name":            input.rule.Name,
+			"enabled":         input.rule.Enabled,
+			"condition":       input.rule.Condition,
+			"actions":         input.rule.Actions,
+			"cooldownSeconds": input.rule.CooldownSeconds,
+			"active":          false,
+			"modifiedAt":      time.Now(),
+		},
+	}, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&rule)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			r.logger.Errorf("REST - PUT - PutRule - cannot find rule with id: %v", ruleID)
+			c.JSON(http.StatusNotFound, gin.H{"error": "rule not found"})
+			return
+		}
+		r.logger.Errorf("REST - PUT - PutRule - cannot update rule, err = %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot update rule"})
+		return
+	}
+
+	r.logger.Infow("AUDIT - rule updated",
+		"profileID", input.profile.ID.Hex(),
+		"homeID", homeID.Hex(),
+		"ruleID", rule.ID.Hex(),
+	)
+	c.JSON(http.StatusOK, rule)
+}
+
+// DeleteRule removes a rule and its executions from a home.
+func (r *Rules) DeleteRule(c *gin.Context) {
+	r.logger.Info("REST - DELETE - DeleteRule called")
+
+	homeID, errID := bson.ObjectIDFromHex(c.Param("id"))
+	ruleID, errRid := bson.ObjectIDFromHex(c.Param("rid"))
+	if errID != nil || errRid != nil {
+		r.logger.Error("REST - DELETE - DeleteRule - wrong format of one of the path params")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "wrong format of one of the path params"})
+		return
+	}
+
+	profile, err := utils.GetLoggedProfileFromContext(c, r.collProfiles)
+	if err != nil {
+		r.logger.Error("REST - DELETE - DeleteRule - cannot find profile")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "cannot find profile"})
+		return
+	}
+	_, role, err := getHomeWithRole(c.Request.Context(), r.collHomes, &profile, homeID)
+	if err != nil {
+		r.logger.Errorf("REST - DELETE - DeleteRule - cannot access home, err = %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cannot delete rules of an home that is not in your profile"})
+		return
+	}
+	if !utils.HasHomeRole(role, models.HomeRoleMember) {
+		r.logger.Errorf("REST - DELETE - DeleteRule - role '%s' cannot delete rules", role)
+		c.JSON(http.StatusForbidden, gin.H{"error": "you don't have permission to manage rules of this home"})
+		return
+	}
+
+	result, err := r.collRules.DeleteOne(c.Request.Context(), bson.M{
+		"_id":    ruleID,
+		"homeId": homeID,
+	})
+	if err != nil {
+		r.logger.Errorf("REST - DELETE - DeleteRule - cannot delete rule, err = %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot delete rule"})
+		return
+	}
+	if result.DeletedCount == 0 {
+		r.logger.Errorf("REST - DELETE - DeleteRule - cannot find rule with id: %v", ruleID)
+		c.JSON(http.StatusNotFound, gin.H{"error": "rule not found"})
+		return
+	}
+	// executions would be removed anyway by their TTL index
+	if _, err = r.collRuleExecutions.DeleteMany(c.Request.Context(), bson.M{"ruleId": ruleID}); err != nil {
+		r.logger.Errorf("REST - DELETE - DeleteRule - cannot delete executions of rule, err = %v", err)
+	}
+
+	r.logger.Infow("AUDIT - rule deleted",
+		"profileID", profile.ID.Hex(),
+		"homeID", homeID.Hex(),
+		"ruleID", ruleID.Hex(),
+	)
+	c.JSON(http.StatusOK, gin.H{"message": "rule has been deleted"})
+}
+
+// PostDryRunRule evaluates a rule with a value, reporting if it would be triggered.
+// Neither the state of the rule is changed nor its actions are executed.
+func (r *Rules) PostDryRunRule(c *gin.Context) {
+	r.logger.Info("REST - POST - PostDryRunRule called")
+
+	homeID, errID := bson.ObjectIDFromHex(c.Param("id"))
+	ruleID, errRid := bson.ObjectIDFromHex(c.Param("rid"))
+	if errID != nil || errRid != nil {
+		r.logger.Error("REST - POST - PostDryRunRule - wrong format of one of the path params")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "wrong format of one of the path params"})
+		return
+	}
+	var dryRunReq RuleDryRunReq
+	// the body is optional
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&dryRunReq); err != nil {
+			r.logger.Errorf("REST - POST - PostDryRunRule - Cannot bind request body, err = %v", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request payload"})
+			return
+		}
+	}
+
+	profile, err := utils.GetLoggedProfileFromContext(c, r.collProfiles)
+	if err != nil {
+		r.logger.Error("REST - POST - PostDryRunRule - cannot find profile")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "cannot find profile"})
+		return
+	}
+	if _, _, err = getHomeWithRole(c.Request.Context(), r.collHomes, &profile, homeID); err != nil {
+		r.logger.Errorf("REST - POST - PostDryRunRule - cannot access home, err = %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cannot get rules of an home that is not in your profile"})
+		return
+	}
+	var rule models.Rule
+	if err = r.collRules.FindOne(c.Request.Context(), bson.M{"_id": ruleID, "homeId": homeID}).Decode(&rule); err != nil {
+		r.logger.Errorf("REST - POST - PostDryRunRule - cannot find rule, err = %v", err)
+		c.JSON(http.StatusNotFound, gin.H{"error": "rule not found"})
+		return
+	}
+
+	resp := RuleDryRunResp{
+		RuleID:  rule.ID,
+		Actions: rule.Actions,
+	}
+	if dryRunReq.Value != nil {
+		resp.Value = *dryRunReq.Value
+		resp.ValueSource = "request"
+	} else {
+		var lastValue models.FeatureValue
+		err = r.collFeatureValues.FindOne(c.Request.Context(), bson.M{
+			"meta.deviceId":    rule.Condition.DeviceID,
+			"meta.featureUuid": rule.Condition.FeatureUUID,
+		}, options.FindOne().SetSort(bson.D{{Key: "timestamp", Value: -1}})).Decode(&lastValue)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				r.logger.Error("REST - POST - PostDryRunRule - no values recorded for the condition feature")
+				c.JSON(http.StatusNotFound, gin.H{"error": "no values recorded for the condition feature, send a value to evaluate"})
+				return
+			}
+			r.logger.Errorf("REST - POST - PostDryRunRule - cannot find last value, err = %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot evaluate rule"})
+			return
+		}
+		resp.Value = lastValue.Value
+		resp.ValueSource = "history"
+	}
+
+	decision := decideRule(&rule, resp.Value, time.Now())
+	resp.Matched = decision.matched
+	resp.WouldTrigger = decision.trigger
+	resp.Reason = decision.reason
+	c.JSON(http.StatusOK, resp)
+}
+
+// GetRuleExecutions returns the latest executions of a rule, from the most recent one.
+// Query param `limit` is the max number of executions (default 20, max 100).
+func (r *Rules) GetRuleExecutions(c *gin.Context) {
+	r.logger.Info("REST - GET - GetRuleExecutions called")
+
+	homeID, errID := bson.ObjectIDFromHex(c.Param("id"))
+	ruleID, errRid := bson.ObjectIDFromHex(c.Param("rid"))
+	if errID != nil || errRid != nil {
+		r.logger.Error("REST - GET - GetRuleExecutions - wrong format of one of the path params")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "wrong format of one of the path params"})
+		return
+	}
+	limit := defaultRuleExecutionsLimit
+	if rawLimit := c.Query("limit"); rawLimit != "" {
+		parsed, err := strconv.Atoi(rawLimit)
+		if err != nil || parsed <= 0 || parsed > maxRuleExecutionsLimit {
+			r.logger.Errorf("REST - GET - GetRuleExecutions - wrong format of query param 'limit': %s", rawLimit)
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("the query param 'limit' must be a number between 1 and %d", maxRuleExecutionsLimit)})
+			return
+		}
+		limit = parsed
+	}
+
+	profile, err := utils.GetLoggedProfileFromContext(c, r.collProfiles)
+	if err != nil {
+		r.logger.Error("REST - GET - GetRuleExecutions - cannot find profile")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "cannot find profile"})
+		return
+	}
+	if _, _, err = getHomeWithRole(c.Request.Context(), r.collHomes, &profile, homeID); err != nil {
+		r.logger.Errorf("REST - GET - GetRuleExecutions - cannot access home, err = %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cannot get rules of an home that is not in your profile"})
+		return
+	}
+	if err = r.collRules.FindOne(c.Request.Context(), bson.M{"_id": ruleID, "homeId": homeID}).Err(); err != nil {
+		r.logger.Errorf("REST - GET - GetRuleExecutions - cannot find rule, err = %v", err)
+		c.JSON(http.StatusNotFound, gin.H{"error": "rule not found"})
+		return
+	}
+
+	cur, err := r.collRuleExecutions.Find(c.Request.Context(), bson.M{"ruleId": ruleID},
+		options.Find().SetSort(bson.D{{Key: "executedAt", Value: -1}}).SetLimit(int64(limit)))
+	if err != nil {
+		r.logger.Errorf("REST - GET - GetRuleExecutions - cannot find rule executions, err = %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot get rule executions"})
+		return
+	}
+	defer cur.Close(c.Request.Context())
+
+	executions := make([]models.RuleExecution, 0)
+	if err = cur.All(c.Request.Context(), &executions); err != nil {
+		r.logger.Errorf("REST - GET - GetRuleExecutions - cannot decode rule executions, err = %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot get rule executions"})
+		return
+	}
+	c.JSON(http.StatusOK, executions)
+}
+
+// ------------------------------ Private methods ------------------------------
+
+// ruleInput is a validated rule request body, with the profile that sent it.
+type ruleInput struct {
+	profile models.Profile
+	rule    models.Rule
+}
+
+// bindRuleReq binds and validates the request body of a rule for the home with homeID.
+// The logged profile must be at least a member of that home.
+// In case of errors, it writes the response and returns false.
+func (r *Rules) bindRuleReq(c *gin.Context, homeID bson.ObjectID, handlerName string) (ruleInput, bool) {
+	var ruleReq RuleReq
+	if err := c.ShouldBindJSON(&ruleReq); err != nil {
+		r.logger.Errorf("REST - %s - Cannot bind request body, err = %v", handlerName, err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request payload"})
+		return ruleInput{}, false
+	}
+	if err := r.validate.Struct(ruleReq); err != nil {
+		r.logger.Errorf("REST - %s - request body is not valid, err %#v", handlerName, err)
+		var errFields = utils.GetErrorMessage(err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body, these fields are not valid:" + errFields})
+		return ruleInput{}, false
+	}
+
+	profile, err := utils.GetLoggedProfileFromContext(c, r.collProfiles)
+	if err != nil {
+		r.logger.Errorf("REST - %s - cannot find profile", handlerName)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "cannot find profile"})
+		return ruleInput{}, false
+	}
+	home, role, err := getHomeWithRole(c.Request.Context(), r.collHomes, &profile, homeID)
+	if err != nil {
+		r.logger.Errorf("REST - %s - cannot access home, err = %v", handlerName, err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cannot manage rules of an home that is not in your profile"})
+		return ruleInput{}, false
+	}
+	if !utils.HasHomeRole(role, models.HomeRoleMember) {
+		r.logger.Errorf("REST - %s - role '%s' cannot manage rules", handlerName, role)
+		c.JSON(http.StatusForbidden, gin.H{"error": "you don't have permission to manage rules of this home"})
+		return ruleInput{}, false
+	}
+
+	condition, err := r.buildRuleCondition(c.Request.Context(), &home, ruleReq.Condition)
+	if err != nil {
+		r.logger.Errorf("REST - %s - rule condition is not valid, err = %v", handlerName, err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid rule condition, " + err.Error()})
+		return ruleInput{}, false
+	}
+	actions, actionErrors, err := r.buildRuleActions(c.Request.Context(), &home, ruleReq.Actions)
+	if err != nil {
+		r.logger.Errorf("REST - %s - cannot validate rule actions, err = %v", handlerName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot validate rule"})
+		return ruleInput{}, false
+	}
+	if len(actionErrors) > 0 {
+		r.logger.Errorf("REST - %s - rule actions are not valid", handlerName)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid rule actions", "actions": actionErrors})
+		return ruleInput{}, false
+	}
+
+	return ruleInput{
+		profile: profile,
+		rule: models.Rule{
+			HomeID:          home.ID,
+			Name:            ruleReq.Name,
+			Enabled:         ruleReq.Enabled,
+			Condition:       condition,
+			Actions:         actions,
+			CooldownSeconds: ruleReq.CooldownSeconds,
+		},
+	}, true
+}
+
+// buildRuleCondition checks that the condition refers to an enabled feature
+// of a device assigned to a room of home.
+func (r *Rules) buildRuleCondition(ctx context.Context, home *models.Home, conditionReq RuleConditionReq) (models.RuleCondition, error) {
+	deviceID, err := bson.ObjectIDFromHex(conditionReq.DeviceID)
+	if err != nil {
+		return models.RuleCondition{}, fmt.Errorf("wrong format of device id")
+	}
+	if !isDeviceInHome(home, deviceID) {
+		return models.RuleCondition{}, fmt.Errorf("device is not in a room of this home")
+	}
+	device, err := r.devicesValues.getDevice(ctx, deviceID)
+	if err != nil {
+		return models.RuleCondition{}, fmt.Errorf("device not found")
+	}
+	featureFound := false
+	for _, feature := range device.Features {
+		if feature.UUID == conditionReq.FeatureUUID && feature.Enable {
+			featureFound = true
+			break
+		}
+	}
+	if !featureFound {
+		return models.RuleCondition{}, fmt.Errorf("feature not found")
+	}
+	return models.RuleCondition{
+		DeviceID:    deviceID,
+		FeatureUUID: conditionReq.FeatureUUID,
+		Operator:    conditionReq.Operator,
+		Value:       conditionReq.Value,
+		Hysteresis:  conditionReq.Hysteresis,
+	}, nil
+}
+
+// buildRuleActions converts request actions to rule actions, validating their values against
+// the features of the device they refer to. The device must be assigned to a room of home.
+func (r *Rules) buildRuleActions(ctx context.Context, home *models.Home, actionsReq []RuleActionReq) ([]models.RuleAction, []RuleActionError, error) {
+	actions := make([]models.RuleAction, 0, len(actionsReq))
+	actionErrors := make([]RuleActionError, 0)
+	for _, actionReq := range actionsReq {
+		deviceID, err := bson.ObjectIDFromHex(actionReq.DeviceID)
+		if err != nil {
+			actionErrors = append(actionErrors, RuleActionError{DeviceID: actionReq.DeviceID, Error: "wrong format of device id"})
+			continue
+		}
+		if !isDeviceInHome(home, deviceID) {
+			actionErrors = append(actionErrors, RuleActionError{DeviceID: actionReq.DeviceID, Error: "device is not in a room of this home"})
+			continue
+		}
+		device, err := r.devicesValues.getDevice(ctx, deviceID)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				actionErrors = append(actionErrors, RuleActionError{DeviceID: actionReq.DeviceID, Error: "device not found"})
+				continue
+			}
+			return nil, nil, err
+		}
+		// only values are stored, timestamps are set when the rule is executed
+		values := utils.MapSlice(actionReq.Values, func(featureState models.DeviceFeatureState) models.DeviceFeatureState {
+			return models.DeviceFeatureState{
+				FeatureUUID: featureState.FeatureUUID,
+				Type:        featureState.Type,
+				Name:        featureState.Name,
+				Value:       featureState.Value,
+			}
+		})
+		if err = r.devicesValues.validateFeatureStatesForDevice(&device, values); err != nil {
+			actionErr := RuleActionError{DeviceID: actionReq.DeviceID, Error: "invalid device feature"}
+			var valuesErr *featureValuesError
+			if errors.As(err, &valuesErr) {
+				actionErr.Error = "invalid device feature values"
+				actionErr.Features = valuesErr.features
+			}
+			actionErrors = append(actionErrors, actionErr)
+			continue
+		}
+		actions = append(actions, models.RuleAction{DeviceID: deviceID, Values: values})
+	}
+	return actions, actionErrors, nil
+}
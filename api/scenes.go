@@ -0,0 +1,467 @@
+package api
+
+import (
+	"api-server/db"
+	"api-server/models"
+	"api-server/utils"
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"go.uber.org/zap"
+)
+
+// SceneValueReq is a controller value of a scene step.
+type SceneValueReq struct {
+	FeatureUUID string  `json:"featureUuid" validate:"required"`
+	Name        string  `json:"name" validate:"required"`
+	Value       float32 `json:"value" validate:"min=0"`
+}
+
+// SceneStepReq contains the values to set to a device of the home.
+type SceneStepReq struct {
+	DeviceID string          `json:"deviceId" validate:"required"`
+	Values   []SceneValueReq `json:"values" validate:"required,min=1,max=50,dive"`
+}
+
+// SceneReq is the request body for creating or updating a scene.
+type SceneReq struct {
+	Name  string         `json:"name" validate:"required,min=1,max=50"`
+	Steps []SceneStepReq `json:"steps" validate:"required,min=1,max=50,dive"`
+}
+
+// SceneStepError describes why a scene step for a device is not valid or cannot be applied.
+type SceneStepError struct {
+	DeviceID string              `json:"deviceId"`
+	Error    string              `json:"error"`
+	Features []FeatureValueError `json:"features,omitempty"`
+}
+
+// SceneActivationResult is the outcome of a scene step.
+type SceneActivationResult struct {
+	DeviceID bson.ObjectID       `json:"deviceId"`
+	Success  bool                `json:"success"`
+	Error    string              `json:"error,omitempty"`
+	Features []FeatureValueError `json:"features,omitempty"`
+}
+
+// SceneActivationResp is the response body of a scene activation with a result for every device.
+type SceneActivationResp struct {
+	SceneID bson.ObjectID           `json:"sceneId"`
+	Results []SceneActivationResult `json:"results"`
+}
+
+// Scenes handles named presets of controller values and their activation.
+type Scenes struct {
+	client        *mongo.Client
+	collProfiles  *mongo.Collection
+	collHomes     *mongo.Collection
+	collScenes    *mongo.Collection
+	devicesValues *DevicesValues
+	logger        *zap.SugaredLogger
+	validate      *validator.Validate
+}
+
+// NewScenes constructs a Scenes handler with the given dependencies.
+func NewScenes(logger *zap.SugaredLogger, client *mongo.Client, validate *validator.Validate, devicesValues *DevicesValues) *Scenes {
+	return &Scenes{
+		client:        client,
+		collProfiles:  db.GetCollections(client).Profiles,
+		collHomes:     db.GetCollections(client).Homes,
+		collScenes:    db.GetCollections(client).Scenes,
+		devicesValues: devicesValues,
+		logger:        logger,
+		validate:      validate,
+	}
+}
+
+// GetScenes returns all scenes of a home. Every member can read them.
+func (s *Scenes) GetScenes(c *gin.Context) {
+	s.logger.Info("REST - GET - GetScenes called")
+
+	homeID, errID := bson.ObjectIDFromHex(c.Param("id"))
+	if errID != nil {
+		s.logger.Error("REST - GET - GetScenes - wrong format of the path param 'id'")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "wrong format of the path param 'id'"})
+		return
+	}
+
+	profile, err := utils.GetLoggedProfileFromContext(c, s.collProfiles)
+	if err != nil {
+		s.logger.Error("REST - GET - GetScenes - cannot find profile")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "cannot find profile"})
+		return
+	}
+	if _, _, err = getHomeWithRole(c.Request.Context(), s.collHomes, &profile, homeID); err != nil {
+		s.logger.Errorf("REST - GET - GetScenes - cannot access home, err = %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cannot get scenes of an home that is not in your profile"})
+		return
+	}
+
+	cur, err := s.collScenes.Find(c.Request.Context(), bson.M{"homeId": homeID})
+	if err != nil {
+		s.logger.Errorf("REST - GET - GetScenes - cannot find scenes, err = %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot get scenes"})
+		return
+	}
+	defer cur.Close(c.Request.Context())
+
+	scenes := make([]models.Scene, 0)
+	if err = cur.All(c.Request.Context(), &scenes); err != nil {
+		s.logger.Errorf("REST - GET - GetScenes - cannot decode scenes, err = %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot get scenes"})
+		return
+	}
+	c.JSON(http.StatusOK, scenes)
+}
+
+// PostScene creates a scene in a home. Steps are validated against features of every device.
+func (s *Scenes) PostScene(c *gin.Context) {
+	s.logger.Info("REST - POST - PostScene called")
+
+	homeID, errID := bson.ObjectIDFromHex(c.Param("id"))
+	if errID != nil {
+		s.logger.Error("REST - POST - PostScene - wrong format of the path param 'id'")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "wrong format of the path param 'id'"})
+		return
+	}
+
+	input, ok := s.bindSceneReq(c, homeID, "PostScene")
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	scene := models.Scene{
+		ID:         bson.NewObjectID(),
+		HomeID:     input.home.ID,
+		Name:       input.name,
+		Steps:      input.steps,
+		CreatedBy:  input.profile.ID,
+		CreatedAt:  now,
+		ModifiedAt: now,
+	}
+	if _, err := s.collScenes.InsertOne(c.Request.Context(), scene); err != nil {
+		s.logger.Errorf("REST - POST - PostScene - cannot insert scene, err = %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot create scene"})
+		return
+	}
+
+	s.logger.Infow("AUDIT - scene created",
+		"profileID", input.profile.ID.Hex(),
+		"homeID", input.home.ID.Hex(),
+		"sceneID", scene.ID.Hex(),
+	)
+	c.JSON(http.StatusOK, scene)
+}
+
+// PutScene replaces name and steps of a scene.
+func (s *Scenes) PutScene(c *gin.Context) {
+	s.logger.Info("REST - PUT - PutScene called")
+
+	homeID, errID := bson.ObjectIDFromHex(c.Param("id"))
+	sceneID, errSid := bson.ObjectIDFromHex(c.Param("sid"))
+	if errID != nil || errSid != nil {
+		s.logger.Error("REST - PUT - PutScene - wrong format of one of the path params")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "wrong format of one of the path params"})
+		return
+	}
+
+	input, ok := s.bindSceneReq(c, homeID, "PutScene")
+	if !ok {
+		return
+	}
+
+	var scene models.Scene
+	err := s.collScenes.FindOneAndUpdate(c.Request.Context(), bson.M{
+		"_id":    sceneID,
+		"homeId": input.home.ID,
+	}, bson.M{
+		"$set": bson.M{
+			"name":       input.name,
+			"steps":      input.steps,
+			"modifiedAt": time.Now(),
+		},
+	}, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&scene)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			s.logger.Errorf("REST - PUT - PutScene - cannot find scene with id: %v", sceneID)
+			c.JSON(http.StatusNotFound, gin.H{"error": "scene not found"})
+			return
+		}
+		s.logger.Errorf("REST - PUT - PutScene - cannot update scene, err = %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot update scene"})
+		return
+	}
+
+	s.logger.Infow("AUDIT - scene updated",
+		"profileID", input.profile.ID.Hex(),
+		"homeID", input.home.ID.Hex(),
+		"sceneID", scene.ID.Hex(),
+	)
+	c.JSON(http.StatusOK, scene)
+}
+
+// DeleteScene removes a scene from a home.
+func (s *Scenes) DeleteScene(c *gin.Context) {
+	s.logger.Info("REST - DELETE - DeleteScene called")
+
+	homeID, errID := bson.ObjectIDFromHex(c.Param("id"))
+	sceneID, errSid := bson.ObjectIDFromHex(c.Param("sid"))
+	if errID != nil || errSid != nil {
+		s.logger.Error("REST - DELETE - DeleteScene - wrong format of one of the path params")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "wrong format of one of the path params"})
+		return
+	}
+
+	profile, err := utils.GetLoggedProfileFromContext(c, s.collProfiles)
+	if err != nil {
+		s.logger.Error("REST - DELETE - DeleteScene - cannot find profile")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "cannot find profile"})
+		return
+	}
+	_, role, err := getHomeWithRole(c.Request.Context(), s.collHomes, &profile, homeID)
+	if err != nil {
+		s.logger.Errorf("REST - DELETE - DeleteScene - cannot access home, err = %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cannot delete scenes of an home that is not in your profile"})
+		return
+	}
+	if !utils.HasHomeRole(role, models.HomeRoleMember) {
+		s.logger.Errorf("REST - DELETE - DeleteScene - role '%s' cannot delete scenes", role)
+		c.JSON(http.StatusForbidden, gin.H{"error": "you don't have permission to manage scenes of this home"})
+		return
+	}
+
+	result, err := s.collScenes.DeleteOne(c.Request.Context(), bson.M{
+		"_id":    sceneID,
+		"homeId": homeID,
+	})
+	if err != nil {
+		s.logger.Errorf("REST - DELETE - DeleteScene - cannot delete scene, err = %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot delete scene"})
+		return
+	}
+	if result.DeletedCount == 0 {
+		s.logger.Errorf("REST - DELETE - DeleteScene - cannot find scene with id: %v", sceneID)
+		c.JSON(http.StatusNotFound, gin.H{"error": "scene not found"})
+		return
+	}
+
+	s.logger.Infow("AUDIT - scene deleted",
+		"profileID", profile.ID.Hex(),
+		"homeID", homeID.Hex(),
+		"sceneID", sceneID.Hex(),
+	)
+	c.JSON(http.StatusOK, gin.H{"message": "scene has been deleted"})
+}
+
+// PostActivateScene sends the values of every step of a scene to its device.
+// A failure on a device doesn't stop the others, the response reports the result of each device.
+func (s *Scenes) PostActivateScene(c *gin.Context) {
+	s.logger.Info("REST - POST - PostActivateScene called")
+
+	sceneID, errID := bson.ObjectIDFromHex(c.Param("id"))
+	if errID != nil {
+		s.logger.Error("REST - POST - PostActivateScene - wrong format of the path param 'id'")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "wrong format of the path param 'id'"})
+		return
+	}
+
+	profile, err := utils.GetLoggedProfileFromContext(c, s.collProfiles)
+	if err != nil {
+		s.logger.Error("REST - POST - PostActivateScene - cannot find profile")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "cannot find profile"})
+		return
+	}
+
+	var scene models.Scene
+	if err = s.collScenes.FindOne(c.Request.Context(), bson.M{"_id": sceneID}).Decode(&scene); err != nil {
+		s.logger.Errorf("REST - POST - PostActivateScene - cannot find scene, err = %v", err)
+		c.JSON(http.StatusNotFound, gin.H{"error": "scene not found"})
+		return
+	}
+	home, role, err := getHomeWithRole(c.Request.Context(), s.collHomes, &profile, scene.HomeID)
+	if err != nil {
+		// don't reveal that the scene exists
+		s.logger.Errorf("REST - POST - PostActivateScene - cannot access home of the scene, err = %v", err)
+		c.JSON(http.StatusNotFound, gin.H{"error": "scene not found"})
+		return
+	}
+	if !utils.HasHomeRole(role, models.HomeRoleMember) {
+		s.logger.Errorf("REST - POST - PostActivateScene - role '%s' cannot activate scenes", role)
+		c.JSON(http.StatusForbidden, gin.H{"error": "you don't have permission to activate scenes of this home"})
+		return
+	}
+
+	// values set by every step are audited as set by this request
+	source := newRequestAuditEvent(c)
+	results := make([]SceneActivationResult, 0, len(scene.Steps))
+	for _, step := range scene.Steps {
+		results = append(results, s.activateSceneStep(c.Request.Context(), source, &profile, &home, step))
+	}
+
+	s.logger.Infow("AUDIT - scene activated",
+		"profileID", profile.ID.Hex(),
+		"homeID", home.ID.Hex(),
+		"sceneID", scene.ID.Hex(),
+	)
+	c.JSON(http.StatusOK, SceneActivationResp{
+		SceneID: scene.ID,
+		Results: results,
+	})
+}
+
+// ------------------------------ Private methods ------------------------------
+
+// sceneInput is a validated scene request body, with the profile and the home it refers to.
+type sceneInput struct {
+	profile models.Profile
+	home    models.Home
+	name    string
+	steps   []models.SceneStep
+}
+
+// bindSceneReq binds and validates the request body of a scene for the home with homeID.
+// The logged profile must be at least a member of that home.
+// In case of errors, it writes the response and returns false.
+func (s *Scenes) bindSceneReq(c *gin.Context, homeID bson.ObjectID, handlerName string) (sceneInput, bool) {
+	var sceneReq SceneReq
+	if err := c.ShouldBindJSON(&sceneReq); err != nil {
+		s.logger.Errorf("REST - %s - Cannot bind request body, err = %v", handlerName, err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request payload"})
+		return sceneInput{}, false
+	}
+	if err := s.validate.Struct(sceneReq); err != nil {
+		s.logger.Errorf("REST - %s - request body is not valid, err %#v", handlerName, err)
+		var errFields = utils.GetErrorMessage(err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body, these fields are not valid:" + errFields})
+		return sceneInput{}, false
+	}
+
+	profile, err := utils.GetLoggedProfileFromContext(c, s.collProfiles)
+	if err != nil {
+		s.logger.Errorf("REST - %s - cannot find profile", handlerName)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "cannot find profile"})
+		return sceneInput{}, false
+	}
+	home, role, err := getHomeWithRole(c.Request.Context(), s.collHomes, &profile, homeID)
+	if err != nil {
+		s.logger.Errorf("REST - %s - cannot access home, err = %v", handlerName, err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cannot manage scenes of an home that is not in your profile"})
+		return sceneInput{}, false
+	}
+	if !utils.HasHomeRole(role, models.HomeRoleMember) {
+		s.logger.Errorf("REST - %s - role '%s' cannot manage scenes", handlerName, role)
+		c.JSON(http.StatusForbidden, gin.H{"error": "you don't have permission to manage scenes of this home"})
+		return sceneInput{}, false
+	}
+
+	steps, stepErrors, err := s.buildSceneSteps(c.Request.Context(), &home, sceneReq.Steps)
+	if err != nil {
+		s.logger.Errorf("REST - %s - cannot validate scene steps, err = %v", handlerName, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot validate scene"})
+		return sceneInput{}, false
+	}
+	if len(stepErrors) > 0 {
+		s.logger.Errorf("REST - %s - scene steps are not valid", handlerName)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid scene steps", "steps": stepErrors})
+		return sceneInput{}, false
+	}
+
+	return sceneInput{
+		profile: profile,
+		home:    home,
+		name:    sceneReq.Name,
+		steps:   steps,
+	}, true
+}
+
+// buildSceneSteps converts request steps to scene steps, validating each of them against
+// the device it refers to. The device must be assigned to a room of home.
+func (s *Scenes) buildSceneSteps(ctx context.Context, home *models.Home, stepsReq []SceneStepReq) ([]models.SceneStep, []SceneStepError, error) {
+	steps := make([]models.SceneStep, 0, len(stepsReq))
+	stepErrors := make([]SceneStepError, 0)
+	for _, stepReq := range stepsReq {
+		deviceID, err := bson.ObjectIDFromHex(stepReq.DeviceID)
+		if err != nil {
+			stepErrors = append(stepErrors, SceneStepError{DeviceID: stepReq.DeviceID, Error: "wrong format of device id"})
+			continue
+		}
+		if !isDeviceInHome(home, deviceID) {
+			stepErrors = append(stepErrors, SceneStepError{DeviceID: stepReq.DeviceID, Error: "device is not in a room of this home"})
+			continue
+		}
+		if utils.Contains(utils.MapSlice(steps, func(step models.SceneStep) bson.ObjectID { return step.DeviceID }), deviceID) {
+			stepErrors = append(stepErrors, SceneStepError{DeviceID: stepReq.DeviceID, Error: "device is used in more than one step"})
+			continue
+		}
+		device, err := s.devicesValues.getDevice(ctx, deviceID)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				stepErrors = append(stepErrors, SceneStepError{DeviceID: stepReq.DeviceID, Error: "device not found"})
+				continue
+			}
+			return nil, nil, err
+		}
+
+		step := models.SceneStep{
+			DeviceID: deviceID,
+			Values: utils.MapSlice(stepReq.Values, func(valueReq SceneValueReq) models.SceneValue {
+				return models.SceneValue{
+					FeatureUUID: valueReq.FeatureUUID,
+					Name:        valueReq.Name,
+					Value:       valueReq.Value,
+				}
+			}),
+		}
+		if stepErr := s.validateSceneStep(&device, step); stepErr != nil {
+			stepErrors = append(stepErrors, *stepErr)
+			continue
+		}
+		steps = append(steps, step)
+	}
+	return steps, stepErrors, nil
+}
+
+func (s *Scenes) validateSceneStep(device *models.Device, step models.SceneStep) *SceneStepError {
+	err := s.devicesValues.validateFeatureStatesForDevice(device, sceneStepToFeatureStates(step))
+	if err == nil {
+		return nil
+	}
+	stepErr := SceneStepError{DeviceID: step.DeviceID.Hex(), Error: "invalid device feature"}
+	var valuesErr *featureValuesError
+	if errors.As(err, &valuesErr) {
+		stepErr.Error = "invalid device feature values"
+		stepErr.Features = valuesErr.features
+	}
+	return &stepErr
+}
+
+func (s *Scenes) activateSceneStep(ctx context.Context, source models.AuditEvent, profile *models.Profile, home *models.Home, step models.SceneStep) SceneActivationResult {
+	result := SceneActivationResult{DeviceID: step.DeviceID}
+	if valuesErr := s.devicesValues.setHomeDeviceValues(ctx, source, profile, home, step.DeviceID, sceneStepToFeatureStates(step)); valuesErr != nil {
+		s.logger.Errorf("REST - POST - PostActivateScene - cannot set values to device %s, err = %v", step.DeviceID.Hex(), valuesErr)
+		result.Error = valuesErr.message
+		result.Features = valuesErr.features
+		return result
+	}
+	result.Success = true
+	return result
+}
+
+func sceneStepToFeatureStates(step models.SceneStep) []models.DeviceFeatureState {
+	return utils.MapSlice(step.Values, func(value models.SceneValue) models.DeviceFeatureState {
+		return models.DeviceFeatureState{
+			FeatureUUID: value.FeatureUUID,
+			Type:        models.Controller,
+			Name:        value.Name,
+			Value:       value.Value,
+		}
+	})
+}
@@ -0,0 +1,247 @@
+package api
+
+import (
+	"api-server/db"
+	"api-server/models"
+	"context"
+	"errors"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"go.uber.org/zap"
+)
+
+const (
+	scheduleLeaseID        = "schedule_runner"
+	scheduleRunnerInterval = 15 * time.Second
+	// the lease must survive some missed ticks, but another replica has to take over quickly
+	scheduleLeaseTTL = 3 * scheduleRunnerInterval
+	// runs due since more than this are skipped, e.g. when all replicas were down at the scheduled time
+	scheduleMaxDelay     = 10 * time.Minute
+	maxSchedulesPerCycle = 100
+)
+
+// ScheduleRunner executes due schedules. Every api-server replica runs it, but only the one
+// holding the lease document in the leases collection executes schedules.
+type ScheduleRunner struct {
+	collProfiles     *mongo.Collection
+	collHomes        *mongo.Collection
+	collSchedules    *mongo.Collection
+	collScheduleRuns *mongo.Collection
+	collLeases       *mongo.Collection
+	devicesValues    *DevicesValues
+	logger           *zap.SugaredLogger
+	instanceID       string
+}
+
+// NewScheduleRunner constructs a ScheduleRunner with the given dependencies.
+func NewScheduleRunner(logger *zap.SugaredLogger, client *mongo.Client, devicesValues *DevicesValues) *ScheduleRunner {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "api-server"
+	}
+	return &ScheduleRunner{
+		collProfiles:     db.GetCollections(client).Profiles,
+		collHomes:        db.GetCollections(client).Homes,
+		collSchedules:    db.GetCollections(client).Schedules,
+		collScheduleRuns: db.GetCollections(client).ScheduleRuns,
+		collLeases:       db.GetCollections(client).Leases,
+		devicesValues:    devicesValues,
+		logger:           logger,
+		instanceID:       hostname + "-" + uuid.NewString(),
+	}
+}
+
+// Start runs due schedules periodically until ctx is done, then it releases the lease.
+func (sr *ScheduleRunner) Start(ctx context.Context) {
+	sr.logger.Infof("ScheduleRunner - started with instanceID = %s", sr.instanceID)
+	ticker := time.NewTicker(scheduleRunnerInterval)
+	defer ticker.Stop()
+	for {
+		if _, err := sr.RunDueSchedules(ctx, time.Now()); err != nil && ctx.Err() == nil {
+			sr.logger.Errorf("ScheduleRunner - cannot run due schedules, err = %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			sr.releaseLease()
+			sr.logger.Info("ScheduleRunner - stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunDueSchedules executes enabled schedules whose next run is not after now,
+// only if this instance holds the lease. It returns the number of recorded runs.
+func (sr *ScheduleRunner) RunDueSchedules(ctx context.Context, now time.Time) (int, error) {
+	acquired, err := sr.acquireLease(ctx, now)
+	if err != nil || !acquired {
+		return 0, err
+	}
+
+	cur, err := sr.collSchedules.Find(ctx, bson.M{
+		"enabled":   true,
+		"nextRunAt": bson.M{"$lte": now},
+	}, options.Find().SetSort(bson.D{{Key: "nextRunAt", Value: 1}}).SetLimit(maxSchedulesPerCycle))
+	if err != nil {
+		return 0, err
+	}
+	var schedules []models.Schedule
+	if err = cur.All(ctx, &schedules); err != nil {
+		return 0, err
+	}
+
+	runs := 0
+	for _, schedule := range schedules {
+		if ctx.Err() != nil {
+			return runs, ctx.Err()
+		}
+		run, claimed, errRun := sr.runSchedule(ctx, &schedule, now)
+		if errRun != nil {
+			sr.logger.Errorf("ScheduleRunner - cannot run schedule %s, err = %v", schedule.ID.Hex(), errRun)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+		if _, errRun = sr.collScheduleRuns.InsertOne(ctx, run); errRun != nil {
+			sr.logger.Errorf("ScheduleRunner - cannot record run of schedule %s, err = %v", schedule.ID.Hex(), errRun)
+			continue
+		}
+		sr.logger.Infow("AUDIT - schedule run",
+			"profileID", schedule.CreatedBy.Hex(),
+			"homeID", schedule.HomeID.Hex(),
+			"scheduleID", schedule.ID.Hex(),
+			"status", run.Status,
+		)
+		runs++
+	}
+	return runs, nil
+}
+
+// ------------------------------ Private methods ------------------------------
+
+// acquireLease takes or renews the lease of the runner. If another instance holds
+// a lease that is not expired, the upsert fails with a duplicate key error.
+func (sr *ScheduleRunner) acquireLease(ctx context.Context, now time.Time) (bool, error) {
+	_, err := sr.collLeases.UpdateOne(ctx, bson.M{
+		"_id": scheduleLeaseID,
+		"$or": bson.A{
+			bson.M{"owner": sr.instanceID},
+			bson.M{"expiresAt": bson.M{"$lte": now}},
+		},
+	}, bson.M{
+		"$set": bson.M{
+			"owner":     sr.instanceID,
+			"expiresAt": now.Add(scheduleLeaseTTL),
+		},
+	}, options.UpdateOne().SetUpsert(true))
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// releaseLease lets another replica take over immediately, instead of waiting for the lease expiration.
+func (sr *ScheduleRunner) releaseLease() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err := sr.collLeases.DeleteOne(ctx, bson.M{"_id": scheduleLeaseID, "owner": sr.instanceID})
+	if err != nil {
+		sr.logger.Errorf("ScheduleRunner - cannot release lease, err = %v", err)
+	}
+}
+
+// runSchedule claims a due schedule moving its next run forward and then sends its values.
+// The claim is conditional on the current next run, so a schedule is executed only once,
+// even if the lease expired while this instance was still running it.
+// It returns false if the schedule has been claimed or changed by someone else.
+func (sr *ScheduleRunner) runSchedule(ctx context.Context, schedule *models.Schedule, now time.Time) (models.ScheduleRun, bool, error) {
+	scheduledAt := *schedule.NextRunAt
+	run := models.ScheduleRun{
+		ID:          bson.NewObjectID(),
+		ScheduleID:  schedule.ID,
+		HomeID:      schedule.HomeID,
+		DeviceID:    schedule.DeviceID,
+		ScheduledAt: scheduledAt,
+		StartedAt:   time.Now(),
+		RunBy:       sr.instanceID,
+	}
+
+	var home models.Home
+	errHome := sr.collHomes.FindOne(ctx, bson.M{"_id": schedule.HomeID}).Decode(&home)
+	if errHome != nil && !errors.Is(errHome, mongo.ErrNoDocuments) {
+		return run, false, errHome
+	}
+
+	set := bson.M{"lastRunAt": now}
+	update := bson.M{"$set": set}
+	nextRunAt, errNext := nextScheduleRun(schedule.Cron, homeLocation(&home), now)
+	if errHome != nil || errNext != nil {
+		// this schedule cannot run anymore, disable it to avoid failing at every cycle
+		set["enabled"] = false
+		update["$unset"] = bson.M{"nextRunAt": ""}
+	} else {
+		set["nextRunAt"] = nextRunAt
+	}
+	result, err := sr.collSchedules.UpdateOne(ctx, bson.M{
+		"_id":       schedule.ID,
+		"enabled":   true,
+		"nextRunAt": scheduledAt,
+	}, update)
+	if err != nil {
+		return run, false, err
+	}
+	if result.ModifiedCount == 0 {
+		return run, false, nil
+	}
+
+	switch {
+	case errHome != nil:
+		run.Status = models.ScheduleRunFailed
+		run.Error = "home not found, the schedule has been disabled"
+	case errNext != nil:
+		run.Status = models.ScheduleRunFailed
+		run.Error = "invalid schedule, the schedule has been disabled"
+	case now.Sub(scheduledAt) > scheduleMaxDelay:
+		run.Status = models.ScheduleRunSkipped
+		run.Error = "the scheduled time has passed since too long"
+	default:
+		run.Status, run.Error = sr.sendScheduleValues(ctx, schedule, &home)
+	}
+	run.FinishedAt = time.Now()
+	return run, true, nil
+}
+
+// sendScheduleValues sends values of schedule on behalf of the profile that created it.
+func (sr *ScheduleRunner) sendScheduleValues(ctx context.Context, schedule *models.Schedule, home *models.Home) (models.ScheduleRunStatus, string) {
+	var creator models.Profile
+	if err := sr.collProfiles.FindOne(ctx, bson.M{"_id": schedule.CreatedBy}).Decode(&creator); err != nil {
+		sr.logger.Errorf("ScheduleRunner - cannot find creator of schedule %s, err = %v", schedule.ID.Hex(), err)
+		return models.ScheduleRunFailed, "the profile that created the schedule doesn't exist anymore"
+	}
+	if _, _, err := getHomeWithRole(ctx, sr.collHomes, &creator, home.ID); err != nil {
+		sr.logger.Errorf("ScheduleRunner - creator of schedule %s cannot access home, err = %v", schedule.ID.Hex(), err)
+		return models.ScheduleRunFailed, "the profile that created the schedule is not a member of this home anymore"
+	}
+
+	now := time.Now().UnixMilli()
+	featureStates := make([]models.DeviceFeatureState, 0, len(schedule.Values))
+	for _, value := range schedule.Values {
+		value.CreatedAt = now
+		value.ModifiedAt = now
+		featureStates = append(featureStates, value)
+	}
+	if valuesErr := sr.devicesValues.setHomeDeviceValues(ctx, models.AuditEvent{ClientType: models.AuditClientSchedule}, &creator, home, schedule.DeviceID, featureStates); valuesErr != nil {
+		sr.logger.Errorf("ScheduleRunner - cannot set values of schedule %s, err = %v", schedule.ID.Hex(), valuesErr)
+		return models.ScheduleRunFailed, valuesErr.message
+	}
+	return models.ScheduleRunSuccess, ""
+}
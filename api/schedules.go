@@ -0,0 +1,496 @@
+package api
+
+import (
+	"api-server/db"
+	"api-server/models"
+	"api-server/utils"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"go.uber.org/zap"
+)
+
+const defaultScheduleRunsLimit = 20
+const maxScheduleRunsLimit = 100
+
+// WeeklyScheduleReq is the request body of a weekly schedule.
+type WeeklyScheduleReq struct {
+	// 0 = Sunday, 6 = Saturday
+	Days []int `json:"days" validate:"required,min=1,max=7,unique,dive,min=0,max=6"`
+	// as "HH:MM" in the timezone of the home
+	Time string `json:"time" validate:"required,len=5"`
+}
+
+// ScheduleReq is the request body for creating or updating a schedule.
+type ScheduleReq struct {
+	Name     string                      `json:"name" validate:"required,min=1,max=50"`
+	DeviceID string                      `json:"deviceId" validate:"required"`
+	Enabled  bool                        `json:"enabled"`
+	Kind     models.ScheduleKind         `json:"kind" validate:"required,oneof=weekly cron"`
+	Weekly   *WeeklyScheduleReq          `json:"weekly" validate:"required_if=Kind weekly"`
+	Cron     string                      `json:"cron" validate:"required_if=Kind cron,max=100"`
+	Values   []models.DeviceFeatureState `json:"values" validate:"required,min=1,max=50,dive"`
+}
+
+// Schedules handles recurring values of device features. Schedules are executed by ScheduleRunner.
+type Schedules struct {
+	client           *mongo.Client
+	collProfiles     *mongo.Collection
+	collHomes        *mongo.Collection
+	collSchedules    *mongo.Collection
+	collScheduleRuns *mongo.Collection
+	devicesValues    *DevicesValues
+	logger           *zap.SugaredLogger
+	validate         *validator.Validate
+}
+
+// NewSchedules constructs a Schedules handler with the given dependencies.
+func NewSchedules(logger *zap.SugaredLogger, client *mongo.Client, validate *validator.Validate, devicesValues *DevicesValues) *Schedules {
+	return &Schedules{
+		client:           client,
+		collProfiles:     db.GetCollections(client).Profiles,
+		collHomes:        db.GetCollections(client).Homes,
+		collSchedules:    db.GetCollections(client).Schedules,
+		collScheduleRuns: db.GetCollections(client).ScheduleRuns,
+		devicesValues:    devicesValues,
+		logger:           logger,
+		validate:         validate,
+	}
+}
+
+// GetSchedules returns all schedules of a home. Every member can read them.
+func (s *Schedules) GetSchedules(c *gin.Context) {
+	s.logger.Info("REST - GET - GetSchedules called")
+
+	homeID, errID := bson.ObjectIDFromHex(c.Param("id"))
+	if errID != nil {
+		s.logger.Error("REST - GET - GetSchedules - wrong format of the path param 'id'")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "wrong format of the path param 'id'"})
+		return
+	}
+
+	profile, err := utils.GetLoggedProfileFromContext(c, s.collProfiles)
+	if err != nil {
+		s.logger.Error("REST - GET - GetSchedules - cannot find profile")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "cannot find profile"})
+		return
+	}
+	if _, _, err = getHomeWithRole(c.Request.Context(), s.collHomes, &profile, homeID); err != nil {
+		s.logger.Errorf("REST - GET - GetSchedules - cannot access home, err = %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cannot get schedules of an home that is not in your profile"})
+		return
+	}
+
+	cur, err := s.collSchedules.Find(c.Request.Context(), bson.M{"homeId": homeID})
+	if err != nil {
+		s.logger.Errorf("REST - GET - GetSchedules - cannot find schedules, err = %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot get schedules"})
+		return
+	}
+	defer cur.Close(c.Request.Context())
+
+	schedules := make([]models.Schedule, 0)
+	if err = cur.All(c.Request.Context(), &schedules); err != nil {
+		s.logger.Errorf("REST - GET - GetSchedules - cannot decode schedules, err = %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot get schedules"})
+		return
+	}
+	c.JSON(http.StatusOK, schedules)
+}
+
+// PostSchedule creates a schedule for a device of a home. Values are validated against features of the device.
+func (s *Schedules) PostSchedule(c *gin.Context) {
+	s.logger.Info("REST - POST - PostSchedule called")
+
+	homeID, errID := bson.ObjectIDFromHex(c.Param("id"))
+	if errID != nil {
+		s.logger.Error("REST - POST - PostSchedule - wrong format of the path param 'id'")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "wrong format of the path param 'id'"})
+		return
+	}
+
+	input, ok := s.bindScheduleReq(c, homeID, "PostSchedule")
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	schedule := input.schedule
+	schedule.ID = bson.NewObjectID()
+	schedule.CreatedBy = input.profile.ID
+	schedule.CreatedAt = now
+	schedule.ModifiedAt = now
+	if _, err := s.collSchedules.InsertOne(c.Request.Context(), schedule); err != nil {
+		s.logger.Errorf("REST - POST - PostSchedule - cannot insert schedule, err = %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot create schedule"})
+		return
+	}
+
+	s.logger.Infow("AUDIT - schedule created",
+		"profileID", input.profile.ID.Hex(),
+		"homeID", homeID.Hex(),
+		"scheduleID", schedule.ID.Hex(),
+	)
+	c.JSON(http.StatusOK, schedule)
+}
+
+// PutSchedule replaces a schedule. Its next run is computed again from now.
+func (s *Schedules) PutSchedule(c *gin.Context) {
+	s.logger.Info("REST - PUT - PutSchedule called")
+
+	homeID, errID := bson.ObjectIDFromHex(c.Param("id"))
+	scheduleID, errSid := bson.ObjectIDFromHex(c.Param("sid"))
+	if errID != nil || errSid != nil {
+		s.logger.Error("REST - PUT - PutSchedule - wrong format of one of the path params")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "wrong format of one of the path params"})
+		return
+	}
+
+	input, ok := s.bindScheduleReq(c, homeID, "PutSchedule")
+	if !ok {
+		return
+	}
+
+	set := bson.M{
+		"deviceId":   input.schedule.DeviceID,
+		"name":       input.schedule.Name,
+		"enabled":    input.schedule.Enabled,
+		"kind":       input.schedule.Kind,
+		"cron":       input.schedule.Cron,
+		"values":     input.schedule.Values,
+		"modifiedAt": time.Now(),
+	}
+	// optional fields are removed instead of being stored as null
+	unset := bson.M{}
+	if input.schedule.Weekly != nil {
+		set["weekly"] = input.schedule.Weekly
+	} else {
+		unset["weekly"] = ""
+	}
+	if input.schedule.NextRunAt != nil {
+		set["nextRunAt"] = input.schedule.NextRunAt
+	} else {
+		unset["nextRunAt"] = ""
+	}
+	update := bson.M{"$set": set}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+
+	var schedule models.Schedule
+	err := s.collSchedules.FindOneAndUpdate(c.Request.Context(), bson.M{
+		"_id":    scheduleID,
+		"homeId": homeID,
+	}, update, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&schedule)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			s.logger.Errorf("REST - PUT - PutSchedule - cannot find schedule with id: %v", scheduleID)
+			c.JSON(http.StatusNotFound, gin.H{"error": "schedule not found"})
+			return
+		}
+		s.logger.Errorf("REST - PUT - PutSchedule - cannot update schedule, err = %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot update schedule"})
+		return
+	}
+
+	s.logger.Infow("AUDIT - schedule updated",
+		"profileID", input.profile.ID.Hex(),
+		"homeID", homeID.Hex(),
+		"scheduleID", schedule.ID.Hex(),
+	)
+	c.JSON(http.StatusOK, schedule)
+}
+
+// DeleteSchedule removes a schedule and its runs from a home.
+func (s *Schedules) DeleteSchedule(c *gin.Context) {
+	s.logger.Info("REST - DELETE - DeleteSchedule called")
+
+	homeID, errID := bson.ObjectIDFromHex(c.Param("id"))
+	scheduleID, errSid := bson.ObjectIDFromHex(c.Param("sid"))
+	if errID != nil || errSid != nil {
+		s.logger.Error("REST - DELETE - DeleteSchedule - wrong format of one of the path params")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "wrong format of one of the path params"})
+		return
+	}
+
+	profile, err := utils.GetLoggedProfileFromContext(c, s.collProfiles)
+	if err != nil {
+		s.logger.Error("REST - DELETE - DeleteSchedule - cannot find profile")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "cannot find profile"})
+		return
+	}
+	_, role, err := getHomeWithRole(c.Request.Context(), s.collHomes, &profile, homeID)
+	if err != nil {
+		s.logger.Errorf("REST - DELETE - DeleteSchedule - cannot access home, err = %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cannot delete schedules of an home that is not in your profile"})
+		return
+	}
+	if !utils.HasHomeRole(role, models.HomeRoleMember) {
+		s.logger.Errorf("REST - DELETE - DeleteSchedule - role '%s' cannot delete schedules", role)
+		c.JSON(http.StatusForbidden, gin.H{"error": "you don't have permission to manage schedules of this home"})
+		return
+	}
+
+	result, err := s.collSchedules.DeleteOne(c.Request.Context(), bson.M{
+		"_id":    scheduleID,
+		"homeId": homeID,
+	})
+	if err != nil {
+		s.logger.Errorf("REST - DELETE - DeleteSchedule - cannot delete schedule, err = %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot delete schedule"})
+		return
+	}
+	if result.DeletedCount == 0 {
+		s.logger.Errorf("REST - DELETE - DeleteSchedule - cannot find schedule with id: %v", scheduleID)
+		c.JSON(http.StatusNotFound, gin.H{"error": "schedule not found"})
+		return
+	}
+	// runs would be removed anyway by their TTL index
+	if _, err = s.collScheduleRuns.DeleteMany(c.Request.Context(), bson.M{"scheduleId": scheduleID}); err != nil {
+		s.logger.Errorf("REST - DELETE - DeleteSchedule - cannot delete runs of schedule, err = %v", err)
+	}
+
+	s.logger.Infow("AUDIT - schedule deleted",
+		"profileID", profile.ID.Hex(),
+		"homeID", homeID.Hex(),
+		"scheduleID", scheduleID.Hex(),
+	)
+	c.JSON(http.StatusOK, gin.H{"message": "schedule has been deleted"})
+}
+
+// GetScheduleRuns returns the latest runs of a schedule, from the most recent one.
+// Query param `limit` is the max number of runs (default 20, max 100).
+func (s *Schedules) GetScheduleRuns(c *gin.Context) {
+	s.logger.Info("REST - GET - GetScheduleRuns called")
+
+	homeID, errID := bson.ObjectIDFromHex(c.Param("id"))
+	scheduleID, errSid := bson.ObjectIDFromHex(c.Param("sid"))
+	if errID != nil || errSid != nil {
+		s.logger.Error("REST - GET - GetScheduleRuns - wrong format of one of the path params")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "wrong format of one of the path params"})
+		return
+	}
+	limit := defaultScheduleRunsLimit
+	if rawLimit := c.Query("limit"); rawLimit != "" {
+		parsed, err := strconv.Atoi(rawLimit)
+		if err != nil || parsed <= 0 || parsed > maxScheduleRunsLimit {
+			s.logger.Errorf("REST - GET - GetScheduleRuns - wrong format of query param 'limit': %s", rawLimit)
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("the query param 'limit' must be a number between 1 and %d", maxScheduleRunsLimit)})
+			return
+		}
+		limit = parsed
+	}
+
+	profile, err := utils.GetLoggedProfileFromContext(c, s.collProfiles)
+	if err != nil {
+		s.logger.Error("REST - GET - GetScheduleRuns - cannot find profile")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "cannot find profile"})
+		return
+	}
+	if _, _, err = getHomeWithRole(c.Request.Context(), s.collHomes, &profile, homeID); err != nil {
+		s.logger.Errorf("REST - GET - GetScheduleRuns - cannot access home, err = %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cannot get schedules of an home that is not in your profile"})
+		return
+	}
+	err = s.collSchedules.FindOne(c.Request.Context(), bson.M{"_id": scheduleID, "homeId": homeID}).Err()
+	if err != nil {
+		s.logger.Errorf("REST - GET - GetScheduleRuns - cannot find schedule, err = %v", err)
+		c.JSON(http.StatusNotFound, gin.H{"error": "schedule not found"})
+		return
+	}
+
+	cur, err := s.collScheduleRuns.Find(c.Request.Context(), bson.M{"scheduleId": scheduleID},
+		options.Find().SetSort(bson.D{{Key: "startedAt", Value: -1}}).SetLimit(int64(limit)))
+	if err != nil {
+		s.logger.Errorf("REST - GET - GetScheduleRuns - cannot find schedule runs, err = %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot get schedule runs"})
+		return
+	}
+	defer cur.Close(c.Request.Context())
+
+	runs := make([]models.ScheduleRun, 0)
+	if err = cur.All(c.Request.Context(), &runs); err != nil {
+		s.logger.Errorf("REST - GET - GetScheduleRuns - cannot decode schedule runs, err = %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot get schedule runs"})
+		return
+	}
+	c.JSON(http.StatusOK, runs)
+}
+
+// ------------------------------ Private methods ------------------------------
+
+// scheduleInput is a validated schedule request body, with the profile that sent it.
+type scheduleInput struct {
+	profile  models.Profile
+	schedule models.Schedule
+}
+
+// bindScheduleReq binds and validates the request body of a schedule for the home with homeID.
+// The logged profile must be at least a member of that home.
+// In case of errors, it writes the response and returns false.
+func (s *Schedules) bindScheduleReq(c *gin.Context, homeID bson.ObjectID, handlerName string) (scheduleInput, bool) {
+	var scheduleReq ScheduleReq
+	if err := c.ShouldBindJSON(&scheduleReq); err != nil {
+		s.logger.Errorf("REST - %s - Cannot bind request body, err = %v", handlerName, err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request payload"})
+		return scheduleInput{}, false
+	}
+	if err := s.validate.Struct(scheduleReq); err != nil {
+		s.logger.Errorf("REST - %s - request body is not valid, err %#v", handlerName, err)
+		var errFields = utils.GetErrorMessage(err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request body, these fields are not valid:" + errFields})
+		return scheduleInput{}, false
+	}
+	deviceID, err := bson.ObjectIDFromHex(scheduleReq.DeviceID)
+	if err != nil {
+		s.logger.Errorf("REST - %s - wrong format of device id", handlerName)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "wrong format of device id"})
+		return scheduleInput{}, false
+	}
+
+	profile, err := utils.GetLoggedProfileFromContext(c, s.collProfiles)
+	if err != nil {
+		s.logger.Errorf("REST - %s - cannot find profile", handlerName)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "cannot find profile"})
+		return scheduleInput{}, false
+	}
+	home, role, err := getHomeWithRole(c.Request.Context(), s.collHomes, &profile, homeID)
+	if err != nil {
+		s.logger.Errorf("REST - %s - cannot access home, err = %v", handlerName, err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cannot manage schedules of an home that is not in your profile"})
+		return scheduleInput{}, false
+	}
+	if !utils.HasHomeRole(role, models.HomeRoleMember) {
+		s.logger.Errorf("REST - %s - role '%s' cannot manage schedules", handlerName, role)
+		c.JSON(http.StatusForbidden, gin.H{"error": "you don't have permission to manage schedules of this home"})
+		return scheduleInput{}, false
+	}
+
+	schedule := models.Schedule{
+		HomeID:   home.ID,
+		DeviceID: deviceID,
+		Name:     scheduleReq.Name,
+		Enabled:  scheduleReq.Enabled,
+		Kind:     scheduleReq.Kind,
+		Cron:     scheduleReq.Cron,
+		// only values are stored, timestamps are set when the schedule runs
+		Values: utils.MapSlice(scheduleReq.Values, func(featureState models.DeviceFeatureState) models.DeviceFeatureState {
+			return models.DeviceFeatureState{
+				FeatureUUID: featureState.FeatureUUID,
+				Type:        featureState.Type,
+				Name:        featureState.Name,
+				Value:       featureState.Value,
+			}
+		}),
+	}
+	if schedule.Kind == models.ScheduleKindWeekly {
+		schedule.Weekly = &models.WeeklySchedule{
+			Days: scheduleReq.Weekly.Days,
+			Time: scheduleReq.Weekly.Time,
+		}
+		if schedule.Cron, err = utils.WeeklyToCron(schedule.Weekly.Days, schedule.Weekly.Time); err != nil {
+			s.logger.Errorf("REST - %s - invalid weekly schedule, err = %v", handlerName, err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid schedule, " + err.Error()})
+			return scheduleInput{}, false
+		}
+	}
+	nextRunAt, err := nextScheduleRun(schedule.Cron, homeLocation(&home), time.Now())
+	if err != nil {
+		s.logger.Errorf("REST - %s - invalid schedule, err = %v", handlerName, err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid schedule, " + err.Error()})
+		return scheduleInput{}, false
+	}
+	if schedule.Enabled {
+		schedule.NextRunAt = &nextRunAt
+	}
+
+	if !isDeviceInHome(&home, deviceID) {
+		s.logger.Errorf("REST - %s - device is not in a room of this home", handlerName)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "device is not in a room of this home"})
+		return scheduleInput{}, false
+	}
+	device, err := s.devicesValues.getDevice(c.Request.Context(), deviceID)
+	if err != nil {
+		s.logger.Errorf("REST - %s - cannot find device, err = %v", handlerName, err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cannot find device"})
+		return scheduleInput{}, false
+	}
+	if err = s.devicesValues.validateFeatureStatesForDevice(&device, schedule.Values); err != nil {
+		var valuesErr *featureValuesError
+		if errors.As(err, &valuesErr) {
+			s.logger.Errorf("REST - %s - feature values out of spec, err %v", handlerName, err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid device feature values", "features": valuesErr.features})
+			return scheduleInput{}, false
+		}
+		s.logger.Errorf("REST - %s - invalid feature state, err %v", handlerName, err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid device feature"})
+		return scheduleInput{}, false
+	}
+
+	return scheduleInput{
+		profile:  profile,
+		schedule: schedule,
+	}, true
+}
+
+// homeLocation returns the timezone of home, UTC if it isn't defined or valid.
+func homeLocation(home *models.Home) *time.Location {
+	if home.Timezone == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(home.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// nextScheduleRun returns the first time after `after` matching cronExpr in the timezone loc.
+func nextScheduleRun(cronExpr string, loc *time.Location, after time.Time) (time.Time, error) {
+	cronSchedule, err := utils.ParseCron(cronExpr)
+	if err != nil {
+		return time.Time{}, err
+	}
+	next := cronSchedule.Next(after.In(loc))
+	if next.IsZero() {
+		return time.Time{}, fmt.Errorf("cron expression never matches a date")
+	}
+	return next.UTC(), nil
+}
+
+// rescheduleHome computes again the next run of all enabled schedules of a home,
+// because its timezone has been changed.
+func rescheduleHome(ctx context.Context, collSchedules *mongo.Collection, home *models.Home) error {
+	cur, err := collSchedules.Find(ctx, bson.M{"homeId": home.ID, "enabled": true})
+	if err != nil {
+		return err
+	}
+	defer cur.Close(ctx)
+
+	var schedules []models.Schedule
+	if err = cur.All(ctx, &schedules); err != nil {
+		return err
+	}
+	loc := homeLocation(home)
+	now := time.Now()
+	for _, schedule := range schedules {
+		nextRunAt, errNext := nextScheduleRun(schedule.Cron, loc, now)
+		if errNext != nil {
+			return errNext
+		}
+		_, err = collSchedules.UpdateOne(ctx, bson.M{"_id": schedule.ID}, bson.M{"$set": bson.M{"nextRunAt": nextRunAt}})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
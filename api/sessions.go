@@ -0,0 +1,165 @@
+package api
+
+import (
+	"api-server/models"
+	"api-server/utils"
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// GetSessions returns active sessions of the logged profile, most recently used first.
+// The session of the caller has current = true.
+func (oc *OAuthHandler) GetSessions(c *gin.Context) {
+	oc.logger.Info("REST - GET - GetSessions called")
+
+	profile, err := utils.GetProfileFromContext(c)
+	if err != nil {
+		oc.logger.Error("REST - GET - GetSessions - cannot find profile")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "cannot find profile"})
+		return
+	}
+	currentSessionID, err := utils.GetSessionIDFromContext(c)
+	if err != nil {
+		oc.logger.Errorf("REST - GET - GetSessions - cannot read session, err = %v", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "cannot read session"})
+		return
+	}
+
+	sessions, err := oc.findActiveSessions(c.Request.Context(), profile.ID, time.Now().UTC())
+	if err != nil {
+		oc.logger.Errorf("REST - GET - GetSessions - cannot find sessions, err = %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot get sessions"})
+		return
+	}
+	for i := range sessions {
+		sessions[i].Current = sessions[i].FamilyID == currentSessionID
+	}
+	c.JSON(http.StatusOK, sessions)
+}
+
+// DeleteSession revokes a session of the logged profile, so its client cannot refresh its access token anymore.
+// Access tokens already issued to the session remain valid until they expire.
+func (oc *OAuthHandler) DeleteSession(c *gin.Context) {
+	oc.logger.Info("REST - DELETE - DeleteSession called")
+
+	familyID := c.Param("familyId")
+	profile, err := utils.GetProfileFromContext(c)
+	if err != nil {
+		oc.logger.Error("REST - DELETE - DeleteSession - cannot find profile")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "cannot find profile"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+	now := time.Now().UTC()
+
+	// families of other profiles are reported as missing, to avoid disclosing them
+	err = oc.collRefreshTokens.FindOne(ctx, bson.M{
+		"familyId":  familyID,
+		"profileId": profile.ID,
+		"revokedAt": bson.M{"$exists": false},
+		"expiresAt": bson.M{"$gt": now},
+	}).Err()
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			oc.logger.Errorf("REST - DELETE - DeleteSession - cannot find session %s", familyID)
+			c.JSON(http.StatusNotFound, gin.H{"error": "session not found"})
+			return
+		}
+		oc.logger.Errorf("REST - DELETE - DeleteSession - cannot find session, err = %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot revoke session"})
+		return
+	}
+	if err = oc.revokeRefreshTokenFamily(ctx, familyID, now); err != nil {
+		oc.logger.Errorf("REST - DELETE - DeleteSession - cannot revoke refresh token family, err = %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot revoke session"})
+		return
+	}
+
+	oc.logger.Infow("AUDIT - session revoked",
+		"profileID", profile.ID.Hex(),
+		"familyID", familyID,
+	)
+	c.JSON(http.StatusOK, gin.H{"message": "session has been revoked"})
+}
+
+// DeleteOtherSessions revokes all sessions of the logged profile, except the one of the caller,
+// i.e. it logs out everywhere else.
+func (oc *OAuthHandler) DeleteOtherSessions(c *gin.Context) {
+	oc.logger.Info("REST - DELETE - DeleteOtherSessions called")
+
+	profile, err := utils.GetProfileFromContext(c)
+	if err != nil {
+		oc.logger.Error("REST - DELETE - DeleteOtherSessions - cannot find profile")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "cannot find profile"})
+		return
+	}
+	currentSessionID, err := utils.GetSessionIDFromContext(c)
+	if err != nil || currentSessionID == "" {
+		// without the current session, every session would be revoked
+		oc.logger.Error("REST - DELETE - DeleteOtherSessions - cannot find current session")
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cannot find current session, login again"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+	revoked, err := oc.revokeOtherRefreshTokenFamilies(ctx, profile.ID, currentSessionID, time.Now().UTC())
+	if err != nil {
+		oc.logger.Errorf("REST - DELETE - DeleteOtherSessions - cannot revoke refresh tokens, err = %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "cannot revoke sessions"})
+		return
+	}
+
+	oc.logger.Infow("AUDIT - other sessions revoked",
+		"profileID", profile.ID.Hex(),
+		"familyID", currentSessionID,
+		"revokedTokens", revoked,
+	)
+	c.JSON(http.StatusOK, gin.H{"message": "other sessions have been revoked"})
+}
+
+// ------------------------------ Private methods ------------------------------
+
+// findActiveSessions groups refresh tokens of a profile by family, keeping families with a usable token.
+// Rotated tokens have lastUsedAt, so the last use of a family is the latest rotation or its login.
+func (oc *OAuthHandler) findActiveSessions(ctx context.Context, profileID bson.ObjectID, now time.Time) ([]models.Session, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"profileId": profileID}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":        "$familyId",
+			"clientType": bson.M{"$first": "$clientType"},
+			"createdAt":  bson.M{"$min": bson.M{"$ifNull": bson.A{"$familyCreatedAt", "$createdAt"}}},
+			"lastUsedAt": bson.M{"$max": bson.M{"$ifNull": bson.A{"$lastUsedAt", "$createdAt"}}},
+			"expiresAt":  bson.M{"$max": "$expiresAt"},
+			"active": bson.M{"$sum": bson.M{"$cond": bson.A{
+				bson.M{"$and": bson.A{
+					bson.M{"$eq": bson.A{bson.M{"$type": "$revokedAt"}, "missing"}},
+					bson.M{"$gt": bson.A{"$expiresAt", now}},
+				}},
+				1,
+				0,
+			}}},
+		}}},
+		{{Key: "$match", Value: bson.M{"active": bson.M{"$gt": 0}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "lastUsedAt", Value: -1}, {Key: "_id", Value: 1}}}},
+	}
+	cur, err := oc.collRefreshTokens.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	sessions := make([]models.Session, 0)
+	if err = cur.All(ctx, &sessions); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
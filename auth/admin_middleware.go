@@ -0,0 +1,24 @@
+package auth
+
+import (
+	"api-server/models"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// profileRoleKey is the context key of the role of the authenticated profile
+const profileRoleKey = "profile_role"
+
+// AdminMiddleware allows only admins to call the routes. It must follow TokenMiddleware or JWTMiddleware,
+// which read the role of the authenticated profile.
+func (a *Auth) AdminMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString(profileRoleKey) != models.ProfileRoleAdmin {
+			a.Logger.Error("AdminMiddleware - profile is not an admin")
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "admin role required"})
+			return
+		}
+		c.Next()
+	}
+}
@@ -2,9 +2,10 @@ package auth
 
 import (
 	"api-server/db"
+	"api-server/models"
 	"api-server/utils"
+	"context"
 	"errors"
-	"fmt"
 	"net/http"
 	"os"
 	"strings"
@@ -13,7 +14,9 @@ import (
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/v2/bson"
 	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
 	"go.uber.org/zap"
 )
 
@@ -26,26 +29,48 @@ const MobileTokenTTL = 15 * time.Minute
 const MobileRefreshTokenTTL = 7 * 24 * time.Hour
 const MobileAppLoginCodeTTL = 1 * time.Minute
 
+// headless clients, logged in with the device authorization grant.
+// They can be unattended for long, e.g. wall-mounted tablets, so refresh tokens last more.
+const DeviceTokenTTL = 15 * time.Minute
+const DeviceRefreshTokenTTL = 30 * 24 * time.Hour
+const DeviceCodeTTL = 10 * time.Minute
+const DeviceCodePollInterval = 5 * time.Second
+
 // Auth handles JWT token issuance and validation.
 type Auth struct {
 	Logger            *zap.SugaredLogger
-	JwtKey            []byte
+	JWTKeys           *utils.JWTKeySet
 	JwtRefreshKey     []byte
 	CollProfiles      *mongo.Collection
 	CollAppLoginCodes *mongo.Collection
 	CollRefreshTokens *mongo.Collection
+	// CollPersonalAccessTokens are read by TokenMiddleware
+	CollPersonalAccessTokens *mongo.Collection
+	// CollUserInvitations are the emails allowed to sign up
+	CollUserInvitations *mongo.Collection
+	// Providers are the identity providers users can log in with
+	Providers Providers
 }
 
-// NewAuth constructs an Auth using the JWT keys from the environment.
-func NewAuth(logger *zap.SugaredLogger, client *mongo.Client) *Auth {
+// NewAuth constructs an Auth using jwtKeys and the identity providers from the environment.
+// Providers are validated with the environment at startup, so here only GitHub is kept if they are not valid.
+func NewAuth(logger *zap.SugaredLogger, client *mongo.Client, jwtKeys *utils.JWTKeySet) *Auth {
 	colls := db.GetCollections(client)
+	providers, err := LoadProviders()
+	if err != nil {
+		logger.Errorw("NewAuth - cannot load identity providers, only GitHub is available", "error", err)
+		providers = Providers{models.IdentityProviderGitHub: &gitHubProvider{httpClient: &http.Client{Timeout: 10 * time.Second}}}
+	}
 	return &Auth{
-		Logger:            logger,
-		JwtKey:            []byte(os.Getenv("JWT_PASSWORD")),
-		JwtRefreshKey:     []byte(os.Getenv("JWT_REFRESH_PASSWORD")),
-		CollProfiles:      colls.Profiles,
-		CollAppLoginCodes: colls.AppLoginCodes,
-		CollRefreshTokens: colls.RefreshTokens,
+		Logger:                   logger,
+		JWTKeys:                  jwtKeys,
+		JwtRefreshKey:            []byte(os.Getenv("JWT_REFRESH_PASSWORD")),
+		CollProfiles:             colls.Profiles,
+		CollAppLoginCodes:        colls.AppLoginCodes,
+		CollRefreshTokens:        colls.RefreshTokens,
+		CollPersonalAccessTokens: colls.PersonalAccessTokens,
+		CollUserInvitations:      colls.UserInvitations,
+		Providers:                providers,
 	}
 }
 
@@ -84,17 +109,14 @@ func (a *Auth) JWTMiddleware() gin.HandlerFunc {
 
 		claimsObj := &utils.JWTClaims{}
 
-		// Parse takes the token string and a function for looking up the key. The latter is especially
-		// useful if you use multiple keys for your application. The standard is to use 'kid' in the
-		// head of the token to identify which key to use, but the parsed token (head and claims) is provided
-		// to the callback, providing flexibility.
-		token, err := jwt.ParseWithClaims(tokenString, claimsObj, func(token *jwt.Token) (interface{}, error) {
-			if token.Method != jwt.SigningMethodHS512 {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-			// jwtKey is injected in Auth struct
-			return a.JwtKey, nil
-		}, jwt.WithIssuer(utils.JWTIssuer), jwt.WithAudience(utils.JWTAudience))
+		// Parse takes the token string and a function for looking up the key.
+		// The 'kid' in the head of the token identifies which key of JWTKeys verifies it,
+		// so tokens signed with previous keys remain valid while rotating them.
+		token, err := jwt.ParseWithClaims(tokenString, claimsObj, a.JWTKeys.Keyfunc,
+			jwt.WithValidMethods(a.JWTKeys.ValidMethods()),
+			jwt.WithIssuer(utils.JWTIssuer),
+			jwt.WithAudience(utils.JWTAudience),
+		)
 
 		if token == nil || !token.Valid || err != nil {
 			if errors.Is(err, jwt.ErrTokenMalformed) {
@@ -129,34 +151,82 @@ func (a *Auth) JWTMiddleware() gin.HandlerFunc {
 		}
 
 		c.Set("jwt_claims", claimsObj)
-		if claimsObj.ClientType == RefreshTokenClientMobile {
-			c.Next()
-			return
+		// mobile and device clients have no web session
+		if claimsObj.ClientType != RefreshTokenClientMobile && claimsObj.ClientType != RefreshTokenClientDevice {
+			if !a.checkWebSession(c, claimsObj) {
+				return
+			}
 		}
 
-		// Private handlers still rely on the session profile. Enforce that the
-		// session identity matches the already-validated JWT, so callers cannot
-		// mix one user's bearer token with another user's session cookie.
-		session := sessions.Default(c)
-		profileSession, err := utils.GetProfileFromSession(session)
-		if err != nil {
-			a.Logger.Error("JWTMiddleware - profile not found in session")
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "cannot find profile in session"})
-			c.Abort()
+		// suspended profiles are rejected even with a valid token
+		if !a.checkActiveProfile(c, claimsObj.ProfileID) {
 			return
 		}
-		if profileSession.ID.Hex() != claimsObj.ProfileID || profileSession.GithubID != claimsObj.ID {
-			a.Logger.Errorw("JWTMiddleware - session/JWT identity mismatch",
-				"sessionProfileID", profileSession.ID.Hex(),
-				"jwtProfileID", claimsObj.ProfileID,
-				"sessionGithubID", profileSession.GithubID,
-				"jwtGithubID", claimsObj.ID,
-			)
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "session does not match token identity"})
-			c.Abort()
-			return
-		}
-
 		c.Next()
 	}
 }
+
+// ------------------------------ Private methods ------------------------------
+
+// checkWebSession aborts the request, returning false, if the session of the web app is not the one of claimsObj.
+// Private handlers still rely on the session profile. Enforce that the
+// session identity matches the already-validated JWT, so callers cannot
+// mix one user's bearer token with another user's session cookie.
+func (a *Auth) checkWebSession(c *gin.Context, claimsObj *utils.JWTClaims) bool {
+	session := sessions.Default(c)
+	profileSession, err := utils.GetProfileFromSession(session)
+	if err != nil {
+		a.Logger.Error("JWTMiddleware - profile not found in session")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "cannot find profile in session"})
+		c.Abort()
+		return false
+	}
+	if profileSession.ID.Hex() != claimsObj.ProfileID || profileSession.GithubID != claimsObj.ID {
+		a.Logger.Errorw("JWTMiddleware - session/JWT identity mismatch",
+			"sessionProfileID", profileSession.ID.Hex(),
+			"jwtProfileID", claimsObj.ProfileID,
+			"sessionGithubID", profileSession.GithubID,
+			"jwtGithubID", claimsObj.ID,
+		)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "session does not match token identity"})
+		c.Abort()
+		return false
+	}
+	return true
+}
+
+// checkActiveProfile aborts the request, returning false, if the profile has been deleted or suspended.
+// Otherwise it stores the role of the profile in the context, for AdminMiddleware.
+func (a *Auth) checkActiveProfile(c *gin.Context, profileID string) bool {
+	id, err := bson.ObjectIDFromHex(profileID)
+	if err != nil {
+		a.Logger.Errorw("checkActiveProfile - invalid profile in token", "profileID", profileID)
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "profile not found"})
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	defer cancel()
+
+	var profile models.Profile
+	err = a.CollProfiles.FindOne(ctx, bson.M{"_id": id},
+		options.FindOne().SetProjection(bson.M{"role": 1, "suspendedAt": 1}),
+	).Decode(&profile)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			a.Logger.Errorw("checkActiveProfile - profile not found", "profileID", profileID)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "profile not found"})
+			return false
+		}
+		a.Logger.Errorw("checkActiveProfile - cannot find profile", "profileID", profileID, "error", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "cannot find profile"})
+		return false
+	}
+	if profile.IsSuspended() {
+		a.Logger.Errorw("checkActiveProfile - profile is suspended", "profileID", profileID)
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "profile is suspended"})
+		return false
+	}
+	c.Set(profileRoleKey, profile.Role)
+	return true
+}
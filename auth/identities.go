@@ -0,0 +1,109 @@
+package auth
+
+import (
+	"api-server/models"
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrIdentityLinkedToOtherProfile = errors.New("identity is already linked to another profile")
+	ErrProviderAlreadyLinked        = errors.New("a login with this provider is already linked")
+	ErrIdentityNotFound             = errors.New("identity not found")
+	ErrLastIdentity                 = errors.New("cannot unlink the last login of the profile")
+)
+
+// LinkIdentity attaches identity to the profile, so logins with it resolve to that profile.
+// Profiles have at most one identity per provider, and identities belong to one profile only.
+// Linking an identity already linked to the same profile is a no-op.
+func LinkIdentity(ctx context.Context, logger *zap.SugaredLogger, collProfiles *mongo.Collection, profileID bson.ObjectID, identity models.Identity) error {
+	var owner models.Profile
+	err := collProfiles.FindOne(ctx, bson.M{"identities.id": identity.ID}).Decode(&owner)
+	if err == nil {
+		if owner.ID == profileID {
+			return nil
+		}
+		return ErrIdentityLinkedToOtherProfile
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return err
+	}
+
+	now := time.Now().UTC()
+	identity.LinkedAt = now
+	set := bson.M{"modifiedAt": now}
+	if identity.Provider == models.IdentityProviderGitHub {
+		github, errGitHub := gitHubFromIdentity(identity)
+		if errGitHub != nil {
+			return errGitHub
+		}
+		set["github"] = github
+	}
+	// the filter on provider makes the check and the update atomic,
+	// while the unique index on identities.id rejects identities linked concurrently to another profile
+	res, err := collProfiles.UpdateOne(ctx, bson.M{
+		"_id":                 profileID,
+		"identities.provider": bson.M{"$ne": identity.Provider},
+	}, bson.M{
+		"$push": bson.M{"identities": identity},
+		"$set":  set,
+	})
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrIdentityLinkedToOtherProfile
+		}
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrProviderAlreadyLinked
+	}
+
+	logger.Infow("AUDIT - identity linked",
+		"profileID", profileID.Hex(),
+		"provider", identity.Provider,
+		"login", identity.Login,
+	)
+	return nil
+}
+
+// UnlinkIdentity removes the identity of provider from the profile, refusing to remove the last one,
+// otherwise nobody could log in with the profile anymore.
+func UnlinkIdentity(ctx context.Context, logger *zap.SugaredLogger, collProfiles *mongo.Collection, profileID bson.ObjectID, provider string) error {
+	set := bson.M{"modifiedAt": time.Now().UTC()}
+	if provider == models.IdentityProviderGitHub {
+		set["github"] = models.GitHub{}
+	}
+	res, err := collProfiles.UpdateOne(ctx, bson.M{
+		"_id":                 profileID,
+		"identities.provider": provider,
+		"identities.1":        bson.M{"$exists": true},
+	}, bson.M{
+		"$pull": bson.M{"identities": bson.M{"provider": provider}},
+		"$set":  set,
+	})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		// find out why the update didn't match
+		count, errCount := collProfiles.CountDocuments(ctx, bson.M{"_id": profileID, "identities.provider": provider})
+		if errCount != nil {
+			return errCount
+		}
+		if count == 0 {
+			return ErrIdentityNotFound
+		}
+		return ErrLastIdentity
+	}
+
+	logger.Infow("AUDIT - identity unlinked",
+		"profileID", profileID.Hex(),
+		"provider", provider,
+	)
+	return nil
+}
@@ -10,6 +10,7 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -25,21 +26,23 @@ const (
 	GitHubCurrentUserURL = "https://api.github.com/user"
 )
 
-type GitHubOAuthClient string
+// OAuthClient is the client logging in, every provider has its own OAuth client for each of them
+type OAuthClient string
 
 const (
-	GitHubOAuthClientWeb GitHubOAuthClient = "web"
-	GitHubOAuthClientApp GitHubOAuthClient = "app"
+	OAuthClientWeb OAuthClient = "web"
+	OAuthClientApp OAuthClient = "app"
 )
 
 const (
 	RefreshTokenClientWeb    = "web"
 	RefreshTokenClientMobile = "mobile"
+	RefreshTokenClientDevice = "device"
 )
 
 // BuildGitHubAuthorizationURL builds the GitHub authorization URL with state
 // and S256 PKCE challenge parameters.
-func BuildGitHubAuthorizationURL(clientType GitHubOAuthClient, state, codeChallenge string) (string, error) {
+func BuildGitHubAuthorizationURL(clientType OAuthClient, state, codeChallenge string) (string, error) {
 	clientID, _, redirectURL, scopes, err := resolveGitHubOAuthConfig(clientType)
 	if err != nil {
 		return "", err
@@ -98,7 +101,7 @@ func FetchGitHubUser(ctx context.Context, httpClient *http.Client, accessToken s
 
 // ExchangeGitHubCodeForAccessToken exchanges a GitHub OAuth authorization code
 // and PKCE verifier for a GitHub access token.
-func ExchangeGitHubCodeForAccessToken(ctx context.Context, httpClient *http.Client, clientType GitHubOAuthClient, code, pkceVerifier string) (string, error) {
+func ExchangeGitHubCodeForAccessToken(ctx context.Context, httpClient *http.Client, clientType OAuthClient, code, pkceVerifier string) (string, error) {
 	clientID, clientSecret, redirectURL, _, err := resolveGitHubOAuthConfig(clientType)
 	if err != nil {
 		return "", err
@@ -145,13 +148,13 @@ func ExchangeGitHubCodeForAccessToken(ctx context.Context, httpClient *http.Clie
 	return tokenResp.AccessToken, nil
 }
 
-func resolveGitHubOAuthConfig(clientType GitHubOAuthClient) (string, string, string, []string, error) {
+func resolveGitHubOAuthConfig(clientType OAuthClient) (string, string, string, []string, error) {
 	scopes := []string{"read:user", "user:email"}
 
 	switch clientType {
-	case GitHubOAuthClientWeb:
+	case OAuthClientWeb:
 		return os.Getenv("OAUTH2_CLIENTID"), os.Getenv("OAUTH2_SECRETID"), os.Getenv("OAUTH2_CALLBACK"), scopes, nil
-	case GitHubOAuthClientApp:
+	case OAuthClientApp:
 		return os.Getenv("OAUTH2_APP_CLIENTID"), os.Getenv("OAUTH2_APP_SECRETID"), os.Getenv("OAUTH2_APP_CALLBACK"), scopes, nil
 	default:
 		return "", "", "", nil, fmt.Errorf("unsupported GitHub OAuth client type %q", clientType)
@@ -167,19 +170,31 @@ func githubEndpointURL(defaultURL, envName string) string {
 	return defaultURL
 }
 
-// FindOrCreateGitHubProfile returns the local profile for a GitHub identity,
-// creating one when this is the first successful login for that GitHub user.
-func FindOrCreateGitHubProfile(ctx context.Context, logger *zap.SugaredLogger, collProfiles *mongo.Collection, githubProfile models.GitHub) (models.Profile, error) {
-	if !isGitHubEmailAllowed(githubProfile.Email, os.Getenv("LIMIT_TO_USER_EMAILS")) {
-		return models.Profile{}, fmt.Errorf("login not permitted")
-	}
+// ErrLoginNotPermitted is returned for new users without an invitation
+var ErrLoginNotPermitted = errors.New("login not permitted")
+
+// ErrProfileSuspended is returned for logins of suspended profiles
+var ErrProfileSuspended = errors.New("profile is suspended")
 
+// FindOrCreateProfile returns the local profile linked to an identity,
+// creating one when this is the first successful login with that identity.
+// New profiles require an invitation for a verified email of the identity, and get its role.
+// Profiles suspended by an admin cannot log in.
+func FindOrCreateProfile(ctx context.Context, logger *zap.SugaredLogger, collProfiles, collUserInvitations *mongo.Collection, identity models.Identity) (models.Profile, error) {
 	var profile models.Profile
-	err := collProfiles.FindOne(ctx, bson.M{"github.id": githubProfile.ID}).Decode(&profile)
+	err := collProfiles.FindOne(ctx, bson.M{"identities.id": identity.ID}).Decode(&profile)
 	if err == nil {
+		if profile.IsSuspended() {
+			logger.Infow("AUDIT - login of suspended profile rejected",
+				"profileID", profile.ID.Hex(),
+				"provider", identity.Provider,
+			)
+			return models.Profile{}, ErrProfileSuspended
+		}
 		logger.Infow("AUDIT - user login",
 			"profileID", profile.ID.Hex(),
-			"githubLogin", githubProfile.Login,
+			"provider", identity.Provider,
+			"login", identity.Login,
 		)
 		return profile, nil
 	}
@@ -187,6 +202,11 @@ func FindOrCreateGitHubProfile(ctx context.Context, logger *zap.SugaredLogger, c
 		return models.Profile{}, err
 	}
 
+	invitation, err := findUserInvitation(ctx, collProfiles, collUserInvitations, identity)
+	if err != nil {
+		return models.Profile{}, err
+	}
+
 	now := time.Now().UTC()
 	apiToken := uuid.NewString()
 	apiTokenEncrypted, err := utils.EncryptAPIToken(apiToken)
@@ -197,52 +217,96 @@ func FindOrCreateGitHubProfile(ctx context.Context, logger *zap.SugaredLogger, c
 	if err != nil {
 		return models.Profile{}, err
 	}
+	identity.LinkedAt = now
 	profile = models.Profile{
 		ID:                bson.NewObjectID(),
-		Github:            githubProfile,
+		Identities:        []models.Identity{identity},
 		APITokenHash:      apiTokenHash,
 		APITokenEncrypted: apiTokenEncrypted,
 		Homes:             []bson.ObjectID{},
 		Devices:           []bson.ObjectID{},
 		CreatedAt:         now,
 		ModifiedAt:        now,
+		Role:              invitation.Role,
+	}
+	if identity.Provider == models.IdentityProviderGitHub {
+		if profile.Github, err = gitHubFromIdentity(identity); err != nil {
+			return models.Profile{}, err
+		}
 	}
 
 	if _, err = collProfiles.InsertOne(ctx, profile); err != nil {
 		return models.Profile{}, err
 	}
+	_, err = collUserInvitations.UpdateOne(ctx, bson.M{"_id": invitation.ID}, bson.M{
+		"$set": bson.M{"profileId": profile.ID, "acceptedAt": now},
+	})
+	if err != nil {
+		logger.Errorw("FindOrCreateProfile - cannot mark invitation as accepted", "invitationID", invitation.ID.Hex(), "error", err)
+	}
 
 	logger.Infow("AUDIT - user created",
 		"profileID", profile.ID.Hex(),
-		"githubLogin", githubProfile.Login,
+		"provider", identity.Provider,
+		"login", identity.Login,
+		"invitationID", invitation.ID.Hex(),
+		"role", profile.Role,
 	)
 	profile.APIToken = apiToken
 	return profile, nil
 }
 
-func isGitHubEmailAllowed(email, allowedEmails string) bool {
-	allowedEmails = strings.TrimSpace(allowedEmails)
-	if allowedEmails == "" {
-		return true
+// gitHubFromIdentity returns the GitHub account of a GitHub identity, the opposite of models.GitHubIdentity
+func gitHubFromIdentity(identity models.Identity) (models.GitHub, error) {
+	githubID, err := strconv.ParseInt(identity.Subject, 10, 64)
+	if err != nil {
+		return models.GitHub{}, fmt.Errorf("invalid github identity %q: %w", identity.Subject, err)
+	}
+	return models.GitHub{
+		ID:        githubID,
+		Login:     identity.Login,
+		Name:      identity.Name,
+		Email:     identity.Email,
+		AvatarURL: identity.AvatarURL,
+	}, nil
+}
+
+// findUserInvitation returns the invitation for the verified email of identity.
+// An invitation creates a single profile: while it exists, other logins must be linked to it.
+func findUserInvitation(ctx context.Context, collProfiles, collUserInvitations *mongo.Collection, identity models.Identity) (models.UserInvitation, error) {
+	email := utils.NormalizeEmail(identity.Email)
+	if !identity.EmailVerified || email == "" {
+		return models.UserInvitation{}, ErrLoginNotPermitted
 	}
-	email = strings.ToLower(strings.TrimSpace(email))
-	if email == "" {
-		return false
+
+	var invitation models.UserInvitation
+	err := collUserInvitations.FindOne(ctx, bson.M{"email": email}).Decode(&invitation)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return models.UserInvitation{}, ErrLoginNotPermitted
+	}
+	if err != nil {
+		return models.UserInvitation{}, err
 	}
-	for _, allowedEmail := range strings.Split(allowedEmails, ",") {
-		if email == strings.ToLower(strings.TrimSpace(allowedEmail)) {
-			return true
+
+	if invitation.ProfileID != nil {
+		count, err := collProfiles.CountDocuments(ctx, bson.M{"_id": *invitation.ProfileID})
+		if err != nil {
+			return models.UserInvitation{}, err
+		}
+		if count > 0 {
+			return models.UserInvitation{}, fmt.Errorf("%w: invitation already used by profile %s", ErrLoginNotPermitted, invitation.ProfileID.Hex())
 		}
 	}
-	return false
+	return invitation, nil
 }
 
 // IssueGitHubLoginResult creates a local access JWT and an opaque refresh token
-// for a successful GitHub login. Only the refresh-token hash is stored.
-func IssueGitHubLoginResult(ctx context.Context, collRefreshTokens *mongo.Collection, profile models.Profile, jwtKey []byte, accessTokenTTL, refreshTokenTTL time.Duration, refreshTokenClientType string) (string, string, time.Time, error) {
+// for a successful login, with GitHub or any other provider. Only the refresh-token hash is stored.
+func IssueGitHubLoginResult(ctx context.Context, collRefreshTokens *mongo.Collection, profile models.Profile, jwtKeys *utils.JWTKeySet, accessTokenTTL, refreshTokenTTL time.Duration, refreshTokenClientType string) (string, string, time.Time, error) {
 	now := time.Now().UTC()
 	accessTokenExpTime := now.Add(accessTokenTTL)
-	accessToken, err := utils.CreateJWT(profile, accessTokenExpTime, utils.AccessToken, refreshTokenClientType, jwtKey)
+	familyID := bson.NewObjectID().Hex()
+	accessToken, err := utils.CreateJWT(profile, accessTokenExpTime, utils.AccessToken, refreshTokenClientType, familyID, jwtKeys)
 	if err != nil {
 		return "", "", time.Time{}, fmt.Errorf("create access token: %w", err)
 	}
@@ -253,13 +317,14 @@ func IssueGitHubLoginResult(ctx context.Context, collRefreshTokens *mongo.Collec
 	}
 
 	refreshTokenRecord := models.RefreshToken{
-		ID:         bson.NewObjectID(),
-		ProfileID:  profile.ID,
-		TokenHash:  utils.HashToken(refreshToken),
-		FamilyID:   bson.NewObjectID().Hex(),
-		ClientType: refreshTokenClientType,
-		CreatedAt:  now,
-		ExpiresAt:  now.Add(refreshTokenTTL),
+		ID:              bson.NewObjectID(),
+		ProfileID:       profile.ID,
+		TokenHash:       utils.HashToken(refreshToken),
+		FamilyID:        familyID,
+		ClientType:      refreshTokenClientType,
+		CreatedAt:       now,
+		ExpiresAt:       now.Add(refreshTokenTTL),
+		FamilyCreatedAt: now,
 	}
 	if _, err = collRefreshTokens.InsertOne(ctx, refreshTokenRecord); err != nil {
 		return "", "", time.Time{}, fmt.Errorf("store refresh token: %w", err)
@@ -1,51 +1,33 @@
 package auth
 
-import "testing"
+import (
+	"api-server/models"
+	"context"
+	"errors"
+	"testing"
+)
 
-func TestIsGitHubEmailAllowed(t *testing.T) {
+func TestFindUserInvitationRequiresVerifiedEmail(t *testing.T) {
 	tests := []struct {
-		name          string
-		email         string
-		allowedEmails string
-		want          bool
+		name     string
+		identity models.Identity
 	}{
 		{
-			name:          "empty allowlist permits any email",
-			email:         "user@example.com",
-			allowedEmails: "",
-			want:          true,
+			name:     "unverified email is rejected",
+			identity: models.Identity{Email: "user@example.com", EmailVerified: false},
 		},
 		{
-			name:          "email in comma separated allowlist is permitted",
-			email:         "second@example.com",
-			allowedEmails: "first@example.com,second@example.com",
-			want:          true,
-		},
-		{
-			name:          "email match ignores spaces and case",
-			email:         "Second@Example.com",
-			allowedEmails: " first@example.com, second@example.com ",
-			want:          true,
-		},
-		{
-			name:          "email outside allowlist is rejected",
-			email:         "third@example.com",
-			allowedEmails: "first@example.com,second@example.com",
-			want:          false,
-		},
-		{
-			name:          "empty github email is rejected when allowlist is set",
-			email:         "",
-			allowedEmails: "first@example.com",
-			want:          false,
+			name:     "empty email is rejected",
+			identity: models.Identity{Email: " ", EmailVerified: true},
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := isGitHubEmailAllowed(tt.email, tt.allowedEmails)
-			if got != tt.want {
-				t.Fatalf("isGitHubEmailAllowed(%q, %q) = %t, want %t", tt.email, tt.allowedEmails, got, tt.want)
+			// invitations are not even read
+			_, err := findUserInvitation(context.Background(), nil, nil, tt.identity)
+			if !errors.Is(err, ErrLoginNotPermitted) {
+				t.Fatalf("findUserInvitation() error = %v, want %v", err, ErrLoginNotPermitted)
 			}
 		})
 	}
@@ -0,0 +1,395 @@
+package auth
+
+import (
+	"api-server/models"
+	"api-server/utils"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// oidcDiscoveryTTL is how long endpoints of a provider are cached
+	oidcDiscoveryTTL = 1 * time.Hour
+	// oidcKeysRefreshInterval limits how often keys are downloaded again,
+	// when an ID token is signed with an unknown key, e.g. after a rotation
+	oidcKeysRefreshInterval = 1 * time.Minute
+	// oidcClockSkew is the tolerated difference between our clock and the provider one
+	oidcClockSkew = 1 * time.Minute
+)
+
+// oidcSigningMethods are the accepted algorithms of ID tokens, "none" and HMAC are never accepted
+var oidcSigningMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+var errOIDCUnknownKey = errors.New("unknown signing key")
+
+// OIDCClientConfig is an OAuth client registered in an OpenID Connect provider
+type OIDCClientConfig struct {
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+}
+
+// OIDCConfig configures an OpenID Connect provider, App is optional
+type OIDCConfig struct {
+	Name   string
+	Issuer string
+	Scopes []string
+	Web    OIDCClientConfig
+	App    OIDCClientConfig
+}
+
+// oidcDiscovery is the subset of the OpenID Provider Metadata used to log in
+type oidcDiscovery struct {
+	Issuer                        string   `json:"issuer"`
+	AuthorizationEndpoint         string   `json:"authorization_endpoint"`
+	TokenEndpoint                 string   `json:"token_endpoint"`
+	JWKSURI                       string   `json:"jwks_uri"`
+	CodeChallengeMethodsSupported []string `json:"code_challenge_methods_supported"`
+}
+
+type oidcTokenResponse struct {
+	IDToken          string `json:"id_token"`
+	TokenType        string `json:"token_type"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// oidcIDTokenClaims are the claims of ID tokens, with standard claims of the user profile
+type oidcIDTokenClaims struct {
+	Nonce             string `json:"nonce"`
+	AuthorizedParty   string `json:"azp"`
+	Email             string `json:"email"`
+	EmailVerified     bool   `json:"email_verified"`
+	Name              string `json:"name"`
+	PreferredUsername string `json:"preferred_username"`
+	Picture           string `json:"picture"`
+	jwt.RegisteredClaims
+}
+
+// oidcProvider logs in with a generic OpenID Connect provider, e.g. Keycloak.
+// Endpoints are read from the discovery document of the issuer and ID tokens are verified with its JWKS.
+type oidcProvider struct {
+	config     OIDCConfig
+	httpClient *http.Client
+
+	mu            sync.Mutex
+	discovery     *oidcDiscovery
+	discoveredAt  time.Time
+	keys          []jsonWebKey
+	keysFetchedAt time.Time
+}
+
+func newOIDCProvider(config OIDCConfig, httpClient *http.Client) *oidcProvider {
+	return &oidcProvider{
+		config:     config,
+		httpClient: httpClient,
+	}
+}
+
+func oidcConfigFromEnv(name string) (OIDCConfig, error) {
+	prefix := "OIDC_" + strings.ToUpper(name) + "_"
+	env := func(suffix string) string {
+		return strings.TrimSpace(os.Getenv(prefix + suffix))
+	}
+	config := OIDCConfig{
+		Name:   name,
+		Issuer: env("ISSUER"),
+		Scopes: strings.Fields(env("SCOPES")),
+		Web: OIDCClientConfig{
+			ClientID:     env("CLIENTID"),
+			ClientSecret: env("SECRETID"),
+			RedirectURL:  env("CALLBACK"),
+		},
+		App: OIDCClientConfig{
+			ClientID:     env("APP_CLIENTID"),
+			ClientSecret: env("APP_SECRETID"),
+			RedirectURL:  env("APP_CALLBACK"),
+		},
+	}
+	if len(config.Scopes) == 0 {
+		config.Scopes = []string{"openid", "profile", "email"}
+	} else if !slices.Contains(config.Scopes, "openid") {
+		return OIDCConfig{}, fmt.Errorf("'%sSCOPES' environment variable must contain openid", prefix)
+	}
+
+	if err := validateAbsoluteURL(prefix+"ISSUER", config.Issuer); err != nil {
+		return OIDCConfig{}, err
+	}
+	if config.Web.ClientID == "" {
+		return OIDCConfig{}, fmt.Errorf("'%sCLIENTID' environment variable is mandatory", prefix)
+	}
+	if err := validateAbsoluteURL(prefix+"CALLBACK", config.Web.RedirectURL); err != nil {
+		return OIDCConfig{}, err
+	}
+	if config.App.ClientID != "" {
+		if err := validateAbsoluteURL(prefix+"APP_CALLBACK", config.App.RedirectURL); err != nil {
+			return OIDCConfig{}, err
+		}
+	}
+	return config, nil
+}
+
+func validateAbsoluteURL(name, raw string) error {
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("'%s' environment variable must be a valid URL: %w", name, err)
+	}
+	if parsed.Scheme == "" || parsed.Host == "" {
+		return fmt.Errorf("'%s' environment variable must include scheme and host", name)
+	}
+	return nil
+}
+
+func (op *oidcProvider) Name() string {
+	return op.config.Name
+}
+
+func (op *oidcProvider) AuthorizationURL(ctx context.Context, client OAuthClient, state, nonce, codeChallenge string) (string, error) {
+	clientConfig, err := op.clientConfig(client)
+	if err != nil {
+		return "", err
+	}
+	discovery, err := op.getDiscovery(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	u, err := url.Parse(discovery.AuthorizationEndpoint)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Set("client_id", clientConfig.ClientID)
+	q.Set("redirect_uri", clientConfig.RedirectURL)
+	q.Set("response_type", "code")
+	q.Set("scope", strings.Join(op.config.Scopes, " "))
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", codeChallenge)
+	q.Set("code_challenge_method", utils.PKCEChallengeMethodS256)
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+func (op *oidcProvider) Identity(ctx context.Context, client OAuthClient, code, pkceVerifier, nonce string) (models.Identity, error) {
+	clientConfig, err := op.clientConfig(client)
+	if err != nil {
+		return models.Identity{}, err
+	}
+	discovery, err := op.getDiscovery(ctx)
+	if err != nil {
+		return models.Identity{}, err
+	}
+
+	rawIDToken, err := op.exchangeCode(ctx, discovery, clientConfig, code, pkceVerifier)
+	if err != nil {
+		return models.Identity{}, err
+	}
+	claims, err := op.verifyIDToken(ctx, discovery, clientConfig, rawIDToken, nonce)
+	if err != nil {
+		return models.Identity{}, fmt.Errorf("invalid id token: %w", err)
+	}
+
+	return models.Identity{
+		ID:            models.IdentityID(op.config.Name, claims.Subject),
+		Provider:      op.config.Name,
+		Subject:       claims.Subject,
+		Login:         claims.PreferredUsername,
+		Name:          claims.Name,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified,
+		AvatarURL:     claims.Picture,
+	}, nil
+}
+
+// ------------------------------ Private methods ------------------------------
+
+func (op *oidcProvider) clientConfig(client OAuthClient) (OIDCClientConfig, error) {
+	switch client {
+	case OAuthClientWeb:
+		return op.config.Web, nil
+	case OAuthClientApp:
+		if op.config.App.ClientID == "" {
+			return OIDCClientConfig{}, fmt.Errorf("OIDC provider %q is not configured for the mobile app", op.config.Name)
+		}
+		return op.config.App, nil
+	default:
+		return OIDCClientConfig{}, fmt.Errorf("unsupported OAuth client type %q", client)
+	}
+}
+
+// getDiscovery returns endpoints of the provider, downloading its discovery document when the cached one is too old
+func (op *oidcProvider) getDiscovery(ctx context.Context) (*oidcDiscovery, error) {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+	if op.discovery != nil && time.Since(op.discoveredAt) < oidcDiscoveryTTL {
+		return op.discovery, nil
+	}
+
+	discoveryURL := strings.TrimSuffix(op.config.Issuer, "/") + "/.well-known/openid-configuration"
+	var discovery oidcDiscovery
+	if err := op.getJSON(ctx, discoveryURL, &discovery); err != nil {
+		return nil, fmt.Errorf("cannot discover OIDC provider %q: %w", op.config.Name, err)
+	}
+	// the issuer must be the configured one, otherwise the provider could impersonate another one
+	if strings.TrimSuffix(discovery.Issuer, "/") != strings.TrimSuffix(op.config.Issuer, "/") {
+		return nil, fmt.Errorf("OIDC provider %q returned issuer %q", op.config.Name, discovery.Issuer)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, fmt.Errorf("OIDC provider %q discovery document is missing required endpoints", op.config.Name)
+	}
+	if len(discovery.CodeChallengeMethodsSupported) > 0 && !slices.Contains(discovery.CodeChallengeMethodsSupported, utils.PKCEChallengeMethodS256) {
+		return nil, fmt.Errorf("OIDC provider %q doesn't support S256 PKCE", op.config.Name)
+	}
+
+	op.discovery = &discovery
+	op.discoveredAt = time.Now()
+	return op.discovery, nil
+}
+
+func (op *oidcProvider) exchangeCode(ctx context.Context, discovery *oidcDiscovery, clientConfig OIDCClientConfig, code, pkceVerifier string) (string, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", clientConfig.RedirectURL)
+	form.Set("code_verifier", pkceVerifier)
+	if clientConfig.ClientSecret == "" {
+		// public clients identify themselves only with their id
+		form.Set("client_id", clientConfig.ClientID)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if clientConfig.ClientSecret != "" {
+		// client_secret_basic, the default authentication method of OpenID Connect
+		req.SetBasicAuth(url.QueryEscape(clientConfig.ClientID), url.QueryEscape(clientConfig.ClientSecret))
+	}
+
+	resp, err := op.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var tokenResp oidcTokenResponse
+	if err = json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
+		return "", err
+	}
+	if tokenResp.Error != "" {
+		return "", fmt.Errorf("oidc token exchange failed: %s %s", tokenResp.Error, tokenResp.ErrorDescription)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("oidc token exchange failed with status %d", resp.StatusCode)
+	}
+	if tokenResp.IDToken == "" {
+		return "", fmt.Errorf("oidc token exchange returned empty id token")
+	}
+	return tokenResp.IDToken, nil
+}
+
+// verifyIDToken validates signature, issuer, audience, expiration and nonce of an ID token, as required by
+// https://openid.net/specs/openid-connect-core-1_0.html#IDTokenValidation
+func (op *oidcProvider) verifyIDToken(ctx context.Context, discovery *oidcDiscovery, clientConfig OIDCClientConfig, rawIDToken, nonce string) (*oidcIDTokenClaims, error) {
+	parser := jwt.NewParser(
+		jwt.WithValidMethods(oidcSigningMethods),
+		jwt.WithIssuer(discovery.Issuer),
+		jwt.WithAudience(clientConfig.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(oidcClockSkew),
+	)
+	claims := &oidcIDTokenClaims{}
+	_, err := parser.ParseWithClaims(rawIDToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return op.verificationKey(ctx, discovery, kid)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.Subject == "" {
+		return nil, errors.New("missing subject")
+	}
+	if subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1 {
+		return nil, errors.New("nonce mismatch")
+	}
+	// with more audiences, the token must be issued to us
+	if (len(claims.Audience) > 1 || claims.AuthorizedParty != "") && claims.AuthorizedParty != clientConfig.ClientID {
+		return nil, fmt.Errorf("token issued to %q", claims.AuthorizedParty)
+	}
+	return claims, nil
+}
+
+// verificationKey returns the key identified by kid, or all keys without kid.
+// Keys are downloaded again when kid is unknown, at most once every oidcKeysRefreshInterval.
+func (op *oidcProvider) verificationKey(ctx context.Context, discovery *oidcDiscovery, kid string) (interface{}, error) {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+
+	if op.lookupKeyLocked(kid) == nil && time.Since(op.keysFetchedAt) >= oidcKeysRefreshInterval {
+		var keySet jsonWebKeySet
+		if err := op.getJSON(ctx, discovery.JWKSURI, &keySet); err != nil {
+			return nil, fmt.Errorf("cannot download keys of OIDC provider %q: %w", op.config.Name, err)
+		}
+		op.keys = keySet.signingKeys()
+		op.keysFetchedAt = time.Now()
+	}
+
+	key := op.lookupKeyLocked(kid)
+	if key == nil {
+		return nil, errOIDCUnknownKey
+	}
+	return key, nil
+}
+
+func (op *oidcProvider) lookupKeyLocked(kid string) interface{} {
+	if kid != "" {
+		for _, key := range op.keys {
+			if key.KeyID == kid {
+				return key.publicKey
+			}
+		}
+		return nil
+	}
+	if len(op.keys) == 0 {
+		return nil
+	}
+	keySet := jwt.VerificationKeySet{}
+	for _, key := range op.keys {
+		keySet.Keys = append(keySet.Keys, key.publicKey)
+	}
+	return keySet
+}
+
+func (op *oidcProvider) getJSON(ctx context.Context, rawURL string, target any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := op.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("request to %s failed with status %d", rawURL, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(target)
+}
@@ -0,0 +1,114 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+)
+
+// jsonWebKeySet is a JWK Set, as defined in https://www.rfc-editor.org/rfc/rfc7517#section-5
+type jsonWebKeySet struct {
+	Keys []jsonWebKey `json:"keys"`
+}
+
+// jsonWebKey is a public key of a JWK Set, supporting RSA, EC (P-256, P-384, P-521) and OKP (Ed25519) keys
+type jsonWebKey struct {
+	KeyType string `json:"kty"`
+	KeyID   string `json:"kid"`
+	Use     string `json:"use"`
+	// RSA
+	N string `json:"n"`
+	E string `json:"e"`
+	// EC and OKP
+	Curve string `json:"crv"`
+	X     string `json:"x"`
+	Y     string `json:"y"`
+
+	publicKey crypto.PublicKey
+}
+
+// signingKeys returns the keys to verify signatures. Encryption and unsupported keys are skipped,
+// so a provider publishing a new kind of key doesn't break logins.
+func (ks jsonWebKeySet) signingKeys() []jsonWebKey {
+	keys := make([]jsonWebKey, 0, len(ks.Keys))
+	for _, key := range ks.Keys {
+		if key.Use != "" && key.Use != "sig" {
+			continue
+		}
+		publicKey, err := key.parsePublicKey()
+		if err != nil {
+			continue
+		}
+		key.publicKey = publicKey
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func (k jsonWebKey) parsePublicKey() (crypto.PublicKey, error) {
+	switch k.KeyType {
+	case "RSA":
+		n, err := decodeKeyParam(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeKeyParam(k.E)
+		if err != nil {
+			return nil, err
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Curve {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Curve)
+		}
+		x, err := decodeKeyParam(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeKeyParam(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		// uncompressed point, it fails if coordinates don't have the curve size or the point isn't on the curve
+		point := append([]byte{4}, append(x, y...)...)
+		return ecdsa.ParseUncompressedPublicKey(curve, point)
+	case "OKP":
+		if k.Curve != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Curve)
+		}
+		x, err := decodeKeyParam(k.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid Ed25519 key size")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.KeyType)
+	}
+}
+
+func decodeKeyParam(param string) ([]byte, error) {
+	if param == "" {
+		return nil, fmt.Errorf("missing key parameter")
+	}
+	return base64.RawURLEncoding.DecodeString(param)
+}
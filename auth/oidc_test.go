@@ -0,0 +1,278 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// testIdP is an OpenID Connect provider answering the token request with an ID token signed by the key signingKid
+type testIdP struct {
+	server *httptest.Server
+
+	mu         sync.Mutex
+	keys       map[string]*rsa.PrivateKey
+	signingKid string
+	claims     jwt.MapClaims
+	jwksCalls  int
+}
+
+func newTestIdP(t *testing.T) *testIdP {
+	t.Helper()
+	idp := &testIdP{keys: map[string]*rsa.PrivateKey{}}
+	idp.addKey(t, "key1")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"issuer":                           idp.server.URL,
+			"authorization_endpoint":           idp.server.URL + "/authorize",
+			"token_endpoint":                   idp.server.URL + "/token",
+			"jwks_uri":                         idp.server.URL + "/jwks",
+			"code_challenge_methods_supported": []string{"S256"},
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		idp.mu.Lock()
+		defer idp.mu.Unlock()
+		idp.jwksCalls++
+		keys := []map[string]string{}
+		for kid, key := range idp.keys {
+			keys = append(keys, map[string]string{
+				"kty": "RSA",
+				"kid": kid,
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			})
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": keys})
+	})
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		clientID, _, ok := r.BasicAuth()
+		if !ok || clientID != "client-id" || r.ParseForm() != nil || r.PostForm.Get("code") != "valid-code" {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		idp.mu.Lock()
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, idp.claims)
+		token.Header["kid"] = idp.signingKid
+		signed, err := token.SignedString(idp.keys[idp.signingKid])
+		idp.mu.Unlock()
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"id_token": signed, "token_type": "Bearer"})
+	})
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+func (idp *testIdP) addKey(t *testing.T, kid string) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("cannot generate key: %v", err)
+	}
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	idp.keys[kid] = key
+	idp.signingKid = kid
+}
+
+func (idp *testIdP) setClaims(claims jwt.MapClaims) {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	idp.claims = claims
+}
+
+func (idp *testIdP) validClaims(nonce string) jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss":                idp.server.URL,
+		"aud":                "client-id",
+		"sub":                "user-1",
+		"iat":                now.Unix(),
+		"exp":                now.Add(5 * time.Minute).Unix(),
+		"nonce":              nonce,
+		"preferred_username": "user1",
+		"name":               "User One",
+		"email":              "user1@example.com",
+		"email_verified":     true,
+	}
+}
+
+func (idp *testIdP) provider() *oidcProvider {
+	return newOIDCProvider(OIDCConfig{
+		Name:   "keycloak",
+		Issuer: idp.server.URL,
+		Scopes: []string{"openid", "profile", "email"},
+		Web: OIDCClientConfig{
+			ClientID:     "client-id",
+			ClientSecret: "client-secret",
+			RedirectURL:  "https://home.example.com/api/oauth/providers/keycloak/callback",
+		},
+	}, idp.server.Client())
+}
+
+func TestOIDCAuthorizationURL(t *testing.T) {
+	idp := newTestIdP(t)
+
+	authURL, err := idp.provider().AuthorizationURL(context.Background(), OAuthClientWeb, "state1", "nonce1", "challenge1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("invalid authorization url %q: %v", authURL, err)
+	}
+	if got := parsed.Scheme + "://" + parsed.Host + parsed.Path; got != idp.server.URL+"/authorize" {
+		t.Fatalf("expected authorization endpoint, got %q", got)
+	}
+	expected := map[string]string{
+		"response_type":         "code",
+		"client_id":             "client-id",
+		"redirect_uri":          "https://home.example.com/api/oauth/providers/keycloak/callback",
+		"scope":                 "openid profile email",
+		"state":                 "state1",
+		"nonce":                 "nonce1",
+		"code_challenge":        "challenge1",
+		"code_challenge_method": "S256",
+	}
+	for name, value := range expected {
+		if got := parsed.Query().Get(name); got != value {
+			t.Fatalf("expected %s=%q, got %q", name, value, got)
+		}
+	}
+}
+
+func TestOIDCAuthorizationURLRequiresAppClient(t *testing.T) {
+	idp := newTestIdP(t)
+
+	if _, err := idp.provider().AuthorizationURL(context.Background(), OAuthClientApp, "state1", "nonce1", "challenge1"); err == nil {
+		t.Fatal("expected error for provider without app client")
+	}
+}
+
+func TestOIDCIdentity(t *testing.T) {
+	idp := newTestIdP(t)
+	idp.setClaims(idp.validClaims("nonce1"))
+
+	identity, err := idp.provider().Identity(context.Background(), OAuthClientWeb, "valid-code", "verifier", "nonce1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if identity.ID != "keycloak|user-1" || identity.Provider != "keycloak" || identity.Subject != "user-1" {
+		t.Fatalf("unexpected identity %+v", identity)
+	}
+	if identity.Login != "user1" || identity.Name != "User One" || identity.Email != "user1@example.com" || !identity.EmailVerified {
+		t.Fatalf("unexpected identity claims %+v", identity)
+	}
+}
+
+func TestOIDCIdentityRejectsInvalidIDTokens(t *testing.T) {
+	cases := map[string]func(claims jwt.MapClaims){
+		"wrong nonce":    func(claims jwt.MapClaims) { claims["nonce"] = "other" },
+		"wrong audience": func(claims jwt.MapClaims) { claims["aud"] = "other-client" },
+		"wrong issuer":   func(claims jwt.MapClaims) { claims["iss"] = "https://evil.example.com" },
+		"expired":        func(claims jwt.MapClaims) { claims["exp"] = time.Now().Add(-time.Hour).Unix() },
+		"missing sub":    func(claims jwt.MapClaims) { delete(claims, "sub") },
+	}
+	for name, mutate := range cases {
+		t.Run(name, func(t *testing.T) {
+			idp := newTestIdP(t)
+			claims := idp.validClaims("nonce1")
+			mutate(claims)
+			idp.setClaims(claims)
+
+			if _, err := idp.provider().Identity(context.Background(), OAuthClientWeb, "valid-code", "verifier", "nonce1"); err == nil {
+				t.Fatal("expected invalid id token")
+			}
+		})
+	}
+}
+
+func TestOIDCIdentityRejectsInvalidCode(t *testing.T) {
+	idp := newTestIdP(t)
+	idp.setClaims(idp.validClaims("nonce1"))
+
+	if _, err := idp.provider().Identity(context.Background(), OAuthClientWeb, "other-code", "verifier", "nonce1"); err == nil {
+		t.Fatal("expected error for invalid code")
+	}
+}
+
+func TestOIDCIdentityRefetchesRotatedKeys(t *testing.T) {
+	idp := newTestIdP(t)
+	provider := idp.provider()
+	idp.setClaims(idp.validClaims("nonce1"))
+	if _, err := provider.Identity(context.Background(), OAuthClientWeb, "valid-code", "verifier", "nonce1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the provider signs with a new key, unknown until keys are fetched again
+	idp.addKey(t, "key2")
+	if _, err := provider.Identity(context.Background(), OAuthClientWeb, "valid-code", "verifier", "nonce1"); err == nil {
+		t.Fatal("expected error, because keys were fetched less than a minute ago")
+	}
+	provider.mu.Lock()
+	provider.keysFetchedAt = time.Now().Add(-oidcKeysRefreshInterval)
+	provider.mu.Unlock()
+	if _, err := provider.Identity(context.Background(), OAuthClientWeb, "valid-code", "verifier", "nonce1"); err != nil {
+		t.Fatalf("expected rotated key to be fetched, got %v", err)
+	}
+	if idp.jwksCalls != 2 {
+		t.Fatalf("expected 2 JWKS requests, got %d", idp.jwksCalls)
+	}
+}
+
+func TestOIDCDiscoveryRejectsIssuerMismatch(t *testing.T) {
+	idp := newTestIdP(t)
+	provider := idp.provider()
+	provider.config.Issuer = idp.server.URL + "/other"
+
+	if _, err := provider.AuthorizationURL(context.Background(), OAuthClientWeb, "state1", "nonce1", "challenge1"); err == nil {
+		t.Fatal("expected error for issuer mismatch")
+	}
+}
+
+func TestJSONWebKeyParsesECKeys(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("cannot generate key: %v", err)
+	}
+	publicKey, err := key.PublicKey.Bytes()
+	if err != nil {
+		t.Fatalf("cannot encode key: %v", err)
+	}
+	// uncompressed point: 0x04 || X || Y
+	jwk := jsonWebKey{
+		KeyType: "EC",
+		Curve:   "P-256",
+		X:       base64.RawURLEncoding.EncodeToString(publicKey[1:33]),
+		Y:       base64.RawURLEncoding.EncodeToString(publicKey[33:]),
+	}
+
+	parsed, err := jwk.parsePublicKey()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !key.PublicKey.Equal(parsed) {
+		t.Fatal("parsed key doesn't match")
+	}
+}
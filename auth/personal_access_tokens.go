@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"api-server/models"
+	"api-server/utils"
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// ClientPersonalAccessToken is the client type of requests authenticated with a personal access token
+const ClientPersonalAccessToken = "pat"
+
+// personalAccessTokenUseInterval limits the updates of lastUsedAt, scripts can call APIs very often
+const personalAccessTokenUseInterval = time.Minute
+
+// RouteScopes are the scopes required to call routes with a personal access token,
+// keyed by method and path as registered in gin, e.g. "GET /api/homes/:id/rooms".
+type RouteScopes map[string]string
+
+// TokenMiddleware authenticates requests with a JWT, like JWTMiddleware, or with a personal access token.
+// Personal access tokens can call only the routes in routeScopes and only with the required scope,
+// so account APIs such as sessions or tokens themselves always require a login.
+func (a *Auth) TokenMiddleware(routeScopes RouteScopes) gin.HandlerFunc {
+	jwtMiddleware := a.JWTMiddleware()
+	return func(c *gin.Context) {
+		tokenString := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !strings.HasPrefix(tokenString, models.PersonalAccessTokenPrefix) {
+			jwtMiddleware(c)
+			return
+		}
+
+		pat, err := a.findPersonalAccessToken(c.Request.Context(), tokenString, time.Now().UTC())
+		if err != nil {
+			a.Logger.Errorw("TokenMiddleware - personal access token is not valid", "error", err)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "personal access token is not valid"})
+			return
+		}
+
+		route := c.Request.Method + " " + c.FullPath()
+		scope, found := routeScopes[route]
+		if !found {
+			a.Logger.Errorw("TokenMiddleware - route not allowed to personal access tokens", "route", route, "tokenID", pat.ID.Hex())
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "personal access tokens cannot call this api"})
+			return
+		}
+		if !pat.HasScope(scope) {
+			a.Logger.Errorw("TokenMiddleware - personal access token without the required scope", "route", route, "scope", scope, "tokenID", pat.ID.Hex())
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "personal access token requires scope " + scope})
+			return
+		}
+
+		if !a.checkActiveProfile(c, pat.ProfileID.Hex()) {
+			return
+		}
+
+		// handlers read the profile from the claims, like for JWTs
+		c.Set("jwt_claims", &utils.JWTClaims{
+			ProfileID:  pat.ProfileID.Hex(),
+			TokenType:  utils.AccessToken,
+			ClientType: ClientPersonalAccessToken,
+			RegisteredClaims: jwt.RegisteredClaims{
+				Subject:   pat.ProfileID.Hex(),
+				ExpiresAt: jwt.NewNumericDate(pat.ExpiresAt),
+			},
+		})
+		c.Next()
+	}
+}
+
+// ------------------------------ Private methods ------------------------------
+
+// findPersonalAccessToken returns the unexpired personal access token of tokenString, recording its use
+func (a *Auth) findPersonalAccessToken(ctx context.Context, tokenString string, now time.Time) (*models.PersonalAccessToken, error) {
+	tokenHash, err := utils.HashAPIToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var pat models.PersonalAccessToken
+	err = a.CollPersonalAccessTokens.FindOne(ctx, bson.M{
+		"tokenHash": tokenHash,
+		"expiresAt": bson.M{"$gt": now},
+	}).Decode(&pat)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, errors.New("personal access token not found or expired")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// best-effort, a failure must not reject the request
+	_, err = a.CollPersonalAccessTokens.UpdateOne(ctx, bson.M{
+		"_id": pat.ID,
+		"$or": bson.A{
+			bson.M{"lastUsedAt": bson.M{"$exists": false}},
+			bson.M{"lastUsedAt": bson.M{"$lt": now.Add(-personalAccessTokenUseInterval)}},
+		},
+	}, bson.M{
+		"$set": bson.M{"lastUsedAt": now},
+	})
+	if err != nil {
+		a.Logger.Errorw("findPersonalAccessToken - cannot update lastUsedAt", "tokenID", pat.ID.Hex(), "error", err)
+	}
+	return &pat, nil
+}
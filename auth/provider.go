@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"api-server/models"
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Provider is an identity provider users log in with, through the authorization code flow with PKCE.
+type Provider interface {
+	// Name identifies the provider in login routes and in linked identities
+	Name() string
+	// AuthorizationURL builds the URL of the provider login page, with state, nonce and S256 PKCE challenge.
+	AuthorizationURL(ctx context.Context, client OAuthClient, state, nonce, codeChallenge string) (string, error)
+	// Identity exchanges an authorization code and its PKCE verifier,
+	// returning the identity of the logged user. Providers supporting it must verify the nonce.
+	Identity(ctx context.Context, client OAuthClient, code, pkceVerifier, nonce string) (models.Identity, error)
+}
+
+// Providers are the configured identity providers by name
+type Providers map[string]Provider
+
+// Get returns the provider called name
+func (p Providers) Get(name string) (Provider, bool) {
+	provider, ok := p[name]
+	return provider, ok
+}
+
+// Names returns the sorted names of the providers
+func (p Providers) Names() []string {
+	names := make([]string, 0, len(p))
+	for name := range p {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// providerNamePattern keeps provider names usable in routes and env variables
+var providerNamePattern = regexp.MustCompile(`^[a-z0-9]+$`)
+
+// LoadProviders returns GitHub and the OpenID Connect providers listed in OIDC_PROVIDERS, e.g. "keycloak".
+// Every OIDC provider is configured by OIDC_<NAME>_ISSUER, OIDC_<NAME>_CLIENTID, OIDC_<NAME>_SECRETID
+// and OIDC_<NAME>_CALLBACK, optionally with OIDC_<NAME>_APP_CLIENTID, OIDC_<NAME>_APP_SECRETID and
+// OIDC_<NAME>_APP_CALLBACK for the mobile app and OIDC_<NAME>_SCOPES, "openid profile email" by default.
+// Endpoints and keys of OIDC providers are discovered on first use, so it doesn't call them.
+func LoadProviders() (Providers, error) {
+	httpClient := &http.Client{
+		Timeout: 10 * time.Second,
+	}
+	providers := Providers{
+		models.IdentityProviderGitHub: &gitHubProvider{httpClient: httpClient},
+	}
+
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !providerNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("OIDC provider name %q must contain only lowercase letters and digits", name)
+		}
+		if _, exists := providers[name]; exists {
+			return nil, fmt.Errorf("OIDC provider %q is defined twice", name)
+		}
+		config, err := oidcConfigFromEnv(name)
+		if err != nil {
+			return nil, err
+		}
+		providers[name] = newOIDCProvider(config, httpClient)
+	}
+	return providers, nil
+}
+
+// gitHubProvider logs in with GitHub OAuth apps, configured by OAUTH2_* env variables.
+// GitHub isn't an OpenID Connect provider, so the nonce isn't used.
+type gitHubProvider struct {
+	httpClient *http.Client
+}
+
+func (gp *gitHubProvider) Name() string {
+	return models.IdentityProviderGitHub
+}
+
+func (gp *gitHubProvider) AuthorizationURL(_ context.Context, client OAuthClient, state, _, codeChallenge string) (string, error) {
+	return BuildGitHubAuthorizationURL(client, state, codeChallenge)
+}
+
+func (gp *gitHubProvider) Identity(ctx context.Context, client OAuthClient, code, pkceVerifier, _ string) (models.Identity, error) {
+	accessToken, err := ExchangeGitHubCodeForAccessToken(ctx, gp.httpClient, client, code, pkceVerifier)
+	if err != nil {
+		return models.Identity{}, fmt.Errorf("github token exchange failed: %w", err)
+	}
+	githubProfile, err := FetchGitHubUser(ctx, gp.httpClient, accessToken)
+	if err != nil {
+		return models.Identity{}, fmt.Errorf("could not load github profile: %w", err)
+	}
+	return models.GitHubIdentity(githubProfile), nil
+}
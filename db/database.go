@@ -1,10 +1,15 @@
 package db
 
 import (
+	"api-server/models"
+	"api-server/utils"
 	"context"
 	"errors"
 	"fmt"
 	"os"
+	"regexp"
+	"strconv"
+	"time"
 
 	"go.mongodb.org/mongo-driver/v2/bson"
 	"go.mongodb.org/mongo-driver/v2/mongo"
@@ -15,13 +20,44 @@ import (
 
 // Collections struct
 type Collections struct {
-	Profiles      *mongo.Collection
-	Homes         *mongo.Collection
-	Devices       *mongo.Collection
-	AppLoginCodes *mongo.Collection
-	RefreshTokens *mongo.Collection
+	Profiles        *mongo.Collection
+	Homes           *mongo.Collection
+	Devices         *mongo.Collection
+	AppLoginCodes   *mongo.Collection
+	RefreshTokens   *mongo.Collection
+	HomeInvitations *mongo.Collection
+	FeatureValues   *mongo.Collection
+	Scenes          *mongo.Collection
+	Schedules       *mongo.Collection
+	ScheduleRuns    *mongo.Collection
+	Leases          *mongo.Collection
+	Rules           *mongo.Collection
+	RuleExecutions  *mongo.Collection
+	// PersonalAccessTokens are tokens of scripts and integrations, see models.PersonalAccessToken
+	PersonalAccessTokens *mongo.Collection
+	// DeviceAuthorizations are pending logins of headless clients, see models.DeviceAuthorization
+	DeviceAuthorizations *mongo.Collection
+	// UserInvitations are the emails allowed to sign up, see models.UserInvitation
+	UserInvitations *mongo.Collection
+	// AuditEvents are security-relevant actions of profiles, see models.AuditEvent
+	AuditEvents *mongo.Collection
 }
 
+// scheduleRunsRetention is how long runs of schedules are kept
+const scheduleRunsRetention = 30 * 24 * time.Hour
+
+// ruleExecutionsRetention is how long executions of rules are kept
+const ruleExecutionsRetention = 30 * 24 * time.Hour
+
+// defaultFeatureValuesRetentionDays is used when FEATURE_VALUES_RETENTION_DAYS is not defined
+const defaultFeatureValuesRetentionDays = 30
+
+// defaultAuditEventsRetentionDays is used when AUDIT_EVENTS_RETENTION_DAYS is not defined
+const defaultAuditEventsRetentionDays = 90
+
+// auditEventCreatedTTLIndex is the name of the index removing old audit events
+const auditEventCreatedTTLIndex = "audit_event_created_ttl"
+
 // InitDb connects to MongoDB and ensures the required indexes.
 func InitDb(ctx context.Context, logger *zap.SugaredLogger) (*mongo.Client, error) {
 	mongoDBUrl := os.Getenv("MONGODB_URL")
@@ -39,9 +75,21 @@ func InitDb(ctx context.Context, logger *zap.SugaredLogger) (*mongo.Client, erro
 	}
 	logger.Info("Connected to MongoDB")
 
+	if err = ensureTimeSeries(ctx, client, logger); err != nil {
+		return nil, fmt.Errorf("ensure MongoDB time-series collections: %w", err)
+	}
 	if err = ensureIndexes(ctx, client, logger); err != nil {
 		return nil, fmt.Errorf("ensure MongoDB indexes: %w", err)
 	}
+	if err = migrateLegacyFCMTokens(ctx, client, logger); err != nil {
+		return nil, fmt.Errorf("migrate legacy FCM tokens: %w", err)
+	}
+	if err = migrateGitHubIdentities(ctx, client, logger); err != nil {
+		return nil, fmt.Errorf("migrate GitHub identities: %w", err)
+	}
+	if err = seedUserInvitations(ctx, client, logger); err != nil {
+		return nil, fmt.Errorf("seed user invitations: %w", err)
+	}
 
 	return client, nil
 }
@@ -50,20 +98,40 @@ func InitDb(ctx context.Context, logger *zap.SugaredLogger) (*mongo.Client, erro
 func GetCollections(client *mongo.Client) *Collections {
 	database := client.Database(getDbName())
 	return &Collections{
-		Profiles:      database.Collection("profiles"),
-		Homes:         database.Collection("homes"),
-		Devices:       database.Collection("devices"),
-		AppLoginCodes: database.Collection("app_login_codes"),
-		RefreshTokens: database.Collection("refresh_tokens"),
+		Profiles:             database.Collection("profiles"),
+		Homes:                database.Collection("homes"),
+		Devices:              database.Collection("devices"),
+		AppLoginCodes:        database.Collection("app_login_codes"),
+		RefreshTokens:        database.Collection("refresh_tokens"),
+		HomeInvitations:      database.Collection("home_invitations"),
+		FeatureValues:        database.Collection("feature_values"),
+		Scenes:               database.Collection("scenes"),
+		Schedules:            database.Collection("schedules"),
+		ScheduleRuns:         database.Collection("schedule_runs"),
+		Leases:               database.Collection("leases"),
+		Rules:                database.Collection("rules"),
+		RuleExecutions:       database.Collection("rule_executions"),
+		PersonalAccessTokens: database.Collection("personal_access_tokens"),
+		DeviceAuthorizations: database.Collection("device_authorizations"),
+		UserInvitations:      database.Collection("user_invitations"),
+		AuditEvents:          database.Collection("audit_events"),
 	}
 }
 
 func ensureIndexes(ctx context.Context, client *mongo.Client, logger *zap.SugaredLogger) error {
 	colls := GetCollections(client)
 
+	// profiles are identified by their linked identities, profiles created with other providers have github.id = 0
+	if err := colls.Profiles.Indexes().DropOne(ctx, "profile_github_id_unique"); err != nil {
+		var commandErr mongo.CommandError
+		if !errors.As(err, &commandErr) || (commandErr.Code != 26 && commandErr.Code != 27) {
+			return fmt.Errorf("cannot drop old profile_github_id_unique index: %w", err)
+		}
+	}
 	_, err := colls.Profiles.Indexes().CreateOne(ctx, mongo.IndexModel{
-		Keys:    bson.D{{Key: "github.id", Value: 1}},
-		Options: options.Index().SetUnique(true).SetName("profile_github_id_unique"),
+		Keys: bson.D{{Key: "identities.id", Value: 1}},
+		Options: options.Index().SetUnique(true).SetName("profile_identities_id_unique").
+			SetPartialFilterExpression(bson.M{"identities.id": bson.M{"$exists": true}}),
 	})
 	if err != nil {
 		return fmt.Errorf("cannot create profiles indexes: %w", err)
@@ -75,6 +143,13 @@ func ensureIndexes(ctx context.Context, client *mongo.Client, logger *zap.Sugare
 	if err != nil {
 		return fmt.Errorf("cannot create profiles apiTokenHash index: %w", err)
 	}
+	_, err = colls.Profiles.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "fcmTokens.token", Value: 1}},
+		Options: options.Index().SetName("profile_fcmTokens_token"),
+	})
+	if err != nil {
+		return fmt.Errorf("cannot create profiles fcmTokens index: %w", err)
+	}
 
 	_, err = colls.AppLoginCodes.Indexes().CreateMany(ctx, []mongo.IndexModel{
 		{
@@ -106,6 +181,10 @@ func ensureIndexes(ctx context.Context, client *mongo.Client, logger *zap.Sugare
 			Keys:    bson.D{{Key: "familyId", Value: 1}},
 			Options: options.Index().SetName("refresh_token_family"),
 		},
+		{
+			Keys:    bson.D{{Key: "profileId", Value: 1}},
+			Options: options.Index().SetName("refresh_token_profile"),
+		},
 		{
 			Keys:    bson.D{{Key: "expiresAt", Value: 1}},
 			Options: options.Index().SetExpireAfterSeconds(0).SetName("refresh_token_expires_ttl"),
@@ -115,10 +194,265 @@ func ensureIndexes(ctx context.Context, client *mongo.Client, logger *zap.Sugare
 		return fmt.Errorf("cannot create refresh_tokens indexes: %w", err)
 	}
 
+	_, err = colls.PersonalAccessTokens.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "tokenHash", Value: 1}},
+			Options: options.Index().SetUnique(true).SetName("personal_access_token_hash_unique"),
+		},
+		{
+			Keys:    bson.D{{Key: "profileId", Value: 1}},
+			Options: options.Index().SetName("personal_access_token_profile"),
+		},
+		{
+			Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0).SetName("personal_access_token_expires_ttl"),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("cannot create personal_access_tokens indexes: %w", err)
+	}
+
+	_, err = colls.DeviceAuthorizations.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "deviceCodeHash", Value: 1}},
+			Options: options.Index().SetUnique(true).SetName("device_authorization_device_code_unique"),
+		},
+		{
+			Keys:    bson.D{{Key: "userCode", Value: 1}},
+			Options: options.Index().SetUnique(true).SetName("device_authorization_user_code_unique"),
+		},
+		{
+			Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0).SetName("device_authorization_expires_ttl"),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("cannot create device_authorizations indexes: %w", err)
+	}
+
+	_, err = colls.UserInvitations.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "email", Value: 1}},
+		Options: options.Index().SetUnique(true).SetName("user_invitation_email_unique"),
+	})
+	if err != nil {
+		return fmt.Errorf("cannot create user_invitations indexes: %w", err)
+	}
+
+	_, err = colls.Homes.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "members.profileId", Value: 1}},
+		Options: options.Index().SetName("home_members_profile"),
+	})
+	if err != nil {
+		return fmt.Errorf("cannot create homes indexes: %w", err)
+	}
+
+	_, err = colls.HomeInvitations.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "codeHash", Value: 1}},
+			Options: options.Index().SetUnique(true).SetName("home_invitation_code_unique"),
+		},
+		{
+			Keys:    bson.D{{Key: "homeId", Value: 1}},
+			Options: options.Index().SetName("home_invitation_home"),
+		},
+		{
+			Keys:    bson.D{{Key: "expiresAt", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0).SetName("home_invitation_expires_ttl"),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("cannot create home_invitations indexes: %w", err)
+	}
+
+	_, err = colls.FeatureValues.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "meta.deviceId", Value: 1},
+			{Key: "meta.featureUuid", Value: 1},
+			{Key: "timestamp", Value: 1},
+		},
+		Options: options.Index().SetName("feature_value_series"),
+	})
+	if err != nil {
+		return fmt.Errorf("cannot create feature_values indexes: %w", err)
+	}
+
+	_, err = colls.Scenes.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "homeId", Value: 1}},
+			Options: options.Index().SetName("scene_home"),
+		},
+		{
+			Keys:    bson.D{{Key: "steps.deviceId", Value: 1}},
+			Options: options.Index().SetName("scene_steps_device"),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("cannot create scenes indexes: %w", err)
+	}
+
+	_, err = colls.Schedules.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "homeId", Value: 1}},
+			Options: options.Index().SetName("schedule_home"),
+		},
+		{
+			Keys:    bson.D{{Key: "deviceId", Value: 1}},
+			Options: options.Index().SetName("schedule_device"),
+		},
+		{
+			Keys:    bson.D{{Key: "enabled", Value: 1}, {Key: "nextRunAt", Value: 1}},
+			Options: options.Index().SetName("schedule_due"),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("cannot create schedules indexes: %w", err)
+	}
+
+	_, err = colls.ScheduleRuns.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "scheduleId", Value: 1}, {Key: "startedAt", Value: -1}},
+			Options: options.Index().SetName("schedule_run_schedule"),
+		},
+		{
+			Keys:    bson.D{{Key: "startedAt", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(int32(scheduleRunsRetention.Seconds())).SetName("schedule_run_started_ttl"),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("cannot create schedule_runs indexes: %w", err)
+	}
+
+	_, err = colls.Rules.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "homeId", Value: 1}},
+			Options: options.Index().SetName("rule_home"),
+		},
+		{
+			Keys:    bson.D{{Key: "condition.deviceId", Value: 1}, {Key: "condition.featureUuid", Value: 1}},
+			Options: options.Index().SetName("rule_condition_feature"),
+		},
+		{
+			Keys:    bson.D{{Key: "actions.deviceId", Value: 1}},
+			Options: options.Index().SetName("rule_actions_device"),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("cannot create rules indexes: %w", err)
+	}
+
+	_, err = colls.RuleExecutions.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "ruleId", Value: 1}, {Key: "executedAt", Value: -1}},
+			Options: options.Index().SetName("rule_execution_rule"),
+		},
+		{
+			Keys:    bson.D{{Key: "executedAt", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(int32(ruleExecutionsRetention.Seconds())).SetName("rule_execution_executed_ttl"),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("cannot create rule_executions indexes: %w", err)
+	}
+
+	_, err = colls.AuditEvents.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "actorId", Value: 1}, {Key: "_id", Value: -1}},
+		Options: options.Index().SetName("audit_event_actor"),
+	})
+	if err != nil {
+		return fmt.Errorf("cannot create audit_events indexes: %w", err)
+	}
+	if err = ensureAuditEventsRetention(ctx, client); err != nil {
+		return err
+	}
+
 	logger.Info("MongoDB indexes ensured")
 	return nil
 }
 
+// ensureAuditEventsRetention creates the TTL index of audit_events.
+// If the index already exists, its expiration is updated to the configured retention.
+func ensureAuditEventsRetention(ctx context.Context, client *mongo.Client) error {
+	retentionDays, err := getRetentionDays("AUDIT_EVENTS_RETENTION_DAYS", defaultAuditEventsRetentionDays)
+	if err != nil {
+		return err
+	}
+	expireAfterSeconds := int32(retentionDays * 24 * 60 * 60)
+
+	_, err = GetCollections(client).AuditEvents.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "createdAt", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(expireAfterSeconds).SetName(auditEventCreatedTTLIndex),
+	})
+	if err == nil {
+		return nil
+	}
+	var commandErr mongo.CommandError
+	// 85 = IndexOptionsConflict, the index exists with another expiration
+	if !errors.As(err, &commandErr) || commandErr.Code != 85 {
+		return fmt.Errorf("cannot create audit_events ttl index: %w", err)
+	}
+	err = client.Database(getDbName()).RunCommand(ctx, bson.D{
+		{Key: "collMod", Value: "audit_events"},
+		{Key: "index", Value: bson.D{
+			{Key: "name", Value: auditEventCreatedTTLIndex},
+			{Key: "expireAfterSeconds", Value: expireAfterSeconds},
+		}},
+	}).Err()
+	if err != nil {
+		return fmt.Errorf("cannot update audit_events retention: %w", err)
+	}
+	return nil
+}
+
+// ensureTimeSeries creates the feature_values time-series collection.
+// Old readings are removed by MongoDB using expireAfterSeconds, the TTL of time-series collections.
+// If the collection already exists, its retention is updated to the configured one.
+func ensureTimeSeries(ctx context.Context, client *mongo.Client, logger *zap.SugaredLogger) error {
+	retentionDays, err := getRetentionDays("FEATURE_VALUES_RETENTION_DAYS", defaultFeatureValuesRetentionDays)
+	if err != nil {
+		return err
+	}
+	expireAfterSeconds := int64(retentionDays) * 24 * 60 * 60
+
+	database := client.Database(getDbName())
+	opts := options.CreateCollection().
+		SetTimeSeriesOptions(options.TimeSeries().
+			SetTimeField("timestamp").
+			SetMetaField("meta").
+			SetGranularity("minutes")).
+		SetExpireAfterSeconds(expireAfterSeconds)
+	err = database.CreateCollection(ctx, "feature_values", opts)
+	if err != nil {
+		var commandErr mongo.CommandError
+		// 48 = NamespaceExists
+		if !errors.As(err, &commandErr) || commandErr.Code != 48 {
+			return fmt.Errorf("cannot create feature_values collection: %w", err)
+		}
+		err = database.RunCommand(ctx, bson.D{
+			{Key: "collMod", Value: "feature_values"},
+			{Key: "expireAfterSeconds", Value: expireAfterSeconds},
+		}).Err()
+		if err != nil {
+			return fmt.Errorf("cannot update feature_values retention: %w", err)
+		}
+	}
+
+	logger.Infof("MongoDB time-series ensured, feature_values retention = %d days", retentionDays)
+	return nil
+}
+
+// getRetentionDays returns the days in the envName environment variable, or defaultDays if not defined
+func getRetentionDays(envName string, defaultDays int) (int, error) {
+	raw := os.Getenv(envName)
+	if raw == "" {
+		return defaultDays, nil
+	}
+	days, err := strconv.Atoi(raw)
+	if err != nil || days <= 0 {
+		return 0, fmt.Errorf("'%s' environment variable must be a positive integer", envName)
+	}
+	return days, nil
+}
+
 // getDbName function
 func getDbName() string {
 	if os.Getenv("ENV") == "testing" {
@@ -126,3 +460,127 @@ func getDbName() string {
 	}
 	return "api-server"
 }
+
+// migrateLegacyFCMTokens moves the single FCM token of old profiles into their list of tokens.
+// Migrated profiles don't have the old fields anymore, so it does nothing on next startups.
+func migrateLegacyFCMTokens(ctx context.Context, client *mongo.Client, logger *zap.SugaredLogger) error {
+	collProfiles := GetCollections(client).Profiles
+	cur, err := collProfiles.Find(ctx, bson.M{"fcmToken": bson.M{"$exists": true}})
+	if err != nil {
+		return err
+	}
+	var profiles []struct {
+		ID                bson.ObjectID `bson:"_id"`
+		FCMToken          string        `bson:"fcmToken"`
+		FCMTokenTimestamp time.Time     `bson:"fcmTokenTimestamp"`
+	}
+	if err = cur.All(ctx, &profiles); err != nil {
+		return err
+	}
+
+	for _, profile := range profiles {
+		update := bson.M{"$unset": bson.M{"fcmToken": "", "fcmTokenTimestamp": ""}}
+		if profile.FCMToken != "" {
+			// tokens set without timestamp would be pruned immediately
+			if profile.FCMTokenTimestamp.IsZero() {
+				profile.FCMTokenTimestamp = time.Now()
+			}
+			update["$push"] = bson.M{"fcmTokens": bson.M{
+				"_id":         bson.NewObjectID(),
+				"token":       profile.FCMToken,
+				"deviceLabel": "",
+				"createdAt":   profile.FCMTokenTimestamp,
+				"lastSeenAt":  profile.FCMTokenTimestamp,
+			}}
+		}
+		if _, err = collProfiles.UpdateOne(ctx, bson.M{"_id": profile.ID}, update); err != nil {
+			return err
+		}
+	}
+	if len(profiles) > 0 {
+		logger.Infof("Migrated legacy FCM tokens of %d profiles", len(profiles))
+	}
+	return nil
+}
+
+// migrateGitHubIdentities links the GitHub account of profiles created before identities were introduced.
+// Migrated profiles have identities, so it does nothing on next startups.
+func migrateGitHubIdentities(ctx context.Context, client *mongo.Client, logger *zap.SugaredLogger) error {
+	collProfiles := GetCollections(client).Profiles
+	cur, err := collProfiles.Find(ctx, bson.M{
+		"github.id":  bson.M{"$gt": 0},
+		"identities": bson.M{"$exists": false},
+	})
+	if err != nil {
+		return err
+	}
+	var profiles []struct {
+		ID        bson.ObjectID `bson:"_id"`
+		Github    models.GitHub `bson:"github"`
+		CreatedAt time.Time     `bson:"createdAt"`
+	}
+	if err = cur.All(ctx, &profiles); err != nil {
+		return err
+	}
+
+	for _, profile := range profiles {
+		identity := models.GitHubIdentity(profile.Github)
+		identity.LinkedAt = profile.CreatedAt
+		if _, err = collProfiles.UpdateOne(ctx, bson.M{"_id": profile.ID, "identities": bson.M{"$exists": false}}, bson.M{
+			"$set": bson.M{"identities": []models.Identity{identity}},
+		}); err != nil {
+			return err
+		}
+	}
+	if len(profiles) > 0 {
+		logger.Infof("Migrated GitHub identities of %d profiles", len(profiles))
+	}
+	return nil
+}
+
+// seedUserInvitations invites the emails of ADMIN_EMAILS as admins, promoting their profiles if they exist,
+// and the ones of the deprecated LIMIT_TO_USER_EMAILS as users, so there is always an admin to invite the others.
+// Existing invitations of LIMIT_TO_USER_EMAILS are not changed, e.g. if an admin changed their role.
+func seedUserInvitations(ctx context.Context, client *mongo.Client, logger *zap.SugaredLogger) error {
+	colls := GetCollections(client)
+	now := time.Now().UTC()
+
+	for _, email := range utils.ParseEmailList(os.Getenv("ADMIN_EMAILS")) {
+		_, err := colls.UserInvitations.UpdateOne(ctx, bson.M{"email": email}, bson.M{
+			"$set":         bson.M{"role": models.ProfileRoleAdmin},
+			"$setOnInsert": bson.M{"_id": bson.NewObjectID(), "createdAt": now},
+		}, options.UpdateOne().SetUpsert(true))
+		if err != nil {
+			return err
+		}
+		res, err := colls.Profiles.UpdateMany(ctx, bson.M{
+			"identities": bson.M{"$elemMatch": bson.M{
+				"email":         bson.M{"$regex": "^" + regexp.QuoteMeta(email) + "$", "$options": "i"},
+				"emailVerified": true,
+			}},
+			"role": bson.M{"$ne": models.ProfileRoleAdmin},
+		}, bson.M{
+			"$set": bson.M{"role": models.ProfileRoleAdmin, "modifiedAt": now},
+		})
+		if err != nil {
+			return err
+		}
+		if res.ModifiedCount > 0 {
+			logger.Infof("Promoted %d profiles of ADMIN_EMAILS to admin", res.ModifiedCount)
+		}
+	}
+
+	userEmails := utils.ParseEmailList(os.Getenv("LIMIT_TO_USER_EMAILS"))
+	if len(userEmails) > 0 {
+		logger.Warn("LIMIT_TO_USER_EMAILS is deprecated, its emails are invited as users, invite the next ones with /api/admin/invitations")
+	}
+	for _, email := range userEmails {
+		_, err := colls.UserInvitations.UpdateOne(ctx, bson.M{"email": email}, bson.M{
+			"$setOnInsert": bson.M{"_id": bson.NewObjectID(), "role": models.ProfileRoleUser, "createdAt": now},
+		}, options.UpdateOne().SetUpsert(true))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
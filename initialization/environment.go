@@ -1,6 +1,7 @@
 package initialization
 
 import (
+	"api-server/auth"
 	"errors"
 	"fmt"
 	"net/url"
@@ -42,7 +43,6 @@ func readEnv() (string, error) {
 
 func printEnv(logger *zap.SugaredLogger) error {
 	required := []string{
-		"JWT_PASSWORD",
 		"JWT_REFRESH_PASSWORD",
 		"REFRESH_TOKEN_HASH_SECRET",
 		"COOKIE_SECRET",
@@ -60,9 +60,6 @@ func printEnv(logger *zap.SugaredLogger) error {
 			return fmt.Errorf("'%s' environment variable is mandatory", name)
 		}
 	}
-	if len(os.Getenv("JWT_PASSWORD")) < 32 {
-		return errors.New("'JWT_PASSWORD' environment variable must be at least 32 characters")
-	}
 	if len(os.Getenv("JWT_REFRESH_PASSWORD")) < 32 {
 		return errors.New("'JWT_REFRESH_PASSWORD' environment variable must be at least 32 characters")
 	}
@@ -92,6 +89,9 @@ func printEnv(logger *zap.SugaredLogger) error {
 	if err := validateOAuthURL("OAUTH2_APP_CALLBACK"); err != nil {
 		return err
 	}
+	if _, err := auth.LoadProviders(); err != nil {
+		return err
+	}
 	if os.Getenv("ENV") == "prod" && os.Getenv("HTTP_CORS") == "true" {
 		return errors.New("'HTTP_CORS' must be false in production")
 	}
@@ -104,6 +104,7 @@ func printEnv(logger *zap.SugaredLogger) error {
 	logger.Infof("OAUTH2_CLIENTID = %s", os.Getenv("OAUTH2_CLIENTID"))
 	logger.Infof("OAUTH2_APP_CALLBACK = %s", os.Getenv("OAUTH2_APP_CALLBACK"))
 	logger.Infof("OAUTH2_APP_CLIENTID = %s", os.Getenv("OAUTH2_APP_CLIENTID"))
+	logger.Infof("OIDC_PROVIDERS = %s", os.Getenv("OIDC_PROVIDERS"))
 	logger.Infof("HTTP_CORS = %s", os.Getenv("HTTP_CORS"))
 	logger.Infof("HTTP_SENSOR_SERVER = %s", os.Getenv("HTTP_SENSOR_SERVER"))
 	logger.Infof("HTTP_SENSOR_PORT = %s", os.Getenv("HTTP_SENSOR_PORT"))
@@ -116,14 +117,20 @@ func printEnv(logger *zap.SugaredLogger) error {
 	logger.Infof("HTTP_ONLINE_FCMTOKEN_API = %s", os.Getenv("HTTP_ONLINE_FCMTOKEN_API"))
 	logger.Infof("HTTP_ONLINE_ROTATE_APITOKEN_API = %s", os.Getenv("HTTP_ONLINE_ROTATE_APITOKEN_API"))
 	logger.Infof("HTTP_ONLINE_KEEPALIVE_API = %s", os.Getenv("HTTP_ONLINE_KEEPALIVE_API"))
+	logger.Infof("FEATURE_VALUES_RETENTION_DAYS = %s", os.Getenv("FEATURE_VALUES_RETENTION_DAYS"))
+	logger.Infof("AUDIT_EVENTS_RETENTION_DAYS = %s", os.Getenv("AUDIT_EVENTS_RETENTION_DAYS"))
 	logger.Infof("GRPC_URL = %s", os.Getenv("GRPC_URL"))
 	logger.Infof("GRPC_TLS = %s", os.Getenv("GRPC_TLS"))
+	logger.Infof("GRPC_MTLS = %s", os.Getenv("GRPC_MTLS"))
+	logger.Infof("GRPC_TLS_SERVER_NAME = %s", os.Getenv("GRPC_TLS_SERVER_NAME"))
 	logger.Infof("CERT_FOLDER_PATH = %s", os.Getenv("CERT_FOLDER_PATH"))
-	logger.Infof("LIMIT_TO_USER_EMAILS = %s", os.Getenv("LIMIT_TO_USER_EMAILS"))
+	logger.Infof("ADMIN_EMAILS = %s", os.Getenv("ADMIN_EMAILS"))
+	logger.Infof("LIMIT_TO_USER_EMAILS (deprecated) = %s", os.Getenv("LIMIT_TO_USER_EMAILS"))
 	logger.Infof("INTERNAL_CLUSTER_PATH = %s", os.Getenv("INTERNAL_CLUSTER_PATH"))
+	logger.Infof("JWT_KEYS_FOLDER_PATH = %s", os.Getenv("JWT_KEYS_FOLDER_PATH"))
+	logger.Infof("JWT_SIGNING_KEY_ID = %s", os.Getenv("JWT_SIGNING_KEY_ID"))
 	logger.Infof("MONGODB_URL = [redacted]")
 	logger.Infof("COOKIE_SECRET = [redacted]")
-	logger.Infof("JWT_PASSWORD = [redacted]")
 	logger.Infof("JWT_REFRESH_PASSWORD = [redacted]")
 	logger.Infof("API_TOKEN_HASH_SECRET = [redacted]")
 	logger.Infof("API_TOKEN_ENCRYPTION_KEY = [redacted]")
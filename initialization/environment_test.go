@@ -10,7 +10,6 @@ func setValidEnv(t *testing.T) {
 	t.Helper()
 
 	t.Setenv("ENV", "prod")
-	t.Setenv("JWT_PASSWORD", "0123456789abcdef0123456789abcdef")
 	t.Setenv("JWT_REFRESH_PASSWORD", "fedcba9876543210fedcba9876543210")
 	t.Setenv("REFRESH_TOKEN_HASH_SECRET", "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa")
 	t.Setenv("COOKIE_SECRET", "bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb")
@@ -77,3 +76,28 @@ func TestPrintEnvRejectsProdCors(t *testing.T) {
 		t.Fatal("expected error for prod HTTP_CORS=true")
 	}
 }
+
+func TestPrintEnvAcceptsOIDCProvider(t *testing.T) {
+	setValidEnv(t)
+	t.Setenv("OIDC_PROVIDERS", "keycloak")
+	t.Setenv("OIDC_KEYCLOAK_ISSUER", "https://sso.example.com/realms/home")
+	t.Setenv("OIDC_KEYCLOAK_CLIENTID", "client-id")
+	t.Setenv("OIDC_KEYCLOAK_SECRETID", "secret-id")
+	t.Setenv("OIDC_KEYCLOAK_CALLBACK", "https://home.example.com/api/oauth/providers/keycloak/callback")
+
+	if err := printEnv(zap.NewNop().Sugar()); err != nil {
+		t.Fatalf("expected valid OIDC provider, got %v", err)
+	}
+}
+
+func TestPrintEnvRejectsOIDCProviderWithoutIssuer(t *testing.T) {
+	setValidEnv(t)
+	t.Setenv("OIDC_PROVIDERS", "keycloak")
+	t.Setenv("OIDC_KEYCLOAK_CLIENTID", "client-id")
+	t.Setenv("OIDC_KEYCLOAK_SECRETID", "secret-id")
+	t.Setenv("OIDC_KEYCLOAK_CALLBACK", "https://home.example.com/api/oauth/providers/keycloak/callback")
+
+	if err := printEnv(zap.NewNop().Sugar()); err == nil {
+		t.Fatal("expected error for OIDC provider without issuer")
+	}
+}
@@ -0,0 +1,67 @@
+package initialization
+
+import (
+	"api-server/utils"
+	"fmt"
+	"os"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	// registers the client side health checking, enabled by healthCheckConfig
+	_ "google.golang.org/grpc/health"
+	"google.golang.org/grpc/keepalive"
+)
+
+// devicesServiceConfig balances calls between all addresses of GRPC_URL, skipping the unhealthy ones,
+// and retries calls failed before reaching api-devices.
+// If api-devices doesn't implement the health service, its addresses are considered healthy.
+const devicesServiceConfig = `{
+	"loadBalancingConfig": [{"round_robin": {}}],
+	"healthCheckConfig": {"serviceName": ""},
+	"methodConfig": [{
+		"name": [{"service": "device.Device"}],
+		"retryPolicy": {
+			"maxAttempts": 3,
+			"initialBackoff": "0.1s",
+			"maxBackoff": "1s",
+			"backoffMultiplier": 2,
+			"retryableStatusCodes": ["UNAVAILABLE"]
+		}
+	}]
+}`
+
+// devicesKeepalive pings api-devices only while calls are in progress,
+// so it doesn't break the default enforcement policy of gRPC servers.
+var devicesKeepalive = keepalive.ClientParameters{
+	Time:                time.Minute,
+	Timeout:             20 * time.Second,
+	PermitWithoutStream: false,
+}
+
+// InitDevicesGrpc creates the long-lived connection to api-devices at GRPC_URL, shared by all handlers.
+// It fails if the transport security is misconfigured, e.g. certificates cannot be read.
+// The connection is established lazily by the first call, so api-devices doesn't need to be up at startup.
+// The caller must close it on shutdown.
+func InitDevicesGrpc(logger *zap.SugaredLogger) (*grpc.ClientConn, error) {
+	transportConfig := utils.GrpcTransportConfigFromEnv()
+	securityDialOption, err := utils.BuildSecurityDialOption(transportConfig)
+	if err != nil {
+		return nil, fmt.Errorf("cannot build security dial option: %w", err)
+	}
+	logger.Infow("InitDevicesGrpc - transport security",
+		"tls", transportConfig.TLS,
+		"mutualTLS", transportConfig.MutualTLS,
+		"serverName", transportConfig.ServerName,
+	)
+
+	conn, err := grpc.NewClient(os.Getenv("GRPC_URL"),
+		securityDialOption,
+		grpc.WithDefaultServiceConfig(devicesServiceConfig),
+		grpc.WithKeepaliveParams(devicesKeepalive),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create gRPC client: %w", err)
+	}
+	return conn, nil
+}
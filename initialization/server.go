@@ -3,6 +3,7 @@ package initialization
 import (
 	"api-server/api"
 	authpkg "api-server/auth"
+	"api-server/models"
 	"api-server/utils"
 	"crypto/sha256"
 	"net/http"
@@ -12,10 +13,10 @@ import (
 	"strings"
 
 	"github.com/gin-contrib/cors"
+	"github.com/gin-contrib/gzip"
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-contrib/sessions/cookie"
 	limits "github.com/gin-contrib/size"
-	"github.com/gin-gonic/contrib/gzip"
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
 	"go.mongodb.org/mongo-driver/v2/mongo"
@@ -55,7 +56,8 @@ func SetupRouter(logger *zap.SugaredLogger) *gin.Engine {
 	router := gin.New()
 	router.Use(gin.Recovery())
 	router.Use(sessions.Sessions(utils.SessionName, store))
-	router.Use(gzip.Gzip(gzip.DefaultCompression))
+	// streamed responses must reach clients when flushed, while gzip buffers them
+	router.Use(gzip.Gzip(gzip.DefaultCompression, gzip.WithExcludedPaths([]string{"/api/events", "/api/profile/export"})))
 
 	// 5. fix a max POST payload size
 	const maxRequestBodySize = 1 * 1024 * 1024 // 1 MB
@@ -121,46 +123,111 @@ func SetupRouter(logger *zap.SugaredLogger) *gin.Engine {
 	return router
 }
 
+// personalAccessTokenScopes are the private routes personal access tokens can call, with the required scope.
+// Routes not listed here, e.g. profile, members, sessions and tokens, require a login.
+var personalAccessTokenScopes = authpkg.RouteScopes{
+	"GET /api/homes":                           models.ScopeHomesRead,
+	"GET /api/homes/:id/rooms":                 models.ScopeHomesRead,
+	"GET /api/homes/:id/config":                models.ScopeHomesRead,
+	"GET /api/homes/:id/dashboard":             models.ScopeHomesRead,
+	"GET /api/homes/:id/rooms/:rid/dashboard":  models.ScopeHomesRead,
+	"GET /api/homes/:id/scenes":                models.ScopeHomesRead,
+	"GET /api/homes/:id/schedules":             models.ScopeHomesRead,
+	"GET /api/homes/:id/schedules/:sid/runs":   models.ScopeHomesRead,
+	"GET /api/homes/:id/rules":                 models.ScopeHomesRead,
+	"GET /api/homes/:id/rules/:rid/executions": models.ScopeHomesRead,
+
+	"POST /api/homes":                        models.ScopeHomesWrite,
+	"PUT /api/homes/:id":                     models.ScopeHomesWrite,
+	"DELETE /api/homes/:id":                  models.ScopeHomesWrite,
+	"POST /api/homes/:id/rooms":              models.ScopeHomesWrite,
+	"PUT /api/homes/:id/rooms/:rid":          models.ScopeHomesWrite,
+	"DELETE /api/homes/:id/rooms/:rid":       models.ScopeHomesWrite,
+	"PUT /api/homes/:id/config":              models.ScopeHomesWrite,
+	"POST /api/homes/:id/scenes":             models.ScopeHomesWrite,
+	"PUT /api/homes/:id/scenes/:sid":         models.ScopeHomesWrite,
+	"DELETE /api/homes/:id/scenes/:sid":      models.ScopeHomesWrite,
+	"POST /api/homes/:id/schedules":          models.ScopeHomesWrite,
+	"PUT /api/homes/:id/schedules/:sid":      models.ScopeHomesWrite,
+	"DELETE /api/homes/:id/schedules/:sid":   models.ScopeHomesWrite,
+	"POST /api/homes/:id/rules":              models.ScopeHomesWrite,
+	"PUT /api/homes/:id/rules/:rid":          models.ScopeHomesWrite,
+	"DELETE /api/homes/:id/rules/:rid":       models.ScopeHomesWrite,
+	"POST /api/homes/:id/rules/:rid/dry-run": models.ScopeHomesWrite,
+
+	"GET /api/devices":                   models.ScopeDevicesRead,
+	"GET /api/online/:id":                models.ScopeDevicesRead,
+	"PUT /api/devices/:id":               models.ScopeDevicesWrite,
+	"PATCH /api/devices/:id":             models.ScopeDevicesWrite,
+	"DELETE /api/devices/:id/assignment": models.ScopeDevicesWrite,
+	"DELETE /api/devices/:id":            models.ScopeDevicesWrite,
+
+	"GET /api/devices/:id/values":                models.ScopeValuesRead,
+	"GET /api/devices/:id/features/:fid/history": models.ScopeValuesRead,
+	"GET /api/events":                            models.ScopeValuesRead,
+	"POST /api/devices/:id/values":               models.ScopeValuesWrite,
+	"POST /api/scenes/:id/activate":              models.ScopeValuesWrite,
+}
+
 // RegisterRoutes function
-func RegisterRoutes(router *gin.Engine, logger *zap.SugaredLogger, validate *validator.Validate, client *mongo.Client) {
-	auth := authpkg.NewAuth(logger, client)
+func RegisterRoutes(router *gin.Engine, logger *zap.SugaredLogger, validate *validator.Validate, client *mongo.Client, devicesValues *api.DevicesValues, eventsHub *api.EventsHub, auditLog *api.AuditLog, jwtKeys *utils.JWTKeySet) {
+	auth := authpkg.NewAuth(logger, client, jwtKeys)
 
-	oauthGithub := api.NewGitHubWebHandler(auth, logger, client, "oauth2_state",
+	oauthGithub := api.NewGitHubWebHandler(auth, logger, client, auditLog, "oauth2_state",
 		"oauth2_web_pkce_verifier")
 
-	oauthAppGithub := api.NewGitHubAppHandler(auth, logger, client, "oauth2_app_state",
+	oauthAppGithub := api.NewGitHubAppHandler(auth, logger, client, auditLog, "oauth2_app_state",
 		"oauth2_app_pkce_challenge")
-	oauthHandler := api.NewOAuthHandler(logger, client)
+	oauthHandler := api.NewOAuthHandler(logger, client, jwtKeys, auditLog)
+	jwks := api.NewJWKS(logger, jwtKeys)
 
 	keepAlive := api.NewKeepAlive(logger)
-	homes := api.NewHomes(logger, client, validate)
-	devices := api.NewDevices(logger, client, validate)
-	devicesValues := api.NewDevicesValues(logger, client, validate)
-	profiles := api.NewProfiles(logger, client, validate)
+	homes := api.NewHomes(logger, client, validate, eventsHub)
+	homeMembers := api.NewHomeMembers(logger, client, validate, eventsHub)
+	scenes := api.NewScenes(logger, client, validate, devicesValues)
+	schedules := api.NewSchedules(logger, client, validate, devicesValues)
+	rules := api.NewRules(logger, client, validate, devicesValues)
+	devices := api.NewDevices(logger, client, validate, eventsHub)
+	profiles := api.NewProfiles(logger, client, validate, auditLog)
 	// FCM = Firebase Cloud Messaging => identify a smartphone on Firebase to send notifications
-	fcmToken := api.NewFCMToken(logger, client, validate)
+	fcmToken := api.NewFCMToken(logger, client, validate, auditLog)
 	online := api.NewOnline(logger, client)
+	dashboard := api.NewDashboard(logger, client, devicesValues)
+	events := api.NewEvents(logger, eventsHub)
+	personalAccessTokens := api.NewPersonalAccessTokens(logger, client, validate)
+	adminUsers := api.NewAdminUsers(logger, client, validate)
+	auditEvents := api.NewAuditEvents(logger, client)
 
 	router.GET("/api/keepalive", keepAlive.GetKeepAlive)
+	router.GET("/.well-known/jwks.json", jwks.GetJWKS)
 	oauth := router.Group("/api/oauth")
 	{
 		// web app
 		oauth.GET("/login", oauthGithub.GitHubLogin)
 		oauth.GET("/callback", oauthGithub.GitHubCallback)
+		oauth.GET("/providers/:provider/login", oauthGithub.ProviderLogin)
+		oauth.GET("/providers/:provider/callback", oauthGithub.ProviderCallback)
 		// mobile app
 		oauth.GET("/app/login", oauthAppGithub.GitHubAppLogin)
 		oauth.GET("/app/callback", oauthAppGithub.GitHubAppCallback)
+		oauth.GET("/app/providers/:provider/login", oauthAppGithub.ProviderAppLogin)
+		oauth.GET("/app/providers/:provider/callback", oauthAppGithub.ProviderAppCallback)
 		oauth.POST("/app/exchange-code", oauthAppGithub.ExchangeAppCode)
 		oauth.POST("/app/refresh", oauthHandler.RefreshMobileToken)
 		oauth.POST("/app/logout", oauthHandler.LogoutApp)
+		// headless clients, with the device authorization grant
+		oauth.POST("/device/code", oauthHandler.PostDeviceCode)
+		oauth.POST("/device/token", oauthHandler.PostDeviceToken)
 		// common
+		oauth.GET("/providers", oauthGithub.GetProviders)
 		oauth.POST("/refresh", oauthHandler.RefreshToken)
 		oauth.POST("/logout", oauthHandler.Logout)
 	}
 
-	// Define private APIs (/api group) protected via JWTMiddleware
+	// Define private APIs (/api group) protected via JWTMiddleware,
+	// or via personal access tokens for the routes in personalAccessTokenScopes
 	private := router.Group("/api")
-	private.Use(auth.JWTMiddleware())
+	private.Use(auth.TokenMiddleware(personalAccessTokenScopes))
 	{
 		private.GET("/homes", homes.GetHomes)
 		private.POST("/homes", homes.PostHome)
@@ -170,19 +237,84 @@ func RegisterRoutes(router *gin.Engine, logger *zap.SugaredLogger, validate *val
 		private.POST("/homes/:id/rooms", homes.PostRoom)
 		private.PUT("/homes/:id/rooms/:rid", homes.PutRoom)
 		private.DELETE("/homes/:id/rooms/:rid", homes.DeleteRoom)
+		private.GET("/homes/:id/config", homes.GetHomeConfig)
+		private.PUT("/homes/:id/config", homes.PutHomeConfig)
+		private.GET("/homes/:id/dashboard", dashboard.GetHomeDashboard)
+		private.GET("/homes/:id/rooms/:rid/dashboard", dashboard.GetRoomDashboard)
+		private.GET("/homes/:id/members", homeMembers.GetMembers)
+		private.DELETE("/homes/:id/members/:pid", homeMembers.DeleteMember)
+		private.POST("/homes/:id/members/invitations", homeMembers.PostInvitation)
+		private.DELETE("/homes/:id/members/invitations/:iid", homeMembers.DeleteInvitation)
+		private.POST("/homes/:id/members/accept", homeMembers.PostAcceptInvitation)
+		private.GET("/homes/:id/scenes", scenes.GetScenes)
+		private.POST("/homes/:id/scenes", scenes.PostScene)
+		private.PUT("/homes/:id/scenes/:sid", scenes.PutScene)
+		private.DELETE("/homes/:id/scenes/:sid", scenes.DeleteScene)
+		private.POST("/scenes/:id/activate", scenes.PostActivateScene)
+		private.GET("/homes/:id/schedules", schedules.GetSchedules)
+		private.POST("/homes/:id/schedules", schedules.PostSchedule)
+		private.PUT("/homes/:id/schedules/:sid", schedules.PutSchedule)
+		private.DELETE("/homes/:id/schedules/:sid", schedules.DeleteSchedule)
+		private.GET("/homes/:id/schedules/:sid/runs", schedules.GetScheduleRuns)
+		private.GET("/homes/:id/rules", rules.GetRules)
+		private.POST("/homes/:id/rules", rules.PostRule)
+		private.PUT("/homes/:id/rules/:rid", rules.PutRule)
+		private.DELETE("/homes/:id/rules/:rid", rules.DeleteRule)
+		private.POST("/homes/:id/rules/:rid/dry-run", rules.PostDryRunRule)
+		private.GET("/homes/:id/rules/:rid/executions", rules.GetRuleExecutions)
 
 		private.GET("/profile", profiles.GetProfile)
+		private.GET("/profile/export", profiles.GetProfileExport)
+		private.POST("/profile/deletion-token", profiles.PostProfileDeletionToken)
+		private.DELETE("/profile", profiles.DeleteProfile)
 		private.POST("/profiles/:id/tokens", profiles.PostRotateAPIToken)
 		private.POST("/profiles/:id/fcmTokens", profiles.PostProfilesFCMToken)
 
 		private.GET("/devices", devices.GetDevices)
 		private.PUT("/devices/:id", devices.PutAssignDeviceToHomeRoom)
+		private.PATCH("/devices/:id", devices.PatchDevice)
+		private.DELETE("/devices/:id/assignment", devices.DeleteDeviceAssignment)
 		private.DELETE("/devices/:id", devices.DeleteDevice)
 
 		private.GET("/devices/:id/values", devicesValues.GetValuesDevice)
 		private.POST("/devices/:id/values", devicesValues.PostValuesDevice)
+		private.GET("/devices/:id/features/:fid/history", devicesValues.GetFeatureHistory)
 
 		private.POST("/fcmtoken", fcmToken.PostFCMToken)
+		private.GET("/fcmtoken", fcmToken.GetFCMTokens)
+		private.DELETE("/fcmtoken/:id", fcmToken.DeleteFCMToken)
 		private.GET("/online/:id", online.GetOnline)
+
+		private.GET("/events", events.GetEvents)
+
+		private.GET("/sessions", oauthHandler.GetSessions)
+		private.DELETE("/sessions", oauthHandler.DeleteOtherSessions)
+		private.DELETE("/sessions/:familyId", oauthHandler.DeleteSession)
+
+		private.GET("/identities", oauthGithub.GetIdentities)
+		private.POST("/identities/:provider/link", oauthGithub.LinkIdentity)
+		private.DELETE("/identities/:provider", oauthGithub.DeleteIdentity)
+
+		// approval of headless clients, from the /device page of the web app
+		private.GET("/device-codes/:userCode", oauthHandler.GetDeviceAuthorization)
+		private.POST("/device-codes/:userCode/approve", oauthHandler.PostApproveDeviceAuthorization)
+		private.POST("/device-codes/:userCode/deny", oauthHandler.PostDenyDeviceAuthorization)
+
+		private.GET("/personal-access-tokens", personalAccessTokens.GetPersonalAccessTokens)
+		private.POST("/personal-access-tokens", personalAccessTokens.PostPersonalAccessToken)
+		private.DELETE("/personal-access-tokens/:id", personalAccessTokens.DeletePersonalAccessToken)
+
+		private.GET("/audit", auditEvents.GetAuditEvents)
+	}
+	admin := private.Group("/admin")
+	admin.Use(auth.AdminMiddleware())
+	{
+		admin.GET("/users", adminUsers.GetUsers)
+		admin.POST("/users/:id/suspend", adminUsers.PostSuspendUser)
+		admin.POST("/users/:id/reactivate", adminUsers.PostReactivateUser)
+		admin.DELETE("/users/:id", adminUsers.DeleteUser)
+		admin.GET("/invitations", adminUsers.GetInvitations)
+		admin.POST("/invitations", adminUsers.PostInvitation)
+		admin.DELETE("/invitations/:id", adminUsers.DeleteInvitation)
 	}
 }
@@ -0,0 +1,48 @@
+package initialization
+
+import (
+	"api-server/api"
+	"api-server/utils"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+	"go.uber.org/zap"
+)
+
+func TestPersonalAccessTokenScopesMatchRoutes(t *testing.T) {
+	logger := zap.NewNop().Sugar()
+	// the client connects lazily, routes are registered without a database
+	client, err := mongo.Connect(options.Client().ApplyURI("mongodb://localhost:27017"))
+	if err != nil {
+		t.Fatalf("mongo.Connect() error = %v", err)
+	}
+	jwtKeys, err := utils.LoadJWTKeys(utils.JWTKeysConfig{AllowEphemeral: true})
+	if err != nil {
+		t.Fatalf("LoadJWTKeys() error = %v", err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	validate := validator.New()
+	events := api.NewEventsHub(logger, client)
+	devicesValues := api.NewDevicesValues(logger, client, validate, nil, events, nil)
+	RegisterRoutes(router, logger, validate, client, devicesValues, events, nil, jwtKeys)
+
+	routes := make(map[string]bool)
+	for _, route := range router.Routes() {
+		routes[route.Method+" "+route.Path] = true
+	}
+	for route := range personalAccessTokenScopes {
+		if !routes[route] {
+			t.Errorf("personalAccessTokenScopes has %q, but it is not a route", route)
+		}
+	}
+	for _, route := range []string{"GET /api/profile", "GET /api/sessions", "POST /api/personal-access-tokens", "GET /api/admin/users", "GET /api/audit"} {
+		if _, found := personalAccessTokenScopes[route]; found {
+			t.Errorf("personalAccessTokenScopes must not allow %q", route)
+		}
+	}
+}
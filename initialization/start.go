@@ -1,7 +1,10 @@
 package initialization
 
 import (
+	"api-server/api"
+	pb "api-server/api/grpc/device"
 	"api-server/db"
+	"api-server/utils"
 	"context"
 	"fmt"
 	"os"
@@ -11,17 +14,36 @@ import (
 	"github.com/go-playground/validator/v10"
 	"go.mongodb.org/mongo-driver/v2/mongo"
 	"go.uber.org/zap"
+	"google.golang.org/grpc"
 )
 
-// Start initializes logger, environment, database, and router.
-func Start() (*zap.SugaredLogger, *gin.Engine, *mongo.Client, error) {
+// Services are long-lived dependencies shared by handlers and background jobs.
+type Services struct {
+	// DevicesConn is the gRPC connection to api-devices, the caller of Start must close it on shutdown
+	DevicesConn *grpc.ClientConn
+	Events      *api.EventsHub
+	// Audit writes audit events in background, the caller of Start must close it on shutdown to write the last ones
+	Audit *api.AuditLog
+	// DevicesValues reads and sets values of devices for handlers and schedules, evaluating rules with a single engine
+	DevicesValues *api.DevicesValues
+	// JWTKeys sign and verify access tokens
+	JWTKeys *utils.JWTKeySet
+}
+
+// Start initializes logger, environment, database, gRPC connection to api-devices, events hub, and router.
+func Start() (*zap.SugaredLogger, *gin.Engine, *mongo.Client, *Services, error) {
 	// 1. Init logger
 	logger := InitLogger()
 
 	// 2. Init env
 	if err := InitEnv(logger); err != nil {
-		return logger, nil, nil, fmt.Errorf("init env: %w", err)
+		return logger, nil, nil, nil, fmt.Errorf("init env: %w", err)
 	}
+	jwtKeys, err := utils.LoadJWTKeys(utils.JWTKeysConfigFromEnv())
+	if err != nil {
+		return logger, nil, nil, nil, fmt.Errorf("init jwt keys: %w", err)
+	}
+	logger.Infof("Start - JWTs are signed with key %s", jwtKeys.SigningKeyID())
 
 	// 3. Init db
 	// Connect to DB
@@ -29,40 +51,67 @@ func Start() (*zap.SugaredLogger, *gin.Engine, *mongo.Client, error) {
 	defer cancel()
 	mongoDbClient, err := db.InitDb(ctx, logger)
 	if err != nil {
-		return logger, nil, nil, fmt.Errorf("init db: %w", err)
+		return logger, nil, nil, nil, fmt.Errorf("init db: %w", err)
+	}
+
+	// 4. Init gRPC connection to api-devices
+	devicesConn, err := InitDevicesGrpc(logger)
+	if err != nil {
+		return logger, nil, mongoDbClient, nil, fmt.Errorf("init grpc: %w", err)
+	}
+
+	// 5. Init events hub, shared by handlers and schedules publishing changes, audit log and device values.
+	// Create a singleton validator instance. Validate is designed to be used as a singleton instance.
+	// It caches information about struct and validations.
+	validate := validator.New()
+	services := &Services{
+		DevicesConn: devicesConn,
+		Events:      api.NewEventsHub(logger, mongoDbClient),
+		Audit:       api.NewAuditLog(logger, mongoDbClient),
+		JWTKeys:     jwtKeys,
 	}
+	services.DevicesValues = api.NewDevicesValues(logger, mongoDbClient, validate, pb.NewDeviceClient(devicesConn), services.Events, services.Audit)
 
-	// 4. Init server
-	router := BuildServer(logger, mongoDbClient)
+	// 6. Init server
+	router := BuildServer(logger, mongoDbClient, validate, services.DevicesValues, services.Events, services.Audit, services.JWTKeys)
 
-	return logger, router, mongoDbClient, nil
+	return logger, router, mongoDbClient, services, nil
 }
 
 // MustStart initializes the application and panics on error. It is intended for tests.
+// Services are not returned, because the gRPC connection stays idle without calls.
 func MustStart() (*zap.SugaredLogger, *gin.Engine, *mongo.Client) {
-	logger, router, mongoDbClient, err := Start()
+	logger, router, mongoDbClient, _, err := Start()
 	if err != nil {
 		panic(err)
 	}
 	return logger, router, mongoDbClient
 }
 
-// BuildServer - Exposed only for testing purposes
-func BuildServer(logger *zap.SugaredLogger, client *mongo.Client) *gin.Engine {
-	// Create a singleton validator instance. Validate is designed to be used as a singleton instance.
-	// It caches information about struct and validations.
-	validate := validator.New()
-
+// BuildServer - Exposed only for testing purposes, devicesValues can be built with a fake device client
+func BuildServer(logger *zap.SugaredLogger, client *mongo.Client, validate *validator.Validate, devicesValues *api.DevicesValues, events *api.EventsHub, audit *api.AuditLog, jwtKeys *utils.JWTKeySet) *gin.Engine {
 	// Config Gin framework mode based on env
 	setGinMode()
 
 	// Instantiate GIN and apply some middlewares
 	logger.Info("BuildServer - GIN - Initializing...")
 	router := SetupRouter(logger)
-	RegisterRoutes(router, logger, validate, client)
+	RegisterRoutes(router, logger, validate, client, devicesValues, events, audit, jwtKeys)
 	return router
 }
 
+// StartScheduleRunner executes schedules in background until ctx is done.
+// The returned channel is closed when the runner has stopped, after releasing its lease.
+func StartScheduleRunner(ctx context.Context, logger *zap.SugaredLogger, client *mongo.Client, services *Services) <-chan struct{} {
+	runner := api.NewScheduleRunner(logger, client, services.DevicesValues)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		runner.Start(ctx)
+	}()
+	return done
+}
+
 func setGinMode() {
 	if os.Getenv("ENV") == "prod" {
 		gin.SetMode(gin.ReleaseMode)
@@ -0,0 +1,164 @@
+package integration_tests
+
+import (
+	"api-server/api"
+	"api-server/db"
+	"api-server/initialization"
+	"api-server/models"
+	"api-server/testuutils"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.uber.org/zap"
+)
+
+var _ = Describe("Admin", func() {
+	var ctx context.Context
+	var logger *zap.SugaredLogger
+	var router *gin.Engine
+	var client *mongo.Client
+	var collProfiles *mongo.Collection
+	var collRefreshTokens *mongo.Collection
+	var collUserInvitations *mongo.Collection
+	var jwtToken string
+	var cookieSession string
+	var adminProfile models.Profile
+	var userProfile models.Profile
+	var userJwt string
+
+	call := func(method, url, token, cookie string, body any) *httptest.ResponseRecorder {
+		var payload []byte
+		if body != nil {
+			var err error
+			payload, err = json.Marshal(body)
+			Expect(err).ShouldNot(HaveOccurred())
+		}
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest(method, url, bytes.NewReader(payload))
+		req.Header.Add("Content-Type", "application/json")
+		if cookie != "" {
+			req.Header.Add("Cookie", cookie)
+		}
+		req.Header.Add("Authorization", "Bearer "+token)
+		router.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+
+		err := os.Setenv("ADMIN_EMAILS", "test@test.com")
+		Expect(err).ShouldNot(HaveOccurred())
+
+		logger, router, client = initialization.MustStart()
+		defer logger.Sync()
+
+		collProfiles = db.GetCollections(client).Profiles
+		collRefreshTokens = db.GetCollections(client).RefreshTokens
+		collUserInvitations = db.GetCollections(client).UserInvitations
+
+		jwtToken, cookieSession = testuutils.GetJwt(router)
+		adminProfile = testuutils.GetLoggedProfile(router, jwtToken, cookieSession)
+
+		userProfile = models.Profile{
+			ID:         bson.NewObjectID(),
+			Github:     models.GitHub{Login: "user", Email: "user@test.com"},
+			Role:       models.ProfileRoleUser,
+			CreatedAt:  time.Now(),
+			ModifiedAt: time.Now(),
+		}
+		Expect(testuutils.InsertOne(ctx, collProfiles, userProfile)).To(Succeed())
+		userJwt = testuutils.GetJwtForProfile(userProfile)
+	})
+
+	AfterEach(func() {
+		Expect(os.Unsetenv("ADMIN_EMAILS")).To(Succeed())
+		testuutils.DropAllCollections(ctx, collProfiles, collRefreshTokens, collUserInvitations)
+	})
+
+	It("should make the users of ADMIN_EMAILS admins", func() {
+		Expect(adminProfile.Role).To(Equal(models.ProfileRoleAdmin))
+
+		recorder := call(http.MethodGet, "/api/admin/users", jwtToken, cookieSession, nil)
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+		var users []api.AdminUserRes
+		Expect(json.Unmarshal(recorder.Body.Bytes(), &users)).To(Succeed())
+		Expect(users).To(HaveLen(2))
+	})
+
+	It("should not allow users without the admin role", func() {
+		recorder := call(http.MethodGet, "/api/admin/users", userJwt, "", nil)
+		Expect(recorder.Code).To(Equal(http.StatusForbidden))
+		recorder = call(http.MethodPost, "/api/admin/invitations", userJwt, "", api.UserInvitationNewReq{Email: "other@test.com"})
+		Expect(recorder.Code).To(Equal(http.StatusForbidden))
+	})
+
+	It("should invite, list and delete invitations", func() {
+		recorder := call(http.MethodPost, "/api/admin/invitations", jwtToken, cookieSession, api.UserInvitationNewReq{Email: " Other@Test.com"})
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+		var invitation models.UserInvitation
+		Expect(json.Unmarshal(recorder.Body.Bytes(), &invitation)).To(Succeed())
+		Expect(invitation.Email).To(Equal("other@test.com"))
+		Expect(invitation.Role).To(Equal(models.ProfileRoleUser))
+
+		recorder = call(http.MethodPost, "/api/admin/invitations", jwtToken, cookieSession, api.UserInvitationNewReq{Email: "other@test.com", Role: models.ProfileRoleAdmin})
+		Expect(recorder.Code).To(Equal(http.StatusConflict))
+		recorder = call(http.MethodPost, "/api/admin/invitations", jwtToken, cookieSession, api.UserInvitationNewReq{Email: "other@test.com", Role: "owner"})
+		Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+
+		recorder = call(http.MethodGet, "/api/admin/invitations", jwtToken, cookieSession, nil)
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+		var invitations []models.UserInvitation
+		Expect(json.Unmarshal(recorder.Body.Bytes(), &invitations)).To(Succeed())
+		Expect(invitations).To(HaveLen(2))
+
+		recorder = call(http.MethodDelete, "/api/admin/invitations/"+invitation.ID.Hex(), jwtToken, cookieSession, nil)
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+		recorder = call(http.MethodDelete, "/api/admin/invitations/"+invitation.ID.Hex(), jwtToken, cookieSession, nil)
+		Expect(recorder.Code).To(Equal(http.StatusNotFound))
+	})
+
+	It("should suspend and reactivate a user", func() {
+		recorder := call(http.MethodGet, "/api/profile", userJwt, "", nil)
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+
+		recorder = call(http.MethodPost, "/api/admin/users/"+userProfile.ID.Hex()+"/suspend", jwtToken, cookieSession, nil)
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+		recorder = call(http.MethodGet, "/api/profile", userJwt, "", nil)
+		Expect(recorder.Code).To(Equal(http.StatusForbidden))
+
+		recorder = call(http.MethodPost, "/api/admin/users/"+userProfile.ID.Hex()+"/reactivate", jwtToken, cookieSession, nil)
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+		recorder = call(http.MethodGet, "/api/profile", userJwt, "", nil)
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+	})
+
+	It("should delete a user", func() {
+		recorder := call(http.MethodDelete, "/api/admin/users/"+userProfile.ID.Hex(), jwtToken, cookieSession, nil)
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+		_, err := testuutils.FindOneById[models.Profile](ctx, collProfiles, userProfile.ID)
+		Expect(err).To(MatchError(mongo.ErrNoDocuments))
+		recorder = call(http.MethodGet, "/api/profile", userJwt, "", nil)
+		Expect(recorder.Code).To(Equal(http.StatusUnauthorized))
+
+		recorder = call(http.MethodDelete, "/api/admin/users/"+userProfile.ID.Hex(), jwtToken, cookieSession, nil)
+		Expect(recorder.Code).To(Equal(http.StatusNotFound))
+	})
+
+	It("should not allow admins to suspend or delete themselves", func() {
+		recorder := call(http.MethodPost, "/api/admin/users/"+adminProfile.ID.Hex()+"/suspend", jwtToken, cookieSession, nil)
+		Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+		recorder = call(http.MethodDelete, "/api/admin/users/"+adminProfile.ID.Hex(), jwtToken, cookieSession, nil)
+		Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+	})
+})
@@ -175,7 +175,8 @@ var _ = Describe("AssignDevices", func() {
 
 				deviceFromDb, err := testuutils.FindOneById[models.Device](ctx, collDevices, deviceController.ID)
 				Expect(err).ShouldNot(HaveOccurred())
-				Expect(deviceFromDb.Name).To(Equal("my-controller"))
+				Expect(deviceFromDb.Overrides.Name).To(Equal("my-controller"))
+				Expect(deviceFromDb.Name).To(Equal(deviceController.Name))
 			})
 
 			It("should assign device to home+room using MAC address as default name", func() {
@@ -210,7 +211,8 @@ var _ = Describe("AssignDevices", func() {
 
 				deviceFromDb, err := testuutils.FindOneById[models.Device](ctx, collDevices, deviceController.ID)
 				Expect(err).ShouldNot(HaveOccurred())
-				Expect(deviceFromDb.Name).To(Equal(deviceController.Mac))
+				Expect(deviceFromDb.Overrides.Name).To(Equal(deviceController.Mac))
+				Expect(deviceFromDb.Name).To(Equal(deviceController.Name))
 			})
 
 			It("should not assign device because name exceeds 32 characters", func() {
@@ -605,4 +607,161 @@ var _ = Describe("AssignDevices", func() {
 			})
 		})
 	})
+
+	Context("calling assignDevice api DELETE", func() {
+		BeforeEach(func() {
+			err := testuutils.InsertOne(ctx, collHomes, home)
+			Expect(err).ShouldNot(HaveOccurred())
+			err = testuutils.InsertOne(ctx, collHomes, home2)
+			Expect(err).ShouldNot(HaveOccurred())
+			err = testuutils.InsertOne(ctx, collDevices, deviceController)
+			Expect(err).ShouldNot(HaveOccurred())
+			err = testuutils.InsertOne(ctx, collDevices, deviceSensor)
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+
+		deleteAssignment := func(jwtToken, cookieSession, deviceID string) *httptest.ResponseRecorder {
+			recorder := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodDelete, "/api/devices/"+deviceID+"/assignment", nil)
+			req.Header.Add("Cookie", cookieSession)
+			req.Header.Add("Authorization", "Bearer "+jwtToken)
+			router.ServeHTTP(recorder, req)
+			return recorder
+		}
+
+		When("device is assigned to a room of a home of the profile", func() {
+			It("should unassign device from all rooms, without changing other profiles", func() {
+				jwtToken, cookieSession := testuutils.GetJwt(router)
+				profileRes := testuutils.GetLoggedProfile(router, jwtToken, cookieSession)
+
+				err := testuutils.AssignDeviceToProfile(ctx, collProfiles, profileRes.ID, deviceController.ID)
+				Expect(err).ShouldNot(HaveOccurred())
+				err = testuutils.AssignHomeToProfile(ctx, collProfiles, profileRes.ID, home.ID)
+				Expect(err).ShouldNot(HaveOccurred())
+				err = testuutils.AssignDeviceToHomeAndRoom(ctx, collHomes, home.ID, home.Rooms[1].ID, deviceController.ID)
+				Expect(err).ShouldNot(HaveOccurred())
+				// `home2` isn't a home of the profile
+				err = testuutils.AssignDeviceToHomeAndRoom(ctx, collHomes, home2.ID, home2.Rooms[0].ID, deviceController.ID)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				recorder := deleteAssignment(jwtToken, cookieSession, deviceController.ID.Hex())
+				Expect(recorder.Code).To(Equal(http.StatusOK))
+				Expect(recorder.Body.String()).To(Equal(`{"message":"device has been unassigned"}`))
+
+				homeFromDb, err := testuutils.FindOneById[models.Home](ctx, collHomes, home.ID)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(homeFromDb.Rooms[0].Devices).To(HaveLen(0))
+				Expect(homeFromDb.Rooms[1].Devices).To(HaveLen(0))
+				home2FromDb, err := testuutils.FindOneById[models.Home](ctx, collHomes, home2.ID)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(home2FromDb.Rooms[0].Devices).To(ConsistOf(deviceController.ID))
+				// the device is unassigned, not deleted
+				_, err = testuutils.FindOneById[models.Device](ctx, collDevices, deviceController.ID)
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		When("you pass bad inputs", func() {
+			It("should not unassign device, because of bad deviceId", func() {
+				jwtToken, cookieSession := testuutils.GetJwt(router)
+
+				recorder := deleteAssignment(jwtToken, cookieSession, "bad_device_id")
+				Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+				Expect(recorder.Body.String()).To(Equal(`{"error":"wrong format of device 'id' path param"}`))
+			})
+
+			It("should not unassign device, because it is not assigned to a home of the profile", func() {
+				jwtToken, cookieSession := testuutils.GetJwt(router)
+				profileRes := testuutils.GetLoggedProfile(router, jwtToken, cookieSession)
+
+				err := testuutils.AssignDeviceToProfile(ctx, collProfiles, profileRes.ID, deviceController.ID)
+				Expect(err).ShouldNot(HaveOccurred())
+				err = testuutils.AssignHomeToProfile(ctx, collProfiles, profileRes.ID, home.ID)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				recorder := deleteAssignment(jwtToken, cookieSession, deviceController.ID.Hex())
+				Expect(recorder.Code).To(Equal(http.StatusNotFound))
+				Expect(recorder.Body.String()).To(Equal(`{"error":"device is not assigned to a room of your homes"}`))
+			})
+		})
+	})
+
+	Context("calling devices api GET with locations", func() {
+		BeforeEach(func() {
+			err := testuutils.InsertOne(ctx, collHomes, home)
+			Expect(err).ShouldNot(HaveOccurred())
+			err = testuutils.InsertOne(ctx, collDevices, deviceController)
+			Expect(err).ShouldNot(HaveOccurred())
+			err = testuutils.InsertOne(ctx, collDevices, deviceSensor)
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+
+		getDevices := func(jwtToken, cookieSession, query string) *httptest.ResponseRecorder {
+			recorder := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/api/devices"+query, nil)
+			req.Header.Add("Cookie", cookieSession)
+			req.Header.Add("Authorization", "Bearer "+jwtToken)
+			router.ServeHTTP(recorder, req)
+			return recorder
+		}
+
+		When("profile owns an assigned device and an unassigned one", func() {
+			It("should get devices with their locations, filtered by assignment", func() {
+				jwtToken, cookieSession := testuutils.GetJwt(router)
+				profileRes := testuutils.GetLoggedProfile(router, jwtToken, cookieSession)
+
+				err := testuutils.AssignDeviceToProfile(ctx, collProfiles, profileRes.ID, deviceController.ID)
+				Expect(err).ShouldNot(HaveOccurred())
+				err = testuutils.AssignDeviceToProfile(ctx, collProfiles, profileRes.ID, deviceSensor.ID)
+				Expect(err).ShouldNot(HaveOccurred())
+				err = testuutils.AssignHomeToProfile(ctx, collProfiles, profileRes.ID, home.ID)
+				Expect(err).ShouldNot(HaveOccurred())
+				err = testuutils.AssignDeviceToHomeAndRoom(ctx, collHomes, home.ID, home.Rooms[1].ID, deviceController.ID)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				recorder := getDevices(jwtToken, cookieSession, "")
+				Expect(recorder.Code).To(Equal(http.StatusOK))
+				var devices []api.DeviceRes
+				err = json.Unmarshal(recorder.Body.Bytes(), &devices)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(devices).To(HaveLen(2))
+				for _, device := range devices {
+					if device.ID == deviceController.ID {
+						Expect(*device.Location).To(Equal(api.DeviceLocation{
+							HomeID:   home.ID,
+							HomeName: home.Name,
+							RoomID:   home.Rooms[1].ID,
+							RoomName: home.Rooms[1].Name,
+						}))
+					} else {
+						Expect(device.Location).To(BeNil())
+					}
+				}
+
+				recorder = getDevices(jwtToken, cookieSession, "?assigned=false")
+				Expect(recorder.Code).To(Equal(http.StatusOK))
+				err = json.Unmarshal(recorder.Body.Bytes(), &devices)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(devices).To(HaveLen(1))
+				Expect(devices[0].ID).To(Equal(deviceSensor.ID))
+
+				recorder = getDevices(jwtToken, cookieSession, "?assigned=true")
+				Expect(recorder.Code).To(Equal(http.StatusOK))
+				err = json.Unmarshal(recorder.Body.Bytes(), &devices)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(devices).To(HaveLen(1))
+				Expect(devices[0].ID).To(Equal(deviceController.ID))
+			})
+		})
+
+		When("you pass bad inputs", func() {
+			It("should return an error, because of bad query param 'assigned'", func() {
+				jwtToken, cookieSession := testuutils.GetJwt(router)
+
+				recorder := getDevices(jwtToken, cookieSession, "?assigned=maybe")
+				Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+				Expect(recorder.Body.String()).To(Equal(`{"error":"wrong format of the query param 'assigned'"}`))
+			})
+		})
+	})
 })
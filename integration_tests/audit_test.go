@@ -0,0 +1,157 @@
+package integration_tests
+
+import (
+	"api-server/api"
+	"api-server/db"
+	"api-server/initialization"
+	"api-server/models"
+	"api-server/testuutils"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.uber.org/zap"
+)
+
+var _ = Describe("Audit", func() {
+	var ctx context.Context
+	var logger *zap.SugaredLogger
+	var router *gin.Engine
+	var client *mongo.Client
+	var collProfiles *mongo.Collection
+	var collAuditEvents *mongo.Collection
+	var jwtToken string
+	var cookieSession string
+	var profile models.Profile
+
+	getAuditEvents := func(query string) (int, api.AuditEventsRes) {
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/api/audit"+query, nil)
+		req.Header.Add("Cookie", cookieSession)
+		req.Header.Add("Authorization", "Bearer "+jwtToken)
+		router.ServeHTTP(recorder, req)
+		var res api.AuditEventsRes
+		if recorder.Code == http.StatusOK {
+			Expect(json.Unmarshal(recorder.Body.Bytes(), &res)).To(Succeed())
+		}
+		return recorder.Code, res
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+
+		err := os.Setenv("LIMIT_TO_USER_EMAILS", "test@test.com")
+		Expect(err).ShouldNot(HaveOccurred())
+
+		logger, router, client = initialization.MustStart()
+		defer logger.Sync()
+
+		collProfiles = db.GetCollections(client).Profiles
+		collAuditEvents = db.GetCollections(client).AuditEvents
+
+		jwtToken, cookieSession = testuutils.GetJwt(router)
+		profile = testuutils.GetLoggedProfile(router, jwtToken, cookieSession)
+	})
+
+	AfterEach(func() {
+		testuutils.DropAllCollections(ctx, collProfiles, collAuditEvents)
+	})
+
+	It("should record logins and FCM token registrations of the profile", func() {
+		body, err := json.Marshal(api.ProfileUpdateFCMTokenReq{FCMToken: "MOCKED_FCM_TOKEN"})
+		Expect(err).ShouldNot(HaveOccurred())
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/profiles/"+profile.ID.Hex()+"/fcmTokens", bytes.NewReader(body))
+		req.Header.Add("Cookie", cookieSession)
+		req.Header.Add("Authorization", "Bearer "+jwtToken)
+		req.Header.Add("Content-Type", `application/json`)
+		req.Header.Add("User-Agent", "audit-test")
+		router.ServeHTTP(recorder, req)
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+
+		// events are written in background
+		Eventually(func() []models.AuditEvent {
+			_, res := getAuditEvents("")
+			return res.Events
+		}, 5*time.Second, 100*time.Millisecond).Should(HaveLen(2))
+
+		code, res := getAuditEvents("?action=" + string(models.AuditActionFCMTokenRegistered))
+		Expect(code).To(Equal(http.StatusOK))
+		Expect(res.Events).To(HaveLen(1))
+		Expect(res.Events[0].ActorID).To(Equal(profile.ID))
+		Expect(res.Events[0].Outcome).To(Equal(models.AuditOutcomeSuccess))
+		Expect(res.Events[0].UserAgent).To(Equal("audit-test"))
+		Expect(res.Events[0].ClientType).To(Equal("web"))
+		Expect(res.NextBefore).To(BeEmpty())
+
+		code, res = getAuditEvents("?action=" + string(models.AuditActionLogin))
+		Expect(code).To(Equal(http.StatusOK))
+		Expect(res.Events).To(HaveLen(1))
+		Expect(res.Events[0].Outcome).To(Equal(models.AuditOutcomeSuccess))
+	})
+
+	It("should page and filter events of the profile only", func() {
+		// wait for the login of BeforeEach, then replace it with known events
+		Eventually(func() int64 {
+			count, _ := collAuditEvents.CountDocuments(ctx, bson.M{})
+			return count
+		}, 5*time.Second, 100*time.Millisecond).Should(BeEquivalentTo(1))
+		_, err := collAuditEvents.DeleteMany(ctx, bson.M{})
+		Expect(err).ShouldNot(HaveOccurred())
+
+		start := time.Now().UTC().Add(-time.Hour).Truncate(time.Second)
+		for i := 0; i < 5; i++ {
+			outcome := models.AuditOutcomeSuccess
+			if i%2 == 1 {
+				outcome = models.AuditOutcomeFailure
+			}
+			err = testuutils.InsertOne(ctx, collAuditEvents, models.AuditEvent{
+				ID:        bson.NewObjectID(),
+				ActorID:   profile.ID,
+				Action:    models.AuditActionDeviceValuesSet,
+				Outcome:   outcome,
+				CreatedAt: start.Add(time.Duration(i) * time.Minute),
+			})
+			Expect(err).ShouldNot(HaveOccurred())
+		}
+		err = testuutils.InsertOne(ctx, collAuditEvents, models.AuditEvent{
+			ID:        bson.NewObjectID(),
+			ActorID:   bson.NewObjectID(),
+			Action:    models.AuditActionLogin,
+			Outcome:   models.AuditOutcomeSuccess,
+			CreatedAt: start,
+		})
+		Expect(err).ShouldNot(HaveOccurred())
+
+		code, res := getAuditEvents("?limit=3")
+		Expect(code).To(Equal(http.StatusOK))
+		Expect(res.Events).To(HaveLen(3))
+		Expect(res.Events[0].CreatedAt).To(BeTemporally("==", start.Add(4*time.Minute)))
+		Expect(res.NextBefore).To(Equal(res.Events[2].ID.Hex()))
+		code, res = getAuditEvents("?limit=3&before=" + res.NextBefore)
+		Expect(code).To(Equal(http.StatusOK))
+		Expect(res.Events).To(HaveLen(2))
+		Expect(res.NextBefore).To(BeEmpty())
+
+		_, res = getAuditEvents("?outcome=failure")
+		Expect(res.Events).To(HaveLen(2))
+		_, res = getAuditEvents("?from=" + start.Add(2*time.Minute).Format(time.RFC3339) + "&to=" + start.Add(4*time.Minute).Format(time.RFC3339))
+		Expect(res.Events).To(HaveLen(2))
+
+		code, _ = getAuditEvents("?outcome=unknown")
+		Expect(code).To(Equal(http.StatusBadRequest))
+		code, _ = getAuditEvents("?limit=1000")
+		Expect(code).To(Equal(http.StatusBadRequest))
+		code, _ = getAuditEvents("?before=wrong")
+		Expect(code).To(Equal(http.StatusBadRequest))
+	})
+})
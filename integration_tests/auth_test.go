@@ -7,18 +7,24 @@ import (
 	"api-server/testuutils"
 	"api-server/utils"
 	"context"
+	"crypto/ed25519"
+	"crypto/rand"
 	"crypto/sha256"
+	"crypto/x509"
 	"encoding/json"
+	"encoding/pem"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-contrib/sessions/cookie"
 	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"go.mongodb.org/mongo-driver/v2/bson"
@@ -100,7 +106,7 @@ var _ = Describe("LoginGithub", func() {
 
 			// create an expired JWT
 			expirationTime := time.Now().Add(-60 * time.Minute)
-			tokenString, err := utils.CreateJWT(profileRes, expirationTime, utils.AccessToken, "web", []byte(os.Getenv("JWT_PASSWORD")))
+			tokenString, err := utils.CreateJWT(profileRes, expirationTime, utils.AccessToken, "web", "", testuutils.GetJWTKeys())
 			Expect(err).ShouldNot(HaveOccurred())
 			logger.Infof("tokenString = %s", tokenString)
 
@@ -118,7 +124,7 @@ var _ = Describe("LoginGithub", func() {
 			profileRes := testuutils.GetLoggedProfile(router, jwtToken, cookieSession)
 
 			expirationTime := time.Now().Add(60 * time.Minute)
-			refreshTokenString, err := utils.CreateJWT(profileRes, expirationTime, utils.RefreshToken, "web", []byte(os.Getenv("JWT_PASSWORD")))
+			refreshTokenString, err := utils.CreateJWT(profileRes, expirationTime, utils.RefreshToken, "web", "", testuutils.GetJWTKeys())
 			Expect(err).ShouldNot(HaveOccurred())
 
 			recorder := httptest.NewRecorder()
@@ -130,6 +136,32 @@ var _ = Describe("LoginGithub", func() {
 			Expect(recorder.Body.String()).To(Equal(`{"error":"token is not an access token"}`))
 		})
 
+		It("should reject a token signed with an unknown key", func() {
+			jwtToken, cookieSession := testuutils.GetJwt(router)
+			profileRes := testuutils.GetLoggedProfile(router, jwtToken, cookieSession)
+
+			// a key folder with a key unknown by the server
+			keysFolder := GinkgoT().TempDir()
+			_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+			Expect(err).ShouldNot(HaveOccurred())
+			der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+			Expect(err).ShouldNot(HaveOccurred())
+			err = os.WriteFile(filepath.Join(keysFolder, "unknown.pem"), pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600)
+			Expect(err).ShouldNot(HaveOccurred())
+			unknownKeys, err := utils.LoadJWTKeys(utils.JWTKeysConfig{KeysFolderPath: keysFolder, SigningKeyID: "unknown"})
+			Expect(err).ShouldNot(HaveOccurred())
+			tokenString, err := utils.CreateJWT(profileRes, time.Now().Add(60*time.Minute), utils.AccessToken, "web", "", unknownKeys)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			recorder := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "/api/profile", nil)
+			req.Header.Add("Cookie", cookieSession)
+			req.Header.Add("Authorization", "Bearer "+tokenString)
+			router.ServeHTTP(recorder, req)
+			Expect(recorder.Code).To(Equal(http.StatusUnauthorized))
+			Expect(recorder.Body.String()).To(Equal(`{"error":"not logged, token is not valid"}`))
+		})
+
 		It("should reject requests when JWT and session belong to different users", func() {
 			jwtToken, cookieSession := testuutils.GetJwt(router)
 			profileRes := testuutils.GetLoggedProfile(router, jwtToken, cookieSession)
@@ -195,6 +227,29 @@ var _ = Describe("LoginGithub", func() {
 		})
 	})
 
+	Context("calling jwks api", func() {
+		It("should publish the public key verifying access tokens", func() {
+			jwtToken, _ := testuutils.GetJwt(router)
+			parsed, _, err := jwt.NewParser().ParseUnverified(jwtToken, &utils.JWTClaims{})
+			Expect(err).ShouldNot(HaveOccurred())
+
+			recorder := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "/.well-known/jwks.json", nil)
+			router.ServeHTTP(recorder, req)
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			Expect(recorder.Header().Get("Cache-Control")).To(Equal("public, max-age=300"))
+			var jwks struct {
+				Keys []utils.JSONWebKey `json:"keys"`
+			}
+			err = json.Unmarshal(recorder.Body.Bytes(), &jwks)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(jwks.Keys).To(ContainElement(HaveField("KeyID", parsed.Header["kid"])))
+			for _, key := range jwks.Keys {
+				Expect(key.Algorithm).To(BeElementOf("EdDSA", "ES256"))
+			}
+		})
+	})
+
 	Context("calling refresh token api", func() {
 		It("should return a new access token with a valid refresh token cookie", func() {
 			_, cookieSession := testuutils.GetJwt(router)
@@ -253,7 +308,7 @@ var _ = Describe("LoginGithub", func() {
 			profileRes := testuutils.GetLoggedProfile(router, jwtToken, cookieSession)
 
 			expirationTime := time.Now().Add(60 * time.Minute)
-			accessToken, err := utils.CreateJWT(profileRes, expirationTime, utils.AccessToken, "web", []byte(os.Getenv("JWT_REFRESH_PASSWORD")))
+			accessToken, err := utils.CreateJWT(profileRes, expirationTime, utils.AccessToken, "web", "", testuutils.GetJWTKeys())
 			Expect(err).ShouldNot(HaveOccurred())
 
 			recorder := httptest.NewRecorder()
@@ -0,0 +1,211 @@
+package integration_tests
+
+import (
+	"api-server/api"
+	"api-server/api/grpc/device"
+	"api-server/db"
+	"api-server/initialization"
+	"api-server/models"
+	"api-server/testuutils"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+)
+
+var _ = Describe("Dashboard", func() {
+	var ctx context.Context
+	var logger *zap.SugaredLogger
+	var router *gin.Engine
+	var client *mongo.Client
+	var collProfiles *mongo.Collection
+	var collHomes *mongo.Collection
+	var collDevices *mongo.Collection
+	var grpcMockServer *grpc.Server
+	var oldGRPCURL string
+	var oldGRPCURLSet bool
+
+	var dashboardDate = time.Now()
+	var deviceAc models.Device
+	var missingDeviceID bson.ObjectID
+	var home models.Home
+
+	getDashboard := func(jwtToken, cookieSession, url string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, url, nil)
+		req.Header.Add("Cookie", cookieSession)
+		req.Header.Add("Authorization", "Bearer "+jwtToken)
+		router.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+
+		// GRPC_URL must point to the mock listener before MustStart creates the gRPC connection
+		grpcListener, errGrpc := net.Listen("tcp", "127.0.0.1:0")
+		Expect(errGrpc).ShouldNot(HaveOccurred())
+		oldGRPCURL, oldGRPCURLSet = os.LookupEnv("GRPC_URL")
+		err := os.Setenv("GRPC_URL", grpcListener.Addr().String())
+		Expect(err).ShouldNot(HaveOccurred())
+		err = os.Setenv("LIMIT_TO_USER_EMAILS", "test@test.com")
+		Expect(err).ShouldNot(HaveOccurred())
+
+		logger, router, client = initialization.MustStart()
+		defer logger.Sync()
+
+		collProfiles = db.GetCollections(client).Profiles
+		collHomes = db.GetCollections(client).Homes
+		collDevices = db.GetCollections(client).Devices
+
+		grpcMockServer = grpc.NewServer()
+		device.RegisterDeviceServer(grpcMockServer, newDeviceGrpc(ctx, logger))
+		go func() {
+			defer GinkgoRecover()
+			errGrpc := grpcMockServer.Serve(grpcListener)
+			if errGrpc != nil && !errors.Is(errGrpc, grpc.ErrServerStopped) {
+				Fail(fmt.Sprintf("gRPC mock server failed: %v", errGrpc))
+			}
+		}()
+
+		deviceAc = models.Device{
+			ID:           bson.NewObjectID(),
+			Mac:          "FF:22:33:44:55:66",
+			Manufacturer: "test",
+			Model:        "test",
+			UUID:         uuid.NewString(),
+			Features: []models.Feature{{
+				UUID:   uuid.NewString(),
+				Type:   "controller",
+				Name:   "setpoint",
+				Enable: true,
+				Order:  1,
+				Unit:   "°C",
+			}},
+			CreatedAt:  dashboardDate,
+			ModifiedAt: dashboardDate,
+		}
+		err = testuutils.InsertOne(ctx, collDevices, deviceAc)
+		Expect(err).ShouldNot(HaveOccurred())
+		// assigned to a room, but deleted in the meantime
+		missingDeviceID = bson.NewObjectID()
+
+		home = models.Home{
+			ID:       bson.NewObjectID(),
+			Name:     "home1",
+			Location: "location1",
+			Rooms: []models.Room{{
+				ID:         bson.NewObjectID(),
+				Name:       "room1",
+				Floor:      1,
+				CreatedAt:  dashboardDate,
+				ModifiedAt: dashboardDate,
+				Devices:    []bson.ObjectID{deviceAc.ID},
+			}, {
+				ID:         bson.NewObjectID(),
+				Name:       "room2",
+				Floor:      2,
+				CreatedAt:  dashboardDate,
+				ModifiedAt: dashboardDate,
+				Devices:    []bson.ObjectID{missingDeviceID},
+			}},
+			CreatedAt:  dashboardDate,
+			ModifiedAt: dashboardDate,
+		}
+		err = testuutils.InsertOne(ctx, collHomes, home)
+		Expect(err).ShouldNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		grpcMockServer.Stop()
+		testuutils.DropAllCollections(ctx, collProfiles, collHomes, collDevices)
+		if oldGRPCURLSet {
+			Expect(os.Setenv("GRPC_URL", oldGRPCURL)).To(Succeed())
+		} else {
+			Expect(os.Unsetenv("GRPC_URL")).To(Succeed())
+		}
+	})
+
+	Context("calling dashboard api", func() {
+		When("profile owns the home", func() {
+			var jwtToken string
+			var cookieSession string
+
+			BeforeEach(func() {
+				jwtToken, cookieSession = testuutils.GetJwt(router)
+				profileID := testuutils.GetLoggedProfile(router, jwtToken, cookieSession).ID
+				err := testuutils.AssignHomeToProfile(ctx, collProfiles, profileID, home.ID)
+				Expect(err).ShouldNot(HaveOccurred())
+				err = testuutils.AssignDeviceToProfile(ctx, collProfiles, profileID, deviceAc.ID)
+				Expect(err).ShouldNot(HaveOccurred())
+				err = testuutils.SetAPITokenToProfile(ctx, collProfiles, profileID, uuid.NewString())
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+
+			It("should return all rooms with devices and values, marking missing devices", func() {
+				recorder := getDashboard(jwtToken, cookieSession, "/api/homes/"+home.ID.Hex()+"/dashboard")
+				Expect(recorder.Code).To(Equal(http.StatusOK))
+				var dashboard api.DashboardResp
+				err := json.Unmarshal(recorder.Body.Bytes(), &dashboard)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(dashboard.HomeID).To(Equal(home.ID))
+				Expect(dashboard.Partial).To(BeTrue())
+				Expect(dashboard.Rooms).To(HaveLen(2))
+
+				Expect(dashboard.Rooms[0].Devices).To(HaveLen(1))
+				acDashboard := dashboard.Rooms[0].Devices[0]
+				Expect(acDashboard.Device.ID).To(Equal(deviceAc.ID))
+				Expect(acDashboard.Error).To(BeEmpty())
+				Expect(acDashboard.Values).To(HaveLen(1))
+				Expect(acDashboard.Values[0].FeatureUUID).To(Equal(deviceAc.Features[0].UUID))
+				Expect(acDashboard.Values[0].Value).To(Equal(controllerValue))
+				Expect(acDashboard.Values[0].Error).To(BeEmpty())
+
+				Expect(dashboard.Rooms[1].Devices).To(HaveLen(1))
+				Expect(dashboard.Rooms[1].Devices[0].Device.ID).To(Equal(missingDeviceID))
+				Expect(dashboard.Rooms[1].Devices[0].Error).To(Equal("device not found"))
+			})
+
+			It("should return a single room", func() {
+				recorder := getDashboard(jwtToken, cookieSession, "/api/homes/"+home.ID.Hex()+"/rooms/"+home.Rooms[0].ID.Hex()+"/dashboard")
+				Expect(recorder.Code).To(Equal(http.StatusOK))
+				var dashboard api.DashboardResp
+				err := json.Unmarshal(recorder.Body.Bytes(), &dashboard)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(dashboard.Partial).To(BeFalse())
+				Expect(dashboard.Rooms).To(HaveLen(1))
+				Expect(dashboard.Rooms[0].ID).To(Equal(home.Rooms[0].ID))
+				Expect(dashboard.Rooms[0].Devices).To(HaveLen(1))
+			})
+
+			It("should return an error, if the room doesn't exist", func() {
+				recorder := getDashboard(jwtToken, cookieSession, "/api/homes/"+home.ID.Hex()+"/rooms/"+bson.NewObjectID().Hex()+"/dashboard")
+				Expect(recorder.Code).To(Equal(http.StatusNotFound))
+				Expect(recorder.Body.String()).To(Equal(`{"error":"room not found"}`))
+			})
+		})
+
+		When("profile is not a member of the home", func() {
+			It("should return an error", func() {
+				jwtToken, cookieSession := testuutils.GetJwt(router)
+				recorder := getDashboard(jwtToken, cookieSession, "/api/homes/"+home.ID.Hex()+"/dashboard")
+				Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+				Expect(recorder.Body.String()).To(Equal(`{"error":"cannot get dashboard of an home that is not in your profile"}`))
+			})
+		})
+	})
+})
@@ -0,0 +1,210 @@
+package integration_tests
+
+import (
+	"api-server/api"
+	"api-server/db"
+	"api-server/initialization"
+	"api-server/models"
+	"api-server/testuutils"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.uber.org/zap"
+)
+
+var _ = Describe("DeviceLogin", func() {
+	var ctx context.Context
+	var logger *zap.SugaredLogger
+	var router *gin.Engine
+	var client *mongo.Client
+	var collProfiles *mongo.Collection
+	var collRefreshTokens *mongo.Collection
+	var collDeviceAuthorizations *mongo.Collection
+
+	postForm := func(path string, form url.Values) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		router.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	callPrivate := func(method, path, jwtToken, cookieSession string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, nil)
+		if cookieSession != "" {
+			req.Header.Add("Cookie", cookieSession)
+		}
+		req.Header.Add("Authorization", "Bearer "+jwtToken)
+		router.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	requestDeviceCode := func() api.DeviceCodeResp {
+		recorder := postForm("/api/oauth/device/code", url.Values{})
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+		var res api.DeviceCodeResp
+		Expect(json.Unmarshal(recorder.Body.Bytes(), &res)).To(Succeed())
+		return res
+	}
+
+	pollDeviceToken := func(deviceCode string) *httptest.ResponseRecorder {
+		return postForm("/api/oauth/device/token", url.Values{
+			"grant_type":  {"urn:ietf:params:oauth:grant-type:device_code"},
+			"device_code": {deviceCode},
+		})
+	}
+
+	expectOAuthError := func(recorder *httptest.ResponseRecorder, oauthError string) {
+		Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+		Expect(recorder.Body.String()).To(MatchJSON(`{"error":"` + oauthError + `"}`))
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+
+		err := os.Setenv("LIMIT_TO_USER_EMAILS", "test@test.com")
+		Expect(err).ShouldNot(HaveOccurred())
+
+		logger, router, client = initialization.MustStart()
+		defer logger.Sync()
+
+		collProfiles = db.GetCollections(client).Profiles
+		collRefreshTokens = db.GetCollections(client).RefreshTokens
+		collDeviceAuthorizations = db.GetCollections(client).DeviceAuthorizations
+	})
+
+	AfterEach(func() {
+		testuutils.DropAllCollections(ctx, collProfiles, collRefreshTokens, collDeviceAuthorizations)
+	})
+
+	Context("logging in with a device code", func() {
+		It("should issue tokens once the user code is approved", func() {
+			jwtToken, cookieSession := testuutils.GetJwt(router)
+			profile := testuutils.GetLoggedProfile(router, jwtToken, cookieSession)
+
+			deviceCode := requestDeviceCode()
+			Expect(deviceCode.UserCode).To(MatchRegexp(`^[A-Z]{4}-[A-Z]{4}$`))
+			Expect(deviceCode.VerificationURI).To(HaveSuffix("/device"))
+			Expect(deviceCode.VerificationURIComplete).To(Equal(deviceCode.VerificationURI + "?user_code=" + deviceCode.UserCode))
+			Expect(deviceCode.ExpiresIn).To(Equal(600))
+			Expect(deviceCode.Interval).To(Equal(5))
+
+			expectOAuthError(pollDeviceToken(deviceCode.DeviceCode), "authorization_pending")
+			// polling again before the interval
+			expectOAuthError(pollDeviceToken(deviceCode.DeviceCode), "slow_down")
+
+			// the user code is accepted as typed by the user
+			typedUserCode := strings.ToLower(strings.ReplaceAll(deviceCode.UserCode, "-", ""))
+			recorder := callPrivate(http.MethodGet, "/api/device-codes/"+typedUserCode, jwtToken, cookieSession)
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			var authorization models.DeviceAuthorization
+			Expect(json.Unmarshal(recorder.Body.Bytes(), &authorization)).To(Succeed())
+			Expect(authorization.UserCode).To(Equal(deviceCode.UserCode))
+			Expect(authorization.Status).To(Equal(models.DeviceAuthorizationPending))
+
+			recorder = callPrivate(http.MethodPost, "/api/device-codes/"+deviceCode.UserCode+"/approve", jwtToken, cookieSession)
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			recorder = callPrivate(http.MethodPost, "/api/device-codes/"+deviceCode.UserCode+"/deny", jwtToken, cookieSession)
+			Expect(recorder.Code).To(Equal(http.StatusNotFound))
+
+			recorder = pollDeviceToken(deviceCode.DeviceCode)
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			Expect(recorder.Header().Get("Cache-Control")).To(Equal("no-store"))
+			var tokens api.DeviceTokenResp
+			Expect(json.Unmarshal(recorder.Body.Bytes(), &tokens)).To(Succeed())
+			Expect(tokens.TokenType).To(Equal("Bearer"))
+			Expect(tokens.ExpiresIn).To(Equal(900))
+			Expect(tokens.RefreshToken).ToNot(BeEmpty())
+
+			// device clients have no web session
+			Expect(testuutils.GetLoggedProfile(router, tokens.AccessToken, "").ID).To(Equal(profile.ID))
+			var refreshToken models.RefreshToken
+			Expect(collRefreshTokens.FindOne(ctx, bson.M{"clientType": "device"}).Decode(&refreshToken)).To(Succeed())
+			Expect(refreshToken.ProfileID).To(Equal(profile.ID))
+
+			// tokens are issued once
+			expectOAuthError(pollDeviceToken(deviceCode.DeviceCode), "invalid_grant")
+		})
+
+		It("should refresh tokens with the refresh_token grant", func() {
+			jwtToken, cookieSession := testuutils.GetJwt(router)
+			deviceCode := requestDeviceCode()
+			Expect(callPrivate(http.MethodPost, "/api/device-codes/"+deviceCode.UserCode+"/approve", jwtToken, cookieSession).Code).To(Equal(http.StatusOK))
+			recorder := pollDeviceToken(deviceCode.DeviceCode)
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			var tokens api.DeviceTokenResp
+			Expect(json.Unmarshal(recorder.Body.Bytes(), &tokens)).To(Succeed())
+
+			refresh := func(refreshToken string) *httptest.ResponseRecorder {
+				return postForm("/api/oauth/device/token", url.Values{
+					"grant_type":    {"refresh_token"},
+					"refresh_token": {refreshToken},
+				})
+			}
+			recorder = refresh(tokens.RefreshToken)
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			var refreshed api.DeviceTokenResp
+			Expect(json.Unmarshal(recorder.Body.Bytes(), &refreshed)).To(Succeed())
+			Expect(refreshed.RefreshToken).ToNot(Equal(tokens.RefreshToken))
+			testuutils.GetLoggedProfile(router, refreshed.AccessToken, "")
+
+			// refresh tokens are rotated
+			expectOAuthError(refresh(tokens.RefreshToken), "invalid_grant")
+
+			// refresh tokens of other clients are not accepted
+			_, mobileRefreshToken := testuutils.GetJwtMobileApp(router)
+			expectOAuthError(refresh(mobileRefreshToken), "invalid_grant")
+		})
+
+		It("should return access_denied, if the user code is denied", func() {
+			jwtToken, cookieSession := testuutils.GetJwt(router)
+			deviceCode := requestDeviceCode()
+			recorder := callPrivate(http.MethodPost, "/api/device-codes/"+deviceCode.UserCode+"/deny", jwtToken, cookieSession)
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			expectOAuthError(pollDeviceToken(deviceCode.DeviceCode), "access_denied")
+		})
+
+		It("should return expired_token, if the device code is expired", func() {
+			deviceCode := requestDeviceCode()
+			_, err := collDeviceAuthorizations.UpdateMany(ctx, bson.M{}, bson.M{"$set": bson.M{"expiresAt": time.Now().Add(-time.Second)}})
+			Expect(err).ShouldNot(HaveOccurred())
+			expectOAuthError(pollDeviceToken(deviceCode.DeviceCode), "expired_token")
+		})
+
+		It("should return an error, if the request is not valid", func() {
+			expectOAuthError(pollDeviceToken("unknown"), "invalid_grant")
+			expectOAuthError(pollDeviceToken(""), "invalid_request")
+			expectOAuthError(postForm("/api/oauth/device/token", url.Values{"grant_type": {"password"}}), "unsupported_grant_type")
+		})
+	})
+
+	Context("approving user codes", func() {
+		It("should return an error, if the user code is unknown or not valid", func() {
+			jwtToken, cookieSession := testuutils.GetJwt(router)
+			recorder := callPrivate(http.MethodPost, "/api/device-codes/BCDF-GHJK/approve", jwtToken, cookieSession)
+			Expect(recorder.Code).To(Equal(http.StatusNotFound))
+			recorder = callPrivate(http.MethodGet, "/api/device-codes/AAAA-0000", jwtToken, cookieSession)
+			Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+		})
+
+		It("should return an error, if not authenticated", func() {
+			deviceCode := requestDeviceCode()
+			recorder := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/api/device-codes/"+deviceCode.UserCode+"/approve", nil)
+			router.ServeHTTP(recorder, req)
+			Expect(recorder.Code).To(Equal(http.StatusUnauthorized))
+		})
+	})
+})
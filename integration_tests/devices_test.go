@@ -11,6 +11,8 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -283,4 +285,122 @@ var _ = Describe("Devices", func() {
 			})
 		})
 	})
+
+	Context("calling devices api PATCH", func() {
+		BeforeEach(func() {
+			err := testuutils.InsertOne(ctx, collDevices, deviceController)
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+
+		patchDevice := func(jwtToken, cookieSession, deviceID, body string) *httptest.ResponseRecorder {
+			recorder := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPatch, "/api/devices/"+deviceID, strings.NewReader(body))
+			req.Header.Add("Cookie", cookieSession)
+			req.Header.Add("Authorization", "Bearer "+jwtToken)
+			req.Header.Add("Content-Type", `application/json`)
+			router.ServeHTTP(recorder, req)
+			return recorder
+		}
+
+		When("profile owns a device", func() {
+			It("should set overrides, without changing reported fields", func() {
+				jwtToken, cookieSession := testuutils.GetJwt(router)
+				profileRes := testuutils.GetLoggedProfile(router, jwtToken, cookieSession)
+				err := testuutils.AssignDeviceToProfile(ctx, collProfiles, profileRes.ID, deviceController.ID)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				featureUUID := deviceController.Features[0].UUID
+				recorder := patchDevice(jwtToken, cookieSession, deviceController.ID.Hex(),
+					`{"name": "Bedroom AC", "category": "climate", "features": [{"featureUuid": "`+featureUUID+`", "label": "Mode", "order": 0}]}`)
+				Expect(recorder.Code).To(Equal(http.StatusOK))
+				var device models.Device
+				err = json.Unmarshal(recorder.Body.Bytes(), &device)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(device.Overrides.Name).To(Equal("Bedroom AC"))
+
+				recorder = patchDevice(jwtToken, cookieSession, deviceController.ID.Hex(),
+					`{"icon": "air-conditioner", "features": [{"featureUuid": "`+featureUUID+`", "hidden": true}]}`)
+				Expect(recorder.Code).To(Equal(http.StatusOK))
+
+				deviceDb, err := testuutils.FindOneById[models.Device](ctx, collDevices, deviceController.ID)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(deviceDb.Name).To(Equal(deviceController.Name))
+				Expect(deviceDb.Features).To(HaveLen(1))
+				Expect(deviceDb.Features[0].Name).To(Equal("ac-beko"))
+				Expect(deviceDb.Features[0].Order).To(Equal(1))
+				order := 0
+				Expect(*deviceDb.Overrides).To(Equal(models.DeviceOverrides{
+					Name:     "Bedroom AC",
+					Icon:     "air-conditioner",
+					Category: models.DeviceCategoryClimate,
+					Features: []models.FeatureOverride{{FeatureUUID: featureUUID, Label: "Mode", Hidden: true, Order: &order}},
+				}))
+
+				recorder = patchDevice(jwtToken, cookieSession, deviceController.ID.Hex(),
+					`{"name": "", "icon": "", "category": "", "features": [{"featureUuid": "`+featureUUID+`", "label": "", "hidden": false, "order": -1}]}`)
+				Expect(recorder.Code).To(Equal(http.StatusOK))
+				deviceDb, err = testuutils.FindOneById[models.Device](ctx, collDevices, deviceController.ID)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(deviceDb.Overrides).To(BeNil())
+			})
+
+			It("should not lose overrides set at the same time", func() {
+				jwtToken, cookieSession := testuutils.GetJwt(router)
+				profileRes := testuutils.GetLoggedProfile(router, jwtToken, cookieSession)
+				err := testuutils.AssignDeviceToProfile(ctx, collProfiles, profileRes.ID, deviceController.ID)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				bodies := []string{`{"name": "Bedroom AC"}`, `{"icon": "air-conditioner"}`, `{"category": "climate"}`}
+				codes := make([]int, len(bodies))
+				var wg sync.WaitGroup
+				for i, body := range bodies {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						codes[i] = patchDevice(jwtToken, cookieSession, deviceController.ID.Hex(), body).Code
+					}()
+				}
+				wg.Wait()
+
+				deviceDb, err := testuutils.FindOneById[models.Device](ctx, collDevices, deviceController.ID)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(codes).To(HaveEach(BeElementOf(http.StatusOK, http.StatusConflict)))
+				if codes[0] == http.StatusOK {
+					Expect(deviceDb.Overrides.Name).To(Equal("Bedroom AC"))
+				}
+				if codes[1] == http.StatusOK {
+					Expect(deviceDb.Overrides.Icon).To(Equal("air-conditioner"))
+				}
+				if codes[2] == http.StatusOK {
+					Expect(deviceDb.Overrides.Category).To(Equal(models.DeviceCategoryClimate))
+				}
+			})
+		})
+
+		When("you pass bad inputs", func() {
+			It("should return an error, because of bad overrides", func() {
+				jwtToken, cookieSession := testuutils.GetJwt(router)
+				profileRes := testuutils.GetLoggedProfile(router, jwtToken, cookieSession)
+				err := testuutils.AssignDeviceToProfile(ctx, collProfiles, profileRes.ID, deviceController.ID)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				for _, body := range []string{
+					`{"category": "unknown"}`,
+					`{"name": "` + strings.Repeat("a", 33) + `"}`,
+					`{"features": [{"featureUuid": "` + uuid.NewString() + `", "hidden": true}]}`,
+				} {
+					recorder := patchDevice(jwtToken, cookieSession, deviceController.ID.Hex(), body)
+					Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+				}
+			})
+
+			It("should return an error, because device is not owned by profile", func() {
+				jwtToken, cookieSession := testuutils.GetJwt(router)
+
+				recorder := patchDevice(jwtToken, cookieSession, deviceController.ID.Hex(), `{"name": "Bedroom AC"}`)
+				Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+				Expect(recorder.Body.String()).To(Equal(`{"error":"this device is not in your profile"}`))
+			})
+		})
+	})
 })
@@ -15,6 +15,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -25,6 +26,8 @@ import (
 	"go.mongodb.org/mongo-driver/v2/mongo"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 var currentDate = time.Now()
@@ -74,6 +77,22 @@ func (handler *deviceGrpcStub) GetValue(ctx context.Context, in *device.GetValue
 	}, nil
 }
 
+// Attention: this function stub name must match the one defined in .proto file
+func (handler *deviceGrpcStub) GetValues(ctx context.Context, in *device.GetValuesRequest) (*device.GetValuesResponse, error) {
+	fmt.Printf("gRPC stub - GetValues - received = %#v\n", in)
+	response := &device.GetValuesResponse{}
+	for _, feature := range in.Features {
+		response.FeatureValues = append(response.FeatureValues, &device.FeatureValueResponse{
+			FeatureUuid: feature.FeatureUuid,
+			FeatureName: feature.FeatureName,
+			Value:       controllerValue,
+			CreatedAt:   currentDate.UnixMilli(),
+			ModifiedAt:  currentDate.UnixMilli(),
+		})
+	}
+	return response, nil
+}
+
 // Attention: this function stub name must match the one defined in .proto file
 func (handler *deviceGrpcStub) SetValues(ctx context.Context, in *device.SetValuesRequest) (*device.SetValueResponse, error) {
 	fmt.Printf("gRPC stub - SetValue - received = %#v\n", in)
@@ -83,6 +102,40 @@ func (handler *deviceGrpcStub) SetValues(ctx context.Context, in *device.SetValu
 	}, nil
 }
 
+// deviceClientFake replaces the gRPC client of api-devices, recording SetValues requests
+type deviceClientFake struct {
+	mu        sync.Mutex
+	setValues []*device.SetValuesRequest
+}
+
+func (fake *deviceClientFake) GetValue(ctx context.Context, in *device.GetValueRequest, opts ...grpc.CallOption) (*device.GetValueResponse, error) {
+	return &device.GetValueResponse{
+		Value:      controllerValue,
+		CreatedAt:  currentDate.UnixMilli(),
+		ModifiedAt: currentDate.UnixMilli(),
+	}, nil
+}
+
+func (fake *deviceClientFake) GetValues(ctx context.Context, in *device.GetValuesRequest, opts ...grpc.CallOption) (*device.GetValuesResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method GetValues not implemented")
+}
+
+func (fake *deviceClientFake) SetValues(ctx context.Context, in *device.SetValuesRequest, opts ...grpc.CallOption) (*device.SetValueResponse, error) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	fake.setValues = append(fake.setValues, in)
+	return &device.SetValueResponse{
+		Status:  "200",
+		Message: "Updated",
+	}, nil
+}
+
+func (fake *deviceClientFake) SetValuesRequests() []*device.SetValuesRequest {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	return append([]*device.SetValuesRequest(nil), fake.setValues...)
+}
+
 var _ = Describe("DevicesValues", func() {
 	var ctx context.Context
 	var logger *zap.SugaredLogger
@@ -91,6 +144,7 @@ var _ = Describe("DevicesValues", func() {
 	var collProfiles *mongo.Collection
 	var collHomes *mongo.Collection
 	var collDevices *mongo.Collection
+	var collFeatureValues *mongo.Collection
 	var grpcMockServer *grpc.Server
 	var httpMockServer *httptest.Server
 	var oldGRPCURL string
@@ -224,8 +278,8 @@ var _ = Describe("DevicesValues", func() {
 	BeforeEach(func() {
 		ctx = context.Background()
 
-		// Bind the mock gRPC listener before building the router. NewDevicesValues
-		// reads GRPC_URL during initialization.MustStart(), so GRPC_URL must point
+		// Bind the mock gRPC listener before building the router. The shared gRPC
+		// connection reads GRPC_URL during initialization.MustStart(), so GRPC_URL must point
 		// to this exact listener before MustStart runs. Use 127.0.0.1 and an
 		// ephemeral port to avoid localhost IPv4/IPv6 ambiguity and fixed-port
 		// collisions between specs.
@@ -234,7 +288,7 @@ var _ = Describe("DevicesValues", func() {
 
 		// Save and restore GRPC_URL because this test overrides process-wide env.
 		// The override must happen after the listener is bound, but before
-		// initialization.MustStart() constructs the API handlers.
+		// initialization.MustStart() creates the gRPC connection.
 		oldGRPCURL, oldGRPCURLSet = os.LookupEnv("GRPC_URL")
 		err := os.Setenv("GRPC_URL", grpcListener.Addr().String())
 		Expect(err).ShouldNot(HaveOccurred())
@@ -243,7 +297,7 @@ var _ = Describe("DevicesValues", func() {
 		Expect(err).ShouldNot(HaveOccurred())
 
 		// MustStart must stay after the GRPC_URL override. Moving this above the
-		// override makes the handler keep the .env value, usually localhost:50051,
+		// override makes the connection keep the .env value, usually localhost:50051,
 		// and the POST test can time out before reaching the stub.
 		logger, router, client = initialization.MustStart()
 		defer logger.Sync()
@@ -251,6 +305,7 @@ var _ = Describe("DevicesValues", func() {
 		collProfiles = db.GetCollections(client).Profiles
 		collHomes = db.GetCollections(client).Homes
 		collDevices = db.GetCollections(client).Devices
+		collFeatureValues = db.GetCollections(client).FeatureValues
 
 		// --------- start a gRPC server ---------
 		grpcMockServer = grpc.NewServer()
@@ -293,7 +348,7 @@ var _ = Describe("DevicesValues", func() {
 	AfterEach(func() {
 		grpcMockServer.Stop()
 		httpMockServer.Close()
-		testuutils.DropAllCollections(ctx, collProfiles, collHomes, collDevices)
+		testuutils.DropAllCollections(ctx, collProfiles, collHomes, collDevices, collFeatureValues)
 		// Restore the process-wide GRPC_URL after this spec. Other integration
 		// tests build their own routers from the environment and must not inherit
 		// this spec's ephemeral mock address.
@@ -421,6 +476,51 @@ var _ = Describe("DevicesValues", func() {
 			})
 		})
 
+		When("a feature of the device cannot be read", func() {
+			It("should get values of the other features", func() {
+				co2FeatureUUID := uuid.NewString()
+				devicePartial := deviceHybrid
+				devicePartial.ID = bson.NewObjectID()
+				devicePartial.Features = append([]models.Feature{}, deviceHybrid.Features...)
+				// the sensors service doesn't have this feature
+				devicePartial.Features = append(devicePartial.Features, models.Feature{
+					UUID:   co2FeatureUUID,
+					Type:   "sensor",
+					Name:   "co2",
+					Enable: true,
+					Order:  3,
+					Unit:   "ppm",
+				})
+				err := testuutils.InsertOne(ctx, collDevices, devicePartial)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				jwtToken, cookieSession := testuutils.GetJwt(router)
+				profileRes := testuutils.GetLoggedProfile(router, jwtToken, cookieSession)
+				err = testuutils.AssignDeviceToProfile(ctx, collProfiles, profileRes.ID, devicePartial.ID)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				recorder := httptest.NewRecorder()
+				req := httptest.NewRequest(http.MethodGet, "/api/devices/"+devicePartial.ID.Hex()+"/values", nil)
+				req.Header.Add("Cookie", cookieSession)
+				req.Header.Add("Authorization", "Bearer "+jwtToken)
+				req.Header.Add("Content-Type", `application/json`)
+				router.ServeHTTP(recorder, req)
+				Expect(recorder.Code).To(Equal(http.StatusOK))
+				var deviceStates []models.DeviceFeatureState
+				err = json.Unmarshal(recorder.Body.Bytes(), &deviceStates)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(deviceStates).To(HaveLen(3))
+				Expect(deviceStates[0].FeatureUUID).To(Equal(controllerAcFeatureUUID))
+				Expect(deviceStates[0].Value).To(Equal(controllerValue))
+				Expect(deviceStates[0].Error).To(BeEmpty())
+				Expect(deviceStates[1].FeatureUUID).To(Equal(temperatureFeatureUUID))
+				Expect(deviceStates[1].Value).To(Equal(temperatureSensorValue))
+				Expect(deviceStates[1].Error).To(BeEmpty())
+				Expect(deviceStates[2].FeatureUUID).To(Equal(co2FeatureUUID))
+				Expect(deviceStates[2].Error).To(Equal("cannot get sensor value"))
+			})
+		})
+
 		When("you pass bad inputs", func() {
 			It("should return an error, because ...", func() {
 				jwtToken, cookieSession := testuutils.GetJwt(router)
@@ -493,6 +593,8 @@ var _ = Describe("DevicesValues", func() {
 					Type:        models.Controller,
 					Name:        deviceController.Features[0].Name,
 					Value:       float32(22.45),
+					// timestamps sent by clients must not be used by the history
+					ModifiedAt: currentDate.AddDate(-1, 0, 0).UnixMilli(),
 				}}
 				var deviceStates bytes.Buffer
 				err = json.NewEncoder(&deviceStates).Encode(devStates)
@@ -506,6 +608,11 @@ var _ = Describe("DevicesValues", func() {
 				router.ServeHTTP(recorder, req)
 				Expect(recorder.Code).To(Equal(http.StatusOK))
 				Expect(recorder.Body.String()).To(Equal(`{"message":"set values success"}`))
+
+				var featureValue models.FeatureValue
+				err = collFeatureValues.FindOne(ctx, bson.M{"meta.deviceId": deviceController.ID}).Decode(&featureValue)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(featureValue.Timestamp).To(BeTemporally("~", time.Now(), time.Minute))
 			})
 		})
 
@@ -590,6 +697,71 @@ var _ = Describe("DevicesValues", func() {
 				Expect(recorder.Code).To(Equal(http.StatusBadRequest))
 				Expect(recorder.Body.String()).To(Equal(`{"error":"invalid device feature"}`))
 			})
+
+			It("should return an error for every feature value outside its spec", func() {
+				jwtToken, cookieSession := testuutils.GetJwt(router)
+				profileRes := testuutils.GetLoggedProfile(router, jwtToken, cookieSession)
+
+				minTemp := 16.0
+				maxTemp := 30.0
+				stepTemp := 0.5
+				deviceSpec := models.Device{
+					ID:           bson.NewObjectID(),
+					Mac:          "DD:22:33:44:55:66",
+					Manufacturer: "test",
+					Model:        "test",
+					UUID:         uuid.NewString(),
+					Features: []models.Feature{{
+						UUID:   uuid.NewString(),
+						Type:   "controller",
+						Name:   "setpoint",
+						Enable: true,
+						Order:  1,
+						Unit:   "°C",
+						Spec:   models.Spec{Format: models.Float, Min: &minTemp, Max: &maxTemp, Step: &stepTemp},
+					}, {
+						UUID:   uuid.NewString(),
+						Type:   "controller",
+						Name:   "on",
+						Enable: true,
+						Order:  2,
+						Unit:   "-",
+						Spec:   models.Spec{Format: models.Bool},
+					}},
+					CreatedAt:  currentDate,
+					ModifiedAt: currentDate,
+				}
+				err := testuutils.InsertOne(ctx, collDevices, deviceSpec)
+				Expect(err).ShouldNot(HaveOccurred())
+				err = testuutils.AssignDeviceToProfile(ctx, collProfiles, profileRes.ID, deviceSpec.ID)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				devStates := []*models.DeviceFeatureState{{
+					FeatureUUID: deviceSpec.Features[0].UUID,
+					Type:        models.Controller,
+					Name:        deviceSpec.Features[0].Name,
+					Value:       float32(45),
+				}, {
+					FeatureUUID: deviceSpec.Features[1].UUID,
+					Type:        models.Controller,
+					Name:        deviceSpec.Features[1].Name,
+					Value:       float32(2),
+				}}
+				var deviceStates bytes.Buffer
+				err = json.NewEncoder(&deviceStates).Encode(devStates)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				recorder := httptest.NewRecorder()
+				req := httptest.NewRequest(http.MethodPost, "/api/devices/"+deviceSpec.ID.Hex()+"/values", &deviceStates)
+				req.Header.Add("Cookie", cookieSession)
+				req.Header.Add("Authorization", "Bearer "+jwtToken)
+				req.Header.Add("Content-Type", `application/json`)
+				router.ServeHTTP(recorder, req)
+				Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+				Expect(recorder.Body.String()).To(Equal(`{"error":"invalid device feature values","features":[` +
+					`{"featureUuid":"` + deviceSpec.Features[0].UUID + `","name":"setpoint","error":"value must be less than or equal to 30"},` +
+					`{"featureUuid":"` + deviceSpec.Features[1].UUID + `","name":"on","error":"value must be 0 or 1"}]}`))
+			})
 		})
 
 		When("profile don't own any device", func() {
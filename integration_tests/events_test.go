@@ -0,0 +1,156 @@
+package integration_tests
+
+import (
+	"api-server/db"
+	"api-server/initialization"
+	"api-server/models"
+	"api-server/testuutils"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.uber.org/zap"
+)
+
+// sseMessage is an event read from a Server-Sent Events stream
+type sseMessage struct {
+	event string
+	data  string
+}
+
+// readSSEMessages sends messages read from body to the returned channel, until body is closed
+func readSSEMessages(body *bufio.Reader) <-chan sseMessage {
+	messages := make(chan sseMessage, 16)
+	go func() {
+		defer close(messages)
+		var message sseMessage
+		for {
+			line, err := body.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimRight(line, "\n")
+			switch {
+			case strings.HasPrefix(line, "event:"):
+				message.event = strings.TrimPrefix(line, "event:")
+			case strings.HasPrefix(line, "data:"):
+				message.data = strings.TrimPrefix(line, "data:")
+			case line == "" && message.event != "":
+				messages <- message
+				message = sseMessage{}
+			}
+		}
+	}()
+	return messages
+}
+
+var _ = Describe("Events", func() {
+	var ctx context.Context
+	var logger *zap.SugaredLogger
+	var router *gin.Engine
+	var client *mongo.Client
+	var collProfiles *mongo.Collection
+	var collHomes *mongo.Collection
+	var collDevices *mongo.Collection
+	var server *httptest.Server
+
+	var eventsDate = time.Now()
+	var home models.Home
+
+	BeforeEach(func() {
+		ctx = context.Background()
+
+		err := os.Setenv("LIMIT_TO_USER_EMAILS", "test@test.com")
+		Expect(err).ShouldNot(HaveOccurred())
+
+		logger, router, client = initialization.MustStart()
+		defer logger.Sync()
+
+		collProfiles = db.GetCollections(client).Profiles
+		collHomes = db.GetCollections(client).Homes
+		collDevices = db.GetCollections(client).Devices
+
+		home = models.Home{
+			ID:         bson.NewObjectID(),
+			Name:       "home1",
+			Location:   "location1",
+			Rooms:      []models.Room{},
+			CreatedAt:  eventsDate,
+			ModifiedAt: eventsDate,
+		}
+		err = testuutils.InsertOne(ctx, collHomes, home)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		// streams require a real server, because httptest.ResponseRecorder returns only at the end
+		server = httptest.NewServer(router)
+	})
+
+	AfterEach(func() {
+		server.Close()
+		testuutils.DropAllCollections(ctx, collProfiles, collHomes, collDevices)
+	})
+
+	Context("calling events api", func() {
+		It("should stream changes of homes in the profile", func() {
+			jwtToken, cookieSession := testuutils.GetJwt(router)
+			profileID := testuutils.GetLoggedProfile(router, jwtToken, cookieSession).ID
+			err := testuutils.AssignHomeToProfile(ctx, collProfiles, profileID, home.ID)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			streamCtx, cancel := context.WithCancel(ctx)
+			defer cancel()
+			req, err := http.NewRequestWithContext(streamCtx, http.MethodGet, server.URL+"/api/events", nil)
+			Expect(err).ShouldNot(HaveOccurred())
+			req.Header.Add("Cookie", cookieSession)
+			req.Header.Add("Authorization", "Bearer "+jwtToken)
+			resp, err := server.Client().Do(req)
+			Expect(err).ShouldNot(HaveOccurred())
+			defer resp.Body.Close()
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			Expect(resp.Header.Get("Content-Type")).To(HavePrefix("text/event-stream"))
+
+			messages := readSSEMessages(bufio.NewReader(resp.Body))
+			Eventually(messages).Should(Receive(HaveField("event", "ready")))
+
+			// add a room
+			recorder := httptest.NewRecorder()
+			var roomBody bytes.Buffer
+			err = json.NewEncoder(&roomBody).Encode(map[string]any{"name": "room1", "floor": 1})
+			Expect(err).ShouldNot(HaveOccurred())
+			roomReq := httptest.NewRequest(http.MethodPost, "/api/homes/"+home.ID.Hex()+"/rooms", &roomBody)
+			roomReq.Header.Add("Cookie", cookieSession)
+			roomReq.Header.Add("Authorization", "Bearer "+jwtToken)
+			router.ServeHTTP(recorder, roomReq)
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+
+			var message sseMessage
+			Eventually(messages, 5*time.Second).Should(Receive(&message))
+			Expect(message.event).To(Equal(string(models.EventRoomCreated)))
+			var event models.Event
+			err = json.Unmarshal([]byte(message.data), &event)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(event.Type).To(Equal(models.EventRoomCreated))
+			Expect(event.HomeID).ToNot(BeNil())
+			Expect(*event.HomeID).To(Equal(home.ID))
+			Expect(event.RoomID).ToNot(BeNil())
+		})
+
+		It("should return an error, if not authenticated", func() {
+			resp, err := server.Client().Get(server.URL + "/api/events")
+			Expect(err).ShouldNot(HaveOccurred())
+			defer resp.Body.Close()
+			Expect(resp.StatusCode).To(Equal(http.StatusUnauthorized))
+		})
+	})
+})
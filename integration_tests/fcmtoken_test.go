@@ -4,18 +4,22 @@ import (
 	"api-server/api"
 	"api-server/db"
 	"api-server/initialization"
+	"api-server/models"
 	"api-server/testuutils"
 	"bytes"
 	"context"
 	"encoding/json"
+	"io"
 	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"sync"
 
 	"github.com/gin-gonic/gin"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"go.mongodb.org/mongo-driver/v2/bson"
 	"go.mongodb.org/mongo-driver/v2/mongo"
 	"go.uber.org/zap"
 )
@@ -36,10 +40,55 @@ var _ = Describe("FCMToken", func() {
 		w.WriteHeader(http.StatusOK)
 		_, _ = w.Write([]byte(`[{"alive": true}]`))
 	})
+	// last payload sent to the online service
+	var onlineFCMReqMu sync.Mutex
+	var onlineFCMReq api.OnlineFCMReq
 	fcmTokenHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		onlineFCMReqMu.Lock()
+		_ = json.Unmarshal(body, &onlineFCMReq)
+		onlineFCMReqMu.Unlock()
 		w.WriteHeader(http.StatusOK)
 		_, _ = w.Write([]byte(`[{"code": 200}]`))
 	})
+	lastOnlineFCMTokens := func() []string {
+		onlineFCMReqMu.Lock()
+		defer onlineFCMReqMu.Unlock()
+		return onlineFCMReq.FCMTokens
+	}
+
+	postFCMToken := func(jwtToken, cookieSession string, initFCMTokenReq api.InitFCMTokenReq) *httptest.ResponseRecorder {
+		var buf bytes.Buffer
+		err := json.NewEncoder(&buf).Encode(initFCMTokenReq)
+		Expect(err).ShouldNot(HaveOccurred())
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/fcmtoken", &buf)
+		req.Header.Add("Cookie", cookieSession)
+		req.Header.Add("Authorization", "Bearer "+jwtToken)
+		req.Header.Add("Content-Type", `application/json`)
+		router.ServeHTTP(recorder, req)
+		return recorder
+	}
+	getFCMTokens := func(jwtToken, cookieSession string) []models.FCMToken {
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/api/fcmtoken", nil)
+		req.Header.Add("Cookie", cookieSession)
+		req.Header.Add("Authorization", "Bearer "+jwtToken)
+		router.ServeHTTP(recorder, req)
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+		var fcmTokens []models.FCMToken
+		err := json.Unmarshal(recorder.Body.Bytes(), &fcmTokens)
+		Expect(err).ShouldNot(HaveOccurred())
+		return fcmTokens
+	}
+	deleteFCMToken := func(jwtToken, cookieSession, id string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodDelete, "/api/fcmtoken/"+id, nil)
+		req.Header.Add("Cookie", cookieSession)
+		req.Header.Add("Authorization", "Bearer "+jwtToken)
+		router.ServeHTTP(recorder, req)
+		return recorder
+	}
 
 	BeforeEach(func() {
 		logger, router, client = initialization.MustStart()
@@ -107,6 +156,67 @@ var _ = Describe("FCMToken", func() {
 			})
 		})
 
+		When("registering smartphones and tablets of the same profile", func() {
+			var jwtToken string
+			var cookieSession string
+
+			BeforeEach(func() {
+				jwtToken, cookieSession = testuutils.GetJwt(router)
+				profileRes := testuutils.GetLoggedProfile(router, jwtToken, cookieSession)
+				err := testuutils.SetAPITokenToProfile(ctx, collProfiles, profileRes.ID, mockedProfileAPIToken)
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+
+			It("should keep a token for each of them and send all of them to the online service", func() {
+				recorder := postFCMToken(jwtToken, cookieSession, api.InitFCMTokenReq{FCMToken: "phone-token", DeviceLabel: "phone", Platform: models.FCMPlatformAndroid})
+				Expect(recorder.Code).To(Equal(http.StatusOK))
+				recorder = postFCMToken(jwtToken, cookieSession, api.InitFCMTokenReq{FCMToken: "tablet-token", DeviceLabel: "tablet", Platform: models.FCMPlatformIOS})
+				Expect(recorder.Code).To(Equal(http.StatusOK))
+				Expect(lastOnlineFCMTokens()).To(ConsistOf("phone-token", "tablet-token"))
+
+				By("refreshing an existing token")
+				recorder = postFCMToken(jwtToken, cookieSession, api.InitFCMTokenReq{FCMToken: "phone-token"})
+				Expect(recorder.Code).To(Equal(http.StatusOK))
+
+				fcmTokens := getFCMTokens(jwtToken, cookieSession)
+				Expect(fcmTokens).To(HaveLen(2))
+				// the most recently seen first
+				Expect(fcmTokens[0].Token).To(Equal("phone-token"))
+				Expect(fcmTokens[0].DeviceLabel).To(Equal("phone"))
+				Expect(fcmTokens[0].Platform).To(Equal(models.FCMPlatformAndroid))
+				Expect(fcmTokens[1].Token).To(Equal("tablet-token"))
+
+				By("deleting a token")
+				recorder = deleteFCMToken(jwtToken, cookieSession, fcmTokens[1].ID.Hex())
+				Expect(recorder.Code).To(Equal(http.StatusOK))
+				Expect(recorder.Body.String()).To(Equal(`{"message":"fcm token has been deleted"}`))
+				Expect(lastOnlineFCMTokens()).To(ConsistOf("phone-token"))
+				fcmTokens = getFCMTokens(jwtToken, cookieSession)
+				Expect(fcmTokens).To(HaveLen(1))
+				Expect(fcmTokens[0].Token).To(Equal("phone-token"))
+			})
+
+			It("should return an error, if the token to delete doesn't exist", func() {
+				recorder := deleteFCMToken(jwtToken, cookieSession, bson.NewObjectID().Hex())
+				Expect(recorder.Code).To(Equal(http.StatusNotFound))
+				Expect(recorder.Body.String()).To(Equal(`{"error":"fcm token not found"}`))
+			})
+
+			It("should not store the token, if the online service is not available", func() {
+				httpMockServer.Close()
+
+				recorder := postFCMToken(jwtToken, cookieSession, api.InitFCMTokenReq{FCMToken: "phone-token", DeviceLabel: "phone"})
+				Expect(recorder.Code).To(Equal(http.StatusInternalServerError))
+				Expect(recorder.Body.String()).To(Equal(`{"error":"Cannot initialize FCM Token"}`))
+				Expect(getFCMTokens(jwtToken, cookieSession)).To(BeEmpty())
+			})
+
+			It("should return an error, if the platform is not supported", func() {
+				recorder := postFCMToken(jwtToken, cookieSession, api.InitFCMTokenReq{FCMToken: "phone-token", Platform: "windows"})
+				Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+			})
+		})
+
 		When("you pass bad inputs", func() {
 			It("should return an error, if body is missing", func() {
 				jwtToken, cookieSession := testuutils.GetJwt(router)
@@ -0,0 +1,150 @@
+package integration_tests
+
+import (
+	"api-server/api"
+	"api-server/db"
+	"api-server/initialization"
+	"api-server/models"
+	"api-server/testuutils"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.uber.org/zap"
+)
+
+var _ = Describe("FeatureHistory", func() {
+	var ctx context.Context
+	var logger *zap.SugaredLogger
+	var router *gin.Engine
+	var client *mongo.Client
+	var collProfiles *mongo.Collection
+	var collHomes *mongo.Collection
+	var collDevices *mongo.Collection
+	var collFeatureValues *mongo.Collection
+
+	// readings must be recent, otherwise they would be removed by the retention of feature_values
+	var historyDate = time.Now().UTC().Truncate(time.Hour).Add(-3 * time.Hour)
+	var temperatureUUID = uuid.NewString()
+	var deviceSensor = models.Device{
+		ID:           bson.NewObjectID(),
+		Mac:          "EE:22:33:44:55:66",
+		Manufacturer: "test",
+		Model:        "test",
+		UUID:         uuid.NewString(),
+		Features: []models.Feature{{
+			UUID:   temperatureUUID,
+			Type:   "sensor",
+			Name:   "temperature",
+			Enable: true,
+			Order:  1,
+			Unit:   "°C",
+		}},
+		CreatedAt:  historyDate,
+		ModifiedAt: historyDate,
+	}
+
+	getHistory := func(jwtToken, cookieSession, path string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Add("Cookie", cookieSession)
+		req.Header.Add("Authorization", "Bearer "+jwtToken)
+		router.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	BeforeEach(func() {
+		logger, router, client = initialization.MustStart()
+		ctx = context.Background()
+		defer logger.Sync()
+
+		collProfiles = db.GetCollections(client).Profiles
+		collHomes = db.GetCollections(client).Homes
+		collDevices = db.GetCollections(client).Devices
+		collFeatureValues = db.GetCollections(client).FeatureValues
+
+		err := os.Setenv("LIMIT_TO_USER_EMAILS", "test@test.com")
+		Expect(err).ShouldNot(HaveOccurred())
+
+		err = testuutils.InsertOne(ctx, collDevices, deviceSensor)
+		Expect(err).ShouldNot(HaveOccurred())
+		for i, value := range []float64{20, 22, 24, 30} {
+			err = testuutils.InsertOne(ctx, collFeatureValues, models.FeatureValue{
+				Meta: models.FeatureValueMeta{
+					DeviceID:    deviceSensor.ID,
+					FeatureUUID: temperatureUUID,
+				},
+				// 3 readings in the first hour, 1 in the second one
+				Timestamp: historyDate.Add(time.Duration(i) * 25 * time.Minute),
+				Value:     value,
+			})
+			Expect(err).ShouldNot(HaveOccurred())
+		}
+	})
+
+	AfterEach(func() {
+		testuutils.DropAllCollections(ctx, collProfiles, collHomes, collDevices, collFeatureValues)
+	})
+
+	Context("calling feature history api GET", func() {
+		When("profile owns the device", func() {
+			It("should return values aggregated by bucket", func() {
+				jwtToken, cookieSession := testuutils.GetJwt(router)
+				profileRes := testuutils.GetLoggedProfile(router, jwtToken, cookieSession)
+				err := testuutils.AssignDeviceToProfile(ctx, collProfiles, profileRes.ID, deviceSensor.ID)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				recorder := getHistory(jwtToken, cookieSession, "/api/devices/"+deviceSensor.ID.Hex()+"/features/"+temperatureUUID+
+					"/history?from="+historyDate.Add(-time.Hour).Format(time.RFC3339)+"&to="+historyDate.Add(2*time.Hour).Format(time.RFC3339)+"&bucket=1h")
+				Expect(recorder.Code).To(Equal(http.StatusOK))
+				var historyRes api.FeatureHistoryResp
+				err = json.Unmarshal(recorder.Body.Bytes(), &historyRes)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(historyRes.Values).To(HaveLen(2))
+				Expect(historyRes.Values[0].From).To(Equal(historyDate))
+				Expect(historyRes.Values[0].Min).To(Equal(20.0))
+				Expect(historyRes.Values[0].Max).To(Equal(24.0))
+				Expect(historyRes.Values[0].Avg).To(Equal(22.0))
+				Expect(historyRes.Values[0].Count).To(Equal(3))
+				Expect(historyRes.Values[1].From).To(Equal(historyDate.Add(time.Hour)))
+				Expect(historyRes.Values[1].Count).To(Equal(1))
+			})
+
+			It("should return an error, because bucket is not valid", func() {
+				jwtToken, cookieSession := testuutils.GetJwt(router)
+				recorder := getHistory(jwtToken, cookieSession, "/api/devices/"+deviceSensor.ID.Hex()+"/features/"+temperatureUUID+"/history?bucket=10s")
+				Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+				Expect(recorder.Body.String()).To(Equal(`{"error":"wrong format of the query param 'bucket', use a size like 5m, 1h or 1d"}`))
+			})
+
+			It("should return an error, because feature is not in device", func() {
+				jwtToken, cookieSession := testuutils.GetJwt(router)
+				profileRes := testuutils.GetLoggedProfile(router, jwtToken, cookieSession)
+				err := testuutils.AssignDeviceToProfile(ctx, collProfiles, profileRes.ID, deviceSensor.ID)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				recorder := getHistory(jwtToken, cookieSession, "/api/devices/"+deviceSensor.ID.Hex()+"/features/"+uuid.NewString()+"/history")
+				Expect(recorder.Code).To(Equal(http.StatusNotFound))
+				Expect(recorder.Body.String()).To(Equal(`{"error":"feature not found"}`))
+			})
+		})
+
+		When("profile doesn't own the device", func() {
+			It("should return an error", func() {
+				jwtToken, cookieSession := testuutils.GetJwt(router)
+				recorder := getHistory(jwtToken, cookieSession, "/api/devices/"+deviceSensor.ID.Hex()+"/features/"+temperatureUUID+"/history")
+				Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+				Expect(recorder.Body.String()).To(Equal(`{"error":"this device is not in your profile"}`))
+			})
+		})
+	})
+})
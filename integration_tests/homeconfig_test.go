@@ -0,0 +1,155 @@
+package integration_tests
+
+import (
+	"api-server/api"
+	"api-server/db"
+	"api-server/initialization"
+	"api-server/models"
+	"api-server/testuutils"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.uber.org/zap"
+)
+
+var _ = Describe("HomeConfig", func() {
+	var ctx context.Context
+	var logger *zap.SugaredLogger
+	var router *gin.Engine
+	var client *mongo.Client
+	var collProfiles *mongo.Collection
+	var collHomes *mongo.Collection
+	var collDevices *mongo.Collection
+	var jwtToken string
+	var cookieSession string
+	var home models.Home
+	var device models.Device
+
+	call := func(method, url, contentType string, body []byte) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest(method, url, bytes.NewReader(body))
+		req.Header.Add("Content-Type", contentType)
+		req.Header.Add("Cookie", cookieSession)
+		req.Header.Add("Authorization", "Bearer "+jwtToken)
+		router.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+
+		err := os.Setenv("LIMIT_TO_USER_EMAILS", "test@test.com")
+		Expect(err).ShouldNot(HaveOccurred())
+
+		logger, router, client = initialization.MustStart()
+		defer logger.Sync()
+
+		collProfiles = db.GetCollections(client).Profiles
+		collHomes = db.GetCollections(client).Homes
+		collDevices = db.GetCollections(client).Devices
+
+		jwtToken, cookieSession = testuutils.GetJwt(router)
+		profile := testuutils.GetLoggedProfile(router, jwtToken, cookieSession)
+
+		home = models.Home{
+			ID:       bson.NewObjectID(),
+			Name:     "home",
+			Location: "location",
+			Rooms: []models.Room{
+				{ID: bson.NewObjectID(), Name: "kitchen", Floor: 0, CreatedAt: time.Now(), ModifiedAt: time.Now()},
+				{ID: bson.NewObjectID(), Name: "cellar", Floor: -1, CreatedAt: time.Now(), ModifiedAt: time.Now()},
+			},
+			Members:    []models.HomeMember{{ProfileID: profile.ID, Role: models.HomeRoleOwner, AddedAt: time.Now()}},
+			CreatedAt:  time.Now(),
+			ModifiedAt: time.Now(),
+		}
+		Expect(testuutils.InsertOne(ctx, collHomes, home)).To(Succeed())
+		Expect(testuutils.AssignHomeToProfile(ctx, collProfiles, profile.ID, home.ID)).To(Succeed())
+		device = models.Device{ID: bson.NewObjectID(), Mac: "11:22:33:44:55:66", UUID: uuid.NewString(), Name: "lamp", Features: []models.Feature{}}
+		Expect(testuutils.InsertOne(ctx, collDevices, device)).To(Succeed())
+		Expect(testuutils.AssignDeviceToProfile(ctx, collProfiles, profile.ID, device.ID)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		testuutils.DropAllCollections(ctx, collProfiles, collHomes, collDevices)
+	})
+
+	It("should apply a configuration, reporting the diff in dry-run mode without changes", func() {
+		config := models.HomeConfig{
+			Version: models.HomeConfigVersion,
+			Rooms: []models.HomeConfigRoom{
+				{Name: "kitchen", Floor: 0, Devices: []models.HomeConfigDevice{}},
+				{Name: "living", Floor: 1, Devices: []models.HomeConfigDevice{{MAC: device.Mac, Name: "main lamp"}}},
+			},
+		}
+		body, err := json.Marshal(config)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		recorder := call(http.MethodPut, "/api/homes/"+home.ID.Hex()+"/config?dryRun=true", "application/json", body)
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+		var res api.HomeConfigApplyRes
+		Expect(json.Unmarshal(recorder.Body.Bytes(), &res)).To(Succeed())
+		Expect(res.DryRun).To(BeTrue())
+		Expect(res.Diff.RoomsCreated).To(Equal([]string{"living"}))
+		Expect(res.Diff.RoomsDeleted).To(Equal([]string{"cellar"}))
+		Expect(res.Diff.DevicesAssigned).To(HaveLen(1))
+		Expect(res.Diff.DevicesRenamed).To(HaveLen(1))
+		homeDb, err := testuutils.FindOneById[models.Home](ctx, collHomes, home.ID)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(homeDb.Rooms).To(HaveLen(2))
+		Expect(homeDb.Rooms[1].Name).To(Equal("cellar"))
+
+		recorder = call(http.MethodPut, "/api/homes/"+home.ID.Hex()+"/config", "application/json", body)
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+		homeDb, err = testuutils.FindOneById[models.Home](ctx, collHomes, home.ID)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(homeDb.Rooms).To(HaveLen(2))
+		Expect(homeDb.Rooms[0].ID).To(Equal(home.Rooms[0].ID))
+		Expect(homeDb.Rooms[1].Name).To(Equal("living"))
+		Expect(homeDb.Rooms[1].Devices).To(Equal([]bson.ObjectID{device.ID}))
+		deviceDb, err := testuutils.FindOneById[models.Device](ctx, collDevices, device.ID)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(deviceDb.Overrides.Name).To(Equal("main lamp"))
+		Expect(deviceDb.Name).To(Equal("lamp"))
+	})
+
+	It("should export and import a configuration as YAML", func() {
+		yamlConfig := "version: 1\nrooms:\n  - name: kitchen\n    floor: 0\n    devices:\n      - uuid: " + device.UUID + "\n"
+		recorder := call(http.MethodPut, "/api/homes/"+home.ID.Hex()+"/config", "application/yaml", []byte(yamlConfig))
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+
+		recorder = call(http.MethodGet, "/api/homes/"+home.ID.Hex()+"/config?format=yaml", "", nil)
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+		Expect(recorder.Body.String()).To(ContainSubstring("name: kitchen"))
+		Expect(recorder.Body.String()).To(ContainSubstring("mac: " + device.Mac))
+
+		recorder = call(http.MethodGet, "/api/homes/"+home.ID.Hex()+"/config", "", nil)
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+		var config models.HomeConfig
+		Expect(json.Unmarshal(recorder.Body.Bytes(), &config)).To(Succeed())
+		Expect(config.Rooms).To(HaveLen(1))
+		Expect(config.Rooms[0].Devices).To(Equal([]models.HomeConfigDevice{{MAC: device.Mac, UUID: device.UUID, Name: device.Name}}))
+	})
+
+	It("should return an error, if the configuration is not valid", func() {
+		for _, config := range []string{
+			`{"version": 2, "rooms": []}`,
+			`{"version": 1, "rooms": [{"name": "a", "devices": [{"mac": "00:00:00:00:00:00"}]}]}`,
+			`{"version": 1, "rooms": [{"name": "a"}, {"name": "a"}]}`,
+		} {
+			recorder := call(http.MethodPut, "/api/homes/"+home.ID.Hex()+"/config", "application/json", []byte(config))
+			Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+		}
+	})
+})
@@ -0,0 +1,288 @@
+package integration_tests
+
+import (
+	"api-server/api"
+	"api-server/db"
+	"api-server/initialization"
+	"api-server/models"
+	"api-server/testuutils"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.uber.org/zap"
+)
+
+var _ = Describe("HomeMembers", func() {
+	var ctx context.Context
+	var logger *zap.SugaredLogger
+	var router *gin.Engine
+	var client *mongo.Client
+	var collProfiles *mongo.Collection
+	var collHomes *mongo.Collection
+	var collInvitations *mongo.Collection
+
+	var currentDate = time.Now()
+	var home models.Home
+	var guestProfile models.Profile
+
+	createInvitation := func(jwtToken, cookieSession string, homeID bson.ObjectID, role models.HomeRole) (int, api.HomeInvitationResp) {
+		var buf bytes.Buffer
+		err := json.NewEncoder(&buf).Encode(api.HomeInvitationNewReq{Role: role})
+		Expect(err).ShouldNot(HaveOccurred())
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/homes/"+homeID.Hex()+"/members/invitations", &buf)
+		req.Header.Add("Cookie", cookieSession)
+		req.Header.Add("Authorization", "Bearer "+jwtToken)
+		req.Header.Add("Content-Type", `application/json`)
+		router.ServeHTTP(recorder, req)
+		var invitationRes api.HomeInvitationResp
+		if recorder.Code == http.StatusOK {
+			err = json.Unmarshal(recorder.Body.Bytes(), &invitationRes)
+			Expect(err).ShouldNot(HaveOccurred())
+		}
+		return recorder.Code, invitationRes
+	}
+
+	acceptInvitation := func(jwtToken string, homeID bson.ObjectID, code string) *httptest.ResponseRecorder {
+		var buf bytes.Buffer
+		err := json.NewEncoder(&buf).Encode(api.HomeInvitationAcceptReq{Code: code})
+		Expect(err).ShouldNot(HaveOccurred())
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/homes/"+homeID.Hex()+"/members/accept", &buf)
+		req.Header.Add("Authorization", "Bearer "+jwtToken)
+		req.Header.Add("Content-Type", `application/json`)
+		router.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	BeforeEach(func() {
+		logger, router, client = initialization.MustStart()
+		ctx = context.Background()
+		defer logger.Sync()
+
+		collProfiles = db.GetCollections(client).Profiles
+		collHomes = db.GetCollections(client).Homes
+		collInvitations = db.GetCollections(client).HomeInvitations
+
+		err := os.Setenv("LIMIT_TO_USER_EMAILS", "test@test.com")
+		Expect(err).ShouldNot(HaveOccurred())
+
+		home = models.Home{
+			ID:       bson.NewObjectID(),
+			Name:     "home1",
+			Location: "location1",
+			Rooms: []models.Room{{
+				ID:         bson.NewObjectID(),
+				Name:       "room1",
+				Floor:      1,
+				CreatedAt:  currentDate,
+				ModifiedAt: currentDate,
+				Devices:    []bson.ObjectID{},
+			}},
+			CreatedAt:  currentDate,
+			ModifiedAt: currentDate,
+		}
+		err = testuutils.InsertOne(ctx, collHomes, home)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		guestProfile = models.Profile{
+			ID: bson.NewObjectID(),
+			Github: models.GitHub{
+				ID:    654321,
+				Login: "guest",
+				Name:  "Guest Guest",
+				Email: "guest@test.com",
+			},
+			Devices:    []bson.ObjectID{},
+			Homes:      []bson.ObjectID{},
+			CreatedAt:  currentDate,
+			ModifiedAt: currentDate,
+		}
+		err = testuutils.InsertOne(ctx, collProfiles, guestProfile)
+		Expect(err).ShouldNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		testuutils.DropAllCollections(ctx, collProfiles, collHomes, collInvitations)
+	})
+
+	Context("sharing a home", func() {
+		When("the owner invites another profile", func() {
+			It("should add the profile as a member with the invited role", func() {
+				jwtToken, cookieSession := testuutils.GetJwt(router)
+				ownerProfile := testuutils.GetLoggedProfile(router, jwtToken, cookieSession)
+				err := testuutils.AssignHomeToProfile(ctx, collProfiles, ownerProfile.ID, home.ID)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				code, invitationRes := createInvitation(jwtToken, cookieSession, home.ID, models.HomeRoleGuest)
+				Expect(code).To(Equal(http.StatusOK))
+				Expect(invitationRes.Code).ToNot(BeEmpty())
+				Expect(invitationRes.Role).To(Equal(models.HomeRoleGuest))
+
+				guestJwt := testuutils.GetJwtForProfile(guestProfile)
+				recorder := acceptInvitation(guestJwt, home.ID, invitationRes.Code)
+				Expect(recorder.Code).To(Equal(http.StatusOK))
+
+				homeDb, err := testuutils.FindOneById[models.Home](ctx, collHomes, home.ID)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(homeDb.Members).To(HaveLen(2))
+				Expect(homeDb.Members[0].ProfileID).To(Equal(ownerProfile.ID))
+				Expect(homeDb.Members[0].Role).To(Equal(models.HomeRoleOwner))
+				Expect(homeDb.Members[1].ProfileID).To(Equal(guestProfile.ID))
+				Expect(homeDb.Members[1].Role).To(Equal(models.HomeRoleGuest))
+				guestDb, err := testuutils.FindOneById[models.Profile](ctx, collProfiles, guestProfile.ID)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(guestDb.Homes).To(ContainElement(home.ID))
+
+				// the same code cannot be used twice
+				recorder = acceptInvitation(guestJwt, home.ID, invitationRes.Code)
+				Expect(recorder.Code).To(Equal(http.StatusConflict))
+				Expect(recorder.Body.String()).To(Equal(`{"error":"you are already a member of this home"}`))
+
+				// a guest cannot update the shared home
+				var homeBuf bytes.Buffer
+				err = json.NewEncoder(&homeBuf).Encode(api.HomeUpdateReq{Name: "home-renamed", Location: "location1"})
+				Expect(err).ShouldNot(HaveOccurred())
+				recorder = httptest.NewRecorder()
+				req := httptest.NewRequest(http.MethodPut, "/api/homes/"+home.ID.Hex(), &homeBuf)
+				req.Header.Add("Authorization", "Bearer "+guestJwt)
+				req.Header.Add("Content-Type", `application/json`)
+				router.ServeHTTP(recorder, req)
+				Expect(recorder.Code).To(Equal(http.StatusForbidden))
+				Expect(recorder.Body.String()).To(Equal(`{"error":"you don't have permission to update this home"}`))
+
+				// but it can list its members
+				recorder = httptest.NewRecorder()
+				req = httptest.NewRequest(http.MethodGet, "/api/homes/"+home.ID.Hex()+"/members", nil)
+				req.Header.Add("Authorization", "Bearer "+guestJwt)
+				router.ServeHTTP(recorder, req)
+				Expect(recorder.Code).To(Equal(http.StatusOK))
+				var membersRes api.HomeMembersResp
+				err = json.Unmarshal(recorder.Body.Bytes(), &membersRes)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(membersRes.Members).To(HaveLen(2))
+				Expect(membersRes.Members[1].Login).To(Equal(guestProfile.Github.Login))
+				Expect(membersRes.Invitations).To(HaveLen(0))
+			})
+
+			It("should not accept a wrong code", func() {
+				jwtToken, cookieSession := testuutils.GetJwt(router)
+				ownerProfile := testuutils.GetLoggedProfile(router, jwtToken, cookieSession)
+				err := testuutils.AssignHomeToProfile(ctx, collProfiles, ownerProfile.ID, home.ID)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				code, _ := createInvitation(jwtToken, cookieSession, home.ID, models.HomeRoleMember)
+				Expect(code).To(Equal(http.StatusOK))
+
+				recorder := acceptInvitation(testuutils.GetJwtForProfile(guestProfile), home.ID, "wrong-code")
+				Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+				Expect(recorder.Body.String()).To(Equal(`{"error":"invalid or expired invitation"}`))
+			})
+
+			It("should not accept a revoked invitation", func() {
+				jwtToken, cookieSession := testuutils.GetJwt(router)
+				ownerProfile := testuutils.GetLoggedProfile(router, jwtToken, cookieSession)
+				err := testuutils.AssignHomeToProfile(ctx, collProfiles, ownerProfile.ID, home.ID)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				code, invitationRes := createInvitation(jwtToken, cookieSession, home.ID, models.HomeRoleMember)
+				Expect(code).To(Equal(http.StatusOK))
+
+				recorder := httptest.NewRecorder()
+				req := httptest.NewRequest(http.MethodDelete, "/api/homes/"+home.ID.Hex()+"/members/invitations/"+invitationRes.ID.Hex(), nil)
+				req.Header.Add("Cookie", cookieSession)
+				req.Header.Add("Authorization", "Bearer "+jwtToken)
+				router.ServeHTTP(recorder, req)
+				Expect(recorder.Code).To(Equal(http.StatusOK))
+
+				recorder = acceptInvitation(testuutils.GetJwtForProfile(guestProfile), home.ID, invitationRes.Code)
+				Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+				Expect(recorder.Body.String()).To(Equal(`{"error":"invalid or expired invitation"}`))
+			})
+		})
+
+		When("the profile is not a member of the home", func() {
+			It("should not create an invitation", func() {
+				jwtToken, cookieSession := testuutils.GetJwt(router)
+				code, _ := createInvitation(jwtToken, cookieSession, home.ID, models.HomeRoleMember)
+				Expect(code).To(Equal(http.StatusBadRequest))
+			})
+		})
+
+		When("an admin invites with role admin", func() {
+			It("should be forbidden", func() {
+				jwtToken, cookieSession := testuutils.GetJwt(router)
+				ownerProfile := testuutils.GetLoggedProfile(router, jwtToken, cookieSession)
+				_, err := collHomes.UpdateOne(ctx, bson.M{"_id": home.ID}, bson.M{"$set": bson.M{"members": []models.HomeMember{
+					{ProfileID: guestProfile.ID, Role: models.HomeRoleOwner, AddedAt: currentDate},
+					{ProfileID: ownerProfile.ID, Role: models.HomeRoleAdmin, AddedAt: currentDate},
+				}}})
+				Expect(err).ShouldNot(HaveOccurred())
+
+				code, _ := createInvitation(jwtToken, cookieSession, home.ID, models.HomeRoleAdmin)
+				Expect(code).To(Equal(http.StatusForbidden))
+			})
+		})
+	})
+
+	Context("removing a member", func() {
+		When("the owner removes a member", func() {
+			It("should remove the member from the home and its profile", func() {
+				jwtToken, cookieSession := testuutils.GetJwt(router)
+				ownerProfile := testuutils.GetLoggedProfile(router, jwtToken, cookieSession)
+				err := testuutils.AssignHomeToProfile(ctx, collProfiles, ownerProfile.ID, home.ID)
+				Expect(err).ShouldNot(HaveOccurred())
+				err = testuutils.AssignHomeToProfile(ctx, collProfiles, guestProfile.ID, home.ID)
+				Expect(err).ShouldNot(HaveOccurred())
+				_, err = collHomes.UpdateOne(ctx, bson.M{"_id": home.ID}, bson.M{"$set": bson.M{"members": []models.HomeMember{
+					{ProfileID: ownerProfile.ID, Role: models.HomeRoleOwner, AddedAt: currentDate},
+					{ProfileID: guestProfile.ID, Role: models.HomeRoleMember, AddedAt: currentDate},
+				}}})
+				Expect(err).ShouldNot(HaveOccurred())
+
+				recorder := httptest.NewRecorder()
+				req := httptest.NewRequest(http.MethodDelete, "/api/homes/"+home.ID.Hex()+"/members/"+guestProfile.ID.Hex(), nil)
+				req.Header.Add("Cookie", cookieSession)
+				req.Header.Add("Authorization", "Bearer "+jwtToken)
+				router.ServeHTTP(recorder, req)
+				Expect(recorder.Code).To(Equal(http.StatusOK))
+
+				homeDb, err := testuutils.FindOneById[models.Home](ctx, collHomes, home.ID)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(homeDb.Members).To(HaveLen(1))
+				guestDb, err := testuutils.FindOneById[models.Profile](ctx, collProfiles, guestProfile.ID)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(guestDb.Homes).ToNot(ContainElement(home.ID))
+			})
+		})
+
+		When("a member tries to remove the owner", func() {
+			It("should fail", func() {
+				jwtToken, cookieSession := testuutils.GetJwt(router)
+				ownerProfile := testuutils.GetLoggedProfile(router, jwtToken, cookieSession)
+				_, err := collHomes.UpdateOne(ctx, bson.M{"_id": home.ID}, bson.M{"$set": bson.M{"members": []models.HomeMember{
+					{ProfileID: ownerProfile.ID, Role: models.HomeRoleOwner, AddedAt: currentDate},
+					{ProfileID: guestProfile.ID, Role: models.HomeRoleMember, AddedAt: currentDate},
+				}}})
+				Expect(err).ShouldNot(HaveOccurred())
+
+				recorder := httptest.NewRecorder()
+				req := httptest.NewRequest(http.MethodDelete, "/api/homes/"+home.ID.Hex()+"/members/"+ownerProfile.ID.Hex(), nil)
+				req.Header.Add("Authorization", "Bearer "+testuutils.GetJwtForProfile(guestProfile))
+				router.ServeHTTP(recorder, req)
+				Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+				Expect(recorder.Body.String()).To(Equal(`{"error":"the owner cannot be removed from a home"}`))
+			})
+		})
+	})
+})
@@ -353,6 +353,32 @@ var _ = Describe("Homes", func() {
 				Expect(recorder.Code).To(Equal(http.StatusBadRequest))
 				Expect(recorder.Body.String()).To(Equal(`{"error":"cannot update a home that is not in your profile"}`))
 			})
+
+			It("should return an error, if homeId is in profile but not in db", func() {
+				jwtToken, cookieSession := testuutils.GetJwt(router)
+				profileRes := testuutils.GetLoggedProfile(router, jwtToken, cookieSession)
+
+				missingHomeID := bson.NewObjectID()
+				err := testuutils.AssignHomeToProfile(ctx, collProfiles, profileRes.ID, missingHomeID)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				updateHome1 := api.HomeUpdateReq{
+					Name:     "home3",
+					Location: "location3",
+				}
+				var homeBuf bytes.Buffer
+				err = json.NewEncoder(&homeBuf).Encode(updateHome1)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				recorder := httptest.NewRecorder()
+				req := httptest.NewRequest(http.MethodPut, "/api/homes/"+missingHomeID.Hex(), &homeBuf)
+				req.Header.Add("Cookie", cookieSession)
+				req.Header.Add("Authorization", "Bearer "+jwtToken)
+				req.Header.Add("Content-Type", `application/json`)
+				router.ServeHTTP(recorder, req)
+				Expect(recorder.Code).To(Equal(http.StatusNotFound))
+				Expect(recorder.Body.String()).To(Equal(`{"error":"cannot find home"}`))
+			})
 		})
 	})
 
@@ -0,0 +1,188 @@
+package integration_tests
+
+import (
+	"api-server/db"
+	"api-server/initialization"
+	"api-server/models"
+	"api-server/testuutils"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+
+	"github.com/gin-gonic/gin"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.uber.org/zap"
+)
+
+var _ = Describe("Identities", func() {
+	var ctx context.Context
+	var logger *zap.SugaredLogger
+	var router *gin.Engine
+	var client *mongo.Client
+	var collProfiles *mongo.Collection
+	var collRefreshTokens *mongo.Collection
+	var idp *testuutils.OIDCMock
+
+	oidcEnv := []string{
+		"OIDC_PROVIDERS",
+		"OIDC_KEYCLOAK_ISSUER",
+		"OIDC_KEYCLOAK_CLIENTID",
+		"OIDC_KEYCLOAK_SECRETID",
+		"OIDC_KEYCLOAK_CALLBACK",
+	}
+
+	callIdentities := func(method, url, jwtToken, cookieSession string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest(method, url, nil)
+		req.Header.Add("Cookie", cookieSession)
+		req.Header.Add("Authorization", "Bearer "+jwtToken)
+		router.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	// linkKeycloak links the identity of idp to the logged profile, returning the response of the callback
+	linkKeycloak := func(jwtToken, cookieSession string) *httptest.ResponseRecorder {
+		recorder := callIdentities(http.MethodPost, "/api/identities/keycloak/link", jwtToken, cookieSession)
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+		var res struct {
+			URL string `json:"url"`
+		}
+		Expect(json.Unmarshal(recorder.Body.Bytes(), &res)).To(Succeed())
+		Expect(res.URL).To(HavePrefix(idp.Server.URL + "/authorize"))
+		linkCookieSession := recorder.Header().Get("Set-Cookie")
+
+		callbackURL := idp.Authorize(res.URL)
+		recorder = httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, callbackURL.RequestURI(), nil)
+		req.Header.Add("Cookie", linkCookieSession)
+		router.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	getIdentities := func(jwtToken, cookieSession string) []models.Identity {
+		recorder := callIdentities(http.MethodGet, "/api/identities", jwtToken, cookieSession)
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+		var identities []models.Identity
+		Expect(json.Unmarshal(recorder.Body.Bytes(), &identities)).To(Succeed())
+		return identities
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+
+		idp = testuutils.NewOIDCMock("oidc-client-id", testuutils.OIDCMockUser{
+			Subject: "keycloak-user-1",
+			Login:   "oidcuser",
+			Name:    "OIDC User",
+			Email:   "oidc@test.com",
+		})
+		Expect(os.Setenv("LIMIT_TO_USER_EMAILS", "test@test.com,oidc@test.com")).To(Succeed())
+		Expect(os.Setenv("OIDC_PROVIDERS", "keycloak")).To(Succeed())
+		Expect(os.Setenv("OIDC_KEYCLOAK_ISSUER", idp.Server.URL)).To(Succeed())
+		Expect(os.Setenv("OIDC_KEYCLOAK_CLIENTID", "oidc-client-id")).To(Succeed())
+		Expect(os.Setenv("OIDC_KEYCLOAK_SECRETID", "oidc-client-secret")).To(Succeed())
+		Expect(os.Setenv("OIDC_KEYCLOAK_CALLBACK", "http://localhost/api/oauth/providers/keycloak/callback")).To(Succeed())
+
+		logger, router, client = initialization.MustStart()
+		defer logger.Sync()
+
+		collProfiles = db.GetCollections(client).Profiles
+		collRefreshTokens = db.GetCollections(client).RefreshTokens
+	})
+
+	AfterEach(func() {
+		idp.Close()
+		for _, name := range oidcEnv {
+			Expect(os.Unsetenv(name)).To(Succeed())
+		}
+		testuutils.DropAllCollections(ctx, collProfiles, collRefreshTokens)
+	})
+
+	Context("linking identities", func() {
+		It("should link an OIDC login to a GitHub profile and log in with both", func() {
+			jwtToken, cookieSession := testuutils.GetJwt(router)
+			profile := testuutils.GetLoggedProfile(router, jwtToken, cookieSession)
+
+			recorder := linkKeycloak(jwtToken, cookieSession)
+			Expect(recorder.Code).To(Equal(http.StatusFound))
+			Expect(recorder.Header().Get("Location")).To(Equal("/postlink#provider=keycloak"))
+
+			identities := getIdentities(jwtToken, cookieSession)
+			Expect(identities).To(HaveLen(2))
+			Expect(identities[0].Provider).To(Equal(models.IdentityProviderGitHub))
+			Expect(identities[1].ID).To(Equal(models.IdentityID("keycloak", "keycloak-user-1")))
+			Expect(identities[1].LinkedAt).ToNot(BeZero())
+
+			oidcJwtToken, oidcCookieSession := testuutils.GetJwtWithOIDC(router, idp, "keycloak")
+			Expect(testuutils.GetLoggedProfile(router, oidcJwtToken, oidcCookieSession).ID).To(Equal(profile.ID))
+			jwtToken, cookieSession = testuutils.GetJwt(router)
+			Expect(testuutils.GetLoggedProfile(router, jwtToken, cookieSession).ID).To(Equal(profile.ID))
+
+			count, err := collProfiles.CountDocuments(ctx, bson.M{})
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(count).To(Equal(int64(1)))
+		})
+
+		It("should return an error, if the identity is linked to another profile", func() {
+			testuutils.GetJwtWithOIDC(router, idp, "keycloak")
+			jwtToken, cookieSession := testuutils.GetJwt(router)
+
+			recorder := linkKeycloak(jwtToken, cookieSession)
+			Expect(recorder.Code).To(Equal(http.StatusConflict))
+			Expect(getIdentities(jwtToken, cookieSession)).To(HaveLen(1))
+		})
+
+		It("should return an error, if a login of the provider is already linked", func() {
+			jwtToken, cookieSession := testuutils.GetJwt(router)
+			Expect(linkKeycloak(jwtToken, cookieSession).Code).To(Equal(http.StatusFound))
+
+			idp.SetUser(testuutils.OIDCMockUser{Subject: "keycloak-user-2", Login: "oidcuser2", Email: "oidc@test.com"})
+			recorder := linkKeycloak(jwtToken, cookieSession)
+			Expect(recorder.Code).To(Equal(http.StatusConflict))
+			Expect(getIdentities(jwtToken, cookieSession)).To(HaveLen(2))
+		})
+
+		It("should return an error, if the provider is unknown", func() {
+			jwtToken, cookieSession := testuutils.GetJwt(router)
+			recorder := callIdentities(http.MethodPost, "/api/identities/unknown/link", jwtToken, cookieSession)
+			Expect(recorder.Code).To(Equal(http.StatusNotFound))
+		})
+
+		It("should return an error, if not authenticated", func() {
+			recorder := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/api/identities/keycloak/link", nil)
+			router.ServeHTTP(recorder, req)
+			Expect(recorder.Code).To(Equal(http.StatusUnauthorized))
+		})
+	})
+
+	Context("unlinking identities", func() {
+		It("should unlink an identity, but not the last one", func() {
+			jwtToken, cookieSession := testuutils.GetJwt(router)
+			Expect(linkKeycloak(jwtToken, cookieSession).Code).To(Equal(http.StatusFound))
+
+			recorder := callIdentities(http.MethodDelete, "/api/identities/github", jwtToken, cookieSession)
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			identities := getIdentities(jwtToken, cookieSession)
+			Expect(identities).To(HaveLen(1))
+			Expect(identities[0].Provider).To(Equal("keycloak"))
+			Expect(testuutils.GetLoggedProfile(router, jwtToken, cookieSession).Github.ID).To(BeZero())
+
+			recorder = callIdentities(http.MethodDelete, "/api/identities/keycloak", jwtToken, cookieSession)
+			Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+			Expect(recorder.Body.String()).To(ContainSubstring("cannot unlink the last login"))
+			Expect(getIdentities(jwtToken, cookieSession)).To(HaveLen(1))
+		})
+
+		It("should return an error, if the identity isn't linked", func() {
+			jwtToken, cookieSession := testuutils.GetJwt(router)
+			recorder := callIdentities(http.MethodDelete, "/api/identities/keycloak", jwtToken, cookieSession)
+			Expect(recorder.Code).To(Equal(http.StatusNotFound))
+		})
+	})
+})
@@ -0,0 +1,140 @@
+package integration_tests
+
+import (
+	"api-server/db"
+	"api-server/initialization"
+	"api-server/models"
+	"api-server/testuutils"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+
+	"github.com/gin-gonic/gin"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.uber.org/zap"
+)
+
+var _ = Describe("LoginOIDC", func() {
+	var ctx context.Context
+	var logger *zap.SugaredLogger
+	var router *gin.Engine
+	var client *mongo.Client
+	var collProfiles *mongo.Collection
+	var collRefreshTokens *mongo.Collection
+	var idp *testuutils.OIDCMock
+
+	oidcEnv := []string{
+		"OIDC_PROVIDERS",
+		"OIDC_KEYCLOAK_ISSUER",
+		"OIDC_KEYCLOAK_CLIENTID",
+		"OIDC_KEYCLOAK_SECRETID",
+		"OIDC_KEYCLOAK_CALLBACK",
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+
+		idp = testuutils.NewOIDCMock("oidc-client-id", testuutils.OIDCMockUser{
+			Subject: "keycloak-user-1",
+			Login:   "oidcuser",
+			Name:    "OIDC User",
+			Email:   "oidc@test.com",
+		})
+		Expect(os.Setenv("LIMIT_TO_USER_EMAILS", "test@test.com,oidc@test.com")).To(Succeed())
+		Expect(os.Setenv("OIDC_PROVIDERS", "keycloak")).To(Succeed())
+		Expect(os.Setenv("OIDC_KEYCLOAK_ISSUER", idp.Server.URL)).To(Succeed())
+		Expect(os.Setenv("OIDC_KEYCLOAK_CLIENTID", "oidc-client-id")).To(Succeed())
+		Expect(os.Setenv("OIDC_KEYCLOAK_SECRETID", "oidc-client-secret")).To(Succeed())
+		Expect(os.Setenv("OIDC_KEYCLOAK_CALLBACK", "http://localhost/api/oauth/providers/keycloak/callback")).To(Succeed())
+
+		logger, router, client = initialization.MustStart()
+		defer logger.Sync()
+
+		collProfiles = db.GetCollections(client).Profiles
+		collRefreshTokens = db.GetCollections(client).RefreshTokens
+	})
+
+	AfterEach(func() {
+		idp.Close()
+		for _, name := range oidcEnv {
+			Expect(os.Unsetenv(name)).To(Succeed())
+		}
+		testuutils.DropAllCollections(ctx, collProfiles, collRefreshTokens)
+	})
+
+	Context("calling providers api", func() {
+		It("should list GitHub and configured OIDC providers", func() {
+			recorder := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/api/oauth/providers", nil)
+			router.ServeHTTP(recorder, req)
+
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			var res struct {
+				Providers []string `json:"providers"`
+			}
+			Expect(json.Unmarshal(recorder.Body.Bytes(), &res)).To(Succeed())
+			Expect(res.Providers).To(Equal([]string{"github", "keycloak"}))
+		})
+	})
+
+	Context("calling login api", func() {
+		It("should login with an OIDC provider and create a profile", func() {
+			jwtToken, cookieSession := testuutils.GetJwtWithOIDC(router, idp, "keycloak")
+
+			profile := testuutils.GetLoggedProfile(router, jwtToken, cookieSession)
+			Expect(profile.Github.ID).To(BeZero())
+			Expect(profile.Identities).To(HaveLen(1))
+			Expect(profile.Identities[0].ID).To(Equal(models.IdentityID("keycloak", "keycloak-user-1")))
+			Expect(profile.Identities[0].Provider).To(Equal("keycloak"))
+			Expect(profile.Identities[0].Login).To(Equal("oidcuser"))
+			Expect(profile.Identities[0].Email).To(Equal("oidc@test.com"))
+			Expect(profile.Identities[0].EmailVerified).To(BeTrue())
+		})
+
+		It("should login again with the same profile", func() {
+			jwtToken, cookieSession := testuutils.GetJwtWithOIDC(router, idp, "keycloak")
+			first := testuutils.GetLoggedProfile(router, jwtToken, cookieSession)
+
+			jwtToken, cookieSession = testuutils.GetJwtWithOIDC(router, idp, "keycloak")
+			second := testuutils.GetLoggedProfile(router, jwtToken, cookieSession)
+			Expect(second.ID).To(Equal(first.ID))
+
+			count, err := collProfiles.CountDocuments(ctx, bson.M{})
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(count).To(Equal(int64(1)))
+		})
+
+		It("should reject OIDC users with emails not allowed", func() {
+			idp.SetUser(testuutils.OIDCMockUser{Subject: "keycloak-user-2", Login: "other", Email: "other@test.com"})
+
+			recorder := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/api/oauth/providers/keycloak/login", nil)
+			router.ServeHTTP(recorder, req)
+			Expect(recorder.Code).To(Equal(http.StatusTemporaryRedirect))
+			cookieSession := recorder.Header().Get("Set-Cookie")
+			callbackURL := idp.Authorize(recorder.Header().Get("Location"))
+
+			recorder = httptest.NewRecorder()
+			req = httptest.NewRequest(http.MethodGet, callbackURL.RequestURI(), nil)
+			req.Header.Add("Cookie", cookieSession)
+			router.ServeHTTP(recorder, req)
+			Expect(recorder.Code).To(Equal(http.StatusInternalServerError))
+			count, err := collProfiles.CountDocuments(ctx, bson.M{})
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(count).To(BeZero())
+		})
+
+		It("should return an error, if the provider is unknown", func() {
+			recorder := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/api/oauth/providers/unknown/login", nil)
+			router.ServeHTTP(recorder, req)
+			Expect(recorder.Code).To(Equal(http.StatusNotFound))
+			Expect(recorder.Body.String()).To(ContainSubstring("unknown identity provider"))
+		})
+	})
+})
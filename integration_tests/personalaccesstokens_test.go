@@ -0,0 +1,172 @@
+package integration_tests
+
+import (
+	"api-server/api"
+	"api-server/db"
+	"api-server/initialization"
+	"api-server/models"
+	"api-server/testuutils"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.uber.org/zap"
+)
+
+var _ = Describe("PersonalAccessTokens", func() {
+	var ctx context.Context
+	var logger *zap.SugaredLogger
+	var router *gin.Engine
+	var client *mongo.Client
+	var collProfiles *mongo.Collection
+	var collRefreshTokens *mongo.Collection
+	var collPersonalAccessTokens *mongo.Collection
+	var jwtToken string
+	var cookieSession string
+
+	call := func(method, url, token, cookie string, body any) *httptest.ResponseRecorder {
+		var payload []byte
+		if body != nil {
+			var err error
+			payload, err = json.Marshal(body)
+			Expect(err).ShouldNot(HaveOccurred())
+		}
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest(method, url, bytes.NewReader(payload))
+		req.Header.Add("Content-Type", "application/json")
+		if cookie != "" {
+			req.Header.Add("Cookie", cookie)
+		}
+		req.Header.Add("Authorization", "Bearer "+token)
+		router.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	createToken := func(scopes ...string) api.PersonalAccessTokenNewRes {
+		recorder := call(http.MethodPost, "/api/personal-access-tokens", jwtToken, cookieSession, api.PersonalAccessTokenNewReq{
+			Name:          "script",
+			Scopes:        scopes,
+			ExpiresInDays: 30,
+		})
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+		var res api.PersonalAccessTokenNewRes
+		Expect(json.Unmarshal(recorder.Body.Bytes(), &res)).To(Succeed())
+		return res
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+
+		err := os.Setenv("LIMIT_TO_USER_EMAILS", "test@test.com")
+		Expect(err).ShouldNot(HaveOccurred())
+
+		logger, router, client = initialization.MustStart()
+		defer logger.Sync()
+
+		collProfiles = db.GetCollections(client).Profiles
+		collRefreshTokens = db.GetCollections(client).RefreshTokens
+		collPersonalAccessTokens = db.GetCollections(client).PersonalAccessTokens
+
+		jwtToken, cookieSession = testuutils.GetJwt(router)
+	})
+
+	AfterEach(func() {
+		testuutils.DropAllCollections(ctx, collProfiles, collRefreshTokens, collPersonalAccessTokens)
+	})
+
+	Context("managing personal access tokens", func() {
+		It("should create, list and delete a token", func() {
+			res := createToken(models.ScopeHomesRead)
+			Expect(res.Token).To(HavePrefix(models.PersonalAccessTokenPrefix))
+			Expect(res.Scopes).To(Equal([]string{models.ScopeHomesRead}))
+			Expect(res.ExpiresAt).To(BeTemporally("~", time.Now().Add(30*24*time.Hour), time.Minute))
+
+			var pat models.PersonalAccessToken
+			Expect(collPersonalAccessTokens.FindOne(ctx, bson.M{"_id": res.ID}).Decode(&pat)).To(Succeed())
+			Expect(pat.TokenHash).ToNot(BeEmpty())
+			Expect(pat.TokenHash).ToNot(ContainSubstring(res.Token))
+
+			recorder := call(http.MethodGet, "/api/personal-access-tokens", jwtToken, cookieSession, nil)
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			Expect(recorder.Body.String()).ToNot(ContainSubstring(res.Token))
+			var pats []models.PersonalAccessToken
+			Expect(json.Unmarshal(recorder.Body.Bytes(), &pats)).To(Succeed())
+			Expect(pats).To(HaveLen(1))
+			Expect(pats[0].Name).To(Equal("script"))
+
+			recorder = call(http.MethodDelete, "/api/personal-access-tokens/"+res.ID.Hex(), jwtToken, cookieSession, nil)
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			recorder = call(http.MethodGet, "/api/homes", res.Token, "", nil)
+			Expect(recorder.Code).To(Equal(http.StatusUnauthorized))
+			recorder = call(http.MethodDelete, "/api/personal-access-tokens/"+res.ID.Hex(), jwtToken, cookieSession, nil)
+			Expect(recorder.Code).To(Equal(http.StatusNotFound))
+		})
+
+		It("should return an error, if the request body is not valid", func() {
+			for _, body := range []api.PersonalAccessTokenNewReq{
+				{Name: "script", Scopes: []string{"profile:write"}, ExpiresInDays: 30},
+				{Name: "script", Scopes: []string{}, ExpiresInDays: 30},
+				{Name: "script", Scopes: []string{models.ScopeHomesRead}, ExpiresInDays: 366},
+				{Name: "", Scopes: []string{models.ScopeHomesRead}, ExpiresInDays: 30},
+			} {
+				recorder := call(http.MethodPost, "/api/personal-access-tokens", jwtToken, cookieSession, body)
+				Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+			}
+		})
+
+		It("should not manage tokens with a personal access token", func() {
+			res := createToken(models.PersonalAccessTokenScopes...)
+			recorder := call(http.MethodPost, "/api/personal-access-tokens", res.Token, "", api.PersonalAccessTokenNewReq{
+				Name:          "other",
+				Scopes:        []string{models.ScopeHomesRead},
+				ExpiresInDays: 30,
+			})
+			Expect(recorder.Code).To(Equal(http.StatusForbidden))
+		})
+	})
+
+	Context("calling apis with a personal access token", func() {
+		It("should allow apis of its scopes only", func() {
+			res := createToken(models.ScopeHomesRead)
+
+			recorder := call(http.MethodGet, "/api/homes", res.Token, "", nil)
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+
+			recorder = call(http.MethodPost, "/api/homes", res.Token, "", api.HomeNewReq{Name: "home", Location: "location", Rooms: []api.RoomNewReq{}})
+			Expect(recorder.Code).To(Equal(http.StatusForbidden))
+			Expect(recorder.Body.String()).To(ContainSubstring(models.ScopeHomesWrite))
+
+			var pat models.PersonalAccessToken
+			Expect(collPersonalAccessTokens.FindOne(ctx, bson.M{"_id": res.ID}).Decode(&pat)).To(Succeed())
+			Expect(pat.LastUsedAt).ToNot(BeNil())
+		})
+
+		It("should not allow account apis", func() {
+			res := createToken(models.PersonalAccessTokenScopes...)
+			for _, url := range []string{"/api/profile", "/api/sessions", "/api/identities"} {
+				recorder := call(http.MethodGet, url, res.Token, "", nil)
+				Expect(recorder.Code).To(Equal(http.StatusForbidden))
+			}
+		})
+
+		It("should return an error, if the token is not valid or expired", func() {
+			recorder := call(http.MethodGet, "/api/homes", models.PersonalAccessTokenPrefix+"unknown", "", nil)
+			Expect(recorder.Code).To(Equal(http.StatusUnauthorized))
+
+			res := createToken(models.ScopeHomesRead)
+			_, err := collPersonalAccessTokens.UpdateOne(ctx, bson.M{"_id": res.ID}, bson.M{"$set": bson.M{"expiresAt": time.Now().Add(-time.Minute)}})
+			Expect(err).ShouldNot(HaveOccurred())
+			recorder = call(http.MethodGet, "/api/homes", res.Token, "", nil)
+			Expect(recorder.Code).To(Equal(http.StatusUnauthorized))
+		})
+	})
+})
@@ -6,15 +6,20 @@ import (
 	"api-server/initialization"
 	"api-server/models"
 	"api-server/testuutils"
+	"archive/zip"
 	"bytes"
 	"context"
 	"encoding/json"
+	"io"
 	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"go.mongodb.org/mongo-driver/v2/bson"
@@ -44,6 +49,9 @@ var _ = Describe("Profiles", func() {
 	var collHomes *mongo.Collection
 	var collDevices *mongo.Collection
 	var httpMockServer *httptest.Server
+	// paths of the online sensors deleted in the online service
+	var deletedOnlinePaths []string
+	var deletedOnlinePathsMu sync.Mutex
 
 	keepAliveOnlineHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
@@ -69,6 +77,17 @@ var _ = Describe("Profiles", func() {
 		w.WriteHeader(http.StatusOK)
 	})
 
+	deleteOnlineHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		deletedOnlinePathsMu.Lock()
+		deletedOnlinePaths = append(deletedOnlinePaths, r.URL.Path)
+		deletedOnlinePathsMu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	})
+
 	BeforeEach(func() {
 		logger, router, client = initialization.MustStart()
 		ctx = context.Background()
@@ -85,6 +104,10 @@ var _ = Describe("Profiles", func() {
 		mux := http.NewServeMux()
 		mux.HandleFunc("/keepalive/", keepAliveOnlineHandler)
 		mux.HandleFunc("/api-token/rotate/", apiTokenRotateOnlineHandler)
+		mux.HandleFunc("/online/", deleteOnlineHandler)
+		deletedOnlinePathsMu.Lock()
+		deletedOnlinePaths = nil
+		deletedOnlinePathsMu.Unlock()
 		httpListener, errHTTP := net.Listen("tcp", "localhost:8089")
 		logger.Infof("online_test - HTTP client listening at %s", httpListener.Addr().String())
 		Expect(errHTTP).ShouldNot(HaveOccurred())
@@ -187,6 +210,11 @@ var _ = Describe("Profiles", func() {
 			err = json.Unmarshal(recorder.Body.Bytes(), &response)
 			Expect(err).ShouldNot(HaveOccurred())
 			Expect(response.Message).To(Equal("Profile update with FCM Token"))
+
+			// deprecated fields are still returned, with the most recent token
+			profileRes = testuutils.GetLoggedProfile(router, jwtToken, cookieSession)
+			Expect(profileRes.FCMToken).To(Equal("MOCKED_FCM_TOKEN"))
+			Expect(profileRes.FCMTokenTimestamp).To(BeTemporally("~", time.Now(), 5*time.Second))
 		})
 
 		It("should return an error, if profileId is wrong", func() {
@@ -268,4 +296,152 @@ var _ = Describe("Profiles", func() {
 			Expect(recorder.Body.String()).To(Equal(`{"error":"invalid request body, these fields are not valid: fcmtoken"}`))
 		})
 	})
+
+	Context("calling profiles api DELETE", func() {
+		callDelete := func(jwtToken, cookieSession string, body any) *httptest.ResponseRecorder {
+			var buf bytes.Buffer
+			Expect(json.NewEncoder(&buf).Encode(body)).To(Succeed())
+			recorder := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodDelete, "/api/profile", &buf)
+			req.Header.Add("Cookie", cookieSession)
+			req.Header.Add("Authorization", "Bearer "+jwtToken)
+			req.Header.Add("Content-Type", `application/json`)
+			router.ServeHTTP(recorder, req)
+			return recorder
+		}
+		getDeletionToken := func(jwtToken, cookieSession string) api.ProfileDeletionTokenRes {
+			recorder := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/api/profile/deletion-token", nil)
+			req.Header.Add("Cookie", cookieSession)
+			req.Header.Add("Authorization", "Bearer "+jwtToken)
+			router.ServeHTTP(recorder, req)
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			var res api.ProfileDeletionTokenRes
+			Expect(json.Unmarshal(recorder.Body.Bytes(), &res)).To(Succeed())
+			Expect(res.ExpiresAt).To(BeTemporally("~", time.Now().Add(5*time.Minute), time.Minute))
+			return res
+		}
+
+		It("should delete the profile with its homes and devices", func() {
+			jwtToken, cookieSession := testuutils.GetJwt(router)
+			profileRes := testuutils.GetLoggedProfile(router, jwtToken, cookieSession)
+
+			home := models.Home{
+				ID:       bson.NewObjectID(),
+				Name:     "home",
+				Location: "location",
+				Rooms:    []models.Room{},
+				Members:  []models.HomeMember{{ProfileID: profileRes.ID, Role: models.HomeRoleOwner, AddedAt: time.Now()}},
+			}
+			Expect(testuutils.InsertOne(ctx, collHomes, home)).To(Succeed())
+			Expect(testuutils.AssignHomeToProfile(ctx, collProfiles, profileRes.ID, home.ID)).To(Succeed())
+			device := models.Device{ID: bson.NewObjectID(), Mac: "11:22:33:44:55:66", UUID: uuid.NewString()}
+			Expect(testuutils.InsertOne(ctx, collDevices, device)).To(Succeed())
+			Expect(testuutils.AssignDeviceToProfile(ctx, collProfiles, profileRes.ID, device.ID)).To(Succeed())
+
+			deletionToken := getDeletionToken(jwtToken, cookieSession)
+			recorder := callDelete(jwtToken, cookieSession, api.ProfileDeleteReq{DeletionToken: deletionToken.DeletionToken})
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+
+			_, err := testuutils.FindOneById[models.Profile](ctx, collProfiles, profileRes.ID)
+			Expect(err).To(MatchError(mongo.ErrNoDocuments))
+			_, err = testuutils.FindOneById[models.Home](ctx, collHomes, home.ID)
+			Expect(err).To(MatchError(mongo.ErrNoDocuments))
+			_, err = testuutils.FindOneById[models.Device](ctx, collDevices, device.ID)
+			Expect(err).To(MatchError(mongo.ErrNoDocuments))
+
+			// the access token is still valid, but its profile is gone
+			recorder = callDelete(jwtToken, cookieSession, api.ProfileDeleteReq{DeletionToken: deletionToken.DeletionToken})
+			Expect(recorder.Code).To(Equal(http.StatusUnauthorized))
+		})
+
+		It("should delete online sensors of devices, except the ones with a malformed UUID", func() {
+			jwtToken, cookieSession := testuutils.GetJwt(router)
+			profileRes := testuutils.GetLoggedProfile(router, jwtToken, cookieSession)
+
+			onlineFeature := models.Feature{UUID: uuid.NewString(), Type: models.Sensor, Name: "online", Enable: true, Order: 1, Unit: "-"}
+			validDevice := models.Device{ID: bson.NewObjectID(), Mac: "11:22:33:44:55:66", UUID: uuid.NewString(), Features: []models.Feature{onlineFeature}}
+			malformedDevice := models.Device{ID: bson.NewObjectID(), Mac: "11:22:33:44:55:77", UUID: "not-a-uuid/../x", Features: []models.Feature{onlineFeature}}
+			for _, device := range []models.Device{validDevice, malformedDevice} {
+				Expect(testuutils.InsertOne(ctx, collDevices, device)).To(Succeed())
+				Expect(testuutils.AssignDeviceToProfile(ctx, collProfiles, profileRes.ID, device.ID)).To(Succeed())
+			}
+
+			deletionToken := getDeletionToken(jwtToken, cookieSession)
+			recorder := callDelete(jwtToken, cookieSession, api.ProfileDeleteReq{DeletionToken: deletionToken.DeletionToken})
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+
+			deletedOnlinePathsMu.Lock()
+			defer deletedOnlinePathsMu.Unlock()
+			Expect(deletedOnlinePaths).To(Equal([]string{"/online/" + validDevice.UUID}))
+			_, err := testuutils.FindOneById[models.Device](ctx, collDevices, malformedDevice.ID)
+			Expect(err).To(MatchError(mongo.ErrNoDocuments))
+		})
+
+		It("should return an error, if the deletion token is not valid or expired", func() {
+			jwtToken, cookieSession := testuutils.GetJwt(router)
+			profileRes := testuutils.GetLoggedProfile(router, jwtToken, cookieSession)
+
+			recorder := callDelete(jwtToken, cookieSession, api.ProfileDeleteReq{})
+			Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+			recorder = callDelete(jwtToken, cookieSession, api.ProfileDeleteReq{DeletionToken: "wrong"})
+			Expect(recorder.Code).To(Equal(http.StatusForbidden))
+
+			deletionToken := getDeletionToken(jwtToken, cookieSession)
+			_, err := collProfiles.UpdateOne(ctx, bson.M{"_id": profileRes.ID}, bson.M{"$set": bson.M{"deletionTokenExpiresAt": time.Now().Add(-time.Minute)}})
+			Expect(err).ShouldNot(HaveOccurred())
+			recorder = callDelete(jwtToken, cookieSession, api.ProfileDeleteReq{DeletionToken: deletionToken.DeletionToken})
+			Expect(recorder.Code).To(Equal(http.StatusForbidden))
+
+			_, err = testuutils.FindOneById[models.Profile](ctx, collProfiles, profileRes.ID)
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+	})
+
+	Context("calling profiles export api GET", func() {
+		It("should return a ZIP archive with the personal data", func() {
+			jwtToken, cookieSession := testuutils.GetJwt(router)
+			profileRes := testuutils.GetLoggedProfile(router, jwtToken, cookieSession)
+			device := models.Device{ID: bson.NewObjectID(), Mac: "11:22:33:44:55:66", UUID: uuid.NewString(), Features: []models.Feature{}}
+			Expect(testuutils.InsertOne(ctx, collDevices, device)).To(Succeed())
+			Expect(testuutils.AssignDeviceToProfile(ctx, collProfiles, profileRes.ID, device.ID)).To(Succeed())
+
+			recorder := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/api/profile/export", nil)
+			req.Header.Add("Cookie", cookieSession)
+			req.Header.Add("Authorization", "Bearer "+jwtToken)
+			router.ServeHTTP(recorder, req)
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			Expect(recorder.Header().Get("Content-Type")).To(Equal("application/zip"))
+
+			body := recorder.Body.Bytes()
+			archive, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+			Expect(err).ShouldNot(HaveOccurred())
+			files := map[string][]byte{}
+			for _, file := range archive.File {
+				reader, err := file.Open()
+				Expect(err).ShouldNot(HaveOccurred())
+				content, err := io.ReadAll(reader)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(reader.Close()).To(Succeed())
+				files[file.Name] = content
+			}
+			Expect(files).To(HaveKey("profile.json"))
+			Expect(files).To(HaveKey("homes.json"))
+			Expect(files).To(HaveKey("fcm_tokens.json"))
+			Expect(files).To(HaveKey("sessions.json"))
+			Expect(files).To(HaveKey("personal_access_tokens.json"))
+			Expect(files).To(HaveKey("feature_values.json"))
+			Expect(string(files["profile.json"])).ToNot(ContainSubstring("apiToken"))
+
+			var devices []models.Device
+			Expect(json.Unmarshal(files["devices.json"], &devices)).To(Succeed())
+			Expect(devices).To(HaveLen(1))
+			Expect(devices[0].ID).To(Equal(device.ID))
+			var sessions []map[string]any
+			Expect(json.Unmarshal(files["sessions.json"], &sessions)).To(Succeed())
+			Expect(sessions).ToNot(BeEmpty())
+			Expect(sessions[0]).ToNot(HaveKey("tokenHash"))
+		})
+	})
 })
@@ -0,0 +1,328 @@
+package integration_tests
+
+import (
+	"api-server/api"
+	"api-server/api/grpc/device"
+	"api-server/db"
+	"api-server/initialization"
+	"api-server/models"
+	"api-server/testuutils"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+)
+
+var _ = Describe("Rules", func() {
+	var ctx context.Context
+	var logger *zap.SugaredLogger
+	var router *gin.Engine
+	var client *mongo.Client
+	var collProfiles *mongo.Collection
+	var collHomes *mongo.Collection
+	var collDevices *mongo.Collection
+	var collRules *mongo.Collection
+	var collRuleExecutions *mongo.Collection
+	var collFeatureValues *mongo.Collection
+	var grpcMockServer *grpc.Server
+	var oldGRPCURL string
+	var oldGRPCURLSet bool
+
+	var ruleDate = time.Now()
+	var minTemp = 16.0
+	var maxTemp = 30.0
+	var deviceThermostat models.Device
+	var deviceAc models.Device
+	var home models.Home
+
+	doRequest := func(method, url, jwtToken, cookieSession string, body any) *httptest.ResponseRecorder {
+		var buf bytes.Buffer
+		if body != nil {
+			err := json.NewEncoder(&buf).Encode(body)
+			Expect(err).ShouldNot(HaveOccurred())
+		}
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest(method, url, &buf)
+		req.Header.Add("Cookie", cookieSession)
+		req.Header.Add("Authorization", "Bearer "+jwtToken)
+		req.Header.Add("Content-Type", `application/json`)
+		router.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	// ruleReq turns on the ac when the thermostat setpoint is above 25, re-arming below 24
+	ruleReq := func() api.RuleReq {
+		return api.RuleReq{
+			Name:    "Cool down",
+			Enabled: true,
+			Condition: api.RuleConditionReq{
+				DeviceID:    deviceThermostat.ID.Hex(),
+				FeatureUUID: deviceThermostat.Features[0].UUID,
+				Operator:    models.RuleOperatorGt,
+				Value:       25,
+				Hysteresis:  1,
+			},
+			Actions: []api.RuleActionReq{{
+				DeviceID: deviceAc.ID.Hex(),
+				Values: []models.DeviceFeatureState{{
+					FeatureUUID: deviceAc.Features[0].UUID,
+					Type:        models.Controller,
+					Name:        deviceAc.Features[0].Name,
+					Value:       20,
+				}},
+			}},
+		}
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+
+		// GRPC_URL must point to the mock listener before handlers are built
+		grpcListener, errGrpc := net.Listen("tcp", "127.0.0.1:0")
+		Expect(errGrpc).ShouldNot(HaveOccurred())
+		oldGRPCURL, oldGRPCURLSet = os.LookupEnv("GRPC_URL")
+		err := os.Setenv("GRPC_URL", grpcListener.Addr().String())
+		Expect(err).ShouldNot(HaveOccurred())
+		err = os.Setenv("LIMIT_TO_USER_EMAILS", "test@test.com")
+		Expect(err).ShouldNot(HaveOccurred())
+
+		logger, router, client = initialization.MustStart()
+		defer logger.Sync()
+
+		collProfiles = db.GetCollections(client).Profiles
+		collHomes = db.GetCollections(client).Homes
+		collDevices = db.GetCollections(client).Devices
+		collRules = db.GetCollections(client).Rules
+		collRuleExecutions = db.GetCollections(client).RuleExecutions
+		collFeatureValues = db.GetCollections(client).FeatureValues
+
+		grpcMockServer = grpc.NewServer()
+		device.RegisterDeviceServer(grpcMockServer, newDeviceGrpc(ctx, logger))
+		go func() {
+			defer GinkgoRecover()
+			errGrpc := grpcMockServer.Serve(grpcListener)
+			if errGrpc != nil && !errors.Is(errGrpc, grpc.ErrServerStopped) {
+				Fail(fmt.Sprintf("gRPC mock server failed: %v", errGrpc))
+			}
+		}()
+
+		deviceThermostat = models.Device{
+			ID:           bson.NewObjectID(),
+			Mac:          "EE:22:33:44:55:66",
+			Manufacturer: "test",
+			Model:        "test",
+			UUID:         uuid.NewString(),
+			Features: []models.Feature{{
+				UUID:   uuid.NewString(),
+				Type:   "controller",
+				Name:   "setpoint",
+				Enable: true,
+				Order:  1,
+				Unit:   "°C",
+				Spec:   models.Spec{Format: models.Float, Min: &minTemp, Max: &maxTemp},
+			}},
+			CreatedAt:  ruleDate,
+			ModifiedAt: ruleDate,
+		}
+		err = testuutils.InsertOne(ctx, collDevices, deviceThermostat)
+		Expect(err).ShouldNot(HaveOccurred())
+		deviceAc = models.Device{
+			ID:           bson.NewObjectID(),
+			Mac:          "EE:22:33:44:55:77",
+			Manufacturer: "test",
+			Model:        "test",
+			UUID:         uuid.NewString(),
+			Features: []models.Feature{{
+				UUID:   uuid.NewString(),
+				Type:   "controller",
+				Name:   "ac",
+				Enable: true,
+				Order:  1,
+				Unit:   "°C",
+				Spec:   models.Spec{Format: models.Float, Min: &minTemp, Max: &maxTemp},
+			}},
+			CreatedAt:  ruleDate,
+			ModifiedAt: ruleDate,
+		}
+		err = testuutils.InsertOne(ctx, collDevices, deviceAc)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		home = models.Home{
+			ID:       bson.NewObjectID(),
+			Name:     "home1",
+			Location: "location1",
+			Rooms: []models.Room{{
+				ID:         bson.NewObjectID(),
+				Name:       "room1",
+				Floor:      1,
+				CreatedAt:  ruleDate,
+				ModifiedAt: ruleDate,
+				Devices:    []bson.ObjectID{deviceThermostat.ID, deviceAc.ID},
+			}},
+			CreatedAt:  ruleDate,
+			ModifiedAt: ruleDate,
+		}
+		err = testuutils.InsertOne(ctx, collHomes, home)
+		Expect(err).ShouldNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		grpcMockServer.Stop()
+		testuutils.DropAllCollections(ctx, collProfiles, collHomes, collDevices, collRules, collRuleExecutions, collFeatureValues)
+		if oldGRPCURLSet {
+			Expect(os.Setenv("GRPC_URL", oldGRPCURL)).To(Succeed())
+		} else {
+			Expect(os.Unsetenv("GRPC_URL")).To(Succeed())
+		}
+	})
+
+	Context("calling rules api", func() {
+		When("profile owns the home", func() {
+			var jwtToken string
+			var cookieSession string
+
+			BeforeEach(func() {
+				jwtToken, cookieSession = testuutils.GetJwt(router)
+				profileID := testuutils.GetLoggedProfile(router, jwtToken, cookieSession).ID
+				err := testuutils.AssignHomeToProfile(ctx, collProfiles, profileID, home.ID)
+				Expect(err).ShouldNot(HaveOccurred())
+				err = testuutils.AssignDeviceToProfile(ctx, collProfiles, profileID, deviceThermostat.ID)
+				Expect(err).ShouldNot(HaveOccurred())
+				err = testuutils.AssignDeviceToProfile(ctx, collProfiles, profileID, deviceAc.ID)
+				Expect(err).ShouldNot(HaveOccurred())
+				err = testuutils.SetAPITokenToProfile(ctx, collProfiles, profileID, uuid.NewString())
+				Expect(err).ShouldNot(HaveOccurred())
+			})
+
+			It("should create a rule and dry-run it", func() {
+				recorder := doRequest(http.MethodPost, "/api/homes/"+home.ID.Hex()+"/rules", jwtToken, cookieSession, ruleReq())
+				Expect(recorder.Code).To(Equal(http.StatusOK))
+				var rule models.Rule
+				err := json.Unmarshal(recorder.Body.Bytes(), &rule)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(rule.Active).To(BeFalse())
+
+				value := 26.0
+				recorder = doRequest(http.MethodPost, "/api/homes/"+home.ID.Hex()+"/rules/"+rule.ID.Hex()+"/dry-run",
+					jwtToken, cookieSession, api.RuleDryRunReq{Value: &value})
+				Expect(recorder.Code).To(Equal(http.StatusOK))
+				var dryRun api.RuleDryRunResp
+				err = json.Unmarshal(recorder.Body.Bytes(), &dryRun)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(dryRun.ValueSource).To(Equal("request"))
+				Expect(dryRun.Matched).To(BeTrue())
+				Expect(dryRun.WouldTrigger).To(BeTrue())
+
+				value = 25.0
+				recorder = doRequest(http.MethodPost, "/api/homes/"+home.ID.Hex()+"/rules/"+rule.ID.Hex()+"/dry-run",
+					jwtToken, cookieSession, api.RuleDryRunReq{Value: &value})
+				Expect(recorder.Code).To(Equal(http.StatusOK))
+				err = json.Unmarshal(recorder.Body.Bytes(), &dryRun)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(dryRun.WouldTrigger).To(BeFalse())
+				Expect(dryRun.Reason).To(Equal("condition is not met"))
+
+				// without values in history, there is nothing to evaluate
+				recorder = doRequest(http.MethodPost, "/api/homes/"+home.ID.Hex()+"/rules/"+rule.ID.Hex()+"/dry-run",
+					jwtToken, cookieSession, nil)
+				Expect(recorder.Code).To(Equal(http.StatusNotFound))
+
+				ruleFromDb, err := testuutils.FindOneById[models.Rule](ctx, collRules, rule.ID)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(ruleFromDb.LastTriggeredAt).To(BeNil())
+			})
+
+			It("should execute a rule once, when the condition value crosses the threshold", func() {
+				recorder := doRequest(http.MethodPost, "/api/homes/"+home.ID.Hex()+"/rules", jwtToken, cookieSession, ruleReq())
+				Expect(recorder.Code).To(Equal(http.StatusOK))
+				var rule models.Rule
+				err := json.Unmarshal(recorder.Body.Bytes(), &rule)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				setSetpoint := func(value float32) {
+					recorder := doRequest(http.MethodPost, "/api/devices/"+deviceThermostat.ID.Hex()+"/values", jwtToken, cookieSession,
+						[]models.DeviceFeatureState{{
+							FeatureUUID: deviceThermostat.Features[0].UUID,
+							Type:        models.Controller,
+							Name:        deviceThermostat.Features[0].Name,
+							Value:       value,
+						}})
+					Expect(recorder.Code).To(Equal(http.StatusOK))
+				}
+				getExecutions := func() []models.RuleExecution {
+					recorder := doRequest(http.MethodGet, "/api/homes/"+home.ID.Hex()+"/rules/"+rule.ID.Hex()+"/executions",
+						jwtToken, cookieSession, nil)
+					Expect(recorder.Code).To(Equal(http.StatusOK))
+					var executions []models.RuleExecution
+					err := json.Unmarshal(recorder.Body.Bytes(), &executions)
+					Expect(err).ShouldNot(HaveOccurred())
+					return executions
+				}
+
+				setSetpoint(27)
+				Eventually(getExecutions).WithTimeout(5 * time.Second).Should(HaveLen(1))
+				executions := getExecutions()
+				Expect(executions[0].Success).To(BeTrue())
+				Expect(executions[0].TriggerValue).To(Equal(27.0))
+				Expect(executions[0].Results).To(HaveLen(1))
+				Expect(executions[0].Results[0].DeviceID).To(Equal(deviceAc.ID))
+
+				// still above the threshold, the rule has been already triggered
+				setSetpoint(28)
+				Consistently(getExecutions).WithTimeout(time.Second).Should(HaveLen(1))
+
+				// going back below the hysteresis band re-arms the rule
+				setSetpoint(23)
+				Eventually(func() bool {
+					ruleFromDb, err := testuutils.FindOneById[models.Rule](ctx, collRules, rule.ID)
+					Expect(err).ShouldNot(HaveOccurred())
+					return ruleFromDb.Active
+				}).WithTimeout(5 * time.Second).Should(BeFalse())
+				setSetpoint(27)
+				Eventually(getExecutions).WithTimeout(5 * time.Second).Should(HaveLen(2))
+			})
+
+			It("should not create a rule with actions outside the feature spec", func() {
+				req := ruleReq()
+				req.Actions[0].Values[0].Value = 40
+				recorder := doRequest(http.MethodPost, "/api/homes/"+home.ID.Hex()+"/rules", jwtToken, cookieSession, req)
+				Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+				Expect(recorder.Body.String()).To(Equal(`{"actions":[{"deviceId":"` + deviceAc.ID.Hex() +
+					`","error":"invalid device feature values","features":[{"featureUuid":"` + deviceAc.Features[0].UUID +
+					`","name":"ac","error":"value must be less than or equal to 30"}]}],"error":"invalid rule actions"}`))
+			})
+
+			It("should not create a rule with a condition on an unknown feature", func() {
+				req := ruleReq()
+				req.Condition.FeatureUUID = uuid.NewString()
+				recorder := doRequest(http.MethodPost, "/api/homes/"+home.ID.Hex()+"/rules", jwtToken, cookieSession, req)
+				Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+				Expect(recorder.Body.String()).To(Equal(`{"error":"invalid rule condition, feature not found"}`))
+			})
+		})
+
+		When("profile is not a member of the home", func() {
+			It("should not create a rule", func() {
+				jwtToken, cookieSession := testuutils.GetJwt(router)
+				recorder := doRequest(http.MethodPost, "/api/homes/"+home.ID.Hex()+"/rules", jwtToken, cookieSession, ruleReq())
+				Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+				Expect(recorder.Body.String()).To(Equal(`{"error":"cannot manage rules of an home that is not in your profile"}`))
+			})
+		})
+	})
+})
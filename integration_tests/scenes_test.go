@@ -0,0 +1,308 @@
+package integration_tests
+
+import (
+	"api-server/api"
+	"api-server/api/grpc/device"
+	"api-server/db"
+	"api-server/initialization"
+	"api-server/models"
+	"api-server/testuutils"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+)
+
+var _ = Describe("Scenes", func() {
+	var ctx context.Context
+	var logger *zap.SugaredLogger
+	var router *gin.Engine
+	var client *mongo.Client
+	var collProfiles *mongo.Collection
+	var collHomes *mongo.Collection
+	var collDevices *mongo.Collection
+	var collScenes *mongo.Collection
+	var collFeatureValues *mongo.Collection
+	var collAuditEvents *mongo.Collection
+	var grpcMockServer *grpc.Server
+	var oldGRPCURL string
+	var oldGRPCURLSet bool
+
+	var sceneDate = time.Now()
+	var minTemp = 16.0
+	var maxTemp = 30.0
+	var deviceAc models.Device
+	var home models.Home
+
+	postScene := func(jwtToken, cookieSession string, homeID bson.ObjectID, sceneReq api.SceneReq) *httptest.ResponseRecorder {
+		var buf bytes.Buffer
+		err := json.NewEncoder(&buf).Encode(sceneReq)
+		Expect(err).ShouldNot(HaveOccurred())
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/homes/"+homeID.Hex()+"/scenes", &buf)
+		req.Header.Add("Cookie", cookieSession)
+		req.Header.Add("Authorization", "Bearer "+jwtToken)
+		req.Header.Add("Content-Type", `application/json`)
+		router.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+
+		// GRPC_URL must point to the mock listener before MustStart builds the handlers
+		grpcListener, errGrpc := net.Listen("tcp", "127.0.0.1:0")
+		Expect(errGrpc).ShouldNot(HaveOccurred())
+		oldGRPCURL, oldGRPCURLSet = os.LookupEnv("GRPC_URL")
+		err := os.Setenv("GRPC_URL", grpcListener.Addr().String())
+		Expect(err).ShouldNot(HaveOccurred())
+		err = os.Setenv("LIMIT_TO_USER_EMAILS", "test@test.com")
+		Expect(err).ShouldNot(HaveOccurred())
+
+		logger, router, client = initialization.MustStart()
+		defer logger.Sync()
+
+		collProfiles = db.GetCollections(client).Profiles
+		collHomes = db.GetCollections(client).Homes
+		collDevices = db.GetCollections(client).Devices
+		collScenes = db.GetCollections(client).Scenes
+		collFeatureValues = db.GetCollections(client).FeatureValues
+		collAuditEvents = db.GetCollections(client).AuditEvents
+
+		grpcMockServer = grpc.NewServer()
+		device.RegisterDeviceServer(grpcMockServer, newDeviceGrpc(ctx, logger))
+		go func() {
+			defer GinkgoRecover()
+			errGrpc := grpcMockServer.Serve(grpcListener)
+			if errGrpc != nil && !errors.Is(errGrpc, grpc.ErrServerStopped) {
+				Fail(fmt.Sprintf("gRPC mock server failed: %v", errGrpc))
+			}
+		}()
+
+		deviceAc = models.Device{
+			ID:           bson.NewObjectID(),
+			Mac:          "FF:22:33:44:55:66",
+			Manufacturer: "test",
+			Model:        "test",
+			UUID:         uuid.NewString(),
+			Features: []models.Feature{{
+				UUID:   uuid.NewString(),
+				Type:   "controller",
+				Name:   "setpoint",
+				Enable: true,
+				Order:  1,
+				Unit:   "°C",
+				Spec:   models.Spec{Format: models.Float, Min: &minTemp, Max: &maxTemp},
+			}},
+			CreatedAt:  sceneDate,
+			ModifiedAt: sceneDate,
+		}
+		err = testuutils.InsertOne(ctx, collDevices, deviceAc)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		home = models.Home{
+			ID:       bson.NewObjectID(),
+			Name:     "home1",
+			Location: "location1",
+			Rooms: []models.Room{{
+				ID:         bson.NewObjectID(),
+				Name:       "room1",
+				Floor:      1,
+				CreatedAt:  sceneDate,
+				ModifiedAt: sceneDate,
+				Devices:    []bson.ObjectID{deviceAc.ID},
+			}},
+			CreatedAt:  sceneDate,
+			ModifiedAt: sceneDate,
+		}
+		err = testuutils.InsertOne(ctx, collHomes, home)
+		Expect(err).ShouldNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		grpcMockServer.Stop()
+		testuutils.DropAllCollections(ctx, collProfiles, collHomes, collDevices, collScenes, collFeatureValues, collAuditEvents)
+		if oldGRPCURLSet {
+			Expect(os.Setenv("GRPC_URL", oldGRPCURL)).To(Succeed())
+		} else {
+			Expect(os.Unsetenv("GRPC_URL")).To(Succeed())
+		}
+	})
+
+	Context("calling scenes api", func() {
+		When("profile owns the home and its devices", func() {
+			It("should create a scene and activate it", func() {
+				jwtToken, cookieSession := testuutils.GetJwt(router)
+				profileRes := testuutils.GetLoggedProfile(router, jwtToken, cookieSession)
+				err := testuutils.AssignHomeToProfile(ctx, collProfiles, profileRes.ID, home.ID)
+				Expect(err).ShouldNot(HaveOccurred())
+				err = testuutils.AssignDeviceToProfile(ctx, collProfiles, profileRes.ID, deviceAc.ID)
+				Expect(err).ShouldNot(HaveOccurred())
+				err = testuutils.SetAPITokenToProfile(ctx, collProfiles, profileRes.ID, uuid.NewString())
+				Expect(err).ShouldNot(HaveOccurred())
+
+				recorder := postScene(jwtToken, cookieSession, home.ID, api.SceneReq{
+					Name: "Movie night",
+					Steps: []api.SceneStepReq{{
+						DeviceID: deviceAc.ID.Hex(),
+						Values: []api.SceneValueReq{{
+							FeatureUUID: deviceAc.Features[0].UUID,
+							Name:        deviceAc.Features[0].Name,
+							Value:       21,
+						}},
+					}},
+				})
+				Expect(recorder.Code).To(Equal(http.StatusOK))
+				var scene models.Scene
+				err = json.Unmarshal(recorder.Body.Bytes(), &scene)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(scene.Name).To(Equal("Movie night"))
+				Expect(scene.HomeID).To(Equal(home.ID))
+				Expect(scene.Steps).To(HaveLen(1))
+
+				recorder = httptest.NewRecorder()
+				req := httptest.NewRequest(http.MethodGet, "/api/homes/"+home.ID.Hex()+"/scenes", nil)
+				req.Header.Add("Cookie", cookieSession)
+				req.Header.Add("Authorization", "Bearer "+jwtToken)
+				router.ServeHTTP(recorder, req)
+				Expect(recorder.Code).To(Equal(http.StatusOK))
+				var scenes []models.Scene
+				err = json.Unmarshal(recorder.Body.Bytes(), &scenes)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(scenes).To(HaveLen(1))
+
+				recorder = httptest.NewRecorder()
+				req = httptest.NewRequest(http.MethodPost, "/api/scenes/"+scene.ID.Hex()+"/activate", nil)
+				req.Header.Add("Cookie", cookieSession)
+				req.Header.Add("Authorization", "Bearer "+jwtToken)
+				router.ServeHTTP(recorder, req)
+				Expect(recorder.Code).To(Equal(http.StatusOK))
+				var activationRes api.SceneActivationResp
+				err = json.Unmarshal(recorder.Body.Bytes(), &activationRes)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(activationRes.Results).To(HaveLen(1))
+				Expect(activationRes.Results[0].DeviceID).To(Equal(deviceAc.ID))
+				Expect(activationRes.Results[0].Success).To(BeTrue())
+
+				By("recording the values set by the scene in the audit log")
+				Eventually(func() (int64, error) {
+					return collAuditEvents.CountDocuments(ctx, bson.M{
+						"actorId":  profileRes.ID,
+						"action":   models.AuditActionDeviceValuesSet,
+						"targetId": deviceAc.ID.Hex(),
+						"outcome":  models.AuditOutcomeSuccess,
+					})
+				}, 5*time.Second, 100*time.Millisecond).Should(Equal(int64(1)))
+			})
+
+			It("should not create a scene with values outside the feature spec", func() {
+				jwtToken, cookieSession := testuutils.GetJwt(router)
+				profileRes := testuutils.GetLoggedProfile(router, jwtToken, cookieSession)
+				err := testuutils.AssignHomeToProfile(ctx, collProfiles, profileRes.ID, home.ID)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				recorder := postScene(jwtToken, cookieSession, home.ID, api.SceneReq{
+					Name: "Too hot",
+					Steps: []api.SceneStepReq{{
+						DeviceID: deviceAc.ID.Hex(),
+						Values: []api.SceneValueReq{{
+							FeatureUUID: deviceAc.Features[0].UUID,
+							Name:        deviceAc.Features[0].Name,
+							Value:       45,
+						}},
+					}},
+				})
+				Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+				Expect(recorder.Body.String()).To(Equal(`{"error":"invalid scene steps","steps":[{"deviceId":"` + deviceAc.ID.Hex() +
+					`","error":"invalid device feature values","features":[{"featureUuid":"` + deviceAc.Features[0].UUID +
+					`","name":"setpoint","error":"value must be less than or equal to 30"}]}]}`))
+			})
+
+			It("should not create a scene with a device outside the home", func() {
+				jwtToken, cookieSession := testuutils.GetJwt(router)
+				profileRes := testuutils.GetLoggedProfile(router, jwtToken, cookieSession)
+				err := testuutils.AssignHomeToProfile(ctx, collProfiles, profileRes.ID, home.ID)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				otherDeviceID := bson.NewObjectID()
+				recorder := postScene(jwtToken, cookieSession, home.ID, api.SceneReq{
+					Name: "Leaving home",
+					Steps: []api.SceneStepReq{{
+						DeviceID: otherDeviceID.Hex(),
+						Values: []api.SceneValueReq{{
+							FeatureUUID: uuid.NewString(),
+							Name:        "setpoint",
+							Value:       20,
+						}},
+					}},
+				})
+				Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+				Expect(recorder.Body.String()).To(Equal(`{"error":"invalid scene steps","steps":[{"deviceId":"` + otherDeviceID.Hex() +
+					`","error":"device is not in a room of this home"}]}`))
+			})
+		})
+
+		When("profile is not a member of the home", func() {
+			It("should not create a scene", func() {
+				jwtToken, cookieSession := testuutils.GetJwt(router)
+				recorder := postScene(jwtToken, cookieSession, home.ID, api.SceneReq{
+					Name: "Movie night",
+					Steps: []api.SceneStepReq{{
+						DeviceID: deviceAc.ID.Hex(),
+						Values: []api.SceneValueReq{{
+							FeatureUUID: deviceAc.Features[0].UUID,
+							Name:        deviceAc.Features[0].Name,
+							Value:       21,
+						}},
+					}},
+				})
+				Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+				Expect(recorder.Body.String()).To(Equal(`{"error":"cannot manage scenes of an home that is not in your profile"}`))
+			})
+
+			It("should not activate a scene", func() {
+				jwtToken, cookieSession := testuutils.GetJwt(router)
+				scene := models.Scene{
+					ID:     bson.NewObjectID(),
+					HomeID: home.ID,
+					Name:   "Movie night",
+					Steps: []models.SceneStep{{
+						DeviceID: deviceAc.ID,
+						Values: []models.SceneValue{{
+							FeatureUUID: deviceAc.Features[0].UUID,
+							Name:        deviceAc.Features[0].Name,
+							Value:       21,
+						}},
+					}},
+					CreatedAt:  sceneDate,
+					ModifiedAt: sceneDate,
+				}
+				err := testuutils.InsertOne(ctx, collScenes, scene)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				recorder := httptest.NewRecorder()
+				req := httptest.NewRequest(http.MethodPost, "/api/scenes/"+scene.ID.Hex()+"/activate", nil)
+				req.Header.Add("Cookie", cookieSession)
+				req.Header.Add("Authorization", "Bearer "+jwtToken)
+				router.ServeHTTP(recorder, req)
+				Expect(recorder.Code).To(Equal(http.StatusNotFound))
+				Expect(recorder.Body.String()).To(Equal(`{"error":"scene not found"}`))
+			})
+		})
+	})
+})
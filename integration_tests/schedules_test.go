@@ -0,0 +1,379 @@
+package integration_tests
+
+import (
+	"api-server/api"
+	"api-server/api/grpc/device"
+	"api-server/db"
+	"api-server/initialization"
+	"api-server/models"
+	"api-server/testuutils"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+)
+
+var _ = Describe("Schedules", func() {
+	var ctx context.Context
+	var logger *zap.SugaredLogger
+	var router *gin.Engine
+	var client *mongo.Client
+	var collProfiles *mongo.Collection
+	var collHomes *mongo.Collection
+	var collDevices *mongo.Collection
+	var collSchedules *mongo.Collection
+	var collScheduleRuns *mongo.Collection
+	var collLeases *mongo.Collection
+	var collFeatureValues *mongo.Collection
+	var grpcMockServer *grpc.Server
+	var oldGRPCURL string
+	var oldGRPCURLSet bool
+
+	var scheduleDate = time.Now()
+	var minTemp = 16.0
+	var maxTemp = 30.0
+	var deviceAc models.Device
+	var home models.Home
+
+	postSchedule := func(jwtToken, cookieSession string, homeID bson.ObjectID, scheduleReq api.ScheduleReq) *httptest.ResponseRecorder {
+		var buf bytes.Buffer
+		err := json.NewEncoder(&buf).Encode(scheduleReq)
+		Expect(err).ShouldNot(HaveOccurred())
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/homes/"+homeID.Hex()+"/schedules", &buf)
+		req.Header.Add("Cookie", cookieSession)
+		req.Header.Add("Authorization", "Bearer "+jwtToken)
+		req.Header.Add("Content-Type", `application/json`)
+		router.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	// insertDueSchedule stores an enabled schedule of the logged profile, due at nextRunAt
+	insertDueSchedule := func(createdBy bson.ObjectID, nextRunAt time.Time) models.Schedule {
+		schedule := models.Schedule{
+			ID:       bson.NewObjectID(),
+			HomeID:   home.ID,
+			DeviceID: deviceAc.ID,
+			Name:     "heating",
+			Enabled:  true,
+			Kind:     models.ScheduleKindCron,
+			Cron:     "30 6 * * *",
+			Values: []models.DeviceFeatureState{{
+				FeatureUUID: deviceAc.Features[0].UUID,
+				Type:        models.Controller,
+				Name:        deviceAc.Features[0].Name,
+				Value:       21,
+			}},
+			NextRunAt:  &nextRunAt,
+			CreatedBy:  createdBy,
+			CreatedAt:  scheduleDate,
+			ModifiedAt: scheduleDate,
+		}
+		err := testuutils.InsertOne(ctx, collSchedules, schedule)
+		Expect(err).ShouldNot(HaveOccurred())
+		return schedule
+	}
+
+	findRuns := func(scheduleID bson.ObjectID) []models.ScheduleRun {
+		cur, err := collScheduleRuns.Find(ctx, bson.M{"scheduleId": scheduleID})
+		Expect(err).ShouldNot(HaveOccurred())
+		var runs []models.ScheduleRun
+		err = cur.All(ctx, &runs)
+		Expect(err).ShouldNot(HaveOccurred())
+		return runs
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+
+		// GRPC_URL must point to the mock listener before handlers and the runner are built
+		grpcListener, errGrpc := net.Listen("tcp", "127.0.0.1:0")
+		Expect(errGrpc).ShouldNot(HaveOccurred())
+		oldGRPCURL, oldGRPCURLSet = os.LookupEnv("GRPC_URL")
+		err := os.Setenv("GRPC_URL", grpcListener.Addr().String())
+		Expect(err).ShouldNot(HaveOccurred())
+		err = os.Setenv("LIMIT_TO_USER_EMAILS", "test@test.com")
+		Expect(err).ShouldNot(HaveOccurred())
+
+		logger, router, client = initialization.MustStart()
+		defer logger.Sync()
+
+		collProfiles = db.GetCollections(client).Profiles
+		collHomes = db.GetCollections(client).Homes
+		collDevices = db.GetCollections(client).Devices
+		collSchedules = db.GetCollections(client).Schedules
+		collScheduleRuns = db.GetCollections(client).ScheduleRuns
+		collLeases = db.GetCollections(client).Leases
+		collFeatureValues = db.GetCollections(client).FeatureValues
+
+		grpcMockServer = grpc.NewServer()
+		device.RegisterDeviceServer(grpcMockServer, newDeviceGrpc(ctx, logger))
+		go func() {
+			defer GinkgoRecover()
+			errGrpc := grpcMockServer.Serve(grpcListener)
+			if errGrpc != nil && !errors.Is(errGrpc, grpc.ErrServerStopped) {
+				Fail(fmt.Sprintf("gRPC mock server failed: %v", errGrpc))
+			}
+		}()
+
+		deviceAc = models.Device{
+			ID:           bson.NewObjectID(),
+			Mac:          "DD:22:33:44:55:66",
+			Manufacturer: "test",
+			Model:        "test",
+			UUID:         uuid.NewString(),
+			Features: []models.Feature{{
+				UUID:   uuid.NewString(),
+				Type:   "controller",
+				Name:   "setpoint",
+				Enable: true,
+				Order:  1,
+				Unit:   "°C",
+				Spec:   models.Spec{Format: models.Float, Min: &minTemp, Max: &maxTemp},
+			}},
+			CreatedAt:  scheduleDate,
+			ModifiedAt: scheduleDate,
+		}
+		err = testuutils.InsertOne(ctx, collDevices, deviceAc)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		home = models.Home{
+			ID:       bson.NewObjectID(),
+			Name:     "home1",
+			Location: "location1",
+			Timezone: "Europe/Rome",
+			Rooms: []models.Room{{
+				ID:         bson.NewObjectID(),
+				Name:       "room1",
+				Floor:      1,
+				CreatedAt:  scheduleDate,
+				ModifiedAt: scheduleDate,
+				Devices:    []bson.ObjectID{deviceAc.ID},
+			}},
+			CreatedAt:  scheduleDate,
+			ModifiedAt: scheduleDate,
+		}
+		err = testuutils.InsertOne(ctx, collHomes, home)
+		Expect(err).ShouldNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		grpcMockServer.Stop()
+		testuutils.DropAllCollections(ctx, collProfiles, collHomes, collDevices, collSchedules, collScheduleRuns, collLeases, collFeatureValues)
+		if oldGRPCURLSet {
+			Expect(os.Setenv("GRPC_URL", oldGRPCURL)).To(Succeed())
+		} else {
+			Expect(os.Unsetenv("GRPC_URL")).To(Succeed())
+		}
+	})
+
+	Context("calling schedules api", func() {
+		When("profile owns the home", func() {
+			It("should create a weekly schedule", func() {
+				jwtToken, cookieSession := testuutils.GetJwt(router)
+				profileRes := testuutils.GetLoggedProfile(router, jwtToken, cookieSession)
+				err := testuutils.AssignHomeToProfile(ctx, collProfiles, profileRes.ID, home.ID)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				recorder := postSchedule(jwtToken, cookieSession, home.ID, api.ScheduleReq{
+					Name:     "Heating on",
+					DeviceID: deviceAc.ID.Hex(),
+					Enabled:  true,
+					Kind:     models.ScheduleKindWeekly,
+					Weekly:   &api.WeeklyScheduleReq{Days: []int{1, 2, 3, 4, 5}, Time: "06:30"},
+					Values: []models.DeviceFeatureState{{
+						FeatureUUID: deviceAc.Features[0].UUID,
+						Type:        models.Controller,
+						Name:        deviceAc.Features[0].Name,
+						Value:       21,
+					}},
+				})
+				Expect(recorder.Code).To(Equal(http.StatusOK))
+				var schedule models.Schedule
+				err = json.Unmarshal(recorder.Body.Bytes(), &schedule)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(schedule.Cron).To(Equal("30 6 * * 1,2,3,4,5"))
+				Expect(schedule.NextRunAt).ToNot(BeNil())
+				rome, err := time.LoadLocation("Europe/Rome")
+				Expect(err).ShouldNot(HaveOccurred())
+				nextRunAt := schedule.NextRunAt.In(rome)
+				Expect(nextRunAt.Hour()).To(Equal(6))
+				Expect(nextRunAt.Minute()).To(Equal(30))
+				Expect(nextRunAt.Weekday()).ToNot(Equal(time.Saturday))
+				Expect(nextRunAt.Weekday()).ToNot(Equal(time.Sunday))
+
+				recorder = httptest.NewRecorder()
+				req := httptest.NewRequest(http.MethodGet, "/api/homes/"+home.ID.Hex()+"/schedules", nil)
+				req.Header.Add("Cookie", cookieSession)
+				req.Header.Add("Authorization", "Bearer "+jwtToken)
+				router.ServeHTTP(recorder, req)
+				Expect(recorder.Code).To(Equal(http.StatusOK))
+				var schedules []models.Schedule
+				err = json.Unmarshal(recorder.Body.Bytes(), &schedules)
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(schedules).To(HaveLen(1))
+			})
+
+			It("should not create a schedule with an invalid cron expression", func() {
+				jwtToken, cookieSession := testuutils.GetJwt(router)
+				profileRes := testuutils.GetLoggedProfile(router, jwtToken, cookieSession)
+				err := testuutils.AssignHomeToProfile(ctx, collProfiles, profileRes.ID, home.ID)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				recorder := postSchedule(jwtToken, cookieSession, home.ID, api.ScheduleReq{
+					Name:     "Heating on",
+					DeviceID: deviceAc.ID.Hex(),
+					Enabled:  true,
+					Kind:     models.ScheduleKindCron,
+					Cron:     "61 6 * * *",
+					Values: []models.DeviceFeatureState{{
+						FeatureUUID: deviceAc.Features[0].UUID,
+						Type:        models.Controller,
+						Name:        deviceAc.Features[0].Name,
+						Value:       21,
+					}},
+				})
+				Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+				Expect(recorder.Body.String()).To(Equal(`{"error":"invalid schedule, minute field must be between 0 and 59"}`))
+			})
+
+			It("should not create a schedule with values outside the feature spec", func() {
+				jwtToken, cookieSession := testuutils.GetJwt(router)
+				profileRes := testuutils.GetLoggedProfile(router, jwtToken, cookieSession)
+				err := testuutils.AssignHomeToProfile(ctx, collProfiles, profileRes.ID, home.ID)
+				Expect(err).ShouldNot(HaveOccurred())
+
+				recorder := postSchedule(jwtToken, cookieSession, home.ID, api.ScheduleReq{
+					Name:     "Heating on",
+					DeviceID: deviceAc.ID.Hex(),
+					Enabled:  true,
+					Kind:     models.ScheduleKindCron,
+					Cron:     "30 6 * * *",
+					Values: []models.DeviceFeatureState{{
+						FeatureUUID: deviceAc.Features[0].UUID,
+						Type:        models.Controller,
+						Name:        deviceAc.Features[0].Name,
+						Value:       10,
+					}},
+				})
+				Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+				Expect(recorder.Body.String()).To(Equal(`{"error":"invalid device feature values","features":[{"featureUuid":"` +
+					deviceAc.Features[0].UUID + `","name":"setpoint","error":"value must be greater than or equal to 16"}]}`))
+			})
+		})
+
+		When("profile is not a member of the home", func() {
+			It("should not create a schedule", func() {
+				jwtToken, cookieSession := testuutils.GetJwt(router)
+				recorder := postSchedule(jwtToken, cookieSession, home.ID, api.ScheduleReq{
+					Name:     "Heating on",
+					DeviceID: deviceAc.ID.Hex(),
+					Kind:     models.ScheduleKindCron,
+					Cron:     "30 6 * * *",
+					Values: []models.DeviceFeatureState{{
+						FeatureUUID: deviceAc.Features[0].UUID,
+						Type:        models.Controller,
+						Name:        deviceAc.Features[0].Name,
+						Value:       21,
+					}},
+				})
+				Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+				Expect(recorder.Body.String()).To(Equal(`{"error":"cannot manage schedules of an home that is not in your profile"}`))
+			})
+		})
+	})
+
+	Context("running schedules", func() {
+		var profileID bson.ObjectID
+		var runner *api.ScheduleRunner
+		var deviceClient *deviceClientFake
+
+		BeforeEach(func() {
+			jwtToken, cookieSession := testuutils.GetJwt(router)
+			profileID = testuutils.GetLoggedProfile(router, jwtToken, cookieSession).ID
+			err := testuutils.AssignHomeToProfile(ctx, collProfiles, profileID, home.ID)
+			Expect(err).ShouldNot(HaveOccurred())
+			err = testuutils.AssignDeviceToProfile(ctx, collProfiles, profileID, deviceAc.ID)
+			Expect(err).ShouldNot(HaveOccurred())
+			err = testuutils.SetAPITokenToProfile(ctx, collProfiles, profileID, uuid.NewString())
+			Expect(err).ShouldNot(HaveOccurred())
+			deviceClient = &deviceClientFake{}
+			runner = api.NewScheduleRunner(logger, client, api.NewDevicesValues(logger, client, validator.New(), deviceClient, nil, nil))
+		})
+
+		It("should send values of due schedules and record the run", func() {
+			now := time.Now()
+			schedule := insertDueSchedule(profileID, now.Add(-time.Minute))
+
+			runs, err := runner.RunDueSchedules(ctx, now)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(runs).To(Equal(1))
+			scheduleRuns := findRuns(schedule.ID)
+			Expect(scheduleRuns).To(HaveLen(1))
+			Expect(scheduleRuns[0].Status).To(Equal(models.ScheduleRunSuccess))
+			Expect(scheduleRuns[0].Error).To(BeEmpty())
+			setValuesRequests := deviceClient.SetValuesRequests()
+			Expect(setValuesRequests).To(HaveLen(1))
+			Expect(setValuesRequests[0].Id).To(Equal(deviceAc.ID.Hex()))
+			Expect(setValuesRequests[0].FeatureValues[0].Value).To(Equal(float32(21)))
+
+			scheduleFromDb, err := testuutils.FindOneById[models.Schedule](ctx, collSchedules, schedule.ID)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(scheduleFromDb.NextRunAt.After(now)).To(BeTrue())
+
+			// the schedule is not due anymore
+			runs, err = runner.RunDueSchedules(ctx, now)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(runs).To(Equal(0))
+		})
+
+		It("should skip runs that are too late", func() {
+			now := time.Now()
+			schedule := insertDueSchedule(profileID, now.Add(-time.Hour))
+
+			runs, err := runner.RunDueSchedules(ctx, now)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(runs).To(Equal(1))
+			scheduleRuns := findRuns(schedule.ID)
+			Expect(scheduleRuns).To(HaveLen(1))
+			Expect(scheduleRuns[0].Status).To(Equal(models.ScheduleRunSkipped))
+		})
+
+		It("should not run schedules, if another instance holds the lease", func() {
+			now := time.Now()
+			schedule := insertDueSchedule(profileID, now.Add(-time.Minute))
+			err := testuutils.InsertOne(ctx, collLeases, models.Lease{
+				ID:        "schedule_runner",
+				Owner:     "another-instance",
+				ExpiresAt: now.Add(time.Minute),
+			})
+			Expect(err).ShouldNot(HaveOccurred())
+
+			runs, err := runner.RunDueSchedules(ctx, now)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(runs).To(Equal(0))
+			Expect(findRuns(schedule.ID)).To(BeEmpty())
+
+			// the lease expired, so this instance can take it over
+			runs, err = runner.RunDueSchedules(ctx, now.Add(2*time.Minute))
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(runs).To(Equal(1))
+		})
+	})
+})
@@ -0,0 +1,153 @@
+package integration_tests
+
+import (
+	"api-server/db"
+	"api-server/initialization"
+	"api-server/models"
+	"api-server/testuutils"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.uber.org/zap"
+)
+
+var _ = Describe("Sessions", func() {
+	var ctx context.Context
+	var logger *zap.SugaredLogger
+	var router *gin.Engine
+	var client *mongo.Client
+	var collProfiles *mongo.Collection
+	var collRefreshTokens *mongo.Collection
+
+	callSessions := func(method, url, jwtToken, cookieSession string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest(method, url, nil)
+		if cookieSession != "" {
+			req.Header.Add("Cookie", cookieSession)
+		}
+		req.Header.Add("Authorization", "Bearer "+jwtToken)
+		router.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	refreshMobile := func(refreshToken string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/oauth/app/refresh", strings.NewReader(`{"refreshToken":"`+refreshToken+`"}`))
+		req.Header.Add("Content-Type", "application/json")
+		router.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+
+		err := os.Setenv("LIMIT_TO_USER_EMAILS", "test@test.com")
+		Expect(err).ShouldNot(HaveOccurred())
+
+		logger, router, client = initialization.MustStart()
+		defer logger.Sync()
+
+		collProfiles = db.GetCollections(client).Profiles
+		collRefreshTokens = db.GetCollections(client).RefreshTokens
+	})
+
+	AfterEach(func() {
+		testuutils.DropAllCollections(ctx, collProfiles, collRefreshTokens)
+	})
+
+	Context("calling sessions api", func() {
+		var jwtToken string
+		var cookieSession string
+		var mobileRefreshToken string
+
+		BeforeEach(func() {
+			jwtToken, cookieSession = testuutils.GetJwt(router)
+			_, mobileRefreshToken = testuutils.GetJwtMobileApp(router)
+		})
+
+		getSessions := func() []models.Session {
+			recorder := callSessions(http.MethodGet, "/api/sessions", jwtToken, cookieSession)
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			var sessions []models.Session
+			err := json.Unmarshal(recorder.Body.Bytes(), &sessions)
+			Expect(err).ShouldNot(HaveOccurred())
+			return sessions
+		}
+
+		It("should list active sessions, marking the current one", func() {
+			sessions := getSessions()
+			Expect(sessions).To(HaveLen(2))
+			Expect(sessions).To(ContainElement(And(
+				HaveField("ClientType", "web"),
+				HaveField("Current", true),
+			)))
+			Expect(sessions).To(ContainElement(And(
+				HaveField("ClientType", "mobile"),
+				HaveField("Current", false),
+			)))
+		})
+
+		It("should keep the session after refreshing tokens", func() {
+			recorder := refreshMobile(mobileRefreshToken)
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+
+			sessions := getSessions()
+			Expect(sessions).To(HaveLen(2))
+			mobileSession := sessions[0]
+			Expect(mobileSession.ClientType).To(Equal("mobile"))
+			Expect(mobileSession.LastUsedAt).To(BeTemporally(">", mobileSession.CreatedAt))
+		})
+
+		It("should revoke a session", func() {
+			var mobileSession models.Session
+			Expect(getSessions()).To(ContainElement(HaveField("ClientType", "mobile"), &mobileSession))
+
+			recorder := callSessions(http.MethodDelete, "/api/sessions/"+mobileSession.FamilyID, jwtToken, cookieSession)
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			Expect(recorder.Body.String()).To(Equal(`{"message":"session has been revoked"}`))
+
+			Expect(getSessions()).To(ConsistOf(HaveField("ClientType", "web")))
+			recorder = refreshMobile(mobileRefreshToken)
+			Expect(recorder.Code).To(Equal(http.StatusUnauthorized))
+
+			recorder = callSessions(http.MethodDelete, "/api/sessions/"+mobileSession.FamilyID, jwtToken, cookieSession)
+			Expect(recorder.Code).To(Equal(http.StatusNotFound))
+			Expect(recorder.Body.String()).To(Equal(`{"error":"session not found"}`))
+		})
+
+		It("should revoke all the other sessions", func() {
+			recorder := callSessions(http.MethodDelete, "/api/sessions", jwtToken, cookieSession)
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			Expect(recorder.Body.String()).To(Equal(`{"message":"other sessions have been revoked"}`))
+
+			Expect(getSessions()).To(ConsistOf(And(
+				HaveField("ClientType", "web"),
+				HaveField("Current", true),
+			)))
+			recorder = refreshMobile(mobileRefreshToken)
+			Expect(recorder.Code).To(Equal(http.StatusUnauthorized))
+		})
+
+		It("should return an error, if the session doesn't exist", func() {
+			recorder := callSessions(http.MethodDelete, "/api/sessions/"+bson.NewObjectID().Hex(), jwtToken, cookieSession)
+			Expect(recorder.Code).To(Equal(http.StatusNotFound))
+			Expect(recorder.Body.String()).To(Equal(`{"error":"session not found"}`))
+		})
+	})
+
+	It("should return an error, if the access token isn't bound to a session", func() {
+		jwtToken := testuutils.GetJwtForProfile(models.Profile{ID: bson.NewObjectID(), Github: models.GitHub{ID: 123}})
+		recorder := callSessions(http.MethodDelete, "/api/sessions", jwtToken, "")
+		Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+		Expect(recorder.Body.String()).To(Equal(`{"error":"cannot find current session, login again"}`))
+	})
+})
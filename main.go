@@ -3,32 +3,98 @@ package main
 import (
 	"api-server/initialization"
 	"context"
+	"errors"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
+	// schedules run in the timezone of homes, but the runtime image doesn't have a tz database
+	_ "time/tzdata"
 )
 
+// shutdownTimeout bounds the wait for in-flight requests on shutdown, then connections are closed
+const shutdownTimeout = 10 * time.Second
+
 func main() {
-	logger, router, mongoDbClient, err := initialization.Start()
+	if err := run(); err != nil {
+		os.Exit(1)
+	}
+}
+
+// run serves requests until SIGINT or SIGTERM, then it stops the server and closes services
+// in reverse order of creation. Errors are returned, so that deferred closes always run.
+func run() error {
+	logger, router, mongoDbClient, services, err := initialization.Start()
+	if logger != nil {
+		defer logger.Sync()
+	}
+	if mongoDbClient != nil {
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if errDisconnect := mongoDbClient.Disconnect(ctx); errDisconnect != nil {
+				logger.Warnw("Cannot disconnect MongoDB cleanly", "error", errDisconnect)
+			}
+		}()
+	}
 	if err != nil {
 		if logger != nil {
 			logger.Errorw("Cannot start application", "error", err)
 		}
-		os.Exit(1)
+		return err
 	}
-	defer logger.Sync()
 	defer func() {
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
-		if err = mongoDbClient.Disconnect(ctx); err != nil {
-			logger.Warnw("Cannot disconnect MongoDB cleanly", "error", err)
+		if errClose := services.Audit.Close(ctx); errClose != nil {
+			logger.Warnw("Cannot write the last audit events", "error", errClose)
+		}
+	}()
+	defer func() {
+		if errClose := services.DevicesConn.Close(); errClose != nil {
+			logger.Warnw("Cannot close gRPC connection cleanly", "error", errClose)
 		}
 	}()
 
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// Start background jobs, stopped after the server and before services are closed
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	jobsDone := initialization.StartScheduleRunner(jobsCtx, logger, mongoDbClient, services)
+	defer func() {
+		stopJobs()
+		<-jobsDone
+	}()
+
 	// Start server
 	port := os.Getenv("HTTP_PORT")
-	logger.Infof("GIN - up and running with port: %s", port)
-	if err = router.Run(":" + port); err != nil {
-		logger.Error("Cannot start HTTP server", err)
-		os.Exit(1)
+	srv := &http.Server{Addr: ":" + port, Handler: router}
+	serveErr := make(chan error, 1)
+	go func() {
+		logger.Infof("GIN - up and running with port: %s", port)
+		serveErr <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err = <-serveErr:
+		logger.Errorw("Cannot start HTTP server", "error", err)
+		return err
+	case <-ctx.Done():
+		logger.Info("Shutdown signal received, stopping HTTP server")
+	}
+	// a second signal terminates the process immediately
+	stop()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err = srv.Shutdown(shutdownCtx); err != nil {
+		// event streams stay open until clients disconnect, so they are closed here
+		logger.Warnw("Cannot stop HTTP server cleanly, closing connections", "error", err)
+		if errClose := srv.Close(); errClose != nil && !errors.Is(errClose, http.ErrServerClosed) {
+			logger.Warnw("Cannot close HTTP server connections", "error", errClose)
+		}
 	}
+	return nil
 }
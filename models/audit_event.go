@@ -0,0 +1,58 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// AuditAction string
+type AuditAction string
+
+// Security-relevant actions recorded in the audit log.
+const (
+	AuditActionLogin              AuditAction = "login"
+	AuditActionAPITokenRotated    AuditAction = "api_token.rotated"
+	AuditActionDeviceValuesSet    AuditAction = "device.values_set"
+	AuditActionFCMTokenRegistered AuditAction = "fcm_token.registered"
+)
+
+// AuditOutcome string
+type AuditOutcome string
+
+// Possible outcomes of an audited action.
+const (
+	AuditOutcomeSuccess AuditOutcome = "success"
+	AuditOutcomeFailure AuditOutcome = "failure"
+)
+
+// Types of the targets of audited actions.
+const (
+	AuditTargetProfile  = "profile"
+	AuditTargetDevice   = "device"
+	AuditTargetFCMToken = "fcmToken"
+)
+
+// Client types of events recorded by background jobs, on behalf of the profile that created them.
+const (
+	AuditClientSchedule = "schedule"
+	AuditClientRule     = "rule"
+)
+
+// AuditEvent is a security-relevant action of a profile, stored in the audit_events collection.
+// Events are removed after the retention set by AUDIT_EVENTS_RETENTION_DAYS.
+type AuditEvent struct {
+	ID bson.ObjectID `json:"id" bson:"_id"`
+	// ActorID is the profile that did the action, it's empty for failed logins of unknown users
+	ActorID    bson.ObjectID `json:"actorId" bson:"actorId,omitempty"`
+	Action     AuditAction   `json:"action" bson:"action"`
+	TargetType string        `json:"targetType,omitempty" bson:"targetType,omitempty"`
+	TargetID   string        `json:"targetId,omitempty" bson:"targetId,omitempty"`
+	IP         string        `json:"ip" bson:"ip"`
+	UserAgent  string        `json:"userAgent" bson:"userAgent"`
+	ClientType string        `json:"clientType" bson:"clientType"`
+	Outcome    AuditOutcome  `json:"outcome" bson:"outcome"`
+	// Reason explains a failure, without personal data
+	Reason    string    `json:"reason,omitempty" bson:"reason,omitempty"`
+	CreatedAt time.Time `json:"createdAt" bson:"createdAt"`
+}
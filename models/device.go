@@ -53,6 +53,60 @@ type Feature struct {
 	Spec   Spec   `json:"spec" bson:"spec"`
 }
 
+// DeviceCategory string
+type DeviceCategory string
+
+// Categories users can give to devices.
+const (
+	DeviceCategoryLight     DeviceCategory = "light"
+	DeviceCategoryClimate   DeviceCategory = "climate"
+	DeviceCategorySwitch    DeviceCategory = "switch"
+	DeviceCategorySensor    DeviceCategory = "sensor"
+	DeviceCategorySecurity  DeviceCategory = "security"
+	DeviceCategoryAppliance DeviceCategory = "appliance"
+	DeviceCategoryOther     DeviceCategory = "other"
+)
+
+// FeatureOverride is how users show a feature, instead of what the device reported.
+type FeatureOverride struct {
+	FeatureUUID string `json:"featureUuid" bson:"featureUuid"`
+	Label       string `json:"label,omitempty" bson:"label,omitempty"`
+	Hidden      bool   `json:"hidden,omitempty" bson:"hidden,omitempty"`
+	// Order replaces Feature.Order, if defined
+	Order *int `json:"order,omitempty" bson:"order,omitempty"`
+}
+
+// DeviceOverrides are the metadata of a device edited by users.
+// They are stored apart from the fields reported by the device at registration, that they never change.
+type DeviceOverrides struct {
+	Name     string            `json:"name,omitempty" bson:"name,omitempty"`
+	Icon     string            `json:"icon,omitempty" bson:"icon,omitempty"`
+	Category DeviceCategory    `json:"category,omitempty" bson:"category,omitempty"`
+	Features []FeatureOverride `json:"features,omitempty" bson:"features,omitempty"`
+}
+
+// IsEmpty reports whether o doesn't override anything
+func (o *DeviceOverrides) IsEmpty() bool {
+	return o.Name == "" && o.Icon == "" && o.Category == "" && len(o.Features) == 0
+}
+
+// FeatureOverridePatch changes the override of a feature. Nil fields are left as they are,
+// an empty label and an order of -1 remove the override.
+type FeatureOverridePatch struct {
+	FeatureUUID string  `json:"featureUuid" validate:"required,uuid"`
+	Label       *string `json:"label" validate:"omitempty,max=50"`
+	Hidden      *bool   `json:"hidden"`
+	Order       *int    `json:"order" validate:"omitempty,min=-1,max=1000"`
+}
+
+// DeviceOverridesPatch changes DeviceOverrides. Nil fields are left as they are, empty strings remove the override.
+type DeviceOverridesPatch struct {
+	Name     *string                `json:"name" validate:"omitempty,max=32"`
+	Icon     *string                `json:"icon" validate:"omitempty,max=50,printascii"`
+	Category *DeviceCategory        `json:"category" validate:"omitempty,oneof='' light climate switch sensor security appliance other"`
+	Features []FeatureOverridePatch `json:"features" validate:"omitempty,max=50,unique=FeatureUUID,dive"`
+}
+
 // Device struct
 type Device struct {
 	//swagger:ignore
@@ -63,16 +117,28 @@ type Device struct {
 	Manufacturer string        `json:"manufacturer" bson:"manufacturer"`
 	Model        string        `json:"model" bson:"model"`
 	Features     []Feature     `json:"features" bson:"features"`
-	CreatedAt    time.Time     `json:"createdAt" bson:"createdAt"`
-	ModifiedAt   time.Time     `json:"modifiedAt" bson:"modifiedAt"`
+	// Overrides are set by users with PATCH /api/devices/:id, Name is the one reported by the device
+	Overrides  *DeviceOverrides `json:"overrides,omitempty" bson:"overrides,omitempty"`
+	CreatedAt  time.Time        `json:"createdAt" bson:"createdAt"`
+	ModifiedAt time.Time        `json:"modifiedAt" bson:"modifiedAt"`
+}
+
+// DisplayName returns the name set by users, or the one reported by the device if not overridden
+func (d Device) DisplayName() string {
+	if d.Overrides != nil && d.Overrides.Name != "" {
+		return d.Overrides.Name
+	}
+	return d.Name
 }
 
 // DeviceFeatureState struct
 type DeviceFeatureState struct {
-	FeatureUUID string  `json:"featureUuid" validate:"required"`
-	Type        Type    `json:"type" validate:"required"` // feature type
-	Name        string  `json:"name" validate:"required"` // feature name
-	Value       float32 `json:"value" validate:"min=0"`   // feature value
-	CreatedAt   int64   `json:"createdAt"`                // as unix epoch in milliseconds
-	ModifiedAt  int64   `json:"modifiedAt"`               // as unix epoch in milliseconds
+	FeatureUUID string  `json:"featureUuid" bson:"featureUuid" validate:"required"`
+	Type        Type    `json:"type" bson:"type" validate:"required"`   // feature type
+	Name        string  `json:"name" bson:"name" validate:"required"`   // feature name
+	Value       float32 `json:"value" bson:"value" validate:"min=0"`    // feature value
+	CreatedAt   int64   `json:"createdAt" bson:"createdAt,omitempty"`   // as unix epoch in milliseconds
+	ModifiedAt  int64   `json:"modifiedAt" bson:"modifiedAt,omitempty"` // as unix epoch in milliseconds
+	// why the value cannot be read, only in responses
+	Error string `json:"error,omitempty" bson:"-"`
 }
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// DeviceAuthorizationStatus is the decision of the user about a DeviceAuthorization
+type DeviceAuthorizationStatus string
+
+const (
+	DeviceAuthorizationPending  DeviceAuthorizationStatus = "pending"
+	DeviceAuthorizationApproved DeviceAuthorizationStatus = "approved"
+	DeviceAuthorizationDenied   DeviceAuthorizationStatus = "denied"
+)
+
+// DeviceAuthorization is a login of a headless client with the device authorization grant (RFC 8628).
+// The client polls with the device code, while a logged user approves the user code shown by the client.
+// Only the hash of the device code is stored.
+type DeviceAuthorization struct {
+	ID             bson.ObjectID             `json:"id" bson:"_id"`
+	DeviceCodeHash string                    `json:"-" bson:"deviceCodeHash"`
+	UserCode       string                    `json:"userCode" bson:"userCode"`
+	Status         DeviceAuthorizationStatus `json:"status" bson:"status"`
+	// ProfileID is the profile that approved or denied the authorization
+	ProfileID *bson.ObjectID `json:"-" bson:"profileId,omitempty"`
+	// Interval is the minimum number of seconds between polls, increased when the client polls too often
+	Interval     int        `json:"-" bson:"interval"`
+	LastPolledAt *time.Time `json:"-" bson:"lastPolledAt,omitempty"`
+	DecidedAt    *time.Time `json:"decidedAt,omitempty" bson:"decidedAt,omitempty"`
+	// UsedAt is set when tokens are issued, so they are issued once
+	UsedAt    *time.Time `json:"-" bson:"usedAt,omitempty"`
+	CreatedAt time.Time  `json:"createdAt" bson:"createdAt"`
+	ExpiresAt time.Time  `json:"expiresAt" bson:"expiresAt"`
+}
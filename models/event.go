@@ -0,0 +1,44 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// EventType string
+type EventType string
+
+// Supported events, sent to profiles that can access the changed home or device.
+const (
+	EventDeviceValues       EventType = "device.values"
+	EventDeviceOnline       EventType = "device.online"
+	EventDeviceAssigned     EventType = "device.assigned"
+	EventDeviceUnassigned   EventType = "device.unassigned"
+	EventDeviceUpdated      EventType = "device.updated"
+	EventDeviceDeleted      EventType = "device.deleted"
+	EventHomeCreated        EventType = "home.created"
+	EventHomeUpdated        EventType = "home.updated"
+	EventHomeDeleted        EventType = "home.deleted"
+	EventHomeMembersUpdated EventType = "home.members.updated"
+	EventRoomCreated        EventType = "room.created"
+	EventRoomUpdated        EventType = "room.updated"
+	EventRoomDeleted        EventType = "room.deleted"
+)
+
+// Event is a change pushed to clients. Data depends on Type,
+// e.g. feature states for EventDeviceValues and DeviceOnlineEvent for EventDeviceOnline.
+type Event struct {
+	Type     EventType      `json:"type"`
+	HomeID   *bson.ObjectID `json:"homeId,omitempty"`
+	RoomID   *bson.ObjectID `json:"roomId,omitempty"`
+	DeviceID *bson.ObjectID `json:"deviceId,omitempty"`
+	Data     any            `json:"data,omitempty"`
+	Time     time.Time      `json:"time"`
+}
+
+// DeviceOnlineEvent is the data of EventDeviceOnline
+type DeviceOnlineEvent struct {
+	Online     bool      `json:"online"`
+	ModifiedAt time.Time `json:"modifiedAt"`
+}
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// FeatureValueMeta identifies the series of a FeatureValue.
+// It's the metaField of the feature_values time-series collection.
+type FeatureValueMeta struct {
+	DeviceID    bson.ObjectID `json:"deviceId" bson:"deviceId"`
+	FeatureUUID string        `json:"featureUuid" bson:"featureUuid"`
+}
+
+// FeatureValue is a single reading of a device feature.
+type FeatureValue struct {
+	Meta      FeatureValueMeta `json:"meta" bson:"meta"`
+	Timestamp time.Time        `json:"timestamp" bson:"timestamp"`
+	Value     float64          `json:"value" bson:"value"`
+}
+
+// FeatureValueBucket aggregates all readings of a feature in a time bucket starting at From.
+type FeatureValueBucket struct {
+	From  time.Time `json:"from" bson:"_id"`
+	Min   float64   `json:"min" bson:"min"`
+	Max   float64   `json:"max" bson:"max"`
+	Avg   float64   `json:"avg" bson:"avg"`
+	Count int       `json:"count" bson:"count"`
+}
@@ -6,12 +6,33 @@ import (
 	"go.mongodb.org/mongo-driver/v2/bson"
 )
 
+// HomeRole string
+type HomeRole string
+
+// Supported home member roles, from the most to the least privileged.
+const (
+	HomeRoleOwner  HomeRole = "owner"
+	HomeRoleAdmin  HomeRole = "admin"
+	HomeRoleMember HomeRole = "member"
+	HomeRoleGuest  HomeRole = "guest"
+)
+
+// HomeMember struct
+type HomeMember struct {
+	ProfileID bson.ObjectID `json:"profileId" bson:"profileId"`
+	Role      HomeRole      `json:"role" bson:"role"`
+	AddedAt   time.Time     `json:"addedAt" bson:"addedAt"`
+}
+
 // Home struct
 type Home struct {
-	ID         bson.ObjectID `json:"id" bson:"_id"`
-	Name       string        `json:"name" bson:"name"`
-	Location   string        `json:"location" bson:"location"`
-	Rooms      []Room        `json:"rooms" bson:"rooms"`
-	CreatedAt  time.Time     `json:"createdAt" bson:"createdAt"`
-	ModifiedAt time.Time     `json:"modifiedAt" bson:"modifiedAt"`
+	ID       bson.ObjectID `json:"id" bson:"_id"`
+	Name     string        `json:"name" bson:"name"`
+	Location string        `json:"location" bson:"location"`
+	// IANA timezone used to run schedules, UTC when empty
+	Timezone   string       `json:"timezone,omitempty" bson:"timezone,omitempty"`
+	Rooms      []Room       `json:"rooms" bson:"rooms"`
+	Members    []HomeMember `json:"members" bson:"members,omitempty"`
+	CreatedAt  time.Time    `json:"createdAt" bson:"createdAt"`
+	ModifiedAt time.Time    `json:"modifiedAt" bson:"modifiedAt"`
 }
@@ -0,0 +1,51 @@
+package models
+
+// HomeConfigVersion is the current version of the HomeConfig schema
+const HomeConfigVersion = 1
+
+// HomeConfig is the configuration of the rooms of a home and of the devices assigned to them.
+// It's exported and imported as JSON or YAML. Devices are identified by MAC or UUID instead of ids,
+// so a configuration can be applied to another home or after devices have been registered again.
+type HomeConfig struct {
+	Version int              `json:"version" validate:"required,eq=1"`
+	Rooms   []HomeConfigRoom `json:"rooms" validate:"required,max=100,dive"`
+}
+
+// HomeConfigRoom is a room of a HomeConfig, identified by its name
+type HomeConfigRoom struct {
+	Name    string             `json:"name" validate:"required,min=1,max=50"`
+	Floor   int                `json:"floor" validate:"min=-50,max=300"`
+	Devices []HomeConfigDevice `json:"devices" validate:"max=200,dive"`
+}
+
+// HomeConfigDevice is a device assigned to a room of a HomeConfig. The name is not changed if empty.
+type HomeConfigDevice struct {
+	MAC  string `json:"mac,omitempty" validate:"required_without=UUID,omitempty,max=32"`
+	UUID string `json:"uuid,omitempty" validate:"required_without=MAC,omitempty,uuid"`
+	Name string `json:"name,omitempty" validate:"omitempty,max=32"`
+}
+
+// HomeConfigDiff are the changes to apply a HomeConfig to a home
+type HomeConfigDiff struct {
+	RoomsCreated      []string                 `json:"roomsCreated"`
+	RoomsUpdated      []string                 `json:"roomsUpdated"`
+	RoomsDeleted      []string                 `json:"roomsDeleted"`
+	DevicesAssigned   []HomeConfigDeviceChange `json:"devicesAssigned"`
+	DevicesUnassigned []HomeConfigDeviceChange `json:"devicesUnassigned"`
+	DevicesRenamed    []HomeConfigDeviceChange `json:"devicesRenamed"`
+}
+
+// HomeConfigDeviceChange is a change of the room or of the name of a device
+type HomeConfigDeviceChange struct {
+	MAC      string `json:"mac"`
+	UUID     string `json:"uuid"`
+	FromRoom string `json:"fromRoom,omitempty"`
+	ToRoom   string `json:"toRoom,omitempty"`
+	Name     string `json:"name,omitempty"`
+}
+
+// IsEmpty reports whether applying the configuration changes nothing
+func (d HomeConfigDiff) IsEmpty() bool {
+	return len(d.RoomsCreated) == 0 && len(d.RoomsUpdated) == 0 && len(d.RoomsDeleted) == 0 &&
+		len(d.DevicesAssigned) == 0 && len(d.DevicesUnassigned) == 0 && len(d.DevicesRenamed) == 0
+}
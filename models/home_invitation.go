@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// HomeInvitation is a pending, single-use invitation to join a home with a
+// specific role. Only the hash of the invitation code is stored.
+type HomeInvitation struct {
+	ID         bson.ObjectID  `json:"id" bson:"_id"`
+	HomeID     bson.ObjectID  `json:"homeId" bson:"homeId"`
+	CodeHash   string         `json:"-" bson:"codeHash"`
+	Role       HomeRole       `json:"role" bson:"role"`
+	Email      string         `json:"email,omitempty" bson:"email,omitempty"`
+	InvitedBy  bson.ObjectID  `json:"invitedBy" bson:"invitedBy"`
+	CreatedAt  time.Time      `json:"createdAt" bson:"createdAt"`
+	ExpiresAt  time.Time      `json:"expiresAt" bson:"expiresAt"`
+	AcceptedAt *time.Time     `json:"acceptedAt,omitempty" bson:"acceptedAt,omitempty"`
+	AcceptedBy *bson.ObjectID `json:"acceptedBy,omitempty" bson:"acceptedBy,omitempty"`
+	RevokedAt  *time.Time     `json:"revokedAt,omitempty" bson:"revokedAt,omitempty"`
+}
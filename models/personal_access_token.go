@@ -0,0 +1,54 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// PersonalAccessTokenPrefix starts every personal access token, to tell them apart from JWTs
+const PersonalAccessTokenPrefix = "hat_"
+
+// Scopes of personal access tokens, each one allows a group of APIs
+const (
+	ScopeHomesRead    = "homes:read"
+	ScopeHomesWrite   = "homes:write"
+	ScopeDevicesRead  = "devices:read"
+	ScopeDevicesWrite = "devices:write"
+	ScopeValuesRead   = "values:read"
+	ScopeValuesWrite  = "values:write"
+)
+
+// PersonalAccessTokenScopes are all the scopes a personal access token can have
+var PersonalAccessTokenScopes = []string{
+	ScopeHomesRead,
+	ScopeHomesWrite,
+	ScopeDevicesRead,
+	ScopeDevicesWrite,
+	ScopeValuesRead,
+	ScopeValuesWrite,
+}
+
+// PersonalAccessToken is a credential created by a user for scripts and integrations.
+// It acts as its profile only on the APIs allowed by its scopes, until it expires.
+// Only the hash of the token is stored, the token is returned once when created.
+type PersonalAccessToken struct {
+	ID         bson.ObjectID `json:"id" bson:"_id"`
+	ProfileID  bson.ObjectID `json:"-" bson:"profileId"`
+	Name       string        `json:"name" bson:"name"`
+	Scopes     []string      `json:"scopes" bson:"scopes"`
+	TokenHash  string        `json:"-" bson:"tokenHash"`
+	CreatedAt  time.Time     `json:"createdAt" bson:"createdAt"`
+	ExpiresAt  time.Time     `json:"expiresAt" bson:"expiresAt"`
+	LastUsedAt *time.Time    `json:"lastUsedAt,omitempty" bson:"lastUsedAt,omitempty"`
+}
+
+// HasScope reports whether the token allows APIs of scope
+func (pat *PersonalAccessToken) HasScope(scope string) bool {
+	for _, s := range pat.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -1,6 +1,8 @@
 package models
 
 import (
+	"strconv"
+	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/v2/bson"
@@ -26,6 +28,44 @@ var DbGithubUserTestmock = GitHub{
 	AvatarURL: "https://avatars.githubusercontent.com/u/123456?v=4",
 }
 
+// Identity is an account of an identity provider linked to a profile, i.e. a way to log in as that profile.
+// ID is unique across providers, e.g. "github|123456".
+type Identity struct {
+	ID            string    `json:"id" bson:"id"`
+	Provider      string    `json:"provider" bson:"provider"`
+	Subject       string    `json:"subject" bson:"subject"`
+	Login         string    `json:"login" bson:"login"`
+	Name          string    `json:"name" bson:"name"`
+	Email         string    `json:"email" bson:"email"`
+	EmailVerified bool      `json:"emailVerified" bson:"emailVerified"`
+	AvatarURL     string    `json:"avatarURL" bson:"avatarURL"`
+	LinkedAt      time.Time `json:"linkedAt" bson:"linkedAt"`
+}
+
+// IdentityProviderGitHub is the name of the GitHub identity provider
+const IdentityProviderGitHub = "github"
+
+// IdentityID returns the ID of the identity of subject in provider
+func IdentityID(provider, subject string) string {
+	return provider + "|" + subject
+}
+
+// GitHubIdentity returns the identity of a GitHub account.
+// GitHub shows only verified emails in profiles, so the email is verified.
+func GitHubIdentity(github GitHub) Identity {
+	subject := strconv.FormatInt(github.ID, 10)
+	return Identity{
+		ID:            IdentityID(IdentityProviderGitHub, subject),
+		Provider:      IdentityProviderGitHub,
+		Subject:       subject,
+		Login:         github.Login,
+		Name:          github.Name,
+		Email:         github.Email,
+		EmailVerified: github.Email != "",
+		AvatarURL:     github.AvatarURL,
+	}
+}
+
 // Profile struct
 type Profile struct {
 	ID                bson.ObjectID   `json:"id" bson:"_id"`
@@ -37,8 +77,85 @@ type Profile struct {
 	Homes             []bson.ObjectID `json:"homes" bson:"homes"`
 	CreatedAt         time.Time       `json:"createdAt" bson:"createdAt"`
 	ModifiedAt        time.Time       `json:"modifiedAt" bson:"modifiedAt"`
-	// as recommended by official FCM documentation, we save both token and timestamp
-	// More info at https://firebase.google.com/docs/cloud-messaging/manage-tokens
-	FCMToken          string    `json:"fcmToken" bson:"fcmToken"`
-	FCMTokenTimestamp time.Time `json:"fcmTokenTimestamp" bson:"fcmTokenTimestamp"`
+	// identities to log in as this profile, in the order they were linked.
+	// Github is empty for profiles created with another provider.
+	Identities []Identity `json:"identities" bson:"identities,omitempty"`
+	// a token for every app installation receiving notifications, listed via GET /api/fcmtoken
+	FCMTokens []FCMToken `json:"-" bson:"fcmTokens,omitempty"`
+	// Deprecated: fcmToken and fcmTokenTimestamp are the most recently seen token of FCMTokens,
+	// filled only by GET /api/profile for old apps and removed in the next release.
+	FCMToken          string    `json:"fcmToken" bson:"-"`
+	FCMTokenTimestamp time.Time `json:"fcmTokenTimestamp" bson:"-"`
+	// Role is ProfileRoleAdmin for profiles managing users, ProfileRoleUser or empty for the other ones
+	Role string `json:"role,omitempty" bson:"role,omitempty"`
+	// SuspendedAt is set for profiles suspended by an admin, they cannot log in or call APIs
+	SuspendedAt *time.Time `json:"suspendedAt,omitempty" bson:"suspendedAt,omitempty"`
+	// DeletionTokenHash confirms the deletion of the profile until DeletionTokenExpiresAt, see DELETE /api/profile
+	DeletionTokenHash      string     `json:"-" bson:"deletionTokenHash,omitempty"`
+	DeletionTokenExpiresAt *time.Time `json:"-" bson:"deletionTokenExpiresAt,omitempty"`
+}
+
+// Roles of profiles, to manage users
+const (
+	ProfileRoleAdmin = "admin"
+	ProfileRoleUser  = "user"
+)
+
+// IsAdmin reports whether the profile can manage users
+func (p Profile) IsAdmin() bool {
+	return p.Role == ProfileRoleAdmin
+}
+
+// IsSuspended reports whether the profile has been suspended by an admin
+func (p Profile) IsSuspended() bool {
+	return p.SuspendedAt != nil
+}
+
+// MainIdentity returns the identity to show for the profile, i.e. the first linked one.
+// Profiles without identities are created before they were introduced and have only a GitHub account.
+func (p Profile) MainIdentity() Identity {
+	if len(p.Identities) > 0 {
+		return p.Identities[0]
+	}
+	return GitHubIdentity(p.Github)
+}
+
+// HasVerifiedEmail reports whether email is the verified email of one of the identities of the profile
+func (p Profile) HasVerifiedEmail(email string) bool {
+	email = strings.TrimSpace(email)
+	if email == "" {
+		return false
+	}
+	identities := p.Identities
+	if len(identities) == 0 {
+		identities = []Identity{GitHubIdentity(p.Github)}
+	}
+	for _, identity := range identities {
+		if identity.EmailVerified && strings.EqualFold(strings.TrimSpace(identity.Email), email) {
+			return true
+		}
+	}
+	return false
+}
+
+// FCMPlatform string
+type FCMPlatform string
+
+// Platforms of apps receiving notifications
+const (
+	FCMPlatformAndroid FCMPlatform = "android"
+	FCMPlatformIOS     FCMPlatform = "ios"
+	FCMPlatformWeb     FCMPlatform = "web"
+)
+
+// FCMToken is the Firebase Cloud Messaging token of an app installation.
+// As recommended by official FCM documentation, we save when it was last seen, to prune stale tokens.
+// More info at https://firebase.google.com/docs/cloud-messaging/manage-tokens
+type FCMToken struct {
+	ID          bson.ObjectID `json:"id" bson:"_id"`
+	Token       string        `json:"token" bson:"token"`
+	DeviceLabel string        `json:"deviceLabel" bson:"deviceLabel"`
+	Platform    FCMPlatform   `json:"platform,omitempty" bson:"platform,omitempty"`
+	CreatedAt   time.Time     `json:"createdAt" bson:"createdAt"`
+	LastSeenAt  time.Time     `json:"lastSeenAt" bson:"lastSeenAt"`
 }
@@ -7,14 +7,25 @@ import (
 )
 
 type RefreshToken struct {
-	ID             bson.ObjectID `bson:"_id,omitempty"`
-	ProfileID      bson.ObjectID `bson:"profileId"`
-	TokenHash      string        `bson:"tokenHash"`
-	FamilyID       string        `bson:"familyId"`
-	ClientType     string        `bson:"clientType"`
-	CreatedAt      time.Time     `bson:"createdAt"`
-	ExpiresAt      time.Time     `bson:"expiresAt"`
-	RevokedAt      *time.Time    `bson:"revokedAt,omitempty"`
-	ReplacedByHash string        `bson:"replacedByHash,omitempty"`
-	LastUsedAt     *time.Time    `bson:"lastUsedAt,omitempty"`
+	ID              bson.ObjectID `bson:"_id,omitempty"`
+	ProfileID       bson.ObjectID `bson:"profileId"`
+	TokenHash       string        `bson:"tokenHash"`
+	FamilyID        string        `bson:"familyId"`
+	ClientType      string        `bson:"clientType"`
+	CreatedAt       time.Time     `bson:"createdAt"`
+	ExpiresAt       time.Time     `bson:"expiresAt"`
+	RevokedAt       *time.Time    `bson:"revokedAt,omitempty"`
+	ReplacedByHash  string        `bson:"replacedByHash,omitempty"`
+	LastUsedAt      *time.Time    `bson:"lastUsedAt,omitempty"`
+	FamilyCreatedAt time.Time     `bson:"familyCreatedAt,omitempty"`
+}
+
+// Session is an active refresh-token family, i.e. a login of a client that can still refresh its access token
+type Session struct {
+	FamilyID   string    `json:"familyId" bson:"_id"`
+	ClientType string    `json:"clientType" bson:"clientType"`
+	CreatedAt  time.Time `json:"createdAt" bson:"createdAt"`
+	LastUsedAt time.Time `json:"lastUsedAt" bson:"lastUsedAt"`
+	ExpiresAt  time.Time `json:"expiresAt" bson:"expiresAt"`
+	Current    bool      `json:"current" bson:"-"`
 }
@@ -0,0 +1,72 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// RuleOperator string
+type RuleOperator string
+
+// Supported comparison operators of rule conditions.
+const (
+	RuleOperatorGt  RuleOperator = "gt"
+	RuleOperatorGte RuleOperator = "gte"
+	RuleOperatorLt  RuleOperator = "lt"
+	RuleOperatorLte RuleOperator = "lte"
+	RuleOperatorEq  RuleOperator = "eq"
+	RuleOperatorNeq RuleOperator = "neq"
+)
+
+// RuleCondition compares the value of a device feature with a threshold.
+type RuleCondition struct {
+	DeviceID    bson.ObjectID `json:"deviceId" bson:"deviceId"`
+	FeatureUUID string        `json:"featureUuid" bson:"featureUuid"`
+	Operator    RuleOperator  `json:"operator" bson:"operator"`
+	Value       float64       `json:"value" bson:"value"`
+	// once triggered, the rule is re-armed only when the value goes back beyond the threshold by this amount
+	Hysteresis float64 `json:"hysteresis" bson:"hysteresis"`
+}
+
+// RuleAction contains the values to set to a device when a rule is triggered.
+type RuleAction struct {
+	DeviceID bson.ObjectID        `json:"deviceId" bson:"deviceId"`
+	Values   []DeviceFeatureState `json:"values" bson:"values"`
+}
+
+// Rule is an automation of a home: when Condition is met, Actions are executed.
+type Rule struct {
+	ID        bson.ObjectID `json:"id" bson:"_id"`
+	HomeID    bson.ObjectID `json:"homeId" bson:"homeId"`
+	Name      string        `json:"name" bson:"name"`
+	Enabled   bool          `json:"enabled" bson:"enabled"`
+	Condition RuleCondition `json:"condition" bson:"condition"`
+	Actions   []RuleAction  `json:"actions" bson:"actions"`
+	// min time between two executions
+	CooldownSeconds int `json:"cooldownSeconds" bson:"cooldownSeconds"`
+	// true after the rule has been triggered, until the condition is not met anymore
+	Active          bool          `json:"active" bson:"active"`
+	LastTriggeredAt *time.Time    `json:"lastTriggeredAt,omitempty" bson:"lastTriggeredAt,omitempty"`
+	CreatedBy       bson.ObjectID `json:"createdBy" bson:"createdBy"`
+	CreatedAt       time.Time     `json:"createdAt" bson:"createdAt"`
+	ModifiedAt      time.Time     `json:"modifiedAt" bson:"modifiedAt"`
+}
+
+// RuleActionResult is the outcome of a single action of a rule execution.
+type RuleActionResult struct {
+	DeviceID bson.ObjectID `json:"deviceId" bson:"deviceId"`
+	Success  bool          `json:"success" bson:"success"`
+	Error    string        `json:"error,omitempty" bson:"error,omitempty"`
+}
+
+// RuleExecution records a rule that has been triggered and the result of its actions.
+type RuleExecution struct {
+	ID           bson.ObjectID      `json:"id" bson:"_id"`
+	RuleID       bson.ObjectID      `json:"ruleId" bson:"ruleId"`
+	HomeID       bson.ObjectID      `json:"homeId" bson:"homeId"`
+	TriggerValue float64            `json:"triggerValue" bson:"triggerValue"`
+	Success      bool               `json:"success" bson:"success"`
+	Results      []RuleActionResult `json:"results" bson:"results"`
+	ExecutedAt   time.Time          `json:"executedAt" bson:"executedAt"`
+}
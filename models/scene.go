@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// SceneValue is the value to set to a controller feature when a scene is activated.
+type SceneValue struct {
+	FeatureUUID string  `json:"featureUuid" bson:"featureUuid"`
+	Name        string  `json:"name" bson:"name"`
+	Value       float32 `json:"value" bson:"value"`
+}
+
+// SceneStep contains all values to set to a single device.
+type SceneStep struct {
+	DeviceID bson.ObjectID `json:"deviceId" bson:"deviceId"`
+	Values   []SceneValue  `json:"values" bson:"values"`
+}
+
+// Scene is a named preset of controller values for devices of a home.
+type Scene struct {
+	ID         bson.ObjectID `json:"id" bson:"_id"`
+	HomeID     bson.ObjectID `json:"homeId" bson:"homeId"`
+	Name       string        `json:"name" bson:"name"`
+	Steps      []SceneStep   `json:"steps" bson:"steps"`
+	CreatedBy  bson.ObjectID `json:"createdBy" bson:"createdBy"`
+	CreatedAt  time.Time     `json:"createdAt" bson:"createdAt"`
+	ModifiedAt time.Time     `json:"modifiedAt" bson:"modifiedAt"`
+}
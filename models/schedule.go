@@ -0,0 +1,76 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// ScheduleKind string
+type ScheduleKind string
+
+// Supported kinds of schedule.
+const (
+	ScheduleKindWeekly ScheduleKind = "weekly"
+	ScheduleKindCron   ScheduleKind = "cron"
+)
+
+// ScheduleRunStatus string
+type ScheduleRunStatus string
+
+// Possible outcomes of a schedule run.
+const (
+	ScheduleRunSuccess ScheduleRunStatus = "success"
+	ScheduleRunFailed  ScheduleRunStatus = "failed"
+	// the run was due while no api-server was running, so values haven't been sent
+	ScheduleRunSkipped ScheduleRunStatus = "skipped"
+)
+
+// WeeklySchedule fires at the same time of the day on some days of the week.
+type WeeklySchedule struct {
+	// 0 = Sunday, 6 = Saturday
+	Days []int `json:"days" bson:"days"`
+	// as "HH:MM" in the timezone of the home
+	Time string `json:"time" bson:"time"`
+}
+
+// Schedule sets values to the controller features of a device at recurring times.
+type Schedule struct {
+	ID       bson.ObjectID   `json:"id" bson:"_id"`
+	HomeID   bson.ObjectID   `json:"homeId" bson:"homeId"`
+	DeviceID bson.ObjectID   `json:"deviceId" bson:"deviceId"`
+	Name     string          `json:"name" bson:"name"`
+	Enabled  bool            `json:"enabled" bson:"enabled"`
+	Kind     ScheduleKind    `json:"kind" bson:"kind"`
+	Weekly   *WeeklySchedule `json:"weekly,omitempty" bson:"weekly,omitempty"`
+	// cron expression evaluated in the timezone of the home, for weekly schedules it's derived from Weekly
+	Cron       string               `json:"cron" bson:"cron"`
+	Values     []DeviceFeatureState `json:"values" bson:"values"`
+	NextRunAt  *time.Time           `json:"nextRunAt,omitempty" bson:"nextRunAt,omitempty"`
+	LastRunAt  *time.Time           `json:"lastRunAt,omitempty" bson:"lastRunAt,omitempty"`
+	CreatedBy  bson.ObjectID        `json:"createdBy" bson:"createdBy"`
+	CreatedAt  time.Time            `json:"createdAt" bson:"createdAt"`
+	ModifiedAt time.Time            `json:"modifiedAt" bson:"modifiedAt"`
+}
+
+// ScheduleRun is the outcome of a single execution of a schedule.
+type ScheduleRun struct {
+	ID          bson.ObjectID     `json:"id" bson:"_id"`
+	ScheduleID  bson.ObjectID     `json:"scheduleId" bson:"scheduleId"`
+	HomeID      bson.ObjectID     `json:"homeId" bson:"homeId"`
+	DeviceID    bson.ObjectID     `json:"deviceId" bson:"deviceId"`
+	Status      ScheduleRunStatus `json:"status" bson:"status"`
+	Error       string            `json:"error,omitempty" bson:"error,omitempty"`
+	ScheduledAt time.Time         `json:"scheduledAt" bson:"scheduledAt"`
+	StartedAt   time.Time         `json:"startedAt" bson:"startedAt"`
+	FinishedAt  time.Time         `json:"finishedAt" bson:"finishedAt"`
+	// api-server instance that executed the run
+	RunBy string `json:"runBy" bson:"runBy"`
+}
+
+// Lease is a lock document that only one api-server instance can hold until ExpiresAt.
+type Lease struct {
+	ID        string    `json:"id" bson:"_id"`
+	Owner     string    `json:"owner" bson:"owner"`
+	ExpiresAt time.Time `json:"expiresAt" bson:"expiresAt"`
+}
@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// UserInvitation allows an email to sign up, i.e. it is an entry of the allowlist of users.
+// A login with a verified email of an invitation creates a profile with the role of the invitation.
+// The invitation is kept after that, so the user can sign up again after deleting the profile,
+// until an admin deletes it.
+type UserInvitation struct {
+	ID    bson.ObjectID `json:"id" bson:"_id"`
+	Email string        `json:"email" bson:"email"`
+	Role  string        `json:"role" bson:"role"`
+	// InvitedBy is the admin who invited the user, nil for invitations from ADMIN_EMAILS and LIMIT_TO_USER_EMAILS
+	InvitedBy *bson.ObjectID `json:"invitedBy,omitempty" bson:"invitedBy,omitempty"`
+	// ProfileID is the profile created with the invitation
+	ProfileID  *bson.ObjectID `json:"profileId,omitempty" bson:"profileId,omitempty"`
+	AcceptedAt *time.Time     `json:"acceptedAt,omitempty" bson:"acceptedAt,omitempty"`
+	CreatedAt  time.Time      `json:"createdAt" bson:"createdAt"`
+}
@@ -1,6 +1,7 @@
 package testuutils
 
 import (
+	"api-server/auth"
 	"api-server/models"
 	"api-server/utils"
 	"encoding/json"
@@ -9,6 +10,7 @@ import (
 	"net/url"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/onsi/gomega"
@@ -106,3 +108,20 @@ func GetLoggedProfile(router *gin.Engine, jwtToken, cookieSession string) models
 	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
 	return profileRes
 }
+
+// GetJwtForProfile creates a mobile access token for a profile inserted directly in db.
+// It's useful to act as a second user, without going through the GitHub login.
+func GetJwtForProfile(profile models.Profile) string {
+	jwtToken, err := utils.CreateJWT(profile, time.Now().Add(auth.MobileTokenTTL), utils.AccessToken,
+		auth.RefreshTokenClientMobile, "", GetJWTKeys())
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	return jwtToken
+}
+
+// GetJWTKeys returns the keys of the server started by tests, to sign tokens like it does.
+// Without JWT_KEYS_FOLDER_PATH, the ephemeral key is the same for the whole process.
+func GetJWTKeys() *utils.JWTKeySet {
+	jwtKeys, err := utils.LoadJWTKeys(utils.JWTKeysConfigFromEnv())
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	return jwtKeys
+}
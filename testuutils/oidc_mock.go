@@ -0,0 +1,216 @@
+package testuutils
+
+import (
+	"api-server/utils"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/onsi/gomega"
+)
+
+// OIDCMockUser is the user logged in by OIDCMock
+type OIDCMockUser struct {
+	Subject string
+	Login   string
+	Name    string
+	Email   string
+}
+
+// OIDCMock is a minimal OpenID Connect provider with discovery, JWKS, authorization and token endpoints.
+// The authorization endpoint logs in the user without asking anything, like a provider with an active session.
+type OIDCMock struct {
+	Server   *httptest.Server
+	ClientID string
+
+	key         *rsa.PrivateKey
+	mu          sync.Mutex
+	user        OIDCMockUser
+	authorizeds map[string]oidcMockAuthorization
+}
+
+type oidcMockAuthorization struct {
+	nonce         string
+	codeChallenge string
+	redirectURI   string
+}
+
+const oidcMockKeyID = "oidc-mock-key"
+
+// NewOIDCMock starts an OpenID Connect provider for clientID, the caller must close it
+func NewOIDCMock(clientID string, user OIDCMockUser) *OIDCMock {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	mock := &OIDCMock{
+		ClientID:    clientID,
+		user:        user,
+		key:         key,
+		authorizeds: make(map[string]oidcMockAuthorization),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]any{
+			"issuer":                           mock.Server.URL,
+			"authorization_endpoint":           mock.Server.URL + "/authorize",
+			"token_endpoint":                   mock.Server.URL + "/token",
+			"jwks_uri":                         mock.Server.URL + "/jwks",
+			"code_challenge_methods_supported": []string{"S256"},
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": oidcMockKeyID,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("GET /authorize", mock.authorize)
+	mux.HandleFunc("POST /token", mock.token)
+	mock.Server = httptest.NewServer(mux)
+	return mock
+}
+
+// SetUser changes the user logged in by the next authorizations
+func (m *OIDCMock) SetUser(user OIDCMockUser) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.user = user
+}
+
+// Close stops the provider
+func (m *OIDCMock) Close() {
+	m.Server.Close()
+}
+
+// Authorize calls the authorization URL the login redirected to, returning the callback URL with code and state
+func (m *OIDCMock) Authorize(authURL string) *url.URL {
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(authURL)
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	defer resp.Body.Close()
+	gomega.Expect(resp.StatusCode).To(gomega.Equal(http.StatusFound))
+	callbackURL, err := resp.Location()
+	gomega.Expect(err).ShouldNot(gomega.HaveOccurred())
+	return callbackURL
+}
+
+func (m *OIDCMock) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("client_id") != m.ClientID || q.Get("response_type") != "code" || q.Get("code_challenge_method") != "S256" ||
+		!strings.Contains(q.Get("scope"), "openid") {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+	code, err := utils.RandomString(32)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+	m.mu.Lock()
+	m.authorizeds[code] = oidcMockAuthorization{
+		nonce:         q.Get("nonce"),
+		codeChallenge: q.Get("code_challenge"),
+		redirectURI:   q.Get("redirect_uri"),
+	}
+	m.mu.Unlock()
+
+	callbackURL, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+	callbackQuery := url.Values{}
+	callbackQuery.Set("code", code)
+	callbackQuery.Set("state", q.Get("state"))
+	callbackURL.RawQuery = callbackQuery.Encode()
+	http.Redirect(w, r, callbackURL.String(), http.StatusFound)
+}
+
+func (m *OIDCMock) token(w http.ResponseWriter, r *http.Request) {
+	clientID, _, ok := r.BasicAuth()
+	if !ok || clientID != m.ClientID || r.ParseForm() != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+	// codes can be used once
+	m.mu.Lock()
+	authorization, found := m.authorizeds[r.PostForm.Get("code")]
+	delete(m.authorizeds, r.PostForm.Get("code"))
+	user := m.user
+	m.mu.Unlock()
+	codeChallenge, err := utils.BuildPKCECodeChallenge(r.PostForm.Get("code_verifier"))
+	if !found || err != nil || codeChallenge != authorization.codeChallenge || r.PostForm.Get("redirect_uri") != authorization.redirectURI {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	now := time.Now()
+	idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":                m.Server.URL,
+		"aud":                m.ClientID,
+		"sub":                user.Subject,
+		"iat":                now.Unix(),
+		"exp":                now.Add(5 * time.Minute).Unix(),
+		"nonce":              authorization.nonce,
+		"preferred_username": user.Login,
+		"name":               user.Name,
+		"email":              user.Email,
+		"email_verified":     true,
+	})
+	idToken.Header["kid"] = oidcMockKeyID
+	signed, err := idToken.SignedString(m.key)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": "oidc-mock-access-token",
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     signed,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+// GetJwtWithOIDC logs in the web app with the OIDC provider called providerName, returning JWT and cookies like GetJwt
+func GetJwtWithOIDC(router *gin.Engine, mock *OIDCMock, providerName string) (string, string) {
+	recorder := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/api/oauth/providers/"+providerName+"/login", nil)
+	router.ServeHTTP(recorder, req)
+	gomega.Expect(recorder.Code).To(gomega.Equal(http.StatusTemporaryRedirect))
+	authURL := recorder.Header().Get("Location")
+	gomega.Expect(authURL).To(gomega.HavePrefix(mock.Server.URL + "/authorize"))
+	cookieSession := recorder.Header().Get("Set-Cookie")
+
+	callbackURL := mock.Authorize(authURL)
+	recorder = httptest.NewRecorder()
+	req = httptest.NewRequest("GET", callbackURL.RequestURI(), nil)
+	req.Header.Add("Cookie", cookieSession)
+	router.ServeHTTP(recorder, req)
+	gomega.Expect(recorder.Code).To(gomega.Equal(http.StatusFound))
+	redirectUrl := recorder.Header().Get("location")
+	gomega.Expect(redirectUrl).To(gomega.HavePrefix("/postlogin#token="))
+	jwtToken := strings.ReplaceAll(redirectUrl, "/postlogin#token=", "")
+	return jwtToken, joinCookies(recorder)
+}
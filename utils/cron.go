@@ -0,0 +1,192 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxCronSearch limits the search of the next run of a cron expression
+// that cannot match any date, like "0 0 31 2 *".
+const maxCronSearch = 5 * 366 * 24 * time.Hour
+
+// CronSchedule is a parsed 5 fields cron expression: minute, hour, day of month, month and day of week.
+type CronSchedule struct {
+	minutes     map[int]bool
+	hours       map[int]bool
+	daysOfMonth map[int]bool
+	months      map[int]bool
+	daysOfWeek  map[int]bool
+	// as in standard cron, when both days are restricted, a date matches if it satisfies one of them
+	anyDayOfMonth bool
+	anyDayOfWeek  bool
+}
+
+type cronField struct {
+	name string
+	min  int
+	max  int
+}
+
+var cronFields = []cronField{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12},
+	// 7 is accepted as an alias of Sunday
+	{name: "day of week", min: 0, max: 7},
+}
+
+// ParseCron parses a cron expression like "30 6 * * 1-5".
+// Every field supports '*', single values, ranges 'a-b', lists 'a,b' and steps '*/n' or 'a-b/n'.
+func ParseCron(expr string) (*CronSchedule, error) {
+	parts := strings.Fields(expr)
+	if len(parts) != len(cronFields) {
+		return nil, fmt.Errorf("cron expression must have %d fields", len(cronFields))
+	}
+	values := make([]map[int]bool, len(cronFields))
+	for i, field := range cronFields {
+		parsed, err := parseCronField(parts[i], field)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = parsed
+	}
+	if values[4][7] {
+		values[4][0] = true
+		delete(values[4], 7)
+	}
+	return &CronSchedule{
+		minutes:       values[0],
+		hours:         values[1],
+		daysOfMonth:   values[2],
+		months:        values[3],
+		daysOfWeek:    values[4],
+		anyDayOfMonth: parts[2] == "*",
+		anyDayOfWeek:  parts[4] == "*",
+	}, nil
+}
+
+// WeeklyToCron converts days of week (0 = Sunday) and a time "HH:MM" to a cron expression.
+func WeeklyToCron(days []int, at string) (string, error) {
+	if len(days) == 0 {
+		return "", fmt.Errorf("at least a day of week is required")
+	}
+	hour, minute, err := parseClock(at)
+	if err != nil {
+		return "", err
+	}
+	rawDays := make([]string, 0, len(days))
+	for _, day := range days {
+		if day < 0 || day > 6 {
+			return "", fmt.Errorf("day of week must be between 0 and 6")
+		}
+		rawDays = append(rawDays, strconv.Itoa(day))
+	}
+	return fmt.Sprintf("%d %d * * %s", minute, hour, strings.Join(rawDays, ",")), nil
+}
+
+// Next returns the first time strictly after `after` matching the schedule,
+// evaluated in the location of `after`. It returns the zero time if there is no match.
+func (cs *CronSchedule) Next(after time.Time) time.Time {
+	loc := after.Location()
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	limit := after.Add(maxCronSearch)
+	for t.Before(limit) {
+		if !cs.months[int(t.Month())] {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !cs.matchDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !cs.hours[t.Hour()] {
+			next := time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+			// on DST changes the next wall clock hour can be the same instant
+			if !next.After(t) {
+				next = t.Add(time.Hour).Truncate(time.Minute)
+			}
+			t = next
+			continue
+		}
+		if !cs.minutes[t.Minute()] {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+func (cs *CronSchedule) matchDay(t time.Time) bool {
+	dayOfMonth := cs.daysOfMonth[t.Day()]
+	dayOfWeek := cs.daysOfWeek[int(t.Weekday())]
+	switch {
+	case cs.anyDayOfMonth && cs.anyDayOfWeek:
+		return true
+	case cs.anyDayOfMonth:
+		return dayOfWeek
+	case cs.anyDayOfWeek:
+		return dayOfMonth
+	default:
+		return dayOfMonth || dayOfWeek
+	}
+}
+
+func parseCronField(raw string, field cronField) (map[int]bool, error) {
+	values := make(map[int]bool)
+	for _, item := range strings.Split(raw, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(item, "/")
+		step := 1
+		if hasStep {
+			parsedStep, err := strconv.Atoi(stepPart)
+			if err != nil || parsedStep <= 0 {
+				return nil, fmt.Errorf("invalid step '%s' in %s field", stepPart, field.name)
+			}
+			step = parsedStep
+		}
+		from, to := field.min, field.max
+		if rangePart != "*" {
+			rawFrom, rawTo, isRange := strings.Cut(rangePart, "-")
+			var err error
+			if from, err = parseCronValue(rawFrom, field); err != nil {
+				return nil, err
+			}
+			to = from
+			if isRange {
+				if to, err = parseCronValue(rawTo, field); err != nil {
+					return nil, err
+				}
+				if to < from {
+					return nil, fmt.Errorf("invalid range '%s' in %s field", rangePart, field.name)
+				}
+			} else if hasStep {
+				// "a/n" means from a to the end of the field
+				to = field.max
+			}
+		}
+		for value := from; value <= to; value += step {
+			values[value] = true
+		}
+	}
+	return values, nil
+}
+
+func parseCronValue(raw string, field cronField) (int, error) {
+	value, err := strconv.Atoi(raw)
+	if err != nil || value < field.min || value > field.max {
+		return 0, fmt.Errorf("%s field must be between %d and %d", field.name, field.min, field.max)
+	}
+	return value, nil
+}
+
+// parseClock parses a time of the day in the "HH:MM" format.
+func parseClock(at string) (int, int, error) {
+	parsed, err := time.Parse("15:04", at)
+	if err != nil {
+		return 0, 0, fmt.Errorf("time must be in the HH:MM format")
+	}
+	return parsed.Hour(), parsed.Minute(), nil
+}
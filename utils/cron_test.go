@@ -0,0 +1,84 @@
+package utils
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("using cron utils", func() {
+	When("calling ParseCron", func() {
+		It("should parse valid expressions", func() {
+			for _, expr := range []string{"* * * * *", "30 6 * * 1-5", "*/15 0-23/2 1,15 * 0", "0 12 * 6 7", "5/10 * * * *"} {
+				_, err := ParseCron(expr)
+				Expect(err).ShouldNot(HaveOccurred(), "expr = %s", expr)
+			}
+		})
+		It("should fail with invalid expressions", func() {
+			for _, expr := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 8", "*/0 * * * *", "5-1 * * * *", "a * * * *"} {
+				_, err := ParseCron(expr)
+				Expect(err).Should(HaveOccurred(), "expr = %s", expr)
+			}
+		})
+	})
+
+	When("calling Next", func() {
+		It("should return the next weekday at 06:30", func() {
+			schedule, err := ParseCron("30 6 * * 1-5")
+			Expect(err).ShouldNot(HaveOccurred())
+			// Friday at 07:00
+			next := schedule.Next(time.Date(2026, 10, 16, 7, 0, 0, 0, time.UTC))
+			Expect(next).To(Equal(time.Date(2026, 10, 19, 6, 30, 0, 0, time.UTC)))
+			// Monday at 06:29:59
+			next = schedule.Next(time.Date(2026, 10, 19, 6, 29, 59, 0, time.UTC))
+			Expect(next).To(Equal(time.Date(2026, 10, 19, 6, 30, 0, 0, time.UTC)))
+			// exactly at the scheduled time, it returns the next one
+			next = schedule.Next(time.Date(2026, 10, 19, 6, 30, 0, 0, time.UTC))
+			Expect(next).To(Equal(time.Date(2026, 10, 20, 6, 30, 0, 0, time.UTC)))
+		})
+		It("should use the location of the reference time", func() {
+			rome, err := time.LoadLocation("Europe/Rome")
+			Expect(err).ShouldNot(HaveOccurred())
+			schedule, err := ParseCron("30 6 * * *")
+			Expect(err).ShouldNot(HaveOccurred())
+			// DST ends in Rome on 25 October 2026
+			next := schedule.Next(time.Date(2026, 10, 24, 12, 0, 0, 0, rome))
+			Expect(next.UTC()).To(Equal(time.Date(2026, 10, 25, 5, 30, 0, 0, time.UTC)))
+			next = schedule.Next(time.Date(2026, 10, 23, 12, 0, 0, 0, rome))
+			Expect(next.UTC()).To(Equal(time.Date(2026, 10, 24, 4, 30, 0, 0, time.UTC)))
+		})
+		It("should match day of month or day of week, when both are restricted", func() {
+			schedule, err := ParseCron("0 0 1 * 0")
+			Expect(err).ShouldNot(HaveOccurred())
+			// Sunday 18 October 2026
+			next := schedule.Next(time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC))
+			Expect(next).To(Equal(time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)))
+			next = schedule.Next(time.Date(2026, 10, 31, 12, 0, 0, 0, time.UTC))
+			Expect(next).To(Equal(time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)))
+		})
+		It("should return the zero time, when the expression never matches", func() {
+			schedule, err := ParseCron("0 0 31 2 *")
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(schedule.Next(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)).IsZero()).To(BeTrue())
+		})
+	})
+
+	When("calling WeeklyToCron", func() {
+		It("should build a cron expression", func() {
+			expr, err := WeeklyToCron([]int{1, 2, 3, 4, 5}, "06:30")
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(expr).To(Equal("30 6 * * 1,2,3,4,5"))
+		})
+		It("should fail with invalid days or time", func() {
+			_, err := WeeklyToCron([]int{}, "06:30")
+			Expect(err).Should(HaveOccurred())
+			_, err = WeeklyToCron([]int{7}, "06:30")
+			Expect(err).Should(HaveOccurred())
+			_, err = WeeklyToCron([]int{1}, "6.30")
+			Expect(err).Should(HaveOccurred())
+			_, err = WeeklyToCron([]int{1}, "24:00")
+			Expect(err).Should(HaveOccurred())
+		})
+	})
+})
@@ -0,0 +1,75 @@
+package utils
+
+import (
+	"api-server/models"
+	"errors"
+	"fmt"
+)
+
+// ErrFeatureNotInDevice is returned when overriding a feature that the device doesn't have
+var ErrFeatureNotInDevice = errors.New("feature is not in device")
+
+// PatchDeviceOverrides returns the overrides of device changed by patch.
+// Fields not in patch are kept and empty values remove overrides, so features without overrides are dropped.
+// Feature overrides are sorted like the features of device, that must have them,
+// otherwise it returns an error wrapping ErrFeatureNotInDevice.
+func PatchDeviceOverrides(device *models.Device, patch *models.DeviceOverridesPatch) (models.DeviceOverrides, error) {
+	var overrides models.DeviceOverrides
+	if device.Overrides != nil {
+		overrides = *device.Overrides
+	}
+	if patch.Name != nil {
+		overrides.Name = *patch.Name
+	}
+	if patch.Icon != nil {
+		overrides.Icon = *patch.Icon
+	}
+	if patch.Category != nil {
+		overrides.Category = *patch.Category
+	}
+
+	featureOverrides := make(map[string]models.FeatureOverride, len(overrides.Features))
+	for _, featureOverride := range overrides.Features {
+		featureOverrides[featureOverride.FeatureUUID] = featureOverride
+	}
+	for _, featurePatch := range patch.Features {
+		if !hasFeature(device.Features, featurePatch.FeatureUUID) {
+			return models.DeviceOverrides{}, fmt.Errorf("%w: %s", ErrFeatureNotInDevice, featurePatch.FeatureUUID)
+		}
+		featureOverride := featureOverrides[featurePatch.FeatureUUID]
+		featureOverride.FeatureUUID = featurePatch.FeatureUUID
+		if featurePatch.Label != nil {
+			featureOverride.Label = *featurePatch.Label
+		}
+		if featurePatch.Hidden != nil {
+			featureOverride.Hidden = *featurePatch.Hidden
+		}
+		if featurePatch.Order != nil {
+			featureOverride.Order = featurePatch.Order
+			if *featurePatch.Order < 0 {
+				featureOverride.Order = nil
+			}
+		}
+		featureOverrides[featurePatch.FeatureUUID] = featureOverride
+	}
+
+	// overrides of features removed from the device by a new registration are dropped too
+	overrides.Features = nil
+	for _, feature := range device.Features {
+		featureOverride, found := featureOverrides[feature.UUID]
+		if !found || (featureOverride.Label == "" && !featureOverride.Hidden && featureOverride.Order == nil) {
+			continue
+		}
+		overrides.Features = append(overrides.Features, featureOverride)
+	}
+	return overrides, nil
+}
+
+func hasFeature(features []models.Feature, featureUUID string) bool {
+	for _, feature := range features {
+		if feature.UUID == featureUUID {
+			return true
+		}
+	}
+	return false
+}
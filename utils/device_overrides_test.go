@@ -0,0 +1,94 @@
+package utils
+
+import (
+	"api-server/models"
+
+	"github.com/google/uuid"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("using device overrides utils", func() {
+	When("calling PatchDeviceOverrides", func() {
+		featureUUID1 := uuid.NewString()
+		featureUUID2 := uuid.NewString()
+		var device models.Device
+
+		BeforeEach(func() {
+			device = models.Device{
+				Name: "manufacturer name",
+				Features: []models.Feature{
+					{UUID: featureUUID1, Name: "setpoint", Order: 1},
+					{UUID: featureUUID2, Name: "temperature", Order: 2},
+				},
+			}
+		})
+
+		It("should set device overrides, without changing reported fields", func() {
+			name := "Bedroom AC"
+			category := models.DeviceCategoryClimate
+			overrides, err := PatchDeviceOverrides(&device, &models.DeviceOverridesPatch{Name: &name, Category: &category})
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(overrides).To(Equal(models.DeviceOverrides{Name: name, Category: category}))
+			Expect(device.Name).To(Equal("manufacturer name"))
+		})
+
+		It("should keep fields not in the patch and remove the empty ones", func() {
+			device.Overrides = &models.DeviceOverrides{Name: "Bedroom AC", Icon: "air-conditioner"}
+			empty := ""
+			overrides, err := PatchDeviceOverrides(&device, &models.DeviceOverridesPatch{Icon: &empty})
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(overrides).To(Equal(models.DeviceOverrides{Name: "Bedroom AC"}))
+			Expect(overrides.IsEmpty()).To(BeFalse())
+		})
+
+		It("should merge feature overrides in the order of device features", func() {
+			label := "Target"
+			order := 0
+			hidden := true
+			device.Overrides = &models.DeviceOverrides{
+				Features: []models.FeatureOverride{{FeatureUUID: featureUUID1, Label: "Old"}},
+			}
+			overrides, err := PatchDeviceOverrides(&device, &models.DeviceOverridesPatch{
+				Features: []models.FeatureOverridePatch{
+					{FeatureUUID: featureUUID2, Hidden: &hidden},
+					{FeatureUUID: featureUUID1, Order: &order},
+				},
+			})
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(overrides.Features).To(Equal([]models.FeatureOverride{
+				{FeatureUUID: featureUUID1, Label: "Old", Order: &order},
+				{FeatureUUID: featureUUID2, Hidden: true},
+			}))
+
+			overrides, err = PatchDeviceOverrides(&device, &models.DeviceOverridesPatch{
+				Features: []models.FeatureOverridePatch{{FeatureUUID: featureUUID1, Label: &label}},
+			})
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(overrides.Features).To(Equal([]models.FeatureOverride{{FeatureUUID: featureUUID1, Label: label}}))
+		})
+
+		It("should drop feature overrides without values", func() {
+			order := 3
+			resetOrder := -1
+			empty := ""
+			device.Overrides = &models.DeviceOverrides{
+				Features: []models.FeatureOverride{{FeatureUUID: featureUUID1, Label: "Target", Order: &order}},
+			}
+			overrides, err := PatchDeviceOverrides(&device, &models.DeviceOverridesPatch{
+				Features: []models.FeatureOverridePatch{{FeatureUUID: featureUUID1, Label: &empty, Order: &resetOrder}},
+			})
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(overrides.Features).To(BeEmpty())
+			Expect(overrides.IsEmpty()).To(BeTrue())
+		})
+
+		It("should return an error, if a feature is not in the device", func() {
+			hidden := true
+			_, err := PatchDeviceOverrides(&device, &models.DeviceOverridesPatch{
+				Features: []models.FeatureOverridePatch{{FeatureUUID: uuid.NewString(), Hidden: &hidden}},
+			})
+			Expect(err).To(MatchError(ErrFeatureNotInDevice))
+		})
+	})
+})
@@ -0,0 +1,23 @@
+package utils
+
+import "strings"
+
+// NormalizeEmail returns email in the form used to compare emails, trimmed and in lower case
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// ParseEmailList returns the normalized emails of a comma-separated list, without empty and duplicated ones
+func ParseEmailList(emails string) []string {
+	result := make([]string, 0)
+	for _, email := range strings.Split(emails, ",") {
+		email = NormalizeEmail(email)
+		if email == "" {
+			continue
+		}
+		if _, found := Find(result, email); !found {
+			result = append(result, email)
+		}
+	}
+	return result
+}
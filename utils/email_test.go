@@ -0,0 +1,25 @@
+package utils
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("using email utils", func() {
+	When("calling ParseEmailList", func() {
+		It("should return normalized emails", func() {
+			Expect(ParseEmailList(" Test@Test.com, other@test.com ,,test@test.com")).To(Equal([]string{"test@test.com", "other@test.com"}))
+		})
+
+		It("should return an empty list", func() {
+			Expect(ParseEmailList("")).To(BeEmpty())
+			Expect(ParseEmailList(" , ")).To(BeEmpty())
+		})
+	})
+
+	When("calling NormalizeEmail", func() {
+		It("should trim the email and convert it to lower case", func() {
+			Expect(NormalizeEmail("  Test@Test.COM ")).To(Equal("test@test.com"))
+		})
+	})
+})
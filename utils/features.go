@@ -1,6 +1,11 @@
 package utils
 
-import "api-server/models"
+import (
+	"api-server/models"
+	"fmt"
+	"math"
+	"strconv"
+)
 
 func HasControllerFeature(features []models.Feature) bool {
 	for _, feature := range features {
@@ -28,3 +33,61 @@ func GetOnlineFeature(features []models.Feature) *models.Feature {
 	}
 	return nil
 }
+
+// ValidateSpecValue checks that value satisfies spec, returning an error describing the first violated constraint.
+// Min, Max and Step are optional, so they are checked only if defined.
+func ValidateSpecValue(spec models.Spec, value float32) error {
+	v := float64(value)
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return fmt.Errorf("value must be a finite number")
+	}
+
+	switch spec.Format {
+	case models.Bool:
+		if v != 0 && v != 1 {
+			return fmt.Errorf("value must be 0 or 1")
+		}
+	case models.Int:
+		if v != math.Trunc(v) {
+			return fmt.Errorf("value must be an integer")
+		}
+	case models.List:
+		found := false
+		for _, item := range spec.List {
+			if item.Value == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("value is not one of the allowed values")
+		}
+	}
+
+	// bounds are compared as float32, like value, so a value sent exactly at a decimal bound is accepted
+	if spec.Min != nil && value < float32(*spec.Min) {
+		return fmt.Errorf("value must be greater than or equal to %s", formatSpecNumber(*spec.Min))
+	}
+	if spec.Max != nil && value > float32(*spec.Max) {
+		return fmt.Errorf("value must be less than or equal to %s", formatSpecNumber(*spec.Max))
+	}
+	if spec.Step != nil && *spec.Step > 0 {
+		// the step grid starts from Min, if defined
+		var base float64
+		if spec.Min != nil {
+			base = *spec.Min
+		}
+		// the nearest point of the grid is compared as float32, like bounds, so the tolerance
+		// scales with the magnitude of value instead of being a fixed fraction of the step
+		step := *spec.Step
+		nearest := base + math.Round((v-base)/step)*step
+		if float32(nearest) != value {
+			return fmt.Errorf("value must be a multiple of %s", formatSpecNumber(*spec.Step))
+		}
+	}
+	return nil
+}
+
+func formatSpecNumber(n float64) string {
+	return strconv.FormatFloat(n, 'f', -1, 64)
+}
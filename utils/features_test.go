@@ -132,4 +132,72 @@ var _ = Describe("using feature utils", func() {
 			Expect(onlineFeatureFound).To(BeNil())
 		})
 	})
+
+	When("calling ValidateSpecValue", func() {
+		min := 16.0
+		max := 30.0
+		step := 0.5
+		floatSpec := models.Spec{Format: models.Float, Min: &min, Max: &max, Step: &step}
+
+		It("should accept a value inside range and on the step grid", func() {
+			Expect(ValidateSpecValue(floatSpec, 22.5)).To(Succeed())
+			Expect(ValidateSpecValue(floatSpec, 16)).To(Succeed())
+			Expect(ValidateSpecValue(floatSpec, 30)).To(Succeed())
+		})
+		It("should reject values outside range", func() {
+			Expect(ValidateSpecValue(floatSpec, 15.5)).To(MatchError("value must be greater than or equal to 16"))
+			Expect(ValidateSpecValue(floatSpec, 31)).To(MatchError("value must be less than or equal to 30"))
+		})
+		It("should reject values not on the step grid", func() {
+			Expect(ValidateSpecValue(floatSpec, 22.3)).To(MatchError("value must be a multiple of 0.5"))
+		})
+		It("should tolerate float32 rounding on decimal steps", func() {
+			decimalStep := 0.1
+			Expect(ValidateSpecValue(models.Spec{Format: models.Float, Step: &decimalStep}, 22.1)).To(Succeed())
+		})
+		DescribeTable("should check the step grid on the float32 scale of large values",
+			func(max, step float64, value float32, valid bool) {
+				zero := 0.0
+				err := ValidateSpecValue(models.Spec{Format: models.Float, Min: &zero, Max: &max, Step: &step}, value)
+				if valid {
+					Expect(err).To(Succeed())
+				} else {
+					Expect(err).To(MatchError("value must be a multiple of " + formatSpecNumber(step)))
+				}
+			},
+			Entry("at max", 100000.0, 0.01, float32(100000), true),
+			Entry("just below max", 100000.0, 0.01, float32(99999.99), true),
+			Entry("in the middle of the range", 100000.0, 0.01, float32(12345.67), true),
+			Entry("on a quarter step", 1000000.0, 0.25, float32(999999.75), true),
+			Entry("between quarter steps", 1000000.0, 0.25, float32(999999.1), false),
+		)
+		It("should accept values exactly at decimal bounds", func() {
+			decimalMin := 30.3
+			decimalMax := 35.7
+			decimalSpec := models.Spec{Format: models.Float, Min: &decimalMin, Max: &decimalMax}
+			Expect(ValidateSpecValue(decimalSpec, 30.3)).To(Succeed())
+			Expect(ValidateSpecValue(decimalSpec, 35.7)).To(Succeed())
+			Expect(ValidateSpecValue(decimalSpec, 30.2)).To(MatchError("value must be greater than or equal to 30.3"))
+		})
+		It("should reject non integer values for int specs", func() {
+			Expect(ValidateSpecValue(models.Spec{Format: models.Int}, 3)).To(Succeed())
+			Expect(ValidateSpecValue(models.Spec{Format: models.Int}, 3.2)).To(MatchError("value must be an integer"))
+		})
+		It("should accept only 0 and 1 for bool specs", func() {
+			Expect(ValidateSpecValue(models.Spec{Format: models.Bool}, 0)).To(Succeed())
+			Expect(ValidateSpecValue(models.Spec{Format: models.Bool}, 1)).To(Succeed())
+			Expect(ValidateSpecValue(models.Spec{Format: models.Bool}, 2)).To(MatchError("value must be 0 or 1"))
+		})
+		It("should accept only listed values for list specs", func() {
+			listSpec := models.Spec{Format: models.List, List: []models.SpecListItem{
+				{Value: 1, Text: "cool"},
+				{Value: 2, Text: "heat"},
+			}}
+			Expect(ValidateSpecValue(listSpec, 2)).To(Succeed())
+			Expect(ValidateSpecValue(listSpec, 3)).To(MatchError("value is not one of the allowed values"))
+		})
+		It("should accept every value if spec has no constraints", func() {
+			Expect(ValidateSpecValue(models.Spec{}, 22.45)).To(Succeed())
+		})
+	})
 })
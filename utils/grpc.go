@@ -1,50 +1,87 @@
 package utils
 
 import (
-	"api-server/customerrors"
 	"crypto/tls"
 	"crypto/x509"
+	"errors"
 	"fmt"
-	"net/http"
 	"os"
+	"path/filepath"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
 )
 
-func BuildSecurityDialOption() (grpc.DialOption, bool, error) {
-	var securityDialOption grpc.DialOption
-	if os.Getenv("GRPC_TLS") == "true" {
-		tlsCredentials, errTLS := LoadTLSCredentials()
-		if errTLS != nil {
-			return nil, false, customerrors.Wrap(http.StatusInternalServerError, errTLS, "loadTLSCredentials cannot read certificates")
-		}
-		securityDialOption = grpc.WithTransportCredentials(tlsCredentials)
-		return securityDialOption, true, nil
+// GrpcTransportConfig is the transport security of calls to api-devices.
+// Certificates are PEM files inside CertFolderPath:
+// ca-cert.pem to verify the server and, with mutual TLS, client-cert.pem and client-key.pem.
+type GrpcTransportConfig struct {
+	TLS            bool
+	MutualTLS      bool
+	CertFolderPath string
+	// ServerName overrides the name used to verify the server certificate, if not empty
+	ServerName string
+}
+
+// GrpcTransportConfigFromEnv reads the configuration from GRPC_TLS, GRPC_MTLS,
+// CERT_FOLDER_PATH and GRPC_TLS_SERVER_NAME environment variables.
+func GrpcTransportConfigFromEnv() GrpcTransportConfig {
+	return GrpcTransportConfig{
+		TLS:            os.Getenv("GRPC_TLS") == "true",
+		MutualTLS:      os.Getenv("GRPC_MTLS") == "true",
+		CertFolderPath: os.Getenv("CERT_FOLDER_PATH"),
+		ServerName:     os.Getenv("GRPC_TLS_SERVER_NAME"),
 	}
+}
 
-	// if security is not enabled, use the insecure version
-	securityDialOption = grpc.WithTransportCredentials(insecure.NewCredentials())
-	return securityDialOption, false, nil
+// BuildSecurityDialOption returns the transport credentials dial option of config.
+// Certificates are read immediately, so invalid configurations fail at startup.
+func BuildSecurityDialOption(config GrpcTransportConfig) (grpc.DialOption, error) {
+	if !config.TLS {
+		if config.MutualTLS {
+			return nil, errors.New("'GRPC_MTLS' requires 'GRPC_TLS' to be enabled")
+		}
+		// if security is not enabled, use the insecure version
+		return grpc.WithTransportCredentials(insecure.NewCredentials()), nil
+	}
+	tlsCredentials, err := LoadTLSCredentials(config)
+	if err != nil {
+		return nil, err
+	}
+	return grpc.WithTransportCredentials(tlsCredentials), nil
 }
 
-func LoadTLSCredentials() (credentials.TransportCredentials, error) {
+// LoadTLSCredentials builds TLS credentials from the certificates of config.
+func LoadTLSCredentials(config GrpcTransportConfig) (credentials.TransportCredentials, error) {
 	// Load certificate of the CA who signed server's certificate
-	pemServerCA, err := os.ReadFile(os.Getenv("CERT_FOLDER_PATH") + "/ca-cert.pem")
+	caPath := filepath.Join(config.CertFolderPath, "ca-cert.pem")
+	pemServerCA, err := os.ReadFile(caPath)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("cannot read CA certificate: %w", err)
 	}
 
 	certPool := x509.NewCertPool()
 	if !certPool.AppendCertsFromPEM(pemServerCA) {
-		return nil, fmt.Errorf("failed to add server CA's certificate")
+		return nil, fmt.Errorf("failed to add server CA's certificate from %s", caPath)
 	}
 
 	// Create the credentials and return it
-	config := &tls.Config{
-		RootCAs: certPool,
+	tlsConfig := &tls.Config{
+		RootCAs:    certPool,
+		ServerName: config.ServerName,
+		MinVersion: tls.VersionTLS12,
+	}
+	if config.MutualTLS {
+		clientCert, err := tls.LoadX509KeyPair(
+			filepath.Join(config.CertFolderPath, "client-cert.pem"),
+			filepath.Join(config.CertFolderPath, "client-key.pem"),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{clientCert}
 	}
 
-	return credentials.NewTLS(config), nil
+	return credentials.NewTLS(tlsConfig), nil
 }
@@ -0,0 +1,91 @@
+package utils
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// writeSelfSignedCert writes a self-signed certificate and its key as PEM files in folder
+func writeSelfSignedCert(folder, certName, keyName string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).ShouldNot(HaveOccurred())
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "api-devices"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	Expect(err).ShouldNot(HaveOccurred())
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	Expect(err).ShouldNot(HaveOccurred())
+	err = os.WriteFile(filepath.Join(folder, certName), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)
+	Expect(err).ShouldNot(HaveOccurred())
+	if keyName != "" {
+		err = os.WriteFile(filepath.Join(folder, keyName), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0o600)
+		Expect(err).ShouldNot(HaveOccurred())
+	}
+}
+
+var _ = Describe("using grpc utils", func() {
+	var certFolder string
+
+	BeforeEach(func() {
+		certFolder = GinkgoT().TempDir()
+	})
+
+	When("calling BuildSecurityDialOption", func() {
+		It("should return insecure credentials, if TLS is disabled", func() {
+			option, err := BuildSecurityDialOption(GrpcTransportConfig{})
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(option).ToNot(BeNil())
+		})
+
+		It("should fail with mutual TLS, if TLS is disabled", func() {
+			_, err := BuildSecurityDialOption(GrpcTransportConfig{MutualTLS: true})
+			Expect(err).Should(HaveOccurred())
+		})
+
+		It("should load the CA certificate with TLS", func() {
+			writeSelfSignedCert(certFolder, "ca-cert.pem", "")
+			option, err := BuildSecurityDialOption(GrpcTransportConfig{TLS: true, CertFolderPath: certFolder, ServerName: "api-devices"})
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(option).ToNot(BeNil())
+		})
+
+		It("should fail with TLS, if the CA certificate is missing or not valid", func() {
+			_, err := BuildSecurityDialOption(GrpcTransportConfig{TLS: true, CertFolderPath: certFolder})
+			Expect(err).Should(HaveOccurred())
+
+			err = os.WriteFile(filepath.Join(certFolder, "ca-cert.pem"), []byte("not a certificate"), 0o600)
+			Expect(err).ShouldNot(HaveOccurred())
+			_, err = BuildSecurityDialOption(GrpcTransportConfig{TLS: true, CertFolderPath: certFolder})
+			Expect(err).Should(HaveOccurred())
+		})
+
+		It("should load the client certificate with mutual TLS", func() {
+			writeSelfSignedCert(certFolder, "ca-cert.pem", "")
+			config := GrpcTransportConfig{TLS: true, MutualTLS: true, CertFolderPath: certFolder}
+			_, err := BuildSecurityDialOption(config)
+			Expect(err).Should(HaveOccurred())
+
+			writeSelfSignedCert(certFolder, "client-cert.pem", "client-key.pem")
+			option, err := BuildSecurityDialOption(config)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(option).ToNot(BeNil())
+		})
+	})
+})
@@ -0,0 +1,56 @@
+package utils
+
+import (
+	"api-server/models"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+var homeRoleRanks = map[models.HomeRole]int{
+	models.HomeRoleGuest:  1,
+	models.HomeRoleMember: 2,
+	models.HomeRoleAdmin:  3,
+	models.HomeRoleOwner:  4,
+}
+
+// IsValidHomeRole reports whether role is one of the supported home roles.
+func IsValidHomeRole(role models.HomeRole) bool {
+	_, found := homeRoleRanks[role]
+	return found
+}
+
+// HasHomeRole reports whether role grants at least the permissions of required.
+func HasHomeRole(role, required models.HomeRole) bool {
+	rank, found := homeRoleRanks[role]
+	if !found {
+		return false
+	}
+	return rank >= homeRoleRanks[required]
+}
+
+// CanGrantHomeRole reports whether a member with role can assign target to
+// another member. Only the owner can grant admin, and nobody can grant owner.
+func CanGrantHomeRole(role, target models.HomeRole) bool {
+	if !IsValidHomeRole(target) || target == models.HomeRoleOwner {
+		return false
+	}
+	if role == models.HomeRoleOwner {
+		return true
+	}
+	return HasHomeRole(role, models.HomeRoleAdmin) && homeRoleRanks[target] < homeRoleRanks[role]
+}
+
+// GetHomeRole returns the role of profileID in home.
+// Homes created before members were introduced have no members list:
+// in that case the profile referencing the home in its homes list is its owner.
+func GetHomeRole(home *models.Home, profileID bson.ObjectID, profileHomes []bson.ObjectID) (models.HomeRole, bool) {
+	for _, member := range home.Members {
+		if member.ProfileID == profileID {
+			return member.Role, true
+		}
+	}
+	if len(home.Members) == 0 && Contains(profileHomes, home.ID) {
+		return models.HomeRoleOwner, true
+	}
+	return "", false
+}
@@ -0,0 +1,72 @@
+package utils
+
+import (
+	"api-server/models"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+var _ = Describe("using home access utils", func() {
+	When("calling HasHomeRole", func() {
+		It("should return true if role is equal or higher than the required one", func() {
+			Expect(HasHomeRole(models.HomeRoleOwner, models.HomeRoleAdmin)).To(BeTrue())
+			Expect(HasHomeRole(models.HomeRoleAdmin, models.HomeRoleAdmin)).To(BeTrue())
+			Expect(HasHomeRole(models.HomeRoleMember, models.HomeRoleGuest)).To(BeTrue())
+		})
+		It("should return false if role is lower than the required one or unknown", func() {
+			Expect(HasHomeRole(models.HomeRoleGuest, models.HomeRoleMember)).To(BeFalse())
+			Expect(HasHomeRole(models.HomeRoleMember, models.HomeRoleAdmin)).To(BeFalse())
+			Expect(HasHomeRole("unknown", models.HomeRoleGuest)).To(BeFalse())
+		})
+	})
+
+	When("calling CanGrantHomeRole", func() {
+		It("should allow the owner to grant every role except owner", func() {
+			Expect(CanGrantHomeRole(models.HomeRoleOwner, models.HomeRoleAdmin)).To(BeTrue())
+			Expect(CanGrantHomeRole(models.HomeRoleOwner, models.HomeRoleGuest)).To(BeTrue())
+			Expect(CanGrantHomeRole(models.HomeRoleOwner, models.HomeRoleOwner)).To(BeFalse())
+		})
+		It("should allow an admin to grant only lower roles", func() {
+			Expect(CanGrantHomeRole(models.HomeRoleAdmin, models.HomeRoleMember)).To(BeTrue())
+			Expect(CanGrantHomeRole(models.HomeRoleAdmin, models.HomeRoleGuest)).To(BeTrue())
+			Expect(CanGrantHomeRole(models.HomeRoleAdmin, models.HomeRoleAdmin)).To(BeFalse())
+		})
+		It("should not allow members and guests to grant roles", func() {
+			Expect(CanGrantHomeRole(models.HomeRoleMember, models.HomeRoleGuest)).To(BeFalse())
+			Expect(CanGrantHomeRole(models.HomeRoleGuest, models.HomeRoleGuest)).To(BeFalse())
+		})
+	})
+
+	When("calling GetHomeRole", func() {
+		profileID := bson.NewObjectID()
+
+		It("should return the role of a member", func() {
+			home := models.Home{
+				ID: bson.NewObjectID(),
+				Members: []models.HomeMember{
+					{ProfileID: bson.NewObjectID(), Role: models.HomeRoleOwner},
+					{ProfileID: profileID, Role: models.HomeRoleGuest},
+				},
+			}
+			role, found := GetHomeRole(&home, profileID, []bson.ObjectID{})
+			Expect(found).To(BeTrue())
+			Expect(role).To(Equal(models.HomeRoleGuest))
+		})
+		It("should return owner for a legacy home without members listed in the profile", func() {
+			home := models.Home{ID: bson.NewObjectID()}
+			role, found := GetHomeRole(&home, profileID, []bson.ObjectID{home.ID})
+			Expect(found).To(BeTrue())
+			Expect(role).To(Equal(models.HomeRoleOwner))
+		})
+		It("should fail if profile is not a member", func() {
+			home := models.Home{
+				ID:      bson.NewObjectID(),
+				Members: []models.HomeMember{{ProfileID: bson.NewObjectID(), Role: models.HomeRoleOwner}},
+			}
+			_, found := GetHomeRole(&home, profileID, []bson.ObjectID{home.ID})
+			Expect(found).To(BeFalse())
+		})
+	})
+})
@@ -0,0 +1,206 @@
+package utils
+
+import (
+	"api-server/models"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+// ErrHomeConfigNotValid is returned when a HomeConfig cannot be applied to a home
+var ErrHomeConfigNotValid = errors.New("home configuration is not valid")
+
+// HomeConfigPlan is how a HomeConfig is applied to a home
+type HomeConfigPlan struct {
+	// Rooms replace the rooms of the home, keeping ids of rooms with the same name
+	Rooms []models.Room
+	// DeviceIDs are the devices assigned by the configuration, to remove from rooms of other homes
+	DeviceIDs []bson.ObjectID
+	// DeviceNames are the new names of renamed devices, that override the names reported by them
+	DeviceNames map[bson.ObjectID]string
+	Diff        models.HomeConfigDiff
+}
+
+// ExportHomeConfig returns the configuration of home. devices are used to identify devices in its rooms
+// by MAC and UUID, devices not found there are left out.
+func ExportHomeConfig(home *models.Home, devices []models.Device) models.HomeConfig {
+	devicesByID := make(map[bson.ObjectID]models.Device, len(devices))
+	for _, device := range devices {
+		devicesByID[device.ID] = device
+	}
+	config := models.HomeConfig{
+		Version: models.HomeConfigVersion,
+		Rooms:   make([]models.HomeConfigRoom, 0, len(home.Rooms)),
+	}
+	for _, room := range home.Rooms {
+		configRoom := models.HomeConfigRoom{
+			Name:    room.Name,
+			Floor:   room.Floor,
+			Devices: make([]models.HomeConfigDevice, 0, len(room.Devices)),
+		}
+		for _, deviceID := range room.Devices {
+			device, found := devicesByID[deviceID]
+			if !found {
+				continue
+			}
+			configRoom.Devices = append(configRoom.Devices, models.HomeConfigDevice{
+				MAC:  device.Mac,
+				UUID: device.UUID,
+				Name: device.DisplayName(),
+			})
+		}
+		config.Rooms = append(config.Rooms, configRoom)
+	}
+	return config
+}
+
+// PlanHomeConfig computes how to apply config to home, so that home has exactly the rooms of config
+// with the devices assigned to them. Rooms are matched by name and devices by UUID or MAC
+// among devices, the ones that can be assigned to home. Errors wrap ErrHomeConfigNotValid.
+func PlanHomeConfig(home *models.Home, devices []models.Device, config *models.HomeConfig, now time.Time) (HomeConfigPlan, error) {
+	if config.Version != models.HomeConfigVersion {
+		return HomeConfigPlan{}, fmt.Errorf("%w: version %d is not supported", ErrHomeConfigNotValid, config.Version)
+	}
+
+	devicesByKey := make(map[string]models.Device, 2*len(devices))
+	for _, device := range devices {
+		if device.UUID != "" {
+			devicesByKey["uuid:"+strings.ToLower(device.UUID)] = device
+		}
+		if device.Mac != "" {
+			devicesByKey["mac:"+strings.ToLower(device.Mac)] = device
+		}
+	}
+	currentRooms := make(map[bson.ObjectID]string)
+	existingRooms := make(map[string][]models.Room)
+	for _, room := range home.Rooms {
+		for _, deviceID := range room.Devices {
+			currentRooms[deviceID] = room.Name
+		}
+		existingRooms[room.Name] = append(existingRooms[room.Name], room)
+	}
+
+	plan := HomeConfigPlan{
+		Rooms:       make([]models.Room, 0, len(config.Rooms)),
+		DeviceIDs:   make([]bson.ObjectID, 0),
+		DeviceNames: make(map[bson.ObjectID]string),
+		Diff: models.HomeConfigDiff{
+			RoomsCreated:      []string{},
+			RoomsUpdated:      []string{},
+			RoomsDeleted:      []string{},
+			DevicesAssigned:   []models.HomeConfigDeviceChange{},
+			DevicesUnassigned: []models.HomeConfigDeviceChange{},
+			DevicesRenamed:    []models.HomeConfigDeviceChange{},
+		},
+	}
+	roomNames := make(map[string]bool)
+	assigned := make(map[bson.ObjectID]bool)
+
+	for _, configRoom := range config.Rooms {
+		if roomNames[configRoom.Name] {
+			return HomeConfigPlan{}, fmt.Errorf("%w: room '%s' is defined more than once", ErrHomeConfigNotValid, configRoom.Name)
+		}
+		roomNames[configRoom.Name] = true
+
+		var room models.Room
+		if candidates := existingRooms[configRoom.Name]; len(candidates) > 0 {
+			room = candidates[0]
+			existingRooms[configRoom.Name] = candidates[1:]
+			if room.Floor != configRoom.Floor {
+				room.Floor = configRoom.Floor
+				room.ModifiedAt = now
+				plan.Diff.RoomsUpdated = append(plan.Diff.RoomsUpdated, room.Name)
+			}
+		} else {
+			room = models.Room{
+				ID:         bson.NewObjectID(),
+				Name:       configRoom.Name,
+				Floor:      configRoom.Floor,
+				CreatedAt:  now,
+				ModifiedAt: now,
+			}
+			plan.Diff.RoomsCreated = append(plan.Diff.RoomsCreated, room.Name)
+		}
+
+		room.Devices = make([]bson.ObjectID, 0, len(configRoom.Devices))
+		for _, configDevice := range configRoom.Devices {
+			device, found := findHomeConfigDevice(devicesByKey, configDevice)
+			if !found {
+				return HomeConfigPlan{}, fmt.Errorf("%w: device %s is not one of your devices or of this home",
+					ErrHomeConfigNotValid, homeConfigDeviceKey(configDevice))
+			}
+			if assigned[device.ID] {
+				return HomeConfigPlan{}, fmt.Errorf("%w: device %s is assigned more than once",
+					ErrHomeConfigNotValid, homeConfigDeviceKey(configDevice))
+			}
+			assigned[device.ID] = true
+			room.Devices = append(room.Devices, device.ID)
+			plan.DeviceIDs = append(plan.DeviceIDs, device.ID)
+
+			if fromRoom, inHome := currentRooms[device.ID]; !inHome || fromRoom != room.Name {
+				plan.Diff.DevicesAssigned = append(plan.Diff.DevicesAssigned, models.HomeConfigDeviceChange{
+					MAC:      device.Mac,
+					UUID:     device.UUID,
+					FromRoom: fromRoom,
+					ToRoom:   room.Name,
+				})
+			}
+			if configDevice.Name != "" && configDevice.Name != device.DisplayName() {
+				plan.DeviceNames[device.ID] = configDevice.Name
+				plan.Diff.DevicesRenamed = append(plan.Diff.DevicesRenamed, models.HomeConfigDeviceChange{
+					MAC:  device.Mac,
+					UUID: device.UUID,
+					Name: configDevice.Name,
+				})
+			}
+		}
+		plan.Rooms = append(plan.Rooms, room)
+	}
+
+	for _, room := range home.Rooms {
+		if unmatched := existingRooms[room.Name]; len(unmatched) > 0 && unmatched[0].ID == room.ID {
+			existingRooms[room.Name] = unmatched[1:]
+			plan.Diff.RoomsDeleted = append(plan.Diff.RoomsDeleted, room.Name)
+		}
+		for _, deviceID := range room.Devices {
+			if assigned[deviceID] {
+				continue
+			}
+			change := models.HomeConfigDeviceChange{FromRoom: room.Name}
+			if device, found := findDeviceByID(devices, deviceID); found {
+				change.MAC = device.Mac
+				change.UUID = device.UUID
+			}
+			plan.Diff.DevicesUnassigned = append(plan.Diff.DevicesUnassigned, change)
+		}
+	}
+	return plan, nil
+}
+
+func findHomeConfigDevice(devicesByKey map[string]models.Device, configDevice models.HomeConfigDevice) (models.Device, bool) {
+	if configDevice.UUID != "" {
+		device, found := devicesByKey["uuid:"+strings.ToLower(configDevice.UUID)]
+		return device, found
+	}
+	device, found := devicesByKey["mac:"+strings.ToLower(configDevice.MAC)]
+	return device, found
+}
+
+func findDeviceByID(devices []models.Device, deviceID bson.ObjectID) (models.Device, bool) {
+	for _, device := range devices {
+		if device.ID == deviceID {
+			return device, true
+		}
+	}
+	return models.Device{}, false
+}
+
+func homeConfigDeviceKey(configDevice models.HomeConfigDevice) string {
+	if configDevice.UUID != "" {
+		return "uuid " + configDevice.UUID
+	}
+	return "mac " + configDevice.MAC
+}
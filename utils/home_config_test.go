@@ -0,0 +1,102 @@
+package utils
+
+import (
+	"api-server/models"
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.mongodb.org/mongo-driver/v2/bson"
+)
+
+var _ = Describe("home config", func() {
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	lamp := models.Device{ID: bson.NewObjectID(), Mac: "AA:BB:CC:DD:EE:01", UUID: "8a4f7d2e-6a38-4b0e-9f0c-0d5c3b1e2a01", Name: "lamp"}
+	sensor := models.Device{ID: bson.NewObjectID(), Mac: "AA:BB:CC:DD:EE:02", UUID: "8a4f7d2e-6a38-4b0e-9f0c-0d5c3b1e2a02", Name: "sensor"}
+	devices := []models.Device{lamp, sensor}
+
+	var home models.Home
+	BeforeEach(func() {
+		home = models.Home{
+			ID: bson.NewObjectID(),
+			Rooms: []models.Room{
+				{ID: bson.NewObjectID(), Name: "kitchen", Floor: 0, Devices: []bson.ObjectID{lamp.ID}},
+				{ID: bson.NewObjectID(), Name: "bedroom", Floor: 1, Devices: []bson.ObjectID{sensor.ID}},
+			},
+		}
+	})
+
+	It("should export rooms with their devices", func() {
+		config := ExportHomeConfig(&home, devices)
+		Expect(config.Version).To(Equal(models.HomeConfigVersion))
+		Expect(config.Rooms).To(HaveLen(2))
+		Expect(config.Rooms[0].Name).To(Equal("kitchen"))
+		Expect(config.Rooms[0].Devices).To(Equal([]models.HomeConfigDevice{{MAC: lamp.Mac, UUID: lamp.UUID, Name: "lamp"}}))
+	})
+
+	It("should plan no changes for an exported configuration", func() {
+		config := ExportHomeConfig(&home, devices)
+		plan, err := PlanHomeConfig(&home, devices, &config, now)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(plan.Diff.IsEmpty()).To(BeTrue())
+		Expect(plan.Rooms[0].ID).To(Equal(home.Rooms[0].ID))
+		Expect(plan.Rooms[1].ID).To(Equal(home.Rooms[1].ID))
+	})
+
+	It("should export and compare names overridden by users", func() {
+		renamedLamp := lamp
+		renamedLamp.Overrides = &models.DeviceOverrides{Name: "main lamp"}
+		renamedDevices := []models.Device{renamedLamp, sensor}
+
+		config := ExportHomeConfig(&home, renamedDevices)
+		Expect(config.Rooms[0].Devices).To(Equal([]models.HomeConfigDevice{{MAC: lamp.Mac, UUID: lamp.UUID, Name: "main lamp"}}))
+		plan, err := PlanHomeConfig(&home, renamedDevices, &config, now)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(plan.Diff.IsEmpty()).To(BeTrue())
+	})
+
+	It("should plan created, updated and deleted rooms and moved devices", func() {
+		config := models.HomeConfig{
+			Version: models.HomeConfigVersion,
+			Rooms: []models.HomeConfigRoom{
+				{Name: "kitchen", Floor: 2, Devices: []models.HomeConfigDevice{}},
+				{Name: "living", Floor: 0, Devices: []models.HomeConfigDevice{
+					{MAC: "aa:bb:cc:dd:ee:01", Name: "main lamp"},
+				}},
+			},
+		}
+		plan, err := PlanHomeConfig(&home, devices, &config, now)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(plan.Diff.RoomsUpdated).To(Equal([]string{"kitchen"}))
+		Expect(plan.Diff.RoomsCreated).To(Equal([]string{"living"}))
+		Expect(plan.Diff.RoomsDeleted).To(Equal([]string{"bedroom"}))
+		Expect(plan.Diff.DevicesAssigned).To(Equal([]models.HomeConfigDeviceChange{
+			{MAC: lamp.Mac, UUID: lamp.UUID, FromRoom: "kitchen", ToRoom: "living"},
+		}))
+		Expect(plan.Diff.DevicesUnassigned).To(Equal([]models.HomeConfigDeviceChange{
+			{MAC: sensor.Mac, UUID: sensor.UUID, FromRoom: "bedroom"},
+		}))
+		Expect(plan.DeviceNames).To(Equal(map[bson.ObjectID]string{lamp.ID: "main lamp"}))
+		Expect(plan.DeviceIDs).To(Equal([]bson.ObjectID{lamp.ID}))
+		Expect(plan.Rooms).To(HaveLen(2))
+		Expect(plan.Rooms[0].Floor).To(Equal(2))
+		Expect(plan.Rooms[0].ModifiedAt).To(Equal(now))
+		Expect(plan.Rooms[1].Devices).To(Equal([]bson.ObjectID{lamp.ID}))
+	})
+
+	It("should return an error, if the configuration cannot be applied", func() {
+		for _, config := range []models.HomeConfig{
+			{Version: 2, Rooms: []models.HomeConfigRoom{}},
+			{Version: 1, Rooms: []models.HomeConfigRoom{{Name: "a"}, {Name: "a"}}},
+			{Version: 1, Rooms: []models.HomeConfigRoom{{Name: "a", Devices: []models.HomeConfigDevice{{MAC: "00:00:00:00:00:00"}}}}},
+			{Version: 1, Rooms: []models.HomeConfigRoom{
+				{Name: "a", Devices: []models.HomeConfigDevice{{UUID: lamp.UUID}}},
+				{Name: "b", Devices: []models.HomeConfigDevice{{MAC: lamp.Mac}}},
+			}},
+		} {
+			_, err := PlanHomeConfig(&home, devices, &config, now)
+			Expect(errors.Is(err, ErrHomeConfigNotValid)).To(BeTrue())
+		}
+	})
+})
@@ -3,6 +3,7 @@ package utils
 import (
 	"api-server/customerrors"
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"net/http"
@@ -17,7 +18,16 @@ var remoteHTTPClient = &http.Client{
 
 // Get function
 func Get(url string) (int, string, error) {
-	response, err := remoteHTTPClient.Get(url)
+	return GetWithContext(context.Background(), url)
+}
+
+// GetWithContext calls url like Get, but the request is canceled when ctx is done.
+func GetWithContext(ctx context.Context, url string) (int, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return -1, "", customerrors.Wrap(http.StatusInternalServerError, err, "Cannot create HTTP GET request")
+	}
+	response, err := remoteHTTPClient.Do(req)
 	if err != nil {
 		return -1, "", customerrors.Wrap(http.StatusInternalServerError, err, "Cannot call HTTP GET API of the remote service")
 	}
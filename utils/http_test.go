@@ -0,0 +1,52 @@
+package utils
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("using http utils", func() {
+	When("calling GetWithContext", func() {
+		var server *httptest.Server
+		var release chan struct{}
+
+		BeforeEach(func() {
+			release = make(chan struct{})
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/slow" {
+					select {
+					case <-release:
+					case <-r.Context().Done():
+					}
+				}
+				_, _ = w.Write([]byte(`{"value":1}`))
+			}))
+		})
+
+		AfterEach(func() {
+			close(release)
+			server.Close()
+		})
+
+		It("should return the response body", func() {
+			code, body, err := GetWithContext(context.Background(), server.URL+"/fast")
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(code).To(Equal(http.StatusOK))
+			Expect(body).To(Equal(`{"value":1}`))
+		})
+
+		It("should return an error as soon as ctx is done", func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			start := time.Now()
+			_, _, err := GetWithContext(ctx, server.URL+"/slow")
+			Expect(err).Should(HaveOccurred())
+			Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+		})
+	})
+})
@@ -0,0 +1,45 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// WriteCursorJSON writes the documents of cur to w as a JSON array, converting each one with convert.
+// Documents are decoded and encoded one at a time, so memory doesn't grow with the number of documents.
+// The cursor is closed when done.
+func WriteCursorJSON[T any](ctx context.Context, w io.Writer, cur *mongo.Cursor, convert func(T) any) error {
+	defer cur.Close(ctx)
+
+	if _, err := io.WriteString(w, "["); err != nil {
+		return err
+	}
+	first := true
+	for cur.Next(ctx) {
+		var doc T
+		if err := cur.Decode(&doc); err != nil {
+			return err
+		}
+		element, err := json.Marshal(convert(doc))
+		if err != nil {
+			return err
+		}
+		if !first {
+			if _, err = io.WriteString(w, ","); err != nil {
+				return err
+			}
+		}
+		first = false
+		if _, err = w.Write(element); err != nil {
+			return err
+		}
+	}
+	if err := cur.Err(); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "]")
+	return err
+}
@@ -0,0 +1,41 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+type streamedDoc struct {
+	Name   string `bson:"name"`
+	Secret string `bson:"secret"`
+}
+
+var _ = Describe("WriteCursorJSON", func() {
+	write := func(docs []any) string {
+		cur, err := mongo.NewCursorFromDocuments(docs, nil, nil)
+		Expect(err).ShouldNot(HaveOccurred())
+		var buf bytes.Buffer
+		err = WriteCursorJSON(context.Background(), &buf, cur, func(doc streamedDoc) any {
+			return map[string]string{"name": doc.Name}
+		})
+		Expect(err).ShouldNot(HaveOccurred())
+		return buf.String()
+	}
+
+	It("should write converted documents as a JSON array", func() {
+		out := write([]any{
+			bson.M{"name": "a", "secret": "s1"},
+			bson.M{"name": "b", "secret": "s2"},
+		})
+		Expect(out).To(MatchJSON(`[{"name":"a"},{"name":"b"}]`))
+	})
+
+	It("should write an empty array without documents", func() {
+		Expect(write([]any{})).To(Equal("[]"))
+	})
+})
@@ -2,7 +2,6 @@ package utils
 
 import (
 	"api-server/models"
-	"strconv"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -28,33 +27,34 @@ type JWTClaims struct {
 	Name       string    `json:"name"`
 	TokenType  TokenType `json:"tokenType"`
 	ClientType string    `json:"clientType"`
+	SessionID  string    `json:"sid,omitempty"`
 	jwt.RegisteredClaims
 }
 
 // CreateJWT builds and signs a local JWT for an authenticated profile.
-// The algorithm is intentionally fixed to HS512 so callers cannot accidentally
-// issue tokens with a weaker or inconsistent signing method. The token includes
+// The algorithm is the one of the signing key of jwtKeys, EdDSA or ES256, and its kid
+// is in the header, so verifiers can pick the public key from the JWKS. The token includes
 // issuer, audience, subject, issued-at, not-before, and expiry claims so
 // validation can reject tokens from the wrong context or outside their validity
-// window.
-func CreateJWT(profile models.Profile, expirationTime time.Time, tokenType TokenType, clientType string, jwtKey []byte) (string, error) {
+// window. sessionID binds the token to its refresh-token family, so clients can
+// recognize their current session.
+func CreateJWT(profile models.Profile, expirationTime time.Time, tokenType TokenType, clientType, sessionID string, jwtKeys *JWTKeySet) (string, error) {
 	now := time.Now().UTC()
 	claims := &JWTClaims{
 		ID:         profile.Github.ID,
 		ProfileID:  profile.ID.Hex(),
-		Name:       profile.Github.Name,
+		Name:       profile.MainIdentity().Name,
 		TokenType:  tokenType,
 		ClientType: clientType,
+		SessionID:  sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
 			Issuer:    JWTIssuer,
 			Audience:  jwt.ClaimStrings{JWTAudience},
-			Subject:   strconv.FormatInt(profile.Github.ID, 10),
+			Subject:   profile.ID.Hex(),
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 			IssuedAt:  jwt.NewNumericDate(now),
 			NotBefore: jwt.NewNumericDate(now),
 		},
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS512, claims)
-	signed, err := token.SignedString(jwtKey)
-	return signed, err
+	return jwtKeys.Sign(claims)
 }
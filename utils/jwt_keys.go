@@ -0,0 +1,253 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// jwtKeyIDPattern restricts key ids, because they come from file names and are published in the JWKS
+var jwtKeyIDPattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+
+// ephemeralJWTKey is generated once per process, so all the JWTKeySet loaded without keys folder agree
+var ephemeralJWTKey = sync.OnceValues(func() (*JWTKey, error) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("cannot generate ephemeral JWT key: %w", err)
+	}
+	kid, err := RandomString(16)
+	if err != nil {
+		return nil, fmt.Errorf("cannot generate ephemeral JWT key id: %w", err)
+	}
+	return &JWTKey{
+		ID:         "ephemeral-" + kid,
+		Method:     jwt.SigningMethodEdDSA,
+		PublicKey:  publicKey,
+		privateKey: privateKey,
+	}, nil
+})
+
+// JWTKeysConfig is the location of the keys signing and verifying JWTs.
+// Keys are PEM files named <kid>.pem inside KeysFolderPath:
+// PKCS#8 or SEC 1 private keys, Ed25519 for EdDSA or P-256 for ES256,
+// or PKIX public keys, to only verify tokens signed with a retired key.
+type JWTKeysConfig struct {
+	KeysFolderPath string
+	// SigningKeyID is the kid of the private key signing new tokens
+	SigningKeyID string
+	// AllowEphemeral generates an in-memory key when KeysFolderPath is empty,
+	// so tokens become invalid on restart. Never in production.
+	AllowEphemeral bool
+}
+
+// JWTKeysConfigFromEnv reads the configuration from JWT_KEYS_FOLDER_PATH, JWT_SIGNING_KEY_ID and ENV.
+func JWTKeysConfigFromEnv() JWTKeysConfig {
+	return JWTKeysConfig{
+		KeysFolderPath: strings.TrimSpace(os.Getenv("JWT_KEYS_FOLDER_PATH")),
+		SigningKeyID:   strings.TrimSpace(os.Getenv("JWT_SIGNING_KEY_ID")),
+		AllowEphemeral: os.Getenv("ENV") != "prod",
+	}
+}
+
+// JWTKey is a key of a JWTKeySet, identified by the kid header of tokens.
+type JWTKey struct {
+	ID        string
+	Method    jwt.SigningMethod
+	PublicKey crypto.PublicKey
+	// privateKey is nil for keys only verifying tokens
+	privateKey crypto.PrivateKey
+}
+
+// JWTKeySet signs tokens with one key and verifies them with all its keys.
+//
+// Keys are rotated without logging out users:
+//  1. add the new <kid>.pem to the keys folder of every instance and restart them,
+//     so they verify tokens of the new key and publish it in the JWKS.
+//  2. wait until verifiers caching the JWKS have refreshed it, then set JWT_SIGNING_KEY_ID to the new kid and restart.
+//  3. after the access token TTL, remove the old key file (or replace it by its public key to keep verifying).
+type JWTKeySet struct {
+	signingKey *JWTKey
+	keys       map[string]*JWTKey
+}
+
+// LoadJWTKeys reads the keys of config.
+// Keys are read immediately, so invalid configurations fail at startup.
+func LoadJWTKeys(config JWTKeysConfig) (*JWTKeySet, error) {
+	if config.KeysFolderPath == "" {
+		if !config.AllowEphemeral {
+			return nil, errors.New("'JWT_KEYS_FOLDER_PATH' environment variable is mandatory in production")
+		}
+		key, err := ephemeralJWTKey()
+		if err != nil {
+			return nil, err
+		}
+		return &JWTKeySet{signingKey: key, keys: map[string]*JWTKey{key.ID: key}}, nil
+	}
+
+	paths, err := filepath.Glob(filepath.Join(config.KeysFolderPath, "*.pem"))
+	if err != nil {
+		return nil, fmt.Errorf("cannot list JWT keys: %w", err)
+	}
+	keySet := &JWTKeySet{keys: make(map[string]*JWTKey, len(paths))}
+	for _, path := range paths {
+		key, errKey := readJWTKey(path)
+		if errKey != nil {
+			return nil, errKey
+		}
+		keySet.keys[key.ID] = key
+	}
+
+	signingKey, ok := keySet.keys[config.SigningKeyID]
+	if !ok {
+		return nil, fmt.Errorf("JWT signing key %q not found in %s", config.SigningKeyID, config.KeysFolderPath)
+	}
+	if signingKey.privateKey == nil {
+		return nil, fmt.Errorf("JWT signing key %q must be a private key", config.SigningKeyID)
+	}
+	keySet.signingKey = signingKey
+	return keySet, nil
+}
+
+// SigningKeyID returns the kid of the key signing new tokens
+func (ks *JWTKeySet) SigningKeyID() string {
+	return ks.signingKey.ID
+}
+
+// Sign signs claims with the signing key, adding its kid to the header
+func (ks *JWTKeySet) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(ks.signingKey.Method, claims)
+	token.Header["kid"] = ks.signingKey.ID
+	return token.SignedString(ks.signingKey.privateKey)
+}
+
+// Keyfunc returns the key verifying token, chosen by its kid header.
+// The algorithm of the token must be the one of the key, to prevent algorithm confusion.
+func (ks *JWTKeySet) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := ks.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %v for key %q", token.Header["alg"], kid)
+	}
+	return key.PublicKey, nil
+}
+
+// ValidMethods returns the algorithms of the keys, to pass them to jwt.WithValidMethods
+func (ks *JWTKeySet) ValidMethods() []string {
+	methods := []string{}
+	for _, key := range ks.keys {
+		if _, found := Find(methods, key.Method.Alg()); !found {
+			methods = append(methods, key.Method.Alg())
+		}
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+// JSONWebKey is the public part of a JWTKey, as defined by RFC 7517
+type JSONWebKey struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	Curve     string `json:"crv"`
+	X         string `json:"x"`
+	Y         string `json:"y,omitempty"`
+}
+
+// JWKS returns the public keys of the set, sorted by kid, to publish them at /.well-known/jwks.json
+func (ks *JWTKeySet) JWKS() []JSONWebKey {
+	jwks := make([]JSONWebKey, 0, len(ks.keys))
+	for _, key := range ks.keys {
+		jwk := JSONWebKey{KeyID: key.ID, Use: "sig", Algorithm: key.Method.Alg()}
+		switch publicKey := key.PublicKey.(type) {
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(publicKey)
+		case *ecdsa.PublicKey:
+			// uncompressed point: 0x04 || X || Y, with coordinates of 32 bytes for P-256
+			point, err := publicKey.Bytes()
+			if err != nil {
+				continue
+			}
+			jwk.KeyType = "EC"
+			jwk.Curve = "P-256"
+			jwk.X = base64.RawURLEncoding.EncodeToString(point[1:33])
+			jwk.Y = base64.RawURLEncoding.EncodeToString(point[33:])
+		}
+		jwks = append(jwks, jwk)
+	}
+	sort.Slice(jwks, func(i, j int) bool {
+		return jwks[i].KeyID < jwks[j].KeyID
+	})
+	return jwks
+}
+
+// ------------------------------ Private methods ------------------------------
+
+// readJWTKey reads a key from a PEM file, its kid is the file name without extension
+func readJWTKey(path string) (*JWTKey, error) {
+	kid := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	if !jwtKeyIDPattern.MatchString(kid) {
+		return nil, fmt.Errorf("JWT key file %s must be named <kid>.pem, with letters, digits, '_', '-' and '.'", path)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read JWT key: %w", err)
+	}
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return nil, fmt.Errorf("JWT key %s is not a PEM file", path)
+	}
+
+	var parsed any
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		parsed, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("JWT key %s has unsupported PEM type %q", path, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse JWT key %s: %w", path, err)
+	}
+
+	key := &JWTKey{ID: kid}
+	switch k := parsed.(type) {
+	case ed25519.PrivateKey:
+		key.Method, key.PublicKey, key.privateKey = jwt.SigningMethodEdDSA, k.Public(), k
+	case ed25519.PublicKey:
+		key.Method, key.PublicKey = jwt.SigningMethodEdDSA, k
+	case *ecdsa.PrivateKey:
+		key.Method, key.PublicKey, key.privateKey = jwt.SigningMethodES256, &k.PublicKey, k
+	case *ecdsa.PublicKey:
+		key.Method, key.PublicKey = jwt.SigningMethodES256, k
+	default:
+		return nil, fmt.Errorf("JWT key %s must be an Ed25519 or P-256 key", path)
+	}
+	if ecKey, ok := key.PublicKey.(*ecdsa.PublicKey); ok && ecKey.Curve != elliptic.P256() {
+		return nil, fmt.Errorf("JWT key %s must be an Ed25519 or P-256 key", path)
+	}
+	return key, nil
+}
@@ -0,0 +1,201 @@
+package utils
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// writePEM writes der as a PEM file called <kid>.pem in folder
+func writePEM(folder, kid, pemType string, der []byte) {
+	err := os.WriteFile(filepath.Join(folder, kid+".pem"), pem.EncodeToMemory(&pem.Block{Type: pemType, Bytes: der}), 0o600)
+	Expect(err).ShouldNot(HaveOccurred())
+}
+
+func writeEd25519Key(folder, kid string) ed25519.PublicKey {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	Expect(err).ShouldNot(HaveOccurred())
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	Expect(err).ShouldNot(HaveOccurred())
+	writePEM(folder, kid, "PRIVATE KEY", der)
+	return publicKey
+}
+
+func writeP256Key(folder, kid string) *ecdsa.PublicKey {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).ShouldNot(HaveOccurred())
+	der, err := x509.MarshalECPrivateKey(privateKey)
+	Expect(err).ShouldNot(HaveOccurred())
+	writePEM(folder, kid, "EC PRIVATE KEY", der)
+	return &privateKey.PublicKey
+}
+
+func testClaims() jwt.RegisteredClaims {
+	return jwt.RegisteredClaims{
+		Issuer:    JWTIssuer,
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+	}
+}
+
+func parseWith(keySet *JWTKeySet, token string) error {
+	_, err := jwt.ParseWithClaims(token, &jwt.RegisteredClaims{}, keySet.Keyfunc, jwt.WithValidMethods(keySet.ValidMethods()))
+	return err
+}
+
+var _ = Describe("using jwt keys utils", func() {
+	var keysFolder string
+
+	BeforeEach(func() {
+		keysFolder = GinkgoT().TempDir()
+	})
+
+	When("calling LoadJWTKeys", func() {
+		It("should sign with the signing key and verify with all keys", func() {
+			writeEd25519Key(keysFolder, "old")
+			writeP256Key(keysFolder, "new")
+			oldKeys, err := LoadJWTKeys(JWTKeysConfig{KeysFolderPath: keysFolder, SigningKeyID: "old"})
+			Expect(err).ShouldNot(HaveOccurred())
+			newKeys, err := LoadJWTKeys(JWTKeysConfig{KeysFolderPath: keysFolder, SigningKeyID: "new"})
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(newKeys.SigningKeyID()).To(Equal("new"))
+			Expect(newKeys.ValidMethods()).To(Equal([]string{"ES256", "EdDSA"}))
+
+			token, err := newKeys.Sign(testClaims())
+			Expect(err).ShouldNot(HaveOccurred())
+			parsed, _, err := jwt.NewParser().ParseUnverified(token, &jwt.RegisteredClaims{})
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(parsed.Header["kid"]).To(Equal("new"))
+			Expect(parsed.Method.Alg()).To(Equal("ES256"))
+			Expect(parseWith(newKeys, token)).To(Succeed())
+
+			// tokens signed before the rotation remain valid
+			oldToken, err := oldKeys.Sign(testClaims())
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(parseWith(newKeys, oldToken)).To(Succeed())
+		})
+
+		It("should verify with public keys", func() {
+			writeEd25519Key(keysFolder, "current")
+			otherFolder := GinkgoT().TempDir()
+			publicKey := writeEd25519Key(otherFolder, "retired")
+			otherKeys, err := LoadJWTKeys(JWTKeysConfig{KeysFolderPath: otherFolder, SigningKeyID: "retired"})
+			Expect(err).ShouldNot(HaveOccurred())
+			der, err := x509.MarshalPKIXPublicKey(publicKey)
+			Expect(err).ShouldNot(HaveOccurred())
+			writePEM(keysFolder, "retired", "PUBLIC KEY", der)
+
+			keySet, err := LoadJWTKeys(JWTKeysConfig{KeysFolderPath: keysFolder, SigningKeyID: "current"})
+			Expect(err).ShouldNot(HaveOccurred())
+			token, err := otherKeys.Sign(testClaims())
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(parseWith(keySet, token)).To(Succeed())
+
+			_, err = LoadJWTKeys(JWTKeysConfig{KeysFolderPath: keysFolder, SigningKeyID: "retired"})
+			Expect(err).Should(HaveOccurred())
+		})
+
+		It("should reject tokens of unknown keys or with the algorithm of another key", func() {
+			writeEd25519Key(keysFolder, "ed")
+			writeP256Key(keysFolder, "ec")
+			keySet, err := LoadJWTKeys(JWTKeysConfig{KeysFolderPath: keysFolder, SigningKeyID: "ed"})
+			Expect(err).ShouldNot(HaveOccurred())
+			token, err := keySet.Sign(testClaims())
+			Expect(err).ShouldNot(HaveOccurred())
+
+			otherFolder := GinkgoT().TempDir()
+			writeEd25519Key(otherFolder, "unknown")
+			otherKeys, err := LoadJWTKeys(JWTKeysConfig{KeysFolderPath: otherFolder, SigningKeyID: "unknown"})
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(parseWith(otherKeys, token)).Should(HaveOccurred())
+
+			// an EdDSA token claiming to be signed by the ES256 key
+			forged := jwt.NewWithClaims(jwt.SigningMethodEdDSA, testClaims())
+			forged.Header["kid"] = "ec"
+			_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+			Expect(err).ShouldNot(HaveOccurred())
+			forgedToken, err := forged.SignedString(privateKey)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(parseWith(keySet, forgedToken)).Should(HaveOccurred())
+
+			// HS256 tokens signed with a public key
+			hmacToken := jwt.NewWithClaims(jwt.SigningMethodHS256, testClaims())
+			hmacToken.Header["kid"] = "ed"
+			signed, err := hmacToken.SignedString([]byte("secret"))
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(parseWith(keySet, signed)).Should(HaveOccurred())
+		})
+
+		It("should return an error, if the signing key is missing", func() {
+			writeEd25519Key(keysFolder, "key1")
+			_, err := LoadJWTKeys(JWTKeysConfig{KeysFolderPath: keysFolder, SigningKeyID: "key2"})
+			Expect(err).Should(HaveOccurred())
+		})
+
+		It("should return an error, if a key is not supported", func() {
+			privateKey, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+			Expect(err).ShouldNot(HaveOccurred())
+			der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+			Expect(err).ShouldNot(HaveOccurred())
+			writePEM(keysFolder, "p384", "PRIVATE KEY", der)
+			_, err = LoadJWTKeys(JWTKeysConfig{KeysFolderPath: keysFolder, SigningKeyID: "p384"})
+			Expect(err).Should(HaveOccurred())
+		})
+
+		It("should use the same ephemeral key, if allowed without keys folder", func() {
+			keySet1, err := LoadJWTKeys(JWTKeysConfig{AllowEphemeral: true})
+			Expect(err).ShouldNot(HaveOccurred())
+			keySet2, err := LoadJWTKeys(JWTKeysConfig{AllowEphemeral: true})
+			Expect(err).ShouldNot(HaveOccurred())
+			token, err := keySet1.Sign(testClaims())
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(parseWith(keySet2, token)).To(Succeed())
+		})
+
+		It("should return an error without keys folder, if ephemeral keys are not allowed", func() {
+			_, err := LoadJWTKeys(JWTKeysConfig{})
+			Expect(err).Should(HaveOccurred())
+		})
+	})
+
+	When("calling JWKS", func() {
+		It("should return the public keys", func() {
+			edKey := writeEd25519Key(keysFolder, "ed")
+			ecKey := writeP256Key(keysFolder, "ec")
+			keySet, err := LoadJWTKeys(JWTKeysConfig{KeysFolderPath: keysFolder, SigningKeyID: "ed"})
+			Expect(err).ShouldNot(HaveOccurred())
+
+			jwks := keySet.JWKS()
+			Expect(jwks).To(HaveLen(2))
+			Expect(jwks[0].KeyID).To(Equal("ec"))
+			Expect(jwks[0].KeyType).To(Equal("EC"))
+			Expect(jwks[0].Algorithm).To(Equal("ES256"))
+			Expect(jwks[0].Curve).To(Equal("P-256"))
+			point, err := ecKey.Bytes()
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(jwks[0].X + jwks[0].Y).To(Equal(b64(point[1:33]) + b64(point[33:])))
+			Expect(jwks[1]).To(Equal(JSONWebKey{
+				KeyType:   "OKP",
+				KeyID:     "ed",
+				Use:       "sig",
+				Algorithm: "EdDSA",
+				Curve:     "Ed25519",
+				X:         b64(edKey),
+			}))
+		})
+	})
+})
+
+func b64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
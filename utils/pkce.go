@@ -67,10 +67,7 @@ func refreshTokenHashSecret() string {
 	if secret := os.Getenv("REFRESH_TOKEN_HASH_SECRET"); secret != "" {
 		return secret
 	}
-	if secret := os.Getenv("JWT_REFRESH_PASSWORD"); secret != "" {
-		return secret
-	}
-	return os.Getenv("JWT_PASSWORD")
+	return os.Getenv("JWT_REFRESH_PASSWORD")
 }
 
 // TruncateString returns input capped at maxLen bytes. Negative maxLen disables
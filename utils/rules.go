@@ -0,0 +1,40 @@
+package utils
+
+import "api-server/models"
+
+// EvaluateRuleCondition reports whether value satisfies cond and the next state of a rule, that was active or not.
+// A rule becomes active when its condition is met and it stays active until the value
+// goes back beyond the threshold by the hysteresis of the condition, to avoid flapping around it.
+func EvaluateRuleCondition(cond models.RuleCondition, active bool, value float64) (bool, bool) {
+	matched := compareRuleValue(cond.Operator, value, cond.Value)
+	if matched || !active {
+		return matched, matched
+	}
+	threshold := cond.Value
+	switch cond.Operator {
+	case models.RuleOperatorGt, models.RuleOperatorGte:
+		threshold -= cond.Hysteresis
+	case models.RuleOperatorLt, models.RuleOperatorLte:
+		threshold += cond.Hysteresis
+	}
+	return false, compareRuleValue(cond.Operator, value, threshold)
+}
+
+func compareRuleValue(operator models.RuleOperator, value, threshold float64) bool {
+	switch operator {
+	case models.RuleOperatorGt:
+		return value > threshold
+	case models.RuleOperatorGte:
+		return value >= threshold
+	case models.RuleOperatorLt:
+		return value < threshold
+	case models.RuleOperatorLte:
+		return value <= threshold
+	case models.RuleOperatorEq:
+		return value == threshold
+	case models.RuleOperatorNeq:
+		return value != threshold
+	default:
+		return false
+	}
+}
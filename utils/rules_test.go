@@ -0,0 +1,56 @@
+package utils
+
+import (
+	"api-server/models"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("using rules utils", func() {
+	When("calling EvaluateRuleCondition", func() {
+		It("should compare values with every operator", func() {
+			cases := []struct {
+				operator models.RuleOperator
+				value    float64
+				matched  bool
+			}{
+				{models.RuleOperatorGt, 26.5, true},
+				{models.RuleOperatorGt, 26, false},
+				{models.RuleOperatorGte, 26, true},
+				{models.RuleOperatorLt, 25.9, true},
+				{models.RuleOperatorLt, 26, false},
+				{models.RuleOperatorLte, 26, true},
+				{models.RuleOperatorEq, 26, true},
+				{models.RuleOperatorEq, 27, false},
+				{models.RuleOperatorNeq, 27, true},
+				{"unknown", 26, false},
+			}
+			for _, c := range cases {
+				matched, active := EvaluateRuleCondition(models.RuleCondition{Operator: c.operator, Value: 26}, false, c.value)
+				Expect(matched).To(Equal(c.matched), "operator = %s, value = %v", c.operator, c.value)
+				Expect(active).To(Equal(c.matched), "operator = %s, value = %v", c.operator, c.value)
+			}
+		})
+
+		It("should keep an active rule active inside the hysteresis band", func() {
+			cond := models.RuleCondition{Operator: models.RuleOperatorGt, Value: 26, Hysteresis: 1}
+			matched, active := EvaluateRuleCondition(cond, true, 25.5)
+			Expect(matched).To(BeFalse())
+			Expect(active).To(BeTrue())
+			matched, active = EvaluateRuleCondition(cond, true, 24.9)
+			Expect(matched).To(BeFalse())
+			Expect(active).To(BeFalse())
+			// inactive rules are not triggered inside the band
+			matched, active = EvaluateRuleCondition(cond, false, 25.5)
+			Expect(matched).To(BeFalse())
+			Expect(active).To(BeFalse())
+
+			cond = models.RuleCondition{Operator: models.RuleOperatorLt, Value: 18, Hysteresis: 0.5}
+			_, active = EvaluateRuleCondition(cond, true, 18.4)
+			Expect(active).To(BeTrue())
+			_, active = EvaluateRuleCondition(cond, true, 18.6)
+			Expect(active).To(BeFalse())
+		})
+	})
+})
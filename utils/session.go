@@ -3,6 +3,7 @@ package utils
 import (
 	"api-server/models"
 	"fmt"
+	"time"
 
 	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
@@ -12,7 +13,8 @@ import (
 
 // SessionProfile is the minimal identity reconstructed from primitive session
 // values. The session stores profileID and githubID separately to avoid gob
-// encoding custom structs into the cookie.
+// encoding custom structs into the cookie. GithubID is 0 for profiles
+// created with other identity providers.
 type SessionProfile struct {
 	ID       bson.ObjectID `json:"id"`
 	GithubID int64         `json:"githubId"`
@@ -32,7 +34,7 @@ func GetProfileFromSession(session sessions.Session) (SessionProfile, error) {
 	}
 
 	githubID, ok := session.Get("githubID").(int64)
-	if !ok || githubID == 0 {
+	if !ok {
 		return SessionProfile{}, fmt.Errorf("cannot find profile in session")
 	}
 
@@ -60,16 +62,57 @@ func GetProfileFromContext(c *gin.Context) (SessionProfile, error) {
 	if err != nil {
 		return SessionProfile{}, fmt.Errorf("invalid profile in jwt claims: %w", err)
 	}
-	if claims.ID == 0 {
-		return SessionProfile{}, fmt.Errorf("missing github id in jwt claims")
-	}
-
 	return SessionProfile{
 		ID:       profileID,
 		GithubID: claims.ID,
 	}, nil
 }
 
+// GetTokenExpirationFromContext returns the expiration time of the access token
+// validated by JWTMiddleware, e.g. to close long-lived responses when it expires.
+func GetTokenExpirationFromContext(c *gin.Context) (time.Time, error) {
+	value, exists := c.Get("jwt_claims")
+	if !exists {
+		return time.Time{}, fmt.Errorf("jwt claims not found in context")
+	}
+
+	claims, ok := value.(*JWTClaims)
+	if !ok || claims == nil || claims.ExpiresAt == nil {
+		return time.Time{}, fmt.Errorf("invalid jwt claims in context")
+	}
+	return claims.ExpiresAt.Time, nil
+}
+
+// GetSessionIDFromContext returns the refresh-token family of the access token
+// validated by JWTMiddleware, or an empty string if the token isn't bound to a session.
+func GetSessionIDFromContext(c *gin.Context) (string, error) {
+	value, exists := c.Get("jwt_claims")
+	if !exists {
+		return "", fmt.Errorf("jwt claims not found in context")
+	}
+
+	claims, ok := value.(*JWTClaims)
+	if !ok || claims == nil {
+		return "", fmt.Errorf("invalid jwt claims in context")
+	}
+	return claims.SessionID, nil
+}
+
+// GetClientTypeFromContext returns the client type of the access token validated by JWTMiddleware,
+// e.g. web, mobile, device or pat for personal access tokens.
+func GetClientTypeFromContext(c *gin.Context) (string, error) {
+	value, exists := c.Get("jwt_claims")
+	if !exists {
+		return "", fmt.Errorf("jwt claims not found in context")
+	}
+
+	claims, ok := value.(*JWTClaims)
+	if !ok || claims == nil {
+		return "", fmt.Errorf("invalid jwt claims in context")
+	}
+	return claims.ClientType, nil
+}
+
 // GetLoggedProfileFromContext loads the current profile from MongoDB using the
 // identity stored in JWT claims.
 func GetLoggedProfileFromContext(c *gin.Context, collection *mongo.Collection) (models.Profile, error) {
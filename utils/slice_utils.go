@@ -16,3 +16,13 @@ func Find[T comparable](slice []T, val T) (int, bool) {
 	}
 	return -1, false
 }
+
+func FilterSlice[T any](a []T, keep func(T) bool) []T {
+	n := make([]T, 0, len(a))
+	for _, e := range a {
+		if keep(e) {
+			n = append(n, e)
+		}
+	}
+	return n
+}
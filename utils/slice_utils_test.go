@@ -37,4 +37,14 @@ var _ = Describe("using slice utils", func() {
 			//Expect(found).To(BeTrue())
 		})
 	})
+
+	When("calling filterSlice", func() {
+		It("should return only elements matching the 'keep' function", func() {
+			slice := []int{1, 2, 3, 4}
+			filteredSlice := FilterSlice(slice, func(val int) bool {
+				return val%2 == 0
+			})
+			Expect(filteredSlice).To(Equal([]int{2, 4}))
+		})
+	})
 })
@@ -0,0 +1,44 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// TimeBucket is a fixed-size time interval used to aggregate time-series data.
+// Unit and BinSize can be passed directly to the MongoDB $dateTrunc operator.
+type TimeBucket struct {
+	Unit     string
+	BinSize  int64
+	Duration time.Duration
+}
+
+var timeBucketUnits = map[byte]struct {
+	unit     string
+	duration time.Duration
+}{
+	'm': {"minute", time.Minute},
+	'h': {"hour", time.Hour},
+	'd': {"day", 24 * time.Hour},
+}
+
+// ParseTimeBucket parses a bucket size like "5m", "1h" or "7d".
+func ParseTimeBucket(bucket string) (TimeBucket, error) {
+	if len(bucket) < 2 {
+		return TimeBucket{}, fmt.Errorf("invalid bucket '%s'", bucket)
+	}
+	unit, found := timeBucketUnits[bucket[len(bucket)-1]]
+	if !found {
+		return TimeBucket{}, fmt.Errorf("invalid bucket unit in '%s', use m, h or d", bucket)
+	}
+	binSize, err := strconv.ParseInt(bucket[:len(bucket)-1], 10, 64)
+	if err != nil || binSize <= 0 || binSize > 1000 {
+		return TimeBucket{}, fmt.Errorf("invalid bucket size in '%s'", bucket)
+	}
+	return TimeBucket{
+		Unit:     unit.unit,
+		BinSize:  binSize,
+		Duration: time.Duration(binSize) * unit.duration,
+	}, nil
+}
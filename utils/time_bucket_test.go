@@ -0,0 +1,32 @@
+package utils
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("using time bucket utils", func() {
+	When("calling ParseTimeBucket", func() {
+		It("should parse minutes, hours and days", func() {
+			bucket, err := ParseTimeBucket("15m")
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(bucket).To(Equal(TimeBucket{Unit: "minute", BinSize: 15, Duration: 15 * time.Minute}))
+
+			bucket, err = ParseTimeBucket("1h")
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(bucket).To(Equal(TimeBucket{Unit: "hour", BinSize: 1, Duration: time.Hour}))
+
+			bucket, err = ParseTimeBucket("7d")
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(bucket).To(Equal(TimeBucket{Unit: "day", BinSize: 7, Duration: 7 * 24 * time.Hour}))
+		})
+		It("should fail with unknown units or invalid sizes", func() {
+			for _, bucket := range []string{"", "h", "10s", "0m", "-1h", "xh", "1001d"} {
+				_, err := ParseTimeBucket(bucket)
+				Expect(err).Should(HaveOccurred(), "bucket = %s", bucket)
+			}
+		})
+	})
+})
@@ -0,0 +1,53 @@
+package utils
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// userCodeAlphabet has no vowels, to avoid words, and no characters looking alike, e.g. 0 and O.
+// 20^8 user codes are enough for codes valid a few minutes and approved by logged users only.
+const userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+
+// UserCodeLength is the number of characters of a user code, without the separator
+const UserCodeLength = 8
+
+// NewUserCode returns a random user code of the device authorization grant (RFC 8628), normalized.
+// Use FormatUserCode to show it.
+func NewUserCode() (string, error) {
+	var sb strings.Builder
+	max := big.NewInt(int64(len(userCodeAlphabet)))
+	for i := 0; i < UserCodeLength; i++ {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", fmt.Errorf("generate user code: %w", err)
+		}
+		sb.WriteByte(userCodeAlphabet[n.Int64()])
+	}
+	return sb.String(), nil
+}
+
+// NormalizeUserCode returns the user code typed by a user without separators and in upper case,
+// or false if it cannot be a user code.
+func NormalizeUserCode(userCode string) (string, bool) {
+	normalized := strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(userCode))
+	if len(normalized) != UserCodeLength {
+		return "", false
+	}
+	for _, r := range normalized {
+		if !strings.ContainsRune(userCodeAlphabet, r) {
+			return "", false
+		}
+	}
+	return normalized, true
+}
+
+// FormatUserCode splits a normalized user code in two groups, e.g. "WDJB-MJHT", to read it easily.
+func FormatUserCode(userCode string) string {
+	if len(userCode) != UserCodeLength {
+		return userCode
+	}
+	return userCode[:UserCodeLength/2] + "-" + userCode[UserCodeLength/2:]
+}
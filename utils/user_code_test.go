@@ -0,0 +1,42 @@
+package utils
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("using user code utils", func() {
+	When("calling NewUserCode", func() {
+		It("should return a normalized user code", func() {
+			userCode, err := NewUserCode()
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(userCode).To(MatchRegexp(`^[BCDFGHJKLMNPQRSTVWXZ]{8}$`))
+			normalized, ok := NormalizeUserCode(FormatUserCode(userCode))
+			Expect(ok).To(BeTrue())
+			Expect(normalized).To(Equal(userCode))
+		})
+	})
+
+	When("calling NormalizeUserCode", func() {
+		It("should accept user codes typed by users", func() {
+			for _, typed := range []string{"WDJB-MJHT", "wdjb-mjht", "WDJBMJHT", " wdjb mjht "} {
+				normalized, ok := NormalizeUserCode(typed)
+				Expect(ok).To(BeTrue())
+				Expect(normalized).To(Equal("WDJBMJHT"))
+			}
+		})
+
+		It("should reject values that cannot be user codes", func() {
+			for _, typed := range []string{"", "WDJB-MJH", "WDJB-MJHTX", "WDJB-MJH0", "AEIO-UBCD"} {
+				_, ok := NormalizeUserCode(typed)
+				Expect(ok).To(BeFalse())
+			}
+		})
+	})
+
+	When("calling FormatUserCode", func() {
+		It("should split the user code in two groups", func() {
+			Expect(FormatUserCode("WDJBMJHT")).To(Equal("WDJB-MJHT"))
+		})
+	})
+})